@@ -0,0 +1,243 @@
+// Package alerts raises alerts for conditions an operator should notice:
+// nodes going offline, low batteries, detection sensor events, and the
+// relay's own deliveries degrading.
+//
+// A standing alert notifies again every repeat interval until its
+// condition clears. Acknowledging an alert keeps it listed but suppresses
+// repeat notifications for the ack period; snoozing hides it entirely for
+// the snooze period.
+package alerts
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/nodedb"
+)
+
+// Kind is the condition an alert reports
+type Kind string
+
+// Alert kinds
+const (
+	KindOffline    Kind = "offline"
+	KindLowBattery Kind = "low_battery"
+	KindDetection  Kind = "detection"
+	KindCanary     Kind = "canary"
+)
+
+// detectionHold is how long a detection alert stays listed after its
+// last event
+const detectionHold = 30 * time.Minute
+
+// Alert is a raised condition
+type Alert struct {
+	Key    string
+	Kind   Kind
+	Node   uint32
+	Name   string
+	Text   string
+	Raised time.Time // when the condition began
+	Fired  time.Time // when the condition was last seen
+
+	// Seq increases each time the alert notifies, so viewers can tell
+	// which notifications they have already shown
+	Seq uint64
+
+	AckedUntil   time.Time
+	SnoozedUntil time.Time
+	notified     time.Time
+}
+
+// Acked reports whether repeat notifications are suppressed at now
+func (a *Alert) Acked(now time.Time) bool {
+	return now.Before(a.AckedUntil)
+}
+
+// Snoozed reports whether the alert is hidden at now
+func (a *Alert) Snoozed(now time.Time) bool {
+	return now.Before(a.SnoozedUntil)
+}
+
+// Engine tracks active alerts
+type Engine struct {
+	cfg     config.AlertsConfig
+	started time.Time
+
+	mu     sync.Mutex
+	alerts map[string]*Alert
+	seq    uint64
+}
+
+// New creates an alert engine. Only nodes heard after now can raise
+// offline alerts, so nodes long gone before the relay started stay quiet.
+func New(cfg config.AlertsConfig, now time.Time) *Engine {
+	return &Engine{
+		cfg:     cfg,
+		started: now,
+		alerts:  make(map[string]*Alert),
+	}
+}
+
+// Observe raises or clears alerts for a received packet
+func (e *Engine) Observe(p *message.Packet) {
+	now := p.ReceivedAt
+	if now.IsZero() {
+		now = time.Now()
+	}
+	name := nodeName(p.From, p.FromNode)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Hearing from a node at all means it is back
+	e.clear(key(KindOffline, p.From))
+
+	switch payload := p.Payload.(type) {
+	case *message.Telemetry:
+		if e.cfg.LowBattery == 0 || payload.BatteryLevel == 0 {
+			return
+		}
+		if payload.BatteryLevel <= e.cfg.LowBattery {
+			e.raise(KindLowBattery, p.From, name, fmt.Sprintf("%s battery at %d%%", name, payload.BatteryLevel), now, false)
+		} else {
+			e.clear(key(KindLowBattery, p.From))
+		}
+	case *message.DetectionEvent:
+		// Every detection is news, even while the alert stands
+		e.raise(KindDetection, p.From, name, fmt.Sprintf("%s: %s", name, payload.Text), now, true)
+	}
+}
+
+// Check raises offline alerts for nodes not heard within the offline
+// period and expires stale detection alerts
+func (e *Engine) Check(nodes []*nodedb.Node, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.cfg.OfflineAfter > 0 {
+		for _, n := range nodes {
+			if !n.LastHeard.After(e.started) {
+				continue
+			}
+			quiet := now.Sub(n.LastHeard)
+			if quiet < e.cfg.OfflineAfter {
+				continue
+			}
+			name := nodeName(n.Num, &message.NodeInfo{User: n.User})
+			text := fmt.Sprintf("%s not heard for %s", name, quiet.Round(time.Minute))
+			e.raise(KindOffline, n.Num, name, text, now, false)
+		}
+	}
+
+	for k, a := range e.alerts {
+		if a.Kind == KindDetection && now.Sub(a.Fired) >= detectionHold {
+			delete(e.alerts, k)
+		}
+	}
+}
+
+// Canary raises the alert for degraded end-to-end delivery with text, or
+// clears it when text is empty. It concerns the relay rather than a node.
+func (e *Engine) Canary(text string, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if text == "" {
+		e.clear(key(KindCanary, 0))
+		return
+	}
+	e.raise(KindCanary, 0, "relay", text, now, false)
+}
+
+// Active returns the alerts not snoozed at now, newest first
+func (e *Engine) Active(now time.Time) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	active := make([]Alert, 0, len(e.alerts))
+	for _, a := range e.alerts {
+		if !a.Snoozed(now) {
+			active = append(active, *a)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		if !active[i].Raised.Equal(active[j].Raised) {
+			return active[i].Raised.After(active[j].Raised)
+		}
+		return active[i].Key < active[j].Key
+	})
+	return active
+}
+
+// Ack suppresses repeat notifications for an alert for the ack period
+func (e *Engine) Ack(key string, now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	a, ok := e.alerts[key]
+	if ok {
+		a.AckedUntil = now.Add(e.cfg.AckPeriod)
+	}
+	return ok
+}
+
+// Snooze hides an alert for the snooze period
+func (e *Engine) Snooze(key string, now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	a, ok := e.alerts[key]
+	if ok {
+		a.SnoozedUntil = now.Add(e.cfg.SnoozePeriod)
+	}
+	return ok
+}
+
+// raise creates or refreshes an alert and notifies if it is new, a
+// repeat is due, or always is set
+func (e *Engine) raise(kind Kind, node uint32, name, text string, now time.Time, always bool) {
+	k := key(kind, node)
+	a, ok := e.alerts[k]
+	if !ok {
+		a = &Alert{Key: k, Kind: kind, Node: node, Raised: now}
+		e.alerts[k] = a
+	}
+	a.Name = name
+	a.Text = text
+	a.Fired = now
+	if always || a.notified.IsZero() || now.Sub(a.notified) >= e.cfg.Repeat {
+		e.notify(a, now)
+	}
+}
+
+// notify records a notification unless the alert is acked or snoozed
+func (e *Engine) notify(a *Alert, now time.Time) {
+	if a.Acked(now) || a.Snoozed(now) {
+		return
+	}
+	e.seq++
+	a.Seq = e.seq
+	a.notified = now
+}
+
+func (e *Engine) clear(k string) {
+	delete(e.alerts, k)
+}
+
+func key(kind Kind, node uint32) string {
+	return fmt.Sprintf("%s:!%08x", kind, node)
+}
+
+func nodeName(num uint32, info *message.NodeInfo) string {
+	if info != nil && info.User != nil {
+		if info.User.LongName != "" {
+			return info.User.LongName
+		}
+		if info.User.ShortName != "" {
+			return info.User.ShortName
+		}
+	}
+	return fmt.Sprintf("!%08x", num)
+}
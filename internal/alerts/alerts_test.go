@@ -0,0 +1,104 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/nodedb"
+)
+
+func testConfig() config.AlertsConfig {
+	return config.AlertsConfig{
+		OfflineAfter: time.Hour,
+		LowBattery:   20,
+		Repeat:       15 * time.Minute,
+		AckPeriod:    time.Hour,
+		SnoozePeriod: 30 * time.Minute,
+	}
+}
+
+func battery(at time.Time, level uint32) *message.Packet {
+	return &message.Packet{From: 7, ReceivedAt: at, Payload: &message.Telemetry{BatteryLevel: level}}
+}
+
+func TestLowBatteryRepeatsUntilAcked(t *testing.T) {
+	at := time.Unix(1_700_000_000, 0)
+	e := New(testConfig(), at)
+
+	e.Observe(battery(at, 15))
+	active := e.Active(at)
+	if len(active) != 1 || active[0].Kind != KindLowBattery || active[0].Seq != 1 {
+		t.Fatalf("active = %+v", active)
+	}
+
+	// Repeats are held back until the repeat interval passes
+	e.Observe(battery(at.Add(5*time.Minute), 14))
+	if a := e.Active(at)[0]; a.Seq != 1 || a.Text != "!00000007 battery at 14%" {
+		t.Errorf("early repeat: %+v", a)
+	}
+	e.Observe(battery(at.Add(20*time.Minute), 13))
+	if a := e.Active(at)[0]; a.Seq != 2 {
+		t.Errorf("repeat not notified: %+v", a)
+	}
+
+	// Acknowledged alerts stay listed without notifying
+	e.Ack(active[0].Key, at.Add(20*time.Minute))
+	e.Observe(battery(at.Add(40*time.Minute), 12))
+	if a := e.Active(at)[0]; a.Seq != 2 || !a.Acked(at.Add(40*time.Minute)) {
+		t.Errorf("acked alert notified: %+v", a)
+	}
+
+	e.Observe(battery(at.Add(50*time.Minute), 80))
+	if len(e.Active(at)) != 0 {
+		t.Error("alert not cleared by recharged battery")
+	}
+}
+
+func TestDetectionAndSnooze(t *testing.T) {
+	at := time.Unix(1_700_000_000, 0)
+	e := New(testConfig(), at)
+
+	motion := &message.Packet{From: 3, ReceivedAt: at, Payload: &message.DetectionEvent{Text: "Motion detected"},
+		FromNode: &message.NodeInfo{User: &message.User{LongName: "Gate"}}}
+	e.Observe(motion)
+	e.Observe(motion)
+	active := e.Active(at)
+	if len(active) != 1 || active[0].Seq != 2 || active[0].Text != "Gate: Motion detected" {
+		t.Fatalf("active = %+v", active)
+	}
+
+	e.Snooze(active[0].Key, at)
+	if len(e.Active(at.Add(time.Minute))) != 0 {
+		t.Error("snoozed alert listed")
+	}
+	if len(e.Active(at.Add(31*time.Minute))) != 1 {
+		t.Error("alert hidden after snooze period")
+	}
+
+	e.Check(nil, at.Add(detectionHold))
+	if len(e.Active(at.Add(detectionHold))) != 0 {
+		t.Error("stale detection alert kept")
+	}
+}
+
+func TestOffline(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	e := New(testConfig(), start)
+
+	nodes := []*nodedb.Node{
+		{Num: 1, LastHeard: start.Add(time.Minute)},
+		{Num: 2, LastHeard: start.Add(-time.Minute)}, // only heard before startup
+	}
+	e.Check(nodes, start.Add(2*time.Hour))
+	active := e.Active(start)
+	if len(active) != 1 || active[0].Kind != KindOffline || active[0].Node != 1 {
+		t.Fatalf("active = %+v", active)
+	}
+
+	e.Observe(&message.Packet{From: 1, ReceivedAt: start.Add(2 * time.Hour)})
+	if len(e.Active(start)) != 0 {
+		t.Error("offline alert not cleared when node heard")
+	}
+}
@@ -0,0 +1,503 @@
+// Package api provides the embedded HTTP API for dashboards and home
+// automation: relay status, the node database, recent messages, sending
+// text messages to the mesh, the device's canned messages, and end-to-end
+// canaries.
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+	"github.com/iamruinous/meshtastic-message-relay/internal/logging"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/nodedb"
+	"github.com/iamruinous/meshtastic-message-relay/internal/relay"
+)
+
+// MaxTextLength is the longest text message accepted by POST /send
+const MaxTextLength = 200
+
+// sendTimeout bounds delivering a message to the connection
+const sendTimeout = 30 * time.Second
+
+// Server is the HTTP API server
+type Server struct {
+	cfg     config.APIConfig
+	service *relay.Service
+	logger  *zap.Logger
+
+	srv      *http.Server
+	listener net.Listener
+}
+
+// New creates an API server for service
+func New(cfg config.APIConfig, service *relay.Service) *Server {
+	s := &Server{
+		cfg:     cfg,
+		service: service,
+		logger:  logging.With(zap.String("component", "api")),
+	}
+	// Streams end when the server shuts down rather than holding it up
+	base, cancel := context.WithCancel(context.Background())
+	s.srv = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return base },
+	}
+	s.srv.RegisterOnShutdown(cancel)
+	return s
+}
+
+// Handler returns the API routes
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /readyz", s.handleReady)
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.HandleFunc("GET /nodes", s.handleNodes)
+	mux.HandleFunc("GET /nodes/{id}", s.handleNode)
+	mux.HandleFunc("GET /nodes/{id}/metrics", s.handleMetrics)
+	mux.HandleFunc("GET /messages", s.handleMessages)
+	mux.HandleFunc("GET /messages/stream", s.handleStream)
+	mux.HandleFunc("GET /logs", s.handleLogs)
+	mux.HandleFunc("GET /frames", s.handleFrames)
+	mux.HandleFunc("POST /send", s.handleSend)
+	mux.HandleFunc("GET /canary", s.handleCanaries)
+	mux.HandleFunc("POST /canary", s.handleInjectCanary)
+	mux.HandleFunc("GET /notes", s.handleNotes)
+	mux.HandleFunc("POST /notes", s.handleAddNote)
+	mux.HandleFunc("DELETE /notes/{id}", s.handleDeleteNote)
+	mux.HandleFunc("GET /canned", s.handleCanned)
+	mux.HandleFunc("PUT /canned", s.handleSetCanned)
+	return s.authorize(mux)
+}
+
+// Start listens on the configured address and serves in the background
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.cfg.Listen, err)
+	}
+	s.listener = ln
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("API server stopped", zap.Error(err))
+		}
+	}()
+
+	s.logger.Info("API listening", zap.String("addr", ln.Addr().String()))
+	return nil
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return s.cfg.Listen
+	}
+	return s.listener.Addr().String()
+}
+
+// Close stops the server, waiting for active requests until ctx is done
+func (s *Server) Close(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+// authorize requires the bearer token on every request when one is set
+func (s *Server) authorize(next http.Handler) http.Handler {
+	if s.cfg.Token == "" {
+		return next
+	}
+	want := []byte("Bearer " + s.cfg.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Status is the response to GET /status
+type Status struct {
+	Running    bool       `json:"running"`
+	StartedAt  time.Time  `json:"started_at,omitempty"`
+	Uptime     string     `json:"uptime,omitempty"`
+	Connection Connection `json:"connection"`
+	Outputs    []string   `json:"outputs"`
+	// OutputStatus has the deliveries and last error of each output,
+	// disabled ones included
+	OutputStatus []relay.OutputStatus `json:"output_status"`
+	Queues       []Queue              `json:"queues"`
+	Stats        Stats                `json:"stats"`
+	Nodes        int                  `json:"nodes"`
+	Home         *Home                `json:"home,omitempty"`
+	SafeMode     bool                 `json:"safe_mode"`
+}
+
+// Connection describes the relay's connection to the mesh
+type Connection struct {
+	Name      string                    `json:"name,omitempty"`
+	Connected bool                      `json:"connected"`
+	Device    *connection.DeviceProfile `json:"device,omitempty"`
+	// ConfigComplete is set for connections that request the device's
+	// configuration
+	ConfigComplete *bool `json:"config_complete,omitempty"`
+}
+
+// Health is the response to GET /healthz and GET /readyz
+type Health struct {
+	Status     string                    `json:"status"`
+	Connection string                    `json:"connection,omitempty"`
+	LastPacket *time.Time                `json:"last_packet,omitempty"` // last packet relayed from the connection
+	LastFrame  *time.Time                `json:"last_frame,omitempty"`  // last frame from the device (serial and tcp)
+	Device     *connection.DeviceProfile `json:"device,omitempty"`
+	Canary     *CanaryHealth             `json:"canary,omitempty"` // with canary.enabled
+}
+
+// Stats are the relay's message counters
+type Stats struct {
+	Received        uint64 `json:"received"`
+	Sent            uint64 `json:"sent"`
+	Filtered        uint64 `json:"filtered"`
+	IngestDropped   uint64 `json:"ingest_dropped"`
+	Duplicates      uint64 `json:"duplicates"`
+	Errors          uint64 `json:"errors"`
+	Failovers       uint64 `json:"failovers"`
+	StallRecoveries uint64 `json:"stall_recoveries"`
+	DeadLettered    uint64 `json:"dead_lettered"`
+	Redelivered     uint64 `json:"redelivered"`
+	QueueDrops      uint64 `json:"queue_drops"`
+	DeadLetters     int    `json:"dead_letters"`
+}
+
+// Queue is an output's dispatch queue
+type Queue struct {
+	Output   string `json:"output"`
+	Queued   int    `json:"queued"`
+	Capacity int    `json:"capacity"`
+	Dropped  uint64 `json:"dropped"`
+	Blocked  uint64 `json:"blocked"`
+}
+
+// Home is the relay's home position
+type Home struct {
+	Lat    float64 `json:"lat"`
+	Lon    float64 `json:"lon"`
+	Source string  `json:"source"`
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	stats := s.service.GetStats()
+	status := Status{
+		Running:  s.service.IsRunning(),
+		Outputs:  []string{},
+		Queues:   []Queue{},
+		SafeMode: s.service.SafeMode(),
+		Stats: Stats{
+			Received:        stats.MessagesReceived,
+			Sent:            stats.MessagesSent,
+			Filtered:        stats.MessagesFiltered,
+			IngestDropped:   stats.IngestDropped,
+			Duplicates:      stats.Duplicates,
+			Errors:          stats.Errors,
+			Failovers:       stats.Failovers,
+			StallRecoveries: stats.StallRecoveries,
+			DeadLettered:    stats.DeadLettered,
+			Redelivered:     stats.Redelivered,
+			QueueDrops:      stats.QueueDrops,
+			DeadLetters:     stats.DeadLetters,
+		},
+	}
+	if status.Running {
+		status.StartedAt = s.service.StartedAt()
+		status.Uptime = time.Since(status.StartedAt).Round(time.Second).String()
+	}
+	if conn := s.service.GetConnection(); conn != nil {
+		status.Connection = Connection{Name: conn.Name(), Connected: conn.IsConnected(), Device: connection.Profile(conn)}
+		if cs, ok := conn.(connection.ConfigState); ok {
+			complete := cs.ConfigComplete()
+			status.Connection.ConfigComplete = &complete
+		}
+	}
+	for _, out := range s.service.GetOutputs() {
+		status.Outputs = append(status.Outputs, out.Name())
+	}
+	status.OutputStatus = s.service.OutputStatuses()
+	for _, q := range s.service.QueueStats() {
+		status.Queues = append(status.Queues, Queue(q))
+	}
+	if nodes := s.service.Nodes(); nodes != nil {
+		status.Nodes = nodes.Len()
+	}
+	if at, source, ok := s.service.Home().Get(); ok {
+		status.Home = &Home{Lat: at.Lat, Lon: at.Lon, Source: string(source)}
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleHealth reports 200 while the relay is running and connected to
+// the mesh with the device's configuration received, and 503 otherwise
+func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	h := s.health()
+	if h.Status == "ok" || h.Status == "config_incomplete" {
+		h.Device = connection.Profile(s.service.GetConnection())
+	}
+	writeHealth(w, h)
+}
+
+// handleReady reports whether the relay is receiving and delivering data:
+// healthy, with api.max_silence set, a packet arrived within it, and with
+// canaries enabled, they are not degraded
+func (s *Server) handleReady(w http.ResponseWriter, _ *http.Request) {
+	h := s.health()
+	if h.Status == "ok" && s.cfg.MaxSilence > 0 {
+		// Silence counts from startup until the first packet
+		last := s.service.LastPacket()
+		if last.IsZero() {
+			last = s.service.StartedAt()
+		}
+		if time.Since(last) > s.cfg.MaxSilence {
+			h.Status = "stale"
+		}
+	}
+	if h.Status == "ok" && h.Canary != nil && h.Canary.Degraded {
+		h.Status = "degraded"
+	}
+	writeHealth(w, h)
+}
+
+// health reports the relay's state and when it last heard from the
+// connection
+func (s *Server) health() Health {
+	var h Health
+	if t := s.service.LastPacket(); !t.IsZero() {
+		h.LastPacket = &t
+	}
+	conn := s.service.GetConnection()
+	if conn != nil {
+		h.Connection = conn.Name()
+	}
+	if act, ok := conn.(connection.Activity); ok {
+		if t := act.LastFrame(); !t.IsZero() {
+			h.LastFrame = &t
+		}
+	}
+	if tracker := s.service.Canaries(); tracker != nil {
+		ch := newCanaryHealth(tracker.Health())
+		h.Canary = &ch
+	}
+
+	cs, hasConfig := conn.(connection.ConfigState)
+	switch {
+	case !s.service.IsRunning():
+		h.Status = "stopped"
+	case conn == nil || !conn.IsConnected():
+		h.Status = "disconnected"
+	case hasConfig && !cs.ConfigComplete():
+		h.Status = "config_incomplete"
+	default:
+		h.Status = "ok"
+	}
+	return h
+}
+
+// writeHealth answers 200 when h is ok and 503 otherwise
+func writeHealth(w http.ResponseWriter, h Health) {
+	code := http.StatusOK
+	if h.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, h)
+}
+
+func (s *Server) handleNodes(w http.ResponseWriter, _ *http.Request) {
+	nodes := []Node{}
+	if db := s.service.Nodes(); db != nil {
+		for _, n := range db.List() {
+			nodes = append(nodes, s.annotateNode(n))
+		}
+	}
+	writeJSON(w, http.StatusOK, nodes)
+}
+
+func (s *Server) handleNode(w http.ResponseWriter, r *http.Request) {
+	num, err := message.ParseNodeID(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var node *nodedb.Node
+	if db := s.service.Nodes(); db != nil {
+		node = db.Node(num)
+	}
+	if node == nil {
+		writeError(w, http.StatusNotFound, "node not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.annotateNode(node))
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	num, err := message.ParseNodeID(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	since, err := parseSince(r.URL.Query().Get("since"), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var history *nodedb.History
+	if db := s.service.Nodes(); db != nil {
+		history = db.History(num, since)
+	}
+	if history == nil {
+		writeError(w, http.StatusNotFound, "node not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// parseSince accepts an RFC 3339 time or a duration before now, such as
+// "24h". Empty means all history.
+func parseSince(v string, now time.Time) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("since must be an RFC 3339 time or a duration such as 24h")
+}
+
+func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
+	limit, ok := limitParam(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.annotateMessages(s.service.Recent(limit)))
+}
+
+// handleLogs returns the latest log entries, oldest first
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	limit, ok := limitParam(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, logging.Recent(limit))
+}
+
+// handleFrames returns the latest raw frames from the device, oldest
+// first; empty for connections that do not keep them
+func (s *Server) handleFrames(w http.ResponseWriter, r *http.Request) {
+	limit, ok := limitParam(w, r)
+	if !ok {
+		return
+	}
+	frames := []connection.RawFrame{}
+	if h, ok := s.service.GetConnection().(connection.FrameHistory); ok {
+		frames = h.RecentFrames(limit)
+	}
+	writeJSON(w, http.StatusOK, frames)
+}
+
+// limitParam reads the limit query parameter, 0 if absent, writing an
+// error response if it is invalid
+func limitParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+		return 0, false
+	}
+	return n, true
+}
+
+// SendRequest is the body of POST /send
+type SendRequest struct {
+	Text    string `json:"text"`
+	To      string `json:"to,omitempty"` // node ID; empty broadcasts
+	Channel uint32 `json:"channel,omitempty"`
+	WantAck bool   `json:"want_ack,omitempty"`
+}
+
+func (s *Server) handleSend(w http.ResponseWriter, r *http.Request) {
+	if s.service.SafeMode() {
+		writeError(w, http.StatusForbidden, "safe mode is on; sending is disabled")
+		return
+	}
+
+	var req SendRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if req.Text == "" {
+		writeError(w, http.StatusBadRequest, "text is required")
+		return
+	}
+	if len(req.Text) > MaxTextLength {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("text is longer than %d bytes", MaxTextLength))
+		return
+	}
+
+	packet := &message.Packet{
+		Channel: req.Channel,
+		PortNum: message.PortNumTextMessage,
+		Payload: &message.TextMessage{Text: req.Text},
+		WantAck: req.WantAck,
+	}
+	if req.To != "" {
+		to, err := message.ParseNodeID(req.To)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		packet.To = to
+	}
+
+	if conn := s.service.GetConnection(); conn == nil || !conn.IsConnected() {
+		writeError(w, http.StatusServiceUnavailable, "not connected")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), sendTimeout)
+	defer cancel()
+	if err := s.service.Send(ctx, packet); err != nil {
+		s.logger.Warn("Failed to send message", zap.Error(err))
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "sent"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/relay"
+)
+
+func newTestServer(t *testing.T, token string) http.Handler {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Relay.HomeLat, cfg.Relay.HomeLon = 45.5, -122.6
+	service, err := relay.New(cfg)
+	if err != nil {
+		t.Fatalf("relay.New: %v", err)
+	}
+	return New(config.APIConfig{Token: token}, service).Handler()
+}
+
+func do(h http.Handler, method, path, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestStatus(t *testing.T) {
+	h := newTestServer(t, "")
+
+	rec := do(h, "GET", "/status", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code = %d", rec.Code)
+	}
+	var status Status
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if status.Running || status.Home == nil || status.Home.Source != "config" {
+		t.Errorf("status = %+v", status)
+	}
+
+	for _, path := range []string{"/nodes", "/messages?limit=5"} {
+		if rec := do(h, "GET", path, ""); rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" {
+			t.Errorf("%s = %d %s", path, rec.Code, rec.Body)
+		}
+	}
+	if rec := do(h, "GET", "/healthz", ""); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"stopped"`) {
+		t.Errorf("GET /healthz on a stopped relay = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(h, "GET", "/readyz", ""); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"stopped"`) {
+		t.Errorf("GET /readyz on a stopped relay = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(h, "GET", "/nodes/!00000001", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown node = %d", rec.Code)
+	}
+	if rec := do(h, "GET", "/messages?limit=x", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad limit = %d", rec.Code)
+	}
+}
+
+func TestSendValidation(t *testing.T) {
+	h := newTestServer(t, "")
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{`, http.StatusBadRequest},
+		{`{"text": ""}`, http.StatusBadRequest},
+		{`{"text": "` + strings.Repeat("x", MaxTextLength+1) + `"}`, http.StatusBadRequest},
+		{`{"text": "hi", "to": "nope"}`, http.StatusBadRequest},
+		{`{"text": "hi", "to": "!1234abcd"}`, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		if rec := do(h, "POST", "/send", tt.body); rec.Code != tt.code {
+			t.Errorf("POST /send %.40s = %d, want %d", tt.body, rec.Code, tt.code)
+		}
+	}
+}
+
+func TestToken(t *testing.T) {
+	h := newTestServer(t, "secret")
+
+	if rec := do(h, "GET", "/status", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("without token = %d", rec.Code)
+	}
+	if rec := do(h, "GET", "/status", "", "Authorization", "Bearer wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong token = %d", rec.Code)
+	}
+	if rec := do(h, "GET", "/status", "", "Authorization", "Bearer secret"); rec.Code != http.StatusOK {
+		t.Errorf("with token = %d", rec.Code)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Time
+		ok   bool
+	}{
+		{"", time.Time{}, true},
+		{"24h", now.Add(-24 * time.Hour), true},
+		{"2026-02-28T00:00:00Z", time.Date(2026, 2, 28, 0, 0, 0, 0, time.UTC), true},
+		{"-1h", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseSince(tt.in, now)
+		if (err == nil) != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("parseSince(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/canary"
+	"github.com/iamruinous/meshtastic-message-relay/internal/relay"
+)
+
+// CanaryResult is a completed canary. Latencies are in milliseconds.
+type CanaryResult struct {
+	ID         string           `json:"id"`
+	Injected   time.Time        `json:"injected"`
+	LatencyMS  float64          `json:"latency_ms"` // the slowest successful delivery
+	Degraded   bool             `json:"degraded"`
+	Reason     string           `json:"reason,omitempty"`
+	Deliveries []CanaryDelivery `json:"deliveries"`
+}
+
+// CanaryDelivery is one output's handling of a canary
+type CanaryDelivery struct {
+	Output    string  `json:"output"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// CanaryHealth summarizes the recent canaries, in /healthz, /readyz, and
+// GET /canary
+type CanaryHealth struct {
+	Degraded bool          `json:"degraded"`
+	Failing  int           `json:"failing"` // degraded canaries in a row
+	Last     *CanaryResult `json:"last,omitempty"`
+}
+
+// CanaryReport is the response to GET /canary
+type CanaryReport struct {
+	CanaryHealth
+	Results []CanaryResult `json:"results"`
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func newCanaryResult(r canary.Result) CanaryResult {
+	res := CanaryResult{
+		ID:         fmt.Sprintf("%08x", r.ID),
+		Injected:   r.Injected,
+		LatencyMS:  milliseconds(r.Latency),
+		Degraded:   r.Degraded,
+		Reason:     r.Reason,
+		Deliveries: make([]CanaryDelivery, len(r.Deliveries)),
+	}
+	for i, d := range r.Deliveries {
+		res.Deliveries[i] = CanaryDelivery{Output: d.Output, LatencyMS: milliseconds(d.Latency), Error: d.Error}
+	}
+	return res
+}
+
+func newCanaryHealth(h canary.Health) CanaryHealth {
+	ch := CanaryHealth{Degraded: h.Degraded, Failing: h.Failing}
+	if h.Last != nil {
+		last := newCanaryResult(*h.Last)
+		ch.Last = &last
+	}
+	return ch
+}
+
+// handleCanaries lists the latest canaries, oldest first, with the
+// relay's delivery health
+func (s *Server) handleCanaries(w http.ResponseWriter, r *http.Request) {
+	limit, ok := limitParam(w, r)
+	if !ok {
+		return
+	}
+	tracker := s.service.Canaries()
+	if tracker == nil {
+		writeError(w, http.StatusNotFound, relay.ErrCanariesDisabled.Error())
+		return
+	}
+	report := CanaryReport{CanaryHealth: newCanaryHealth(tracker.Health()), Results: []CanaryResult{}}
+	for _, res := range tracker.Results(limit) {
+		report.Results = append(report.Results, newCanaryResult(res))
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleInjectCanary injects a canary and answers with its result once
+// every output has reported, or 202 with its ID when wait=false
+func (s *Server) handleInjectCanary(w http.ResponseWriter, r *http.Request) {
+	id, err := s.service.InjectCanary()
+	switch {
+	case errors.Is(err, relay.ErrCanariesDisabled):
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if r.URL.Query().Get("wait") == "false" {
+		writeJSON(w, http.StatusAccepted, map[string]string{"id": fmt.Sprintf("%08x", id)})
+		return
+	}
+
+	// The canary completes by canary.timeout at the latest
+	res, err := s.service.Canaries().Wait(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, newCanaryResult(res))
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/canned"
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+)
+
+// adminTimeout bounds each admin exchange with the device
+const adminTimeout = 15 * time.Second
+
+// Canned is the device's canned message list, the response to GET /canned
+// and the body of PUT /canned
+type Canned struct {
+	Messages []string `json:"messages"`
+}
+
+// deviceAdmin returns the connection's admin transport, writing an error
+// response when device administration is not possible. Reading the list
+// is an admin request to the radio too, so safe mode refuses both.
+func (s *Server) deviceAdmin(w http.ResponseWriter) (connection.AdminTransport, bool) {
+	if s.service.SafeMode() {
+		writeError(w, http.StatusForbidden, "safe mode is on; device administration is disabled")
+		return nil, false
+	}
+	conn := s.service.GetConnection()
+	if conn == nil || !conn.IsConnected() {
+		writeError(w, http.StatusServiceUnavailable, "not connected")
+		return nil, false
+	}
+	admin, ok := conn.(connection.AdminTransport)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "connection does not support device administration")
+		return nil, false
+	}
+	return admin, true
+}
+
+// handleCanned returns the device's canned messages
+func (s *Server) handleCanned(w http.ResponseWriter, r *http.Request) {
+	admin, ok := s.deviceAdmin(w)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), adminTimeout)
+	defer cancel()
+	messages, err := canned.Get(ctx, admin)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "failed to read canned messages: "+err.Error())
+		return
+	}
+	if messages == nil {
+		messages = []string{}
+	}
+	writeJSON(w, http.StatusOK, Canned{Messages: messages})
+}
+
+// handleSetCanned replaces the device's canned messages; an empty list
+// clears them
+func (s *Server) handleSetCanned(w http.ResponseWriter, r *http.Request) {
+	var req Canned
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if _, err := canned.Join(req.Messages); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	admin, ok := s.deviceAdmin(w)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), adminTimeout)
+	defer cancel()
+	if err := canned.Set(ctx, admin, req.Messages); err != nil {
+		writeError(w, http.StatusBadGateway, "failed to update canned messages: "+err.Error())
+		return
+	}
+	s.logger.Info("Canned messages updated", zap.Int("messages", len(req.Messages)))
+	if req.Messages == nil {
+		req.Messages = []string{}
+	}
+	writeJSON(w, http.StatusOK, req)
+}
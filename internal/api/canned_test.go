@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/relay"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+// adminPlayback is a connection whose device keeps a canned message list
+type adminPlayback struct {
+	*connection.Playback
+	mu   sync.Mutex
+	list string
+}
+
+func (a *adminPlayback) AdminRequest(_ context.Context, msg *meshtastic.AdminMessage) (*meshtastic.AdminMessage, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	list := a.list
+	return &meshtastic.AdminMessage{GetCannedMessagesResponse: &list}, nil
+}
+
+func (a *adminPlayback) SendAdmin(_ context.Context, msg *meshtastic.AdminMessage) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if msg.SetCannedMessages != nil {
+		a.list = *msg.SetCannedMessages
+	}
+	return nil
+}
+
+func TestCanned(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.NodeDB.Path = ""
+	cfg.Outputs = []config.OutputConfig{{
+		Type:    "file",
+		Enabled: true,
+		Options: map[string]interface{}{"path": filepath.Join(t.TempDir(), "out.log"), "format": "json"},
+	}}
+	service, err := relay.New(cfg)
+	if err != nil {
+		t.Fatalf("relay.New: %v", err)
+	}
+
+	// Stay connected until the test is done
+	done := make(chan struct{})
+	device := &adminPlayback{list: "Hi|Bye", Playback: connection.NewPlayback("test", func(func(*message.Packet) error) error {
+		<-done
+		return nil
+	})}
+	service.UseConnection(device)
+	if err := service.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() {
+		close(done)
+		_ = service.Stop()
+	}()
+
+	srv := httptest.NewServer(New(config.APIConfig{}, service).Handler())
+	defer srv.Close()
+	client := NewClient(srv.URL, "")
+
+	ctx := context.Background()
+	if messages, err := client.Canned(ctx); err != nil || !reflect.DeepEqual(messages, []string{"Hi", "Bye"}) {
+		t.Errorf("Canned = %q, %v", messages, err)
+	}
+	if err := client.SetCanned(ctx, []string{"Net at 7", "Copy"}); err != nil {
+		t.Fatalf("SetCanned: %v", err)
+	}
+	if device.list != "Net at 7|Copy" {
+		t.Errorf("device list = %q", device.list)
+	}
+	if err := client.SetCanned(ctx, []string{"a|b"}); err == nil {
+		t.Error("SetCanned with the separator in a message succeeded")
+	}
+	if err := client.SetCanned(ctx, nil); err != nil || device.list != "" {
+		t.Errorf("clearing: list %q, %v", device.list, err)
+	}
+}
+
+func TestCannedUnavailable(t *testing.T) {
+	for _, safe := range []bool{false, true} {
+		cfg := config.DefaultConfig()
+		cfg.Relay.SafeMode = safe
+		service, err := relay.New(cfg)
+		if err != nil {
+			t.Fatalf("relay.New: %v", err)
+		}
+		h := New(config.APIConfig{}, service).Handler()
+
+		// Safe mode refuses device administration; otherwise there is no
+		// connection yet
+		want := http.StatusServiceUnavailable
+		if safe {
+			want = http.StatusForbidden
+		}
+		if rec := do(h, "GET", "/canned", ""); rec.Code != want {
+			t.Errorf("safe mode %v: GET /canned = %d, want %d", safe, rec.Code, want)
+		}
+		if rec := do(h, "PUT", "/canned", `{"messages": ["Copy"]}`); rec.Code != want {
+			t.Errorf("safe mode %v: PUT /canned = %d, want %d", safe, rec.Code, want)
+		}
+	}
+}
+
+func TestCannedValidation(t *testing.T) {
+	h := newTestServer(t, "")
+
+	for _, body := range []string{`{`, `{"messages": ["a|b"]}`} {
+		if rec := do(h, "PUT", "/canned", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("PUT /canned %s = %d", body, rec.Code)
+		}
+	}
+}
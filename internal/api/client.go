@@ -0,0 +1,155 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// requestTimeout bounds the client's requests other than streams
+const requestTimeout = 10 * time.Second
+
+// Client talks to a running relay's API
+type Client struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+// NewClient returns a client for the API at base, such as
+// "http://127.0.0.1:8080", sending token when it is set
+func NewClient(base, token string) *Client {
+	return &Client{base: strings.TrimSuffix(base, "/"), token: token, http: &http.Client{}}
+}
+
+// Status returns the relay's status
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var status Status
+	if err := c.do(ctx, http.MethodGet, "/status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Send sends a text message to the mesh
+func (c *Client) Send(ctx context.Context, req SendRequest) error {
+	return c.do(ctx, http.MethodPost, "/send", req, nil)
+}
+
+// Canned returns the device's canned messages
+func (c *Client) Canned(ctx context.Context) ([]string, error) {
+	var list Canned
+	if err := c.do(ctx, http.MethodGet, "/canned", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Messages, nil
+}
+
+// SetCanned replaces the device's canned messages
+func (c *Client) SetCanned(ctx context.Context, messages []string) error {
+	return c.do(ctx, http.MethodPut, "/canned", Canned{Messages: messages}, nil)
+}
+
+// Stream calls fn with each message the relay receives until ctx is done
+// or the stream fails
+func (c *Client) Stream(ctx context.Context, fn func(*message.Packet)) error {
+	resp, err := c.request(ctx, http.MethodGet, "/messages/stream", nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// Events are an "event:" line, a "data:" line, and a blank line;
+	// comments start with a colon
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var event string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:") && event == "message":
+			var p message.Packet
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &p); err != nil {
+				return fmt.Errorf("invalid message in stream: %w", err)
+			}
+			fn(&p)
+		case line == "":
+			event = ""
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// do sends a request with an optional JSON body and decodes the JSON
+// response into v when it is not nil
+func (c *Client) do(ctx context.Context, method, path string, body, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	resp, err := c.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if v == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid response to %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// request sends a request, turning error responses into errors
+func (c *Client) request(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer func() { _ = resp.Body.Close() }()
+		var e struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		if e.Error == "" {
+			return nil, fmt.Errorf("%s %s: %s", method, path, resp.Status)
+		}
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, e.Error)
+	}
+	return resp, nil
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/relay"
+)
+
+func TestClientStream(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Relay.SafeMode = true
+	cfg.NodeDB.Path = ""
+	cfg.Outputs = []config.OutputConfig{{
+		Type:    "file",
+		Enabled: true,
+		Options: map[string]interface{}{"path": filepath.Join(t.TempDir(), "out.log"), "format": "json"},
+	}}
+	service, err := relay.New(cfg)
+	if err != nil {
+		t.Fatalf("relay.New: %v", err)
+	}
+
+	// Keep sending until the test is done, so the stream sees a packet
+	// whenever it connects
+	done := make(chan struct{})
+	defer close(done)
+	service.UseConnection(connection.NewPlayback("test", func(fn func(*message.Packet) error) error {
+		for id := uint32(1); ; id++ {
+			select {
+			case <-done:
+				return nil
+			case <-time.After(10 * time.Millisecond):
+			}
+			p := &message.Packet{ID: id, From: 0x1234abcd, PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: "hello"}}
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+	}))
+	if err := service.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = service.Stop() }()
+
+	srv := httptest.NewServer(New(config.APIConfig{Token: "secret"}, service).Handler())
+	defer srv.Close()
+
+	if _, err := NewClient(srv.URL, "wrong").Status(context.Background()); err == nil {
+		t.Error("Status with the wrong token succeeded")
+	}
+	client := NewClient(srv.URL+"/", "secret")
+	status, err := client.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if !status.Running || len(status.OutputStatus) != 1 || !status.OutputStatus[0].Enabled {
+		t.Errorf("status = %+v", status)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var got *message.Packet
+	err = client.Stream(ctx, func(p *message.Packet) {
+		if got == nil {
+			got = p
+			cancel()
+		}
+	})
+	if got == nil {
+		t.Fatalf("no message streamed: %v", err)
+	}
+	if got.Text() != "hello" || got.From != 0x1234abcd {
+		t.Errorf("streamed %+v", got)
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/nodedb"
+	"github.com/iamruinous/meshtastic-message-relay/internal/notes"
+)
+
+// Message is a received packet with the notes on it
+type Message struct {
+	*message.Packet
+	Notes []notes.Note `json:"notes,omitempty"`
+}
+
+// Node is a node from the database with the notes on it
+type Node struct {
+	*nodedb.Node
+	Notes []notes.Note `json:"notes,omitempty"`
+}
+
+// NoteRequest is the body of POST /notes. Set node, packet, or both; a
+// packet's sender is looked up in the recent messages when node is empty.
+type NoteRequest struct {
+	Node   string   `json:"node,omitempty"` // node ID
+	Packet uint32   `json:"packet,omitempty"`
+	Text   string   `json:"text"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// annotateMessages pairs packets with their notes
+func (s *Server) annotateMessages(packets []*message.Packet) []Message {
+	store := s.service.Notes()
+	list := make([]Message, len(packets))
+	for i, p := range packets {
+		list[i] = Message{Packet: p}
+		if store != nil {
+			list[i].Notes = store.OnPacket(p)
+		}
+	}
+	return list
+}
+
+// annotateNode pairs a node with its notes
+func (s *Server) annotateNode(n *nodedb.Node) Node {
+	node := Node{Node: n}
+	if store := s.service.Notes(); store != nil {
+		node.Notes = store.OnNode(n.Num)
+	}
+	return node
+}
+
+// handleNotes lists notes, optionally for one node, packet, or tag
+func (s *Server) handleNotes(w http.ResponseWriter, r *http.Request) {
+	store := s.service.Notes()
+	if store == nil {
+		writeError(w, http.StatusServiceUnavailable, "relay is not running")
+		return
+	}
+
+	var q notes.Query
+	params := r.URL.Query()
+	if v := params.Get("node"); v != "" {
+		num, err := message.ParseNodeID(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		q.Node = num
+	}
+	if v := params.Get("packet"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || id == 0 {
+			writeError(w, http.StatusBadRequest, "packet must be a packet id")
+			return
+		}
+		q.Packet = uint32(id)
+	}
+	q.Tag = params.Get("tag")
+	writeJSON(w, http.StatusOK, store.List(q))
+}
+
+func (s *Server) handleAddNote(w http.ResponseWriter, r *http.Request) {
+	store := s.service.Notes()
+	if store == nil {
+		writeError(w, http.StatusServiceUnavailable, "relay is not running")
+		return
+	}
+
+	var req NoteRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 8192)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	note := notes.Note{Packet: req.Packet, Text: req.Text, Tags: req.Tags}
+	if req.Node != "" {
+		num, err := message.ParseNodeID(req.Node)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		note.Node = num
+	} else if req.Packet != 0 {
+		for _, p := range s.service.Recent(0) {
+			if p.ID == req.Packet {
+				note.Node = p.From
+			}
+		}
+	}
+
+	added, err := store.Add(note)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.logger.Info("Note added", zap.Uint64("id", added.ID), zap.Uint32("node", added.Node), zap.Uint32("packet", added.Packet))
+	writeJSON(w, http.StatusCreated, added)
+}
+
+func (s *Server) handleDeleteNote(w http.ResponseWriter, r *http.Request) {
+	store := s.service.Notes()
+	if store == nil {
+		writeError(w, http.StatusServiceUnavailable, "relay is not running")
+		return
+	}
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid note id")
+		return
+	}
+	found, err := store.Delete(id)
+	switch {
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	case !found:
+		writeError(w, http.StatusNotFound, "note not found")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+const (
+	// streamHeartbeat keeps idle streams from being closed by proxies
+	streamHeartbeat = 30 * time.Second
+
+	// streamBuffer is how many messages a stream holds for a slow client
+	// before dropping them
+	streamBuffer = 64
+)
+
+// handleStream streams each message as it is received, as Server-Sent
+// Events named "message" whose data is the message as GET /messages
+// lists it. Clients too slow to keep up miss messages rather than
+// holding up the relay.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	messages, stop := s.service.Subscribe(streamBuffer)
+	defer stop()
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			_, _ = fmt.Fprint(w, ": ping\n\n")
+		case p := <-messages:
+			data, err := json.Marshal(s.annotateMessages([]*message.Packet{p})[0])
+			if err != nil {
+				s.logger.Warn("Failed to encode streamed message", zap.Error(err))
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: message\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
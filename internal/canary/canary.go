@@ -0,0 +1,271 @@
+// Package canary measures end-to-end delivery latency with synthetic text
+// packets the relay injects as if its connection had received them. Each
+// output the relay queues a canary for reports when it confirmed delivery;
+// the canary completes when every one has, or when it times out.
+//
+// A canary is degraded when an output failed or did not confirm in time,
+// when no output took it, or when its slowest delivery took longer than
+// the latency limit. The relay is degraded after enough degraded canaries
+// in a row.
+package canary
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// Delivery is one output's handling of a canary
+type Delivery struct {
+	Output  string
+	Latency time.Duration // from injection until the output confirmed delivery
+	Error   string        // why the delivery failed, empty if it succeeded
+}
+
+// Result is a completed canary
+type Result struct {
+	ID         uint32
+	Injected   time.Time
+	Deliveries []Delivery    // by output name
+	Latency    time.Duration // the slowest successful delivery
+	Degraded   bool
+	Reason     string // why the canary was degraded
+}
+
+// Health summarizes the recent canaries
+type Health struct {
+	Last     *Result // the newest completed canary, nil before the first
+	Failing  int     // degraded canaries in a row, up to the newest
+	Degraded bool    // Failing has reached the configured failures
+}
+
+// Tracker injects canaries and collects their results. It is safe for
+// concurrent use.
+type Tracker struct {
+	cfg    config.CanaryConfig
+	notify func(Result, Health)
+
+	mu      sync.Mutex
+	runs    map[uint32]*run
+	results []Result // oldest first, up to cfg.History
+	failing int
+}
+
+// run is a canary in flight
+type run struct {
+	result     Result
+	queued     map[string]int // outputs yet to report, by name
+	dispatched bool
+	done       chan struct{}
+}
+
+// New creates a tracker. notify, if set, is called with each completed
+// canary and the health that follows from it.
+func New(cfg config.CanaryConfig, notify func(Result, Health)) *Tracker {
+	return &Tracker{
+		cfg:    cfg,
+		notify: notify,
+		runs:   make(map[uint32]*run),
+	}
+}
+
+// Start returns a new canary packet, marked as one, and begins timing it.
+// The canary times out after the configured timeout.
+func (t *Tracker) Start(now time.Time) *message.Packet {
+	t.mu.Lock()
+	id := rand.Uint32N(0xFFFFFFFE) + 1
+	for t.runs[id] != nil {
+		id = rand.Uint32N(0xFFFFFFFE) + 1
+	}
+	t.runs[id] = &run{
+		result: Result{ID: id, Injected: now},
+		queued: make(map[string]int),
+		done:   make(chan struct{}),
+	}
+	t.mu.Unlock()
+
+	time.AfterFunc(t.cfg.Timeout, func() { t.expire(id) })
+
+	return &message.Packet{
+		ID:         id,
+		To:         0xFFFFFFFF,
+		PortNum:    message.PortNumTextMessage,
+		Payload:    &message.TextMessage{Text: fmt.Sprintf("%s %08x", t.cfg.Text, id)},
+		ReceivedAt: now,
+		Canary:     true,
+	}
+}
+
+// Queued records that the relay queued canary id for an output
+func (t *Tracker) Queued(id uint32, output string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if r := t.runs[id]; r != nil {
+		r.queued[output]++
+	}
+}
+
+// Dispatched records that the relay queued canary id for every output it
+// goes to. The canary completes once they have all reported.
+func (t *Tracker) Dispatched(id uint32) {
+	t.mu.Lock()
+	r := t.runs[id]
+	if r == nil {
+		t.mu.Unlock()
+		return
+	}
+	r.dispatched = true
+	t.completeIfDone(r)
+}
+
+// Delivered records an output's delivery of canary id, or the error that
+// kept it from delivering. Packets that are not canaries in flight are
+// ignored.
+func (t *Tracker) Delivered(id uint32, output string, err error, now time.Time) {
+	t.mu.Lock()
+	r := t.runs[id]
+	if r == nil || r.queued[output] == 0 {
+		t.mu.Unlock()
+		return
+	}
+	r.queued[output]--
+	d := Delivery{Output: output, Latency: now.Sub(r.result.Injected)}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	r.result.Deliveries = append(r.result.Deliveries, d)
+	t.completeIfDone(r)
+}
+
+// Wait returns the result of canary id once it completes
+func (t *Tracker) Wait(ctx context.Context, id uint32) (Result, error) {
+	t.mu.Lock()
+	r := t.runs[id]
+	if r == nil {
+		defer t.mu.Unlock()
+		for _, res := range t.results {
+			if res.ID == id {
+				return res, nil
+			}
+		}
+		return Result{}, fmt.Errorf("unknown canary %08x", id)
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return r.result, nil
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	}
+}
+
+// Results returns up to limit of the newest completed canaries, oldest
+// first. A limit of zero or less returns all that are kept.
+func (t *Tracker) Results(limit int) []Result {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list := t.results
+	if limit > 0 && len(list) > limit {
+		list = list[len(list)-limit:]
+	}
+	return append([]Result(nil), list...)
+}
+
+// Health summarizes the completed canaries
+func (t *Tracker) Health() Health {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.health()
+}
+
+func (t *Tracker) health() Health {
+	h := Health{Failing: t.failing, Degraded: t.failing >= t.cfg.Failures}
+	if n := len(t.results); n > 0 {
+		last := t.results[n-1]
+		h.Last = &last
+	}
+	return h
+}
+
+// expire completes canary id with the outputs yet to report as failed
+func (t *Tracker) expire(id uint32) {
+	t.mu.Lock()
+	r := t.runs[id]
+	if r == nil {
+		t.mu.Unlock()
+		return
+	}
+	for output, n := range r.queued {
+		for ; n > 0; n-- {
+			r.result.Deliveries = append(r.result.Deliveries, Delivery{
+				Output:  output,
+				Latency: t.cfg.Timeout,
+				Error:   "not confirmed within " + t.cfg.Timeout.String(),
+			})
+		}
+	}
+	r.queued = nil
+	r.dispatched = true
+	t.completeIfDone(r)
+}
+
+// completeIfDone completes r when every output it was queued for has
+// reported. It is called with t.mu held and releases it.
+func (t *Tracker) completeIfDone(r *run) {
+	for _, n := range r.queued {
+		if n > 0 {
+			t.mu.Unlock()
+			return
+		}
+	}
+	if !r.dispatched {
+		t.mu.Unlock()
+		return
+	}
+
+	res := &r.result
+	sort.SliceStable(res.Deliveries, func(i, j int) bool {
+		return res.Deliveries[i].Output < res.Deliveries[j].Output
+	})
+	failed := 0
+	for _, d := range res.Deliveries {
+		if d.Error != "" {
+			failed++
+		} else if d.Latency > res.Latency {
+			res.Latency = d.Latency
+		}
+	}
+	switch {
+	case len(res.Deliveries) == 0:
+		res.Degraded, res.Reason = true, "no output took the canary"
+	case failed > 0:
+		res.Degraded, res.Reason = true, fmt.Sprintf("%d of %d outputs failed", failed, len(res.Deliveries))
+	case t.cfg.MaxLatency > 0 && res.Latency > t.cfg.MaxLatency:
+		res.Degraded, res.Reason = true, fmt.Sprintf("latency %s over %s", res.Latency.Round(time.Millisecond), t.cfg.MaxLatency)
+	}
+
+	delete(t.runs, res.ID)
+	t.results = append(t.results, *res)
+	if len(t.results) > t.cfg.History {
+		t.results = t.results[len(t.results)-t.cfg.History:]
+	}
+	if res.Degraded {
+		t.failing++
+	} else {
+		t.failing = 0
+	}
+	h := t.health()
+	close(r.done)
+	t.mu.Unlock()
+
+	if t.notify != nil {
+		t.notify(*res, h)
+	}
+}
@@ -0,0 +1,129 @@
+package canary
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func testConfig() config.CanaryConfig {
+	return config.CanaryConfig{
+		Text:       "canary",
+		Timeout:    time.Minute,
+		MaxLatency: 5 * time.Second,
+		Failures:   2,
+		History:    3,
+	}
+}
+
+func TestCanaryCompletesWhenOutputsReport(t *testing.T) {
+	var notified []Result
+	tr := New(testConfig(), func(r Result, _ Health) { notified = append(notified, r) })
+	at := time.Unix(1_700_000_000, 0)
+
+	p := tr.Start(at)
+	if !p.Canary || p.PortNum != message.PortNumTextMessage {
+		t.Fatalf("canary packet = %+v", p)
+	}
+	tr.Queued(p.ID, "stdout")
+	tr.Queued(p.ID, "webhook")
+	tr.Dispatched(p.ID)
+
+	tr.Delivered(p.ID, "stdout", nil, at.Add(10*time.Millisecond))
+	if len(notified) != 0 {
+		t.Fatal("completed before every output reported")
+	}
+	tr.Delivered(p.ID, "webhook", nil, at.Add(300*time.Millisecond))
+
+	res, err := tr.Wait(context.Background(), p.ID)
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if res.Degraded || res.Latency != 300*time.Millisecond || len(res.Deliveries) != 2 {
+		t.Errorf("result = %+v", res)
+	}
+	if len(notified) != 1 {
+		t.Errorf("notified %d times, want 1", len(notified))
+	}
+}
+
+func TestCanaryDegradedAfterFailures(t *testing.T) {
+	tr := New(testConfig(), nil)
+	at := time.Unix(1_700_000_000, 0)
+
+	run := func(latency time.Duration, err error) Result {
+		p := tr.Start(at)
+		tr.Queued(p.ID, "webhook")
+		tr.Dispatched(p.ID)
+		tr.Delivered(p.ID, "webhook", err, at.Add(latency))
+		res, _ := tr.Wait(context.Background(), p.ID)
+		return res
+	}
+
+	if res := run(6*time.Second, nil); !res.Degraded || res.Reason != "latency 6s over 5s" {
+		t.Errorf("slow canary = %+v", res)
+	}
+	if tr.Health().Degraded {
+		t.Error("degraded after a single slow canary")
+	}
+	if res := run(time.Second, errors.New("refused")); !res.Degraded || res.Reason != "1 of 1 outputs failed" {
+		t.Errorf("failed canary = %+v", res)
+	}
+	if h := tr.Health(); !h.Degraded || h.Failing != 2 {
+		t.Errorf("health = %+v", h)
+	}
+
+	run(time.Second, nil)
+	if h := tr.Health(); h.Degraded || h.Failing != 0 || h.Last == nil || h.Last.Degraded {
+		t.Errorf("health after recovery = %+v", h)
+	}
+
+	run(time.Second, nil)
+	if got := tr.Results(0); len(got) != 3 {
+		t.Errorf("kept %d results, want history of 3", len(got))
+	}
+}
+
+func TestCanaryTimesOut(t *testing.T) {
+	cfg := testConfig()
+	cfg.Timeout = 20 * time.Millisecond
+	tr := New(cfg, nil)
+
+	p := tr.Start(time.Now())
+	tr.Queued(p.ID, "slow")
+	tr.Dispatched(p.ID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	res, err := tr.Wait(ctx, p.ID)
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if !res.Degraded || len(res.Deliveries) != 1 || res.Deliveries[0].Error == "" {
+		t.Errorf("timed out canary = %+v", res)
+	}
+
+	// A delivery after the timeout is ignored
+	tr.Delivered(p.ID, "slow", nil, time.Now())
+	if n := len(tr.Results(0)); n != 1 {
+		t.Errorf("results = %d, want 1", n)
+	}
+}
+
+func TestCanaryWithoutOutputs(t *testing.T) {
+	tr := New(testConfig(), nil)
+	p := tr.Start(time.Now())
+	tr.Dispatched(p.ID)
+
+	res, err := tr.Wait(context.Background(), p.ID)
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if !res.Degraded || res.Reason != "no output took the canary" {
+		t.Errorf("result = %+v", res)
+	}
+}
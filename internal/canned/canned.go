@@ -0,0 +1,84 @@
+// Package canned reads and updates the canned message module's message
+// list on a Meshtastic device.
+package canned
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+// MaxLength is the longest message list the firmware stores, including
+// separators
+const MaxLength = 200
+
+var (
+	// ErrTooLong indicates the joined message list exceeds MaxLength
+	ErrTooLong = errors.New("canned messages too long")
+
+	// ErrInvalidMessage indicates a message is empty or contains the separator
+	ErrInvalidMessage = errors.New("invalid canned message")
+)
+
+// Admin is the connection capability needed to manage canned messages.
+// It is satisfied by connection.AdminTransport.
+type Admin interface {
+	AdminRequest(ctx context.Context, msg *meshtastic.AdminMessage) (*meshtastic.AdminMessage, error)
+	SendAdmin(ctx context.Context, msg *meshtastic.AdminMessage) error
+}
+
+// Get returns the canned messages configured on the device
+func Get(ctx context.Context, admin Admin) ([]string, error) {
+	resp, err := admin.AdminRequest(ctx, &meshtastic.AdminMessage{GetCannedMessagesRequest: true})
+	if err != nil {
+		return nil, err
+	}
+	if resp.GetCannedMessagesResponse == nil {
+		return nil, fmt.Errorf("device did not return canned messages")
+	}
+	return Split(*resp.GetCannedMessagesResponse), nil
+}
+
+// Set replaces the canned messages on the device. An empty list clears them.
+func Set(ctx context.Context, admin Admin, messages []string) error {
+	joined, err := Join(messages)
+	if err != nil {
+		return err
+	}
+
+	// Reading first establishes the admin session passkey required for writes
+	if _, err := Get(ctx, admin); err != nil {
+		return fmt.Errorf("failed to open admin session: %w", err)
+	}
+
+	return admin.SendAdmin(ctx, &meshtastic.AdminMessage{SetCannedMessages: &joined})
+}
+
+// Split parses the device's message list into individual messages
+func Split(list string) []string {
+	var messages []string
+	for _, m := range strings.Split(list, meshtastic.CannedMessageSeparator) {
+		if m = strings.TrimSpace(m); m != "" {
+			messages = append(messages, m)
+		}
+	}
+	return messages
+}
+
+// Join validates messages and encodes them as a device message list
+func Join(messages []string) (string, error) {
+	for _, m := range messages {
+		if strings.TrimSpace(m) == "" || strings.Contains(m, meshtastic.CannedMessageSeparator) {
+			return "", fmt.Errorf("%w: %q", ErrInvalidMessage, m)
+		}
+	}
+
+	joined := strings.Join(messages, meshtastic.CannedMessageSeparator)
+	if len(joined) > MaxLength {
+		return "", fmt.Errorf("%w: %d bytes exceeds %d", ErrTooLong, len(joined), MaxLength)
+	}
+	return joined, nil
+}
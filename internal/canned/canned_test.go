@@ -0,0 +1,95 @@
+package canned
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+// fakeAdmin stores canned messages like the device's module config
+type fakeAdmin struct {
+	list    string
+	passkey []byte
+	writes  int
+}
+
+func (f *fakeAdmin) AdminRequest(_ context.Context, msg *meshtastic.AdminMessage) (*meshtastic.AdminMessage, error) {
+	// Round trip through the wire format like a real device would
+	req, err := meshtastic.ParseAdminMessage(msg.Marshal())
+	if err != nil {
+		return nil, err
+	}
+	if !req.GetCannedMessagesRequest {
+		return nil, errors.New("unexpected request")
+	}
+	list := f.list
+	return meshtastic.ParseAdminMessage((&meshtastic.AdminMessage{
+		GetCannedMessagesResponse: &list,
+		SessionPasskey:            f.passkey,
+	}).Marshal())
+}
+
+func (f *fakeAdmin) SendAdmin(_ context.Context, msg *meshtastic.AdminMessage) error {
+	req, err := meshtastic.ParseAdminMessage(msg.Marshal())
+	if err != nil {
+		return err
+	}
+	if req.SetCannedMessages == nil {
+		return errors.New("unexpected write")
+	}
+	f.list = *req.SetCannedMessages
+	f.writes++
+	return nil
+}
+
+func TestSplit(t *testing.T) {
+	got := Split("Hi| On my way |Need help||")
+	want := []string{"Hi", "On my way", "Need help"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Split() = %q, want %q", got, want)
+	}
+
+	if got := Split(""); len(got) != 0 {
+		t.Errorf("Split(\"\") = %q, want empty", got)
+	}
+}
+
+func TestJoinValidation(t *testing.T) {
+	if _, err := Join([]string{"ok", "a|b"}); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("Expected ErrInvalidMessage, got %v", err)
+	}
+	if _, err := Join([]string{strings.Repeat("x", MaxLength+1)}); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Expected ErrTooLong, got %v", err)
+	}
+}
+
+func TestGetSet(t *testing.T) {
+	admin := &fakeAdmin{list: "Hi|Bye", passkey: []byte{1, 2, 3}}
+
+	messages, err := Get(context.Background(), admin)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !reflect.DeepEqual(messages, []string{"Hi", "Bye"}) {
+		t.Errorf("Get() = %q", messages)
+	}
+
+	if err := Set(context.Background(), admin, []string{"Net at 7", "Copy"}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if admin.list != "Net at 7|Copy" || admin.writes != 1 {
+		t.Errorf("Device list = %q after %d writes", admin.list, admin.writes)
+	}
+
+	// Clearing must still send the (empty) field
+	if err := Set(context.Background(), admin, nil); err != nil {
+		t.Fatalf("Set(nil) failed: %v", err)
+	}
+	if admin.list != "" || admin.writes != 2 {
+		t.Errorf("Device list = %q after %d writes, want cleared", admin.list, admin.writes)
+	}
+}
@@ -0,0 +1,321 @@
+// Package capture records raw FromRadio frames to an indexed, compressed
+// capture file that can be read back by time range without loading the
+// whole file, so multi-day captures stay quick to decode and export.
+//
+// A capture file is a header followed by blocks and, once the capture is
+// closed, an index:
+//
+//	header   "MRCAP001"
+//	block    "MRB1", frames uint32, compressed size uint32, raw size uint32,
+//	         first and last frame time int64 (Unix ns), then the frames
+//	         compressed as one zstd frame
+//	index    "MRI1", blocks uint32, then per block its offset uint64, frames
+//	         uint32, and first and last frame time int64
+//	trailer  index offset uint64, "MRCAPEND"
+//
+// Integers are big-endian. Inside a block each frame is its time after the
+// block's first frame in ns and its length, both uvarints, then its bytes.
+//
+// A capture that was not closed, e.g. after a crash, has no index; its
+// block headers are read instead. A block is written out once it holds
+// blockFrames frames or blockBytes bytes, or when a frame arrives
+// blockAge after its first; frames in the block being filled are lost in
+// a crash.
+package capture
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	fileMagic    = "MRCAP001"
+	blockMagic   = "MRB1"
+	indexMagic   = "MRI1"
+	trailerMagic = "MRCAPEND"
+
+	blockHeaderSize = 4 + 4 + 4 + 4 + 8 + 8
+	indexEntrySize  = 8 + 4 + 8 + 8
+	trailerSize     = 8 + 8
+)
+
+// Blocks are written out once they hold blockFrames frames or blockBytes
+// bytes, or their first frame is blockAge old
+const (
+	blockFrames = 1024
+	blockBytes  = 256 * 1024
+	blockAge    = 30 * time.Second
+)
+
+// maxFrameSize bounds a frame's length when reading, so a damaged file
+// cannot make the reader allocate without limit
+const maxFrameSize = 1 << 20
+
+// ErrNotCapture is returned for files that are not capture files
+var ErrNotCapture = errors.New("not a capture file")
+
+// Frame is a raw FromRadio frame and when it was received
+type Frame struct {
+	Seq  uint64    `json:"seq"` // position in the capture, from 1
+	At   time.Time `json:"at"`
+	Data []byte    `json:"data"`
+}
+
+// Block describes a block of frames
+type Block struct {
+	Offset  int64
+	Frames  int
+	First   time.Time
+	Last    time.Time
+	RawSize int // uncompressed size of the frames, 0 when read from the index
+	Size    int // compressed size, 0 when read from the index
+}
+
+func (b *Block) overlaps(from, to time.Time) bool {
+	return (from.IsZero() || !b.Last.Before(from)) && (to.IsZero() || !b.First.After(to))
+}
+
+// Writer records frames to a capture file. It is safe for concurrent use.
+type Writer struct {
+	mu      sync.Mutex
+	f       *os.File
+	enc     *zstd.Encoder
+	blocks  []Block
+	end     int64 // where the next block goes
+	pending []byte
+	frames  int
+	first   time.Time
+	last    time.Time
+}
+
+// Create opens a capture file for recording. Frames are added after those
+// of an existing capture.
+func Create(path string) (*Writer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture: %w", err)
+	}
+	w := &Writer{f: f}
+
+	st, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to open capture: %w", err)
+	}
+	if st.Size() == 0 {
+		if _, err := f.Write([]byte(fileMagic)); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to write capture: %w", err)
+		}
+		w.end = int64(len(fileMagic))
+	} else {
+		if w.blocks, w.end, err = readBlocks(f, st.Size()); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		// Drop the index; a new one is written on close
+		if err := f.Truncate(w.end); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to open capture: %w", err)
+		}
+	}
+
+	if w.enc, err = zstd.NewWriter(nil); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write records a frame received at at
+func (w *Writer) Write(at time.Time, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return os.ErrClosed
+	}
+
+	// Frames are kept in time order within a block even if the clock
+	// steps back
+	if w.frames > 0 && at.Before(w.last) {
+		at = w.last
+	}
+	if w.frames == 0 {
+		w.first = at
+	} else if at.Sub(w.first) >= blockAge {
+		if err := w.flush(); err != nil {
+			return err
+		}
+		w.first = at
+	}
+	w.last = at
+
+	w.pending = binary.AppendUvarint(w.pending, uint64(at.Sub(w.first)))
+	w.pending = binary.AppendUvarint(w.pending, uint64(len(data)))
+	w.pending = append(w.pending, data...)
+	w.frames++
+	if w.frames >= blockFrames || len(w.pending) >= blockBytes {
+		return w.flush()
+	}
+	return nil
+}
+
+// Flush writes out the frames recorded so far
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return os.ErrClosed
+	}
+	return w.flush()
+}
+
+func (w *Writer) flush() error {
+	if w.frames == 0 {
+		return nil
+	}
+	compressed := w.enc.EncodeAll(w.pending, nil)
+	b := Block{
+		Offset:  w.end,
+		Frames:  w.frames,
+		First:   w.first,
+		Last:    w.last,
+		RawSize: len(w.pending),
+		Size:    len(compressed),
+	}
+
+	hdr := make([]byte, 0, blockHeaderSize+len(compressed))
+	hdr = append(hdr, blockMagic...)
+	hdr = binary.BigEndian.AppendUint32(hdr, uint32(b.Frames))
+	hdr = binary.BigEndian.AppendUint32(hdr, uint32(b.Size))
+	hdr = binary.BigEndian.AppendUint32(hdr, uint32(b.RawSize))
+	hdr = binary.BigEndian.AppendUint64(hdr, uint64(b.First.UnixNano()))
+	hdr = binary.BigEndian.AppendUint64(hdr, uint64(b.Last.UnixNano()))
+	if _, err := w.f.WriteAt(append(hdr, compressed...), w.end); err != nil {
+		return fmt.Errorf("failed to write capture: %w", err)
+	}
+
+	w.end += int64(blockHeaderSize + len(compressed))
+	w.blocks = append(w.blocks, b)
+	w.pending = w.pending[:0]
+	w.frames = 0
+	return nil
+}
+
+// Close writes out the remaining frames and the index
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return nil
+	}
+	err := w.flush()
+	if err == nil {
+		err = w.writeIndex()
+	}
+	_ = w.enc.Close()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	w.f = nil
+	return err
+}
+
+func (w *Writer) writeIndex() error {
+	buf := make([]byte, 0, 8+len(w.blocks)*indexEntrySize+trailerSize)
+	buf = append(buf, indexMagic...)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(w.blocks)))
+	for _, b := range w.blocks {
+		buf = binary.BigEndian.AppendUint64(buf, uint64(b.Offset))
+		buf = binary.BigEndian.AppendUint32(buf, uint32(b.Frames))
+		buf = binary.BigEndian.AppendUint64(buf, uint64(b.First.UnixNano()))
+		buf = binary.BigEndian.AppendUint64(buf, uint64(b.Last.UnixNano()))
+	}
+	buf = binary.BigEndian.AppendUint64(buf, uint64(w.end))
+	buf = append(buf, trailerMagic...)
+	if _, err := w.f.WriteAt(buf, w.end); err != nil {
+		return fmt.Errorf("failed to write capture index: %w", err)
+	}
+	return nil
+}
+
+// readBlocks returns a capture's blocks and where its last block ends,
+// from the index when the capture was closed and from the block headers
+// otherwise
+func readBlocks(r io.ReaderAt, size int64) ([]Block, int64, error) {
+	magic := make([]byte, len(fileMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil || string(magic) != fileMagic {
+		return nil, 0, ErrNotCapture
+	}
+	if blocks, end, ok := readIndex(r, size); ok {
+		return blocks, end, nil
+	}
+
+	var blocks []Block
+	off := int64(len(fileMagic))
+	hdr := make([]byte, blockHeaderSize)
+	for off+blockHeaderSize <= size {
+		if _, err := r.ReadAt(hdr, off); err != nil || string(hdr[:4]) != blockMagic {
+			break
+		}
+		b := parseBlockHeader(hdr, off)
+		if off+blockHeaderSize+int64(b.Size) > size {
+			// Cut short while being written
+			break
+		}
+		blocks = append(blocks, b)
+		off += blockHeaderSize + int64(b.Size)
+	}
+	return blocks, off, nil
+}
+
+func readIndex(r io.ReaderAt, size int64) ([]Block, int64, bool) {
+	if size < int64(len(fileMagic))+8+trailerSize {
+		return nil, 0, false
+	}
+	trailer := make([]byte, trailerSize)
+	if _, err := r.ReadAt(trailer, size-trailerSize); err != nil || string(trailer[8:]) != trailerMagic {
+		return nil, 0, false
+	}
+	start := int64(binary.BigEndian.Uint64(trailer))
+	if start < int64(len(fileMagic)) || start+8 > size-trailerSize {
+		return nil, 0, false
+	}
+	index := make([]byte, size-trailerSize-start)
+	if _, err := r.ReadAt(index, start); err != nil || string(index[:4]) != indexMagic {
+		return nil, 0, false
+	}
+	n := int(binary.BigEndian.Uint32(index[4:]))
+	if len(index) != 8+n*indexEntrySize {
+		return nil, 0, false
+	}
+	blocks := make([]Block, n)
+	for i := range blocks {
+		e := index[8+i*indexEntrySize:]
+		blocks[i] = Block{
+			Offset: int64(binary.BigEndian.Uint64(e)),
+			Frames: int(binary.BigEndian.Uint32(e[8:])),
+			First:  time.Unix(0, int64(binary.BigEndian.Uint64(e[12:]))).UTC(),
+			Last:   time.Unix(0, int64(binary.BigEndian.Uint64(e[20:]))).UTC(),
+		}
+	}
+	return blocks, start, true
+}
+
+func parseBlockHeader(hdr []byte, off int64) Block {
+	return Block{
+		Offset:  off,
+		Frames:  int(binary.BigEndian.Uint32(hdr[4:])),
+		Size:    int(binary.BigEndian.Uint32(hdr[8:])),
+		RawSize: int(binary.BigEndian.Uint32(hdr[12:])),
+		First:   time.Unix(0, int64(binary.BigEndian.Uint64(hdr[16:]))).UTC(),
+		Last:    time.Unix(0, int64(binary.BigEndian.Uint64(hdr[24:]))).UTC(),
+	}
+}
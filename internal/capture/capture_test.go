@@ -0,0 +1,93 @@
+package capture
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCapture(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "radio.mrcap")
+	start := time.Date(2025, 6, 1, 18, 0, 0, 0, time.UTC)
+	frame := func(i int) []byte { return []byte(fmt.Sprintf("frame %d", i)) }
+
+	// 100 frames 10s apart fill a block every 30s
+	w, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := w.Write(start.Add(time.Duration(i)*10*time.Second), frame(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Left unclosed, as after a crash, with the last block written out
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := r.Info(); info.Frames != 100 || info.Blocks != 34 || info.Indexed || !info.Last.Equal(start.Add(990*time.Second)) {
+		t.Errorf("info of unclosed capture = %+v", info)
+	}
+	_ = r.Close()
+
+	// Recording resumes after the existing frames
+	_ = w.Close()
+	w, err = Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(start.Add(time.Hour), frame(100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = r.Close() }()
+	info := r.Info()
+	if info.Frames != 101 || !info.Indexed || !info.First.Equal(start) || !info.Last.Equal(start.Add(time.Hour)) {
+		t.Errorf("info = %+v", info)
+	}
+
+	var got []Frame
+	err = r.Range(start.Add(95*time.Second), start.Add(130*time.Second), func(f Frame) error {
+		got = append(got, f)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 4 || got[0].Seq != 11 || !bytes.Equal(got[0].Data, frame(10)) || !got[3].At.Equal(start.Add(130*time.Second)) {
+		t.Errorf("range = %+v", got)
+	}
+
+	n := 0
+	if err := r.Range(time.Time{}, time.Time{}, func(f Frame) error {
+		if !bytes.Equal(f.Data, frame(n)) || f.Seq != uint64(n+1) {
+			return fmt.Errorf("frame %d = %d %q", n, f.Seq, f.Data)
+		}
+		n++
+		return nil
+	}); err != nil || n != 101 {
+		t.Errorf("read %d frames: %v", n, err)
+	}
+
+	if err := os.WriteFile(path, []byte("# frame 1, 3 bytes\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Error("hexdump opened as a capture")
+	}
+}
@@ -0,0 +1,96 @@
+package capture
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// LinkTypeUser0 is the pcap link type frames are exported with. In
+// Wireshark, map DLT_USER 147 to the protobuf dissector with the message
+// type meshtastic.FromRadio (and the Meshtastic .proto files on its
+// search path) to decode them.
+const LinkTypeUser0 = 147
+
+// pcapng block types and option codes
+const (
+	pcapngSectionHeader  = 0x0A0D0D0A
+	pcapngInterface      = 0x00000001
+	pcapngEnhancedPacket = 0x00000006
+	pcapngByteOrderMagic = 0x1A2B3C4D
+
+	pcapngOptEnd         = 0
+	pcapngOptShbUserAppl = 4
+	pcapngOptIfName      = 2
+	pcapngOptIfTsresol   = 9
+)
+
+// PcapngWriter writes frames as a pcapng file, one packet per frame with
+// microsecond timestamps, for Wireshark and other pcap tools
+type PcapngWriter struct {
+	w io.Writer
+}
+
+// NewPcapngWriter writes the pcapng section and interface headers to w
+// and returns a writer for the frames
+func NewPcapngWriter(w io.Writer, app string) (*PcapngWriter, error) {
+	p := &PcapngWriter{w: w}
+
+	shb := binary.LittleEndian.AppendUint32(nil, pcapngByteOrderMagic)
+	shb = binary.LittleEndian.AppendUint16(shb, 1) // version 1.0
+	shb = binary.LittleEndian.AppendUint16(shb, 0)
+	shb = binary.LittleEndian.AppendUint64(shb, ^uint64(0)) // section length not given
+	shb = appendOption(shb, pcapngOptShbUserAppl, []byte(app))
+	shb = appendOption(shb, pcapngOptEnd, nil)
+	if err := p.block(pcapngSectionHeader, shb); err != nil {
+		return nil, err
+	}
+
+	idb := binary.LittleEndian.AppendUint16(nil, LinkTypeUser0)
+	idb = binary.LittleEndian.AppendUint16(idb, 0)
+	idb = binary.LittleEndian.AppendUint32(idb, 0) // no snapshot length
+	idb = appendOption(idb, pcapngOptIfName, []byte("meshtastic"))
+	idb = appendOption(idb, pcapngOptIfTsresol, []byte{6}) // microseconds
+	idb = appendOption(idb, pcapngOptEnd, nil)
+	if err := p.block(pcapngInterface, idb); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Write writes a frame as a packet
+func (p *PcapngWriter) Write(f Frame) error {
+	ts := uint64(f.At.UnixMicro())
+	epb := binary.LittleEndian.AppendUint32(nil, 0) // interface
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(ts>>32))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(ts))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(len(f.Data)))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(len(f.Data)))
+	epb = append(epb, pad(f.Data)...)
+	return p.block(pcapngEnhancedPacket, epb)
+}
+
+// block writes a block with its type and both copies of its length
+func (p *PcapngWriter) block(typ uint32, body []byte) error {
+	size := uint32(12 + len(body))
+	buf := binary.LittleEndian.AppendUint32(nil, typ)
+	buf = binary.LittleEndian.AppendUint32(buf, size)
+	buf = append(buf, body...)
+	buf = binary.LittleEndian.AppendUint32(buf, size)
+	_, err := p.w.Write(buf)
+	return err
+}
+
+// appendOption appends a pcapng option, padded to 32 bits
+func appendOption(buf []byte, code uint16, value []byte) []byte {
+	buf = binary.LittleEndian.AppendUint16(buf, code)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(value)))
+	return append(buf, pad(value)...)
+}
+
+// pad returns b padded with zeros to a multiple of 4 bytes
+func pad(b []byte) []byte {
+	if n := len(b) % 4; n != 0 {
+		b = append(b[:len(b):len(b)], make([]byte, 4-n)...)
+	}
+	return b
+}
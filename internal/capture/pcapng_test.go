@@ -0,0 +1,69 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestPcapngWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewPcapngWriter(&buf, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2025, 6, 1, 18, 0, 0, 123456000, time.UTC)
+	frames := [][]byte{[]byte("abc"), []byte("abcd"), nil}
+	for i, data := range frames {
+		if err := w.Write(Frame{Seq: uint64(i), At: at, Data: data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Walk the blocks, checking each is padded and closed by its length
+	var types []uint32
+	var packets [][]byte
+	b := buf.Bytes()
+	for len(b) > 0 {
+		if len(b) < 12 {
+			t.Fatalf("%d trailing bytes", len(b))
+		}
+		typ, size := binary.LittleEndian.Uint32(b), binary.LittleEndian.Uint32(b[4:])
+		if size%4 != 0 || int(size) > len(b) || binary.LittleEndian.Uint32(b[size-4:]) != size {
+			t.Fatalf("block %#x has bad length %d", typ, size)
+		}
+		body := b[8 : size-4]
+		switch typ {
+		case pcapngSectionHeader:
+			if binary.LittleEndian.Uint32(body) != pcapngByteOrderMagic {
+				t.Error("section header lacks the byte order magic")
+			}
+		case pcapngInterface:
+			if lt := binary.LittleEndian.Uint16(body); lt != LinkTypeUser0 {
+				t.Errorf("link type = %d", lt)
+			}
+		case pcapngEnhancedPacket:
+			ts := uint64(binary.LittleEndian.Uint32(body[4:]))<<32 | uint64(binary.LittleEndian.Uint32(body[8:]))
+			if ts != uint64(at.UnixMicro()) {
+				t.Errorf("timestamp = %d, want %d", ts, at.UnixMicro())
+			}
+			n := binary.LittleEndian.Uint32(body[12:])
+			if binary.LittleEndian.Uint32(body[16:]) != n {
+				t.Error("captured and original lengths differ")
+			}
+			packets = append(packets, body[20:20+n])
+		}
+		types = append(types, typ)
+		b = b[size:]
+	}
+
+	if len(types) != 5 || types[0] != pcapngSectionHeader || types[1] != pcapngInterface {
+		t.Fatalf("block types = %#x", types)
+	}
+	for i, data := range frames {
+		if !bytes.Equal(packets[i], data) {
+			t.Errorf("packet %d = %q, want %q", i, packets[i], data)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Reader reads frames from a capture file, one block at a time
+type Reader struct {
+	f       *os.File
+	dec     *zstd.Decoder
+	blocks  []Block
+	indexed bool
+}
+
+// Info summarizes a capture
+type Info struct {
+	Frames  int       `json:"frames"`
+	Blocks  int       `json:"blocks"`
+	First   time.Time `json:"first,omitempty"`
+	Last    time.Time `json:"last,omitempty"`
+	Size    int64     `json:"size"`
+	Indexed bool      `json:"indexed"` // false for a capture still being written or cut short
+}
+
+// IsCapture reports whether the file at path is a capture file, as
+// opposed to a message log
+func IsCapture(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = f.Close() }()
+	magic := make([]byte, len(fileMagic))
+	n, _ := io.ReadFull(f, magic)
+	return string(magic[:n]) == fileMagic, nil
+}
+
+// Open opens a capture file for reading
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	r := &Reader{f: f}
+	_, _, r.indexed = readIndex(f, st.Size())
+	if r.blocks, _, err = readBlocks(f, st.Size()); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if r.dec, err = zstd.NewReader(nil); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Close closes the file
+func (r *Reader) Close() error {
+	r.dec.Close()
+	return r.f.Close()
+}
+
+// Blocks returns the capture's blocks, oldest first
+func (r *Reader) Blocks() []Block {
+	return append([]Block(nil), r.blocks...)
+}
+
+// Info summarizes the capture from its index or block headers, without
+// decompressing any frames
+func (r *Reader) Info() Info {
+	info := Info{Blocks: len(r.blocks), Indexed: r.indexed}
+	if st, err := r.f.Stat(); err == nil {
+		info.Size = st.Size()
+	}
+	for _, b := range r.blocks {
+		info.Frames += b.Frames
+	}
+	if len(r.blocks) > 0 {
+		info.First = r.blocks[0].First
+		info.Last = r.blocks[len(r.blocks)-1].Last
+	}
+	return info
+}
+
+// Range calls fn for each frame received from from to to, oldest first; a
+// zero bound is open. Only the blocks overlapping the range are read.
+// Returning an error from fn stops the iteration and returns it.
+func (r *Reader) Range(from, to time.Time, fn func(Frame) error) error {
+	var seq uint64
+	for _, b := range r.blocks {
+		if !b.overlaps(from, to) {
+			seq += uint64(b.Frames)
+			continue
+		}
+		frames, err := r.readBlock(b, seq)
+		if err != nil {
+			return err
+		}
+		seq += uint64(b.Frames)
+		for _, f := range frames {
+			if !from.IsZero() && f.At.Before(from) || !to.IsZero() && f.At.After(to) {
+				continue
+			}
+			if err := fn(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readBlock decompresses a block's frames, numbering them after seq
+func (r *Reader) readBlock(b Block, seq uint64) ([]Frame, error) {
+	hdr := make([]byte, blockHeaderSize)
+	if _, err := r.f.ReadAt(hdr, b.Offset); err != nil || string(hdr[:4]) != blockMagic {
+		return nil, fmt.Errorf("block at %d: invalid header", b.Offset)
+	}
+	b = parseBlockHeader(hdr, b.Offset)
+	compressed := make([]byte, b.Size)
+	if _, err := r.f.ReadAt(compressed, b.Offset+blockHeaderSize); err != nil {
+		return nil, fmt.Errorf("block at %d: %w", b.Offset, err)
+	}
+	raw, err := r.dec.DecodeAll(compressed, make([]byte, 0, b.RawSize))
+	if err != nil {
+		return nil, fmt.Errorf("block at %d: %w", b.Offset, err)
+	}
+
+	frames := make([]Frame, 0, b.Frames)
+	for len(raw) > 0 {
+		delta, n := binary.Uvarint(raw)
+		if n <= 0 {
+			return nil, fmt.Errorf("block at %d: invalid frame", b.Offset)
+		}
+		raw = raw[n:]
+		size, n := binary.Uvarint(raw)
+		if n <= 0 || size > maxFrameSize || uint64(len(raw)-n) < size {
+			return nil, fmt.Errorf("block at %d: invalid frame", b.Offset)
+		}
+		raw = raw[n:]
+		seq++
+		frames = append(frames, Frame{
+			Seq:  seq,
+			At:   b.First.Add(time.Duration(delta)),
+			Data: raw[:size:size],
+		})
+		raw = raw[size:]
+	}
+	return frames, nil
+}
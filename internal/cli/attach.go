@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/api"
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/tui"
+)
+
+var (
+	attachAPI   string
+	attachToken string
+)
+
+var attachCmd = &cobra.Command{
+	Use:   "attach",
+	Short: "Open the TUI on a relay that is already running",
+	Long: `Open the interactive TUI on a relay that is already running, such as
+one installed with "service install", through its HTTP API. The relay runs
+headless and keeps running when the TUI exits, so it can be attached to
+from any terminal and as often as needed.
+
+The relay needs api.enabled. The API URL and token default to api.listen
+and api.token from the config file.
+
+Attached, the TUI shows messages as they arrive, the stats, and the
+outputs panel, and sends text messages. Quick replies, the alerts pane,
+notes, and ack status need the TUI in the relay's own process
+(run --interactive).
+
+Examples:
+  # The relay on this host
+  meshtastic-relay attach
+
+  # A relay on another host
+  meshtastic-relay attach --api http://relay.local:8080 --token "$API_TOKEN"`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runAttach,
+}
+
+func init() {
+	rootCmd.AddCommand(attachCmd)
+
+	attachCmd.Flags().StringVar(&attachAPI, "api", "", "running relay's API URL (default from api.listen)")
+	attachCmd.Flags().StringVar(&attachToken, "token", "", "API token (default from api.token)")
+}
+
+func runAttach(_ *cobra.Command, _ []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	base := attachAPI
+	if base == "" {
+		if !cfg.API.Enabled {
+			return fmt.Errorf("api is disabled; enable it or pass --api")
+		}
+		base = apiURL(cfg.API.Listen)
+	}
+	token := attachToken
+	if token == "" {
+		token = cfg.API.Token
+	}
+
+	// Fail before taking over the terminal when the relay is unreachable
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := api.NewClient(base, token).Status(ctx); err != nil {
+		return fmt.Errorf("failed to reach the relay: %w", err)
+	}
+
+	return tui.Run(tui.Remote(base, token))
+}
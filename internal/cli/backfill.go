@@ -0,0 +1,256 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/logging"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/output"
+	"github.com/iamruinous/meshtastic-message-relay/internal/relay"
+)
+
+var (
+	backfillOutput  string
+	backfillRate    float64
+	backfillFilters bool
+	backfillSince   string
+	backfillUntil   string
+)
+
+var backfillCmd = &cobra.Command{
+	Use:   "backfill <file>...",
+	Short: "Replay logged messages into an output",
+	Long: `Replay messages from JSON Lines logs (the file output with format: json)
+into one configured output, e.g. to populate a newly added output with
+history. Files are replayed in the order given, so pass rotated logs
+oldest first.
+
+The output is selected by its index in the outputs list or by its type
+when only one output of that type exists. It does not need to be enabled.
+
+Examples:
+  # Replay into the second configured output at 5 messages per second
+  meshtastic-relay backfill --to 1 --rate 5 messages.log.2 messages.log.1 messages.log
+
+  # Only replay the last week, applying the configured filters
+  meshtastic-relay backfill --to webhook --since 168h --filters messages.log`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runBackfill,
+}
+
+func init() {
+	rootCmd.AddCommand(backfillCmd)
+
+	backfillCmd.Flags().StringVar(&backfillOutput, "to", "", "output to replay into (index or type)")
+	backfillCmd.Flags().Float64Var(&backfillRate, "rate", 10, "maximum messages per second (0 for unlimited)")
+	backfillCmd.Flags().BoolVar(&backfillFilters, "filters", false, "apply the configured message filters")
+	backfillCmd.Flags().StringVar(&backfillSince, "since", "", "only replay messages newer than this (RFC3339 time or duration ago)")
+	backfillCmd.Flags().StringVar(&backfillUntil, "until", "", "only replay messages older than this (RFC3339 time or duration ago)")
+	_ = backfillCmd.MarkFlagRequired("to")
+}
+
+// backfillStats tracks replay progress
+type backfillStats struct {
+	read, sent, skipped, failed int
+}
+
+func runBackfill(_ *cobra.Command, args []string) error {
+	if err := logging.Initialize(logConfig()); err != nil {
+		return fmt.Errorf("failed to initialize logging: %w", err)
+	}
+	defer logging.Sync()
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	since, err := parseTimeBound(backfillSince)
+	if err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+	until, err := parseTimeBound(backfillUntil)
+	if err != nil {
+		return fmt.Errorf("invalid --until: %w", err)
+	}
+
+	outCfg, err := selectOutput(cfg.Outputs, backfillOutput)
+	if err != nil {
+		return err
+	}
+	out, err := output.New(outCfg)
+	if err != nil {
+		return fmt.Errorf("failed to create output: %w", err)
+	}
+	defer func() { _ = out.Close() }()
+
+	service, err := relay.New(cfg)
+	if err != nil {
+		return err
+	}
+
+	var relayed func(*message.Packet) bool
+	if backfillFilters {
+		relayed = service.ShouldRelay
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	var throttle <-chan time.Time
+	if backfillRate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / backfillRate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	progress := time.NewTicker(time.Second)
+	defer progress.Stop()
+
+	stats := &backfillStats{}
+	start := time.Now()
+	report := func() {
+		elapsed := time.Since(start).Seconds()
+		fmt.Fprintf(os.Stderr, "\rread %d, sent %d, skipped %d, failed %d (%.1f/s)",
+			stats.read, stats.sent, stats.skipped, stats.failed, float64(stats.sent)/elapsed)
+	}
+
+	fmt.Fprintf(os.Stderr, "Replaying into %s\n", out.Name())
+
+	for _, path := range args {
+		err := replayFile(ctx, path, func(pkt *message.Packet) error {
+			stats.read++
+
+			if skipBackfill(pkt, since, until, relayed) {
+				stats.skipped++
+				return nil
+			}
+
+			if throttle != nil {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-throttle:
+				}
+			}
+
+			if err := out.Send(ctx, pkt); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				stats.failed++
+				logging.Warn("Backfill send failed",
+					zap.Uint32("id", pkt.ID),
+					zap.Error(err))
+			} else {
+				stats.sent++
+			}
+
+			select {
+			case <-progress.C:
+				report()
+			default:
+			}
+			return nil
+		})
+
+		if err != nil {
+			report()
+			fmt.Fprintln(os.Stderr)
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	report()
+	fmt.Fprintln(os.Stderr)
+
+	if stats.failed > 0 {
+		return fmt.Errorf("%d messages failed to send", stats.failed)
+	}
+	return nil
+}
+
+// replayFile calls fn for every packet in a JSONL file
+func replayFile(ctx context.Context, path string, fn func(*message.Packet) error) error {
+	f, err := message.OpenLog(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	reader := message.NewReader(f)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		pkt, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w (only JSON Lines logs can be replayed)", err)
+		}
+
+		if err := fn(pkt); err != nil {
+			return err
+		}
+	}
+}
+
+// skipBackfill reports whether a logged packet is left out of the replay:
+// it was received outside the since and until bounds, which are ignored
+// when zero, or relayed, if set, rejects it
+func skipBackfill(pkt *message.Packet, since, until time.Time, relayed func(*message.Packet) bool) bool {
+	return (!since.IsZero() && pkt.ReceivedAt.Before(since)) ||
+		(!until.IsZero() && pkt.ReceivedAt.After(until)) ||
+		(relayed != nil && !relayed(pkt))
+}
+
+// selectOutput finds an output by index or unique type
+func selectOutput(outputs []config.OutputConfig, sel string) (config.OutputConfig, error) {
+	if i, err := strconv.Atoi(sel); err == nil {
+		if i < 0 || i >= len(outputs) {
+			return config.OutputConfig{}, fmt.Errorf("output index %d out of range (have %d outputs)", i, len(outputs))
+		}
+		return outputs[i], nil
+	}
+
+	var found []config.OutputConfig
+	for _, out := range outputs {
+		if out.Type == sel {
+			found = append(found, out)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return config.OutputConfig{}, fmt.Errorf("no output of type %q configured", sel)
+	case 1:
+		return found[0], nil
+	default:
+		return config.OutputConfig{}, fmt.Errorf("%d outputs of type %q configured, select one by index", len(found), sel)
+	}
+}
+
+// parseTimeBound parses an RFC3339 time or a duration before now
+func parseTimeBound(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/relay"
+)
+
+func TestParseTimeBound(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		ago     time.Duration // when set, want is this long before now
+		wantErr bool
+	}{
+		{in: ""},
+		{in: "2024-03-01T12:00:00Z", want: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{in: "2024-03-01T12:00:00+02:00", want: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)},
+		{in: "168h", ago: 168 * time.Hour},
+		{in: "90m", ago: 90 * time.Minute},
+		{in: "yesterday", wantErr: true},
+		{in: "2024-03-01", wantErr: true},
+		{in: "2024-03-01 12:00:00", wantErr: true},
+		{in: "7d", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeBound(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseTimeBound(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTimeBound(%q): %v", tt.in, err)
+			continue
+		}
+		if tt.ago > 0 {
+			if off := time.Since(got) - tt.ago; off < 0 || off > time.Minute {
+				t.Errorf("parseTimeBound(%q) = %v, want %v ago", tt.in, got, tt.ago)
+			}
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseTimeBound(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSelectOutput(t *testing.T) {
+	outputs := []config.OutputConfig{
+		{Type: "webhook", Options: map[string]interface{}{"url": "http://a"}},
+		{Type: "file"},
+		{Type: "webhook", Options: map[string]interface{}{"url": "http://b"}},
+	}
+	tests := []struct {
+		sel     string
+		want    int    // index of the output selected
+		wantErr string // part of the error, when one is expected
+	}{
+		{sel: "0", want: 0},
+		{sel: "2", want: 2},
+		{sel: "file", want: 1},
+		{sel: "3", wantErr: "out of range"},
+		{sel: "-1", wantErr: "out of range"},
+		{sel: "pager", wantErr: `no output of type "pager"`},
+		{sel: "webhook", wantErr: "select one by index"},
+		{sel: "", wantErr: `no output of type ""`},
+	}
+	for _, tt := range tests {
+		got, err := selectOutput(outputs, tt.sel)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("selectOutput(%q) error = %v, want it to mention %q", tt.sel, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("selectOutput(%q): %v", tt.sel, err)
+			continue
+		}
+		if got.Type != outputs[tt.want].Type || got.Options["url"] != outputs[tt.want].Options["url"] {
+			t.Errorf("selectOutput(%q) = %+v, want output %d", tt.sel, got, tt.want)
+		}
+	}
+}
+
+func TestSkipBackfill(t *testing.T) {
+	service, err := relay.New(&config.Config{
+		Filters: config.FilterConfig{MessageTypes: []string{message.PortNumTextMessage.String()}},
+	})
+	if err != nil {
+		t.Fatalf("relay.New: %v", err)
+	}
+
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	text := func(at time.Time) *message.Packet {
+		return &message.Packet{From: 1, PortNum: message.PortNumTextMessage, ReceivedAt: at}
+	}
+	position := &message.Packet{From: 1, PortNum: message.PortNumPosition, ReceivedAt: base}
+
+	tests := []struct {
+		name         string
+		pkt          *message.Packet
+		since, until time.Time
+		filters      bool
+		want         bool
+	}{
+		{name: "no bounds", pkt: text(base)},
+		{name: "after since", pkt: text(base), since: base.Add(-time.Hour)},
+		{name: "at since", pkt: text(base), since: base},
+		{name: "before since", pkt: text(base), since: base.Add(time.Hour), want: true},
+		{name: "before until", pkt: text(base), until: base.Add(time.Hour)},
+		{name: "after until", pkt: text(base), until: base.Add(-time.Hour), want: true},
+		{name: "inside both", pkt: text(base), since: base.Add(-time.Hour), until: base.Add(time.Hour)},
+		{name: "filtered out", pkt: position, filters: true, want: true},
+		{name: "passes filters", pkt: text(base), filters: true},
+		{name: "filters off", pkt: position},
+	}
+	for _, tt := range tests {
+		var relayed func(*message.Packet) bool
+		if tt.filters {
+			relayed = service.ShouldRelay
+		}
+		if got := skipBackfill(tt.pkt, tt.since, tt.until, relayed); got != tt.want {
+			t.Errorf("%s: skipBackfill = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/api"
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+)
+
+var (
+	canaryAPI    string
+	canaryFormat outputFormat
+)
+
+var canaryCmd = &cobra.Command{
+	Use:   "canary",
+	Short: "Inject a test packet and time its delivery to each output",
+	Long: `Ask the running relay to pass a synthetic text packet through as if its
+connection had received it, and report how long each output took to
+confirm delivery. Outputs with canary: false do not get canaries.
+
+The relay's HTTP API must be enabled (or --api given), along with
+canary.enabled. The command exits non-zero when the canary is degraded:
+an output failed or did not confirm within canary.timeout, or the slowest
+delivery took longer than canary.max_latency.
+
+Examples:
+  meshtastic-relay canary
+  meshtastic-relay canary -o json`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runCanary,
+}
+
+func init() {
+	rootCmd.AddCommand(canaryCmd)
+
+	canaryCmd.Flags().StringVar(&canaryAPI, "api", "", "running relay's API URL (default from api.listen)")
+	addFormatFlag(canaryCmd, &canaryFormat)
+}
+
+func runCanary(_ *cobra.Command, _ []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	base := canaryAPI
+	if base == "" {
+		if !cfg.API.Enabled {
+			return fmt.Errorf("api is disabled; enable it or pass --api")
+		}
+		base = apiURL(cfg.API.Listen)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(base, "/")+"/canary", nil)
+	if err != nil {
+		return err
+	}
+	if cfg.API.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.API.Token)
+	}
+	client := &http.Client{Timeout: cfg.Canary.Timeout + 10*time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the relay: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("POST /canary: %s: %s", resp.Status, e.Error)
+	}
+	var res api.CanaryResult
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+
+	err = render(canaryFormat, res, func(w io.Writer) {
+		fmt.Fprintln(w, "OUTPUT\tLATENCY\tRESULT")
+		for _, d := range res.Deliveries {
+			result := "ok"
+			if d.Error != "" {
+				result = d.Error
+			}
+			fmt.Fprintf(w, "%s\t%.1f ms\t%s\n", d.Output, d.LatencyMS, result)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if res.Degraded {
+		return fmt.Errorf("canary %s degraded: %s", res.ID, res.Reason)
+	}
+	if !canaryFormat.structured() {
+		fmt.Printf("\nCanary %s delivered to %d outputs in %.1f ms\n", res.ID, len(res.Deliveries), res.LatencyMS)
+	}
+	return nil
+}
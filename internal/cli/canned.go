@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/canned"
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+)
+
+// adminTimeout bounds each admin exchange with the device
+const adminTimeout = 15 * time.Second
+
+var cannedFormat outputFormat
+
+var cannedCmd = &cobra.Command{
+	Use:   "canned",
+	Short: "Manage the device's canned messages",
+	Long: `Read and update the canned message module's message list on the
+connected device. Canned messages show up as quick replies on devices
+with an input method and in the TUI.
+
+Only serial and TCP connections support device administration.
+
+Examples:
+  # Show the configured messages
+  meshtastic-relay canned list
+
+  # Replace the list
+  meshtastic-relay canned set "On my way" "Need help" "Net at 19:00"
+
+  # Append a message
+  meshtastic-relay canned add "Copy"
+
+  # Remove all messages
+  meshtastic-relay canned clear`,
+}
+
+var cannedListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Show the device's canned messages",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		return withAdmin(func(ctx context.Context, admin connection.AdminTransport) error {
+			messages, err := canned.Get(ctx, admin)
+			if err != nil {
+				return fmt.Errorf("failed to read canned messages: %w", err)
+			}
+			if messages == nil {
+				messages = []string{}
+			}
+			if len(messages) == 0 && !cannedFormat.structured() {
+				fmt.Println("No canned messages configured")
+				return nil
+			}
+			return render(cannedFormat, messages, func(w io.Writer) {
+				for i, m := range messages {
+					_, _ = fmt.Fprintf(w, "%2d.\t%s\n", i+1, m)
+				}
+			})
+		})
+	},
+}
+
+var cannedSetCmd = &cobra.Command{
+	Use:   "set <message>...",
+	Short: "Replace the device's canned messages",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		if _, err := canned.Join(args); err != nil {
+			return err
+		}
+		return withAdmin(func(ctx context.Context, admin connection.AdminTransport) error {
+			if err := canned.Set(ctx, admin, args); err != nil {
+				return fmt.Errorf("failed to update canned messages: %w", err)
+			}
+			fmt.Printf("Set %d canned messages\n", len(args))
+			return nil
+		})
+	},
+}
+
+var cannedAddCmd = &cobra.Command{
+	Use:   "add <message>...",
+	Short: "Append messages to the device's canned messages",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		return withAdmin(func(ctx context.Context, admin connection.AdminTransport) error {
+			messages, err := canned.Get(ctx, admin)
+			if err != nil {
+				return fmt.Errorf("failed to read canned messages: %w", err)
+			}
+			messages = append(messages, args...)
+			if err := canned.Set(ctx, admin, messages); err != nil {
+				return fmt.Errorf("failed to update canned messages: %w", err)
+			}
+			fmt.Printf("Device now has %d canned messages\n", len(messages))
+			return nil
+		})
+	},
+}
+
+var cannedClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all canned messages from the device",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		return withAdmin(func(ctx context.Context, admin connection.AdminTransport) error {
+			if err := canned.Set(ctx, admin, nil); err != nil {
+				return fmt.Errorf("failed to clear canned messages: %w", err)
+			}
+			fmt.Println("Cleared canned messages")
+			return nil
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cannedCmd)
+	cannedCmd.AddCommand(cannedListCmd)
+	cannedCmd.AddCommand(cannedSetCmd)
+	cannedCmd.AddCommand(cannedAddCmd)
+	cannedCmd.AddCommand(cannedClearCmd)
+
+	addFormatFlag(cannedListCmd, &cannedFormat)
+}
+
+// withAdmin connects to the device and runs fn with its admin transport
+func withAdmin(fn func(context.Context, connection.AdminTransport) error) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	conn, err := connectDevice(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	admin, ok := conn.(connection.AdminTransport)
+	if !ok {
+		return fmt.Errorf("connection %s does not support device administration", conn.Name())
+	}
+
+	ctx, cancelTimeout := context.WithTimeout(ctx, adminTimeout)
+	defer cancelTimeout()
+
+	return fn(ctx, admin)
+}
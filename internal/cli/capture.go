@@ -0,0 +1,262 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/capture"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/output"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+var (
+	captureFormat outputFormat
+	captureFrom   string
+	captureTo     string
+	captureOut    string
+	captureExport string
+)
+
+var captureCmd = &cobra.Command{
+	Use:   "capture",
+	Short: "Read capture files of raw device frames",
+	Long: `Read the capture files recorded with connection.capture. A capture
+holds every raw frame received from the device, compressed in blocks
+with an index of their times, so a time range of a multi-day capture is
+read without decompressing the rest.
+
+Examples:
+  # Size and time span of a capture
+  meshtastic-relay capture info radio.mrcap
+
+  # Messages received in the last hour
+  meshtastic-relay capture decode --from 1h radio.mrcap
+
+  # A night's messages as a JSON Lines log, for backfill or incident export
+  meshtastic-relay capture export --from 2025-06-01T18:00:00Z --to 2025-06-02T06:00:00Z \
+    --out night.log radio.mrcap
+
+  # Raw frames for Wireshark
+  meshtastic-relay capture export --format pcapng --out radio.pcapng radio.mrcap`,
+}
+
+var captureInfoCmd = &cobra.Command{
+	Use:          "info <file>",
+	Short:        "Summarize a capture",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(_ *cobra.Command, args []string) error {
+		r, err := capture.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer func() { _ = r.Close() }()
+
+		info := r.Info()
+		return render(captureFormat, info, func(w io.Writer) {
+			_, _ = fmt.Fprintf(w, "Frames:\t%d\n", info.Frames)
+			_, _ = fmt.Fprintf(w, "Blocks:\t%d\n", info.Blocks)
+			_, _ = fmt.Fprintf(w, "Size:\t%d bytes\n", info.Size)
+			if info.Frames > 0 {
+				_, _ = fmt.Fprintf(w, "First:\t%s\n", info.First.Local().Format(time.RFC3339))
+				_, _ = fmt.Fprintf(w, "Last:\t%s\n", info.Last.Local().Format(time.RFC3339))
+			}
+			if !info.Indexed {
+				_, _ = fmt.Fprintln(w, "Index:\tmissing (still recording or cut short)")
+			}
+		})
+	},
+}
+
+var captureDecodeCmd = &cobra.Command{
+	Use:          "decode <file>",
+	Short:        "Print the messages in a capture",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(_ *cobra.Command, args []string) error {
+		w := bufio.NewWriter(os.Stdout)
+		err := decodeCapture(args[0], func(p *message.Packet) error {
+			_, err := fmt.Fprintln(w, output.NewRender(p).Text())
+			return err
+		})
+		if ferr := w.Flush(); err == nil {
+			err = ferr
+		}
+		return err
+	},
+}
+
+var captureExportCmd = &cobra.Command{
+	Use:   "export <file>",
+	Short: "Write the messages in a capture as a JSON Lines log or pcapng file",
+	Long: `Write the messages in a capture as a JSON Lines log, in the format of
+the file output with format: json, so they can be replayed with backfill
+or reported on with incident export.
+
+With --format pcapng, the raw frames are written instead as a pcapng
+file for Wireshark and other packet tools, one packet per frame with its
+receive time. The packets use the DLT_USER0 link type (147); to decode
+them in Wireshark, add an entry for DLT_USER0 under Protocols > DLT_USER
+with the payload dissector "protobuf", and have the protobuf dissector
+decode that payload as meshtastic.FromRadio with the Meshtastic .proto
+files on its search path.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(_ *cobra.Command, args []string) error {
+		var export func(path string, w io.Writer) (int, string, error)
+		switch captureExport {
+		case "jsonl":
+			export = exportJSONLines
+		case "pcapng":
+			export = exportPcapng
+		default:
+			return fmt.Errorf("invalid --format %q (use jsonl or pcapng)", captureExport)
+		}
+
+		out := os.Stdout
+		if captureOut != "" {
+			f, err := os.Create(captureOut)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", captureOut, err)
+			}
+			out = f
+		}
+
+		w := bufio.NewWriter(out)
+		n, unit, err := export(args[0], w)
+		if ferr := w.Flush(); err == nil {
+			err = ferr
+		}
+		if captureOut == "" {
+			return err
+		}
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", captureOut, err)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s: %d %s\n", captureOut, n, unit)
+		return nil
+	},
+}
+
+// exportJSONLines writes the messages in a capture as a JSON Lines log
+func exportJSONLines(path string, w io.Writer) (int, string, error) {
+	n := 0
+	err := decodeCapture(path, func(p *message.Packet) error {
+		line, err := output.NewRender(p).JSONLine()
+		if err != nil {
+			return err
+		}
+		n++
+		_, err = w.Write(line)
+		return err
+	})
+	return n, "messages", err
+}
+
+// exportPcapng writes the raw frames of a capture as a pcapng file
+func exportPcapng(path string, w io.Writer) (int, string, error) {
+	from, to, err := captureRange()
+	if err != nil {
+		return 0, "", err
+	}
+	r, err := capture.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() { _ = r.Close() }()
+
+	pw, err := capture.NewPcapngWriter(w, "meshtastic-relay "+Version)
+	if err != nil {
+		return 0, "", err
+	}
+	n := 0
+	err = r.Range(from, to, func(f capture.Frame) error {
+		n++
+		return pw.Write(f)
+	})
+	return n, "frames", err
+}
+
+func init() {
+	rootCmd.AddCommand(captureCmd)
+	captureCmd.AddCommand(captureInfoCmd, captureDecodeCmd, captureExportCmd)
+
+	addFormatFlag(captureInfoCmd, &captureFormat)
+	for _, cmd := range []*cobra.Command{captureDecodeCmd, captureExportCmd} {
+		cmd.Flags().StringVar(&captureFrom, "from", "", "first frame time (RFC3339 time or duration ago)")
+		cmd.Flags().StringVar(&captureTo, "to", "", "last frame time (RFC3339 time or duration ago)")
+	}
+	captureExportCmd.Flags().StringVar(&captureOut, "out", "", "file to write to (default stdout)")
+	captureExportCmd.Flags().StringVar(&captureExport, "format", "jsonl", "export format (jsonl, pcapng)")
+}
+
+// decodeCapture calls fn with the messages decoded from a capture's frames
+// in the --from and --to range. Node names come from the node info frames
+// seen before each message, so a range that starts after the device's
+// config dump may lack some names.
+func decodeCapture(path string, fn func(*message.Packet) error) error {
+	from, to, err := captureRange()
+	if err != nil {
+		return err
+	}
+
+	r, err := capture.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+
+	nodes := make(map[uint32]*meshtastic.NodeInfo)
+	skipped := 0
+	err = r.Range(from, to, func(f capture.Frame) error {
+		fr, err := meshtastic.ParseFromRadio(f.Data)
+		if err != nil {
+			skipped++
+			return nil
+		}
+		if fr.NodeInfo != nil {
+			nodes[fr.NodeInfo.Num] = fr.NodeInfo
+		}
+
+		mp := fr.ToPacket()
+		if mp == nil {
+			return nil
+		}
+		mp.FromNode = nodes[mp.From]
+		p := message.FromMeshtasticPacket(mp)
+		if p == nil {
+			return nil
+		}
+		p.ReceivedAt = f.At
+		return fn(p)
+	})
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: skipped %d frames that could not be decoded\n", skipped)
+	}
+	return err
+}
+
+// captureRange parses the --from and --to flags
+func captureRange() (from, to time.Time, err error) {
+	from, err = parseTimeBound(captureFrom)
+	if err != nil {
+		return from, to, fmt.Errorf("invalid --from: %w", err)
+	}
+	to, err = parseTimeBound(captureTo)
+	if err != nil {
+		return from, to, fmt.Errorf("invalid --to: %w", err)
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return from, to, fmt.Errorf("--to is before --from")
+	}
+	return from, to, nil
+}
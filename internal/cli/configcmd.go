@@ -0,0 +1,292 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/state"
+)
+
+var (
+	migrateDryRun  bool
+	migrateWorkDir string
+
+	initOptions = config.DefaultStarterOptions()
+	initForce   bool
+	initYes     bool
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the configuration file",
+}
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate [file]",
+	Short: "Upgrade a config file to the current layout",
+	Long: `Upgrade a config file written for an older release to the current
+layout (version ` + fmt.Sprint(config.CurrentVersion) + `). Older files keep working as they are; migrating
+makes the new layout's defaults apply to them. Only the settings that
+change are rewritten, so comments and formatting are kept. The original
+is saved next to it with a .bak suffix.
+
+The file defaults to the one given with --config or found in the usual
+locations.
+
+Version 1 files took relative state file paths (nodedb.path and the
+like) from the working directory; they are made absolute using
+--workdir, since version 2 takes relative paths from state_dir.
+
+Examples:
+  # Show what would change
+  meshtastic-relay config migrate --dry-run /etc/meshtastic-relay/config.yaml
+
+  # Upgrade a file whose relay ran from /srv/relay
+  meshtastic-relay config migrate --workdir /srv/relay config.yaml`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE:         runConfigMigrate,
+}
+
+var configInitCmd = &cobra.Command{
+	Use:   "init [file]",
+	Short: "Write a starter config file",
+	Long: `Write a starter config file with the chosen connection and outputs. Run
+from a terminal, it asks for each choice not given as a flag; use --yes to
+take the defaults instead. Credentials are left as ${NAME} references to
+environment variables.
+
+The file defaults to config.yaml in the current directory; "-" prints it.
+An existing file is only replaced with --force.
+
+Outputs: ` + strings.Join(config.StarterOutputs, ", ") + `
+
+Examples:
+  # Answer the questions
+  meshtastic-relay config init
+
+  # A TCP node posting to Telegram and logging to a file
+  meshtastic-relay config init --connection tcp --host 192.168.1.50 \
+    --outputs telegram,file /etc/meshtastic-relay/config.yaml`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE:         runConfigInit,
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "Check a config file without running the relay",
+	Long: `Load a config file as the relay would, resolving its environment
+variables and secret files, and report the first problem found. Nothing is
+connected or opened, so this suits CI and deployment checks; use
+"run --dry-run --sample simulator" to also preview what outputs send.
+
+The file defaults to the one given with --config or found in the usual
+locations. The command exits non-zero when the file is invalid.`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE:         runConfigValidate,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configMigrateCmd)
+	configCmd.AddCommand(configInitCmd)
+	configCmd.AddCommand(configValidateCmd)
+
+	configMigrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "print the upgraded file instead of writing it")
+	configMigrateCmd.Flags().StringVar(&migrateWorkDir, "workdir", "", "directory the relay ran from, for relative paths (default: current directory)")
+
+	f := configInitCmd.Flags()
+	f.StringVar(&initOptions.Connection, "connection", initOptions.Connection, "connection type (serial, tcp, mqtt)")
+	f.StringVar(&initOptions.SerialPort, "port", initOptions.SerialPort, "serial port")
+	f.StringVar(&initOptions.TCPHost, "host", initOptions.TCPHost, "TCP host of the node")
+	f.StringVar(&initOptions.MQTTBroker, "broker", initOptions.MQTTBroker, "MQTT broker URL")
+	f.StringVar(&initOptions.MQTTTopic, "topic", initOptions.MQTTTopic, "MQTT topic to subscribe to")
+	f.StringSliceVar(&initOptions.Outputs, "outputs", initOptions.Outputs, "outputs to include, comma-separated")
+	f.BoolVarP(&initForce, "force", "f", false, "replace an existing file")
+	f.BoolVarP(&initYes, "yes", "y", false, "take the defaults for choices not given as flags")
+}
+
+func runConfigInit(cmd *cobra.Command, args []string) error {
+	path := "config.yaml"
+	if len(args) > 0 {
+		path = args[0]
+	}
+	if path != "-" && !initForce {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists; use --force to replace it", path)
+		}
+	}
+
+	if !initYes && isatty.IsTerminal(os.Stdin.Fd()) {
+		p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stderr, flags: cmd}
+		p.ask("connection", "Connection type (serial, tcp, mqtt)", &initOptions.Connection)
+		switch initOptions.Connection {
+		case "serial":
+			p.ask("port", "Serial port", &initOptions.SerialPort)
+		case "tcp":
+			p.ask("host", "Node host", &initOptions.TCPHost)
+		case "mqtt":
+			p.ask("broker", "MQTT broker", &initOptions.MQTTBroker)
+			p.ask("topic", "MQTT topic", &initOptions.MQTTTopic)
+		}
+		outputs := strings.Join(initOptions.Outputs, ",")
+		p.ask("outputs", "Outputs ("+strings.Join(config.StarterOutputs, ", ")+")", &outputs)
+		initOptions.Outputs = splitList(outputs)
+		if p.err != nil {
+			return p.err
+		}
+	}
+
+	data, err := config.Starter(initOptions)
+	if err != nil {
+		return err
+	}
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	// The file may come to hold credentials
+	if err := state.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	fmt.Printf("Wrote %s (%s connection; outputs: %s)\n", path, initOptions.Connection, strings.Join(initOptions.Outputs, ", "))
+	fmt.Printf("Check it with: meshtastic-relay config validate %s\n", path)
+	return nil
+}
+
+func runConfigValidate(_ *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		viper.SetConfigFile(args[0])
+	}
+	if err := config.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if errors.As(err, &notFound) {
+			return fmt.Errorf("no config file found; give its path")
+		}
+		return err
+	}
+	path := viper.ConfigFileUsed()
+
+	cfg, err := config.Load()
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		return fmt.Errorf("%s is invalid: %w", path, err)
+	}
+
+	enabled := 0
+	for _, out := range cfg.Outputs {
+		if out.Enabled {
+			enabled++
+		}
+	}
+	fmt.Printf("%s is valid (%s connection, %d of %d outputs enabled)\n", path, cfg.Connection.Type, enabled, len(cfg.Outputs))
+	if cfg.Version < config.CurrentVersion {
+		fmt.Printf("It uses config version %d; upgrade it with: meshtastic-relay config migrate %s\n", cfg.Version, path)
+	}
+	return nil
+}
+
+// prompter asks for the settings whose flags were not given, keeping the
+// current value when the answer is empty
+type prompter struct {
+	in    *bufio.Reader
+	out   io.Writer
+	flags *cobra.Command
+	err   error
+}
+
+func (p *prompter) ask(flag, question string, value *string) {
+	if p.err != nil || p.flags.Flags().Changed(flag) {
+		return
+	}
+	fmt.Fprintf(p.out, "%s [%s]: ", question, *value)
+	line, err := p.in.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		p.err = err
+		return
+	}
+	if answer := strings.TrimSpace(line); answer != "" {
+		*value = answer
+	}
+}
+
+// splitList splits a comma-separated list, dropping blanks
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func runConfigMigrate(_ *cobra.Command, args []string) error {
+	path := viper.ConfigFileUsed()
+	if len(args) > 0 {
+		path = args[0]
+	}
+	if path == "" {
+		return fmt.Errorf("no config file found; give its path")
+	}
+
+	workDir := migrateWorkDir
+	if workDir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		workDir = wd
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	m, err := config.Migrate(data, workDir)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if m.From == m.To {
+		fmt.Printf("%s is already version %d\n", path, m.To)
+		return nil
+	}
+
+	if migrateDryRun {
+		_, err := os.Stdout.Write(m.Data)
+		for _, c := range m.Changes {
+			fmt.Fprintf(os.Stderr, "  %s\n", c)
+		}
+		return err
+	}
+
+	st, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".bak", data, st.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to back up config: %w", err)
+	}
+	if err := state.WriteFile(path, m.Data, st.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	fmt.Printf("Migrated %s from version %d to %d (original saved as %s.bak)\n", path, m.From, m.To, path)
+	for _, c := range m.Changes {
+		fmt.Printf("  %s\n", c)
+	}
+	return nil
+}
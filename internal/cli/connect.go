@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+	"github.com/iamruinous/meshtastic-message-relay/internal/logging"
+)
+
+// settleDelay gives a fresh connection time to exchange its config dump
+// before one-off commands start talking to the device
+const settleDelay = 2 * time.Second
+
+// connectDevice loads the configuration, initializes logging, and connects
+// to the configured device. It is used by commands that talk to the device
+// directly instead of running the relay service.
+func connectDevice(ctx context.Context) (connection.Connection, error) {
+	if err := logging.Initialize(logConfig()); err != nil {
+		return nil, fmt.Errorf("failed to initialize logging: %w", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if err := cfg.Connection.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	conn, err := connection.New(&cfg.Connection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection: %w", err)
+	}
+
+	if err := conn.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		_ = conn.Close()
+		return nil, ctx.Err()
+	case <-time.After(settleDelay):
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/discovery"
+)
+
+var (
+	discoverTimeout time.Duration
+	discoverPassive bool
+	discoverFormat  outputFormat
+)
+
+var discoverCmd = &cobra.Command{
+	Use:   "discover",
+	Short: "Find Meshtastic devices on the local network",
+	Long: `Search the local network for Meshtastic devices.
+
+Devices are found by querying mDNS for the _meshtastic._tcp service and,
+with --passive, by listening on the Meshtastic UDP multicast group.
+
+Any device listed here can be used as connection.tcp.host. Setting
+connection.tcp.host to "auto" connects to the first device found.`,
+	RunE: runDiscover,
+}
+
+func init() {
+	rootCmd.AddCommand(discoverCmd)
+
+	discoverCmd.Flags().DurationVarP(&discoverTimeout, "timeout", "t", discovery.DefaultTimeout, "how long to wait for responses")
+	discoverCmd.Flags().BoolVar(&discoverPassive, "passive", true, "also listen on the Meshtastic UDP multicast group")
+	addFormatFlag(discoverCmd, &discoverFormat)
+}
+
+func runDiscover(_ *cobra.Command, _ []string) error {
+	_, _ = fmt.Fprintf(discoverFormat.progress(), "Searching for Meshtastic devices (%v)...\n", discoverTimeout)
+
+	devices, err := discovery.Discover(context.Background(), discovery.Options{
+		Timeout: discoverTimeout,
+		Passive: discoverPassive,
+	})
+	if err != nil {
+		return fmt.Errorf("discovery failed: %w", err)
+	}
+
+	if len(devices) == 0 && !discoverFormat.structured() {
+		fmt.Println("No devices found")
+		return nil
+	}
+
+	return render(discoverFormat, devices, func(w io.Writer) {
+		_, _ = fmt.Fprintln(w, "ADDRESS\tNAME\tHOSTNAME\tSOURCE")
+		for i := range devices {
+			d := &devices[i]
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.Address(), valueOr(d.Name, "-"), valueOr(d.Hostname, "-"), d.Source)
+		}
+	})
+}
+
+// valueOr returns v, or fallback if v is empty
+func valueOr(v, fallback string) string {
+	if v == "" {
+		return fallback
+	}
+	return v
+}
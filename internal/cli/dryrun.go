@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/output"
+	"github.com/iamruinous/meshtastic-message-relay/internal/relay"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic/simulator"
+)
+
+// sampleSimulator selects generated packets as the dry-run sample source
+const sampleSimulator = "simulator"
+
+// loadSamples reads up to n packets from the simulator or a JSONL capture
+func loadSamples(source string, n int) ([]*message.Packet, error) {
+	if source == sampleSimulator {
+		return simulatorSamples(n)
+	}
+
+	f, err := message.OpenLog(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sample file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	reader := message.NewReader(f)
+	packets := make([]*message.Packet, 0, n)
+	for len(packets) < n {
+		p, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", source, err)
+		}
+		packets = append(packets, p)
+	}
+	return packets, nil
+}
+
+// simulatorSamples decodes packets generated by the device simulator the
+// same way a live connection would
+func simulatorSamples(n int) ([]*message.Packet, error) {
+	simCfg := simulator.DefaultConfig()
+	device := simulator.New(&simCfg)
+
+	nodes := make(map[uint32]*meshtastic.NodeInfo)
+	packets := make([]*message.Packet, 0, n)
+	for _, data := range device.Samples(n) {
+		fr, err := meshtastic.ParseFromRadio(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode simulated packet: %w", err)
+		}
+		if fr.NodeInfo != nil {
+			nodes[fr.NodeInfo.Num] = fr.NodeInfo
+		}
+
+		mp := fr.ToPacket()
+		if mp == nil {
+			continue
+		}
+		mp.FromNode = nodes[mp.From]
+		if p := message.FromMeshtasticPacket(mp); p != nil {
+			packets = append(packets, p)
+		}
+	}
+	return packets, nil
+}
+
+// previewOutputs prints what each enabled output would send for the samples
+func previewOutputs(cfg *config.Config, packets []*message.Packet) error {
+	service, err := relay.New(cfg)
+	if err != nil {
+		return err
+	}
+
+	type namedPreviewer struct {
+		name string
+		output.Previewer
+	}
+	var previewers []namedPreviewer
+	for i, outCfg := range cfg.Outputs {
+		if !outCfg.Enabled {
+			continue
+		}
+		p, err := output.NewPreviewer(outCfg)
+		if err != nil {
+			return fmt.Errorf("outputs[%d] (%s): %w", i, outCfg.Type, err)
+		}
+		previewers = append(previewers, namedPreviewer{name: fmt.Sprintf("outputs[%d] %s", i, outCfg.Type), Previewer: p})
+	}
+
+	if len(packets) == 0 {
+		fmt.Println("\nNo sample packets found")
+		return nil
+	}
+
+	for i, pkt := range packets {
+		fmt.Printf("\nSample %d: %s from %s on channel %d\n", i+1, pkt.PortNum, nodeLabel(pkt), pkt.Channel)
+
+		if !service.ShouldRelay(pkt) {
+			fmt.Println("  (dropped by filters)")
+			continue
+		}
+
+		for _, p := range previewers {
+			preview, err := p.Preview(pkt)
+			if err != nil {
+				fmt.Printf("  %s: error: %v\n", p.name, err)
+				continue
+			}
+			printPreview(p.name, preview)
+		}
+	}
+
+	return nil
+}
+
+func printPreview(name string, p *output.Preview) {
+	target := p.Target
+	if p.Method != "" {
+		target = p.Method + " " + target
+	}
+	fmt.Printf("  %s -> %s\n", name, target)
+
+	if p.Skipped != "" {
+		fmt.Printf("    skipped: %s\n", p.Skipped)
+		return
+	}
+
+	keys := make([]string, 0, len(p.Headers))
+	for k := range p.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("    %s: %s\n", k, p.Headers[k])
+	}
+
+	for _, line := range strings.Split(p.Body, "\n") {
+		fmt.Printf("    %s\n", line)
+	}
+}
+
+func nodeLabel(p *message.Packet) string {
+	label := fmt.Sprintf("!%08x", p.From)
+	if p.FromNode != nil && p.FromNode.User != nil && p.FromNode.User.ShortName != "" {
+		label += " (" + p.FromNode.User.ShortName + ")"
+	}
+	return label
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v3"
+)
+
+// outputFormat is the value of a command's --output flag
+type outputFormat string
+
+// Output formats
+const (
+	formatTable outputFormat = "table"
+	formatJSON  outputFormat = "json"
+	formatYAML  outputFormat = "yaml"
+)
+
+// String implements pflag.Value
+func (f *outputFormat) String() string {
+	return string(*f)
+}
+
+// Set implements pflag.Value
+func (f *outputFormat) Set(v string) error {
+	switch outputFormat(v) {
+	case formatTable, formatJSON, formatYAML:
+		*f = outputFormat(v)
+		return nil
+	default:
+		return fmt.Errorf("must be one of table, json, yaml")
+	}
+}
+
+// Type implements pflag.Value
+func (f *outputFormat) Type() string {
+	return "format"
+}
+
+// structured reports whether the format is meant for scripts, in which
+// case progress messages go to stderr
+func (f outputFormat) structured() bool {
+	return f == formatJSON || f == formatYAML
+}
+
+// addFormatFlag adds the --output flag shared by commands that print results
+func addFormatFlag(cmd *cobra.Command, f *outputFormat) {
+	*f = formatTable
+	cmd.Flags().VarP(f, "output", "o", "output format (table, json, yaml)")
+}
+
+// progress returns where a command should write progress messages
+func (f outputFormat) progress() io.Writer {
+	if f.structured() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// render writes v to stdout as JSON or YAML, or calls table with a
+// tabwriter for the table format. YAML uses the same field names as JSON.
+func render(f outputFormat, v interface{}, table func(w io.Writer)) error {
+	switch f {
+	case formatJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case formatYAML:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var doc interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		table(w)
+		return w.Flush()
+	}
+}
@@ -0,0 +1,186 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/incident"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/nodedb"
+	"github.com/iamruinous/meshtastic-message-relay/internal/notes"
+)
+
+var (
+	incidentFrom   string
+	incidentTo     string
+	incidentFormat string
+	incidentOut    string
+	incidentLogs   []string
+)
+
+var incidentCmd = &cobra.Command{
+	Use:   "incident",
+	Short: "Build after-action reports",
+}
+
+var incidentExportCmd = &cobra.Command{
+	Use:   "export <file>...",
+	Short: "Write a chronological report of a deployment",
+	Long: `Write one chronological report of a deployment, e.g. for the
+after-action review of a search and rescue or an event, as Markdown or a
+self-contained HTML page.
+
+The timeline holds:
+
+  messages     text messages and detection sensor events, from JSON Lines
+               message logs (the file output with format: json)
+  alerts       offline, low battery, and detection alerts, recomputed from
+               the messages with the alerts settings
+  connection   the relay starting and stopping and the device connection
+               dropping and coming back, from the relay's JSON logs (--logs)
+  notes        operator notes, from notes.path
+
+Positions are gathered into one track per node, listed after the
+timeline and, in HTML, drawn together. Node names come from the messages
+and from nodedb.path.
+
+Pass rotated message logs oldest first.
+
+Examples:
+  # Markdown report of last night's search
+  meshtastic-relay incident export --from 2025-06-01T18:00:00Z --to 2025-06-02T06:00:00Z \
+    messages.log.1 messages.log > search.md
+
+  # HTML report of the last 12 hours, with connection events
+  meshtastic-relay incident export --from 12h --logs relay.log --out report.html messages.log`,
+	Args:         cobra.ArbitraryArgs,
+	SilenceUsage: true,
+	RunE:         runIncidentExport,
+}
+
+func init() {
+	rootCmd.AddCommand(incidentCmd)
+	incidentCmd.AddCommand(incidentExportCmd)
+
+	incidentExportCmd.Flags().StringVar(&incidentFrom, "from", "", "start of the report (RFC3339 time or duration ago)")
+	incidentExportCmd.Flags().StringVar(&incidentTo, "to", "", "end of the report (RFC3339 time or duration ago)")
+	incidentExportCmd.Flags().StringVar(&incidentFormat, "format", "", "report format: markdown or html (default from --out, else markdown)")
+	incidentExportCmd.Flags().StringVar(&incidentOut, "out", "", "file to write the report to (default stdout)")
+	incidentExportCmd.Flags().StringSliceVar(&incidentLogs, "logs", nil, "relay JSON log files to take connection events from")
+}
+
+func runIncidentExport(_ *cobra.Command, args []string) error {
+	if len(args) == 0 && len(incidentLogs) == 0 {
+		return fmt.Errorf("give message logs to report on, or --logs")
+	}
+
+	from, err := parseTimeBound(incidentFrom)
+	if err != nil {
+		return fmt.Errorf("invalid --from: %w", err)
+	}
+	to, err := parseTimeBound(incidentTo)
+	if err != nil {
+		return fmt.Errorf("invalid --to: %w", err)
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return fmt.Errorf("--to is before --from")
+	}
+
+	format := incidentFormat
+	if format == "" {
+		format = "markdown"
+		if ext := strings.ToLower(filepath.Ext(incidentOut)); ext == ".html" || ext == ".htm" {
+			format = "html"
+		}
+	}
+	if !slices.Contains(incident.Formats, format) {
+		return fmt.Errorf("unknown --format %q (use %s)", format, strings.Join(incident.Formats, " or "))
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	b := incident.New(from, to, cfg.Alerts)
+	if cfg.NodeDB.Path != "" {
+		db, err := nodedb.Open(cfg.NodeDB)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		} else {
+			for _, n := range db.List() {
+				b.AddNode(n.Num, n.User)
+			}
+		}
+	}
+
+	for _, path := range args {
+		err := replayFile(context.Background(), path, func(p *message.Packet) error {
+			b.AddPacket(p)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	for _, path := range incidentLogs {
+		if err := readLogFile(path, b.AddLogEntry); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if cfg.Notes.Path != "" {
+		store, err := notes.Open(cfg.Notes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		} else {
+			for _, n := range store.List(notes.Query{}) {
+				b.AddNote(n)
+			}
+		}
+	}
+
+	report := b.Report()
+	if incidentOut == "" {
+		return incident.Write(os.Stdout, report, format)
+	}
+
+	f, err := os.Create(incidentOut)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %w", err)
+	}
+	if err := incident.Write(f, report, format); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s: %d events, %d tracks\n", incidentOut, len(report.Events), len(report.Tracks))
+	return nil
+}
+
+// readLogFile calls fn for every line of a log file
+func readLogFile(path string, fn func([]byte)) error {
+	f, err := message.OpenLog(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fn(scanner.Bytes())
+	}
+	return scanner.Err()
+}
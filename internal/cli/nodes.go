@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/api"
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+	"github.com/iamruinous/meshtastic-message-relay/internal/nodedb"
+	"github.com/iamruinous/meshtastic-message-relay/internal/notes"
+)
+
+var (
+	nodesDevice bool
+	nodesFormat outputFormat
+)
+
+var nodesCmd = &cobra.Command{
+	Use:   "nodes",
+	Short: "List the nodes the relay knows about",
+	Long: `List the nodes in the relay's node database (nodedb.path), most
+recently heard first.
+
+With --device, connect to the configured device and list its own node
+database instead, after a summary of the device's firmware, hardware
+model, role, and network capabilities. JSON and YAML output then hold
+the device profile under "device" and the list under "nodes".
+
+Operator notes on nodes (notes.path) are shown in the NOTES column and
+included in JSON and YAML output.
+
+Examples:
+  # Nodes saved by the running relay
+  meshtastic-relay nodes
+
+  # Nodes known to the device, as JSON
+  meshtastic-relay nodes --device -o json`,
+	Args: cobra.NoArgs,
+	RunE: runNodes,
+}
+
+func init() {
+	rootCmd.AddCommand(nodesCmd)
+
+	nodesCmd.Flags().BoolVar(&nodesDevice, "device", false, "list the connected device's node database")
+	addFormatFlag(nodesCmd, &nodesFormat)
+}
+
+// deviceReport is the structured output of nodes --device
+type deviceReport struct {
+	Device *connection.DeviceProfile `json:"device"`
+	Nodes  []api.Node                `json:"nodes"`
+}
+
+func runNodes(_ *cobra.Command, _ []string) error {
+	var db *nodedb.DB
+	var profile *connection.DeviceProfile
+	var err error
+	if nodesDevice {
+		db, profile, err = deviceNodes()
+	} else {
+		db, err = savedNodes()
+	}
+	if err != nil {
+		return err
+	}
+
+	nodes := db.List()
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].LastHeard.After(nodes[j].LastHeard) })
+
+	store := savedNotes()
+	annotated := make([]api.Node, len(nodes))
+	for i, n := range nodes {
+		annotated[i] = api.Node{Node: n}
+		if store != nil {
+			annotated[i].Notes = store.OnNode(n.Num)
+		}
+	}
+
+	var v interface{} = annotated
+	if nodesDevice {
+		v = deviceReport{Device: profile, Nodes: annotated}
+		if !nodesFormat.structured() {
+			printProfile(profile)
+		}
+	}
+	if len(nodes) == 0 && !nodesFormat.structured() {
+		fmt.Println("No nodes known")
+		return nil
+	}
+
+	now := time.Now()
+	return render(nodesFormat, v, func(w io.Writer) {
+		_, _ = fmt.Fprintln(w, "ID\tNAME\tSHORT\tLAST HEARD\tSNR\tBATTERY\tNOTES")
+		for _, n := range annotated {
+			name, short := "-", "-"
+			if n.User != nil {
+				name, short = valueOr(n.User.LongName, "-"), valueOr(n.User.ShortName, "-")
+			}
+			heard := "-"
+			if !n.LastHeard.IsZero() {
+				heard = now.Sub(n.LastHeard).Round(time.Second).String() + " ago"
+			}
+			battery := "-"
+			if t := n.Latest(); t != nil && t.BatteryLevel > 0 {
+				battery = fmt.Sprintf("%d%%", t.BatteryLevel)
+			}
+			_, _ = fmt.Fprintf(w, "!%08x\t%s\t%s\t%s\t%.1f\t%s\t%s\n", n.Num, name, short, heard, n.SNR, battery, noteSummary(n.Notes))
+		}
+	})
+}
+
+// savedNodes opens the node database the relay saves
+func savedNodes() (*nodedb.DB, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if cfg.NodeDB.Path == "" {
+		return nil, fmt.Errorf("nodedb.path is not set; use --device to list the device's nodes")
+	}
+	return nodedb.Open(cfg.NodeDB)
+}
+
+// savedNotes opens the notes the relay saves, or returns nil when there
+// are none to show
+func savedNotes() *notes.Store {
+	cfg, err := config.Load()
+	if err != nil || cfg.Notes.Path == "" {
+		return nil
+	}
+	store, err := notes.Open(cfg.Notes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return nil
+	}
+	return store
+}
+
+// noteSummary joins the text and tags of notes for the table
+func noteSummary(list []notes.Note) string {
+	var parts []string
+	for _, n := range list {
+		parts = append(parts, n.String())
+	}
+	return valueOr(strings.Join(parts, "; "), "-")
+}
+
+// printProfile prints the summary of the device above the node table
+func printProfile(p *connection.DeviceProfile) {
+	if p == nil {
+		fmt.Println("Device: metadata not reported")
+		fmt.Println()
+		return
+	}
+	fmt.Printf("Device: !%08x firmware %s, hardware model %d, role %s, interfaces %s\n",
+		p.NodeNum, valueOr(p.Firmware, "unknown"), p.HwModel, p.Role, p.Capabilities())
+	fmt.Println()
+}
+
+// deviceNodes reads the connected device's node database and profile
+func deviceNodes() (*nodedb.DB, *connection.DeviceProfile, error) {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	conn, err := connectDevice(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	dir, ok := conn.(connection.NodeDirectory)
+	if !ok {
+		return nil, nil, fmt.Errorf("connection %s does not provide a node database", conn.Name())
+	}
+	db, err := nodedb.Open(config.NodeDBConfig{})
+	if err != nil {
+		return nil, nil, err
+	}
+	db.Import(dir.Nodes())
+	return db, connection.Profile(conn), nil
+}
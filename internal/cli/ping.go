@@ -0,0 +1,177 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/ping"
+)
+
+var (
+	pingCount    int
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+	pingChannel  uint32
+	pingText     string
+	pingFormat   outputFormat
+)
+
+// pingReport is the ping command's structured output
+type pingReport struct {
+	Node     string       `json:"node"`
+	Sent     int          `json:"sent"`
+	Received int          `json:"received"`
+	Loss     float64      `json:"loss"`
+	MinMS    float64      `json:"rtt_min_ms,omitempty"`
+	AvgMS    float64      `json:"rtt_avg_ms,omitempty"`
+	MaxMS    float64      `json:"rtt_max_ms,omitempty"`
+	StdDevMS float64      `json:"rtt_stddev_ms,omitempty"`
+	Probes   []pingResult `json:"probes"`
+}
+
+// pingResult is one probe in a pingReport
+type pingResult struct {
+	Seq   int     `json:"seq"`
+	RTTMS float64 `json:"rtt_ms,omitempty"`
+	Hops  *int    `json:"hops,omitempty"`
+	Error string  `json:"error,omitempty"`
+}
+
+// formatHops describes a hop count, which is negative when unknown
+func formatHops(hops int) string {
+	switch {
+	case hops < 0:
+		return "hops unknown"
+	case hops == 0:
+		return "direct"
+	case hops == 1:
+		return "1 hop"
+	}
+	return fmt.Sprintf("%d hops", hops)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+var pingCmd = &cobra.Command{
+	Use:   "ping <node>",
+	Short: "Measure round-trip latency to a node",
+	Long: `Send probes with want_ack set to a node and report how long the
+acknowledgement takes to come back and how many hops it took, along with
+loss and latency statistics. Useful for validating links after antenna or
+placement changes. Hop counts need firmware 2.3 or later on the node.
+
+Probes use the reply port so they do not show up as chat messages. Use
+--text to send text messages instead, e.g. to nodes that ignore the reply
+port. Only serial and TCP connections support ping.
+
+The node may be given as !1234abcd, 0x1234abcd, or a decimal number.
+
+Examples:
+  # Five probes, ten seconds apart
+  meshtastic-relay ping !1234abcd
+
+  # Twenty probes as text messages on channel 1
+  meshtastic-relay ping !1234abcd -n 20 --channel 1 --text "link test"`,
+	Args: cobra.ExactArgs(1),
+	RunE: runPing,
+}
+
+func init() {
+	rootCmd.AddCommand(pingCmd)
+
+	pingCmd.Flags().IntVarP(&pingCount, "count", "n", 5, "number of probes to send")
+	pingCmd.Flags().DurationVarP(&pingInterval, "interval", "i", 10*time.Second, "time between probes")
+	pingCmd.Flags().DurationVar(&pingTimeout, "timeout", 60*time.Second, "how long to wait for each ack")
+	pingCmd.Flags().Uint32Var(&pingChannel, "channel", 0, "channel index to send on")
+	pingCmd.Flags().StringVar(&pingText, "text", "", "send probes as text messages with this prefix")
+	addFormatFlag(pingCmd, &pingFormat)
+}
+
+func runPing(_ *cobra.Command, args []string) error {
+	to, err := message.ParseNodeID(args[0])
+	if err != nil {
+		return err
+	}
+	if pingCount < 1 {
+		return fmt.Errorf("--count must be at least 1")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	conn, err := connectDevice(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	transport, ok := conn.(connection.AckTransport)
+	if !ok {
+		return fmt.Errorf("connection %s does not support acknowledgements", conn.Name())
+	}
+
+	pinger := ping.New(transport, to)
+	pinger.Channel = pingChannel
+	pinger.Timeout = pingTimeout
+	if pingText != "" {
+		pinger.Port = message.PortNumTextMessage
+		pinger.Text = pingText
+	}
+
+	progress := pingFormat.progress()
+	_, _ = fmt.Fprintf(progress, "PING !%08x: %d probes, %s apart\n", to, pingCount, pingInterval)
+	results := pinger.Run(ctx, pingCount, pingInterval, func(r ping.Result) {
+		if r.Err != nil {
+			_, _ = fmt.Fprintf(progress, "seq=%d lost: %v\n", r.Seq, r.Err)
+			return
+		}
+		_, _ = fmt.Fprintf(progress, "seq=%d ack in %s, %s\n", r.Seq, r.RTT.Round(time.Millisecond), formatHops(r.Hops))
+	})
+
+	stats := ping.Summarize(results)
+	if pingFormat.structured() {
+		report := pingReport{
+			Node:     fmt.Sprintf("!%08x", to),
+			Sent:     stats.Sent,
+			Received: stats.Received,
+			Loss:     stats.Loss(),
+			MinMS:    milliseconds(stats.Min),
+			AvgMS:    milliseconds(stats.Avg),
+			MaxMS:    milliseconds(stats.Max),
+			StdDevMS: milliseconds(stats.StdDev),
+			Probes:   make([]pingResult, 0, len(results)),
+		}
+		for _, r := range results {
+			p := pingResult{Seq: r.Seq, RTTMS: milliseconds(r.RTT)}
+			if r.Hops >= 0 {
+				p.Hops = &r.Hops
+			}
+			if r.Err != nil {
+				p = pingResult{Seq: r.Seq, Error: r.Err.Error()}
+			}
+			report.Probes = append(report.Probes, p)
+		}
+		return render(pingFormat, report, func(io.Writer) {})
+	}
+
+	fmt.Printf("\n--- !%08x ping statistics ---\n", to)
+	fmt.Printf("%d sent, %d acknowledged, %.0f%% loss\n", stats.Sent, stats.Received, stats.Loss()*100)
+	if stats.Received > 0 {
+		fmt.Printf("rtt min/avg/max/stddev = %s/%s/%s/%s\n",
+			stats.Min.Round(time.Millisecond),
+			stats.Avg.Round(time.Millisecond),
+			stats.Max.Round(time.Millisecond),
+			stats.StdDev.Round(time.Millisecond))
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+	"github.com/iamruinous/meshtastic-message-relay/internal/discovery"
+)
+
+var (
+	portsProbe   bool
+	portsAll     bool
+	portsLAN     bool
+	portsTimeout time.Duration
+	portsFormat  outputFormat
+)
+
+// portReport is one port in the ports command's output
+type portReport struct {
+	connection.SerialPort
+	Likely  bool              `json:"likely"`
+	Probe   *portProbe        `json:"probe,omitempty"`
+	Network *discovery.Device `json:"network,omitempty"` // set for devices found with --lan
+}
+
+// portProbe is the result of probing a port
+type portProbe struct {
+	Node     string `json:"node,omitempty"`
+	Firmware string `json:"firmware,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+var portsCmd = &cobra.Command{
+	Use:   "ports",
+	Short: "List serial ports and network devices that may be Meshtastic nodes",
+	Long: `List the host's serial ports. Ports whose USB IDs belong to a chip used
+on Meshtastic boards are marked with * and listed first; the USB-serial
+bridges among them are common on other hardware too.
+
+With --probe, each marked port (every port with --all) is opened and asked
+for its node info, confirming which one has a Meshtastic device. Baud rate,
+settle delay, and DTR/RTS come from connection.serial. Probing opens the
+port, which resets many boards, so do not probe the port a running relay
+is using.
+
+With --lan, Meshtastic devices found on the local network, as by the
+discover command, are listed after the serial ports with their TCP address
+as the port. They answered discovery, so they are marked and not probed.
+
+Examples:
+  meshtastic-relay ports
+  meshtastic-relay ports --probe
+  meshtastic-relay ports --probe --all -o json
+  meshtastic-relay ports --lan`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runPorts,
+}
+
+func init() {
+	rootCmd.AddCommand(portsCmd)
+
+	portsCmd.Flags().BoolVarP(&portsProbe, "probe", "p", false, "open the marked ports to confirm a device answers")
+	portsCmd.Flags().BoolVar(&portsAll, "all", false, "with --probe, probe every port")
+	portsCmd.Flags().BoolVar(&portsLAN, "lan", false, "also list Meshtastic devices found on the local network")
+	portsCmd.Flags().DurationVarP(&portsTimeout, "timeout", "t", 5*time.Second, "how long to wait for each probed device")
+	addFormatFlag(portsCmd, &portsFormat)
+}
+
+func runPorts(_ *cobra.Command, _ []string) error {
+	ports, err := connection.SerialPorts()
+	if err != nil {
+		return err
+	}
+
+	reports := make([]portReport, 0, len(ports))
+	for _, p := range ports {
+		reports = append(reports, portReport{SerialPort: p, Likely: p.Likely()})
+	}
+	if portsLAN {
+		found, err := discoverPorts()
+		if err != nil {
+			return err
+		}
+		reports = append(reports, found...)
+	}
+
+	if portsProbe {
+		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer cancel()
+
+		serialCfg := config.DefaultConfig().Connection.Serial
+		if cfg, err := config.Load(); err == nil {
+			serialCfg = cfg.Connection.Serial
+		}
+		for i := range reports {
+			r := &reports[i]
+			if r.Network != nil || !r.Likely && !portsAll {
+				continue
+			}
+			_, _ = fmt.Fprintf(portsFormat.progress(), "Probing %s...\n", r.Name)
+			serialCfg.Port = r.Name
+			r.Probe = probePort(ctx, serialCfg)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+		}
+	}
+
+	if len(reports) == 0 && !portsFormat.structured() {
+		if portsLAN {
+			fmt.Println("No serial ports or network devices found")
+		} else {
+			fmt.Println("No serial ports found")
+		}
+		return nil
+	}
+
+	return render(portsFormat, reports, func(w io.Writer) {
+		header := "\tPORT\tUSB ID\tCHIP\tPRODUCT"
+		if portsProbe {
+			header += "\tDEVICE"
+		}
+		_, _ = fmt.Fprintln(w, header)
+		for _, r := range reports {
+			mark, usbID := "", "-"
+			if r.Likely {
+				mark = "*"
+			}
+			if r.VID != "" {
+				usbID = r.VID + ":" + r.PID
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s", mark, r.Name, usbID, valueOr(r.Chip, "-"), valueOr(r.Product, "-"))
+			if portsProbe {
+				_, _ = fmt.Fprintf(w, "\t%s", r.Probe.describe())
+			}
+			_, _ = fmt.Fprintln(w)
+		}
+	})
+}
+
+// discoverPorts searches the local network for Meshtastic devices and
+// reports each one as a port at its TCP address
+func discoverPorts() ([]portReport, error) {
+	_, _ = fmt.Fprintf(portsFormat.progress(), "Searching for Meshtastic devices (%v)...\n", discovery.DefaultTimeout)
+	devices, err := discovery.Discover(context.Background(), discovery.Options{
+		Timeout: discovery.DefaultTimeout,
+		Passive: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+
+	reports := make([]portReport, 0, len(devices))
+	for i := range devices {
+		d := &devices[i]
+		product := valueOr(d.Name, d.Hostname)
+		if product != "" {
+			product += " "
+		}
+		reports = append(reports, portReport{
+			SerialPort: connection.SerialPort{Name: d.Address(), Product: product + "(" + d.Source + ")"},
+			Likely:     true,
+			Network:    d,
+		})
+	}
+	return reports, nil
+}
+
+// probePort asks the device on a port for its node info
+func probePort(ctx context.Context, cfg config.SerialConfig) *portProbe {
+	ctx, cancel := context.WithTimeout(ctx, portsTimeout+cfg.SettleDelay)
+	defer cancel()
+
+	p, err := connection.ProbeSerial(ctx, cfg)
+	if err != nil {
+		return &portProbe{Error: err.Error()}
+	}
+	return &portProbe{Node: fmt.Sprintf("!%08x", p.NodeNum), Firmware: p.Firmware}
+}
+
+// describe summarizes a probe for the table format
+func (p *portProbe) describe() string {
+	switch {
+	case p == nil:
+		return "-"
+	case p.Error != "":
+		return "no: " + p.Error
+	case p.Firmware != "":
+		return p.Node + " (firmware " + p.Firmware + ")"
+	}
+	return p.Node
+}
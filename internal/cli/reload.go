@@ -0,0 +1,208 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/logging"
+	"github.com/iamruinous/meshtastic-message-relay/internal/relay"
+)
+
+// reloadSettle is how long the config file must go unchanged before it is
+// reloaded, since editors often write a file in several steps
+const reloadSettle = 500 * time.Millisecond
+
+// reloadable lists the settings relay.Service.Reload applies while
+// running, along with everything below them
+var reloadable = []string{"outputs", "filters", "routes", "connection.filters"}
+
+// isReloadable reports whether a changed setting is applied without a
+// restart
+func isReloadable(key string) bool {
+	for _, r := range reloadable {
+		if key == r || strings.HasPrefix(key, r+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// watchConfig reloads the configuration on SIGHUP and, with
+// relay.watch_config, whenever the config file changes, until ctx is done.
+// Outputs, filters, connection filters, and routes are applied without
+// touching the connection; the other settings that changed are logged as waiting for a
+// restart.
+func watchConfig(ctx context.Context, service *relay.Service, cfg *config.Config) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var changes <-chan struct{}
+	if path := viper.ConfigFileUsed(); cfg.Relay.WatchConfig && path != "" {
+		if w, err := newConfigWatcher(path, reloadSettle); err != nil {
+			logging.Warn("Not watching config file", zap.Error(err))
+		} else {
+			go w.Run(ctx)
+			changes = w.Changes()
+			logging.Info("Watching config file for changes", zap.String("path", path))
+		}
+	}
+
+	go func() {
+		defer signal.Stop(hup)
+		current := cfg
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				current = reloadConfig(service, current, "SIGHUP")
+			case <-changes:
+				current = reloadConfig(service, current, "file change")
+			}
+		}
+	}()
+}
+
+// configWatcher reports changes to a config file once it has gone
+// unchanged for the settle delay. It only reports them: the file is read
+// by reloadConfig alone, since viper's own watcher would reread it into
+// the shared config concurrently with a SIGHUP reload. The directory is
+// watched so that a file replaced by an editor or a symlink swap is
+// noticed; events for the other files in it are ignored.
+type configWatcher struct {
+	path    string // absolute path of the config file
+	target  string // the file path resolves to, which changes in a symlink swap
+	settle  time.Duration
+	watcher *fsnotify.Watcher
+	changes chan struct{}
+}
+
+// newConfigWatcher starts watching the directory of the config file at path
+func newConfigWatcher(path string, settle time.Duration) (*configWatcher, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch config file: %w", err)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch config file: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		_ = watcher.Close()
+		return nil, fmt.Errorf("failed to watch config file: %w", err)
+	}
+	target, _ := filepath.EvalSymlinks(path)
+	return &configWatcher{
+		path:    path,
+		target:  target,
+		settle:  settle,
+		watcher: watcher,
+		changes: make(chan struct{}, 1),
+	}, nil
+}
+
+// Changes returns the channel that receives a value after each settled
+// change to the file
+func (w *configWatcher) Changes() <-chan struct{} {
+	return w.changes
+}
+
+// Run reports changes until ctx is done, then stops watching
+func (w *configWatcher) Run(ctx context.Context) {
+	defer func() { _ = w.watcher.Close() }()
+
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			written := filepath.Clean(event.Name) == w.path && event.Op&(fsnotify.Write|fsnotify.Create) != 0
+			// A symlinked file changes when its target does
+			current, _ := filepath.EvalSymlinks(w.path)
+			if !written && (current == "" || current == w.target) {
+				continue
+			}
+			w.target = current
+			settle = time.After(w.settle)
+		case <-settle:
+			settle = nil
+			select {
+			case w.changes <- struct{}{}:
+			default:
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			logging.Warn("Error watching config file", zap.Error(err))
+		}
+	}
+}
+
+// reloadConfig rereads the config file, logs which settings differ from
+// current, and applies them to service. It returns the configuration to
+// compare the next reload against: the new one, or current if nothing
+// could be applied.
+func reloadConfig(service *relay.Service, current *config.Config, trigger string) *config.Config {
+	if err := config.ReadInConfig(); err != nil {
+		logging.Error("Failed to read config file", zap.Error(err))
+		return current
+	}
+	cfg, err := config.Load()
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		logging.Error("Ignoring invalid configuration; keeping the running one",
+			zap.String("trigger", trigger),
+			zap.Error(err))
+		return current
+	}
+
+	changed := config.Diff(current, cfg)
+	if len(changed) == 0 {
+		logging.Info("Configuration unchanged", zap.String("trigger", trigger))
+		return current
+	}
+	var applied, pending []string
+	for _, key := range changed {
+		if isReloadable(key) {
+			applied = append(applied, key)
+		} else {
+			pending = append(pending, key)
+		}
+	}
+	logging.Info("Configuration changed",
+		zap.String("trigger", trigger),
+		zap.Strings("settings", changed))
+
+	if len(applied) > 0 {
+		summary, err := service.Reload(cfg)
+		if err != nil {
+			logging.Error("Failed to reload configuration", zap.Error(err))
+		}
+		// Without a summary nothing was applied
+		if summary == nil {
+			return current
+		}
+	}
+	if len(pending) > 0 {
+		logging.Warn("Some settings take effect on restart", zap.Strings("settings", pending))
+	}
+	return cfg
+}
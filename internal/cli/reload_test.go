@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+)
+
+const testSettle = 100 * time.Millisecond
+
+// startWatcher watches path until the test ends
+func startWatcher(t *testing.T, path string) *configWatcher {
+	t.Helper()
+	w, err := newConfigWatcher(path, testSettle)
+	if err != nil {
+		t.Fatalf("newConfigWatcher: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go w.Run(ctx)
+	return w
+}
+
+// changes counts the changes w reports within d
+func changes(w *configWatcher, d time.Duration) int {
+	n := 0
+	timeout := time.After(d)
+	for {
+		select {
+		case <-w.Changes():
+			n++
+		case <-timeout:
+			return n
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigWatcherSettles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, "a: 1\n")
+	w := startWatcher(t, path)
+
+	// Several writes in quick succession are one change
+	for i := 0; i < 5; i++ {
+		writeFile(t, path, "a: 2\n")
+		time.Sleep(testSettle / 4)
+	}
+	if n := changes(w, 5*testSettle); n != 1 {
+		t.Errorf("changes = %d, want 1", n)
+	}
+
+	writeFile(t, path, "a: 3\n")
+	if n := changes(w, 5*testSettle); n != 1 {
+		t.Errorf("changes after a later write = %d, want 1", n)
+	}
+}
+
+func TestConfigWatcherIgnoresSiblings(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeFile(t, path, "a: 1\n")
+	w := startWatcher(t, path)
+
+	writeFile(t, filepath.Join(dir, "other.yaml"), "b: 1\n")
+	writeFile(t, filepath.Join(dir, ".config.yaml.swp"), "x")
+	if err := os.Remove(filepath.Join(dir, "other.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if n := changes(w, 5*testSettle); n != 0 {
+		t.Errorf("changes = %d, want 0", n)
+	}
+}
+
+func TestConfigWatcherSymlinkSwap(t *testing.T) {
+	// The layout of a Kubernetes ConfigMap volume: config.yaml links
+	// through ..data, which is swapped atomically to a new directory
+	dir := t.TempDir()
+	for _, v := range []string{"v1", "v2"} {
+		if err := os.Mkdir(filepath.Join(dir, v), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, filepath.Join(dir, v, "config.yaml"), "version: "+v+"\n")
+	}
+	if err := os.Symlink("v1", filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.Symlink(filepath.Join("..data", "config.yaml"), path); err != nil {
+		t.Fatal(err)
+	}
+	w := startWatcher(t, path)
+
+	if err := os.Symlink("v2", filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	if n := changes(w, 5*testSettle); n != 1 {
+		t.Errorf("changes = %d, want 1", n)
+	}
+}
+
+func TestReloadableSettings(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"outputs", true},
+		{"filters.message_types", true},
+		{"routes", true},
+		{"connection.filters.node_ids", true},
+		{"connection.filters", true},
+		{"connection.type", false},
+		{"connection.serial.port", false},
+		{"filtersx", false},
+		{"api.listen", false},
+	}
+	for _, tt := range tests {
+		if got := isReloadable(tt.key); got != tt.want {
+			t.Errorf("isReloadable(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+
+	// The keys Diff reports for an edit to the connection's filters
+	a, b := config.DefaultConfig(), config.DefaultConfig()
+	b.Connection.Filters.MessageTypes = []string{"text"}
+	changed := config.Diff(a, b)
+	if len(changed) == 0 {
+		t.Fatal("Diff reported no change")
+	}
+	for _, key := range changed {
+		if !isReloadable(key) {
+			t.Errorf("%s takes effect only on restart", key)
+		}
+	}
+}
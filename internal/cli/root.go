@@ -7,6 +7,9 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/logging"
 )
 
 var (
@@ -66,8 +69,28 @@ func initConfig() {
 	viper.SetEnvPrefix("MESH_RELAY")
 	viper.AutomaticEnv()
 
-	// Read config file if it exists (errors are intentionally ignored)
-	_ = viper.ReadInConfig()
+	// Read config file if it exists (errors are intentionally ignored;
+	// config.Load resolves its secrets and reports those it cannot)
+	_ = config.ReadInConfig()
+}
+
+// logConfig returns the logging settings, which are needed before the rest
+// of the configuration is loaded
+func logConfig() logging.Config {
+	defaults := config.DefaultConfig().Logging
+	cfg := logging.Config{
+		Level:           viper.GetString("logging.level"),
+		Format:          viper.GetString("logging.format"),
+		SampleThreshold: defaults.SampleThreshold,
+		SampleInterval:  defaults.SampleInterval,
+	}
+	if viper.IsSet("logging.sample_threshold") {
+		cfg.SampleThreshold = viper.GetInt("logging.sample_threshold")
+	}
+	if d := viper.GetDuration("logging.sample_interval"); d > 0 {
+		cfg.SampleInterval = d
+	}
+	return cfg
 }
 
 // GetConfigFile returns the config file being used
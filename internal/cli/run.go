@@ -6,20 +6,25 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 
+	"github.com/iamruinous/meshtastic-message-relay/internal/api"
 	"github.com/iamruinous/meshtastic-message-relay/internal/config"
 	"github.com/iamruinous/meshtastic-message-relay/internal/logging"
 	"github.com/iamruinous/meshtastic-message-relay/internal/relay"
 	"github.com/iamruinous/meshtastic-message-relay/internal/tui"
+	"github.com/iamruinous/meshtastic-message-relay/internal/web"
 )
 
 var (
 	dryRun      bool
 	interactive bool
+	sampleFrom  string
+	sampleCount int
 )
 
 var runCmd = &cobra.Command{
@@ -31,7 +36,29 @@ The service will connect to a Meshtastic node using the configured
 connection method and forward received messages to the configured
 output destinations.
 
-Use --interactive or -i to run with an interactive TUI.`,
+Use --interactive or -i to run with an interactive TUI. To watch a relay
+already running in the background, use attach instead.
+
+The connection can be set with flags instead of the config file, which
+they override, for quick one-off runs:
+
+  meshtastic-relay run --connection.type serial --connection.serial.port /dev/ttyACM0
+  meshtastic-relay run --connection.type tcp --connection.tcp.host 192.168.1.50
+
+Use --safe-mode to guarantee nothing is written to the radio: sending,
+quick replies, scheduled broadcasts, replay requests, and mailbox delivery
+are disabled, for monitoring meshes where transmissions must be strictly
+controlled. The same as relay.safe_mode in the config file.
+
+Use --dry-run to validate the configuration without connecting. Add
+--sample simulator (or --sample path/to/messages.jsonl) to also show
+exactly what each enabled output would send for a few sample packets,
+with secrets in URLs and headers masked. Nothing is delivered.
+
+Send SIGHUP to reload the config file; with relay.watch_config (the
+default) it is also reloaded whenever it changes. Outputs, filters, and
+routes are applied without dropping the radio connection, and the
+settings that changed are logged; other settings take effect on restart.`,
 	RunE: runRelay,
 }
 
@@ -40,14 +67,35 @@ func init() {
 
 	runCmd.Flags().BoolVar(&dryRun, "dry-run", false, "validate configuration without starting the service")
 	runCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "run with interactive TUI")
+	runCmd.Flags().StringVar(&sampleFrom, "sample", "", `with --dry-run, preview outputs using packets from "simulator" or a JSONL file`)
+	runCmd.Flags().IntVar(&sampleCount, "sample-count", 3, "number of sample packets to preview")
+	runCmd.Flags().Bool("safe-mode", false, "never write to the radio (no sending, broadcasts, or replay)")
+
+	_ = viper.BindPFlag("relay.safe_mode", runCmd.Flags().Lookup("safe-mode"))
+
+	// Connection overrides; unset flags leave the config file's values
+	f := runCmd.Flags()
+	f.String("connection.type", "", "connection type (serial, tcp, mqtt)")
+	f.String("connection.serial.port", "", "serial port, e.g. /dev/ttyUSB0")
+	f.Int("connection.serial.baud", 0, "serial baud rate (default 115200)")
+	f.String("connection.tcp.host", "", `TCP host of the node, or "auto" to discover one`)
+	f.Int("connection.tcp.port", 0, "TCP port of the node (default 4403)")
+	f.String("connection.mqtt.broker", "", "MQTT broker URL, e.g. tcp://localhost:1883")
+	for _, name := range []string{
+		"connection.type",
+		"connection.serial.port",
+		"connection.serial.baud",
+		"connection.tcp.host",
+		"connection.tcp.port",
+		"connection.mqtt.broker",
+	} {
+		_ = viper.BindPFlag(name, f.Lookup(name))
+	}
 }
 
 func runRelay(_ *cobra.Command, _ []string) error {
 	// Initialize logging
-	logCfg := logging.Config{
-		Level:  viper.GetString("logging.level"),
-		Format: viper.GetString("logging.format"),
-	}
+	logCfg := logConfig()
 
 	// For interactive mode, use text format and reduce log noise
 	if interactive {
@@ -75,9 +123,17 @@ func runRelay(_ *cobra.Command, _ []string) error {
 	if err := cfg.Validate(); err != nil {
 		return fmt.Errorf("invalid configuration: %w", err)
 	}
+	if cfg.Version < config.CurrentVersion {
+		logging.Warn("Config file uses an older layout; upgrade it with 'meshtastic-relay config migrate'",
+			zap.Int("version", cfg.Version),
+			zap.Int("current", config.CurrentVersion))
+	}
 
 	if dryRun {
 		fmt.Println("Configuration is valid!")
+		if cfg.Version < config.CurrentVersion {
+			fmt.Printf("  Version: %d (upgrade with config migrate)\n", cfg.Version)
+		}
 		fmt.Printf("  Connection: %s\n", cfg.Connection.Type)
 		enabledOutputs := 0
 		for _, out := range cfg.Outputs {
@@ -90,7 +146,24 @@ func runRelay(_ *cobra.Command, _ []string) error {
 			len(cfg.Filters.MessageTypes),
 			len(cfg.Filters.NodeIDs),
 			len(cfg.Filters.Channels))
-		return nil
+		if cfg.Filters.Expression != "" {
+			fmt.Printf("  Expression: %s\n", cfg.Filters.Expression)
+		}
+		if len(cfg.Routes) > 0 {
+			fmt.Printf("  Routes: %d\n", len(cfg.Routes))
+		}
+		if cfg.Relay.SafeMode {
+			fmt.Println("  Safe mode: nothing will be written to the radio")
+		}
+
+		if sampleFrom == "" {
+			return nil
+		}
+		packets, err := loadSamples(sampleFrom, sampleCount)
+		if err != nil {
+			return err
+		}
+		return previewOutputs(cfg, packets)
 	}
 
 	// Create relay service
@@ -111,6 +184,31 @@ func runRelay(_ *cobra.Command, _ []string) error {
 		return fmt.Errorf("failed to start relay service: %w", err)
 	}
 
+	// Start the HTTP API
+	var server *api.Server
+	if cfg.API.Enabled {
+		server = api.New(cfg.API, service)
+		if err := server.Start(); err != nil {
+			_ = service.Stop()
+			return fmt.Errorf("failed to start API: %w", err)
+		}
+	}
+
+	// Start the web dashboard
+	var dashboard *web.Server
+	if cfg.Web.Enabled {
+		dashboard = web.New(cfg.Web, service)
+		if err := dashboard.Start(); err != nil {
+			if server != nil {
+				_ = server.Close(context.Background())
+			}
+			_ = service.Stop()
+			return fmt.Errorf("failed to start web dashboard: %w", err)
+		}
+	}
+
+	watchConfig(ctx, service, cfg)
+
 	if interactive {
 		// Run TUI
 		go func() {
@@ -118,7 +216,7 @@ func runRelay(_ *cobra.Command, _ []string) error {
 			cancel()
 		}()
 
-		if err := tui.Run(service); err != nil {
+		if err := tui.Run(tui.Local(service)); err != nil {
 			logging.Error("TUI error", zap.Error(err))
 		}
 	} else {
@@ -128,6 +226,22 @@ func runRelay(_ *cobra.Command, _ []string) error {
 		logging.Info("Received shutdown signal")
 	}
 
+	if dashboard != nil {
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := dashboard.Close(shutdownCtx); err != nil {
+			logging.Error("Error stopping web dashboard", zap.Error(err))
+		}
+		cancelShutdown()
+	}
+
+	if server != nil {
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := server.Close(shutdownCtx); err != nil {
+			logging.Error("Error stopping API", zap.Error(err))
+		}
+		cancelShutdown()
+	}
+
 	// Stop the service
 	if err := service.Stop(); err != nil {
 		logging.Error("Error stopping service", zap.Error(err))
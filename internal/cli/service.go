@@ -0,0 +1,186 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/service"
+)
+
+var (
+	serviceOptions service.Options
+	serviceNoStart bool
+	servicePrint   bool
+)
+
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Install the relay as a system service",
+	Long: `Install, remove, and check the relay as a service that starts at boot:
+a systemd unit on Linux or a launchd job on macOS.
+
+System services need root; --user installs one for the current user
+instead, started at login (on a headless Raspberry Pi, also run
+"loginctl enable-linger" so it starts at boot).`,
+}
+
+var serviceInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install and start the relay service",
+	Long: `Install a service that runs this executable with the current config
+file, enable it at boot, and start it. The config file is the one given
+with --config or found in the usual locations, and is checked first.
+
+A system service runs as the user who ran sudo, or root otherwise; change
+this with --run-as. On Linux the service is also given access to serial
+devices through the dialout group.
+
+Examples:
+  # On a Raspberry Pi
+  sudo meshtastic-relay --config /etc/meshtastic-relay/config.yaml service install
+
+  # Show the unit without installing it
+  meshtastic-relay service install --print`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runServiceInstall,
+}
+
+var serviceUninstallCmd = &cobra.Command{
+	Use:          "uninstall",
+	Short:        "Stop and remove the relay service",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runServiceUninstall,
+}
+
+var serviceStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the relay service is installed and running",
+	Long: `Show the service manager's status for the relay service. The command
+exits non-zero when the service is not running.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runServiceStatus,
+}
+
+func init() {
+	rootCmd.AddCommand(serviceCmd)
+	serviceCmd.AddCommand(serviceInstallCmd)
+	serviceCmd.AddCommand(serviceUninstallCmd)
+	serviceCmd.AddCommand(serviceStatusCmd)
+
+	serviceCmd.PersistentFlags().StringVar(&serviceOptions.Name, "name", service.DefaultName, "service name")
+	serviceCmd.PersistentFlags().BoolVar(&serviceOptions.User, "user", false, "manage a service for the current user instead of the system")
+
+	serviceInstallCmd.Flags().StringVar(&serviceOptions.RunAs, "run-as", os.Getenv("SUDO_USER"), "user a system service runs as (default root)")
+	serviceInstallCmd.Flags().BoolVar(&serviceNoStart, "no-start", false, "enable the service without starting it now")
+	serviceInstallCmd.Flags().BoolVar(&servicePrint, "print", false, "print the service definition instead of installing it")
+}
+
+func runServiceInstall(_ *cobra.Command, _ []string) error {
+	opts := serviceOptions
+	if opts.User {
+		opts.RunAs = ""
+	}
+
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		return fmt.Errorf("no config file found; give its path with --config")
+	}
+	cfg, err := config.Load()
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		return fmt.Errorf("%s is invalid: %w", path, err)
+	}
+	if opts.Config, err = filepath.Abs(path); err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the relay executable: %w", err)
+	}
+	if opts.Binary, err = filepath.EvalSymlinks(exe); err != nil {
+		return fmt.Errorf("failed to find the relay executable: %w", err)
+	}
+
+	m, err := service.New(opts)
+	if err != nil {
+		return err
+	}
+	if servicePrint {
+		data, err := m.Definition()
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := checkServiceRoot(opts); err != nil {
+		return err
+	}
+
+	if err := m.Install(!serviceNoStart); err != nil {
+		return err
+	}
+	fmt.Printf("Installed %s\n", m.Path())
+	fmt.Printf("  Runs: %s --config %s run\n", opts.Binary, opts.Config)
+	if opts.RunAs != "" {
+		fmt.Printf("  As:   %s\n", opts.RunAs)
+	}
+	if serviceNoStart && opts.User {
+		fmt.Println("It starts at the next login")
+	} else if serviceNoStart {
+		fmt.Println("It starts at the next boot")
+	}
+	return nil
+}
+
+func runServiceUninstall(_ *cobra.Command, _ []string) error {
+	m, err := service.New(serviceOptions)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(m.Path()); err != nil {
+		return fmt.Errorf("%s is not installed (no %s)", serviceOptions.Name, m.Path())
+	}
+	if err := checkServiceRoot(serviceOptions); err != nil {
+		return err
+	}
+	if err := m.Uninstall(); err != nil {
+		return err
+	}
+	fmt.Printf("Removed %s\n", m.Path())
+	return nil
+}
+
+func runServiceStatus(_ *cobra.Command, _ []string) error {
+	m, err := service.New(serviceOptions)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(m.Path()); err != nil {
+		return fmt.Errorf("%s is not installed (no %s)", serviceOptions.Name, m.Path())
+	}
+	fmt.Printf("Installed: %s\n\n", m.Path())
+	if err := m.Status(); err != nil {
+		return fmt.Errorf("%s is not running", serviceOptions.Name)
+	}
+	return nil
+}
+
+// checkServiceRoot reports when a system service is managed without root
+func checkServiceRoot(opts service.Options) error {
+	if opts.User || os.Geteuid() == 0 {
+		return nil
+	}
+	return fmt.Errorf("system services need root; run with sudo or pass --user")
+}
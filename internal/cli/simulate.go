@@ -3,6 +3,7 @@ package cli
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
 	"syscall"
@@ -20,6 +21,9 @@ var (
 	simInterval  time.Duration
 	simVerbose   bool
 	simSymlink   string
+	simScenario  string
+	simTCP       string
+	simImpair    simulator.Impairments
 )
 
 var simulateCmd = &cobra.Command{
@@ -28,7 +32,10 @@ var simulateCmd = &cobra.Command{
 	Long: `Run a simulated Meshtastic device for testing.
 
 This creates a virtual serial port that behaves like a real Meshtastic node.
-Connect to it using the path printed by this command.
+Connect to it using the path printed by this command. With --tcp, it listens
+on a TCP port instead, speaking the same framed protocol as a node's TCP API,
+so the tcp connection can be tested, and on Windows, where there are no
+pseudo-terminals.
 
 The simulator will:
 - Respond to configuration requests
@@ -36,12 +43,54 @@ The simulator will:
 - Periodically send simulated text messages
 - Display received packets (with --verbose)
 
+With --scenario, it plays a timeline from a YAML file instead of random
+messages: nodes joining, text messages, position tracks, and nodes going
+silent, at fixed offsets from when the relay connects. With a seed set, every
+run sends the same packets, for reproducible integration tests and demos:
+
+  name: hike
+  seed: 42
+  nodes:
+    - {id: "!aabbccdd", long_name: Hiker, short_name: HIK, latitude: 46.78, longitude: -121.74}
+  events:
+    - {at: 5s, text: "Starting up the trail"}
+    - at: 10s
+      track:
+        every: 30s
+        points:
+          - {latitude: 46.79, longitude: -121.74, altitude: 1700}
+          - {latitude: 46.80, longitude: -121.75, altitude: 1800}
+    - {at: 1m, join: {id: "!11223344", long_name: Base Camp, short_name: BASE}}
+    - {at: 2m, from: "!11223344", text: "Copy, see you at the top"}
+    - {at: 3m, silent: true}
+
+Events without from are sent by the first node.
+
+To test how a client copes with a bad link, the simulator can drop,
+duplicate, corrupt, truncate, and delay the frames it sends (--loss,
+--duplicate, --corrupt, --truncate as percentages, --latency, --jitter), or a
+scenario can set them:
+
+  impairments: {loss: 5, corrupt: 2, truncate: 1, jitter: 200ms}
+
+Flags override the scenario's settings.
+
 Example:
   # Start simulator
   meshtastic-relay simulate --verbose
 
   # In another terminal, connect to the simulated device
   meshtastic-relay run --config config.yaml -c /dev/pts/X
+
+  # Listen on the node TCP API port instead
+  meshtastic-relay simulate --tcp 127.0.0.1:4403
+  meshtastic-relay run --connection.type tcp --connection.tcp.host 127.0.0.1
+
+  # Drop 10% of frames and corrupt 5%
+  meshtastic-relay simulate --loss 10 --corrupt 5
+
+  # Play a scenario
+  meshtastic-relay simulate --scenario scenarios/simulate/hike.yaml
 `,
 	RunE: runSimulate,
 }
@@ -55,9 +104,17 @@ func init() {
 	simulateCmd.Flags().DurationVar(&simInterval, "interval", 30*time.Second, "message send interval (0 to disable)")
 	simulateCmd.Flags().BoolVarP(&simVerbose, "verbose", "v", false, "verbose output")
 	simulateCmd.Flags().StringVar(&simSymlink, "symlink", "", "create symlink to PTY at this path")
+	simulateCmd.Flags().StringVar(&simTCP, "tcp", "", "listen for a TCP client on this address (e.g. 127.0.0.1:4403) instead of creating a PTY")
+	simulateCmd.Flags().Float64Var(&simImpair.Loss, "loss", 0, "percentage of frames to drop")
+	simulateCmd.Flags().Float64Var(&simImpair.Duplicate, "duplicate", 0, "percentage of frames to send twice")
+	simulateCmd.Flags().Float64Var(&simImpair.Corrupt, "corrupt", 0, "percentage of frames with a random byte changed")
+	simulateCmd.Flags().Float64Var(&simImpair.Truncate, "truncate", 0, "percentage of frames to cut short")
+	simulateCmd.Flags().DurationVar(&simImpair.Latency, "latency", 0, "delay before every frame")
+	simulateCmd.Flags().DurationVar(&simImpair.Jitter, "jitter", 0, "random extra delay before every frame, up to this")
+	simulateCmd.Flags().StringVar(&simScenario, "scenario", "", "play the timeline in this YAML file instead of random messages")
 }
 
-func runSimulate(_ *cobra.Command, _ []string) error {
+func runSimulate(cmd *cobra.Command, _ []string) error {
 	config := simulator.DefaultConfig()
 	config.NodeNum = simNodeNum
 	config.LongName = simLongName
@@ -65,20 +122,42 @@ func runSimulate(_ *cobra.Command, _ []string) error {
 	config.MessageInterval = simInterval
 	config.Verbose = simVerbose
 
+	var scenario *simulator.Scenario
+	if simScenario != "" {
+		var err error
+		if scenario, err = simulator.LoadScenario(simScenario); err != nil {
+			return err
+		}
+		if len(scenario.Nodes) > 0 {
+			config.SimulatedNodes = scenario.SimulatedNodes()
+		}
+		config.Seed = scenario.Seed
+		config.MessageInterval = 0
+		config.Impairments = scenario.Impairments
+	}
+	applyImpairmentFlags(cmd, &config.Impairments)
+	if err := config.Impairments.Validate(); err != nil {
+		return err
+	}
+
 	device := simulator.New(&config)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// Start the simulator
-	path, err := device.Start(ctx)
+	start := device.Start
+	if simTCP != "" {
+		start = func(ctx context.Context) (string, error) { return device.StartTCP(ctx, simTCP) }
+	}
+	path, err := start(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to start simulator: %w", err)
 	}
 	defer func() { _ = device.Stop() }()
 
 	// Create symlink if requested
-	if simSymlink != "" {
+	if simSymlink != "" && simTCP == "" {
 		if err := os.Symlink(path, simSymlink); err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: failed to create symlink: %v\n", err)
 		} else {
@@ -88,18 +167,36 @@ func runSimulate(_ *cobra.Command, _ []string) error {
 	}
 
 	fmt.Printf("Simulated Meshtastic device started\n")
-	fmt.Printf("  Device path: %s\n", path)
+	if simTCP != "" {
+		fmt.Printf("  Listening on: %s\n", path)
+	} else {
+		fmt.Printf("  Device path: %s\n", path)
+	}
 	fmt.Printf("  Node number: !%08x\n", config.NodeNum)
 	fmt.Printf("  Long name:   %s\n", config.LongName)
 	fmt.Printf("  Short name:  %s\n", config.ShortName)
 	fmt.Printf("  Simulated nodes: %d\n", len(config.SimulatedNodes))
-	if config.MessageInterval > 0 {
+	switch {
+	case scenario != nil:
+		fmt.Printf("  Scenario: %s (%d events over %v)\n", scenario.Name, len(scenario.Events), scenario.Duration())
+	case config.MessageInterval > 0:
 		fmt.Printf("  Message interval: %v\n", config.MessageInterval)
-	} else {
+	default:
 		fmt.Printf("  Auto messages: disabled\n")
 	}
+	if config.Impairments.Enabled() {
+		fmt.Printf("  Impairments: %s\n", config.Impairments)
+	}
 	fmt.Println()
-	fmt.Println("Connect with: meshtastic-relay run --connection.serial.port", path)
+	if simTCP != "" {
+		host, port, _ := net.SplitHostPort(path)
+		if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+			host = "127.0.0.1"
+		}
+		fmt.Println("Connect with: meshtastic-relay run --connection.type tcp --connection.tcp.host", host, "--connection.tcp.port", port)
+	} else {
+		fmt.Println("Connect with: meshtastic-relay run --connection.type serial --connection.serial.port", path)
+	}
 	fmt.Println("Press Ctrl+C to stop")
 	fmt.Println()
 
@@ -110,6 +207,20 @@ func runSimulate(_ *cobra.Command, _ []string) error {
 	}
 	fmt.Println()
 
+	if scenario != nil {
+		fmt.Println("The scenario starts when the relay connects.")
+		fmt.Println()
+		go func() {
+			if err := device.Play(ctx, scenario); err != nil {
+				if ctx.Err() == nil {
+					fmt.Fprintf(os.Stderr, "Scenario stopped: %v\n", err)
+				}
+				return
+			}
+			fmt.Println("Scenario finished; press Ctrl+C to stop")
+		}()
+	}
+
 	// Wait for signal
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -118,3 +229,27 @@ func runSimulate(_ *cobra.Command, _ []string) error {
 	fmt.Println("\nShutting down...")
 	return nil
 }
+
+// applyImpairmentFlags sets the impairments given as flags, leaving the
+// others as the scenario set them
+func applyImpairmentFlags(cmd *cobra.Command, im *simulator.Impairments) {
+	flags := cmd.Flags()
+	if flags.Changed("loss") {
+		im.Loss = simImpair.Loss
+	}
+	if flags.Changed("duplicate") {
+		im.Duplicate = simImpair.Duplicate
+	}
+	if flags.Changed("corrupt") {
+		im.Corrupt = simImpair.Corrupt
+	}
+	if flags.Changed("truncate") {
+		im.Truncate = simImpair.Truncate
+	}
+	if flags.Changed("latency") {
+		im.Latency = simImpair.Latency
+	}
+	if flags.Changed("jitter") {
+		im.Jitter = simImpair.Jitter
+	}
+}
@@ -0,0 +1,233 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+	"github.com/iamruinous/meshtastic-message-relay/internal/support"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+var (
+	bundleLogs   int
+	bundleFrames int
+	bundleAPI    string
+)
+
+// bundleManifest describes a support bundle and what could not be
+// collected for it
+type bundleManifest struct {
+	Version    string    `json:"version"`
+	Commit     string    `json:"commit"`
+	GoVersion  string    `json:"go_version"`
+	Platform   string    `json:"platform"`
+	Created    time.Time `json:"created"`
+	ConfigFile string    `json:"config_file,omitempty"`
+	API        string    `json:"api,omitempty"`
+	Files      []string  `json:"files"`
+	Notes      []string  `json:"notes,omitempty"`
+}
+
+var supportBundleCmd = &cobra.Command{
+	Use:   "support-bundle [file]",
+	Short: "Collect diagnostics into a tarball for bug reports",
+	Long: `Collect what is needed to diagnose a problem into a gzipped tarball to
+attach to a bug report:
+
+  config.yaml   the configuration, with tokens, passwords, and keys
+                redacted and URLs cut down to their scheme and server
+  status.json   the running relay's stats, connection, and device metadata
+  logs.jsonl    the running relay's latest log entries
+  frames.txt    the latest raw frames from the device, as hexdumps
+  manifest.json versions, platform, and anything that could not be collected
+
+Status, logs, and frames come from the running relay through its HTTP API,
+so api.enabled must be set (or --api given). Frames hold the packets the
+device received, messages included; use --frames 0 to leave them out.
+
+Examples:
+  # Write meshtastic-relay-support-<time>.tar.gz in the current directory
+  meshtastic-relay support-bundle
+
+  # Fewer log entries, no frames, to a chosen file
+  meshtastic-relay support-bundle --logs 200 --frames 0 /tmp/bundle.tar.gz`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE:         runSupportBundle,
+}
+
+func init() {
+	rootCmd.AddCommand(supportBundleCmd)
+
+	supportBundleCmd.Flags().IntVar(&bundleLogs, "logs", 500, "log entries to include")
+	supportBundleCmd.Flags().IntVar(&bundleFrames, "frames", 100, "raw frames to include")
+	supportBundleCmd.Flags().StringVar(&bundleAPI, "api", "", "running relay's API URL (default from api.listen)")
+}
+
+func runSupportBundle(_ *cobra.Command, args []string) error {
+	created := time.Now()
+	name := "meshtastic-relay-support-" + created.Format("20060102-150405")
+	path := name + ".tar.gz"
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	b := support.New(name)
+	m := bundleManifest{
+		Version:    Version,
+		Commit:     Commit,
+		GoVersion:  GoVersion,
+		Platform:   runtime.GOOS + "/" + runtime.GOARCH,
+		Created:    created.UTC(),
+		ConfigFile: GetConfigFile(),
+	}
+	note := func(format string, a ...interface{}) {
+		m.Notes = append(m.Notes, fmt.Sprintf(format, a...))
+	}
+
+	// The settings as read, so options the relay does not know are kept
+	if m.ConfigFile == "" {
+		note("no config file found; config.yaml holds defaults and flags only")
+	}
+	data, err := yaml.Marshal(support.Redact(viper.AllSettings()))
+	if err != nil {
+		return fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	b.Add("config.yaml", data)
+
+	cfg, err := config.Load()
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		note("configuration is invalid: %v", err)
+	}
+
+	m.API = bundleAPI
+	if m.API == "" && cfg != nil && cfg.API.Enabled {
+		m.API = apiURL(cfg.API.Listen)
+	}
+	if m.API == "" {
+		note("api is disabled; status, logs, and frames were not collected")
+	} else {
+		token := ""
+		if cfg != nil {
+			token = cfg.API.Token
+		}
+		collectFromAPI(b, strings.TrimSuffix(m.API, "/"), token, note)
+	}
+
+	m.Files = append(b.Files(), "manifest.json")
+	if err := b.AddJSON("manifest.json", m); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	if err := b.Write(f); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	fmt.Printf("Wrote %s (%s)\n", path, strings.Join(m.Files, ", "))
+	for _, n := range m.Notes {
+		fmt.Fprintf(os.Stderr, "Note: %s\n", n)
+	}
+	fmt.Println("Review it before sharing: frames and logs can include message text and node names.")
+	return nil
+}
+
+// apiURL returns the URL to reach an API listening on listen from this host
+func apiURL(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "http://" + listen
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// collectFromAPI adds the running relay's status, logs, and frames
+func collectFromAPI(b *support.Bundle, base, token string, note func(string, ...interface{})) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	get := func(path string, v interface{}) error {
+		req, err := http.NewRequest(http.MethodGet, base+path, nil)
+		if err != nil {
+			return err
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("GET %s: %s", path, resp.Status)
+		}
+		return json.NewDecoder(resp.Body).Decode(v)
+	}
+
+	var status json.RawMessage
+	if err := get("/status", &status); err != nil {
+		note("status not collected: %v", err)
+		// The relay is not reachable; the rest would fail the same way
+		return
+	}
+	if err := b.AddJSON("status.json", status); err != nil {
+		note("status not collected: %v", err)
+	}
+
+	if bundleLogs > 0 {
+		var entries []json.RawMessage
+		if err := get(fmt.Sprintf("/logs?limit=%d", bundleLogs), &entries); err != nil {
+			note("logs not collected: %v", err)
+		} else {
+			var buf bytes.Buffer
+			for _, e := range entries {
+				buf.Write(e)
+				buf.WriteByte('\n')
+			}
+			b.Add("logs.jsonl", buf.Bytes())
+		}
+	}
+
+	if bundleFrames > 0 {
+		var frames []connection.RawFrame
+		if err := get(fmt.Sprintf("/frames?limit=%d", bundleFrames), &frames); err != nil {
+			note("frames not collected: %v", err)
+		} else {
+			var buf bytes.Buffer
+			for _, f := range frames {
+				fmt.Fprintf(&buf, "# frame %d, %d bytes, %s\n", f.Seq, len(f.Data), f.At.Format(time.RFC3339Nano))
+				_ = meshtastic.WriteHexdump(&buf, f.Data)
+				buf.WriteByte('\n')
+			}
+			if len(frames) == 0 {
+				note("the connection keeps no raw frames (mqtt) or none were received")
+			}
+			b.Add("frames.txt", buf.Bytes())
+		}
+	}
+}
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"fmt"
+	"io"
 	"runtime"
 
 	"github.com/spf13/cobra"
@@ -15,21 +16,42 @@ var (
 	GoVersion = runtime.Version()
 )
 
+var versionFormat outputFormat
+
+// versionInfo is the version command's structured output
+type versionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Built     string `json:"built"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Print version information",
 	Long:  `Print detailed version information about the meshtastic-relay binary.`,
-	Run: func(_ *cobra.Command, _ []string) {
-		fmt.Printf("meshtastic-relay %s\n", Version)
-		fmt.Printf("  Commit:     %s\n", Commit)
-		fmt.Printf("  Built:      %s\n", Date)
-		fmt.Printf("  Go version: %s\n", GoVersion)
-		fmt.Printf("  OS/Arch:    %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	RunE: func(_ *cobra.Command, _ []string) error {
+		info := versionInfo{
+			Version:   Version,
+			Commit:    Commit,
+			Built:     Date,
+			GoVersion: GoVersion,
+			Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		}
+		return render(versionFormat, info, func(w io.Writer) {
+			_, _ = fmt.Fprintf(w, "meshtastic-relay %s\n", info.Version)
+			_, _ = fmt.Fprintf(w, "  Commit:\t%s\n", info.Commit)
+			_, _ = fmt.Fprintf(w, "  Built:\t%s\n", info.Built)
+			_, _ = fmt.Fprintf(w, "  Go version:\t%s\n", info.GoVersion)
+			_, _ = fmt.Fprintf(w, "  OS/Arch:\t%s\n", info.Platform)
+		})
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(versionCmd)
+	addFormatFlag(versionCmd, &versionFormat)
 }
 
 // SetVersionInfo sets the version information from build flags
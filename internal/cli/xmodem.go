@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+	"github.com/iamruinous/meshtastic-message-relay/internal/xmodem"
+)
+
+var xmodemCmd = &cobra.Command{
+	Use:   "xmodem",
+	Short: "Transfer files to and from the device",
+	Long: `Transfer files to and from the connected Meshtastic device using the
+XModem protocol carried over the stream API.
+
+Only serial and TCP connections support file transfers.
+
+Examples:
+  # Download a file from the device
+  meshtastic-relay xmodem get /prefs/config.proto config.proto
+
+  # Upload a file to the device
+  meshtastic-relay xmodem put cannedConf.proto /prefs/cannedConf.proto`,
+}
+
+var xmodemGetCmd = &cobra.Command{
+	Use:   "get <remote> [local]",
+	Short: "Download a file from the device",
+	Long:  `Download a file from the device. Use "-" as the local path to write to stdout.`,
+	Args:  cobra.RangeArgs(1, 2),
+	RunE:  runXModemGet,
+}
+
+var xmodemPutCmd = &cobra.Command{
+	Use:   "put <local> <remote>",
+	Short: "Upload a file to the device",
+	Args:  cobra.ExactArgs(2),
+	RunE:  runXModemPut,
+}
+
+func init() {
+	rootCmd.AddCommand(xmodemCmd)
+	xmodemCmd.AddCommand(xmodemGetCmd)
+	xmodemCmd.AddCommand(xmodemPutCmd)
+}
+
+func runXModemGet(_ *cobra.Command, args []string) error {
+	remote := args[0]
+	local := path.Base(remote)
+	if len(args) > 1 {
+		local = args[1]
+	}
+
+	return withXModem(func(ctx context.Context, client *xmodem.Client) error {
+		data, err := client.Download(ctx, remote)
+		if err != nil {
+			return fmt.Errorf("download failed: %w", err)
+		}
+		fmt.Fprintln(os.Stderr)
+
+		if local == "-" {
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		if err := os.WriteFile(local, data, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", local, err)
+		}
+		fmt.Fprintf(os.Stderr, "Downloaded %s -> %s (%d bytes)\n", remote, local, len(data))
+		return nil
+	})
+}
+
+func runXModemPut(_ *cobra.Command, args []string) error {
+	local, remote := args[0], args[1]
+
+	data, err := os.ReadFile(local)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", local, err)
+	}
+
+	return withXModem(func(ctx context.Context, client *xmodem.Client) error {
+		if err := client.Upload(ctx, remote, data); err != nil {
+			return fmt.Errorf("upload failed: %w", err)
+		}
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintf(os.Stderr, "Uploaded %s -> %s (%d bytes)\n", local, remote, len(data))
+		return nil
+	})
+}
+
+// withXModem connects to the device and runs fn with an XModem client
+func withXModem(fn func(context.Context, *xmodem.Client) error) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	conn, err := connectDevice(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	transport, ok := conn.(connection.XModemTransport)
+	if !ok {
+		return fmt.Errorf("connection %s does not support file transfers", conn.Name())
+	}
+
+	client := xmodem.New(transport)
+	client.Progress = func(n int) {
+		fmt.Fprintf(os.Stderr, "\r%d bytes", n)
+	}
+
+	return fn(ctx, client)
+}
@@ -0,0 +1,219 @@
+// Package cluster shares node database updates and dedup state between
+// relays over a private MQTT topic, so a fleet of gateways agrees on node
+// names and only one of them notifies about a packet several heard.
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/dedup"
+	"github.com/iamruinous/meshtastic-message-relay/internal/logging"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/nodedb"
+	"github.com/iamruinous/meshtastic-message-relay/internal/proxy"
+)
+
+// Update is what a relay publishes for each packet it handles
+type Update struct {
+	// Relay is the name of the publishing relay
+	Relay string `json:"relay"`
+
+	// From and ID identify the packet for dedup
+	From uint32 `json:"from"`
+	ID   uint32 `json:"id,omitempty"`
+
+	// At is when the relay received the packet
+	At time.Time `json:"at"`
+
+	// Node carries the sender's user info or position when the packet
+	// changed them
+	Node *nodedb.Node `json:"node,omitempty"`
+}
+
+// Cluster publishes this relay's updates and applies other relays'. It is
+// safe for concurrent use.
+type Cluster struct {
+	cfg    config.ClusterConfig
+	name   string
+	nodes  *nodedb.DB
+	dedup  *dedup.Filter
+	logger *zap.Logger
+
+	mu     sync.Mutex
+	client mqtt.Client
+}
+
+// New creates a cluster member that merges remote updates into nodes and,
+// if it is not nil, filter
+func New(cfg config.ClusterConfig, nodes *nodedb.DB, filter *dedup.Filter) (*Cluster, error) {
+	name := cfg.Name
+	if name == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("cluster.name is not set and the hostname is unknown: %w", err)
+		}
+		name = host
+	}
+	return &Cluster{
+		cfg:    cfg,
+		name:   name,
+		nodes:  nodes,
+		dedup:  filter,
+		logger: logging.With(zap.String("component", "cluster"), zap.String("relay", name)),
+	}, nil
+}
+
+// Name returns this relay's name in the cluster
+func (c *Cluster) Name() string {
+	return c.name
+}
+
+// Start connects to the broker and subscribes to the cluster topic. The
+// client reconnects and resubscribes on its own after that.
+func (c *Cluster) Start() error {
+	clientID := c.cfg.ClientID
+	if clientID == "" {
+		clientID = fmt.Sprintf("meshtastic-relay-cluster-%s-%d", c.name, time.Now().UnixNano())
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(c.cfg.Broker).
+		SetClientID(clientID).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(5 * time.Second).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			c.logger.Warn("Cluster connection lost", zap.Error(err))
+		}).
+		SetOnConnectHandler(c.onConnect)
+	if c.cfg.Username != "" {
+		opts.SetUsername(c.cfg.Username)
+	}
+	if c.cfg.Password != "" {
+		opts.SetPassword(c.cfg.Password)
+	}
+	if c.cfg.TLS.IsSet() {
+		tlsCfg, err := c.cfg.TLS.Load()
+		if err != nil {
+			return fmt.Errorf("invalid cluster tls config: %w", err)
+		}
+		opts.SetTLSConfig(tlsCfg)
+	}
+	if c.cfg.Proxy != "" {
+		u, err := config.ParseProxy(c.cfg.Proxy)
+		if err != nil {
+			return fmt.Errorf("invalid cluster proxy: %w", err)
+		}
+		opts.SetCustomOpenConnectionFn(proxy.MQTT(u))
+	}
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(10 * time.Second) {
+		client.Disconnect(0)
+		return fmt.Errorf("cluster broker connection timeout")
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to connect to cluster broker: %w", err)
+	}
+
+	c.mu.Lock()
+	c.client = client
+	c.mu.Unlock()
+	return nil
+}
+
+// onConnect subscribes to the cluster topic
+func (c *Cluster) onConnect(client mqtt.Client) {
+	token := client.Subscribe(c.cfg.Topic, 1, func(_ mqtt.Client, msg mqtt.Message) {
+		c.apply(msg.Payload())
+	})
+	if token.Wait() && token.Error() != nil {
+		c.logger.Error("Failed to subscribe to cluster topic", zap.Error(token.Error()))
+		return
+	}
+	c.logger.Info("Joined relay cluster", zap.String("topic", c.cfg.Topic))
+}
+
+// Share publishes a packet this relay handled. Packets without an ID or
+// node changes are not shared.
+func (c *Cluster) Share(p *message.Packet) {
+	u := c.update(p)
+	if u == nil {
+		return
+	}
+
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+	if client == nil || !client.IsConnectionOpen() {
+		return
+	}
+
+	data, err := json.Marshal(u)
+	if err != nil {
+		c.logger.Warn("Failed to encode cluster update", zap.Error(err))
+		return
+	}
+	// Publish without waiting; a lost update only risks a duplicate
+	client.Publish(c.cfg.Topic, 1, false, data)
+}
+
+// update returns the update to publish for p, or nil
+func (c *Cluster) update(p *message.Packet) *Update {
+	if p.From == 0 {
+		return nil
+	}
+	u := &Update{Relay: c.name, From: p.From, ID: p.ID, At: p.ReceivedAt}
+	if u.At.IsZero() {
+		u.At = time.Now()
+	}
+
+	switch p.Payload.(type) {
+	case *message.User, *message.Position:
+		if n := c.nodes.Node(p.From); n != nil {
+			u.Node = &nodedb.Node{Num: n.Num, User: n.User, Position: n.Position, LastHeard: n.LastHeard}
+		}
+	}
+	if u.ID == 0 && u.Node == nil {
+		return nil
+	}
+	return u
+}
+
+// apply merges an update published by another relay
+func (c *Cluster) apply(data []byte) {
+	var u Update
+	if err := json.Unmarshal(data, &u); err != nil {
+		c.logger.Debug("Ignoring invalid cluster update", zap.Error(err))
+		return
+	}
+	if u.Relay == c.name {
+		return
+	}
+	if c.dedup != nil {
+		c.dedup.Mark(u.From, u.ID, u.At)
+	}
+	if u.Node != nil && u.Node.Num == u.From {
+		c.nodes.Merge(u.Node)
+	}
+}
+
+// Close leaves the cluster
+func (c *Cluster) Close() {
+	c.mu.Lock()
+	client := c.client
+	c.client = nil
+	c.mu.Unlock()
+	if client != nil {
+		client.Disconnect(250)
+	}
+}
@@ -0,0 +1,73 @@
+package cluster
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/dedup"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/nodedb"
+)
+
+func newMember(t *testing.T, name string) (*Cluster, *nodedb.DB, *dedup.Filter) {
+	t.Helper()
+	nodes, err := nodedb.Open(config.NodeDBConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := dedup.New(config.DedupConfig{Window: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(config.ClusterConfig{Name: name, Topic: "test"}, nodes, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, nodes, filter
+}
+
+// exchange passes what a publishes for p to b
+func exchange(t *testing.T, a, b *Cluster, p *message.Packet) {
+	t.Helper()
+	u := a.update(p)
+	if u == nil {
+		t.Fatalf("no update for %+v", p)
+	}
+	data, err := json.Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.apply(data)
+}
+
+func TestClusterSharesDedupAndNames(t *testing.T) {
+	a, aNodes, _ := newMember(t, "north")
+	b, bNodes, bFilter := newMember(t, "south")
+
+	user := &message.Packet{From: 7, ID: 100, ReceivedAt: time.Now(),
+		Payload: &message.User{LongName: "Ridge Repeater", ShortName: "RR"}}
+	aNodes.Observe(user)
+	exchange(t, a, b, user)
+
+	if n := bNodes.Node(7); n == nil || n.User == nil || n.User.LongName != "Ridge Repeater" {
+		t.Errorf("node name not shared: %+v", n)
+	}
+	if !bFilter.Duplicate(&message.Packet{From: 7, ID: 100}) {
+		t.Error("packet handled by another relay not marked as a duplicate")
+	}
+
+	// Text packets share only their dedup key
+	text := &message.Packet{From: 7, ID: 101, Payload: &message.TextMessage{Text: "hi"}}
+	if u := a.update(text); u == nil || u.Node != nil {
+		t.Errorf("text update = %+v", u)
+	}
+
+	// A relay ignores its own updates
+	data, _ := json.Marshal(b.update(&message.Packet{From: 9, ID: 5}))
+	b.apply(data)
+	if bFilter.Duplicate(&message.Packet{From: 9, ID: 5}) {
+		t.Error("own update applied")
+	}
+}
@@ -1,74 +1,464 @@
 // Package config provides configuration types and loading for the relay service.
 package config
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/state"
+)
 
 // Config represents the complete application configuration.
 type Config struct {
+	// Version is the layout of the config file; files without one are
+	// version 1. See CurrentVersion.
+	Version int `mapstructure:"version"`
+
 	Connection ConnectionConfig `mapstructure:"connection"`
 	Outputs    []OutputConfig   `mapstructure:"outputs"`
 	Filters    FilterConfig     `mapstructure:"filters"`
+	Schedules  []ScheduleConfig `mapstructure:"schedules"`
+	Routes     []RouteConfig    `mapstructure:"routes"`
+	Mailbox    MailboxConfig    `mapstructure:"mailbox"`
+	Replay     ReplayConfig     `mapstructure:"replay"`
+	Relay      RelayConfig      `mapstructure:"relay"`
+	Positions  PositionsConfig  `mapstructure:"positions"`
+	NodeDB     NodeDBConfig     `mapstructure:"nodedb"`
+	Notes      NotesConfig      `mapstructure:"notes"`
+	Dedup      DedupConfig      `mapstructure:"dedup"`
+	DeadLetter DeadLetterConfig `mapstructure:"dead_letter"`
+	API        APIConfig        `mapstructure:"api"`
+	Web        WebConfig        `mapstructure:"web"`
+	Alerts     AlertsConfig     `mapstructure:"alerts"`
+	Cluster    ClusterConfig    `mapstructure:"cluster"`
+	Power      PowerConfig      `mapstructure:"power"`
+	Reactions  ReactionsConfig  `mapstructure:"reactions"`
+	Canary     CanaryConfig     `mapstructure:"canary"`
 	Logging    LoggingConfig    `mapstructure:"logging"`
+
+	// Proxy is the proxy for the MQTT connection, the cluster broker, and
+	// outputs that accept one, unless they set their own
+	Proxy string `mapstructure:"proxy"`
+
+	// StateDir holds the files kept across restarts; relative paths for
+	// them are taken from it. It defaults to $STATE_DIRECTORY under
+	// systemd, else $XDG_STATE_HOME/meshtastic-relay.
+	StateDir string `mapstructure:"state_dir"`
+}
+
+// CurrentVersion is the config layout this relay reads natively. Older
+// layouts are still loaded as they were meant, and the config migrate
+// command upgrades them.
+//
+//	1  relative state file paths are taken from the working directory;
+//	   connection.mqtt.topic names a single topic
+//	2  relative state file paths are taken from state_dir;
+//	   connection.mqtt.topics lists the topics
+const CurrentVersion = 2
+
+// StateFile is a file the relay keeps across restarts
+type StateFile struct {
+	Key  string // the setting naming the file, e.g. "nodedb.path"
+	Path string
+}
+
+// statePaths returns the settings that name files kept across restarts
+func (c *Config) statePaths() []struct {
+	key  string
+	path *string
+} {
+	return []struct {
+		key  string
+		path *string
+	}{
+		{"nodedb.path", &c.NodeDB.Path},
+		{"notes.path", &c.Notes.Path},
+		{"dedup.state_file", &c.Dedup.StateFile},
+		{"replay.state_file", &c.Replay.StateFile},
+		{"dead_letter.path", &c.DeadLetter.Path},
+		{"relay.sequence_file", &c.Relay.SequenceFile},
+		{"connection.capture", &c.Connection.Capture},
+	}
+}
+
+// StateFiles returns the files kept across restarts that are configured
+func (c *Config) StateFiles() []StateFile {
+	var files []StateFile
+	for _, p := range c.statePaths() {
+		if *p.path != "" {
+			files = append(files, StateFile{Key: p.key, Path: *p.path})
+		}
+	}
+	return files
+}
+
+// RelayConfig defines settings for the relay station itself.
+type RelayConfig struct {
+	// HomeLat and HomeLon are the base station position in degrees. When
+	// unset, the attached node's own reported position is used.
+	HomeLat float64 `mapstructure:"home_lat"`
+	HomeLon float64 `mapstructure:"home_lon"`
+
+	// SigningKey, when set, marks text messages the relay sends with an
+	// HMAC so recipients sharing the key can verify them.
+	SigningKey string `mapstructure:"signing_key"`
+
+	// SafeMode guarantees the relay never writes to the radio: sending,
+	// scheduled broadcasts, replay requests, and mailbox delivery are
+	// disabled. Only the wake sequence and the request for the device's
+	// configuration, which the attached device answers itself, are written.
+	SafeMode bool `mapstructure:"safe_mode"`
+
+	// Clock chooses the time packets are stamped with: "device" keeps the
+	// receive time the device or MQTT gateway reports, and "relay" uses
+	// the relay's own clock when the packet arrives.
+	Clock string `mapstructure:"clock"`
+
+	// SequenceFile keeps the sequence number given to every packet across
+	// restarts; empty starts again from 1
+	SequenceFile string `mapstructure:"sequence_file"`
+
+	// WatchConfig reloads the config file when it changes, as SIGHUP
+	// does. Outputs, filters, and routes are applied without dropping the
+	// connection; other settings take effect on restart.
+	WatchConfig bool `mapstructure:"watch_config"`
 }
 
+// Clock sources for RelayConfig.Clock
+const (
+	ClockDevice = "device"
+	ClockRelay  = "relay"
+)
+
+// HasHome reports whether a home position is configured
+func (c RelayConfig) HasHome() bool {
+	return c.HomeLat != 0 || c.HomeLon != 0
+}
+
+// PositionsConfig defines what is added to position packets before they
+// reach the outputs.
+type PositionsConfig struct {
+	// MapLinks adds a link to the position on a map: MapLinksOSM,
+	// MapLinksGoogle, or empty for none
+	MapLinks string `mapstructure:"map_links"`
+
+	// Geocoder names the place at each position
+	Geocoder GeocoderConfig `mapstructure:"geocoder"`
+}
+
+// Map services for PositionsConfig.MapLinks
+const (
+	MapLinksOSM    = "osm"
+	MapLinksGoogle = "google"
+)
+
+// GeocoderConfig defines the reverse geocoding service.
+type GeocoderConfig struct {
+	Type      string        `mapstructure:"type"`       // nominatim; empty disables geocoding
+	URL       string        `mapstructure:"url"`        // base URL of the service
+	UserAgent string        `mapstructure:"user_agent"` // identifies the relay, as the public Nominatim server requires
+	Language  string        `mapstructure:"language"`   // preferred language of place names, e.g. "en"
+	Timeout   time.Duration `mapstructure:"timeout"`    // longest a lookup may take
+	Interval  time.Duration `mapstructure:"interval"`   // least time between lookups
+	Proxy     string        `mapstructure:"proxy"`
+}
+
+// Geocoder types for GeocoderConfig.Type
+const (
+	GeocoderNominatim = "nominatim"
+)
+
 // ConnectionConfig defines how to connect to the Meshtastic node.
 type ConnectionConfig struct {
 	Type   string       `mapstructure:"type"` // serial, tcp, mqtt
 	Serial SerialConfig `mapstructure:"serial"`
 	TCP    TCPConfig    `mapstructure:"tcp"`
 	MQTT   MQTTConfig   `mapstructure:"mqtt"`
+	PKI    PKIConfig    `mapstructure:"pki"`
+
+	// Filters drop packets from this connection as they arrive, before
+	// dedup, the node database, alerts, or the API see them, e.g. to shed
+	// telemetry from a busy MQTT feed. The top-level filters still apply
+	// to what is relayed.
+	Filters FilterConfig `mapstructure:"filters"`
+
+	// Hexdump appends every raw FromRadio frame to this file as an
+	// annotated hexdump, for debugging the protocol (serial and tcp)
+	Hexdump string `mapstructure:"hexdump"`
+
+	// Capture appends every raw FromRadio frame to this file in the
+	// compressed, indexed capture format that the capture command reads
+	// (serial and tcp)
+	Capture string `mapstructure:"capture"`
+
+	// StallTimeout reconnects a serial or tcp connection that stays open
+	// but receives no frames for this long; 0 disables the watchdog
+	StallTimeout time.Duration `mapstructure:"stall_timeout"`
+
+	// ConfigTimeout is how long a serial or tcp connection keeps asking
+	// the device for its configuration and node DB until it is complete;
+	// 0 uses the default of two minutes
+	ConfigTimeout time.Duration `mapstructure:"config_timeout"`
+
+	// SafeMode refuses every write to the device except the configuration
+	// request; it is set from relay.safe_mode
+	SafeMode bool `mapstructure:"-"`
+}
+
+// PKIConfig defines the key used to decrypt public-key encrypted direct
+// messages.
+type PKIConfig struct {
+	PrivateKey string `mapstructure:"private_key"` // base64, as shown by the Meshtastic apps
+	FromDevice bool   `mapstructure:"from_device"` // read the key from the device (serial and TCP)
 }
 
 // SerialConfig defines serial port connection settings.
 type SerialConfig struct {
-	Port string `mapstructure:"port"`
-	Baud int    `mapstructure:"baud"`
+	Port          string `mapstructure:"port"`
+	Baud          int    `mapstructure:"baud"`
+	MaxPacketSize int    `mapstructure:"max_packet_size"` // 0 uses the protocol default
+
+	// DTR and RTS set the modem control lines on open: "on", "off", or
+	// empty for the driver default (both on). Boards whose auto-reset
+	// circuit is wired to these lines may reset or enter the bootloader
+	// unless they are held in a specific state.
+	DTR string `mapstructure:"dtr"`
+	RTS string `mapstructure:"rts"`
+
+	// SettleDelay waits after opening the port, then discards anything
+	// the board printed while booting, before talking to it.
+	SettleDelay time.Duration `mapstructure:"settle_delay"`
+}
+
+// SerialLineStates are the accepted values for SerialConfig.DTR and RTS
+var SerialLineStates = []string{"", "on", "off"}
+
+// ControlLines returns the configured DTR and RTS states, and whether
+// either was set at all
+func (c SerialConfig) ControlLines() (dtr, rts, set bool) {
+	return c.DTR != "off", c.RTS != "off", c.DTR != "" || c.RTS != ""
 }
 
 // TCPConfig defines TCP connection settings.
 type TCPConfig struct {
-	Host string `mapstructure:"host"`
-	Port int    `mapstructure:"port"`
+	Host          string `mapstructure:"host"`
+	Port          int    `mapstructure:"port"`
+	MaxPacketSize int    `mapstructure:"max_packet_size"` // 0 uses the protocol default
+
+	// FallbackDelay is how long each address of a host with several A
+	// and AAAA records is tried before the next one starts (Happy
+	// Eyeballs); 0 uses the RFC 8305 default of 250ms
+	FallbackDelay time.Duration `mapstructure:"fallback_delay"`
+
+	// Interface is the source interface name or address to connect from;
+	// empty lets the system choose
+	Interface string `mapstructure:"interface"`
+
+	// TLS wraps the stream API in TLS, for devices behind stunnel or
+	// another TLS terminator
+	TLS TCPTLSConfig `mapstructure:"tls"`
 }
 
 // MQTTConfig defines MQTT connection settings.
 type MQTTConfig struct {
-	Broker   string `mapstructure:"broker"`
-	Topic    string `mapstructure:"topic"`
-	Username string `mapstructure:"username"`
-	Password string `mapstructure:"password"`
-	ClientID string `mapstructure:"client_id"`
+	Broker   string    `mapstructure:"broker"`
+	Topic    string    `mapstructure:"topic"`
+	Username string    `mapstructure:"username"`
+	Password string    `mapstructure:"password"`
+	ClientID string    `mapstructure:"client_id"`
+	TLS      TLSConfig `mapstructure:"tls"`
+	Proxy    string    `mapstructure:"proxy"` // defaults to the global proxy
+
+	// Topics replaces Topic to subscribe to several filters, each with
+	// its own QoS
+	Topics []MQTTTopic `mapstructure:"topics"`
+}
+
+// DefaultMQTTQoS is the QoS used for topics that do not set one
+const DefaultMQTTQoS = 1
+
+// MQTTTopic is a topic filter to subscribe to.
+type MQTTTopic struct {
+	Topic string `mapstructure:"topic"`
+	QoS   byte   `mapstructure:"qos"`
+}
+
+// Subscriptions returns the topic filters to subscribe to and their QoS
+func (c *MQTTConfig) Subscriptions() map[string]byte {
+	if len(c.Topics) == 0 {
+		return map[string]byte{c.Topic: DefaultMQTTQoS}
+	}
+	subs := make(map[string]byte, len(c.Topics))
+	for _, t := range c.Topics {
+		subs[t.Topic] = t.QoS
+	}
+	return subs
 }
 
 // OutputConfig defines a single output destination.
 type OutputConfig struct {
-	Type    string                 `mapstructure:"type"` // stdout, file, apprise, webhook
+	Type    string                 `mapstructure:"type"` // stdout, file, apprise, webhook, mqtt
 	Enabled bool                   `mapstructure:"enabled"`
 	Options map[string]interface{} `mapstructure:",remain"`
 }
 
+// Fallbacks returns the outputs to try in order when this one fails, from
+// its fallback option: a single output or a list of them. Entries that
+// are not maps are skipped; Validate reports them.
+func (c OutputConfig) Fallbacks() []OutputConfig {
+	var entries []interface{}
+	switch v := c.Options["fallback"].(type) {
+	case map[string]interface{}:
+		entries = []interface{}{v}
+	case []interface{}:
+		entries = v
+	}
+
+	fallbacks := make([]OutputConfig, 0, len(entries))
+	for _, e := range entries {
+		opts, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		typ, _ := opts["type"].(string)
+		fallbacks = append(fallbacks, OutputConfig{Type: typ, Enabled: true, Options: opts})
+	}
+	return fallbacks
+}
+
+// Groups returns the output groups from its groups option: a name or a
+// list of them
+func (c OutputConfig) Groups() ([]string, error) {
+	return stringList(c.Options["groups"])
+}
+
+// TextPatterns returns the output's text_patterns option
+func (c OutputConfig) TextPatterns() (TextPatternsConfig, error) {
+	var tp TextPatternsConfig
+	switch v := c.Options["text_patterns"].(type) {
+	case nil:
+		return tp, nil
+	case map[string]interface{}:
+		var err error
+		if tp.Include, err = stringList(v["include"]); err != nil {
+			return tp, fmt.Errorf("include: %w", err)
+		}
+		if tp.Exclude, err = stringList(v["exclude"]); err != nil {
+			return tp, fmt.Errorf("exclude: %w", err)
+		}
+		return tp, nil
+	}
+	return tp, fmt.Errorf("must have include and/or exclude lists")
+}
+
+// stringList converts an option holding a string or a list of strings
+func stringList(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("must be a list of strings")
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("must be a list of strings")
+}
+
+// The output settings below are the options each output type reads from
+// OutputConfig.Options. Validate decodes the options into them, so unknown
+// keys and values of the wrong type are reported at startup.
+
+// OutputCommonConfig defines the options every output takes.
+type OutputCommonConfig struct {
+	Type         string             `mapstructure:"type"`
+	Enabled      bool               `mapstructure:"enabled"`
+	Groups       []string           `mapstructure:"groups"`
+	Fallback     interface{}        `mapstructure:"fallback"` // an output or a list of them
+	Filter       string             `mapstructure:"filter"`
+	TextPatterns TextPatternsConfig `mapstructure:"text_patterns"`
+	Critical     bool               `mapstructure:"critical"`
+	Canary       *bool              `mapstructure:"canary"` // nil sends canaries
+	Proxy        string             `mapstructure:"proxy"`
+
+	Retries       int           `mapstructure:"retries"`
+	RetryDelay    time.Duration `mapstructure:"retry_delay"`
+	RetryBackoff  float64       `mapstructure:"retry_backoff"`
+	RetryMaxDelay time.Duration `mapstructure:"retry_max_delay"`
+	QueueSize     int           `mapstructure:"queue_size"`
+	QueueFull     string        `mapstructure:"queue_full"` // drop, block
+
+	// Transforms; each is true, false, or a map of its settings
+	PublicFeed    PublicFeedConfig    `mapstructure:"public_feed"`
+	Pseudonymize  PseudonymizeConfig  `mapstructure:"pseudonymize"`
+	NormalizeText NormalizeTextConfig `mapstructure:"normalize_text"`
+}
+
+// PublicFeedConfig defines the public_feed transform.
+type PublicFeedConfig struct {
+	Enabled          bool   `mapstructure:"enabled"`
+	PositionDecimals int    `mapstructure:"position_decimals"`
+	Salt             string `mapstructure:"salt"`
+}
+
+// PseudonymizeConfig defines the pseudonymize transform.
+type PseudonymizeConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Salt    string `mapstructure:"salt"`
+}
+
+// NormalizeTextConfig defines the normalize_text transform.
+type NormalizeTextConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`
+	Replacement   string `mapstructure:"replacement"`
+	Transliterate bool   `mapstructure:"transliterate"`
+}
+
+// HTTPOutputConfig defines the connection pool options of outputs that
+// post over HTTP.
+type HTTPOutputConfig struct {
+	MaxInFlight         int           `mapstructure:"max_in_flight"`
+	MaxIdleConns        int           `mapstructure:"max_idle_conns"`
+	MaxIdleConnsPerHost int           `mapstructure:"max_idle_conns_per_host"`
+	MaxConnsPerHost     int           `mapstructure:"max_conns_per_host"`
+	IdleConnTimeout     time.Duration `mapstructure:"idle_conn_timeout"`
+	KeepAlive           bool          `mapstructure:"keep_alive"`
+}
+
 // StdoutOutputConfig defines stdout output settings.
 type StdoutOutputConfig struct {
-	Format string `mapstructure:"format"` // json, text
+	Format   string `mapstructure:"format"` // json, text
+	Template string `mapstructure:"template"`
 }
 
 // FileOutputConfig defines file output settings.
 type FileOutputConfig struct {
-	Path       string `mapstructure:"path"`
-	Format     string `mapstructure:"format"` // json, text
-	Rotate     bool   `mapstructure:"rotate"`
-	MaxSizeMB  int    `mapstructure:"max_size_mb"`
-	MaxBackups int    `mapstructure:"max_backups"`
-	MaxAgeDays int    `mapstructure:"max_age_days"`
+	Path        string `mapstructure:"path"`
+	Format      string `mapstructure:"format"` // json, text
+	Template    string `mapstructure:"template"`
+	Rotate      bool   `mapstructure:"rotate"`
+	MaxSizeMB   int    `mapstructure:"max_size_mb"`
+	MaxBackups  int    `mapstructure:"max_backups"`
+	MaxAgeDays  int    `mapstructure:"max_age_days"`
+	Compression string `mapstructure:"compression"` // none, gzip, zstd
 }
 
 // AppriseOutputConfig defines Apprise output settings.
 type AppriseOutputConfig struct {
-	URL      string                          `mapstructure:"url"`
-	Tag      string                          `mapstructure:"tag"`
-	Timeout  time.Duration                   `mapstructure:"timeout"`
-	Headers  map[string]string               `mapstructure:"headers"`
-	Channels map[uint32]AppriseChannelConfig `mapstructure:"channels"`
+	URL           string                          `mapstructure:"url"`
+	Tag           string                          `mapstructure:"tag"`
+	Timeout       time.Duration                   `mapstructure:"timeout"`
+	Headers       map[string]string               `mapstructure:"headers"`
+	Channels      map[uint32]AppriseChannelConfig `mapstructure:"channels"`
+	TitleTemplate string                          `mapstructure:"title_template"`
+	BodyTemplate  string                          `mapstructure:"body_template"`
 }
 
 // AppriseChannelConfig defines per-channel Apprise settings.
@@ -79,10 +469,150 @@ type AppriseChannelConfig struct {
 
 // WebhookOutputConfig defines webhook output settings.
 type WebhookOutputConfig struct {
-	URL     string            `mapstructure:"url"`
-	Method  string            `mapstructure:"method"`
-	Headers map[string]string `mapstructure:"headers"`
-	Timeout time.Duration     `mapstructure:"timeout"`
+	URL          string            `mapstructure:"url"`
+	Method       string            `mapstructure:"method"`
+	Headers      map[string]string `mapstructure:"headers"`
+	Timeout      time.Duration     `mapstructure:"timeout"`
+	BodyTemplate string            `mapstructure:"body_template"`
+}
+
+// MQTTBrokerConfig defines the broker connection of the mqtt and
+// homeassistant outputs.
+type MQTTBrokerConfig struct {
+	Broker   string        `mapstructure:"broker"`
+	Username string        `mapstructure:"username"`
+	Password string        `mapstructure:"password"`
+	ClientID string        `mapstructure:"client_id"`
+	QoS      int           `mapstructure:"qos"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	TLS      TLSConfig     `mapstructure:"tls"`
+}
+
+// MQTTOutputConfig defines MQTT output settings.
+type MQTTOutputConfig struct {
+	MQTTBrokerConfig `mapstructure:",squash"`
+	Topic            string `mapstructure:"topic"`
+	EventTopic       string `mapstructure:"event_topic"`
+	Format           string `mapstructure:"format"` // json, protobuf
+	NodeState        bool   `mapstructure:"node_state"`
+}
+
+// HomeAssistantOutputConfig defines Home Assistant output settings.
+type HomeAssistantOutputConfig struct {
+	MQTTBrokerConfig `mapstructure:",squash"`
+	Topic            string `mapstructure:"topic"`
+	DiscoveryPrefix  string `mapstructure:"discovery_prefix"`
+}
+
+// SSEOutputConfig defines server-sent events output settings.
+type SSEOutputConfig struct {
+	Listen      string `mapstructure:"listen"`
+	Path        string `mapstructure:"path"`
+	Buffer      int    `mapstructure:"buffer"`
+	AllowOrigin string `mapstructure:"allow_origin"`
+}
+
+// TelegramOutputConfig defines Telegram output settings.
+type TelegramOutputConfig struct {
+	BotToken            string        `mapstructure:"bot_token"`
+	ChatID              interface{}   `mapstructure:"chat_id"` // a number or an @channel name
+	APIURL              string        `mapstructure:"api_url"`
+	ParseMode           string        `mapstructure:"parse_mode"`
+	DisableNotification bool          `mapstructure:"disable_notification"`
+	AllPorts            bool          `mapstructure:"all_ports"`
+	Replies             bool          `mapstructure:"replies"`
+	RateLimit           int           `mapstructure:"rate_limit"`
+	Template            string        `mapstructure:"template"`
+	Timeout             time.Duration `mapstructure:"timeout"`
+}
+
+// SlackOutputConfig defines Slack output settings.
+type SlackOutputConfig struct {
+	WebhookURL   string        `mapstructure:"webhook_url"`
+	BotToken     string        `mapstructure:"bot_token"`
+	Channel      string        `mapstructure:"channel"`
+	APIURL       string        `mapstructure:"api_url"`
+	Threads      bool          `mapstructure:"threads"`
+	ThreadWindow time.Duration `mapstructure:"thread_window"`
+	AllPorts     bool          `mapstructure:"all_ports"`
+	Template     string        `mapstructure:"template"`
+	Timeout      time.Duration `mapstructure:"timeout"`
+}
+
+// InfluxDBOutputConfig defines InfluxDB output settings.
+type InfluxDBOutputConfig struct {
+	URL               string        `mapstructure:"url"`
+	Org               string        `mapstructure:"org"`
+	Bucket            string        `mapstructure:"bucket"`
+	Database          string        `mapstructure:"database"`
+	Token             string        `mapstructure:"token"`
+	Username          string        `mapstructure:"username"`
+	Password          string        `mapstructure:"password"`
+	MeasurementPrefix string        `mapstructure:"measurement_prefix"`
+	Timeout           time.Duration `mapstructure:"timeout"`
+}
+
+// TAKOutputConfig defines TAK output settings.
+type TAKOutputConfig struct {
+	Address   string        `mapstructure:"address"`
+	Protocol  string        `mapstructure:"protocol"`
+	Format    string        `mapstructure:"format"`
+	Positions bool          `mapstructure:"positions"`
+	Stale     time.Duration `mapstructure:"stale"`
+	Timeout   time.Duration `mapstructure:"timeout"`
+}
+
+// StreamOutputConfig defines how the kafka and nats outputs encode
+// records.
+type StreamOutputConfig struct {
+	Format string `mapstructure:"format"` // json, protobuf
+	Key    string `mapstructure:"key"`    // node, channel, none
+}
+
+// KafkaOutputConfig defines Kafka output settings.
+type KafkaOutputConfig struct {
+	StreamOutputConfig `mapstructure:",squash"`
+	Brokers            []string      `mapstructure:"brokers"`
+	Topic              string        `mapstructure:"topic"`
+	Acks               string        `mapstructure:"acks"`
+	Timeout            time.Duration `mapstructure:"timeout"`
+	Username           string        `mapstructure:"username"`
+	Password           string        `mapstructure:"password"`
+	TLS                TLSConfig     `mapstructure:"tls"`
+}
+
+// NATSOutputConfig defines NATS output settings.
+type NATSOutputConfig struct {
+	StreamOutputConfig `mapstructure:",squash"`
+	URL                string        `mapstructure:"url"`
+	Subject            string        `mapstructure:"subject"`
+	Username           string        `mapstructure:"username"`
+	Password           string        `mapstructure:"password"`
+	Token              string        `mapstructure:"token"`
+	Credentials        string        `mapstructure:"credentials"`
+	Timeout            time.Duration `mapstructure:"timeout"`
+	TLS                TLSConfig     `mapstructure:"tls"`
+}
+
+// SMSOutputConfig defines SMS output settings.
+type SMSOutputConfig struct {
+	Provider           string              `mapstructure:"provider"`
+	From               string              `mapstructure:"from"`
+	AccountSID         string              `mapstructure:"account_sid"`
+	AuthToken          string              `mapstructure:"auth_token"`
+	APIURL             string              `mapstructure:"api_url"`
+	URL                string              `mapstructure:"url"`
+	Method             string              `mapstructure:"method"`
+	Headers            map[string]string   `mapstructure:"headers"`
+	BodyTemplate       string              `mapstructure:"body_template"`
+	To                 []string            `mapstructure:"to"`
+	Recipients         map[string][]string `mapstructure:"recipients"` // node ID to phone numbers
+	AllPorts           bool                `mapstructure:"all_ports"`
+	MaxLength          int                 `mapstructure:"max_length"`
+	RateLimit          int                 `mapstructure:"rate_limit"`
+	RecipientRateLimit int                 `mapstructure:"recipient_rate_limit"`
+	Template           string              `mapstructure:"template"`
+	Timeout            time.Duration       `mapstructure:"timeout"`
 }
 
 // FilterConfig defines message filtering rules.
@@ -90,17 +620,195 @@ type FilterConfig struct {
 	MessageTypes []string `mapstructure:"message_types"`
 	NodeIDs      []uint32 `mapstructure:"node_ids"`
 	Channels     []uint32 `mapstructure:"channels"`
+
+	// Expression is a filter expression packets must also satisfy, e.g.
+	// portnum == "TEXT_MESSAGE_APP" && rssi > -110; see package filter
+	Expression string `mapstructure:"expression"`
+
+	TextPatterns TextPatternsConfig `mapstructure:"text_patterns"`
+}
+
+// TextPatternsConfig selects text messages by regular expressions on
+// their body. With include patterns, packets without text are not
+// relayed either.
+type TextPatternsConfig struct {
+	Include []string `mapstructure:"include"` // relay only text matching one of these
+	Exclude []string `mapstructure:"exclude"` // never relay text matching any of these
+}
+
+// RouteConfig sends the packets matching it to the outputs in its groups.
+// Routes are tried in order and the first that matches decides, unless it
+// sets Continue. Empty criteria match every packet.
+type RouteConfig struct {
+	Name         string   `mapstructure:"name"`
+	Connections  []string `mapstructure:"connections"`   // connection type or name, e.g. serial or tcp:radio.lan:4403
+	Channels     []uint32 `mapstructure:"channels"`      // channel indexes
+	MessageTypes []string `mapstructure:"message_types"` // port names, e.g. TEXT_MESSAGE_APP
+	Nodes        []string `mapstructure:"nodes"`         // sender node ids, e.g. !1234abcd
+	Groups       []string `mapstructure:"groups"`        // output groups the packets go to
+	Continue     bool     `mapstructure:"continue"`      // keep trying the routes after this one
+}
+
+// ScheduleConfig defines a message broadcast to the mesh on a schedule.
+// Exactly one of At or Every must be set.
+type ScheduleConfig struct {
+	Name     string        `mapstructure:"name"`
+	Enabled  bool          `mapstructure:"enabled"`
+	At       string        `mapstructure:"at"`       // daily time of day, HH:MM
+	Days     []string      `mapstructure:"days"`     // mon..sun, empty means every day
+	Every    time.Duration `mapstructure:"every"`    // fixed interval
+	Timezone string        `mapstructure:"timezone"` // IANA name, empty means local
+	Channel  uint32        `mapstructure:"channel"`
+	To       uint32        `mapstructure:"to"` // 0 broadcasts
+	Message  string        `mapstructure:"message"`
+}
+
+// MailboxConfig defines holding direct messages for offline nodes.
+type MailboxConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	OfflineAfter time.Duration `mapstructure:"offline_after"` // silence before a node counts as offline
+	MaxMessages  int           `mapstructure:"max_messages"`  // per recipient, oldest dropped first
+	MaxAge       time.Duration `mapstructure:"max_age"`       // held messages expire after this
+	Deliver      bool          `mapstructure:"deliver"`       // also DM the digest to the node
+}
+
+// ReplayConfig defines catching up on missed messages at startup through
+// a Store & Forward server.
+type ReplayConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Server    string        `mapstructure:"server"`     // node id; empty waits for a server heartbeat
+	Window    time.Duration `mapstructure:"window"`     // longest history to request
+	StateFile string        `mapstructure:"state_file"` // remembers the last relayed message across restarts
+}
+
+// NodeDBConfig defines the node database shared by all connections.
+type NodeDBConfig struct {
+	Path         string        `mapstructure:"path"`          // JSON snapshot; empty keeps nodes in memory only
+	History      int           `mapstructure:"history"`       // telemetry samples kept per node
+	SaveInterval time.Duration `mapstructure:"save_interval"` // how often changes are written
+
+	// Aliases names nodes in outputs by node ID ("!1234abcd" or the
+	// decimal number), replacing the long name the node announces
+	Aliases map[string]string `mapstructure:"aliases"`
+}
+
+// NotesConfig defines where operator notes on packets and nodes are kept.
+type NotesConfig struct {
+	Path string `mapstructure:"path"` // JSON file; empty keeps notes in memory only
+}
+
+// DedupConfig defines dropping packets that were already relayed, such
+// as the same packet heard through several MQTT gateways.
+type DedupConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Window    time.Duration `mapstructure:"window"`     // how long a packet ID is remembered
+	StateFile string        `mapstructure:"state_file"` // remembers recent packets across restarts
+}
+
+// DeadLetterConfig defines keeping messages that an output could not take,
+// after its retries and fallbacks, and delivering them again later.
+type DeadLetterConfig struct {
+	Path          string        `mapstructure:"path"`           // JSON Lines file; empty drops undelivered messages
+	RetryInterval time.Duration `mapstructure:"retry_interval"` // how often delivery is tried again
+	MaxAge        time.Duration `mapstructure:"max_age"`        // messages still undelivered after this are dropped
+	MaxMessages   int           `mapstructure:"max_messages"`   // oldest dropped first
+}
+
+// APIConfig defines the embedded HTTP API.
+type APIConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Listen  string `mapstructure:"listen"`  // host:port
+	Token   string `mapstructure:"token"`   // bearer token required on every request when set
+	History int    `mapstructure:"history"` // recent messages kept for GET /messages
+
+	// MaxSilence makes GET /readyz fail when no packet has arrived for
+	// this long; 0 only checks the connection
+	MaxSilence time.Duration `mapstructure:"max_silence"`
+}
+
+// WebConfig defines the embedded web dashboard: a map of node positions,
+// a live message feed, and basic stats.
+type WebConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Listen   string `mapstructure:"listen"`   // host:port
+	Password string `mapstructure:"password"` // HTTP basic auth password, with any user name, required when set
+}
+
+// AlertsConfig defines the conditions shown in the TUI alerts pane.
+type AlertsConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	OfflineAfter time.Duration `mapstructure:"offline_after"` // a node heard since startup is offline after this long
+	LowBattery   uint32        `mapstructure:"low_battery"`   // battery percent at or below which to alert
+	Repeat       time.Duration `mapstructure:"repeat"`        // how often a standing alert notifies again
+	AckPeriod    time.Duration `mapstructure:"ack_period"`    // how long acknowledging suppresses repeats
+	SnoozePeriod time.Duration `mapstructure:"snooze_period"` // how long snoozing hides an alert
+}
+
+// ClusterConfig defines sharing node database updates and dedup state
+// with other relays over a private MQTT topic.
+type ClusterConfig struct {
+	Enabled  bool      `mapstructure:"enabled"`
+	Name     string    `mapstructure:"name"` // this relay's name in the cluster; defaults to the hostname
+	Broker   string    `mapstructure:"broker"`
+	Topic    string    `mapstructure:"topic"`
+	Username string    `mapstructure:"username"`
+	Password string    `mapstructure:"password"`
+	ClientID string    `mapstructure:"client_id"`
+	TLS      TLSConfig `mapstructure:"tls"`
+	Proxy    string    `mapstructure:"proxy"` // defaults to the global proxy
+}
+
+// PowerConfig defines the low-power mode for relays sharing a solar or
+// battery budget with their node. Outputs with the critical option are
+// always sent to immediately.
+type PowerConfig struct {
+	Enabled          bool          `mapstructure:"enabled"`
+	SaveInterval     time.Duration `mapstructure:"save_interval"`     // node database and dedup saves
+	CheckInterval    time.Duration `mapstructure:"check_interval"`    // alert checks
+	FlushInterval    time.Duration `mapstructure:"flush_interval"`    // non-critical outputs are sent in batches this often
+	PollInterval     time.Duration `mapstructure:"poll_interval"`     // connection stall checks and dead letter retries
+	BatteryThreshold uint32        `mapstructure:"battery_threshold"` // device battery percent below which non-critical outputs pause; 0 never pauses
+}
+
+// ReactionsConfig defines summarizing emoji reactions instead of relaying
+// each one. Outputs that can edit their messages show the summary on the
+// original message; others get a periodic digest.
+type ReactionsConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	DigestInterval time.Duration `mapstructure:"digest_interval"` // how often outputs that cannot edit get a digest
+}
+
+// CanaryConfig defines end-to-end checks that pass synthetic text packets
+// through the relay as if the connection had received them and time their
+// delivery to each output.
+type CanaryConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Interval   time.Duration `mapstructure:"interval"`    // how often to inject a canary; 0 only on request
+	Text       string        `mapstructure:"text"`        // the canary's text, followed by its ID
+	Timeout    time.Duration `mapstructure:"timeout"`     // outputs that have not confirmed delivery by then fail
+	MaxLatency time.Duration `mapstructure:"max_latency"` // a slower canary is degraded; 0 checks only for failures
+	Failures   int           `mapstructure:"failures"`    // degraded canaries in a row before alerting
+	History    int           `mapstructure:"history"`     // completed canaries kept for the API
 }
 
 // LoggingConfig defines logging settings.
 type LoggingConfig struct {
 	Level  string `mapstructure:"level"`  // debug, info, warn, error
 	Format string `mapstructure:"format"` // json, text
+
+	// SampleThreshold is how many debug entries with the same message are
+	// logged each second before the rest are sampled, so debug logging
+	// keeps up with a busy feed; 0 logs every entry
+	SampleThreshold int `mapstructure:"sample_threshold"`
+	// SampleInterval is how often a line summarizing the entries sampling
+	// dropped is logged
+	SampleInterval time.Duration `mapstructure:"sample_interval"`
 }
 
 // DefaultConfig returns a configuration with sensible defaults.
 func DefaultConfig() *Config {
 	return &Config{
+		Version: CurrentVersion,
 		Connection: ConnectionConfig{
 			Type: "serial",
 			Serial: SerialConfig{
@@ -130,9 +838,78 @@ func DefaultConfig() *Config {
 			NodeIDs:      []uint32{},
 			Channels:     []uint32{},
 		},
+		Mailbox: MailboxConfig{
+			OfflineAfter: 2 * time.Hour,
+			MaxMessages:  20,
+			MaxAge:       7 * 24 * time.Hour,
+		},
+		Replay: ReplayConfig{
+			Window: 2 * time.Hour,
+		},
+		Relay: RelayConfig{
+			Clock:       ClockDevice,
+			WatchConfig: true,
+		},
+		NodeDB: NodeDBConfig{
+			History:      100,
+			SaveInterval: 5 * time.Minute,
+		},
+		Dedup: DedupConfig{
+			Window: 10 * time.Minute,
+		},
+		DeadLetter: DeadLetterConfig{
+			RetryInterval: 5 * time.Minute,
+			MaxAge:        24 * time.Hour,
+			MaxMessages:   10000,
+		},
+		API: APIConfig{
+			Listen:  "127.0.0.1:8080",
+			History: 100,
+		},
+		Web: WebConfig{
+			Listen: "127.0.0.1:8081",
+		},
+		Alerts: AlertsConfig{
+			OfflineAfter: 2 * time.Hour,
+			LowBattery:   20,
+			Repeat:       15 * time.Minute,
+			AckPeriod:    12 * time.Hour,
+			SnoozePeriod: time.Hour,
+		},
+		Cluster: ClusterConfig{
+			Topic: "meshtastic-relay/cluster",
+		},
+		Power: PowerConfig{
+			SaveInterval:  30 * time.Minute,
+			CheckInterval: 5 * time.Minute,
+			FlushInterval: time.Minute,
+			PollInterval:  5 * time.Minute,
+		},
+		Reactions: ReactionsConfig{
+			DigestInterval: 15 * time.Minute,
+		},
+		Canary: CanaryConfig{
+			Interval:   15 * time.Minute,
+			Text:       "Relay canary",
+			Timeout:    time.Minute,
+			MaxLatency: 10 * time.Second,
+			Failures:   2,
+			History:    100,
+		},
+		Positions: PositionsConfig{
+			Geocoder: GeocoderConfig{
+				URL:       "https://nominatim.openstreetmap.org",
+				UserAgent: "meshtastic-message-relay",
+				Timeout:   2 * time.Second,
+				Interval:  time.Second,
+			},
+		},
+		StateDir: state.DefaultDir(),
 		Logging: LoggingConfig{
-			Level:  "info",
-			Format: "json",
+			Level:           "info",
+			Format:          "json",
+			SampleThreshold: 100,
+			SampleInterval:  10 * time.Second,
 		},
 	}
 }
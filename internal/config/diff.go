@@ -0,0 +1,55 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Diff returns the dotted keys of the settings that differ between two
+// configurations, such as "outputs" or "connection.mqtt.broker", in the
+// order they appear in Config. Lists and maps are compared as a whole and
+// reported by their own key. Only keys are returned, never values, so the
+// result is safe to log.
+func Diff(a, b *Config) []string {
+	var keys []string
+	diffValue(reflect.ValueOf(*a), reflect.ValueOf(*b), "", &keys)
+	return keys
+}
+
+func diffValue(a, b reflect.Value, key string, keys *[]string) {
+	if a.Kind() != reflect.Struct {
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*keys = append(*keys, key)
+		}
+		return
+	}
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("mapstructure")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		sub := key
+		switch {
+		case name != "":
+			sub = joinKey(key, name)
+		case opts == "squash" || opts == "remain":
+			// Fields that mapstructure flattens into their parent
+		default:
+			sub = joinKey(key, strings.ToLower(f.Name))
+		}
+		diffValue(a.Field(i), b.Field(i), sub, keys)
+	}
+}
+
+func joinKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a := DefaultConfig()
+	b := DefaultConfig()
+	if keys := Diff(a, b); len(keys) != 0 {
+		t.Errorf("Diff of equal configs = %q", keys)
+	}
+
+	b.Connection.MQTT.Broker = "tcp://broker:1883"
+	b.Connection.TCP.TLS.CACert = "ca.pem"
+	b.Connection.SafeMode = true
+	b.Outputs = append(b.Outputs, OutputConfig{Type: "stdout", Enabled: true})
+	b.Filters.Channels = []uint32{1}
+	want := []string{"connection.tcp.tls.ca_cert", "connection.mqtt.broker", "outputs", "filters.channels"}
+	if keys := Diff(a, b); !reflect.DeepEqual(keys, want) {
+		t.Errorf("Diff = %q, want %q", keys, want)
+	}
+}
@@ -1,15 +1,67 @@
 package config
 
 import (
+	"bytes"
+	"encoding/base64"
 	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/spf13/viper"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/filter"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/state"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
 )
 
-// Load reads the configuration from viper and returns a Config struct
+// LoadYAML reads the configuration from YAML data in place of the config
+// file viper has read, resolving its secrets as Load does with relative
+// secret files taken from the working directory
+func LoadYAML(data []byte) (*Config, error) {
+	resolved, err := ResolveSecrets(data, ".")
+	if err != nil {
+		return nil, err
+	}
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(bytes.NewReader(resolved)); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration: %w", err)
+	}
+	return load(true)
+}
+
+// Load resolves the secrets of the config file viper has read, then reads
+// the configuration from viper and returns a Config struct
 func Load() (*Config, error) {
+	fromFile, err := resolveConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	return load(fromFile)
+}
+
+// load reads the configuration from viper as it stands. fromFile reports
+// whether viper read a config file; settings from flags and the
+// environment alone are in the current layout.
+func load(fromFile bool) (*Config, error) {
 	cfg := DefaultConfig()
 
+	// Files from before the version field are version 1
+	cfg.Version = viper.GetInt("version")
+	if cfg.Version == 0 {
+		cfg.Version = 1
+		if !fromFile {
+			cfg.Version = CurrentVersion
+		}
+	}
+	if cfg.Version > CurrentVersion {
+		return nil, fmt.Errorf("config version %d is newer than this relay supports (%d)", cfg.Version, CurrentVersion)
+	}
+
 	// Connection settings
 	cfg.Connection.Type = viper.GetString("connection.type")
 
@@ -19,6 +71,10 @@ func Load() (*Config, error) {
 	if cfg.Connection.Serial.Baud == 0 {
 		cfg.Connection.Serial.Baud = 115200
 	}
+	cfg.Connection.Serial.MaxPacketSize = viper.GetInt("connection.serial.max_packet_size")
+	cfg.Connection.Serial.DTR = strings.ToLower(viper.GetString("connection.serial.dtr"))
+	cfg.Connection.Serial.RTS = strings.ToLower(viper.GetString("connection.serial.rts"))
+	cfg.Connection.Serial.SettleDelay = viper.GetDuration("connection.serial.settle_delay")
 
 	// TCP settings
 	cfg.Connection.TCP.Host = viper.GetString("connection.tcp.host")
@@ -26,13 +82,53 @@ func Load() (*Config, error) {
 	if cfg.Connection.TCP.Port == 0 {
 		cfg.Connection.TCP.Port = 4403
 	}
+	cfg.Connection.TCP.MaxPacketSize = viper.GetInt("connection.tcp.max_packet_size")
+	cfg.Connection.TCP.FallbackDelay = viper.GetDuration("connection.tcp.fallback_delay")
+	cfg.Connection.TCP.Interface = viper.GetString("connection.tcp.interface")
+	cfg.Connection.TCP.TLS = TCPTLSConfig{
+		Enabled: viper.GetBool("connection.tcp.tls.enabled"),
+		TLSConfig: TLSConfig{
+			CACert:             viper.GetString("connection.tcp.tls.ca_cert"),
+			ClientCert:         viper.GetString("connection.tcp.tls.client_cert"),
+			ClientKey:          viper.GetString("connection.tcp.tls.client_key"),
+			InsecureSkipVerify: viper.GetBool("connection.tcp.tls.insecure_skip_verify"),
+			ServerName:         viper.GetString("connection.tcp.tls.server_name"),
+		},
+	}
 
 	// MQTT settings
 	cfg.Connection.MQTT.Broker = viper.GetString("connection.mqtt.broker")
-	cfg.Connection.MQTT.Topic = viper.GetString("connection.mqtt.topic")
+	if t := viper.GetString("connection.mqtt.topic"); t != "" {
+		cfg.Connection.MQTT.Topic = t
+	}
+	topics, err := loadMQTTTopics(viper.Get("connection.mqtt.topics"))
+	if err != nil {
+		return nil, err
+	}
+	cfg.Connection.MQTT.Topics = topics
 	cfg.Connection.MQTT.Username = viper.GetString("connection.mqtt.username")
 	cfg.Connection.MQTT.Password = viper.GetString("connection.mqtt.password")
 	cfg.Connection.MQTT.ClientID = viper.GetString("connection.mqtt.client_id")
+	cfg.Proxy = viper.GetString("proxy")
+	cfg.Connection.MQTT.Proxy = viper.GetString("connection.mqtt.proxy")
+	if cfg.Connection.MQTT.Proxy == "" {
+		cfg.Connection.MQTT.Proxy = cfg.Proxy
+	}
+	cfg.Connection.MQTT.TLS = TLSConfig{
+		CACert:             viper.GetString("connection.mqtt.tls.ca_cert"),
+		ClientCert:         viper.GetString("connection.mqtt.tls.client_cert"),
+		ClientKey:          viper.GetString("connection.mqtt.tls.client_key"),
+		InsecureSkipVerify: viper.GetBool("connection.mqtt.tls.insecure_skip_verify"),
+		ServerName:         viper.GetString("connection.mqtt.tls.server_name"),
+	}
+
+	// PKI settings
+	cfg.Connection.PKI.PrivateKey = viper.GetString("connection.pki.private_key")
+	cfg.Connection.PKI.FromDevice = viper.GetBool("connection.pki.from_device")
+	cfg.Connection.Hexdump = viper.GetString("connection.hexdump")
+	cfg.Connection.Capture = viper.GetString("connection.capture")
+	cfg.Connection.StallTimeout = viper.GetDuration("connection.stall_timeout")
+	cfg.Connection.ConfigTimeout = viper.GetDuration("connection.config_timeout")
 
 	// Load outputs
 	outputsRaw := viper.Get("outputs")
@@ -41,6 +137,9 @@ func Load() (*Config, error) {
 			cfg.Outputs = make([]OutputConfig, 0, len(outputs))
 			for _, out := range outputs {
 				if outMap, ok := out.(map[string]interface{}); ok {
+					if cfg.Proxy != "" {
+						inheritProxy(outMap, cfg.Proxy)
+					}
 					outputCfg := OutputConfig{
 						Type:    getString(outMap, "type"),
 						Enabled: getBool(outMap, "enabled"),
@@ -53,9 +152,218 @@ func Load() (*Config, error) {
 	}
 
 	// Filters
-	cfg.Filters.MessageTypes = viper.GetStringSlice("filters.message_types")
-	cfg.Filters.NodeIDs = toUint32Slice(viper.Get("filters.node_ids"))
-	cfg.Filters.Channels = toUint32Slice(viper.Get("filters.channels"))
+	cfg.Filters = loadFilters("filters")
+	cfg.Connection.Filters = loadFilters("connection.filters")
+
+	// Schedules
+	if err := viper.UnmarshalKey("schedules", &cfg.Schedules); err != nil {
+		return nil, fmt.Errorf("failed to parse schedules: %w", err)
+	}
+
+	// Routes
+	if err := viper.UnmarshalKey("routes", &cfg.Routes); err != nil {
+		return nil, fmt.Errorf("failed to parse routes: %w", err)
+	}
+
+	// Mailbox
+	cfg.Mailbox.Enabled = viper.GetBool("mailbox.enabled")
+	cfg.Mailbox.Deliver = viper.GetBool("mailbox.deliver")
+	if d := viper.GetDuration("mailbox.offline_after"); d > 0 {
+		cfg.Mailbox.OfflineAfter = d
+	}
+	if n := viper.GetInt("mailbox.max_messages"); n > 0 {
+		cfg.Mailbox.MaxMessages = n
+	}
+	if d := viper.GetDuration("mailbox.max_age"); d > 0 {
+		cfg.Mailbox.MaxAge = d
+	}
+
+	// Startup replay
+	cfg.Replay.Enabled = viper.GetBool("replay.enabled")
+	cfg.Replay.Server = viper.GetString("replay.server")
+	cfg.Replay.StateFile = viper.GetString("replay.state_file")
+	if d := viper.GetDuration("replay.window"); d > 0 {
+		cfg.Replay.Window = d
+	}
+
+	// Node database
+	cfg.NodeDB.Path = viper.GetString("nodedb.path")
+	if n := viper.GetInt("nodedb.history"); n > 0 {
+		cfg.NodeDB.History = n
+	}
+	if d := viper.GetDuration("nodedb.save_interval"); d > 0 {
+		cfg.NodeDB.SaveInterval = d
+	}
+	cfg.NodeDB.Aliases = viper.GetStringMapString("nodedb.aliases")
+
+	// Notes
+	cfg.Notes.Path = viper.GetString("notes.path")
+
+	// Deduplication
+	cfg.Dedup.Enabled = viper.GetBool("dedup.enabled")
+	cfg.Dedup.StateFile = viper.GetString("dedup.state_file")
+	if d := viper.GetDuration("dedup.window"); d > 0 {
+		cfg.Dedup.Window = d
+	}
+
+	// Dead letters
+	cfg.DeadLetter.Path = viper.GetString("dead_letter.path")
+	if d := viper.GetDuration("dead_letter.retry_interval"); d > 0 {
+		cfg.DeadLetter.RetryInterval = d
+	}
+	if d := viper.GetDuration("dead_letter.max_age"); d > 0 {
+		cfg.DeadLetter.MaxAge = d
+	}
+	if n := viper.GetInt("dead_letter.max_messages"); n > 0 {
+		cfg.DeadLetter.MaxMessages = n
+	}
+
+	// HTTP API
+	cfg.API.Enabled = viper.GetBool("api.enabled")
+	cfg.API.Token = viper.GetString("api.token")
+	if l := viper.GetString("api.listen"); l != "" {
+		cfg.API.Listen = l
+	}
+	if n := viper.GetInt("api.history"); n > 0 {
+		cfg.API.History = n
+	}
+	cfg.API.MaxSilence = viper.GetDuration("api.max_silence")
+
+	// Web dashboard
+	cfg.Web.Enabled = viper.GetBool("web.enabled")
+	cfg.Web.Password = viper.GetString("web.password")
+	if l := viper.GetString("web.listen"); l != "" {
+		cfg.Web.Listen = l
+	}
+
+	// Alerts
+	cfg.Alerts.Enabled = viper.GetBool("alerts.enabled")
+	if d := viper.GetDuration("alerts.offline_after"); d > 0 {
+		cfg.Alerts.OfflineAfter = d
+	}
+	if n := viper.GetUint32("alerts.low_battery"); n > 0 {
+		cfg.Alerts.LowBattery = n
+	}
+	if d := viper.GetDuration("alerts.repeat"); d > 0 {
+		cfg.Alerts.Repeat = d
+	}
+	if d := viper.GetDuration("alerts.ack_period"); d > 0 {
+		cfg.Alerts.AckPeriod = d
+	}
+	if d := viper.GetDuration("alerts.snooze_period"); d > 0 {
+		cfg.Alerts.SnoozePeriod = d
+	}
+
+	// Cluster
+	cfg.Cluster.Enabled = viper.GetBool("cluster.enabled")
+	cfg.Cluster.Name = viper.GetString("cluster.name")
+	cfg.Cluster.Broker = viper.GetString("cluster.broker")
+	if t := viper.GetString("cluster.topic"); t != "" {
+		cfg.Cluster.Topic = t
+	}
+	cfg.Cluster.Username = viper.GetString("cluster.username")
+	cfg.Cluster.Password = viper.GetString("cluster.password")
+	cfg.Cluster.ClientID = viper.GetString("cluster.client_id")
+	cfg.Cluster.Proxy = viper.GetString("cluster.proxy")
+	if cfg.Cluster.Proxy == "" {
+		cfg.Cluster.Proxy = cfg.Proxy
+	}
+	cfg.Cluster.TLS = TLSConfig{
+		CACert:             viper.GetString("cluster.tls.ca_cert"),
+		ClientCert:         viper.GetString("cluster.tls.client_cert"),
+		ClientKey:          viper.GetString("cluster.tls.client_key"),
+		InsecureSkipVerify: viper.GetBool("cluster.tls.insecure_skip_verify"),
+		ServerName:         viper.GetString("cluster.tls.server_name"),
+	}
+
+	// Low-power mode
+	cfg.Power.Enabled = viper.GetBool("power.enabled")
+	if d := viper.GetDuration("power.save_interval"); d > 0 {
+		cfg.Power.SaveInterval = d
+	}
+	if d := viper.GetDuration("power.check_interval"); d > 0 {
+		cfg.Power.CheckInterval = d
+	}
+	if d := viper.GetDuration("power.flush_interval"); d > 0 {
+		cfg.Power.FlushInterval = d
+	}
+	if d := viper.GetDuration("power.poll_interval"); d > 0 {
+		cfg.Power.PollInterval = d
+	}
+	cfg.Power.BatteryThreshold = viper.GetUint32("power.battery_threshold")
+
+	// Reaction summaries
+	cfg.Reactions.Enabled = viper.GetBool("reactions.enabled")
+	if d := viper.GetDuration("reactions.digest_interval"); d > 0 {
+		cfg.Reactions.DigestInterval = d
+	}
+
+	// Canaries
+	cfg.Canary.Enabled = viper.GetBool("canary.enabled")
+	if viper.IsSet("canary.interval") {
+		cfg.Canary.Interval = viper.GetDuration("canary.interval")
+	}
+	if t := viper.GetString("canary.text"); t != "" {
+		cfg.Canary.Text = t
+	}
+	if d := viper.GetDuration("canary.timeout"); d > 0 {
+		cfg.Canary.Timeout = d
+	}
+	if viper.IsSet("canary.max_latency") {
+		cfg.Canary.MaxLatency = viper.GetDuration("canary.max_latency")
+	}
+	if n := viper.GetInt("canary.failures"); n > 0 {
+		cfg.Canary.Failures = n
+	}
+	if n := viper.GetInt("canary.history"); n > 0 {
+		cfg.Canary.History = n
+	}
+
+	// Relay station
+	cfg.Relay.HomeLat = viper.GetFloat64("relay.home_lat")
+	cfg.Relay.HomeLon = viper.GetFloat64("relay.home_lon")
+	cfg.Relay.SigningKey = viper.GetString("relay.signing_key")
+	cfg.Relay.SafeMode = viper.GetBool("relay.safe_mode")
+	if v := viper.GetString("relay.clock"); v != "" {
+		cfg.Relay.Clock = v
+	}
+	cfg.Relay.SequenceFile = viper.GetString("relay.sequence_file")
+	if viper.IsSet("relay.watch_config") {
+		cfg.Relay.WatchConfig = viper.GetBool("relay.watch_config")
+	}
+	cfg.Connection.SafeMode = cfg.Relay.SafeMode
+
+	// Position enrichment
+	cfg.Positions.MapLinks = strings.ToLower(viper.GetString("positions.map_links"))
+	cfg.Positions.Geocoder.Type = strings.ToLower(viper.GetString("positions.geocoder.type"))
+	if v := viper.GetString("positions.geocoder.url"); v != "" {
+		cfg.Positions.Geocoder.URL = v
+	}
+	if v := viper.GetString("positions.geocoder.user_agent"); v != "" {
+		cfg.Positions.Geocoder.UserAgent = v
+	}
+	cfg.Positions.Geocoder.Language = viper.GetString("positions.geocoder.language")
+	if viper.IsSet("positions.geocoder.timeout") {
+		cfg.Positions.Geocoder.Timeout = viper.GetDuration("positions.geocoder.timeout")
+	}
+	if viper.IsSet("positions.geocoder.interval") {
+		cfg.Positions.Geocoder.Interval = viper.GetDuration("positions.geocoder.interval")
+	}
+	cfg.Positions.Geocoder.Proxy = viper.GetString("positions.geocoder.proxy")
+	if cfg.Positions.Geocoder.Proxy == "" {
+		cfg.Positions.Geocoder.Proxy = cfg.Proxy
+	}
+
+	// Files kept across restarts go in the state directory unless given
+	// as absolute paths. Version 1 took them from the working directory.
+	if v := viper.GetString("state_dir"); v != "" {
+		cfg.StateDir = v
+	}
+	if cfg.Version >= 2 {
+		for _, p := range cfg.statePaths() {
+			*p.path = state.Resolve(cfg.StateDir, *p.path)
+		}
+	}
 
 	// Logging
 	cfg.Logging.Level = viper.GetString("logging.level")
@@ -66,68 +374,540 @@ func Load() (*Config, error) {
 	if cfg.Logging.Format == "" {
 		cfg.Logging.Format = "text"
 	}
+	if viper.IsSet("logging.sample_threshold") {
+		cfg.Logging.SampleThreshold = viper.GetInt("logging.sample_threshold")
+	}
+	if d := viper.GetDuration("logging.sample_interval"); d > 0 {
+		cfg.Logging.SampleInterval = d
+	}
 
 	return cfg, nil
 }
 
 // Validate checks the configuration for errors
 func (c *Config) Validate() error {
+	if err := c.Connection.Validate(); err != nil {
+		return err
+	}
+
+	// Validate outputs
+	if len(c.Outputs) == 0 {
+		return fmt.Errorf("at least one output must be configured")
+	}
+
+	enabledOutputs := 0
+	for i, out := range c.Outputs {
+		if out.Enabled {
+			enabledOutputs++
+		}
+		if err := validateOutput(out, fmt.Sprintf("outputs[%d]", i)); err != nil {
+			return err
+		}
+		if err := validateFallbacks(out, fmt.Sprintf("outputs[%d]", i)); err != nil {
+			return err
+		}
+	}
+
+	if enabledOutputs == 0 {
+		return fmt.Errorf("at least one output must be enabled")
+	}
+
+	for id, name := range c.NodeDB.Aliases {
+		if _, err := message.ParseNodeID(id); err != nil {
+			return fmt.Errorf("nodedb.aliases: %w", err)
+		}
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("nodedb.aliases: %s has an empty name", id)
+		}
+	}
+
+	if err := validateFilters(c.Filters, "filters"); err != nil {
+		return err
+	}
+	if err := validateFilters(c.Connection.Filters, "connection.filters"); err != nil {
+		return err
+	}
+
+	if c.Relay.HomeLat < -90 || c.Relay.HomeLat > 90 {
+		return fmt.Errorf("relay.home_lat must be between -90 and 90")
+	}
+	if c.Relay.HomeLon < -180 || c.Relay.HomeLon > 180 {
+		return fmt.Errorf("relay.home_lon must be between -180 and 180")
+	}
+	if c.Relay.Clock != "" && c.Relay.Clock != ClockDevice && c.Relay.Clock != ClockRelay {
+		return fmt.Errorf("relay.clock must be %s or %s", ClockDevice, ClockRelay)
+	}
+
+	switch c.Positions.MapLinks {
+	case "", MapLinksOSM, MapLinksGoogle:
+	default:
+		return fmt.Errorf("positions.map_links must be %s or %s", MapLinksOSM, MapLinksGoogle)
+	}
+	if g := c.Positions.Geocoder; g.Type != "" {
+		if g.Type != GeocoderNominatim {
+			return fmt.Errorf("positions.geocoder.type must be %s", GeocoderNominatim)
+		}
+		if _, err := url.ParseRequestURI(g.URL); err != nil {
+			return fmt.Errorf("positions.geocoder.url: %w", err)
+		}
+		if g.Timeout <= 0 {
+			return fmt.Errorf("positions.geocoder.timeout must be positive")
+		}
+		if g.Interval < 0 {
+			return fmt.Errorf("positions.geocoder.interval must not be negative")
+		}
+		if g.Proxy != "" {
+			if _, err := ParseProxy(g.Proxy); err != nil {
+				return fmt.Errorf("positions.geocoder.proxy: %w", err)
+			}
+		}
+	}
+
+	if c.Cluster.Enabled {
+		if c.Cluster.Broker == "" {
+			return fmt.Errorf("cluster.broker is required")
+		}
+		if strings.ContainsAny(c.Cluster.Topic, "+#") || c.Cluster.Topic == "" {
+			return fmt.Errorf("cluster.topic must be a topic name without wildcards")
+		}
+		if c.Cluster.TLS.IsSet() {
+			if _, err := c.Cluster.TLS.Load(); err != nil {
+				return fmt.Errorf("cluster.tls: %w", err)
+			}
+		}
+		if c.Cluster.Proxy != "" {
+			if _, err := ParseProxy(c.Cluster.Proxy); err != nil {
+				return fmt.Errorf("cluster.proxy: %w", err)
+			}
+		}
+	}
+
+	seen := make(map[string]string)
+	for _, f := range c.StateFiles() {
+		if key, ok := seen[f.Path]; ok {
+			return fmt.Errorf("%s and %s must be different files", key, f.Key)
+		}
+		seen[f.Path] = f.Key
+	}
+
+	if c.API.MaxSilence < 0 {
+		return fmt.Errorf("api.max_silence must not be negative")
+	}
+	if c.Logging.SampleThreshold < 0 {
+		return fmt.Errorf("logging.sample_threshold must not be negative")
+	}
+
+	if c.Canary.Interval < 0 {
+		return fmt.Errorf("canary.interval must not be negative")
+	}
+	if c.Canary.MaxLatency < 0 {
+		return fmt.Errorf("canary.max_latency must not be negative")
+	}
+	if c.Canary.Enabled && c.Canary.Interval > 0 && c.Canary.Interval < c.Canary.Timeout {
+		return fmt.Errorf("canary.interval must be at least canary.timeout")
+	}
+
+	if c.Power.BatteryThreshold > 100 {
+		return fmt.Errorf("power.battery_threshold must be between 0 and 100")
+	}
+
+	// Validate schedules
+	for i := range c.Schedules {
+		if err := c.Schedules[i].Validate(); err != nil {
+			return fmt.Errorf("schedules[%d]: %w", i, err)
+		}
+	}
+
+	return c.validateRoutes()
+}
+
+// validateRoutes checks that every route sends to groups outputs are in
+func (c *Config) validateRoutes() error {
+	groups := make(map[string]bool)
+	for i, out := range c.Outputs {
+		names, err := out.Groups()
+		if err != nil {
+			return fmt.Errorf("outputs[%d].groups %w", i, err)
+		}
+		for _, g := range names {
+			groups[g] = true
+		}
+	}
+	if len(c.Routes) == 0 && len(groups) > 0 {
+		return fmt.Errorf("outputs have groups but no routes send to them")
+	}
+
+	for i := range c.Routes {
+		if err := c.Routes[i].Validate(); err != nil {
+			return fmt.Errorf("routes[%d]: %w", i, err)
+		}
+		for _, g := range c.Routes[i].Groups {
+			if !groups[g] {
+				return fmt.Errorf("routes[%d]: no output is in group %q", i, g)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks the route's criteria
+func (r *RouteConfig) Validate() error {
+	if len(r.Groups) == 0 {
+		return fmt.Errorf("groups is required")
+	}
+	for _, ch := range r.Channels {
+		if ch > MaxChannelIndex {
+			return fmt.Errorf("channels must be between 0 and %d", MaxChannelIndex)
+		}
+	}
+	for _, id := range r.Nodes {
+		if _, err := message.ParseNodeID(id); err != nil {
+			return fmt.Errorf("nodes: %w", err)
+		}
+	}
+	return nil
+}
+
+// MaxChannelIndex is the highest channel index a device supports
+const MaxChannelIndex = 7
+
+// Validate checks the schedule settings for errors
+func (s *ScheduleConfig) Validate() error {
+	switch {
+	case s.At == "" && s.Every == 0:
+		return fmt.Errorf("one of at or every is required")
+	case s.At != "" && s.Every != 0:
+		return fmt.Errorf("at and every are mutually exclusive")
+	case s.Every < 0:
+		return fmt.Errorf("every must be positive")
+	case s.Every > 0 && s.Every < time.Minute:
+		return fmt.Errorf("every must be at least 1m to avoid flooding the mesh")
+	}
+
+	if s.At != "" {
+		if _, _, err := ParseTimeOfDay(s.At); err != nil {
+			return err
+		}
+	} else if len(s.Days) > 0 {
+		return fmt.Errorf("days can only be used with at")
+	}
+
+	for _, day := range s.Days {
+		if _, err := ParseWeekday(day); err != nil {
+			return err
+		}
+	}
+
+	if s.Timezone != "" {
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", s.Timezone, err)
+		}
+	}
+
+	if s.Channel > MaxChannelIndex {
+		return fmt.Errorf("channel must be between 0 and %d", MaxChannelIndex)
+	}
+
+	if strings.TrimSpace(s.Message) == "" {
+		return fmt.Errorf("message is required")
+	}
+	if _, err := template.New(s.Name).Parse(s.Message); err != nil {
+		return fmt.Errorf("invalid message template: %w", err)
+	}
+
+	return nil
+}
+
+// ParseTimeOfDay parses an HH:MM time of day
+func ParseTimeOfDay(s string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time of day %q (expected HH:MM)", s)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// ParseWeekday parses a weekday name such as "mon" or "Monday"
+func ParseWeekday(s string) (time.Weekday, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		full := strings.ToLower(d.String())
+		if name == full || name == full[:3] {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day %q", s)
+}
+
+// Validate checks the connection settings for errors
+func (c *ConnectionConfig) Validate() error {
 	// Validate connection type
-	switch c.Connection.Type {
+	switch c.Type {
 	case "serial", "tcp", "mqtt":
 		// Valid
 	case "":
 		return fmt.Errorf("connection.type is required")
 	default:
-		return fmt.Errorf("invalid connection.type: %s (must be serial, tcp, or mqtt)", c.Connection.Type)
+		return fmt.Errorf("invalid connection.type: %s (must be serial, tcp, or mqtt)", c.Type)
 	}
 
 	// Validate connection-specific settings
-	switch c.Connection.Type {
+	switch c.Type {
 	case "serial":
-		if c.Connection.Serial.Port == "" {
+		if c.Serial.Port == "" {
 			return fmt.Errorf("connection.serial.port is required for serial connection")
 		}
+		for _, line := range []struct{ key, value string }{
+			{"connection.serial.dtr", c.Serial.DTR},
+			{"connection.serial.rts", c.Serial.RTS},
+		} {
+			if !slices.Contains(SerialLineStates, line.value) {
+				return fmt.Errorf("%s must be on or off, got %q", line.key, line.value)
+			}
+		}
+		if c.Serial.SettleDelay < 0 {
+			return fmt.Errorf("connection.serial.settle_delay must not be negative")
+		}
 	case "tcp":
-		if c.Connection.TCP.Host == "" {
+		if c.TCP.Host == "" {
 			return fmt.Errorf("connection.tcp.host is required for tcp connection")
 		}
+		if c.TCP.FallbackDelay < 0 {
+			return fmt.Errorf("connection.tcp.fallback_delay must not be negative")
+		}
+		if c.TCP.TLS.IsSet() && !c.TCP.TLS.Enabled {
+			return fmt.Errorf("connection.tcp.tls settings require connection.tcp.tls.enabled")
+		}
+		if c.TCP.TLS.Enabled {
+			if _, err := c.TCP.TLS.Load(); err != nil {
+				return fmt.Errorf("connection.tcp.tls: %w", err)
+			}
+		}
 	case "mqtt":
-		if c.Connection.MQTT.Broker == "" {
+		if c.MQTT.Broker == "" {
 			return fmt.Errorf("connection.mqtt.broker is required for mqtt connection")
 		}
+		if c.MQTT.TLS.IsSet() {
+			if !IsTLSBroker(c.MQTT.Broker) {
+				return fmt.Errorf("connection.mqtt.tls requires an ssl://, tls://, mqtts:// or wss:// broker")
+			}
+			if _, err := c.MQTT.TLS.Load(); err != nil {
+				return fmt.Errorf("connection.mqtt.tls: %w", err)
+			}
+		}
+		if c.MQTT.Proxy != "" {
+			if _, err := ParseProxy(c.MQTT.Proxy); err != nil {
+				return fmt.Errorf("connection.mqtt.proxy: %w", err)
+			}
+		}
 	}
 
-	// Validate outputs
-	if len(c.Outputs) == 0 {
-		return fmt.Errorf("at least one output must be configured")
+	for _, size := range []struct {
+		key   string
+		value int
+	}{
+		{"connection.serial.max_packet_size", c.Serial.MaxPacketSize},
+		{"connection.tcp.max_packet_size", c.TCP.MaxPacketSize},
+	} {
+		if size.value < 0 || size.value > meshtastic.MaxFrameSize {
+			return fmt.Errorf("%s must be between 0 and %d", size.key, meshtastic.MaxFrameSize)
+		}
 	}
 
-	enabledOutputs := 0
-	for i, out := range c.Outputs {
-		if out.Enabled {
-			enabledOutputs++
+	if c.PKI.PrivateKey != "" {
+		if _, err := c.PKI.Key(); err != nil {
+			return fmt.Errorf("connection.pki.private_key: %w", err)
+		}
+	}
+	if c.PKI.FromDevice && c.Type == "mqtt" {
+		return fmt.Errorf("connection.pki.from_device requires a serial or tcp connection")
+	}
+	if c.PKI.FromDevice && c.SafeMode {
+		return fmt.Errorf("connection.pki.from_device asks the device for its key, which safe mode does not allow; set connection.pki.private_key instead")
+	}
+	if c.Hexdump != "" && c.Type == "mqtt" {
+		return fmt.Errorf("connection.hexdump requires a serial or tcp connection")
+	}
+	if c.Capture != "" && c.Type == "mqtt" {
+		return fmt.Errorf("connection.capture requires a serial or tcp connection")
+	}
+	if c.Capture != "" && c.Capture == c.Hexdump {
+		return fmt.Errorf("connection.capture and connection.hexdump must be different files")
+	}
+	if c.StallTimeout < 0 {
+		return fmt.Errorf("connection.stall_timeout must not be negative")
+	}
+	if c.StallTimeout > 0 && c.Type == "mqtt" {
+		return fmt.Errorf("connection.stall_timeout requires a serial or tcp connection")
+	}
+	if c.ConfigTimeout < 0 {
+		return fmt.Errorf("connection.config_timeout must not be negative")
+	}
+	if c.ConfigTimeout > 0 && c.Type == "mqtt" {
+		return fmt.Errorf("connection.config_timeout requires a serial or tcp connection")
+	}
+
+	return nil
+}
+
+// Helper functions
+
+// loadMQTTTopics reads connection.mqtt.topics, a list of topic filters
+// given as strings or as maps with topic and qos
+func loadMQTTTopics(raw interface{}) ([]MQTTTopic, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	items, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("connection.mqtt.topics must be a list")
+	}
+
+	topics := make([]MQTTTopic, 0, len(items))
+	for i, item := range items {
+		t := MQTTTopic{QoS: DefaultMQTTQoS}
+		switch v := item.(type) {
+		case string:
+			t.Topic = v
+		case map[string]interface{}:
+			t.Topic = getString(v, "topic")
+			if q, ok := v["qos"]; ok {
+				n := toUint32Slice([]interface{}{q})
+				if len(n) != 1 || n[0] > 2 {
+					return nil, fmt.Errorf("connection.mqtt.topics[%d].qos must be 0, 1, or 2", i)
+				}
+				t.QoS = byte(n[0])
+			}
 		}
-		if out.Type == "" {
-			return fmt.Errorf("outputs[%d].type is required", i)
+		if t.Topic == "" {
+			return nil, fmt.Errorf("connection.mqtt.topics[%d].topic is required", i)
 		}
-		switch out.Type {
-		case "stdout", "file", "apprise", "webhook":
-			// Valid
-		default:
-			return fmt.Errorf("outputs[%d].type is invalid: %s", i, out.Type)
+		topics = append(topics, t)
+	}
+	return topics, nil
+}
+
+// validateOutput checks an output's type and options
+func validateOutput(out OutputConfig, name string) error {
+	if out.Type == "" {
+		return fmt.Errorf("%s.type is required", name)
+	}
+	if _, ok := outputSchemas[out.Type]; !ok {
+		return fmt.Errorf("%s.type is invalid: %s", name, out.Type)
+	}
+	switch v := out.Options["retries"].(type) {
+	case nil:
+	case int:
+		if v < 0 {
+			return fmt.Errorf("%s.retries must not be negative", name)
+		}
+	default:
+		return fmt.Errorf("%s.retries must be a whole number", name)
+	}
+	for _, opt := range []string{"retry_delay", "retry_max_delay"} {
+		if v, ok := out.Options[opt]; ok {
+			s, _ := v.(string)
+			if d, err := time.ParseDuration(s); err != nil || d < 0 {
+				return fmt.Errorf("%s.%s is invalid: %v", name, opt, v)
+			}
 		}
 	}
+	switch v := out.Options["retry_backoff"].(type) {
+	case nil:
+	case int:
+		if v < 1 {
+			return fmt.Errorf("%s.retry_backoff must be at least 1", name)
+		}
+	case float64:
+		if v < 1 {
+			return fmt.Errorf("%s.retry_backoff must be at least 1", name)
+		}
+	default:
+		return fmt.Errorf("%s.retry_backoff must be a number", name)
+	}
+	switch v := out.Options["queue_size"].(type) {
+	case nil:
+	case int:
+		if v < 1 {
+			return fmt.Errorf("%s.queue_size must be at least 1", name)
+		}
+	case float64:
+		// Numbers given through the API arrive as floats
+		if v != math.Trunc(v) {
+			return fmt.Errorf("%s.queue_size must be a whole number", name)
+		}
+		if v < 1 {
+			return fmt.Errorf("%s.queue_size must be at least 1", name)
+		}
+	default:
+		return fmt.Errorf("%s.queue_size must be a whole number", name)
+	}
+	if v, ok := out.Options["queue_full"]; ok && v != "drop" && v != "block" {
+		return fmt.Errorf("%s.queue_full must be drop or block", name)
+	}
+	if v, ok := out.Options["proxy"]; ok {
+		if !slices.Contains(ProxyOutputTypes, out.Type) {
+			return fmt.Errorf("%s.proxy is not supported by %s outputs", name, out.Type)
+		}
+		s, _ := v.(string)
+		if _, err := ParseProxy(s); err != nil {
+			return fmt.Errorf("%s.proxy: %w", name, err)
+		}
+	}
+	if v, ok := out.Options["filter"]; ok {
+		s, isString := v.(string)
+		if !isString {
+			return fmt.Errorf("%s.filter must be an expression", name)
+		}
+		if _, err := filter.Compile(s); err != nil {
+			return fmt.Errorf("%s.filter: %w", name, err)
+		}
+	}
+	tp, err := out.TextPatterns()
+	if err != nil {
+		return fmt.Errorf("%s.text_patterns: %w", name, err)
+	}
+	if _, err := filter.NewTextPatterns(tp.Include, tp.Exclude); err != nil {
+		return fmt.Errorf("%s.text_patterns.%w", name, err)
+	}
+	return checkOptions(out, name)
+}
 
-	if enabledOutputs == 0 {
-		return fmt.Errorf("at least one output must be enabled")
+// validateFallbacks checks the fallback chain of an output
+func validateFallbacks(out OutputConfig, name string) error {
+	var entries int
+	switch v := out.Options["fallback"].(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		entries = 1
+	case []interface{}:
+		entries = len(v)
+	default:
+		return fmt.Errorf("%s.fallback must be an output or a list of outputs", name)
 	}
 
+	fallbacks := out.Fallbacks()
+	if len(fallbacks) != entries {
+		return fmt.Errorf("%s.fallback must be an output or a list of outputs", name)
+	}
+	for j, fb := range fallbacks {
+		fbName := fmt.Sprintf("%s.fallback[%d]", name, j)
+		if err := validateOutput(fb, fbName); err != nil {
+			return err
+		}
+		if _, nested := fb.Options["fallback"]; nested {
+			return fmt.Errorf("%s cannot have its own fallback; list the chain in order instead", fbName)
+		}
+		for _, opt := range []string{"filter", "text_patterns", "groups"} {
+			if _, ok := fb.Options[opt]; ok {
+				return fmt.Errorf("%s.%s is not used; fallbacks get what their output sends", fbName, opt)
+			}
+		}
+	}
 	return nil
 }
 
-// Helper functions
-
 func getString(m map[string]interface{}, key string) string {
 	if v, ok := m[key]; ok {
 		if s, ok := v.(string); ok {
@@ -146,6 +926,34 @@ func getBool(m map[string]interface{}, key string) bool {
 	return false
 }
 
+// loadFilters reads the filter settings under key
+func loadFilters(key string) FilterConfig {
+	return FilterConfig{
+		MessageTypes: viper.GetStringSlice(key + ".message_types"),
+		NodeIDs:      toUint32Slice(viper.Get(key + ".node_ids")),
+		Channels:     toUint32Slice(viper.Get(key + ".channels")),
+		Expression:   viper.GetString(key + ".expression"),
+		TextPatterns: TextPatternsConfig{
+			Include: viper.GetStringSlice(key + ".text_patterns.include"),
+			Exclude: viper.GetStringSlice(key + ".text_patterns.exclude"),
+		},
+	}
+}
+
+// validateFilters checks the expression and text patterns of filter
+// settings named name
+func validateFilters(f FilterConfig, name string) error {
+	if f.Expression != "" {
+		if _, err := filter.Compile(f.Expression); err != nil {
+			return fmt.Errorf("%s.expression: %w", name, err)
+		}
+	}
+	if _, err := filter.NewTextPatterns(f.TextPatterns.Include, f.TextPatterns.Exclude); err != nil {
+		return fmt.Errorf("%s.text_patterns.%w", name, err)
+	}
+	return nil
+}
+
 func toUint32Slice(v interface{}) []uint32 {
 	if v == nil {
 		return nil
@@ -173,3 +981,15 @@ func toUint32Slice(v interface{}) []uint32 {
 	}
 	return nil
 }
+
+// Key decodes the configured private key
+func (c *PKIConfig) Key() ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(c.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
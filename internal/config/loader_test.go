@@ -0,0 +1,332 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestLoadMQTTTopics(t *testing.T) {
+	topics, err := loadMQTTTopics([]interface{}{
+		"msh/US/2/e/LongFast/#",
+		map[string]interface{}{"topic": "msh/EU_868/2/json/#", "qos": 0},
+		map[string]interface{}{"topic": "msh/ANZ/#", "qos": float64(2)},
+	})
+	if err != nil {
+		t.Fatalf("loadMQTTTopics: %v", err)
+	}
+
+	cfg := MQTTConfig{Topic: "ignored/#", Topics: topics}
+	want := map[string]byte{"msh/US/2/e/LongFast/#": 1, "msh/EU_868/2/json/#": 0, "msh/ANZ/#": 2}
+	subs := cfg.Subscriptions()
+	if len(subs) != len(want) {
+		t.Fatalf("Subscriptions = %v", subs)
+	}
+	for topic, qos := range want {
+		if got, ok := subs[topic]; !ok || got != qos {
+			t.Errorf("%s: qos %d, want %d", topic, got, qos)
+		}
+	}
+
+	single := MQTTConfig{Topic: "meshtastic/#"}
+	if subs := single.Subscriptions(); len(subs) != 1 || subs["meshtastic/#"] != DefaultMQTTQoS {
+		t.Errorf("single topic Subscriptions = %v", subs)
+	}
+
+	for _, bad := range []interface{}{
+		"msh/#",
+		[]interface{}{map[string]interface{}{"qos": 1}},
+		[]interface{}{map[string]interface{}{"topic": "msh/#", "qos": 3}},
+	} {
+		if _, err := loadMQTTTopics(bad); err == nil {
+			t.Errorf("loadMQTTTopics(%v) accepted", bad)
+		}
+	}
+}
+
+func TestValidateFallbacks(t *testing.T) {
+	output := func(fallback interface{}) *Config {
+		cfg := DefaultConfig()
+		cfg.Outputs = []OutputConfig{{Type: "apprise", Enabled: true, Options: map[string]interface{}{
+			"retries":  2,
+			"fallback": fallback,
+		}}}
+		return cfg
+	}
+
+	chain := []interface{}{
+		map[string]interface{}{"type": "webhook", "url": "http://localhost/a"},
+		map[string]interface{}{"type": "file", "path": "/tmp/relay.log"},
+	}
+	cfg := output(chain)
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if fbs := cfg.Outputs[0].Fallbacks(); len(fbs) != 2 || fbs[1].Type != "file" || !fbs[1].Enabled {
+		t.Errorf("Fallbacks = %+v", fbs)
+	}
+
+	for _, bad := range []interface{}{
+		"webhook",
+		[]interface{}{"webhook"},
+		map[string]interface{}{"url": "http://localhost"},
+		map[string]interface{}{"type": "pager"},
+		map[string]interface{}{"type": "stdout", "fallback": map[string]interface{}{"type": "stdout"}},
+		map[string]interface{}{"type": "stdout", "retry_delay": "soon"},
+		map[string]interface{}{"type": "stdout", "retry_backoff": 0.5},
+		map[string]interface{}{"type": "stdout", "retry_max_delay": "-1s"},
+		map[string]interface{}{"type": "stdout", "queue_size": 0},
+		map[string]interface{}{"type": "stdout", "queue_size": -5.0},
+		map[string]interface{}{"type": "stdout", "queue_size": 2.5},
+		map[string]interface{}{"type": "stdout", "queue_full": "wait"},
+	} {
+		if err := output(bad).Validate(); err == nil {
+			t.Errorf("fallback %v accepted", bad)
+		}
+	}
+
+	// Numbers from JSON are floats
+	if err := output(map[string]interface{}{"type": "stdout", "queue_size": 500.0}).Validate(); err != nil {
+		t.Errorf("queue_size 500.0: Validate = %v", err)
+	}
+}
+
+func TestValidateOutputOptions(t *testing.T) {
+	cfg, err := LoadYAML([]byte(`
+connection:
+  type: serial
+  serial:
+    port: /dev/ttyUSB0
+outputs:
+  - type: apprise
+    enabled: true
+    url: http://apprise:8000/notify
+    timeout: 30s
+    max_in_flight: 4
+    channels:
+      1: {tag: alerts, enabled: false}
+    normalize_text: true
+  - type: kafka
+    enabled: true
+    brokers: localhost:9092
+    key: channel
+    tls: {ca_cert: /etc/ssl/ca.pem}
+    pseudonymize: {salt: pepper}
+`))
+	if err != nil {
+		t.Fatalf("LoadYAML: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	for opt, want := range map[string]string{
+		"tiemout: 30s":                                "outputs[0].tiemout is not a known apprise output option (did you mean timeout?)",
+		"timeout: 30":                                 "outputs[0].timeout must be a duration such as 30s",
+		"broker: tcp://mqtt:1883":                     "outputs[0].broker is not a known apprise output option",
+		"max_in_flight: many":                         "outputs[0].max_in_flight must be a whole number",
+		"channels: {1: {tagg: x}}":                    "outputs[0].channels.1.tagg is not a known option (did you mean tag?)",
+		"channels: {one: {tag: x}}":                   "outputs[0].channels[one] must be a whole number",
+		"normalize_text: {transliterate: yes please}": "outputs[0].normalize_text.transliterate must be true or false",
+	} {
+		cfg, err := LoadYAML([]byte("connection: {type: serial, serial: {port: /dev/ttyUSB0}}\noutputs:\n  - {type: apprise, enabled: true, " + opt + "}\n"))
+		if err != nil {
+			t.Fatalf("LoadYAML: %v", err)
+		}
+		if err := cfg.Validate(); err == nil || err.Error() != want {
+			t.Errorf("%s: Validate = %v, want %s", opt, err, want)
+		}
+	}
+}
+
+func TestLoadProxy(t *testing.T) {
+	cfg, err := LoadYAML([]byte(`
+proxy: socks5://gw.internal:1080
+connection:
+  type: mqtt
+  mqtt:
+    broker: tcp://broker:1883
+outputs:
+  - type: webhook
+    enabled: true
+    url: http://hooks.example.com
+    fallback:
+      - {type: apprise, url: http://apprise:8000/notify}
+      - {type: file, path: /tmp/relay.log}
+  - type: telegram
+    enabled: true
+    proxy: none
+  - type: stdout
+    enabled: true
+`))
+	if err != nil {
+		t.Fatalf("LoadYAML: %v", err)
+	}
+	if cfg.Connection.MQTT.Proxy != "socks5://gw.internal:1080" {
+		t.Errorf("connection.mqtt.proxy = %q", cfg.Connection.MQTT.Proxy)
+	}
+
+	proxies := map[string]interface{}{}
+	for _, out := range cfg.Outputs {
+		proxies[out.Type] = out.Options["proxy"]
+		for _, fb := range out.Fallbacks() {
+			proxies[fb.Type] = fb.Options["proxy"]
+		}
+	}
+	want := map[string]interface{}{
+		"webhook":  "socks5://gw.internal:1080",
+		"apprise":  "socks5://gw.internal:1080",
+		"file":     nil,
+		"telegram": NoProxy,
+		"stdout":   nil,
+	}
+	for typ, p := range want {
+		if proxies[typ] != p {
+			t.Errorf("%s proxy = %v, want %v", typ, proxies[typ], p)
+		}
+	}
+
+	cfg.Outputs[1].Options["proxy"] = "ftp://gw.internal"
+	if err := cfg.Validate(); err == nil {
+		t.Error("ftp proxy accepted")
+	}
+	cfg.Outputs[1].Options["proxy"] = NoProxy
+	cfg.Outputs[2].Options["proxy"] = "http://gw.internal:3128"
+	if err := cfg.Validate(); err == nil {
+		t.Error("proxy on a stdout output accepted")
+	}
+}
+
+func TestValidateRoutes(t *testing.T) {
+	cfg, err := LoadYAML([]byte(`
+connection:
+  type: serial
+  serial:
+    port: /dev/ttyUSB0
+outputs:
+  - type: stdout
+    enabled: true
+    groups: alerts
+  - type: file
+    enabled: true
+    path: /tmp/relay.log
+    groups: [archive, alerts]
+routes:
+  - name: sos
+    channels: [1]
+    nodes: ["!1234abcd", 42]
+    groups: [alerts]
+    continue: true
+  - groups: [archive]
+`))
+	if err != nil {
+		t.Fatalf("LoadYAML: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if r := cfg.Routes[0]; len(r.Nodes) != 2 || r.Nodes[1] != "42" || !r.Continue {
+		t.Errorf("Routes[0] = %+v", r)
+	}
+
+	for name, route := range map[string]RouteConfig{
+		"no groups":     {Name: "empty"},
+		"unknown group": {Groups: []string{"pager"}},
+		"bad channel":   {Channels: []uint32{8}, Groups: []string{"alerts"}},
+		"bad node":      {Nodes: []string{"!xyz"}, Groups: []string{"alerts"}},
+	} {
+		bad := *cfg
+		bad.Routes = []RouteConfig{route}
+		if err := bad.Validate(); err == nil {
+			t.Errorf("%s: route accepted", name)
+		}
+	}
+
+	ungrouped := *cfg
+	ungrouped.Routes = nil
+	if err := ungrouped.Validate(); err == nil {
+		t.Error("groups without routes accepted")
+	}
+}
+
+func TestLoadStateDir(t *testing.T) {
+	cfg, err := LoadYAML([]byte(`
+version: 2
+state_dir: /var/lib/relay
+connection:
+  type: serial
+  serial:
+    port: /dev/ttyUSB0
+  capture: radio.mrcap
+outputs:
+  - type: stdout
+    enabled: true
+nodedb:
+  path: nodes.json
+dead_letter:
+  path: /srv/undelivered.jsonl
+`))
+	if err != nil {
+		t.Fatalf("LoadYAML: %v", err)
+	}
+	want := []StateFile{
+		{"nodedb.path", "/var/lib/relay/nodes.json"},
+		{"dead_letter.path", "/srv/undelivered.jsonl"},
+		{"connection.capture", "/var/lib/relay/radio.mrcap"},
+	}
+	got := cfg.StateFiles()
+	if len(got) != len(want) {
+		t.Fatalf("StateFiles = %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("StateFiles[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	cfg.Notes.Path = cfg.NodeDB.Path
+	if err := cfg.Validate(); err == nil {
+		t.Error("notes and node database sharing a file accepted")
+	}
+}
+
+func TestLoadWithoutConfigFile(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("connection.type", "serial")
+	viper.Set("connection.serial.port", "/dev/null")
+	viper.Set("state_dir", "/var/lib/relay")
+	viper.Set("nodedb.path", "nodes.json")
+
+	// Settings from flags alone are not an older file layout
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Version != CurrentVersion {
+		t.Errorf("Version = %d, want %d", cfg.Version, CurrentVersion)
+	}
+	if cfg.NodeDB.Path != "/var/lib/relay/nodes.json" {
+		t.Errorf("nodedb.path = %q, want it in the state directory", cfg.NodeDB.Path)
+	}
+
+	// A file without a version is still version 1
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("connection:\n  type: serial\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(path)
+	if err := ReadInConfig(); err != nil {
+		t.Fatalf("ReadInConfig failed: %v", err)
+	}
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Version != 1 {
+		t.Errorf("Version = %d for a file without one, want 1", cfg.Version)
+	}
+}
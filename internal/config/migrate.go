@@ -0,0 +1,220 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Migration is the result of upgrading a config file to CurrentVersion
+type Migration struct {
+	From    int
+	To      int
+	Data    []byte   // the upgraded file
+	Changes []string // what was changed, one line each
+}
+
+// edit replaces n characters at a line and column of a config file, both
+// counted from 1 as the YAML parser reports them
+type edit struct {
+	line, col int
+	n         int
+	text      string
+}
+
+// migrations upgrade a config document from the version they are indexed
+// by to the next one. workDir is where relative paths were taken from.
+var migrations = map[int]func(root *yaml.Node, lines []string, workDir string) ([]edit, []string){
+	1: migrateV1,
+}
+
+// Migrate upgrades YAML config data to CurrentVersion. Only the values
+// that change are rewritten in place, so comments, blank lines, and
+// formatting are kept. Data already at CurrentVersion is returned
+// unchanged.
+func Migrate(data []byte, workDir string) (*Migration, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration: %w", err)
+	}
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	if len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("configuration must be a mapping")
+	}
+
+	m := &Migration{From: 1, To: CurrentVersion}
+	version := lookupNode(root, "version")
+	if version != nil {
+		n, err := strconv.Atoi(version.Value)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid config version %q", version.Value)
+		}
+		m.From = n
+	}
+	if m.From > CurrentVersion {
+		return nil, fmt.Errorf("config version %d is newer than this relay supports (%d)", m.From, CurrentVersion)
+	}
+	if m.From == CurrentVersion {
+		m.Data = data
+		return m, nil
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	var edits []edit
+	for v := m.From; v < CurrentVersion; v++ {
+		e, changes := migrations[v](root, lines, workDir)
+		edits = append(edits, e...)
+		m.Changes = append(m.Changes, changes...)
+	}
+
+	if version != nil {
+		edits = append(edits, replaceScalar(lines, version, strconv.Itoa(CurrentVersion)))
+	} else {
+		// Above the first key and the comment that belongs to it
+		at := len(lines)
+		if len(root.Content) > 0 {
+			first := root.Content[0]
+			at = first.Line - 1 - strings.Count(first.HeadComment, "\n")
+			if first.HeadComment != "" {
+				at--
+			}
+		} else if last := len(lines) - 1; !strings.HasSuffix(lines[last], "\n") && lines[last] != "" {
+			lines[last] += "\n"
+		}
+		lines = append(lines[:at], append([]string{fmt.Sprintf("version: %d\n\n", CurrentVersion)}, lines[at:]...)...)
+		// The inserted line moves the rest down
+		for i := range edits {
+			if edits[i].line > at {
+				edits[i].line++
+			}
+		}
+	}
+	m.Changes = append(m.Changes, fmt.Sprintf("version: set to %d", CurrentVersion))
+
+	// Later edits first, so earlier positions stay valid
+	sort.Slice(edits, func(i, j int) bool {
+		if edits[i].line != edits[j].line {
+			return edits[i].line > edits[j].line
+		}
+		return edits[i].col > edits[j].col
+	})
+	for _, e := range edits {
+		line := []rune(lines[e.line-1])
+		lines[e.line-1] = string(line[:e.col-1]) + e.text + string(line[e.col-1+e.n:])
+	}
+	m.Data = []byte(strings.Join(lines, ""))
+
+	if err := yaml.Unmarshal(m.Data, &yaml.Node{}); err != nil {
+		return nil, fmt.Errorf("migrated configuration is invalid: %w", err)
+	}
+	return m, nil
+}
+
+// migrateV1 keeps relative state file paths pointing where version 1
+// took them from, and turns connection.mqtt.topic into a topics list
+func migrateV1(root *yaml.Node, lines []string, workDir string) ([]edit, []string) {
+	var edits []edit
+	var changes []string
+	for _, p := range (&Config{}).statePaths() {
+		v := lookupNode(root, p.key)
+		if !singleLine(v) || v.Value == "" || filepath.IsAbs(v.Value) {
+			continue
+		}
+		abs := filepath.Join(workDir, v.Value)
+		edits = append(edits, replaceScalar(lines, v, quoteScalar(abs)))
+		changes = append(changes, fmt.Sprintf("%s: %s is now %s, as relative paths are taken from state_dir", p.key, v.Value, abs))
+	}
+
+	mqtt := lookupNode(root, "connection.mqtt")
+	if mqtt != nil && lookupNode(mqtt, "topics") == nil {
+		for i := 0; i+1 < len(mqtt.Content); i += 2 {
+			key, topic := mqtt.Content[i], mqtt.Content[i+1]
+			if key.Value != "topic" || !singleLine(topic) {
+				continue
+			}
+			edits = append(edits,
+				replaceScalar(lines, key, "topics"),
+				edit{line: topic.Line, col: topic.Column, text: "["},
+				edit{line: topic.Line, col: topic.Column + scalarLen(lines, topic), text: "]"})
+			changes = append(changes, "connection.mqtt.topic: moved to connection.mqtt.topics")
+			break
+		}
+	}
+	return edits, changes
+}
+
+// singleLine reports whether n is a scalar written on one line, which
+// migrations can rewrite in place
+func singleLine(n *yaml.Node) bool {
+	if n == nil || n.Kind != yaml.ScalarNode || strings.Contains(n.Value, "\n") {
+		return false
+	}
+	return n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) == 0
+}
+
+// replaceScalar returns the edit replacing a single-line scalar's value
+func replaceScalar(lines []string, n *yaml.Node, value string) edit {
+	return edit{line: n.Line, col: n.Column, n: scalarLen(lines, n), text: value}
+}
+
+// quoteScalar writes s as a YAML scalar, quoted only when it has to be
+func quoteScalar(s string) string {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return strconv.Quote(s)
+	}
+	return strings.TrimSuffix(string(data), "\n")
+}
+
+// scalarLen returns how many characters a single-line scalar takes in
+// the file, its quotes included
+func scalarLen(lines []string, n *yaml.Node) int {
+	raw := []rune(lines[n.Line-1])[n.Column-1:]
+	switch {
+	case n.Style&yaml.DoubleQuotedStyle != 0:
+		for i := 1; i < len(raw); i++ {
+			if raw[i] == '\\' {
+				i++
+			} else if raw[i] == '"' {
+				return i + 1
+			}
+		}
+	case n.Style&yaml.SingleQuotedStyle != 0:
+		for i := 1; i < len(raw); i++ {
+			if raw[i] == '\'' {
+				if i+1 < len(raw) && raw[i+1] == '\'' {
+					i++
+					continue
+				}
+				return i + 1
+			}
+		}
+	}
+	return len([]rune(n.Value))
+}
+
+// lookupNode returns the value at a dotted key path in a mapping node, or
+// nil if it is not set
+func lookupNode(n *yaml.Node, key string) *yaml.Node {
+	for _, part := range strings.Split(key, ".") {
+		if n == nil || n.Kind != yaml.MappingNode {
+			return nil
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == part {
+				next = n.Content[i+1]
+				break
+			}
+		}
+		n = next
+	}
+	return n
+}
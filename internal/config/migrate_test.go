@@ -0,0 +1,74 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	v1 := `# Relay at the fire station
+
+connection:
+  type: mqtt
+  mqtt:
+    broker: tcp://localhost:1883
+    topic: "msh/US/#"   # regional feed
+
+outputs:
+  - type: stdout
+    enabled: true
+
+# Kept across restarts
+nodedb:
+  path: nodes.json
+dedup:
+  state_file: /var/lib/relay/dedup.json
+`
+	m, err := Migrate([]byte(v1), "/srv/relay")
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	want := `# Relay at the fire station
+
+version: 2
+
+connection:
+  type: mqtt
+  mqtt:
+    broker: tcp://localhost:1883
+    topics: ["msh/US/#"]   # regional feed
+
+outputs:
+  - type: stdout
+    enabled: true
+
+# Kept across restarts
+nodedb:
+  path: /srv/relay/nodes.json
+dedup:
+  state_file: /var/lib/relay/dedup.json
+`
+	if string(m.Data) != want {
+		t.Errorf("migrated config =\n%s\nwant\n%s", m.Data, want)
+	}
+	if m.From != 1 || m.To != CurrentVersion || len(m.Changes) != 3 {
+		t.Errorf("migration = %d to %d, changes %q", m.From, m.To, m.Changes)
+	}
+
+	cfg, err := LoadYAML(m.Data)
+	if err != nil {
+		t.Fatalf("LoadYAML: %v", err)
+	}
+	if cfg.Version != CurrentVersion || cfg.NodeDB.Path != "/srv/relay/nodes.json" || cfg.Connection.MQTT.Subscriptions()["msh/US/#"] != DefaultMQTTQoS {
+		t.Errorf("migrated config loaded as version %d, nodedb %q, topics %v", cfg.Version, cfg.NodeDB.Path, cfg.Connection.MQTT.Topics)
+	}
+
+	again, err := Migrate(m.Data, "/srv/relay")
+	if err != nil || again.From != CurrentVersion || string(again.Data) != want {
+		t.Errorf("migrating a current config = %+v, %v", again, err)
+	}
+
+	if _, err := Migrate([]byte("version: 99\n"), "/"); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("Migrate of a newer config = %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-viper/mapstructure/v2"
+)
+
+// outputSchemas lists the option structs each output type reads, besides
+// OutputCommonConfig
+var outputSchemas = map[string][]interface{}{
+	"stdout":        {StdoutOutputConfig{}},
+	"file":          {FileOutputConfig{}},
+	"apprise":       {AppriseOutputConfig{}, HTTPOutputConfig{}},
+	"webhook":       {WebhookOutputConfig{}, HTTPOutputConfig{}},
+	"mqtt":          {MQTTOutputConfig{}},
+	"homeassistant": {HomeAssistantOutputConfig{}},
+	"sse":           {SSEOutputConfig{}},
+	"telegram":      {TelegramOutputConfig{}, HTTPOutputConfig{}},
+	"slack":         {SlackOutputConfig{}, HTTPOutputConfig{}},
+	"influxdb":      {InfluxDBOutputConfig{}, HTTPOutputConfig{}},
+	"tak":           {TAKOutputConfig{}},
+	"kafka":         {KafkaOutputConfig{}},
+	"nats":          {NATSOutputConfig{}},
+	"sms":           {SMSOutputConfig{}, HTTPOutputConfig{}},
+}
+
+// decodeOptions decodes an output's options into target, one of the
+// output settings structs, reporting values of the wrong type
+func decodeOptions(opts map[string]interface{}, target interface{}) error {
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(durationHook, enabledHook, listHook, uintHook),
+		Result:     target,
+	})
+	if err != nil {
+		return err
+	}
+	if err := dec.Decode(opts); err != nil {
+		var de *mapstructure.DecodeError
+		if !errors.As(err, &de) {
+			return err
+		}
+		var ute *mapstructure.UnconvertibleTypeError
+		if errors.As(de, &ute) {
+			return fmt.Errorf("%s must be %s", de.Name(), describeType(ute.Expected.Type()))
+		}
+		return fmt.Errorf("%s %v", de.Name(), de.Unwrap())
+	}
+	return nil
+}
+
+// checkOptions reports options an output's type does not read and values
+// of the wrong type
+func checkOptions(out OutputConfig, name string) error {
+	schemas := append([]interface{}{OutputCommonConfig{}}, outputSchemas[out.Type]...)
+
+	known := make(map[string]reflect.Type)
+	for _, s := range schemas {
+		for k, t := range optionFields(reflect.TypeOf(s)) {
+			known[k] = t
+		}
+	}
+	if err := checkKeys(out.Options, known, name, "known "+out.Type+" output option"); err != nil {
+		return err
+	}
+
+	for _, s := range schemas {
+		target := reflect.New(reflect.TypeOf(s)).Interface()
+		if err := decodeOptions(out.Options, target); err != nil {
+			return fmt.Errorf("%s.%w", name, err)
+		}
+	}
+	return nil
+}
+
+// checkKeys reports the first key of opts, in sorted order, that is not in
+// known, and checks the keys of nested settings
+func checkKeys(opts map[string]interface{}, known map[string]reflect.Type, name, what string) error {
+	keys := make([]string, 0, len(opts))
+	for k := range opts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		t, ok := known[k]
+		if !ok {
+			err := fmt.Sprintf("%s.%s is not a %s", name, k, what)
+			if s := closest(k, known); s != "" {
+				err += fmt.Sprintf(" (did you mean %s?)", s)
+			}
+			return errors.New(err)
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		sub, isMap := opts[k].(map[string]interface{})
+		if !isMap {
+			continue
+		}
+		switch {
+		case t.Kind() == reflect.Struct:
+			if err := checkKeys(sub, optionFields(t), name+"."+k, "known option"); err != nil {
+				return err
+			}
+		case t.Kind() == reflect.Map && t.Elem().Kind() == reflect.Struct:
+			for entry, v := range sub {
+				if m, ok := v.(map[string]interface{}); ok {
+					if err := checkKeys(m, optionFields(t.Elem()), name+"."+k+"."+entry, "known option"); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// optionFields returns the keys of an options struct with their types,
+// including those of squashed structs
+func optionFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, opts, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if opts == "squash" {
+			for k, ft := range optionFields(f.Type) {
+				fields[k] = ft
+			}
+			continue
+		}
+		if tag != "" && tag != "-" {
+			fields[tag] = f.Type
+		}
+	}
+	return fields
+}
+
+// closest returns the known key within two edits of key, if there is one
+func closest(key string, known map[string]reflect.Type) string {
+	best, bestDist := "", 3
+	for k := range known {
+		if d := editDistance(key, k); d < bestDist || (d == bestDist && k < best) {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// describeType names what a value of type t is written as in the config
+func describeType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a whole number"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice:
+		return "a list"
+	}
+	return "a map"
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// durationHook reads durations the way outputs do: as strings such as 30s
+func durationHook(f, t reflect.Type, data interface{}) (interface{}, error) {
+	if t != durationType {
+		return data, nil
+	}
+	s, ok := data.(string)
+	if !ok {
+		return nil, fmt.Errorf("must be a duration such as 30s")
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, fmt.Errorf("must be a duration such as 30s")
+	}
+	return d, nil
+}
+
+// enabledHook reads true or false given for settings with an enabled
+// option, such as the transforms, as that option
+func enabledHook(f, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.Bool || t.Kind() != reflect.Struct {
+		return data, nil
+	}
+	if _, ok := optionFields(t)["enabled"]; !ok {
+		return data, nil
+	}
+	return map[string]interface{}{"enabled": data}, nil
+}
+
+// listHook reads a single string given for a list of strings as a list of
+// one
+func listHook(f, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t.Kind() != reflect.Slice || t.Elem().Kind() != reflect.String {
+		return data, nil
+	}
+	return []string{data.(string)}, nil
+}
+
+// uintHook reads numbers used as map keys, such as Apprise channels, which
+// the config file gives as strings
+func uintHook(f, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String {
+		return data, nil
+	}
+	switch t.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(data.(string), 10, t.Bits())
+		if err != nil {
+			return nil, fmt.Errorf("must be a whole number")
+		}
+		return n, nil
+	}
+	return data, nil
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+)
+
+// NoProxy is the proxy value that connects directly, overriding the global
+// proxy and the proxy environment variables
+const NoProxy = "none"
+
+// ProxyOutputTypes are the output types that accept a proxy option: the
+// HTTP outputs and the MQTT ones
+var ProxyOutputTypes = []string{"apprise", "webhook", "telegram", "slack", "influxdb", "sms", "mqtt", "homeassistant"}
+
+// ParseProxy parses a proxy URL: http://, https://, socks5://, or
+// socks5h://, with optional user:password. It returns nil for NoProxy.
+func ParseProxy(raw string) (*url.URL, error) {
+	if raw == NoProxy {
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("proxy must be an http, https, socks5, or socks5h url, or %s", NoProxy)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy url has no host")
+	}
+	return u, nil
+}
+
+// inheritProxy gives outputs that take a proxy and do not set one the
+// global proxy, including their fallbacks
+func inheritProxy(opts map[string]interface{}, proxy string) {
+	if typ, _ := opts["type"].(string); slices.Contains(ProxyOutputTypes, typ) {
+		if _, ok := opts["proxy"]; !ok {
+			opts["proxy"] = proxy
+		}
+	}
+	switch fb := opts["fallback"].(type) {
+	case map[string]interface{}:
+		inheritProxy(fb, proxy)
+	case []interface{}:
+		for _, e := range fb {
+			if m, ok := e.(map[string]interface{}); ok {
+				inheritProxy(m, proxy)
+			}
+		}
+	}
+}
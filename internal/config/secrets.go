@@ -0,0 +1,163 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+)
+
+// envRef matches ${NAME} and ${NAME:-default} in config values; $${ is a
+// literal ${
+var envRef = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// fileOptions are the options ending in _file that name a file the relay
+// keeps rather than one to read a secret from
+var fileOptions = map[string]bool{
+	"state_file":    true,
+	"sequence_file": true,
+}
+
+// ReadInConfig finds and reads the config file as viper.ReadInConfig does.
+// Its secrets are resolved by Load, so commands that tolerate a missing
+// config file still report secrets that cannot be resolved.
+func ReadInConfig() error {
+	return viper.ReadInConfig()
+}
+
+// resolveConfigFile rereads the config file viper found with its secrets
+// resolved: ${NAME} in values is replaced with the environment variable,
+// and an option such as password_file is replaced with password set to
+// the file's contents. Relative secret files are taken from the config
+// file's directory. Without a config file, or with one in a format other
+// than YAML, viper's settings are left as read. It reports whether there
+// was a config file.
+func resolveConfigFile() (bool, error) {
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		return false, nil
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext != ".yaml" && ext != ".yml" && ext != "" {
+		return true, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return true, err
+	}
+	resolved, err := ResolveSecrets(data, filepath.Dir(path))
+	if err != nil {
+		return true, fmt.Errorf("%s: %w", path, err)
+	}
+	return true, viper.ReadConfig(bytes.NewReader(resolved))
+}
+
+// ResolveSecrets expands environment variables in the values of YAML
+// config data and reads the secrets named by _file options, relative to
+// dir. Comments are dropped from the result.
+func ResolveSecrets(data []byte, dir string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return data, nil
+	}
+	if err := resolveNode(doc.Content[0], "", dir); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(&doc)
+}
+
+// resolveNode resolves the secrets in n, the value at path
+func resolveNode(n *yaml.Node, path, dir string) error {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		expandScalar(n)
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			if err := resolveNode(c, fmt.Sprintf("%s[%d]", path, i), dir); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		keys := make(map[string]bool, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			keys[n.Content[i].Value] = true
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			name := joinPath(path, key.Value)
+			if err := resolveNode(value, name, dir); err != nil {
+				return err
+			}
+			base, isFile := strings.CutSuffix(key.Value, "_file")
+			if !isFile || base == "" || fileOptions[key.Value] || value.Kind != yaml.ScalarNode {
+				continue
+			}
+			if keys[base] {
+				return fmt.Errorf("%s and %s are both set", joinPath(path, base), name)
+			}
+			secret, err := readSecret(value.Value, dir)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			key.Value = base
+			value.Value, value.Tag, value.Style = secret, "!!str", 0
+		}
+	}
+	return nil
+}
+
+// expandScalar replaces environment variable references in a scalar. A
+// plain scalar is typed by what it expands to, so "port: ${PORT}" reads
+// as a number.
+func expandScalar(n *yaml.Node) {
+	if !strings.Contains(n.Value, "${") {
+		return
+	}
+	n.Value = envRef.ReplaceAllStringFunc(n.Value, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+		m := envRef.FindStringSubmatch(ref)
+		if v, ok := os.LookupEnv(m[1]); ok && v != "" {
+			return v
+		}
+		return strings.TrimPrefix(m[2], ":-")
+	})
+	if n.Style == 0 {
+		n.Tag = ""
+	}
+}
+
+// readSecret reads a secret file, without its trailing newline
+func readSecret(path, dir string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("no file given")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
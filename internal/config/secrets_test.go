@@ -0,0 +1,112 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "mqtt_password"), []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("RELAY_TEST_TOKEN", "abc123")
+	t.Setenv("RELAY_TEST_PORT", "4404")
+	t.Setenv("RELAY_TEST_SECRETS", dir)
+	t.Setenv("RELAY_TEST_ODD", "p@ss: #1")
+
+	data := []byte(`
+connection:
+  tcp:
+    port: ${RELAY_TEST_PORT}
+  mqtt:
+    username: relay
+    password_file: mqtt_password
+dedup:
+  state_file: dedup.json
+outputs:
+  - type: telegram
+    bot_token: "${RELAY_TEST_TOKEN}"
+    chat_id: ${RELAY_TEST_UNSET:-42}
+    api_key_file: ${RELAY_TEST_SECRETS}/mqtt_password
+    template: "cost: $${price}"
+    auth_token: ${RELAY_TEST_ODD}
+`)
+	resolved, err := ResolveSecrets(data, dir)
+	if err != nil {
+		t.Fatalf("ResolveSecrets failed: %v", err)
+	}
+	var got map[string]interface{}
+	if err := yaml.Unmarshal(resolved, &got); err != nil {
+		t.Fatalf("resolved data is not YAML: %v\n%s", err, resolved)
+	}
+
+	conn := got["connection"].(map[string]interface{})
+	if port := conn["tcp"].(map[string]interface{})["port"]; port != 4404 {
+		t.Errorf("port = %#v, want the number 4404", port)
+	}
+	mqtt := conn["mqtt"].(map[string]interface{})
+	if mqtt["password"] != "hunter2" || mqtt["password_file"] != nil {
+		t.Errorf("mqtt = %v", mqtt)
+	}
+	if f := got["dedup"].(map[string]interface{})["state_file"]; f != "dedup.json" {
+		t.Errorf("state_file = %v, want it kept as a path", f)
+	}
+	out := got["outputs"].([]interface{})[0].(map[string]interface{})
+	if out["bot_token"] != "abc123" || out["chat_id"] != 42 || out["api_key"] != "hunter2" || out["auth_token"] != "p@ss: #1" {
+		t.Errorf("output = %v", out)
+	}
+	if out["template"] != "cost: ${price}" {
+		t.Errorf("template = %q, want the escaped reference kept", out["template"])
+	}
+}
+
+func TestResolveSecretsErrors(t *testing.T) {
+	for name, data := range map[string]string{
+		"missing file": "connection:\n  mqtt:\n    password_file: /nonexistent/secret\n",
+		"both set":     "api:\n  token: abc\n  token_file: token\n",
+	} {
+		_, err := ResolveSecrets([]byte(data), t.TempDir())
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+			continue
+		}
+		if !strings.Contains(err.Error(), "token") && !strings.Contains(err.Error(), "password_file") {
+			t.Errorf("%s: error %q does not name the option", name, err)
+		}
+	}
+}
+
+func TestLoadResolvesConfigFileSecrets(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("api:\n  token_file: token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(path)
+	if err := ReadInConfig(); err != nil {
+		t.Fatalf("ReadInConfig failed: %v", err)
+	}
+
+	// Each Load reports the secrets it cannot resolve, and nothing is
+	// left over from an earlier one
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "api.token_file") {
+		t.Errorf("Load without the secret file = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "token"), []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.API.Token != "s3cret" {
+		t.Errorf("api.token = %q", cfg.API.Token)
+	}
+}
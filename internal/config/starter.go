@@ -0,0 +1,140 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// StarterOutputs are the output types a starter config can include
+var StarterOutputs = []string{"stdout", "file", "apprise", "webhook", "mqtt", "telegram", "slack"}
+
+// StarterOptions are the choices for a starter config
+type StarterOptions struct {
+	Connection string // serial, tcp, or mqtt
+	SerialPort string
+	TCPHost    string
+	MQTTBroker string
+	MQTTTopic  string
+	Outputs    []string // from StarterOutputs
+}
+
+// DefaultStarterOptions returns the choices used when none are made
+func DefaultStarterOptions() StarterOptions {
+	d := DefaultConfig()
+	return StarterOptions{
+		Connection: "serial",
+		SerialPort: "/dev/ttyUSB0",
+		TCPHost:    "meshtastic.local",
+		MQTTBroker: "tcp://localhost:1883",
+		MQTTTopic:  d.Connection.MQTT.Topic,
+		Outputs:    []string{"stdout"},
+	}
+}
+
+// Starter returns a commented starter config file for opts. Credentials
+// are left as ${NAME} references to environment variables.
+func Starter(opts StarterOptions) ([]byte, error) {
+	switch opts.Connection {
+	case "serial", "tcp", "mqtt":
+	default:
+		return nil, fmt.Errorf("connection type must be serial, tcp, or mqtt")
+	}
+	if len(opts.Outputs) == 0 {
+		return nil, fmt.Errorf("at least one output is required")
+	}
+	seen := make(map[string]bool)
+	for _, out := range opts.Outputs {
+		if !slices.Contains(StarterOutputs, out) {
+			return nil, fmt.Errorf("unknown output %q (choose from %s)", out, strings.Join(StarterOutputs, ", "))
+		}
+		if seen[out] {
+			return nil, fmt.Errorf("output %q given twice", out)
+		}
+		seen[out] = true
+	}
+
+	var buf bytes.Buffer
+	data := struct {
+		StarterOptions
+		Version int
+	}{opts, CurrentVersion}
+	if err := starterTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var starterTemplate = template.Must(template.New("starter").Parse(`# Meshtastic Message Relay configuration
+# See configs/example.yaml for every setting. Credentials are read from
+# environment variables ("${NAME}") or files (add _file to an option's
+# name) so they stay out of this file.
+version: {{.Version}}
+
+connection:
+  type: {{.Connection}}
+{{- if eq .Connection "serial"}}
+  serial:
+    port: {{printf "%q" .SerialPort}}
+    baud: 115200
+{{- else if eq .Connection "tcp"}}
+  tcp:
+    host: {{printf "%q" .TCPHost}}
+    port: 4403
+{{- else}}
+  mqtt:
+    broker: {{printf "%q" .MQTTBroker}}
+    topic: {{printf "%q" .MQTTTopic}}
+    # username: relay
+    # password: "${MQTT_PASSWORD}"
+{{- end}}
+
+outputs:
+{{- range .Outputs}}
+{{- if eq . "stdout"}}
+  - type: stdout
+    enabled: true
+    format: text  # json or text
+{{- else if eq . "file"}}
+  - type: file
+    enabled: true
+    path: /var/log/meshtastic/messages.log
+    format: json
+    rotate: true
+    max_size_mb: 100
+    max_backups: 5
+{{- else if eq . "apprise"}}
+  - type: apprise
+    enabled: true
+    url: "${APPRISE_URL:-http://localhost:8000/notify}"
+    tag: meshtastic
+{{- else if eq . "webhook"}}
+  - type: webhook
+    enabled: true
+    url: "${WEBHOOK_URL}"
+    method: POST
+{{- else if eq . "mqtt"}}
+  - type: mqtt
+    enabled: true
+    broker: tcp://localhost:1883
+    topic: meshtastic-relay
+    # username: relay
+    # password: "${MQTT_PASSWORD}"
+{{- else if eq . "telegram"}}
+  - type: telegram
+    enabled: true
+    bot_token: "${TELEGRAM_BOT_TOKEN}"
+    chat_id: "${TELEGRAM_CHAT_ID}"
+{{- else if eq . "slack"}}
+  - type: slack
+    enabled: true
+    webhook_url: "${SLACK_WEBHOOK_URL}"
+{{- end}}
+{{- end}}
+
+logging:
+  level: info
+  format: text
+`))
@@ -0,0 +1,55 @@
+package config
+
+import "testing"
+
+func TestStarterLoads(t *testing.T) {
+	t.Setenv("WEBHOOK_URL", "https://example.com/hook")
+	t.Setenv("TELEGRAM_BOT_TOKEN", "123:abc")
+	t.Setenv("TELEGRAM_CHAT_ID", "-100")
+	t.Setenv("SLACK_WEBHOOK_URL", "https://hooks.slack.com/services/T/B/X")
+
+	for _, conn := range []string{"serial", "tcp", "mqtt"} {
+		opts := DefaultStarterOptions()
+		opts.Connection = conn
+		opts.Outputs = StarterOutputs
+		data, err := Starter(opts)
+		if err != nil {
+			t.Fatalf("%s: Starter: %v", conn, err)
+		}
+		cfg, err := LoadYAML(data)
+		if err != nil {
+			t.Fatalf("%s: LoadYAML: %v\n%s", conn, err, data)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("%s: Validate: %v\n%s", conn, err, data)
+		}
+		if cfg.Version != CurrentVersion || cfg.Connection.Type != conn || len(cfg.Outputs) != len(StarterOutputs) {
+			t.Errorf("%s: loaded %+v", conn, cfg)
+		}
+	}
+
+	opts := DefaultStarterOptions()
+	opts.Connection = "tcp"
+	opts.TCPHost = "10.0.0.5"
+	data, _ := Starter(opts)
+	cfg, err := LoadYAML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Connection.TCP.Host != "10.0.0.5" || cfg.Outputs[0].Type != "stdout" {
+		t.Errorf("tcp starter = %+v", cfg)
+	}
+}
+
+func TestStarterRejects(t *testing.T) {
+	for name, opts := range map[string]StarterOptions{
+		"connection": {Connection: "ble", Outputs: []string{"stdout"}},
+		"no outputs": {Connection: "serial"},
+		"unknown":    {Connection: "serial", Outputs: []string{"fax"}},
+		"twice":      {Connection: "serial", Outputs: []string{"stdout", "stdout"}},
+	} {
+		if _, err := Starter(opts); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
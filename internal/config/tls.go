@@ -0,0 +1,78 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TLSConfig defines TLS settings for connecting to a broker or TCP endpoint.
+type TLSConfig struct {
+	CACert             string `mapstructure:"ca_cert"`     // PEM file; system roots if empty
+	ClientCert         string `mapstructure:"client_cert"` // PEM file, for mutual TLS
+	ClientKey          string `mapstructure:"client_key"`  // PEM file, for mutual TLS
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+	ServerName         string `mapstructure:"server_name"` // overrides the host name to verify
+}
+
+// TCPTLSConfig defines TLS settings for a TCP connection. Unlike a broker
+// URL, a host and port carry no scheme, so TLS is switched on explicitly.
+type TCPTLSConfig struct {
+	Enabled   bool `mapstructure:"enabled"`
+	TLSConfig `mapstructure:",squash"`
+}
+
+// IsSet reports whether any TLS setting was given
+func (c *TLSConfig) IsSet() bool {
+	return *c != TLSConfig{}
+}
+
+// Load builds a tls.Config, reading the certificate files
+func (c *TLSConfig) Load() (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.InsecureSkipVerify, //nolint:gosec // opt-in for self-signed test brokers
+		ServerName:         c.ServerName,
+	}
+
+	if c.CACert != "" {
+		pem, err := os.ReadFile(c.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca_cert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca_cert %s", c.CACert)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if (c.ClientCert == "") != (c.ClientKey == "") {
+		return nil, fmt.Errorf("client_cert and client_key must be set together")
+	}
+	if c.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
+
+// IsTLSBroker reports whether a broker URL uses a scheme the MQTT client
+// connects to over TLS
+func IsTLSBroker(broker string) bool {
+	scheme, _, ok := strings.Cut(broker, "://")
+	if !ok {
+		return false
+	}
+	switch strings.ToLower(scheme) {
+	case "ssl", "tls", "mqtts", "mqtt+ssl", "tcps", "wss":
+		return true
+	}
+	return false
+}
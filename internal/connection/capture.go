@@ -0,0 +1,25 @@
+package connection
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/capture"
+)
+
+// captureConfigurer is implemented by connections that can record raw
+// frames from the device to a capture file
+type captureConfigurer interface {
+	configureCapture(path string) error
+}
+
+func (s *stream) configureCapture(path string) error {
+	w, err := capture.Create(path)
+	if err != nil {
+		return err
+	}
+	s.dump.mu.Lock()
+	s.dump.capture = w
+	s.dump.mu.Unlock()
+	s.logger.Info("Capturing raw frames", zap.String("capture", path))
+	return nil
+}
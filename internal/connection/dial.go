@@ -0,0 +1,209 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DefaultFallbackDelay is how long a connection attempt gets before the
+// next address is tried alongside it, as recommended by RFC 8305
+const DefaultFallbackDelay = 250 * time.Millisecond
+
+// dialer connects to hostnames with several A and AAAA records using Happy
+// Eyeballs: addresses are tried in order alternating between IPv6 and
+// IPv4, each attempt starting when the previous one fails or has had
+// fallbackDelay, and the first to connect wins.
+type dialer struct {
+	timeout       time.Duration
+	fallbackDelay time.Duration
+	// iface is the source interface name or address; empty lets the
+	// system choose
+	iface string
+}
+
+// dialResult is the outcome of one connection attempt
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// DialContext connects to a host:port address
+func (d *dialer) DialContext(ctx context.Context, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	local4, local6, err := d.sourceAddrs()
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	// Only families the source interface can reach
+	if d.iface != "" {
+		usable := ips[:0]
+		for _, ip := range ips {
+			if ip.To4() != nil && local4 != nil || ip.To4() == nil && local6 != nil {
+				usable = append(usable, ip)
+			}
+		}
+		if len(usable) == 0 {
+			return nil, fmt.Errorf("%s has no address reachable from %s", host, d.iface)
+		}
+		ips = usable
+	}
+	ips = interleave(ips)
+
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult, len(ips))
+	attempt := func(ip net.IP) {
+		nd := net.Dialer{KeepAlive: 30 * time.Second}
+		local := local4
+		if ip.To4() == nil {
+			local = local6
+		}
+		if local != nil {
+			nd.LocalAddr = &net.TCPAddr{IP: local}
+		}
+		conn, err := nd.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), port))
+		results <- dialResult{conn, err}
+	}
+
+	var errs []error
+	started, pending := 0, 0
+	next := time.NewTimer(0)
+	defer next.Stop()
+	for {
+		select {
+		case <-next.C:
+			if started < len(ips) {
+				go attempt(ips[started])
+				started++
+				pending++
+				next.Reset(d.fallbackDelay)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				// Close connections that lose the race
+				cancel()
+				go func(n int) {
+					for ; n > 0; n-- {
+						if late := <-results; late.conn != nil {
+							_ = late.conn.Close()
+						}
+					}
+				}(pending)
+				return res.conn, nil
+			}
+			errs = append(errs, res.err)
+			if started < len(ips) {
+				// A failure starts the next attempt right away
+				next.Reset(0)
+			} else if pending == 0 {
+				return nil, fmt.Errorf("failed to connect to %s: %w", addr, errors.Join(errs...))
+			}
+		}
+	}
+}
+
+// lookup resolves host to its addresses; IP literals are used as is
+func (d *dialer) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, a := range addrs {
+		ips[i] = a.IP
+	}
+	return ips, nil
+}
+
+// sourceAddrs returns the IPv4 and IPv6 source addresses for the
+// configured interface, which may be an interface name or an address
+func (d *dialer) sourceAddrs() (net.IP, net.IP, error) {
+	if d.iface == "" {
+		return nil, nil, nil
+	}
+	if ip := net.ParseIP(d.iface); ip != nil {
+		if ip.To4() != nil {
+			return ip, nil, nil
+		}
+		return nil, ip, nil
+	}
+
+	ifi, err := net.InterfaceByName(d.iface)
+	if err != nil {
+		return nil, nil, fmt.Errorf("source interface: %w", err)
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, nil, fmt.Errorf("source interface %s: %w", d.iface, err)
+	}
+	var local4, local6 net.IP
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipNet.IP
+		switch {
+		case ip.To4() != nil:
+			if local4 == nil {
+				local4 = ip
+			}
+		// Link-local addresses need a zone and cannot reach other
+		// networks
+		case !ip.IsLinkLocalUnicast():
+			if local6 == nil {
+				local6 = ip
+			}
+		}
+	}
+	if local4 == nil && local6 == nil {
+		return nil, nil, fmt.Errorf("source interface %s has no usable address", d.iface)
+	}
+	return local4, local6, nil
+}
+
+// interleave orders addresses alternating between families, starting with
+// the family of the first address, keeping the resolver's order within
+// each family (RFC 8305 section 4)
+func interleave(ips []net.IP) []net.IP {
+	var first, second []net.IP
+	for _, ip := range ips {
+		if (ip.To4() == nil) == (ips[0].To4() == nil) {
+			first = append(first, ip)
+		} else {
+			second = append(second, ip)
+		}
+	}
+	out := make([]net.IP, 0, len(ips))
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			out = append(out, first[i])
+		}
+		if i < len(second) {
+			out = append(out, second[i])
+		}
+	}
+	return out
+}
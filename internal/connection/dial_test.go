@@ -0,0 +1,62 @@
+package connection
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestInterleave(t *testing.T) {
+	ips := []net.IP{
+		net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), net.ParseIP("2001:db8::3"),
+		net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2"),
+	}
+	want := []string{"2001:db8::1", "192.0.2.1", "2001:db8::2", "192.0.2.2", "2001:db8::3"}
+	got := interleave(ips)
+	if len(got) != len(want) {
+		t.Fatalf("interleave = %v", got)
+	}
+	for i := range want {
+		if got[i].String() != want[i] {
+			t.Errorf("interleave[%d] = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDialerSourceAddress(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	d := &dialer{timeout: time.Second, fallbackDelay: DefaultFallbackDelay, iface: "127.0.0.1"}
+	conn, err := d.DialContext(ctx, net.JoinHostPort("localhost", port))
+	if err != nil {
+		t.Fatalf("DialContext: %v", err)
+	}
+	if local := conn.LocalAddr().(*net.TCPAddr).IP; !local.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("local address = %s", local)
+	}
+	_ = conn.Close()
+
+	// An IPv4 source cannot reach an IPv6 address
+	if _, err := d.DialContext(ctx, net.JoinHostPort("::1", port)); err == nil {
+		t.Error("dialed ::1 from an IPv4 source")
+	}
+}
@@ -9,14 +9,42 @@ import (
 
 // New creates a new Connection based on the configuration
 func New(cfg *config.ConnectionConfig) (Connection, error) {
+	var conn Connection
+	var err error
 	switch cfg.Type {
 	case "serial":
-		return NewSerial(cfg.Serial)
+		conn, err = NewSerial(cfg.Serial)
 	case "tcp":
-		return NewTCP(cfg.TCP)
+		conn, err = NewTCP(cfg.TCP)
 	case "mqtt":
-		return NewMQTT(&cfg.MQTT)
+		conn, err = NewMQTT(&cfg.MQTT)
 	default:
 		return nil, fmt.Errorf("unknown connection type: %s", cfg.Type)
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p, ok := conn.(pkiConfigurer); ok {
+		if err := p.configurePKI(cfg.PKI); err != nil {
+			return nil, fmt.Errorf("invalid pki config: %w", err)
+		}
+	}
+	if h, ok := conn.(hexdumpConfigurer); ok && cfg.Hexdump != "" {
+		if err := h.configureHexdump(cfg.Hexdump); err != nil {
+			return nil, err
+		}
+	}
+	if c, ok := conn.(captureConfigurer); ok && cfg.Capture != "" {
+		if err := c.configureCapture(cfg.Capture); err != nil {
+			return nil, err
+		}
+	}
+	if c, ok := conn.(configRequester); ok {
+		c.configureConfigTimeout(cfg.ConfigTimeout)
+	}
+	if c, ok := conn.(safeModeConfigurer); ok && cfg.SafeMode {
+		c.configureSafeMode()
+	}
+	return conn, nil
 }
@@ -0,0 +1,123 @@
+package connection
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/capture"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+// hexdumpConfigurer is implemented by connections that can record raw
+// frames from the device
+type hexdumpConfigurer interface {
+	configureHexdump(path string) error
+}
+
+// recentFrameCount is how many raw frames are kept in memory for support
+// bundles
+const recentFrameCount = 200
+
+// RawFrame is a FromRadio frame as received from the device
+type RawFrame struct {
+	Seq  uint64    `json:"seq"`
+	At   time.Time `json:"at"`
+	Data []byte    `json:"data"`
+}
+
+// frameDump keeps the latest raw FromRadio frames, and appends them to a
+// file as annotated hexdumps and to a capture file when configured
+type frameDump struct {
+	mu      sync.Mutex
+	file    *os.File
+	capture *capture.Writer
+	seq     uint64
+	recent  []RawFrame
+	next    int
+}
+
+func (s *stream) configureHexdump(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open hexdump file: %w", err)
+	}
+	s.dump.mu.Lock()
+	s.dump.file = f
+	s.dump.mu.Unlock()
+	s.logger.Info("Recording raw frames", zap.String("hexdump", path))
+	return nil
+}
+
+// dumpFrame records a frame read from the device
+func (s *stream) dumpFrame(frame []byte) {
+	d := &s.dump
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.seq++
+	now := time.Now().UTC()
+	rf := RawFrame{Seq: d.seq, At: now, Data: append([]byte(nil), frame...)}
+	if len(d.recent) < recentFrameCount {
+		d.recent = append(d.recent, rf)
+	} else {
+		d.recent[d.next] = rf
+		d.next = (d.next + 1) % recentFrameCount
+	}
+
+	if d.capture != nil {
+		if err := d.capture.Write(now, frame); err != nil {
+			s.logger.Warn("Failed to write capture; recording stopped", zap.Error(err))
+			_ = d.capture.Close()
+			d.capture = nil
+		}
+	}
+
+	if d.file == nil {
+		return
+	}
+	_, err := fmt.Fprintf(d.file, "# frame %d, %d bytes, %s\n", d.seq, len(frame), now.Format(time.RFC3339Nano))
+	if err == nil {
+		err = meshtastic.WriteHexdump(d.file, frame)
+	}
+	if err == nil {
+		_, err = d.file.WriteString("\n")
+	}
+	if err != nil {
+		s.logger.Warn("Failed to write hexdump; recording stopped", zap.Error(err))
+		_ = d.file.Close()
+		d.file = nil
+	}
+}
+
+// RecentFrames returns up to n of the latest frames received, oldest
+// first. A limit of zero or less returns all that are kept.
+func (s *stream) RecentFrames(n int) []RawFrame {
+	d := &s.dump
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	frames := append(append([]RawFrame{}, d.recent[d.next:]...), d.recent[:d.next]...)
+	if n > 0 && n < len(frames) {
+		frames = frames[len(frames)-n:]
+	}
+	return frames
+}
+
+// closeDump stops recording frames to the hexdump and capture files
+func (s *stream) closeDump() {
+	d := &s.dump
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.file != nil {
+		_ = d.file.Close()
+		d.file = nil
+	}
+	if d.capture != nil {
+		if err := d.capture.Close(); err != nil {
+			s.logger.Warn("Failed to close capture", zap.Error(err))
+		}
+		d.capture = nil
+	}
+}
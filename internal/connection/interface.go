@@ -2,8 +2,11 @@ package connection
 
 import (
 	"context"
+	"sort"
+	"time"
 
 	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
 )
 
 // Connection defines the interface for Meshtastic node connections.
@@ -31,3 +34,98 @@ type Connection interface {
 	// IsConnected returns true if the connection is currently active.
 	IsConnected() bool
 }
+
+// NodeDirectory is implemented by connections that track the nodes heard
+// on the mesh.
+type NodeDirectory interface {
+	// GetNodeInfo returns the known info for a node, or nil.
+	GetNodeInfo(nodeNum uint32) *meshtastic.NodeInfo
+
+	// Nodes returns all known nodes ordered by node number.
+	Nodes() []*meshtastic.NodeInfo
+}
+
+// LocalNode is implemented by connections attached to a device that
+// reports its own node number (serial and TCP).
+type LocalNode interface {
+	// GetMyInfo returns the attached device's info, or nil until it is known.
+	GetMyInfo() *meshtastic.MyNodeInfo
+}
+
+// Activity is implemented by connections that can tell when the device
+// last sent anything (serial and TCP), so a link that stays open but has
+// gone silent can be detected.
+type Activity interface {
+	// LastFrame returns when the last frame was received, or the zero
+	// time if none has been since connecting.
+	LastFrame() time.Time
+}
+
+// ConfigState is implemented by connections that request the device's
+// configuration on connect (serial and TCP).
+type ConfigState interface {
+	// ConfigComplete reports whether the device has finished sending its
+	// configuration, node DB included, since connecting.
+	ConfigComplete() bool
+}
+
+// FrameHistory is implemented by connections that keep the latest raw
+// frames received from the device (serial and TCP).
+type FrameHistory interface {
+	// RecentFrames returns up to n of the latest frames, oldest first, or
+	// all that are kept if n is zero or less.
+	RecentFrames(n int) []RawFrame
+}
+
+// DeviceInfo is implemented by connections attached to a device that
+// reports its metadata (serial and TCP).
+type DeviceInfo interface {
+	// Metadata returns the device's firmware and capabilities, or nil until
+	// they are known.
+	Metadata() *meshtastic.DeviceMetadata
+}
+
+// nodeList returns the nodes in db ordered by node number
+func nodeList(db map[uint32]*meshtastic.NodeInfo) []*meshtastic.NodeInfo {
+	nodes := make([]*meshtastic.NodeInfo, 0, len(db))
+	for _, n := range db {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Num < nodes[j].Num })
+	return nodes
+}
+
+// XModemTransport is implemented by connections that can exchange XModem
+// file transfer packets with the device (serial and TCP).
+type XModemTransport interface {
+	// SendXModem writes an XModem packet to the device.
+	SendXModem(pkt *meshtastic.XModem) error
+
+	// XModemPackets returns a channel of XModem packets sent by the device.
+	XModemPackets() <-chan *meshtastic.XModem
+}
+
+// AdminTransport is implemented by connections that can exchange admin
+// messages with the locally attached device (serial and TCP).
+type AdminTransport interface {
+	// AdminRequest sends an admin message and waits for the device's response.
+	AdminRequest(ctx context.Context, msg *meshtastic.AdminMessage) (*meshtastic.AdminMessage, error)
+
+	// SendAdmin sends an admin message without waiting for a response.
+	SendAdmin(ctx context.Context, msg *meshtastic.AdminMessage) error
+}
+
+// AckTransport is implemented by connections that can wait for the mesh
+// to acknowledge a packet (serial and TCP).
+type AckTransport interface {
+	// SendAndWaitAck sends a packet with want_ack set and blocks until the
+	// destination acknowledges it, the mesh reports a failure, or ctx ends.
+	SendAndWaitAck(ctx context.Context, packet *message.Packet) (Ack, error)
+}
+
+// Ack is the destination's acknowledgement of a want_ack packet
+type Ack struct {
+	// Hops is how many times the ack was relayed on its way back, or -1
+	// when the destination's firmware does not report it
+	Hops int
+}
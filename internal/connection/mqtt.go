@@ -14,6 +14,7 @@ import (
 	"github.com/iamruinous/meshtastic-message-relay/internal/config"
 	"github.com/iamruinous/meshtastic-message-relay/internal/logging"
 	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/proxy"
 	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
 )
 
@@ -23,6 +24,7 @@ type MQTT struct {
 	client   mqtt.Client
 	messages chan *message.Packet
 	nodeDB   map[uint32]*meshtastic.NodeInfo
+	pki      pkiKeys
 	logger   *zap.Logger
 
 	mu        sync.RWMutex
@@ -51,8 +53,7 @@ func (m *MQTT) Connect(_ context.Context) error {
 	}
 
 	m.logger.Info("Connecting to MQTT broker",
-		zap.String("broker", m.config.Broker),
-		zap.String("topic", m.config.Topic))
+		zap.String("broker", m.config.Broker))
 
 	// Generate client ID if not provided
 	clientID := m.config.ClientID
@@ -76,6 +77,20 @@ func (m *MQTT) Connect(_ context.Context) error {
 	if m.config.Password != "" {
 		opts.SetPassword(m.config.Password)
 	}
+	if m.config.TLS.IsSet() {
+		tlsCfg, err := m.config.TLS.Load()
+		if err != nil {
+			return fmt.Errorf("invalid mqtt tls config: %w", err)
+		}
+		opts.SetTLSConfig(tlsCfg)
+	}
+	if m.config.Proxy != "" {
+		u, err := config.ParseProxy(m.config.Proxy)
+		if err != nil {
+			return fmt.Errorf("invalid mqtt proxy: %w", err)
+		}
+		opts.SetCustomOpenConnectionFn(proxy.MQTT(u))
+	}
 
 	// Create and connect client
 	client := mqtt.NewClient(opts)
@@ -99,10 +114,11 @@ func (m *MQTT) Connect(_ context.Context) error {
 
 // onConnect is called when the MQTT connection is established
 func (m *MQTT) onConnect(client mqtt.Client) {
-	m.logger.Info("MQTT connected, subscribing to topic", zap.String("topic", m.config.Topic))
+	subs := m.config.Subscriptions()
+	m.logger.Info("MQTT connected, subscribing to topics", zap.Any("topics", subs))
 
-	// Subscribe to the topic
-	token := client.Subscribe(m.config.Topic, 1, m.messageHandler)
+	// Subscribe to all topics; handled messages are the same for each
+	token := client.SubscribeMultiple(subs, m.messageHandler)
 	if token.Wait() && token.Error() != nil {
 		m.logger.Error("Failed to subscribe", zap.Error(token.Error()))
 		return
@@ -112,7 +128,7 @@ func (m *MQTT) onConnect(client mqtt.Client) {
 	m.connected = true
 	m.mu.Unlock()
 
-	m.logger.Info("Subscribed to topic")
+	m.logger.Info("Subscribed to topics", zap.Int("count", len(subs)))
 }
 
 // onConnectionLost is called when the MQTT connection is lost
@@ -181,6 +197,10 @@ func (m *MQTT) parseMessage(topic string, payload []byte) *message.Packet {
 			packet.ReceivedAt = time.Unix(jsonMsg.RxTime, 0)
 		}
 
+		// JSON topics are msh/<region>/2/json/<channel>/<gateway>
+		packet.GatewayID = jsonMsg.Sender
+		packet.ChannelName = topicChannel(topic)
+
 		// Parse port number from type or topic
 		packet.PortNum = m.parsePortNum(jsonMsg.Type, topic)
 
@@ -199,10 +219,15 @@ func (m *MQTT) parseMessage(topic string, payload []byte) *message.Packet {
 		return packet
 	}
 
-	// Try to parse as protobuf (binary format)
-	// This handles the native Meshtastic MQTT format
+	// Native Meshtastic MQTT publishes ServiceEnvelopes
+	if env, err := meshtastic.ParseServiceEnvelope(payload); err == nil {
+		return m.parseEnvelope(env)
+	}
+
+	// Some bridges publish bare FromRadio protobufs
 	fromRadio, err := meshtastic.ParseFromRadio(payload)
 	if err == nil && fromRadio.Packet != nil {
+		m.decryptPKI(fromRadio.Packet)
 		meshPacket := fromRadio.ToPacket()
 		if meshPacket != nil {
 			return message.FromMeshtasticPacket(meshPacket)
@@ -233,6 +258,31 @@ func (m *MQTT) parseMessage(topic string, payload []byte) *message.Packet {
 	return packet
 }
 
+// parseEnvelope converts a ServiceEnvelope, dropping packets still
+// encrypted with a channel key
+func (m *MQTT) parseEnvelope(env *meshtastic.ServiceEnvelope) *message.Packet {
+	m.decryptPKI(env.Packet)
+	if env.Packet.Decoded == nil {
+		m.logger.Debug("Skipping encrypted packet",
+			zap.Uint32("from", env.Packet.From),
+			zap.String("channel", env.ChannelID),
+			zap.String("gateway", env.GatewayID))
+		return nil
+	}
+	return message.FromMeshtasticPacket(env.ToPacket())
+}
+
+// topicChannel returns the channel name from a JSON topic
+func topicChannel(topic string) string {
+	parts := strings.Split(topic, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "json" && !strings.HasPrefix(parts[i+1], "!") {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
 // parsePortNum extracts the port number from type string or topic
 func (m *MQTT) parsePortNum(typeStr, topic string) message.PortNum {
 	typeStr = strings.ToUpper(typeStr)
@@ -331,3 +381,27 @@ func (m *MQTT) GetNodeInfo(nodeNum uint32) *meshtastic.NodeInfo {
 	defer m.mu.RUnlock()
 	return m.nodeDB[nodeNum]
 }
+
+// Nodes returns all nodes seen on the broker
+func (m *MQTT) Nodes() []*meshtastic.NodeInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return nodeList(m.nodeDB)
+}
+
+func (m *MQTT) configurePKI(cfg config.PKIConfig) error {
+	return m.pki.configure(cfg)
+}
+
+// decryptPKI decrypts a PKI direct message using the sender's key from
+// the node database
+func (m *MQTT) decryptPKI(mp *meshtastic.MeshPacket) {
+	m.mu.RLock()
+	var senderKey []byte
+	if node, ok := m.nodeDB[mp.From]; ok && node.User != nil {
+		senderKey = node.User.PublicKey
+	}
+	m.mu.RUnlock()
+
+	m.pki.decrypt(mp, senderKey, m.logger)
+}
@@ -0,0 +1,30 @@
+package connection
+
+import (
+	"testing"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+func FuzzMQTTParseMessage(f *testing.F) {
+	f.Add("msh/US/2/json/LongFast/!abcd1234",
+		[]byte(`{"from":305419896,"to":4294967295,"channel":0,"type":"text","payload":"hello","sender":"!abcd1234","rxTime":1700000000}`))
+	f.Add("msh/US/2/json/LongFast/!abcd1234",
+		[]byte(`{"from":1,"type":"position","payload":{"latitude_i":451234560,"longitude_i":-1229876540}}`))
+	f.Add("msh/US/2/e/LongFast/!abcd1234", (&meshtastic.ServiceEnvelope{
+		Packet: &meshtastic.MeshPacket{
+			From:    0x12345678,
+			To:      meshtastic.BroadcastAddr,
+			Decoded: &meshtastic.Data{PortNum: meshtastic.PortNumTextMessageApp, Payload: []byte("hi")},
+		},
+		ChannelID: "LongFast",
+		GatewayID: "!abcd1234",
+	}).Marshal())
+	f.Add("msh/US/!abcd1234", []byte("plain text"))
+
+	m, _ := NewMQTT(&config.MQTTConfig{})
+	f.Fuzz(func(t *testing.T, topic string, payload []byte) {
+		m.parseMessage(topic, payload)
+	})
+}
@@ -0,0 +1,130 @@
+package connection
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+// pkiKeyTimeout bounds reading the private key from the device
+const pkiKeyTimeout = 15 * time.Second
+
+// pkiConfigurer is implemented by connections that can decrypt PKI
+// direct messages
+type pkiConfigurer interface {
+	configurePKI(cfg config.PKIConfig) error
+}
+
+// pkiKeys holds the private key used to decrypt PKI direct messages.
+// The zero value decrypts nothing.
+type pkiKeys struct {
+	mu         sync.RWMutex
+	private    []byte
+	fromDevice bool
+}
+
+func (k *pkiKeys) configure(cfg config.PKIConfig) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.fromDevice = cfg.FromDevice
+	if cfg.PrivateKey == "" {
+		return nil
+	}
+	key, err := cfg.Key()
+	if err != nil {
+		return err
+	}
+	k.private = key
+	return nil
+}
+
+func (k *pkiKeys) set(key []byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.private = key
+}
+
+// wantsDeviceKey reports whether the key should be read from the device
+func (k *pkiKeys) wantsDeviceKey() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.fromDevice && k.private == nil
+}
+
+// decrypt decodes mp in place if it is an encrypted direct message for
+// our key. senderKey is the sender's public key from the node database,
+// if known; the key carried in the packet is used otherwise.
+func (k *pkiKeys) decrypt(mp *meshtastic.MeshPacket, senderKey []byte, logger *zap.Logger) {
+	if mp.Decoded != nil || len(mp.Encrypted) == 0 || mp.To == meshtastic.BroadcastAddr {
+		return
+	}
+
+	k.mu.RLock()
+	private := k.private
+	k.mu.RUnlock()
+	if private == nil {
+		return
+	}
+
+	if senderKey == nil {
+		senderKey = mp.PublicKey
+	}
+	if senderKey == nil {
+		logger.Debug("No public key for PKI sender", zap.Uint32("from", mp.From))
+		return
+	}
+
+	// Packets for other nodes fail authentication, so failures are expected
+	if err := mp.DecryptPKI(private, senderKey); err != nil {
+		logger.Debug("Could not decrypt direct message",
+			zap.Uint32("from", mp.From),
+			zap.Uint32("to", mp.To),
+			zap.Error(err))
+		return
+	}
+	logger.Debug("Decrypted PKI direct message", zap.Uint32("from", mp.From))
+}
+
+func (s *stream) configurePKI(cfg config.PKIConfig) error {
+	return s.pki.configure(cfg)
+}
+
+// decryptPKI decrypts a PKI direct message using the sender's key from
+// the node database
+func (s *stream) decryptPKI(mp *meshtastic.MeshPacket) {
+	s.mu.RLock()
+	var senderKey []byte
+	if node, ok := s.nodeDB[mp.From]; ok && node.User != nil {
+		senderKey = node.User.PublicKey
+	}
+	s.mu.RUnlock()
+
+	s.pki.decrypt(mp, senderKey, s.logger)
+}
+
+// loadDeviceKey reads the private key from the device's security config
+func (s *stream) loadDeviceKey() {
+	ctx, cancel := context.WithTimeout(context.Background(), pkiKeyTimeout)
+	defer cancel()
+
+	section := meshtastic.ConfigTypeSecurity
+	resp, err := s.AdminRequest(ctx, &meshtastic.AdminMessage{GetConfigRequest: &section})
+	if err != nil {
+		s.logger.Warn("Failed to read private key from device", zap.Error(err))
+		return
+	}
+	if resp.GetConfigResponse == nil || resp.GetConfigResponse.Security == nil ||
+		len(resp.GetConfigResponse.Security.PrivateKey) != 32 {
+		s.logger.Warn("Device did not return a private key")
+		return
+	}
+
+	s.pki.set(resp.GetConfigResponse.Security.PrivateKey)
+	s.logger.Info("Loaded private key from device for direct message decryption")
+}
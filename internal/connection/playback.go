@@ -0,0 +1,173 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// ErrPlayback indicates a packet was sent to a playback connection, which
+// has no radio to send it with
+var ErrPlayback = errors.New("playback connections cannot send")
+
+// PlaybackSource calls fn with each recorded packet, oldest first, and
+// stops when fn returns an error
+type PlaybackSource func(fn func(*message.Packet) error) error
+
+// Playback implements Connection by playing back recorded packets, as if
+// the device were receiving them again. Packets are spaced by the time
+// between their ReceivedAt times, divided by Speed.
+type Playback struct {
+	name   string
+	source PlaybackSource
+
+	// Speed divides the time between packets; zero or less plays them
+	// back as fast as they are taken
+	Speed float64
+	// MaxGap caps the wait between packets; zero for no cap
+	MaxGap time.Duration
+
+	messages chan *message.Packet
+	done     chan struct{}
+	stop     context.CancelFunc
+	played   int
+	err      error
+	mu       sync.Mutex
+	once     sync.Once
+}
+
+// NewPlayback creates a connection that plays back the packets from source
+func NewPlayback(name string, source PlaybackSource) *Playback {
+	return &Playback{
+		name:     name,
+		source:   source,
+		Speed:    1,
+		messages: make(chan *message.Packet, 100),
+		done:     make(chan struct{}),
+	}
+}
+
+// Connect starts the playback
+func (p *Playback) Connect(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop != nil {
+		return nil
+	}
+	ctx, p.stop = context.WithCancel(ctx)
+	go p.play(ctx)
+	return nil
+}
+
+// play sends the source's packets, then closes the message channel
+func (p *Playback) play(ctx context.Context) {
+	defer close(p.done)
+	defer close(p.messages)
+
+	var last time.Time
+	err := p.source(func(pkt *message.Packet) error {
+		if wait := p.gap(last, pkt.ReceivedAt); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		if !pkt.ReceivedAt.IsZero() {
+			last = pkt.ReceivedAt
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case p.messages <- pkt:
+		}
+		p.mu.Lock()
+		p.played++
+		p.mu.Unlock()
+		return nil
+	})
+
+	p.mu.Lock()
+	if !errors.Is(err, context.Canceled) {
+		p.err = err
+	}
+	p.mu.Unlock()
+}
+
+// gap returns how long to wait before a packet received at next when the
+// previous one was received at last
+func (p *Playback) gap(last, next time.Time) time.Duration {
+	if p.Speed <= 0 || last.IsZero() || next.IsZero() || !next.After(last) {
+		return 0
+	}
+	wait := time.Duration(float64(next.Sub(last)) / p.Speed)
+	if p.MaxGap > 0 && wait > p.MaxGap {
+		wait = p.MaxGap
+	}
+	return wait
+}
+
+// Done is closed once every packet has been handed out, or the playback
+// failed or was closed
+func (p *Playback) Done() <-chan struct{} {
+	return p.done
+}
+
+// Played returns how many packets have been handed out
+func (p *Playback) Played() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.played
+}
+
+// Err returns the error that ended the playback early, if any
+func (p *Playback) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// Messages returns the channel of played back packets, closed at the end
+func (p *Playback) Messages() <-chan *message.Packet {
+	return p.messages
+}
+
+// Send always fails; there is no radio to send with
+func (p *Playback) Send(context.Context, *message.Packet) error {
+	return ErrPlayback
+}
+
+// Close stops the playback
+func (p *Playback) Close() error {
+	p.once.Do(func() {
+		p.mu.Lock()
+		stop := p.stop
+		p.mu.Unlock()
+		if stop != nil {
+			stop()
+			<-p.done
+		}
+	})
+	return nil
+}
+
+// Name returns the connection identifier
+func (p *Playback) Name() string {
+	return "playback:" + p.name
+}
+
+// IsConnected reports whether packets are still being played back
+func (p *Playback) IsConnected() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.stop != nil
+	}
+}
@@ -0,0 +1,91 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestPlaybackGap(t *testing.T) {
+	at := time.Unix(1_700_000_000, 0)
+	p := NewPlayback("test", nil)
+
+	if got := p.gap(time.Time{}, at); got != 0 {
+		t.Errorf("first packet waits %v", got)
+	}
+	if got := p.gap(at, at.Add(2*time.Second)); got != 2*time.Second {
+		t.Errorf("speed 1 gap = %v", got)
+	}
+	if got := p.gap(at, at.Add(-time.Second)); got != 0 {
+		t.Errorf("out of order gap = %v", got)
+	}
+	p.Speed = 4
+	if got := p.gap(at, at.Add(2*time.Second)); got != 500*time.Millisecond {
+		t.Errorf("speed 4 gap = %v", got)
+	}
+	p.MaxGap = 100 * time.Millisecond
+	if got := p.gap(at, at.Add(time.Hour)); got != 100*time.Millisecond {
+		t.Errorf("capped gap = %v", got)
+	}
+	p.Speed = 0
+	if got := p.gap(at, at.Add(time.Hour)); got != 0 {
+		t.Errorf("speed 0 gap = %v", got)
+	}
+}
+
+func TestPlaybackPlays(t *testing.T) {
+	at := time.Now()
+	failed := errors.New("bad line")
+	p := NewPlayback("test", func(fn func(*message.Packet) error) error {
+		for i := range 3 {
+			if err := fn(&message.Packet{ID: uint32(i + 1), ReceivedAt: at.Add(time.Duration(i) * 20 * time.Millisecond)}); err != nil {
+				return err
+			}
+		}
+		return failed
+	})
+	if err := p.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = p.Close() }()
+
+	start := time.Now()
+	var ids []uint32
+	for pkt := range p.Messages() {
+		ids = append(ids, pkt.ID)
+	}
+	<-p.Done()
+	if len(ids) != 3 || ids[2] != 3 || p.Played() != 3 {
+		t.Errorf("played %v (%d)", ids, p.Played())
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("played in %v, faster than recorded", elapsed)
+	}
+	if !errors.Is(p.Err(), failed) || p.IsConnected() {
+		t.Errorf("Err = %v, IsConnected = %v", p.Err(), p.IsConnected())
+	}
+	if err := p.Send(context.Background(), &message.Packet{}); !errors.Is(err, ErrPlayback) {
+		t.Errorf("Send = %v", err)
+	}
+}
+
+func TestPlaybackClose(t *testing.T) {
+	p := NewPlayback("test", func(fn func(*message.Packet) error) error {
+		for {
+			if err := fn(&message.Packet{}); err != nil {
+				return err
+			}
+		}
+	})
+	if err := p.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	<-p.Messages()
+	_ = p.Close()
+	if p.Err() != nil {
+		t.Errorf("Err after Close = %v", p.Err())
+	}
+}
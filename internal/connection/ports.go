@@ -0,0 +1,115 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+)
+
+// SerialPort describes a serial device found on the host
+type SerialPort struct {
+	// Name is the device path, e.g. /dev/ttyUSB0 or COM3
+	Name string `json:"name"`
+	// VID and PID are the USB vendor and product IDs, in hex
+	VID string `json:"vid,omitempty"`
+	PID string `json:"pid,omitempty"`
+	// Product is the OS's description of the device, if any
+	Product string `json:"product,omitempty"`
+	// SerialNumber is the USB serial number, if any
+	SerialNumber string `json:"serial_number,omitempty"`
+	// Chip names the USB chip when it is one Meshtastic boards use
+	Chip string `json:"chip,omitempty"`
+}
+
+// Likely reports whether the port's USB IDs are those of a chip used on
+// Meshtastic boards
+func (p *SerialPort) Likely() bool {
+	return p.Chip != ""
+}
+
+// meshtasticChips maps the USB vendor:product IDs found on Meshtastic
+// boards to the chip they belong to. The USB-serial bridges are also found
+// on other hardware, so a match only makes a port a candidate.
+var meshtasticChips = map[string]string{
+	"10C4:EA60": "CP210x",           // Heltec V2, T-Beam, Station G1
+	"1A86:7523": "CH340",            // T-Beam, many ESP32 devkits
+	"1A86:55D4": "CH9102",           // T-Beam 1.2, T-LoRa
+	"0403:6001": "FTDI",             // FT232R adapters
+	"303A:1001": "ESP32-S3",         // Heltec V3, T-Deck, Station G2
+	"303A:4001": "ESP32-S3",         // ESP32-S3 TinyUSB firmware
+	"239A:8029": "nRF52840",         // RAK4631 and other Adafruit-bootloader boards
+	"239A:0029": "nRF52840 (DFU)",   // same, in the bootloader
+	"239A:4405": "nRF52840",         // T-Echo
+	"2886:0045": "nRF52840",         // Seeed XIAO, Wio Tracker
+	"2E8A:000A": "RP2040",           // Raspberry Pi Pico, RAK11310
+	"2E8A:0003": "RP2040 (BOOTSEL)", // same, in the bootloader
+}
+
+// SerialPorts lists the host's serial ports, candidates for a Meshtastic
+// device first. USB details are only filled in where the platform
+// reports them.
+func SerialPorts() ([]SerialPort, error) {
+	ports, err := listSerialPorts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list serial ports: %w", err)
+	}
+	classifyPorts(ports)
+	return ports, nil
+}
+
+// classifyPorts names the chips of ports and sorts the candidates first
+func classifyPorts(ports []SerialPort) {
+	for i := range ports {
+		p := &ports[i]
+		p.VID, p.PID = strings.ToUpper(p.VID), strings.ToUpper(p.PID)
+		if p.VID != "" {
+			p.Chip = meshtasticChips[p.VID+":"+p.PID]
+		}
+	}
+	sort.SliceStable(ports, func(i, j int) bool {
+		if ports[i].Likely() != ports[j].Likely() {
+			return ports[i].Likely()
+		}
+		return ports[i].Name < ports[j].Name
+	})
+}
+
+// ProbeSerial connects to the port in cfg and waits for the device to
+// report its node number, returning its profile. An error means no
+// Meshtastic device answered before ctx ended.
+func ProbeSerial(ctx context.Context, cfg config.SerialConfig) (*DeviceProfile, error) {
+	conn, err := NewSerial(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Connect(ctx); err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		my := conn.GetMyInfo()
+		if my != nil && (conn.Metadata() != nil || conn.ConfigComplete()) {
+			p := &DeviceProfile{}
+			if md := conn.Metadata(); md != nil {
+				p = newProfile(md)
+			}
+			p.NodeNum = my.MyNodeNum
+			return p, nil
+		}
+		select {
+		case <-ctx.Done():
+			if my != nil {
+				return &DeviceProfile{NodeNum: my.MyNodeNum}, nil
+			}
+			return nil, fmt.Errorf("no response from device")
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !darwin || cgo
+
+package connection
+
+import "go.bug.st/serial/enumerator"
+
+// listSerialPorts lists serial ports with their USB details
+func listSerialPorts() ([]SerialPort, error) {
+	details, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]SerialPort, 0, len(details))
+	for _, d := range details {
+		p := SerialPort{Name: d.Name, Product: d.Product}
+		if d.IsUSB {
+			p.VID, p.PID, p.SerialNumber = d.VID, d.PID, d.SerialNumber
+		}
+		ports = append(ports, p)
+	}
+	return ports, nil
+}
@@ -0,0 +1,19 @@
+//go:build darwin && !cgo
+
+package connection
+
+import "go.bug.st/serial"
+
+// listSerialPorts lists serial ports by name only; reading USB details on
+// macOS needs cgo
+func listSerialPorts() ([]SerialPort, error) {
+	names, err := serial.GetPortsList()
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]SerialPort, 0, len(names))
+	for _, name := range names {
+		ports = append(ports, SerialPort{Name: name})
+	}
+	return ports, nil
+}
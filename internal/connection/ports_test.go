@@ -0,0 +1,28 @@
+package connection
+
+import "testing"
+
+func TestClassifyPorts(t *testing.T) {
+	ports := []SerialPort{
+		{Name: "/dev/ttyS0"},
+		{Name: "/dev/ttyUSB1", VID: "0bda", PID: "8153"},
+		{Name: "/dev/ttyACM0", VID: "303a", PID: "1001"},
+		{Name: "/dev/ttyUSB0", VID: "10c4", PID: "ea60"},
+	}
+	classifyPorts(ports)
+
+	want := []struct{ name, chip string }{
+		{"/dev/ttyACM0", "ESP32-S3"},
+		{"/dev/ttyUSB0", "CP210x"},
+		{"/dev/ttyS0", ""},
+		{"/dev/ttyUSB1", ""},
+	}
+	for i, w := range want {
+		if ports[i].Name != w.name || ports[i].Chip != w.chip {
+			t.Errorf("ports[%d] = %+v, want %s (%q)", i, ports[i], w.name, w.chip)
+		}
+	}
+	if ports[1].VID != "10C4" || ports[1].PID != "EA60" {
+		t.Errorf("USB IDs not normalized: %+v", ports[1])
+	}
+}
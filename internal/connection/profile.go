@@ -0,0 +1,91 @@
+package connection
+
+import (
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+// DeviceProfile describes the device a connection is attached to
+type DeviceProfile struct {
+	NodeNum      uint32 `json:"node_num,omitempty"`
+	Firmware     string `json:"firmware,omitempty"`
+	HwModel      uint32 `json:"hw_model,omitempty"`
+	Role         string `json:"role"`
+	Wifi         bool   `json:"wifi"`
+	Bluetooth    bool   `json:"bluetooth"`
+	Ethernet     bool   `json:"ethernet"`
+	CanShutdown  bool   `json:"can_shutdown"`
+	RemoteHW     bool   `json:"remote_hardware"`
+	StateVersion uint32 `json:"state_version,omitempty"`
+}
+
+// Profile returns the profile of the device conn is attached to, or nil
+// if the connection does not report device metadata or it is not yet known
+func Profile(conn Connection) *DeviceProfile {
+	info, ok := conn.(DeviceInfo)
+	if !ok {
+		return nil
+	}
+	md := info.Metadata()
+	if md == nil {
+		return nil
+	}
+	p := newProfile(md)
+	if local, ok := conn.(LocalNode); ok {
+		if my := local.GetMyInfo(); my != nil {
+			p.NodeNum = my.MyNodeNum
+		}
+	}
+	return p
+}
+
+func newProfile(md *meshtastic.DeviceMetadata) *DeviceProfile {
+	return &DeviceProfile{
+		Firmware:     md.FirmwareVersion,
+		HwModel:      md.HwModel,
+		Role:         meshtastic.RoleName(md.Role),
+		Wifi:         md.HasWifi,
+		Bluetooth:    md.HasBluetooth,
+		Ethernet:     md.HasEthernet,
+		CanShutdown:  md.CanShutdown,
+		RemoteHW:     md.HasRemoteHardware,
+		StateVersion: md.DeviceStateVersion,
+	}
+}
+
+// Capabilities lists the device's network interfaces, e.g. "wifi,bluetooth"
+func (p *DeviceProfile) Capabilities() string {
+	var caps []string
+	if p.Wifi {
+		caps = append(caps, "wifi")
+	}
+	if p.Bluetooth {
+		caps = append(caps, "bluetooth")
+	}
+	if p.Ethernet {
+		caps = append(caps, "ethernet")
+	}
+	if len(caps) == 0 {
+		return "none"
+	}
+	return strings.Join(caps, ",")
+}
+
+// fields returns the profile as structured log fields
+func (p *DeviceProfile) fields() []zap.Field {
+	return []zap.Field{
+		zap.Uint32("node_num", p.NodeNum),
+		zap.String("firmware", p.Firmware),
+		zap.Uint32("hw_model", p.HwModel),
+		zap.String("role", p.Role),
+		zap.Bool("wifi", p.Wifi),
+		zap.Bool("bluetooth", p.Bluetooth),
+		zap.Bool("ethernet", p.Ethernet),
+		zap.Bool("can_shutdown", p.CanShutdown),
+		zap.Bool("remote_hardware", p.RemoteHW),
+		zap.Uint32("state_version", p.StateVersion),
+	}
+}
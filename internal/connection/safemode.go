@@ -0,0 +1,28 @@
+package connection
+
+import (
+	"errors"
+
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+// ErrSafeMode indicates a write refused because safe mode is on
+var ErrSafeMode = errors.New("safe mode is on; nothing is written to the radio")
+
+// safeModeConfigurer is implemented by connections that write to a device
+// and can be limited to reading from it
+type safeModeConfigurer interface {
+	configureSafeMode()
+}
+
+func (s *stream) configureSafeMode() {
+	s.safeMode = true
+}
+
+// allowedInSafeMode reports whether tr may be written in safe mode. Only
+// the configuration request is: the attached device answers it itself and
+// transmits nothing, and without it the device sends no packets at all.
+func allowedInSafeMode(tr *meshtastic.ToRadio) bool {
+	return tr.WantConfigID != 0 && tr.Packet == nil && tr.XmodemPacket == nil &&
+		tr.MqttClientProxyMessage == nil && !tr.Disconnect
+}
@@ -3,7 +3,6 @@ package connection
 import (
 	"context"
 	"fmt"
-	"sync"
 	"time"
 
 	"go.bug.st/serial"
@@ -11,33 +10,21 @@ import (
 
 	"github.com/iamruinous/meshtastic-message-relay/internal/config"
 	"github.com/iamruinous/meshtastic-message-relay/internal/logging"
-	"github.com/iamruinous/meshtastic-message-relay/internal/message"
 	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
 )
 
 // Serial implements Connection for serial port connections
 type Serial struct {
-	config   config.SerialConfig
-	port     serial.Port
-	framer   *meshtastic.StreamFramer
-	messages chan *message.Packet
-	nodeDB   map[uint32]*meshtastic.NodeInfo
-	myInfo   *meshtastic.MyNodeInfo
-	logger   *zap.Logger
-
-	mu        sync.RWMutex
-	connected bool
-	stopCh    chan struct{}
+	config config.SerialConfig
+	port   serial.Port
+	stream
 }
 
 // NewSerial creates a new serial connection
 func NewSerial(cfg config.SerialConfig) (*Serial, error) {
 	return &Serial{
-		config:   cfg,
-		messages: make(chan *message.Packet, 100),
-		nodeDB:   make(map[uint32]*meshtastic.NodeInfo),
-		logger:   logging.With(zap.String("connection", "serial")),
-		stopCh:   make(chan struct{}),
+		config: cfg,
+		stream: newStream(logging.With(zap.String("connection", "serial"))),
 	}, nil
 }
 
@@ -61,6 +48,10 @@ func (s *Serial) Connect(ctx context.Context) error {
 		Parity:   serial.NoParity,
 		StopBits: serial.OneStopBit,
 	}
+	if dtr, rts, set := s.config.ControlLines(); set {
+		// On Unix both lines still pulse on briefly while the port opens
+		mode.InitialStatusBits = &serial.ModemOutputBits{DTR: dtr, RTS: rts}
+	}
 
 	port, err := serial.Open(s.config.Port, mode)
 	if err != nil {
@@ -73,8 +64,33 @@ func (s *Serial) Connect(ctx context.Context) error {
 		return fmt.Errorf("failed to set read timeout: %w", err)
 	}
 
+	// Let a board that reset on open finish booting, and drop its boot log
+	if s.config.SettleDelay > 0 {
+		s.logger.Debug("Waiting for device to settle", zap.Duration("delay", s.config.SettleDelay))
+		select {
+		case <-time.After(s.config.SettleDelay):
+		case <-ctx.Done():
+			_ = port.Close()
+			return ctx.Err()
+		}
+		if err := port.ResetInputBuffer(); err != nil {
+			_ = port.Close()
+			return fmt.Errorf("failed to flush serial input: %w", err)
+		}
+	}
+
+	// Wake the device before any frames are exchanged
+	framer := meshtastic.NewStreamFramer(port, port)
+	if s.config.MaxPacketSize > 0 {
+		framer.SetMaxPacketSize(s.config.MaxPacketSize)
+	}
+	if err := framer.WriteWake(); err != nil {
+		_ = port.Close()
+		return fmt.Errorf("failed to send wake sequence: %w", err)
+	}
+
 	s.port = port
-	s.framer = meshtastic.NewStreamFramer(port, port)
+	s.framer = framer
 	s.connected = true
 	s.stopCh = make(chan struct{})
 
@@ -82,34 +98,17 @@ func (s *Serial) Connect(ctx context.Context) error {
 	go s.readLoop(ctx)
 
 	// Request initial config
-	go s.requestConfig()
+	go s.requestConfig(s.stopCh)
 
 	s.logger.Info("Connected to serial port")
 	return nil
 }
 
-// Messages returns the channel for receiving packets
-func (s *Serial) Messages() <-chan *message.Packet {
-	return s.messages
-}
-
-// Send transmits a packet over the serial connection
-func (s *Serial) Send(_ context.Context, _ *message.Packet) error {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	if !s.connected {
-		return fmt.Errorf("not connected")
-	}
-
-	// TODO: Implement sending - requires encoding ToRadio protobuf
-	return fmt.Errorf("send not yet implemented")
-}
-
 // Close closes the serial connection
 func (s *Serial) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	defer s.closeDump()
 
 	if !s.connected {
 		return nil
@@ -140,13 +139,6 @@ func (s *Serial) Name() string {
 	return fmt.Sprintf("serial:%s", s.config.Port)
 }
 
-// IsConnected returns the connection status
-func (s *Serial) IsConnected() bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.connected
-}
-
 // readLoop continuously reads packets from the serial port
 func (s *Serial) readLoop(ctx context.Context) {
 	s.logger.Debug("Starting read loop")
@@ -176,6 +168,8 @@ func (s *Serial) readPacket() {
 		return
 	}
 
+	s.dumpFrame(data)
+
 	// Parse the FromRadio message
 	fromRadio, err := meshtastic.ParseFromRadio(data)
 	if err != nil {
@@ -185,104 +179,3 @@ func (s *Serial) readPacket() {
 
 	s.handleFromRadio(fromRadio)
 }
-
-func (s *Serial) handleFromRadio(fr *meshtastic.FromRadio) {
-	// Handle different message types
-	if fr.MyInfo != nil {
-		s.mu.Lock()
-		s.myInfo = fr.MyInfo
-		s.mu.Unlock()
-		s.logger.Info("Received MyInfo",
-			zap.Uint32("node_num", fr.MyInfo.MyNodeNum))
-	}
-
-	if fr.NodeInfo != nil {
-		s.mu.Lock()
-		s.nodeDB[fr.NodeInfo.Num] = fr.NodeInfo
-		s.mu.Unlock()
-
-		userName := ""
-		if fr.NodeInfo.User != nil {
-			userName = fr.NodeInfo.User.LongName
-		}
-		s.logger.Debug("Received NodeInfo",
-			zap.Uint32("num", fr.NodeInfo.Num),
-			zap.String("name", userName))
-	}
-
-	if fr.ConfigCompleteID != 0 {
-		s.logger.Info("Config complete", zap.Uint32("id", fr.ConfigCompleteID))
-	}
-
-	if fr.Packet != nil {
-		// Convert to internal packet format
-		meshPacket := fr.ToPacket()
-		if meshPacket == nil {
-			return
-		}
-
-		// Attach node info if available
-		s.mu.RLock()
-		if nodeInfo, ok := s.nodeDB[meshPacket.From]; ok {
-			meshPacket.FromNode = nodeInfo
-		}
-		s.mu.RUnlock()
-
-		// Convert to our message format
-		packet := message.FromMeshtasticPacket(meshPacket)
-		if packet == nil {
-			return
-		}
-
-		s.logger.Debug("Received packet",
-			zap.Uint32("from", packet.From),
-			zap.Uint32("to", packet.To),
-			zap.String("port", packet.PortNum.String()))
-
-		// Send to channel (non-blocking)
-		select {
-		case s.messages <- packet:
-		default:
-			s.logger.Warn("Message channel full, dropping packet")
-		}
-	}
-}
-
-// requestConfig sends a request for initial configuration
-func (s *Serial) requestConfig() {
-	// Wait a moment for the connection to stabilize
-	time.Sleep(500 * time.Millisecond)
-
-	s.mu.RLock()
-	connected := s.connected
-	s.mu.RUnlock()
-
-	if !connected {
-		return
-	}
-
-	// Send a WantConfig request
-	// ToRadio { want_config_id: 1 }
-	// Field 3, varint wire type, value 1
-	// Tag: (3 << 3) | 0 = 24 = 0x18
-	wantConfig := []byte{0x18, 0x01}
-
-	s.logger.Debug("Requesting initial configuration")
-	if err := s.framer.WritePacket(wantConfig); err != nil {
-		s.logger.Error("Failed to request config", zap.Error(err))
-	}
-}
-
-// GetNodeInfo returns information about a specific node
-func (s *Serial) GetNodeInfo(nodeNum uint32) *meshtastic.NodeInfo {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.nodeDB[nodeNum]
-}
-
-// GetMyInfo returns information about this node
-func (s *Serial) GetMyInfo() *meshtastic.MyNodeInfo {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.myInfo
-}
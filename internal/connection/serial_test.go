@@ -4,11 +4,16 @@ package connection
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/iamruinous/meshtastic-message-relay/internal/config"
 	"github.com/iamruinous/meshtastic-message-relay/internal/logging"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
 	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic/simulator"
 )
 
@@ -65,6 +70,96 @@ func TestSerialConnection(t *testing.T) {
 	}
 
 	t.Log("Config exchange completed")
+
+	// The device profile comes from the metadata sent with the config
+	var profile *DeviceProfile
+	for deadline := time.Now().Add(2 * time.Second); profile == nil && time.Now().Before(deadline); {
+		time.Sleep(20 * time.Millisecond)
+		profile = Profile(conn)
+	}
+	if profile == nil || profile.Firmware != "2.5.0.sim" || profile.Capabilities() != "bluetooth" || profile.Role != "CLIENT" {
+		t.Errorf("Unexpected device profile: %+v", profile)
+	}
+}
+
+func TestSerialHexdump(t *testing.T) {
+	device := simulator.NewTestDevice(t)
+	defer device.Stop()
+	path := device.Start()
+
+	dump := filepath.Join(t.TempDir(), "frames.txt")
+	conn, err := New(&config.ConnectionConfig{
+		Type:    "serial",
+		Serial:  config.SerialConfig{Port: path, Baud: 115200},
+		Hexdump: dump,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create serial connection: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := conn.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	if !device.WaitForConfig(5 * time.Second) {
+		t.Fatal("Config was not requested/sent within timeout")
+	}
+	time.Sleep(200 * time.Millisecond)
+	_ = conn.Close()
+
+	data, err := os.ReadFile(dump)
+	if err != nil {
+		t.Fatalf("Failed to read hexdump: %v", err)
+	}
+	for _, want := range []string{"# frame 1,", "my_info (3)", "metadata (13)", "config_complete_id (8)"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("hexdump missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestSerialSettleDelay(t *testing.T) {
+	device := simulator.NewTestDevice(t)
+	defer device.Stop()
+	path := device.Start()
+
+	conn, err := NewSerial(config.SerialConfig{Port: path, Baud: 115200, SettleDelay: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create serial connection: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if err := conn.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Connect returned after %v, before the settle delay", elapsed)
+	}
+
+	if !device.WaitForConfig(5 * time.Second) {
+		t.Error("Config was not requested/sent after settling")
+	}
+}
+
+func TestProbeSerial(t *testing.T) {
+	device := simulator.NewTestDevice(t)
+	defer device.Stop()
+	path := device.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p, err := ProbeSerial(ctx, config.SerialConfig{Port: path, Baud: 115200})
+	if err != nil {
+		t.Fatalf("ProbeSerial failed: %v", err)
+	}
+	if p.NodeNum == 0 || p.Firmware != "2.5.0.sim" {
+		t.Errorf("profile = %+v", p)
+	}
 }
 
 func TestSerialReceiveMessage(t *testing.T) {
@@ -226,3 +321,110 @@ func TestSerialClose(t *testing.T) {
 		// Channel might be empty but not closed yet, that's ok
 	}
 }
+
+func TestSerialNodeInfoPacket(t *testing.T) {
+	device := simulator.NewTestDevice(t)
+	defer device.Stop()
+
+	path := device.Start()
+
+	conn, err := NewSerial(config.SerialConfig{Port: path, Baud: 115200})
+	if err != nil {
+		t.Fatalf("Failed to create serial connection: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := conn.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if !device.WaitForConfig(5 * time.Second) {
+		t.Fatal("Config was not sent")
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	// A node not in the config dump announces itself
+	const newNode = 0x0BADCAFE
+	if err := device.SendNodeInfo(newNode, "Late Joiner", "LATE", 9); err != nil {
+		t.Fatalf("Failed to send node info: %v", err)
+	}
+
+	select {
+	case msg := <-conn.Messages():
+		user, ok := msg.Payload.(*message.User)
+		if !ok {
+			t.Fatalf("Expected *message.User payload, got %T", msg.Payload)
+		}
+		if user.LongName != "Late Joiner" || user.ShortName != "LATE" {
+			t.Errorf("Unexpected user: %+v", user)
+		}
+		if msg.FromNode == nil || msg.FromNode.User == nil || msg.FromNode.User.ShortName != "LATE" {
+			t.Errorf("Expected FromNode to carry the announced user, got %+v", msg.FromNode)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for node info packet")
+	}
+
+	info := conn.GetNodeInfo(newNode)
+	if info == nil || info.User == nil || info.User.LongName != "Late Joiner" {
+		t.Errorf("Node DB not updated: %+v", info)
+	}
+}
+
+func TestSerialSensorPackets(t *testing.T) {
+	device := simulator.NewTestDevice(t)
+	defer device.Stop()
+
+	path := device.Start()
+
+	conn, err := NewSerial(config.SerialConfig{Port: path, Baud: 115200})
+	if err != nil {
+		t.Fatalf("Failed to create serial connection: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := conn.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if !device.WaitForConfig(5 * time.Second) {
+		t.Fatal("Config was not sent")
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if err := device.SendDetection(0x12345678, "Motion detected"); err != nil {
+		t.Fatalf("Failed to send detection: %v", err)
+	}
+	if err := device.SendPaxcount(0x12345678, 12, 5, 3600); err != nil {
+		t.Fatalf("Failed to send paxcount: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-conn.Messages():
+			switch p := msg.Payload.(type) {
+			case *message.DetectionEvent:
+				if p.Text != "Motion detected" {
+					t.Errorf("Unexpected detection text: %q", p.Text)
+				}
+			case *message.Paxcount:
+				if p.WiFi != 12 || p.BLE != 5 || p.Uptime != 3600 {
+					t.Errorf("Unexpected paxcount: %+v", p)
+				}
+				if got := fmt.Sprint(p); got != "17 devices nearby (12 WiFi, 5 Bluetooth)" {
+					t.Errorf("Unexpected paxcount text: %q", got)
+				}
+			default:
+				t.Errorf("Unexpected payload %T on %s", msg.Payload, msg.PortNum)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for sensor packets")
+		}
+	}
+}
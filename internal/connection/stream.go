@@ -0,0 +1,579 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+// ErrNoNodeInfo indicates the device has not reported its own node info yet
+var ErrNoNodeInfo = errors.New("device node info not yet received")
+
+// ErrNotAcked indicates the mesh reported a want_ack packet as undelivered
+var ErrNotAcked = errors.New("packet not acknowledged")
+
+// stream holds the state shared by connections that speak the framed
+// stream API to a device (serial and TCP).
+type stream struct {
+	framer   *meshtastic.StreamFramer
+	messages chan *message.Packet
+	xmodem   chan *meshtastic.XModem
+	nodeDB   map[uint32]*meshtastic.NodeInfo
+	myInfo   *meshtastic.MyNodeInfo
+	metadata *meshtastic.DeviceMetadata
+	logger   *zap.Logger
+
+	// pending maps outstanding request packet IDs to their reply channels
+	pending map[uint32]chan *meshtastic.MeshPacket
+	passkey []byte
+
+	// acks maps want_ack packet IDs to the routing result for them
+	acks map[uint32]*ackWaiter
+
+	pki  pkiKeys
+	dump frameDump
+	want wantConfig
+
+	// safeMode refuses writes other than the configuration request; it is
+	// set before connecting
+	safeMode bool
+
+	mu        sync.RWMutex
+	connected bool
+	lastFrame time.Time
+	stopCh    chan struct{}
+}
+
+func newStream(logger *zap.Logger) stream {
+	return stream{
+		messages: make(chan *message.Packet, 100),
+		xmodem:   make(chan *meshtastic.XModem, 16),
+		nodeDB:   make(map[uint32]*meshtastic.NodeInfo),
+		pending:  make(map[uint32]chan *meshtastic.MeshPacket),
+		acks:     make(map[uint32]*ackWaiter),
+		logger:   logger,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Messages returns the channel for receiving packets
+func (s *stream) Messages() <-chan *message.Packet {
+	return s.messages
+}
+
+// IsConnected returns the connection status
+func (s *stream) IsConnected() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.connected
+}
+
+// LastFrame returns when the last frame was received from the device
+func (s *stream) LastFrame() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastFrame
+}
+
+// GetNodeInfo returns information about a specific node
+func (s *stream) GetNodeInfo(nodeNum uint32) *meshtastic.NodeInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.nodeDB[nodeNum]
+}
+
+// Nodes returns all nodes the device has reported
+func (s *stream) Nodes() []*meshtastic.NodeInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return nodeList(s.nodeDB)
+}
+
+// GetMyInfo returns information about this node
+func (s *stream) GetMyInfo() *meshtastic.MyNodeInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.myInfo
+}
+
+// Metadata returns the device's firmware and capabilities
+func (s *stream) Metadata() *meshtastic.DeviceMetadata {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.metadata
+}
+
+// SendXModem writes an XModem packet to the device
+func (s *stream) SendXModem(pkt *meshtastic.XModem) error {
+	return s.writeToRadio(&meshtastic.ToRadio{XmodemPacket: pkt.Marshal()})
+}
+
+// XModemPackets returns the channel of XModem packets received from the device
+func (s *stream) XModemPackets() <-chan *meshtastic.XModem {
+	return s.xmodem
+}
+
+// Send transmits a packet to the mesh through the device
+func (s *stream) Send(_ context.Context, packet *message.Packet) error {
+	if packet == nil {
+		return fmt.Errorf("nil packet")
+	}
+
+	payload := packet.RawPayload
+	var replyID uint32
+	switch p := packet.Payload.(type) {
+	case *message.TextMessage:
+		payload = []byte(p.Text)
+		replyID = p.ReplyID
+	case string:
+		payload = []byte(p)
+	case []byte:
+		payload = p
+	}
+
+	to := packet.To
+	if to == 0 {
+		to = meshtastic.BroadcastAddr
+	}
+
+	mp := &meshtastic.MeshPacket{
+		To:       to,
+		Channel:  packet.Channel,
+		ID:       packet.ID,
+		HopLimit: packet.HopLimit,
+		WantAck:  packet.WantAck,
+		Decoded: &meshtastic.Data{
+			PortNum: meshtastic.PortNum(packet.PortNum),
+			Payload: payload,
+			ReplyID: replyID,
+		},
+	}
+
+	if err := s.sendMeshPacket(mp); err != nil {
+		return err
+	}
+	packet.ID = mp.ID
+	return nil
+}
+
+// ackWaiter receives the routing result for a want_ack packet
+type ackWaiter struct {
+	to     uint32
+	result chan ackResult
+}
+
+// ackResult is the routing result for a want_ack packet
+type ackResult struct {
+	reason meshtastic.RoutingError
+	ack    Ack
+}
+
+// SendAndWaitAck sends packet with want_ack set and waits until the
+// destination acknowledges it. Implicit acks, where the local device only
+// overheard a rebroadcast, are not enough.
+func (s *stream) SendAndWaitAck(ctx context.Context, packet *message.Packet) (Ack, error) {
+	if packet.To == 0 || packet.To == meshtastic.BroadcastAddr {
+		return Ack{}, fmt.Errorf("acknowledgements require a destination node")
+	}
+	if packet.ID == 0 {
+		packet.ID = newPacketID()
+	}
+	packet.WantAck = true
+
+	waiter := &ackWaiter{to: packet.To, result: make(chan ackResult, 1)}
+	s.mu.Lock()
+	s.acks[packet.ID] = waiter
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.acks, packet.ID)
+		s.mu.Unlock()
+	}()
+
+	if err := s.Send(ctx, packet); err != nil {
+		return Ack{}, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return Ack{}, ctx.Err()
+	case <-s.stopCh:
+		return Ack{}, fmt.Errorf("connection closed")
+	case r := <-waiter.result:
+		if r.reason != meshtastic.RoutingErrorNone {
+			return Ack{}, fmt.Errorf("%w: %s", ErrNotAcked, r.reason)
+		}
+		return r.ack, nil
+	}
+}
+
+// AdminRequest sends an admin message to the local device and waits for
+// its response. The session passkey from the response is remembered so
+// later writes are accepted.
+func (s *stream) AdminRequest(ctx context.Context, msg *meshtastic.AdminMessage) (*meshtastic.AdminMessage, error) {
+	mp, err := s.adminPacket(msg, true)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := s.request(ctx, mp)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Decoded == nil || reply.Decoded.PortNum != meshtastic.PortNumAdminApp {
+		return nil, fmt.Errorf("unexpected reply on port %s", replyPort(reply))
+	}
+
+	resp, err := meshtastic.ParseAdminMessage(reply.Decoded.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse admin response: %w", err)
+	}
+
+	if len(resp.SessionPasskey) > 0 {
+		s.mu.Lock()
+		s.passkey = resp.SessionPasskey
+		s.mu.Unlock()
+	}
+
+	return resp, nil
+}
+
+// SendAdmin sends an admin message to the local device without waiting
+// for a response
+func (s *stream) SendAdmin(_ context.Context, msg *meshtastic.AdminMessage) error {
+	mp, err := s.adminPacket(msg, false)
+	if err != nil {
+		return err
+	}
+	return s.sendMeshPacket(mp)
+}
+
+func (s *stream) adminPacket(msg *meshtastic.AdminMessage, wantResponse bool) (*meshtastic.MeshPacket, error) {
+	s.mu.RLock()
+	myInfo, passkey := s.myInfo, s.passkey
+	s.mu.RUnlock()
+
+	if myInfo == nil {
+		return nil, ErrNoNodeInfo
+	}
+
+	if msg.SessionPasskey == nil {
+		msg.SessionPasskey = passkey
+	}
+
+	return &meshtastic.MeshPacket{
+		To:      myInfo.MyNodeNum,
+		WantAck: true,
+		Decoded: &meshtastic.Data{
+			PortNum:      meshtastic.PortNumAdminApp,
+			Payload:      msg.Marshal(),
+			WantResponse: wantResponse,
+		},
+	}, nil
+}
+
+// request sends a packet and waits for the packet that answers it
+func (s *stream) request(ctx context.Context, mp *meshtastic.MeshPacket) (*meshtastic.MeshPacket, error) {
+	if mp.ID == 0 {
+		mp.ID = newPacketID()
+	}
+
+	reply := make(chan *meshtastic.MeshPacket, 1)
+	s.mu.Lock()
+	s.pending[mp.ID] = reply
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, mp.ID)
+		s.mu.Unlock()
+	}()
+
+	if err := s.sendMeshPacket(mp); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.stopCh:
+		return nil, fmt.Errorf("connection closed")
+	case pkt := <-reply:
+		return pkt, nil
+	}
+}
+
+// sendMeshPacket assigns a packet ID if needed and writes the packet
+func (s *stream) sendMeshPacket(mp *meshtastic.MeshPacket) error {
+	if mp.ID == 0 {
+		mp.ID = newPacketID()
+	}
+	if mp.HopLimit == 0 {
+		mp.HopLimit = meshtastic.DefaultHopLimit
+	}
+
+	s.logger.Debug("Sending packet",
+		zap.Uint32("id", mp.ID),
+		zap.Uint32("to", mp.To),
+		zap.Stringer("port", mp.Decoded.PortNum))
+
+	return s.writeToRadio(&meshtastic.ToRadio{Packet: mp})
+}
+
+// deliverReply hands a packet to the request waiting for it, if any
+func (s *stream) deliverReply(mp *meshtastic.MeshPacket) bool {
+	if mp.Decoded == nil || mp.Decoded.RequestID == 0 {
+		return false
+	}
+
+	if s.deliverAck(mp) {
+		return true
+	}
+
+	s.mu.RLock()
+	reply, ok := s.pending[mp.Decoded.RequestID]
+	s.mu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	// Routing acks share the request ID; keep waiting for the real answer
+	if mp.Decoded.PortNum == meshtastic.PortNumRoutingApp {
+		return true
+	}
+
+	select {
+	case reply <- mp:
+	default:
+	}
+	return true
+}
+
+// deliverAck hands a routing result to the SendAndWaitAck call waiting for it
+func (s *stream) deliverAck(mp *meshtastic.MeshPacket) bool {
+	if mp.Decoded.PortNum != meshtastic.PortNumRoutingApp {
+		return false
+	}
+
+	s.mu.RLock()
+	waiter, ok := s.acks[mp.Decoded.RequestID]
+	s.mu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	reason, err := meshtastic.ParseRoutingError(mp.Decoded.Payload)
+	if err != nil {
+		s.logger.Debug("Error parsing routing packet", zap.Error(err))
+		return true
+	}
+
+	// A successful ack only counts when it comes from the destination;
+	// failures are reported by the local device
+	if reason == meshtastic.RoutingErrorNone && mp.From != waiter.to {
+		return true
+	}
+
+	select {
+	case waiter.result <- ackResult{reason: reason, ack: Ack{Hops: hopsTaken(mp)}}:
+	default:
+	}
+	return true
+}
+
+// hopsTaken returns how many times mp was relayed, or -1 when its sender
+// did not set hop_start (firmware before 2.3)
+func hopsTaken(mp *meshtastic.MeshPacket) int {
+	if mp.HopStart == 0 || mp.HopLimit > mp.HopStart {
+		return -1
+	}
+	return int(mp.HopStart - mp.HopLimit)
+}
+
+func newPacketID() uint32 {
+	// Zero means "unset" on the wire
+	return rand.Uint32N(0xFFFFFFFE) + 1
+}
+
+func replyPort(mp *meshtastic.MeshPacket) string {
+	if mp.Decoded == nil {
+		return "encrypted"
+	}
+	return mp.Decoded.PortNum.String()
+}
+
+// writeToRadio encodes and writes a ToRadio message to the device
+func (s *stream) writeToRadio(tr *meshtastic.ToRadio) error {
+	if s.safeMode && !allowedInSafeMode(tr) {
+		return ErrSafeMode
+	}
+
+	s.mu.RLock()
+	connected, framer := s.connected, s.framer
+	s.mu.RUnlock()
+
+	if !connected || framer == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	return framer.WritePacket(tr.Marshal())
+}
+
+// logProfile records the attached device's profile for support requests
+func (s *stream) logProfile() {
+	s.mu.RLock()
+	md, myInfo := s.metadata, s.myInfo
+	s.mu.RUnlock()
+	if md == nil {
+		s.logger.Warn("Device did not report its metadata")
+		return
+	}
+	p := newProfile(md)
+	if myInfo != nil {
+		p.NodeNum = myInfo.MyNodeNum
+	}
+	s.logger.Info("Device profile", p.fields()...)
+}
+
+func (s *stream) handleFromRadio(fr *meshtastic.FromRadio) {
+	s.mu.Lock()
+	s.lastFrame = time.Now()
+	s.mu.Unlock()
+
+	// Handle different message types
+	if fr.MyInfo != nil {
+		s.mu.Lock()
+		s.myInfo = fr.MyInfo
+		s.mu.Unlock()
+		s.want.received()
+		s.logger.Info("Received MyInfo",
+			zap.Uint32("node_num", fr.MyInfo.MyNodeNum))
+	}
+
+	if fr.Metadata != nil {
+		s.mu.Lock()
+		s.metadata = fr.Metadata
+		s.mu.Unlock()
+		s.want.received()
+	}
+
+	if fr.NodeInfo != nil {
+		s.mu.Lock()
+		s.nodeDB[fr.NodeInfo.Num] = fr.NodeInfo
+		s.mu.Unlock()
+		s.want.received()
+
+		userName := ""
+		if fr.NodeInfo.User != nil {
+			userName = fr.NodeInfo.User.LongName
+		}
+		s.logger.Debug("Received NodeInfo",
+			zap.Uint32("num", fr.NodeInfo.Num),
+			zap.String("name", userName))
+	}
+
+	if fr.ConfigCompleteID != 0 {
+		s.want.complete()
+		s.logger.Info("Config complete", zap.Uint32("id", fr.ConfigCompleteID))
+		s.logProfile()
+		if s.pki.wantsDeviceKey() {
+			go s.loadDeviceKey()
+		}
+	}
+
+	if fr.XmodemPacket != nil {
+		s.handleXModem(fr.XmodemPacket)
+	}
+
+	if fr.Packet != nil {
+		s.decryptPKI(fr.Packet)
+
+		// Replies to our own requests are not relayed
+		if s.deliverReply(fr.Packet) {
+			return
+		}
+
+		// Convert to internal packet format
+		meshPacket := fr.ToPacket()
+		if meshPacket == nil {
+			return
+		}
+
+		// Learn about nodes announcing themselves on the mesh
+		if user, ok := meshPacket.Payload.(*meshtastic.User); ok {
+			s.updateNodeUser(meshPacket.From, user, meshPacket.ReceivedAt)
+		}
+
+		// Attach node info if available
+		s.mu.RLock()
+		if nodeInfo, ok := s.nodeDB[meshPacket.From]; ok {
+			meshPacket.FromNode = nodeInfo
+		}
+		s.mu.RUnlock()
+
+		// Convert to our message format
+		packet := message.FromMeshtasticPacket(meshPacket)
+		if packet == nil {
+			return
+		}
+
+		s.logger.Debug("Received packet",
+			zap.Uint32("from", packet.From),
+			zap.Uint32("to", packet.To),
+			zap.String("port", packet.PortNum.String()))
+
+		// Send to channel (non-blocking)
+		select {
+		case s.messages <- packet:
+		default:
+			s.logger.Warn("Message channel full, dropping packet")
+		}
+	}
+}
+
+// updateNodeUser records user info received in a NODEINFO_APP packet.
+// Entries are replaced rather than modified since packets already handed
+// out may reference them.
+func (s *stream) updateNodeUser(num uint32, user *meshtastic.User, heard time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updated := &meshtastic.NodeInfo{Num: num}
+	if existing, ok := s.nodeDB[num]; ok {
+		*updated = *existing
+	}
+	updated.User = user
+	updated.LastHeard = uint32(heard.Unix())
+	s.nodeDB[num] = updated
+
+	s.logger.Debug("Updated node from NodeInfo packet",
+		zap.Uint32("num", num),
+		zap.String("name", user.LongName))
+}
+
+func (s *stream) handleXModem(data []byte) {
+	pkt, err := meshtastic.ParseXModem(data)
+	if err != nil {
+		s.logger.Debug("Error parsing XModem packet", zap.Error(err))
+		return
+	}
+
+	s.logger.Debug("Received XModem packet",
+		zap.Stringer("control", pkt.Control),
+		zap.Uint32("seq", pkt.Seq))
+
+	select {
+	case s.xmodem <- pkt:
+	default:
+		s.logger.Warn("XModem channel full, dropping packet")
+	}
+}
@@ -0,0 +1,49 @@
+package connection
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+func TestDeliverAckHops(t *testing.T) {
+	s := newStream(zap.NewNop())
+	waiter := &ackWaiter{to: 0x1234abcd, result: make(chan ackResult, 1)}
+	s.acks[42] = waiter
+
+	ack := func(from, hopStart, hopLimit uint32) *meshtastic.MeshPacket {
+		return &meshtastic.MeshPacket{
+			From:     from,
+			HopStart: hopStart,
+			HopLimit: hopLimit,
+			Decoded:  &meshtastic.Data{PortNum: meshtastic.PortNumRoutingApp, RequestID: 42},
+		}
+	}
+
+	// An implicit ack from a relaying node does not count
+	if !s.deliverReply(ack(0x99, 3, 2)) {
+		t.Fatal("routing packet not claimed")
+	}
+	select {
+	case r := <-waiter.result:
+		t.Fatalf("implicit ack delivered: %+v", r)
+	default:
+	}
+
+	for _, tc := range []struct {
+		hopStart, hopLimit uint32
+		want               int
+	}{
+		{3, 1, 2},
+		{3, 3, 0},
+		{0, 3, -1},
+	} {
+		s.deliverReply(ack(0x1234abcd, tc.hopStart, tc.hopLimit))
+		r := <-waiter.result
+		if r.reason != meshtastic.RoutingErrorNone || r.ack.Hops != tc.want {
+			t.Errorf("hop_start %d, hop_limit %d: result %+v, want %d hops", tc.hopStart, tc.hopLimit, r, tc.want)
+		}
+	}
+}
@@ -2,42 +2,34 @@ package connection
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
-	"sync"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/discovery"
 	"github.com/iamruinous/meshtastic-message-relay/internal/logging"
-	"github.com/iamruinous/meshtastic-message-relay/internal/message"
 	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
 )
 
+// AutoHost is the TCP host value that selects a device via LAN discovery
+const AutoHost = "auto"
+
 // TCP implements Connection for TCP connections
 type TCP struct {
-	config   config.TCPConfig
-	conn     net.Conn
-	framer   *meshtastic.StreamFramer
-	messages chan *message.Packet
-	nodeDB   map[uint32]*meshtastic.NodeInfo
-	myInfo   *meshtastic.MyNodeInfo
-	logger   *zap.Logger
-
-	mu        sync.RWMutex
-	connected bool
-	stopCh    chan struct{}
+	config config.TCPConfig
+	conn   net.Conn
+	stream
 }
 
 // NewTCP creates a new TCP connection
 func NewTCP(cfg config.TCPConfig) (*TCP, error) {
 	return &TCP{
-		config:   cfg,
-		messages: make(chan *message.Packet, 100),
-		nodeDB:   make(map[uint32]*meshtastic.NodeInfo),
-		logger:   logging.With(zap.String("connection", "tcp")),
-		stopCh:   make(chan struct{}),
+		config: cfg,
+		stream: newStream(logging.With(zap.String("connection", "tcp"))),
 	}, nil
 }
 
@@ -51,20 +43,63 @@ func (t *TCP) Connect(ctx context.Context) error {
 	}
 
 	addr := fmt.Sprintf("%s:%d", t.config.Host, t.config.Port)
-	t.logger.Info("Connecting to TCP endpoint", zap.String("address", addr))
+	if t.config.Host == AutoHost {
+		t.logger.Info("Discovering Meshtastic devices on the local network")
+		device, err := discovery.First(ctx, discovery.DefaultTimeout)
+		if err != nil {
+			return fmt.Errorf("failed to discover device: %w", err)
+		}
+		addr = device.Address()
+	}
+	t.logger.Info("Connecting to TCP endpoint", zap.String("address", addr), zap.Bool("tls", t.config.TLS.Enabled))
 
-	// Dial with timeout
-	dialer := net.Dialer{Timeout: 10 * time.Second}
-	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	// Dial with timeout, trying every address of the host
+	fallbackDelay := t.config.FallbackDelay
+	if fallbackDelay == 0 {
+		fallbackDelay = DefaultFallbackDelay
+	}
+	d := &dialer{timeout: 10 * time.Second, fallbackDelay: fallbackDelay, iface: t.config.Interface}
+	conn, err := d.DialContext(ctx, addr)
 	if err != nil {
-		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+		return err
+	}
+	if t.config.TLS.Enabled {
+		tlsCfg, err := t.config.TLS.Load()
+		if err != nil {
+			_ = conn.Close()
+			return fmt.Errorf("invalid tcp tls config: %w", err)
+		}
+		if tlsCfg.ServerName == "" {
+			tlsCfg.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		// Handshake now, so certificate errors are reported here rather
+		// than as a silent read loop
+		tlsConn := tls.Client(conn, tlsCfg)
+		hsCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		err = tlsConn.HandshakeContext(hsCtx)
+		cancel()
+		if err != nil {
+			_ = conn.Close()
+			return fmt.Errorf("failed to connect to %s over tls: %w", addr, err)
+		}
+		conn = tlsConn
 	}
 
 	// Set read deadline for non-blocking reads
 	_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
 
+	// Wake the device before any frames are exchanged
+	framer := meshtastic.NewStreamFramer(conn, conn)
+	if t.config.MaxPacketSize > 0 {
+		framer.SetMaxPacketSize(t.config.MaxPacketSize)
+	}
+	if err := framer.WriteWake(); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("failed to send wake sequence: %w", err)
+	}
+
 	t.conn = conn
-	t.framer = meshtastic.NewStreamFramer(conn, conn)
+	t.framer = framer
 	t.connected = true
 	t.stopCh = make(chan struct{})
 
@@ -72,34 +107,17 @@ func (t *TCP) Connect(ctx context.Context) error {
 	go t.readLoop(ctx)
 
 	// Request initial config
-	go t.requestConfig()
+	go t.requestConfig(t.stopCh)
 
 	t.logger.Info("Connected to TCP endpoint")
 	return nil
 }
 
-// Messages returns the channel for receiving packets
-func (t *TCP) Messages() <-chan *message.Packet {
-	return t.messages
-}
-
-// Send transmits a packet over the TCP connection
-func (t *TCP) Send(_ context.Context, _ *message.Packet) error {
-	t.mu.RLock()
-	defer t.mu.RUnlock()
-
-	if !t.connected {
-		return fmt.Errorf("not connected")
-	}
-
-	// TODO: Implement sending - requires encoding ToRadio protobuf
-	return fmt.Errorf("send not yet implemented")
-}
-
 // Close closes the TCP connection
 func (t *TCP) Close() error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	defer t.closeDump()
 
 	if !t.connected {
 		return nil
@@ -130,13 +148,6 @@ func (t *TCP) Name() string {
 	return fmt.Sprintf("tcp:%s:%d", t.config.Host, t.config.Port)
 }
 
-// IsConnected returns the connection status
-func (t *TCP) IsConnected() bool {
-	t.mu.RLock()
-	defer t.mu.RUnlock()
-	return t.connected
-}
-
 // readLoop continuously reads packets from the TCP connection
 func (t *TCP) readLoop(ctx context.Context) {
 	t.logger.Debug("Starting read loop")
@@ -176,6 +187,8 @@ func (t *TCP) readPacket() {
 		return
 	}
 
+	t.dumpFrame(data)
+
 	// Parse the FromRadio message
 	fromRadio, err := meshtastic.ParseFromRadio(data)
 	if err != nil {
@@ -185,101 +198,3 @@ func (t *TCP) readPacket() {
 
 	t.handleFromRadio(fromRadio)
 }
-
-func (t *TCP) handleFromRadio(fr *meshtastic.FromRadio) {
-	// Handle different message types
-	if fr.MyInfo != nil {
-		t.mu.Lock()
-		t.myInfo = fr.MyInfo
-		t.mu.Unlock()
-		t.logger.Info("Received MyInfo",
-			zap.Uint32("node_num", fr.MyInfo.MyNodeNum))
-	}
-
-	if fr.NodeInfo != nil {
-		t.mu.Lock()
-		t.nodeDB[fr.NodeInfo.Num] = fr.NodeInfo
-		t.mu.Unlock()
-
-		userName := ""
-		if fr.NodeInfo.User != nil {
-			userName = fr.NodeInfo.User.LongName
-		}
-		t.logger.Debug("Received NodeInfo",
-			zap.Uint32("num", fr.NodeInfo.Num),
-			zap.String("name", userName))
-	}
-
-	if fr.ConfigCompleteID != 0 {
-		t.logger.Info("Config complete", zap.Uint32("id", fr.ConfigCompleteID))
-	}
-
-	if fr.Packet != nil {
-		// Convert to internal packet format
-		meshPacket := fr.ToPacket()
-		if meshPacket == nil {
-			return
-		}
-
-		// Attach node info if available
-		t.mu.RLock()
-		if nodeInfo, ok := t.nodeDB[meshPacket.From]; ok {
-			meshPacket.FromNode = nodeInfo
-		}
-		t.mu.RUnlock()
-
-		// Convert to our message format
-		packet := message.FromMeshtasticPacket(meshPacket)
-		if packet == nil {
-			return
-		}
-
-		t.logger.Debug("Received packet",
-			zap.Uint32("from", packet.From),
-			zap.Uint32("to", packet.To),
-			zap.String("port", packet.PortNum.String()))
-
-		// Send to channel (non-blocking)
-		select {
-		case t.messages <- packet:
-		default:
-			t.logger.Warn("Message channel full, dropping packet")
-		}
-	}
-}
-
-// requestConfig sends a request for initial configuration
-func (t *TCP) requestConfig() {
-	// Wait a moment for the connection to stabilize
-	time.Sleep(500 * time.Millisecond)
-
-	t.mu.RLock()
-	connected := t.connected
-	t.mu.RUnlock()
-
-	if !connected {
-		return
-	}
-
-	// Send a WantConfig request
-	wantConfig := []byte{0x18, 0x01}
-
-	t.logger.Debug("Requesting initial configuration")
-	if err := t.framer.WritePacket(wantConfig); err != nil {
-		t.logger.Error("Failed to request config", zap.Error(err))
-	}
-}
-
-// GetNodeInfo returns information about a specific node
-func (t *TCP) GetNodeInfo(nodeNum uint32) *meshtastic.NodeInfo {
-	t.mu.RLock()
-	defer t.mu.RUnlock()
-	return t.nodeDB[nodeNum]
-}
-
-// GetMyInfo returns information about this node
-func (t *TCP) GetMyInfo() *meshtastic.MyNodeInfo {
-	t.mu.RLock()
-	defer t.mu.RUnlock()
-	return t.myInfo
-}
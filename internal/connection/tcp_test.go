@@ -0,0 +1,322 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic/simulator"
+)
+
+func TestTCPTLS(t *testing.T) {
+	// Borrow httptest's certificate for 127.0.0.1
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	cert := srv.TLS.Certificates[0]
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	wake := make(chan []byte, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				buf := make([]byte, meshtastic.WakeSequenceLen)
+				if _, err := io.ReadFull(conn, buf); err == nil {
+					wake <- buf
+				}
+				_, _ = io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// An untrusted certificate fails the handshake at connect
+	conn, _ := NewTCP(config.TCPConfig{Host: "127.0.0.1", Port: port, TLS: config.TCPTLSConfig{Enabled: true}})
+	if err := conn.Connect(ctx); err == nil || !strings.Contains(err.Error(), "over tls") {
+		_ = conn.Close()
+		t.Fatalf("Connect with system roots: err = %v, want a tls error", err)
+	}
+
+	conn, _ = NewTCP(config.TCPConfig{Host: "127.0.0.1", Port: port, TLS: config.TCPTLSConfig{
+		Enabled:   true,
+		TLSConfig: config.TLSConfig{CACert: caFile},
+	}})
+	if err := conn.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	select {
+	case got := <-wake:
+		if !bytes.Equal(got, bytes.Repeat([]byte{meshtastic.Magic2}, meshtastic.WakeSequenceLen)) {
+			t.Errorf("wake sequence = % x", got)
+		}
+	case <-ctx.Done():
+		t.Fatal("server did not receive the wake sequence")
+	}
+}
+
+func TestTCPConfigRetry(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	// The device misses the first want_config and answers the second
+	var requests atomic.Int32
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		framer := meshtastic.NewStreamFramer(conn, conn)
+		for {
+			pkt, err := framer.ReadPacket()
+			if errors.Is(err, net.ErrClosed) || errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil || len(pkt) == 0 || pkt[0] != 0x18 {
+				continue
+			}
+			if requests.Add(1) == 2 {
+				_ = framer.WritePacket(simulator.EncodeFromRadio(1, nil, nil, nil, uint32(pkt[1])))
+			}
+		}
+	}()
+
+	conn, _ := NewTCP(config.TCPConfig{Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port})
+	conn.want.retry = 100 * time.Millisecond
+	if err := conn.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !conn.ConfigComplete() {
+		if time.Now().After(deadline) {
+			t.Fatalf("config not complete after %d requests", requests.Load())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if n := requests.Load(); n != 2 {
+		t.Errorf("want_config sent %d times, want 2", n)
+	}
+}
+
+func TestTCPSafeMode(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	// The device answers want_config and counts every other frame
+	var others atomic.Int32
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		framer := meshtastic.NewStreamFramer(conn, conn)
+		for {
+			pkt, err := framer.ReadPacket()
+			if errors.Is(err, net.ErrClosed) || errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil || len(pkt) == 0 {
+				continue
+			}
+			if pkt[0] != 0x18 {
+				others.Add(1)
+				continue
+			}
+			myInfo := simulator.EncodeMyNodeInfo(0x1234, 0)
+			_ = framer.WritePacket(simulator.EncodeFromRadio(1, nil, myInfo, nil, 0))
+			_ = framer.WritePacket(simulator.EncodeFromRadio(2, nil, nil, nil, uint32(pkt[1])))
+		}
+	}()
+
+	conn, err := New(&config.ConnectionConfig{
+		Type:     "tcp",
+		TCP:      config.TCPConfig{Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port},
+		SafeMode: true,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := conn.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !conn.(ConfigState).ConfigComplete() {
+		if time.Now().After(deadline) {
+			t.Fatal("config not complete")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	ctx := context.Background()
+	text := &message.Packet{To: 0x5678, PortNum: message.PortNumTextMessage, Payload: "hello"}
+	if err := conn.Send(ctx, text); !errors.Is(err, ErrSafeMode) {
+		t.Errorf("Send: got %v, want ErrSafeMode", err)
+	}
+	if err := conn.(AdminTransport).SendAdmin(ctx, &meshtastic.AdminMessage{GetCannedMessagesRequest: true}); !errors.Is(err, ErrSafeMode) {
+		t.Errorf("SendAdmin: got %v, want ErrSafeMode", err)
+	}
+	if err := conn.(XModemTransport).SendXModem(&meshtastic.XModem{}); !errors.Is(err, ErrSafeMode) {
+		t.Errorf("SendXModem: got %v, want ErrSafeMode", err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if n := others.Load(); n != 0 {
+		t.Errorf("device received %d frames besides want_config", n)
+	}
+}
+
+func TestTCPSimulator(t *testing.T) {
+	device := simulator.NewTestDevice(t)
+	defer device.Stop()
+	_, port, _ := net.SplitHostPort(device.StartTCP())
+	portNum, _ := strconv.Atoi(port)
+
+	connect := func() Connection {
+		t.Helper()
+		conn, err := New(&config.ConnectionConfig{Type: "tcp", TCP: config.TCPConfig{Host: "127.0.0.1", Port: portNum}})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		if err := conn.Connect(context.Background()); err != nil {
+			t.Fatalf("Connect: %v", err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for !conn.(ConfigState).ConfigComplete() {
+			if time.Now().After(deadline) {
+				t.Fatal("config not complete")
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		return conn
+	}
+
+	// Each client that connects gets the config and then the mesh traffic
+	for i := 0; i < 2; i++ {
+		conn := connect()
+		from := device.Config().SimulatedNodes[0].NodeNum
+		device.MustSendTextMessage(from, "over tcp")
+
+		deadline := time.After(5 * time.Second)
+	wait:
+		for {
+			select {
+			case p := <-conn.Messages():
+				if p.From == from && p.Text() == "over tcp" {
+					break wait
+				}
+			case <-deadline:
+				t.Fatalf("client %d: no text message", i)
+			}
+		}
+		_ = conn.Close()
+	}
+}
+
+func TestTCPImpairedSimulator(t *testing.T) {
+	cfg := simulator.DefaultConfig()
+	cfg.MessageInterval = 0
+	cfg.Seed = 1
+	cfg.Impairments = simulator.Impairments{Duplicate: 10, Corrupt: 10, Truncate: 10}
+	device := simulator.NewTestDeviceWithConfig(t, &cfg)
+	defer device.Stop()
+	_, port, _ := net.SplitHostPort(device.StartTCP())
+	portNum, _ := strconv.Atoi(port)
+
+	conn, err := New(&config.ConnectionConfig{Type: "tcp", TCP: config.TCPConfig{Host: "127.0.0.1", Port: portNum}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := conn.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// The framer resyncs after corrupt and truncated frames, so most
+	// messages still arrive, some of them twice
+	from := cfg.SimulatedNodes[0].NodeNum
+	const sent = 100
+	go func() {
+		for !device.ConfigSent() {
+			time.Sleep(10 * time.Millisecond)
+		}
+		for i := 0; i < sent; i++ {
+			if device.SendTextMessage(from, fmt.Sprintf("message %d", i)) != nil {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	seen := make(map[uint32]bool)
+	received, duplicates := 0, 0
+	timeout := time.After(3 * time.Second)
+collect:
+	for {
+		select {
+		case p := <-conn.Messages():
+			if !strings.HasPrefix(p.Text(), "message ") {
+				continue
+			}
+			if seen[p.ID] {
+				duplicates++
+				continue
+			}
+			seen[p.ID] = true
+			received++
+		case <-timeout:
+			break collect
+		}
+	}
+	if received < sent/2 || duplicates == 0 {
+		t.Errorf("received %d of %d messages, %d duplicates", received, sent, duplicates)
+	}
+}
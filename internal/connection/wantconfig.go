@@ -0,0 +1,139 @@
+package connection
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+const (
+	// DefaultConfigTimeout is how long the device's configuration is
+	// requested before giving up
+	DefaultConfigTimeout = 2 * time.Minute
+
+	// configRetryDelay is the wait before the first repeated request; it
+	// doubles up to maxConfigRetryDelay
+	configRetryDelay    = 2 * time.Second
+	maxConfigRetryDelay = 30 * time.Second
+)
+
+// configRequester is implemented by connections that request the device's
+// configuration on connect
+type configRequester interface {
+	configureConfigTimeout(timeout time.Duration)
+}
+
+// wantConfig tracks the request for the device's configuration. The zero
+// value retries until DefaultConfigTimeout.
+type wantConfig struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	retry   time.Duration
+	done    bool
+	// progress is when the device last sent part of its configuration
+	progress time.Time
+}
+
+func (s *stream) configureConfigTimeout(timeout time.Duration) {
+	s.want.mu.Lock()
+	defer s.want.mu.Unlock()
+	s.want.timeout = timeout
+}
+
+// ConfigComplete reports whether the device has finished sending its
+// configuration since connecting
+func (s *stream) ConfigComplete() bool {
+	s.want.mu.Lock()
+	defer s.want.mu.Unlock()
+	return s.want.done
+}
+
+// start begins a new request and returns its timeout and first retry
+// delay
+func (w *wantConfig) start() (timeout, retry time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.done = false
+	w.progress = time.Time{}
+	timeout, retry = w.timeout, w.retry
+	if timeout <= 0 {
+		timeout = DefaultConfigTimeout
+	}
+	if retry <= 0 {
+		retry = configRetryDelay
+	}
+	return timeout, retry
+}
+
+// received records a frame that is part of the configuration
+func (w *wantConfig) received() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.progress = time.Now()
+}
+
+// complete records the end of the configuration
+func (w *wantConfig) complete() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.done = true
+	w.progress = time.Now()
+}
+
+// state returns whether the configuration is complete and when part of it
+// last arrived
+func (w *wantConfig) state() (bool, time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.done, w.progress
+}
+
+// requestConfig asks the device for its configuration, node DB included,
+// and asks again with backoff until it is complete or the timeout passes.
+// A device still sending is left to finish, since a new request restarts
+// the transfer.
+func (s *stream) requestConfig(stopCh <-chan struct{}) {
+	timeout, delay := s.want.start()
+	deadline := time.Now().Add(timeout)
+
+	// Wait a moment for the connection to stabilize
+	select {
+	case <-stopCh:
+		return
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	var since time.Time
+	for requests := 0; ; {
+		// Parts of the configuration arriving during the last wait mean
+		// the device is still sending
+		if _, progress := s.want.state(); requests == 0 || !progress.After(since) {
+			requests++
+			s.logger.Debug("Requesting initial configuration", zap.Int("attempt", requests))
+			if err := s.writeToRadio(&meshtastic.ToRadio{WantConfigID: 1}); err != nil {
+				s.logger.Warn("Failed to request config", zap.Error(err))
+			}
+		}
+		since = time.Now()
+
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(min(delay, max(time.Until(deadline), 0))):
+		}
+
+		if done, _ := s.want.state(); done {
+			return
+		}
+		if time.Until(deadline) <= 0 {
+			s.logger.Error("Device did not finish sending its configuration; node info may be missing",
+				zap.Duration("timeout", timeout),
+				zap.Int("requests", requests))
+			return
+		}
+		delay = min(delay*2, maxConfigRetryDelay)
+	}
+}
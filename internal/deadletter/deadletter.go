@@ -0,0 +1,226 @@
+// Package deadletter keeps messages that an output could not take, after
+// its retries and fallbacks, on disk so an outage of a webhook or Apprise
+// server does not lose them. They are delivered again later, oldest
+// first.
+//
+// The queue is a JSON Lines file: failed messages are appended as they
+// fail, and the file is rewritten after each redelivery pass.
+package deadletter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/state"
+)
+
+// Entry is a message an output could not take
+type Entry struct {
+	ID       uint64          `json:"id"`
+	Output   string          `json:"output"` // the output's type and destination
+	Packet   *message.Packet `json:"packet"`
+	Failed   time.Time       `json:"failed"`   // when the first delivery failed
+	Attempts int             `json:"attempts"` // deliveries tried, the first included
+	Error    string          `json:"error"`    // why the last delivery failed
+}
+
+// Queue holds the undelivered messages. It is safe for concurrent use.
+type Queue struct {
+	cfg config.DeadLetterConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries []*Entry
+	nextID  uint64
+}
+
+// Open loads the undelivered messages from cfg.Path. A missing file
+// starts an empty queue.
+func Open(cfg config.DeadLetterConfig) (*Queue, error) {
+	q := &Queue{cfg: cfg, now: time.Now, nextID: 1}
+
+	err := state.Load(cfg.Path, func(data []byte) error {
+		var entries []*Entry
+		nextID := uint64(1)
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			var e Entry
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				// A crash can cut the last append short; skip it rather
+				// than refuse to start
+				continue
+			}
+			if e.Packet == nil {
+				continue
+			}
+			entries = append(entries, &e)
+			nextID = max(nextID, e.ID+1)
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		q.entries, q.nextID = entries, nextID
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead letters: %w", err)
+	}
+	return q, nil
+}
+
+// Add keeps a message that output failed to take with err
+func (q *Queue) Add(output string, p *message.Packet, cause error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e := &Entry{ID: q.nextID, Output: output, Packet: p, Failed: q.now(), Attempts: 1}
+	if cause != nil {
+		e.Error = cause.Error()
+	}
+	q.nextID++
+	q.entries = append(q.entries, e)
+
+	if q.cfg.MaxMessages > 0 && len(q.entries) > q.cfg.MaxMessages {
+		q.entries = q.entries[len(q.entries)-q.cfg.MaxMessages:]
+		return q.save()
+	}
+	return q.append(e)
+}
+
+// Len returns how many messages are waiting
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// List returns copies of the waiting messages, oldest first
+func (q *Queue) List() []Entry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := make([]Entry, len(q.entries))
+	for i, e := range q.entries {
+		list[i] = *e
+	}
+	return list
+}
+
+// Result counts what a redelivery pass did
+type Result struct {
+	Delivered int
+	Failed    int
+	Expired   int
+}
+
+// Redeliver tries each waiting message again with send, oldest first.
+// Once a message for an output fails, the output's later messages wait
+// for the next pass so they stay in order. Messages older than the
+// maximum age are dropped.
+func (q *Queue) Redeliver(ctx context.Context, send func(ctx context.Context, output string, p *message.Packet) error) (Result, error) {
+	q.mu.Lock()
+	pending := make([]Entry, len(q.entries))
+	for i, e := range q.entries {
+		pending[i] = *e
+	}
+	q.mu.Unlock()
+
+	var res Result
+	now := q.now()
+	done := make(map[uint64]bool)
+	failed := make(map[uint64]error)
+	down := make(map[string]bool)
+	for _, e := range pending {
+		switch {
+		case q.cfg.MaxAge > 0 && now.Sub(e.Failed) >= q.cfg.MaxAge:
+			done[e.ID] = true
+			res.Expired++
+		case down[e.Output] || ctx.Err() != nil:
+		default:
+			if err := send(ctx, e.Output, e.Packet); err != nil {
+				failed[e.ID] = err
+				down[e.Output] = true
+				res.Failed++
+			} else {
+				done[e.ID] = true
+				res.Delivered++
+			}
+		}
+	}
+	if len(done) == 0 && len(failed) == 0 {
+		return res, nil
+	}
+
+	// Messages added during the pass are kept
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	kept := q.entries[:0]
+	for _, e := range q.entries {
+		if done[e.ID] {
+			continue
+		}
+		if err, ok := failed[e.ID]; ok {
+			e.Attempts++
+			e.Error = err.Error()
+		}
+		kept = append(kept, e)
+	}
+	clear(q.entries[len(kept):])
+	q.entries = kept
+	return res, q.save()
+}
+
+// append writes one entry to the end of the file. The caller holds q.mu.
+func (q *Queue) append(e *Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode dead letter: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(q.cfg.Path), 0o755); err != nil {
+		return fmt.Errorf("failed to create dead letter directory: %w", err)
+	}
+	f, err := os.OpenFile(q.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write dead letter: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write dead letter: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write dead letter: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write dead letter: %w", err)
+	}
+	return nil
+}
+
+// save rewrites the file with the waiting messages. The caller holds q.mu.
+func (q *Queue) save() error {
+	var data []byte
+	for _, e := range q.entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to encode dead letter: %w", err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if err := state.WriteFile(q.cfg.Path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write dead letters: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestQueue(t *testing.T) {
+	cfg := config.DeadLetterConfig{
+		Path:        filepath.Join(t.TempDir(), "dead", "letters.jsonl"),
+		MaxAge:      time.Hour,
+		MaxMessages: 3,
+	}
+	q, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Unix(1_700_000_000, 0)
+	q.now = func() time.Time { return at }
+
+	text := func(id uint32, s string) *message.Packet {
+		return &message.Packet{ID: id, From: 7, PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: s}}
+	}
+	down := errors.New("502 Bad Gateway")
+	for i, p := range []*message.Packet{text(1, "one"), text(2, "two"), text(3, "three"), text(4, "four")} {
+		output := "webhook:http://a"
+		if i == 2 {
+			output = "apprise:http://b"
+		}
+		if err := q.Add(output, p, down); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The oldest message made room for the fourth, and the rest survive a
+	// restart
+	q, err = Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.now = func() time.Time { return at.Add(time.Minute) }
+	list := q.List()
+	if len(list) != 3 || list[0].Packet.ID != 2 || list[0].Error != "502 Bad Gateway" {
+		t.Fatalf("entries = %+v", list)
+	}
+	if tm, ok := list[0].Packet.Payload.(*message.TextMessage); !ok || tm.Text != "two" {
+		t.Errorf("payload = %#v", list[0].Packet.Payload)
+	}
+
+	// The webhook is still down, so its later message waits its turn
+	var sent []uint32
+	res, err := q.Redeliver(context.Background(), func(_ context.Context, output string, p *message.Packet) error {
+		sent = append(sent, p.ID)
+		if output == "webhook:http://a" {
+			return down
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (Result{Delivered: 1, Failed: 1}) || len(sent) != 2 || sent[0] != 2 || sent[1] != 3 {
+		t.Errorf("result = %+v, sent = %v", res, sent)
+	}
+	list = q.List()
+	if len(list) != 2 || list[0].Packet.ID != 2 || list[0].Attempts != 2 || list[1].Attempts != 1 {
+		t.Errorf("entries after redelivery = %+v", list)
+	}
+
+	// Messages past the maximum age are dropped
+	q.now = func() time.Time { return at.Add(2 * time.Hour) }
+	res, err = q.Redeliver(context.Background(), func(context.Context, string, *message.Packet) error {
+		t.Error("expired message sent")
+		return nil
+	})
+	if err != nil || res.Expired != 2 || q.Len() != 0 {
+		t.Errorf("result = %+v, len = %d, err = %v", res, q.Len(), err)
+	}
+	data, err := os.ReadFile(cfg.Path)
+	if err != nil || len(data) != 0 {
+		t.Errorf("file = %q, %v", data, err)
+	}
+}
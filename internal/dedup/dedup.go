@@ -0,0 +1,183 @@
+// Package dedup drops packets the relay has already handled, such as the
+// same packet arriving over serial and MQTT or through several gateways.
+package dedup
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/state"
+)
+
+// key identifies a packet on the mesh. Packet IDs are chosen by the
+// sender, so they are only unique per sending node.
+type key struct {
+	from uint32
+	id   uint32
+}
+
+// record is the on-disk form of a remembered packet
+type record struct {
+	From uint32    `json:"from"`
+	ID   uint32    `json:"id"`
+	At   time.Time `json:"at"`
+}
+
+// Filter remembers the packets seen within a time window. It is safe for
+// concurrent use.
+type Filter struct {
+	window time.Duration
+	path   string
+	now    func() time.Time
+
+	mu     sync.Mutex
+	seen   map[key]time.Time
+	pruned time.Time
+	dirty  bool
+}
+
+// New creates a filter, loading the packets remembered in cfg.StateFile
+func New(cfg config.DedupConfig) (*Filter, error) {
+	f := &Filter{
+		window: cfg.Window,
+		path:   cfg.StateFile,
+		now:    time.Now,
+		seen:   make(map[key]time.Time),
+	}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	f.pruned = f.now()
+	return f, nil
+}
+
+// Duplicate records p and reports whether it was already seen within the
+// window. Packets without an ID cannot be matched and are never duplicates.
+func (f *Filter) Duplicate(p *message.Packet) bool {
+	if p.ID == 0 {
+		return false
+	}
+	now := f.now()
+	k := key{from: p.From, id: p.ID}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if now.Sub(f.pruned) >= f.window {
+		f.prune(now)
+	}
+	if at, ok := f.seen[k]; ok && now.Sub(at) < f.window {
+		return true
+	}
+	f.seen[k] = now
+	f.dirty = true
+	return false
+}
+
+// Mark records a packet handled elsewhere, such as by another relay in a
+// cluster, so it is a duplicate if it arrives here within the window
+func (f *Filter) Mark(from, id uint32, at time.Time) {
+	if id == 0 {
+		return
+	}
+	now := f.now()
+	if at.IsZero() || at.After(now) {
+		at = now
+	}
+	if now.Sub(at) >= f.window {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	k := key{from: from, id: id}
+	if seen, ok := f.seen[k]; !ok || at.After(seen) {
+		f.seen[k] = at
+		f.dirty = true
+	}
+}
+
+// Len returns how many packets are remembered
+func (f *Filter) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.seen)
+}
+
+// prune forgets packets older than the window. f.mu must be held.
+func (f *Filter) prune(now time.Time) {
+	for k, at := range f.seen {
+		if now.Sub(at) >= f.window {
+			delete(f.seen, k)
+			f.dirty = true
+		}
+	}
+	f.pruned = now
+}
+
+// Save writes the remembered packets to the state file if they changed
+func (f *Filter) Save() error {
+	if f.path == "" {
+		return nil
+	}
+
+	f.mu.Lock()
+	if !f.dirty {
+		f.mu.Unlock()
+		return nil
+	}
+	f.prune(f.now())
+	records := make([]record, 0, len(f.seen))
+	for k, at := range f.seen {
+		records = append(records, record{From: k.from, ID: k.id, At: at})
+	}
+	f.dirty = false
+	f.mu.Unlock()
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		err = fmt.Errorf("failed to encode dedup state: %w", err)
+	} else if err = state.WriteFile(f.path, data, 0o644); err != nil {
+		err = fmt.Errorf("failed to write dedup state: %w", err)
+	}
+	if err != nil {
+		// Try again on the next save
+		f.mu.Lock()
+		f.dirty = true
+		f.mu.Unlock()
+	}
+	return err
+}
+
+// Close saves the remembered packets
+func (f *Filter) Close() error {
+	return f.Save()
+}
+
+func (f *Filter) load() error {
+	if f.path == "" {
+		return nil
+	}
+
+	err := state.Load(f.path, func(data []byte) error {
+		var records []record
+		if err := json.Unmarshal(data, &records); err != nil {
+			return err
+		}
+		now := f.now()
+		for _, r := range records {
+			if now.Sub(r.At) < f.window {
+				f.seen[key{from: r.From, id: r.ID}] = r.At
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read dedup state: %w", err)
+	}
+	return nil
+}
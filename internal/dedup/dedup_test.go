@@ -0,0 +1,85 @@
+package dedup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestDuplicate(t *testing.T) {
+	f, err := New(config.DedupConfig{Window: 10 * time.Minute})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	f.now = func() time.Time { return now }
+
+	p := &message.Packet{From: 1, ID: 42}
+	if f.Duplicate(p) {
+		t.Fatal("first packet reported as duplicate")
+	}
+	if !f.Duplicate(&message.Packet{From: 1, ID: 42}) {
+		t.Error("second copy not reported as duplicate")
+	}
+	if f.Duplicate(&message.Packet{From: 2, ID: 42}) {
+		t.Error("same ID from another node reported as duplicate")
+	}
+	if f.Duplicate(&message.Packet{From: 1}) || f.Duplicate(&message.Packet{From: 1}) {
+		t.Error("packets without an ID reported as duplicate")
+	}
+
+	now = now.Add(10 * time.Minute)
+	if f.Duplicate(p) {
+		t.Error("packet still remembered after the window")
+	}
+}
+
+func TestStatePersists(t *testing.T) {
+	cfg := config.DedupConfig{Window: time.Hour, StateFile: filepath.Join(t.TempDir(), "state", "dedup.json")}
+	f, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	f.Duplicate(&message.Packet{From: 1, ID: 7})
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	f, err = New(cfg)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if !f.Duplicate(&message.Packet{From: 1, ID: 7}) {
+		t.Error("packet relayed before the restart not reported as duplicate")
+	}
+}
+
+func TestFailedSaveRetried(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.json")
+	f, err := New(config.DedupConfig{Window: time.Hour, StateFile: path})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	f.Duplicate(&message.Packet{From: 1, ID: 7})
+
+	// A directory in the way makes the write fail
+	if err := os.MkdirAll(filepath.Join(path, "blocker"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Save(); err == nil {
+		t.Fatal("Save succeeded with a directory in place of the state file")
+	}
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("state not written after the failed save: %v", err)
+	}
+}
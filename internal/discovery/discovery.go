@@ -0,0 +1,190 @@
+// Package discovery finds Meshtastic devices on the local network.
+//
+// Two mechanisms are used: an active mDNS query for the _meshtastic._tcp
+// service that network-capable firmware advertises, and a passive listen on
+// the Meshtastic UDP multicast group where devices broadcast mesh packets.
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Discovery constants
+const (
+	// ServiceName is the mDNS service advertised by Meshtastic firmware
+	ServiceName = "_meshtastic._tcp.local."
+
+	// DefaultPort is the TCP API port used by Meshtastic devices
+	DefaultPort = 4403
+
+	// DefaultTimeout is how long to listen for responses
+	DefaultTimeout = 3 * time.Second
+)
+
+var (
+	mdnsAddr      = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+	multicastAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 69), Port: DefaultPort}
+)
+
+// ErrNoDevices indicates that discovery completed without finding a device
+var ErrNoDevices = errors.New("no meshtastic devices found")
+
+// Device describes a Meshtastic device found on the network
+type Device struct {
+	// Name is the advertised instance name (may be empty for passive finds)
+	Name string `json:"name,omitempty"`
+	// Hostname is the advertised mDNS host name
+	Hostname string `json:"hostname,omitempty"`
+	// Host is the IP address to connect to
+	Host string `json:"host"`
+	// Port is the TCP API port
+	Port int `json:"port"`
+	// Source is how the device was found (mdns, multicast)
+	Source string `json:"source"`
+	// TXT holds any advertised TXT key/value pairs
+	TXT map[string]string `json:"txt,omitempty"`
+}
+
+// Address returns the host:port dial address for the device
+func (d *Device) Address() string {
+	return net.JoinHostPort(d.Host, fmt.Sprintf("%d", d.Port))
+}
+
+// Options controls a discovery run
+type Options struct {
+	// Timeout is how long to wait for responses
+	Timeout time.Duration
+	// Passive also listens on the Meshtastic UDP multicast group
+	Passive bool
+}
+
+// Discover searches the local network for Meshtastic devices.
+// Results are de-duplicated by host and sorted by address.
+func Discover(ctx context.Context, opts Options) ([]Device, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		devices = make(map[string]Device)
+		wg      sync.WaitGroup
+	)
+
+	add := func(d Device) {
+		mu.Lock()
+		defer mu.Unlock()
+		// Prefer mDNS results since they carry names and ports
+		if existing, ok := devices[d.Host]; ok && existing.Source == "mdns" {
+			return
+		}
+		devices[d.Host] = d
+	}
+
+	var mdnsErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		mdnsErr = queryMDNS(ctx, add)
+	}()
+
+	if opts.Passive {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Passive listening is best-effort; the group may be unavailable
+			_ = listenMulticast(ctx, add)
+		}()
+	}
+
+	wg.Wait()
+
+	result := make([]Device, 0, len(devices))
+	for _, d := range devices {
+		result = append(result, d)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Host < result[j].Host
+	})
+
+	if len(result) == 0 && mdnsErr != nil {
+		return nil, mdnsErr
+	}
+	return result, nil
+}
+
+// First returns the first device found, for use with connection.tcp.host "auto"
+func First(ctx context.Context, timeout time.Duration) (*Device, error) {
+	devices, err := Discover(ctx, Options{Timeout: timeout, Passive: true})
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, ErrNoDevices
+	}
+	return &devices[0], nil
+}
+
+// queryMDNS sends a one-shot mDNS query and collects unicast responses
+func queryMDNS(ctx context.Context, add func(Device)) error {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+	if err != nil {
+		return fmt.Errorf("failed to open mdns socket: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.WriteToUDP(BuildQuery(ServiceName), mdnsAddr); err != nil {
+		return fmt.Errorf("failed to send mdns query: %w", err)
+	}
+
+	return readUntilDone(ctx, conn, func(data []byte, from *net.UDPAddr) {
+		for _, d := range ParseResponse(data, from.IP) {
+			add(d)
+		}
+	})
+}
+
+// listenMulticast records the source of any datagram sent to the mesh group
+func listenMulticast(ctx context.Context, add func(Device)) error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, multicastAddr)
+	if err != nil {
+		return fmt.Errorf("failed to join multicast group: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	return readUntilDone(ctx, conn, func(_ []byte, from *net.UDPAddr) {
+		add(Device{
+			Host:   from.IP.String(),
+			Port:   DefaultPort,
+			Source: "multicast",
+		})
+	})
+}
+
+func readUntilDone(ctx context.Context, conn *net.UDPConn, handle func([]byte, *net.UDPAddr)) error {
+	buf := make([]byte, 9000)
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+		handle(buf[:n], from)
+	}
+}
@@ -0,0 +1,234 @@
+package discovery
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+)
+
+// DNS record types used by mDNS service discovery
+const (
+	typeA    uint16 = 1
+	typePTR  uint16 = 12
+	typeTXT  uint16 = 16
+	typeAAAA uint16 = 28
+	typeSRV  uint16 = 33
+
+	classIN         uint16 = 1
+	classUnicastBit uint16 = 0x8000
+
+	// maxPointerJumps bounds name decompression to prevent loops
+	maxPointerJumps = 16
+)
+
+// BuildQuery builds an mDNS PTR query for the given service name.
+// The QU bit is set so responders answer directly to our ephemeral port.
+func BuildQuery(service string) []byte {
+	msg := make([]byte, 12, 64)
+	binary.BigEndian.PutUint16(msg[4:6], 1) // QDCOUNT
+
+	msg = appendName(msg, service)
+	msg = binary.BigEndian.AppendUint16(msg, typePTR)
+	msg = binary.BigEndian.AppendUint16(msg, classIN|classUnicastBit)
+	return msg
+}
+
+func appendName(msg []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	return append(msg, 0)
+}
+
+type srvRecord struct {
+	target string
+	port   uint16
+}
+
+// ParseResponse extracts Meshtastic devices from an mDNS response.
+// The source address is used when the response carries no address records.
+// Malformed messages yield whatever was parsed before the error.
+func ParseResponse(data []byte, source net.IP) []Device {
+	if len(data) < 12 {
+		return nil
+	}
+
+	qdCount := int(binary.BigEndian.Uint16(data[4:6]))
+	rrCount := int(binary.BigEndian.Uint16(data[6:8])) +
+		int(binary.BigEndian.Uint16(data[8:10])) +
+		int(binary.BigEndian.Uint16(data[10:12]))
+
+	pos := 12
+	for i := 0; i < qdCount; i++ {
+		_, n, ok := readName(data, pos)
+		if !ok || n+4 > len(data) {
+			return nil
+		}
+		pos = n + 4
+	}
+
+	var (
+		instances []string
+		srvs      = make(map[string]srvRecord)
+		txts      = make(map[string]map[string]string)
+		addrs     = make(map[string][]net.IP)
+	)
+
+	for i := 0; i < rrCount; i++ {
+		name, n, ok := readName(data, pos)
+		if !ok || n+10 > len(data) {
+			break
+		}
+		rrType := binary.BigEndian.Uint16(data[n : n+2])
+		rdLen := int(binary.BigEndian.Uint16(data[n+8 : n+10]))
+		rdStart := n + 10
+		if rdStart+rdLen > len(data) {
+			break
+		}
+		rdata := data[rdStart : rdStart+rdLen]
+		pos = rdStart + rdLen
+
+		switch rrType {
+		case typePTR:
+			if !strings.EqualFold(name, ServiceName) {
+				continue
+			}
+			if target, _, ok := readName(data, rdStart); ok {
+				instances = append(instances, target)
+			}
+		case typeSRV:
+			if rdLen < 7 {
+				continue
+			}
+			if target, _, ok := readName(data, rdStart+6); ok {
+				srvs[strings.ToLower(name)] = srvRecord{
+					target: target,
+					port:   binary.BigEndian.Uint16(rdata[4:6]),
+				}
+			}
+		case typeTXT:
+			txts[strings.ToLower(name)] = parseTXT(rdata)
+		case typeA:
+			if rdLen == net.IPv4len {
+				addrs[strings.ToLower(name)] = append(addrs[strings.ToLower(name)], net.IP(append([]byte(nil), rdata...)))
+			}
+		case typeAAAA:
+			if rdLen == net.IPv6len {
+				addrs[strings.ToLower(name)] = append(addrs[strings.ToLower(name)], net.IP(append([]byte(nil), rdata...)))
+			}
+		}
+	}
+
+	devices := make([]Device, 0, len(instances))
+	for _, instance := range instances {
+		d := Device{
+			Name:   instanceLabel(instance),
+			Port:   DefaultPort,
+			Source: "mdns",
+			TXT:    txts[strings.ToLower(instance)],
+		}
+
+		if srv, ok := srvs[strings.ToLower(instance)]; ok {
+			d.Hostname = strings.TrimSuffix(srv.target, ".")
+			if srv.port != 0 {
+				d.Port = int(srv.port)
+			}
+			d.Host = pickAddress(addrs[strings.ToLower(srv.target)])
+		}
+
+		if d.Host == "" && source != nil {
+			d.Host = source.String()
+		}
+		if d.Host == "" {
+			continue
+		}
+		devices = append(devices, d)
+	}
+
+	return devices
+}
+
+// readName decodes a possibly-compressed DNS name starting at pos.
+// It returns the name with a trailing dot and the offset just past it.
+func readName(data []byte, pos int) (name string, next int, ok bool) {
+	var labels []string
+	jumps := 0
+	next = -1
+
+	for {
+		if pos >= len(data) {
+			return "", 0, false
+		}
+		length := int(data[pos])
+
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = pos + 1
+			}
+			return strings.Join(labels, ".") + ".", next, true
+
+		case length&0xC0 == 0xC0:
+			if pos+1 >= len(data) || jumps >= maxPointerJumps {
+				return "", 0, false
+			}
+			if next < 0 {
+				next = pos + 2
+			}
+			pos = int(binary.BigEndian.Uint16(data[pos:pos+2]) & 0x3FFF)
+			jumps++
+
+		default:
+			if pos+1+length > len(data) {
+				return "", 0, false
+			}
+			labels = append(labels, string(data[pos+1:pos+1+length]))
+			pos += 1 + length
+		}
+	}
+}
+
+func parseTXT(rdata []byte) map[string]string {
+	txt := make(map[string]string)
+	for pos := 0; pos < len(rdata); {
+		length := int(rdata[pos])
+		pos++
+		if pos+length > len(rdata) {
+			break
+		}
+		entry := string(rdata[pos : pos+length])
+		pos += length
+
+		key, value, _ := strings.Cut(entry, "=")
+		if key != "" {
+			txt[key] = value
+		}
+	}
+	return txt
+}
+
+// instanceLabel returns the instance portion of a full service instance name
+func instanceLabel(instance string) string {
+	label := strings.TrimSuffix(instance, ".")
+	if idx := strings.Index(strings.ToLower(label), "."+strings.TrimSuffix(ServiceName, ".")); idx > 0 {
+		return label[:idx]
+	}
+	return label
+}
+
+// pickAddress prefers IPv4 addresses, falling back to the first IPv6 address
+func pickAddress(ips []net.IP) string {
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip.String()
+		}
+	}
+	if len(ips) > 0 {
+		return ips[0].String()
+	}
+	return ""
+}
@@ -0,0 +1,127 @@
+package discovery
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func appendRR(msg []byte, name []byte, rrType uint16, rdata []byte) []byte {
+	msg = append(msg, name...)
+	msg = binary.BigEndian.AppendUint16(msg, rrType)
+	msg = binary.BigEndian.AppendUint16(msg, classIN)
+	msg = binary.BigEndian.AppendUint32(msg, 120)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(rdata)))
+	return append(msg, rdata...)
+}
+
+func buildResponse() []byte {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[2:4], 0x8400)
+	binary.BigEndian.PutUint16(msg[6:8], 2)   // ANCOUNT
+	binary.BigEndian.PutUint16(msg[10:12], 2) // ARCOUNT
+
+	// PTR _meshtastic._tcp.local -> Meshtastic_abcd._meshtastic._tcp.local
+	serviceOffset := len(msg)
+	service := appendName(nil, ServiceName)
+	instance := append([]byte{15}, "Meshtastic_abcd"...)
+	instance = append(instance, 0xC0, byte(serviceOffset))
+	msg = appendRR(msg, service, typePTR, instance)
+
+	// SRV for the instance (name compressed to the PTR rdata)
+	instanceOffset := len(msg) - len(instance)
+	instanceRef := []byte{0xC0, byte(instanceOffset)}
+	srv := []byte{0, 0, 0, 0}
+	srv = binary.BigEndian.AppendUint16(srv, 4403)
+	srv = appendName(srv, "meshtastic-abcd.local.")
+	msg = appendRR(msg, instanceRef, typeSRV, srv)
+
+	// TXT for the instance
+	txt := append([]byte{13}, "shortname=ABC"...)
+	txt = append(txt, append([]byte{12}, "id=!deadbeef"...)...)
+	msg = appendRR(msg, instanceRef, typeTXT, txt)
+
+	// A record for the host
+	msg = appendRR(msg, appendName(nil, "meshtastic-abcd.local."), typeA, []byte{192, 168, 1, 42})
+
+	return msg
+}
+
+func TestBuildQuery(t *testing.T) {
+	query := BuildQuery(ServiceName)
+
+	if got := binary.BigEndian.Uint16(query[4:6]); got != 1 {
+		t.Errorf("Expected QDCOUNT 1, got %d", got)
+	}
+
+	name, next, ok := readName(query, 12)
+	if !ok {
+		t.Fatal("Failed to read question name")
+	}
+	if name != ServiceName {
+		t.Errorf("Expected name %q, got %q", ServiceName, name)
+	}
+	if qtype := binary.BigEndian.Uint16(query[next : next+2]); qtype != typePTR {
+		t.Errorf("Expected PTR query, got type %d", qtype)
+	}
+	if qclass := binary.BigEndian.Uint16(query[next+2 : next+4]); qclass&classUnicastBit == 0 {
+		t.Error("Expected QU bit to be set")
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	devices := ParseResponse(buildResponse(), net.IPv4(10, 0, 0, 1))
+
+	if len(devices) != 1 {
+		t.Fatalf("Expected 1 device, got %d", len(devices))
+	}
+
+	d := devices[0]
+	if d.Name != "Meshtastic_abcd" {
+		t.Errorf("Expected name Meshtastic_abcd, got %q", d.Name)
+	}
+	if d.Host != "192.168.1.42" {
+		t.Errorf("Expected host from A record, got %q", d.Host)
+	}
+	if d.Port != 4403 {
+		t.Errorf("Expected port 4403, got %d", d.Port)
+	}
+	if d.Hostname != "meshtastic-abcd.local" {
+		t.Errorf("Expected hostname meshtastic-abcd.local, got %q", d.Hostname)
+	}
+	if d.TXT["shortname"] != "ABC" || d.TXT["id"] != "!deadbeef" {
+		t.Errorf("Unexpected TXT records: %v", d.TXT)
+	}
+}
+
+func TestParseResponseFallsBackToSource(t *testing.T) {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[6:8], 1)
+	instance := appendName(nil, "node._meshtastic._tcp.local.")
+	msg = appendRR(msg, appendName(nil, ServiceName), typePTR, instance)
+
+	devices := ParseResponse(msg, net.IPv4(10, 0, 0, 7))
+	if len(devices) != 1 {
+		t.Fatalf("Expected 1 device, got %d", len(devices))
+	}
+	if devices[0].Host != "10.0.0.7" {
+		t.Errorf("Expected source address, got %q", devices[0].Host)
+	}
+}
+
+func TestParseResponseMalformed(t *testing.T) {
+	msg := buildResponse()
+
+	// Truncated data must not panic
+	for i := 0; i < len(msg); i++ {
+		_ = ParseResponse(msg[:i], nil)
+	}
+
+	// Self-referencing compression pointer must terminate
+	loop := make([]byte, 12)
+	binary.BigEndian.PutUint16(loop[6:8], 1)
+	loop = append(loop, 0xC0, 12)
+	if devices := ParseResponse(loop, nil); len(devices) != 0 {
+		t.Errorf("Expected no devices from looping message, got %d", len(devices))
+	}
+}
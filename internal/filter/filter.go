@@ -0,0 +1,221 @@
+// Package filter evaluates filter expressions against packets, e.g.
+//
+//	portnum == "TEXT_MESSAGE_APP" && channel in [0, 1] && rssi > -110
+//
+// Expressions combine comparisons of packet fields with &&, ||, !, and
+// parentheses. Comparisons are ==, !=, <, <=, >, >=, in and not in a
+// list, contains for substrings, and matches for regular expressions.
+// Node fields compare with node ids written as "!1234abcd".
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// kind is the type of a value in an expression
+type kind int
+
+const (
+	kindNumber kind = iota
+	kindString
+	kindBool
+)
+
+func (k kind) String() string {
+	switch k {
+	case kindNumber:
+		return "number"
+	case kindString:
+		return "string"
+	default:
+		return "bool"
+	}
+}
+
+// field is a packet field expressions can refer to
+type field struct {
+	kind kind
+	node bool // a node number, comparable with "!1234abcd"
+	get  func(p *message.Packet) any
+}
+
+var fields = map[string]field{
+	"id":      {kind: kindNumber, get: func(p *message.Packet) any { return float64(p.ID) }},
+	"from":    {kind: kindNumber, node: true, get: func(p *message.Packet) any { return float64(p.From) }},
+	"to":      {kind: kindNumber, node: true, get: func(p *message.Packet) any { return float64(p.To) }},
+	"channel": {kind: kindNumber, get: func(p *message.Packet) any { return float64(p.Channel) }},
+	"portnum": {kind: kindString, get: func(p *message.Packet) any { return p.PortNum.String() }},
+	"port":    {kind: kindNumber, get: func(p *message.Packet) any { return float64(p.PortNum) }},
+	"rssi":    {kind: kindNumber, get: func(p *message.Packet) any { return float64(p.RSSI) }},
+	"snr":     {kind: kindNumber, get: func(p *message.Packet) any { return float64(p.SNR) }},
+	"hop_limit": {kind: kindNumber, get: func(p *message.Packet) any {
+		return float64(p.HopLimit)
+	}},
+	"want_ack": {kind: kindBool, get: func(p *message.Packet) any { return p.WantAck }},
+	"broadcast": {kind: kindBool, get: func(p *message.Packet) any {
+		return p.To == 0xFFFFFFFF
+	}},
+	"text": {kind: kindString, get: func(p *message.Packet) any {
+		text, _ := textOf(p)
+		return text
+	}},
+	"from_name": {kind: kindString, get: func(p *message.Packet) any {
+		if p.FromNode != nil && p.FromNode.User != nil {
+			return p.FromNode.User.LongName
+		}
+		return ""
+	}},
+	"from_short": {kind: kindString, get: func(p *message.Packet) any {
+		if p.FromNode != nil && p.FromNode.User != nil {
+			return p.FromNode.User.ShortName
+		}
+		return ""
+	}},
+	"channel_name": {kind: kindString, get: func(p *message.Packet) any { return p.ChannelName }},
+	"gateway":      {kind: kindString, get: func(p *message.Packet) any { return p.GatewayID }},
+}
+
+// textOf returns the text of a text message packet
+func textOf(p *message.Packet) (string, bool) {
+	switch v := p.Payload.(type) {
+	case *message.TextMessage:
+		return v.Text, true
+	case string:
+		return v, true
+	}
+	return "", false
+}
+
+// Fields returns the names of the packet fields expressions can use
+func Fields() []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Expr is a compiled filter expression. It is safe for concurrent use.
+type Expr struct {
+	src  string
+	root node
+}
+
+// Compile parses and type checks an expression
+func Compile(src string) (*Expr, error) {
+	p := &parser{lex: lexer{src: src}}
+	p.next()
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	if root.kind() != kindBool {
+		return nil, fmt.Errorf("expression is a %s, not a condition", root.kind())
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// Match reports whether p satisfies the expression
+func (e *Expr) Match(p *message.Packet) bool {
+	return e.root.eval(p).(bool)
+}
+
+// String returns the expression's source
+func (e *Expr) String() string {
+	return e.src
+}
+
+// node is a compiled part of an expression
+type node interface {
+	kind() kind
+	eval(p *message.Packet) any
+}
+
+type literal struct {
+	k kind
+	v any
+}
+
+func (l *literal) kind() kind               { return l.k }
+func (l *literal) eval(*message.Packet) any { return l.v }
+
+type fieldRef struct {
+	name string
+	f    field
+}
+
+func (r *fieldRef) kind() kind                 { return r.f.kind }
+func (r *fieldRef) eval(p *message.Packet) any { return r.f.get(p) }
+
+type not struct{ x node }
+
+func (n *not) kind() kind                 { return kindBool }
+func (n *not) eval(p *message.Packet) any { return !n.x.eval(p).(bool) }
+
+type logical struct {
+	and         bool
+	left, right node
+}
+
+func (l *logical) kind() kind { return kindBool }
+func (l *logical) eval(p *message.Packet) any {
+	// A false left side decides &&, a true one decides ||
+	if left := l.left.eval(p).(bool); left != l.and {
+		return left
+	}
+	return l.right.eval(p).(bool)
+}
+
+type compare struct {
+	op          string
+	left, right node
+}
+
+func (c *compare) kind() kind { return kindBool }
+func (c *compare) eval(p *message.Packet) any {
+	a, b := c.left.eval(p), c.right.eval(p)
+	switch c.op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "contains":
+		return strings.Contains(a.(string), b.(string))
+	}
+	x, y := a.(float64), b.(float64)
+	switch c.op {
+	case "<":
+		return x < y
+	case "<=":
+		return x <= y
+	case ">":
+		return x > y
+	}
+	return x >= y
+}
+
+type member struct {
+	x      node
+	set    map[any]bool
+	negate bool
+}
+
+func (m *member) kind() kind                 { return kindBool }
+func (m *member) eval(p *message.Packet) any { return m.set[m.x.eval(p)] != m.negate }
+
+type match struct {
+	x  node
+	re *regexp.Regexp
+}
+
+func (m *match) kind() kind                 { return kindBool }
+func (m *match) eval(p *message.Packet) any { return m.re.MatchString(m.x.eval(p).(string)) }
@@ -0,0 +1,114 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestMatch(t *testing.T) {
+	pkt := &message.Packet{
+		From:     0x1234abcd,
+		To:       0xFFFFFFFF,
+		Channel:  1,
+		PortNum:  message.PortNumTextMessage,
+		Payload:  &message.TextMessage{Text: "Help at the trailhead"},
+		RSSI:     -95,
+		SNR:      4.5,
+		FromNode: &message.NodeInfo{User: &message.User{LongName: "Alice", ShortName: "ALC"}},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`portnum == "TEXT_MESSAGE_APP" && channel in [0, 1] && rssi > -110`, true},
+		{`portnum == "TEXT_MESSAGE_APP" && channel in [0, 2]`, false},
+		{`channel not in [2, 3]`, true},
+		{`rssi >= -95 && snr < 5`, true},
+		{`rssi < -100 || from == "!1234abcd"`, true},
+		{`from in ["!00000001", 305441741]`, true},
+		{`to != "!1234abcd" && broadcast`, true},
+		{`!(portnum == "POSITION_APP")`, true},
+		{`text contains "Help" && from_name == 'Alice'`, true},
+		{`text matches "(?i)^help"`, true},
+		{`text matches "^at"`, false},
+		{`want_ack`, false},
+		{`want_ack == false && port == 1`, true},
+		{`false || (true && !false)`, true},
+	}
+	for _, tt := range tests {
+		e, err := Compile(tt.expr)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := e.Match(pkt); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{``, "unexpected end of expression"},
+		{`rssi`, "not a condition"},
+		{`rsi > -100`, `unknown field "rsi"`},
+		{`rssi > "strong"`, "cannot compare a number with a string"},
+		{`from == "alice"`, `invalid node id "alice"`},
+		{`portnum > "A"`, "compares numbers"},
+		{`channel in [0, "x"]`, "cannot compare"},
+		{`channel in [0 1]`, `expected ","`},
+		{`text matches "("`, "invalid regular expression"},
+		{`text == "open`, "unterminated string"},
+		{`rssi > -100 &&`, "position 15"},
+		{`rssi > -100 && channel`, "needs conditions"},
+		{`(rssi > -100`, `expected ")"`},
+		{`rssi > -100 rssi`, `unexpected "rssi"`},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.expr)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Compile(%q) = %v, want an error containing %q", tt.expr, err, tt.want)
+		}
+	}
+}
+
+func TestTextPatterns(t *testing.T) {
+	text := func(s string) *message.Packet {
+		return &message.Packet{PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: s}}
+	}
+	position := &message.Packet{PortNum: message.PortNumPosition, Payload: &message.Position{}}
+
+	exclude, err := NewTextPatterns(nil, []string{`^seq \d+$`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exclude.Match(text("seq 42")) || !exclude.Match(text("hello")) || !exclude.Match(position) {
+		t.Error("exclude-only patterns")
+	}
+
+	include, err := NewTextPatterns([]string{"SOS|EMERGENCY", `(?i)\bhelp\b`}, []string{"test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for s, want := range map[string]bool{"SOS at camp": true, "need Help": true, "helpful": false, "SOS test": false} {
+		if got := include.Match(text(s)); got != want {
+			t.Errorf("Match(%q) = %v, want %v", s, got, want)
+		}
+	}
+	if include.Match(position) {
+		t.Error("include patterns passed a packet without text")
+	}
+
+	if tp, err := NewTextPatterns(nil, nil); tp != nil || err != nil {
+		t.Errorf("no patterns = %v, %v; want nil", tp, err)
+	}
+	if _, err := NewTextPatterns([]string{"("}, nil); err == nil || !strings.HasPrefix(err.Error(), "include:") {
+		t.Errorf("invalid pattern error = %v", err)
+	}
+}
@@ -0,0 +1,361 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+	tokError
+)
+
+type token struct {
+	kind tokenKind
+	text string // the source text, or the unquoted string
+	num  float64
+	pos  int // byte offset in the source
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// lexer splits an expression into tokens
+type lexer struct {
+	src string
+	pos int
+}
+
+func (l *lexer) next() token {
+	for l.pos < len(l.src) && strings.ContainsRune(" \t\r\n", rune(l.src[l.pos])) {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: start}
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case c == '"' || c == '\'':
+		return l.string(c)
+	case isDigit(c) || c == '-' && l.pos+1 < len(l.src) && isDigit(l.src[l.pos+1]):
+		l.pos++
+		for l.pos < len(l.src) && (isDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		text := l.src[start:l.pos]
+		n, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return token{kind: tokError, text: fmt.Sprintf("invalid number %q", text), pos: start}
+		}
+		return token{kind: tokNumber, text: text, num: n, pos: start}
+	case isIdentStart(c):
+		for l.pos < len(l.src) && (isIdentStart(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.src[start:l.pos], pos: start}
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ","} {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokOp, text: op, pos: start}
+		}
+	}
+	l.pos++
+	return token{kind: tokError, text: fmt.Sprintf("unexpected character %q", c), pos: start}
+}
+
+// string reads a string quoted with q; a backslash escapes the next
+// character
+func (l *lexer) string(q byte) token {
+	start := l.pos
+	l.pos++
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		l.pos++
+		switch {
+		case c == q:
+			return token{kind: tokString, text: b.String(), pos: start}
+		case c == '\\' && l.pos < len(l.src):
+			b.WriteByte(l.src[l.pos])
+			l.pos++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return token{kind: tokError, text: "unterminated string", pos: start}
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isIdentStart(c byte) bool { return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+
+// parser builds and type checks the expression tree by recursive descent:
+//
+//	or         = and { "||" and }
+//	and        = unary { "&&" unary }
+//	unary      = "!" unary | comparison
+//	comparison = operand [ op operand | ["not"] "in" list | "contains" operand | "matches" string ]
+//	operand    = field | string | number | "true" | "false" | "(" or ")"
+//	list       = "[" [ operand { "," operand } ] "]"
+type parser struct {
+	lex lexer
+	tok token
+}
+
+var compareOps = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+func (p *parser) next() {
+	p.tok = p.lex.next()
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("position %d: %s", p.tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+// is reports whether the current token is the operator or keyword s
+func (p *parser) is(s string) bool {
+	return (p.tok.kind == tokOp || p.tok.kind == tokIdent) && p.tok.text == s
+}
+
+func (p *parser) expect(s string) error {
+	if !p.is(s) {
+		return p.errorf("expected %q, found %s", s, p.tok)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	return p.parseLogical("||", p.parseAnd)
+}
+
+func (p *parser) parseAnd() (node, error) {
+	return p.parseLogical("&&", p.parseUnary)
+}
+
+func (p *parser) parseLogical(op string, operand func() (node, error)) (node, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.is(op) {
+		if left.kind() != kindBool {
+			return nil, p.errorf("%s needs conditions on both sides", op)
+		}
+		p.next()
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if right.kind() != kindBool {
+			return nil, p.errorf("%s needs conditions on both sides", op)
+		}
+		left = &logical{and: op == "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if !p.is("!") {
+		return p.parseComparison()
+	}
+	p.next()
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if x.kind() != kindBool {
+		return nil, p.errorf("! needs a condition")
+	}
+	return &not{x: x}, nil
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.tok.kind == tokOp && compareOps[p.tok.text]:
+		op := p.tok.text
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if left, right, err = p.unify(left, right); err != nil {
+			return nil, err
+		}
+		if op != "==" && op != "!=" && left.kind() != kindNumber {
+			return nil, p.errorf("%s compares numbers, not %ss", op, left.kind())
+		}
+		return &compare{op: op, left: left, right: right}, nil
+
+	case p.is("in"), p.is("not"):
+		negate := p.is("not")
+		p.next()
+		if negate {
+			if err := p.expect("in"); err != nil {
+				return nil, err
+			}
+		}
+		set, err := p.parseList(left)
+		if err != nil {
+			return nil, err
+		}
+		return &member{x: left, set: set, negate: negate}, nil
+
+	case p.is("contains"):
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if left.kind() != kindString || right.kind() != kindString {
+			return nil, p.errorf("contains compares strings")
+		}
+		return &compare{op: "contains", left: left, right: right}, nil
+
+	case p.is("matches"):
+		p.next()
+		if p.tok.kind != tokString {
+			return nil, p.errorf("matches needs a quoted regular expression, found %s", p.tok)
+		}
+		re, err := regexp.Compile(p.tok.text)
+		if err != nil {
+			return nil, p.errorf("invalid regular expression: %v", err)
+		}
+		p.next()
+		if left.kind() != kindString {
+			return nil, p.errorf("matches applies to strings, not %ss", left.kind())
+		}
+		return &match{x: left, re: re}, nil
+	}
+	return left, nil
+}
+
+// parseList reads a list of literals for x to be looked up in
+func (p *parser) parseList(x node) (map[any]bool, error) {
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	set := make(map[any]bool)
+	for i := 0; !p.is("]"); i++ {
+		if i > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		item, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		lit, ok := item.(*literal)
+		if !ok {
+			return nil, p.errorf("lists hold literal values")
+		}
+		if _, item, err = p.unify(x, lit); err != nil {
+			return nil, err
+		}
+		set[item.eval(nil)] = true
+	}
+	p.next()
+	return set, nil
+}
+
+func (p *parser) parseOperand() (node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokError:
+		return nil, p.errorf("%s", tok.text)
+	case tokString:
+		p.next()
+		return &literal{k: kindString, v: tok.text}, nil
+	case tokNumber:
+		p.next()
+		return &literal{k: kindNumber, v: tok.num}, nil
+	case tokIdent:
+		p.next()
+		switch tok.text {
+		case "true", "false":
+			return &literal{k: kindBool, v: tok.text == "true"}, nil
+		}
+		f, ok := fields[tok.text]
+		if !ok {
+			return nil, fmt.Errorf("position %d: unknown field %q (fields: %s)", tok.pos+1, tok.text, strings.Join(Fields(), ", "))
+		}
+		return &fieldRef{name: tok.text, f: f}, nil
+	}
+	if p.is("(") {
+		p.next()
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return x, nil
+	}
+	return nil, p.errorf("unexpected %s", tok)
+}
+
+// unify checks that a and b can be compared, converting node ids written
+// as strings to node numbers
+func (p *parser) unify(a, b node) (node, node, error) {
+	if a.kind() == b.kind() {
+		return a, b, nil
+	}
+	if id, ok := nodeLiteral(a, b); ok {
+		return a, id, nil
+	}
+	if id, ok := nodeLiteral(b, a); ok {
+		return id, b, nil
+	}
+	if ref, ok := a.(*fieldRef); ok && ref.f.node {
+		if lit, ok := b.(*literal); ok && lit.k == kindString {
+			return nil, nil, p.errorf("invalid node id %q for %s", lit.v, ref.name)
+		}
+	}
+	return nil, nil, p.errorf("cannot compare a %s with a %s", a.kind(), b.kind())
+}
+
+// nodeLiteral converts lit to a node number when it is a node id string
+// compared with the node field ref
+func nodeLiteral(ref, lit node) (node, bool) {
+	r, ok := ref.(*fieldRef)
+	if !ok || !r.f.node {
+		return nil, false
+	}
+	l, ok := lit.(*literal)
+	if !ok || l.k != kindString {
+		return nil, false
+	}
+	n, err := message.ParseNodeID(l.v.(string))
+	if err != nil {
+		return nil, false
+	}
+	return &literal{k: kindNumber, v: float64(n)}, true
+}
@@ -0,0 +1,68 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// TextPatterns selects text messages by their body. It is safe for
+// concurrent use.
+type TextPatterns struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// NewTextPatterns compiles include and exclude regular expressions. It
+// returns nil when both are empty.
+func NewTextPatterns(include, exclude []string) (*TextPatterns, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+	t := &TextPatterns{}
+	var err error
+	if t.include, err = compileAll(include); err != nil {
+		return nil, fmt.Errorf("include: %w", err)
+	}
+	if t.exclude, err = compileAll(exclude); err != nil {
+		return nil, fmt.Errorf("exclude: %w", err)
+	}
+	return t, nil
+}
+
+func compileAll(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// Match reports whether p passes: with include patterns only text
+// messages matching one of them do, and text matching an exclude pattern
+// never does. Other packets pass unless there are include patterns.
+func (t *TextPatterns) Match(p *message.Packet) bool {
+	text, ok := textOf(p)
+	if !ok {
+		return len(t.include) == 0
+	}
+	for _, re := range t.exclude {
+		if re.MatchString(text) {
+			return false
+		}
+	}
+	if len(t.include) == 0 {
+		return true
+	}
+	for _, re := range t.include {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
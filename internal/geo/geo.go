@@ -0,0 +1,123 @@
+// Package geo provides distance and bearing calculations relative to the
+// relay's home position, map links, and reverse geocoding of positions.
+package geo
+
+import (
+	"math"
+	"sync"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+)
+
+// earthRadius is the mean Earth radius in meters
+const earthRadius = 6371008.8
+
+// Point is a position in decimal degrees
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Distance returns the great-circle distance between a and b in meters
+func Distance(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLat := lat2 - lat1
+	dLon := radians(b.Lon - a.Lon)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Bearing returns the initial bearing from a to b in degrees clockwise
+// from true north, in [0, 360)
+func Bearing(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLon := radians(b.Lon - a.Lon)
+
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+	deg := math.Atan2(y, x) * 180 / math.Pi
+	return math.Mod(deg+360, 360)
+}
+
+// Compass returns the 8-point compass direction for a bearing in degrees
+func Compass(bearing float64) string {
+	points := [...]string{"N", "NE", "E", "SE", "S", "SW", "W", "NW"}
+	i := int(math.Round(math.Mod(bearing+360, 360)/45)) % len(points)
+	return points[i]
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// Source describes where the home position came from
+type Source string
+
+// Home position sources
+const (
+	SourceNone    Source = ""
+	SourceConfig  Source = "config"
+	SourceDevice  Source = "device"
+	SourceRuntime Source = "runtime"
+)
+
+// Home holds the relay's base station position. A configured or runtime
+// position takes precedence over one learned from the attached device.
+// It is safe for concurrent use.
+type Home struct {
+	mu     sync.RWMutex
+	point  Point
+	source Source
+}
+
+// NewHome returns a home set from cfg, or unset if no position is configured
+func NewHome(cfg config.RelayConfig) *Home {
+	h := &Home{}
+	if cfg.HasHome() {
+		h.point = Point{Lat: cfg.HomeLat, Lon: cfg.HomeLon}
+		h.source = SourceConfig
+	}
+	return h
+}
+
+// Get returns the home position and whether one is known
+func (h *Home) Get() (Point, Source, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.point, h.source, h.source != SourceNone
+}
+
+// Set replaces the home position at runtime
+func (h *Home) Set(p Point) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.point = p
+	h.source = SourceRuntime
+}
+
+// Learn records the attached device's own position unless the home was
+// configured or set at runtime. It reports whether the home changed.
+func (h *Home) Learn(p Point) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.followsDevice() || h.source == SourceDevice && h.point == p {
+		return false
+	}
+	h.point = p
+	h.source = SourceDevice
+	return true
+}
+
+// FollowsDevice reports whether the home is taken from the device's own
+// position, i.e. was neither configured nor set at runtime
+func (h *Home) FollowsDevice() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.followsDevice()
+}
+
+func (h *Home) followsDevice() bool {
+	return h.source == SourceNone || h.source == SourceDevice
+}
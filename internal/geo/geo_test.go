@@ -0,0 +1,60 @@
+package geo
+
+import (
+	"math"
+	"testing"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+)
+
+func TestDistanceBearing(t *testing.T) {
+	portland := Point{Lat: 45.5152, Lon: -122.6784}
+	seattle := Point{Lat: 47.6062, Lon: -122.3321}
+
+	if d := Distance(portland, seattle); math.Abs(d-233800) > 1000 {
+		t.Errorf("Distance = %.0f m, want ~233.8 km", d)
+	}
+	if b := Bearing(portland, seattle); math.Abs(b-6.4) > 0.5 {
+		t.Errorf("Bearing = %.1f, want ~6.4", b)
+	}
+	if b := Bearing(seattle, portland); math.Abs(b-186.6) > 0.5 {
+		t.Errorf("reverse Bearing = %.1f, want ~186.6", b)
+	}
+	if d := Distance(portland, portland); d != 0 {
+		t.Errorf("Distance to self = %f", d)
+	}
+
+	for bearing, want := range map[float64]string{0: "N", 22: "N", 23: "NE", 180: "S", 350: "N", 290: "W"} {
+		if got := Compass(bearing); got != want {
+			t.Errorf("Compass(%.0f) = %s, want %s", bearing, got, want)
+		}
+	}
+}
+
+func TestHomeSources(t *testing.T) {
+	h := NewHome(config.RelayConfig{})
+	if _, _, ok := h.Get(); ok {
+		t.Fatal("home known without config")
+	}
+
+	device := Point{Lat: 1, Lon: 2}
+	if !h.Learn(device) || h.Learn(device) {
+		t.Error("Learn should report only changes")
+	}
+	if p, src, _ := h.Get(); p != device || src != SourceDevice {
+		t.Errorf("Get = %v %s", p, src)
+	}
+
+	h.Set(Point{Lat: 3, Lon: 4})
+	if h.Learn(device) || h.FollowsDevice() {
+		t.Error("runtime home overridden by device")
+	}
+
+	configured := NewHome(config.RelayConfig{HomeLat: 5, HomeLon: 6})
+	if configured.Learn(device) {
+		t.Error("configured home overridden by device")
+	}
+	if p, src, ok := configured.Get(); !ok || p != (Point{Lat: 5, Lon: 6}) || src != SourceConfig {
+		t.Errorf("configured Get = %v %s %v", p, src, ok)
+	}
+}
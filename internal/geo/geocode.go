@@ -0,0 +1,291 @@
+package geo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/proxy"
+)
+
+// MapLink returns a link to p on the map service named by provider,
+// config.MapLinksOSM or config.MapLinksGoogle, or "" for any other
+func MapLink(provider string, p Point) string {
+	lat := strconv.FormatFloat(p.Lat, 'f', 5, 64)
+	lon := strconv.FormatFloat(p.Lon, 'f', 5, 64)
+	switch provider {
+	case config.MapLinksOSM:
+		return fmt.Sprintf("https://www.openstreetmap.org/?mlat=%s&mlon=%s#map=15/%s/%s", lat, lon, lat, lon)
+	case config.MapLinksGoogle:
+		return fmt.Sprintf("https://www.google.com/maps/search/?api=1&query=%s,%s", lat, lon)
+	}
+	return ""
+}
+
+// Geocoder names the place at a position
+type Geocoder interface {
+	// Reverse returns a short name for the place at p, or "" if the
+	// service has none
+	Reverse(ctx context.Context, p Point) (string, error)
+}
+
+// NewGeocoder returns the geocoder cfg describes, with lookups cached and
+// spaced out, or nil when none is configured
+func NewGeocoder(cfg config.GeocoderConfig) (Geocoder, error) {
+	var g Geocoder
+	switch cfg.Type {
+	case "":
+		return nil, nil
+	case config.GeocoderNominatim:
+		n, err := NewNominatim(cfg)
+		if err != nil {
+			return nil, err
+		}
+		g = n
+	default:
+		return nil, fmt.Errorf("unknown geocoder type: %s", cfg.Type)
+	}
+	return newCache(g, cfg.Interval), nil
+}
+
+// Nominatim looks places up with the Nominatim API of OpenStreetMap
+type Nominatim struct {
+	url       string
+	userAgent string
+	language  string
+	client    *http.Client
+}
+
+// NewNominatim returns a geocoder using the Nominatim server at cfg.URL
+func NewNominatim(cfg config.GeocoderConfig) (*Nominatim, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Proxy != "" {
+		u, err := config.ParseProxy(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid geocoder proxy: %w", err)
+		}
+		transport.Proxy = proxy.HTTP(u)
+	}
+	return &Nominatim{
+		url:       strings.TrimSuffix(cfg.URL, "/"),
+		userAgent: cfg.UserAgent,
+		language:  cfg.Language,
+		client:    &http.Client{Transport: transport, Timeout: cfg.Timeout},
+	}, nil
+}
+
+// nominatimPlace is the part of a Nominatim reverse lookup that is used
+type nominatimPlace struct {
+	Error       string            `json:"error"`
+	Name        string            `json:"name"`
+	DisplayName string            `json:"display_name"`
+	Address     map[string]string `json:"address"`
+}
+
+// Reverse returns the place's name, if it has one, and the town it is in
+func (n *Nominatim) Reverse(ctx context.Context, p Point) (string, error) {
+	q := url.Values{}
+	q.Set("format", "jsonv2")
+	q.Set("lat", strconv.FormatFloat(p.Lat, 'f', 6, 64))
+	q.Set("lon", strconv.FormatFloat(p.Lon, 'f', 6, 64))
+	q.Set("zoom", "16")
+	if n.language != "" {
+		q.Set("accept-language", n.language)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.url+"/reverse?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", n.userAgent)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("reverse geocoding failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("reverse geocoding failed: %s", resp.Status)
+	}
+
+	var place nominatimPlace
+	if err := json.NewDecoder(resp.Body).Decode(&place); err != nil {
+		return "", fmt.Errorf("invalid reverse geocoding response: %w", err)
+	}
+	// Positions at sea or off the map have no place
+	if place.Error != "" {
+		return "", nil
+	}
+
+	var parts []string
+	add := func(s string) {
+		if s != "" && (len(parts) == 0 || parts[len(parts)-1] != s) {
+			parts = append(parts, s)
+		}
+	}
+	add(place.Name)
+	for _, k := range []string{"city", "town", "village", "hamlet", "suburb"} {
+		if v := place.Address[k]; v != "" {
+			add(v)
+			break
+		}
+	}
+	add(place.Address["state"])
+	if len(parts) == 0 {
+		return place.DisplayName, nil
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// cacheSize bounds the places remembered by a cache; it starts over when
+// full
+const cacheSize = 4096
+
+// cache remembers places by position rounded to about 100 m, and leaves
+// positions unnamed rather than look them up more often than every
+// interval, as public services such as Nominatim require
+type cache struct {
+	g        Geocoder
+	interval time.Duration
+
+	mu     sync.Mutex
+	places map[Point]string
+	last   time.Time
+	now    func() time.Time
+}
+
+func newCache(g Geocoder, interval time.Duration) *cache {
+	return &cache{g: g, interval: interval, places: make(map[Point]string), now: time.Now}
+}
+
+// Reverse returns the remembered place near p, or looks it up when the
+// interval since the last lookup has passed and returns "" otherwise
+func (c *cache) Reverse(ctx context.Context, p Point) (string, error) {
+	key := cacheKey(p)
+
+	c.mu.Lock()
+	if place, ok := c.places[key]; ok {
+		c.mu.Unlock()
+		return place, nil
+	}
+	now := c.now()
+	if c.wait(now) > 0 {
+		c.mu.Unlock()
+		return "", nil
+	}
+	c.last = now
+	c.mu.Unlock()
+
+	place, err := c.g.Reverse(ctx, p)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	if len(c.places) >= cacheSize {
+		c.places = make(map[Point]string)
+	}
+	c.places[key] = place
+	c.mu.Unlock()
+	return place, nil
+}
+
+// cacheKey rounds p to about 100 m
+func cacheKey(p Point) Point {
+	return Point{Lat: math.Round(p.Lat*1000) / 1000, Lon: math.Round(p.Lon*1000) / 1000}
+}
+
+// cached returns the remembered place near p
+func (c *cache) cached(p Point) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	place, ok := c.places[cacheKey(p)]
+	return place, ok
+}
+
+// wait returns how long after now the next lookup may be made. The caller
+// holds c.mu.
+func (c *cache) wait(now time.Time) time.Duration {
+	if c.last.IsZero() {
+		return 0
+	}
+	return max(c.interval-now.Sub(c.last), 0)
+}
+
+// queueSize bounds the positions waiting to be named; more are dropped
+// until the lookups catch up
+const queueSize = 64
+
+// Namer names positions without waiting on the geocoding service. Name
+// answers from the cache and queues positions it has no place for, which
+// Run looks up in the background, so later reports from there are named.
+type Namer struct {
+	cache   *cache
+	timeout time.Duration
+	queue   chan Point
+}
+
+// NewNamer returns a namer for the geocoder cfg describes, or nil when
+// none is configured
+func NewNamer(cfg config.GeocoderConfig) (*Namer, error) {
+	g, err := NewGeocoder(cfg)
+	if g == nil || err != nil {
+		return nil, err
+	}
+	return &Namer{cache: g.(*cache), timeout: cfg.Timeout, queue: make(chan Point, queueSize)}, nil
+}
+
+// Name returns the remembered place near p, or "" after queuing p to be
+// looked up
+func (n *Namer) Name(p Point) string {
+	if place, ok := n.cache.cached(p); ok {
+		return place
+	}
+	select {
+	case n.queue <- p:
+	default:
+	}
+	return ""
+}
+
+// Run looks up queued positions, spaced out by the cache's interval, until
+// ctx is done. Failed lookups are passed to failed.
+func (n *Namer) Run(ctx context.Context, failed func(Point, error)) {
+	for {
+		var p Point
+		select {
+		case <-ctx.Done():
+			return
+		case p = <-n.queue:
+		}
+		// Positions queued again while an earlier one was looked up
+		if _, ok := n.cache.cached(p); ok {
+			continue
+		}
+
+		n.cache.mu.Lock()
+		wait := n.cache.wait(n.cache.now())
+		n.cache.mu.Unlock()
+		if wait > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+
+		lookupCtx, cancel := context.WithTimeout(ctx, n.timeout)
+		_, err := n.cache.Reverse(lookupCtx, p)
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			failed(p, err)
+		}
+	}
+}
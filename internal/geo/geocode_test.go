@@ -0,0 +1,124 @@
+package geo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+)
+
+func TestNominatim(t *testing.T) {
+	var lookups atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		if r.URL.Path != "/reverse" || r.Header.Get("User-Agent") != "test-relay" || r.URL.Query().Get("accept-language") != "en" {
+			t.Errorf("request %s with agent %q", r.URL, r.Header.Get("User-Agent"))
+		}
+		if strings.HasPrefix(r.URL.Query().Get("lat"), "0.") {
+			_, _ = w.Write([]byte(`{"error":"Unable to geocode"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"name":"Pike Place Market","display_name":"Pike Place Market, Seattle, Washington, United States",
+			"address":{"city":"Seattle","state":"Washington","country":"United States"}}`))
+	}))
+	defer srv.Close()
+
+	g, err := NewGeocoder(config.GeocoderConfig{
+		Type:      config.GeocoderNominatim,
+		URL:       srv.URL + "/",
+		UserAgent: "test-relay",
+		Language:  "en",
+		Timeout:   time.Second,
+		Interval:  time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := g.(*cache)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	market := Point{Lat: 47.60970, Lon: -122.34220}
+	if place, err := g.Reverse(ctx, market); place != "Pike Place Market, Seattle, Washington" || err != nil {
+		t.Errorf("Reverse = %q, %v", place, err)
+	}
+	// Nearby positions come from the cache; others wait for the interval
+	if place, _ := g.Reverse(ctx, Point{Lat: 47.60972, Lon: -122.34218}); place != "Pike Place Market, Seattle, Washington" {
+		t.Errorf("cached Reverse = %q", place)
+	}
+	if place, _ := g.Reverse(ctx, Point{Lat: 0.5, Lon: 0.5}); place != "" || lookups.Load() != 1 {
+		t.Errorf("Reverse within the interval = %q after %d lookups", place, lookups.Load())
+	}
+	now = now.Add(time.Minute)
+	if place, err := g.Reverse(ctx, Point{Lat: 0.5, Lon: 0.5}); place != "" || err != nil || lookups.Load() != 2 {
+		t.Errorf("Reverse at sea = %q, %v after %d lookups", place, err, lookups.Load())
+	}
+
+	if g, err := NewGeocoder(config.GeocoderConfig{}); g != nil || err != nil {
+		t.Errorf("NewGeocoder without a type = %v, %v", g, err)
+	}
+}
+
+func TestMapLink(t *testing.T) {
+	p := Point{Lat: 47.6097, Lon: -122.3422}
+	for provider, want := range map[string]string{
+		config.MapLinksOSM:    "https://www.openstreetmap.org/?mlat=47.60970&mlon=-122.34220#map=15/47.60970/-122.34220",
+		config.MapLinksGoogle: "https://www.google.com/maps/search/?api=1&query=47.60970,-122.34220",
+		"":                    "",
+	} {
+		if got := MapLink(provider, p); got != want {
+			t.Errorf("MapLink(%q) = %q, want %q", provider, got, want)
+		}
+	}
+}
+
+func TestNamer(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		_, _ = w.Write([]byte(`{"name":"Pike Place Market","address":{"city":"Seattle"}}`))
+	}))
+	defer srv.Close()
+
+	n, err := NewNamer(config.GeocoderConfig{
+		Type:     config.GeocoderNominatim,
+		URL:      srv.URL,
+		Timeout:  5 * time.Second,
+		Interval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx, func(_ Point, err error) { t.Errorf("lookup failed: %v", err) })
+
+	// The first report is not held up by the lookup it starts
+	market := Point{Lat: 47.60970, Lon: -122.34220}
+	start := time.Now()
+	if place := n.Name(market); place != "" || time.Since(start) > time.Second {
+		t.Errorf("Name = %q after %s", place, time.Since(start))
+	}
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for n.Name(market) == "" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if place := n.Name(market); place != "Pike Place Market, Seattle" {
+		t.Errorf("Name after the lookup = %q", place)
+	}
+
+	if n, err := NewNamer(config.GeocoderConfig{}); n != nil || err != nil {
+		t.Errorf("NewNamer without a type = %v, %v", n, err)
+	}
+}
@@ -0,0 +1,372 @@
+// Package incident builds after-action reports: one chronological
+// timeline of the messages, alerts, connection events, and operator notes
+// of a deployment, with node positions gathered into tracks.
+//
+// Alerts are not stored by the relay, so they are recomputed by replaying
+// the messages through an alert engine, checking for offline nodes once a
+// minute as the relay does.
+package incident
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/alerts"
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/geo"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/nodedb"
+	"github.com/iamruinous/meshtastic-message-relay/internal/notes"
+)
+
+// checkInterval is how often offline alerts are checked, as in the relay
+const checkInterval = time.Minute
+
+// Kind is what a timeline event records
+type Kind string
+
+// Event kinds
+const (
+	KindMessage    Kind = "message"
+	KindAlert      Kind = "alert"
+	KindConnection Kind = "connection"
+	KindNote       Kind = "note"
+)
+
+// connectionEvents are the log messages that mark the relay starting and
+// stopping and its connection to the device coming and going
+var connectionEvents = map[string]bool{
+	"Relay service started":                   true,
+	"Relay service stopped":                   true,
+	"Connected to serial port":                true,
+	"Connected to TCP endpoint":               true,
+	"Connected to MQTT broker":                true,
+	"MQTT connection lost":                    true,
+	"No frames from the device; reconnecting": true,
+	"Reconnected after stall":                 true,
+	"Reconnect failed":                        true,
+}
+
+// connectionFields are the log fields worth showing with a connection event
+var connectionFields = []string{"connection", "port", "address", "error"}
+
+// Event is one entry in the timeline
+type Event struct {
+	Time time.Time `json:"time"`
+	Kind Kind      `json:"kind"`
+	Node uint32    `json:"node,omitempty"`
+	Name string    `json:"name,omitempty"`
+	Text string    `json:"text"`
+}
+
+// TrackPoint is one reported position of a node
+type TrackPoint struct {
+	Time      time.Time `json:"time"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Altitude  int32     `json:"altitude,omitempty"`
+}
+
+// Track is the positions a node reported, oldest first
+type Track struct {
+	Node   uint32       `json:"node"`
+	Name   string       `json:"name"`
+	Points []TrackPoint `json:"points"`
+}
+
+// Distance returns the length of the track in meters
+func (t *Track) Distance() float64 {
+	var d float64
+	for i := 1; i < len(t.Points); i++ {
+		a, b := t.Points[i-1], t.Points[i]
+		d += geo.Distance(geo.Point{Lat: a.Latitude, Lon: a.Longitude}, geo.Point{Lat: b.Latitude, Lon: b.Longitude})
+	}
+	return d
+}
+
+// Report is an after-action report
+type Report struct {
+	From      time.Time `json:"from,omitempty"`
+	To        time.Time `json:"to,omitempty"`
+	Generated time.Time `json:"generated"`
+	Nodes     int       `json:"nodes"`
+	Messages  int       `json:"messages"`
+	Events    []Event   `json:"events"`
+	Tracks    []Track   `json:"tracks"`
+}
+
+// Builder collects packets, log entries, and notes into a report. Inputs
+// outside the report's time range are ignored. Packets must be added
+// oldest first for alerts to be recomputed correctly.
+type Builder struct {
+	from, to time.Time
+	names    map[uint32]string
+	heard    map[uint32]*nodedb.Node
+	tracks   map[uint32]*Track
+	messages int
+	events   []Event
+
+	alerts   *alerts.Engine
+	clock    time.Time
+	standing map[string]alerts.Alert
+}
+
+// New creates a builder for the time range from to to; a zero bound is
+// open. cfg sets the thresholds for recomputed alerts.
+func New(from, to time.Time, cfg config.AlertsConfig) *Builder {
+	return &Builder{
+		from:     from,
+		to:       to,
+		names:    make(map[uint32]string),
+		heard:    make(map[uint32]*nodedb.Node),
+		tracks:   make(map[uint32]*Track),
+		alerts:   alerts.New(cfg, from),
+		standing: make(map[string]alerts.Alert),
+	}
+}
+
+func (b *Builder) inRange(t time.Time) bool {
+	return (b.from.IsZero() || !t.Before(b.from)) && (b.to.IsZero() || !t.After(b.to))
+}
+
+// AddNode names a node, e.g. from the node database. Names learned from
+// packets take precedence.
+func (b *Builder) AddNode(num uint32, user *message.User) {
+	if _, ok := b.names[num]; !ok {
+		if name := userName(user); name != "" {
+			b.names[num] = name
+		}
+	}
+}
+
+// AddPacket adds a received packet to the report
+func (b *Builder) AddPacket(p *message.Packet) {
+	if !b.inRange(p.ReceivedAt) {
+		return
+	}
+	if p.FromNode != nil {
+		if name := userName(p.FromNode.User); name != "" {
+			b.names[p.From] = name
+		}
+	}
+
+	b.advance(p.ReceivedAt)
+	b.record(p)
+	b.alerts.Observe(p)
+	b.collectAlerts(p.ReceivedAt)
+}
+
+// record adds what a packet says about its sender to the report
+func (b *Builder) record(p *message.Packet) {
+	n, ok := b.heard[p.From]
+	if !ok {
+		n = &nodedb.Node{Num: p.From}
+		b.heard[p.From] = n
+	}
+	n.LastHeard = p.ReceivedAt
+
+	switch payload := p.Payload.(type) {
+	case *message.User:
+		n.User = payload
+		if name := userName(payload); name != "" {
+			b.names[p.From] = name
+		}
+	case *message.TextMessage:
+		b.messages++
+		text := payload.Text
+		if p.To != 0xFFFFFFFF {
+			text = fmt.Sprintf("(to !%08x) %s", p.To, text)
+		}
+		b.add(Event{Time: p.ReceivedAt, Kind: KindMessage, Node: p.From, Text: text})
+	case *message.DetectionEvent:
+		b.messages++
+		b.add(Event{Time: p.ReceivedAt, Kind: KindMessage, Node: p.From, Text: "detection: " + payload.Text})
+	case *message.Position:
+		if payload.Latitude == 0 && payload.Longitude == 0 {
+			return
+		}
+		t, ok := b.tracks[p.From]
+		if !ok {
+			t = &Track{Node: p.From}
+			b.tracks[p.From] = t
+		}
+		t.Points = append(t.Points, TrackPoint{
+			Time:      p.ReceivedAt,
+			Latitude:  payload.Latitude,
+			Longitude: payload.Longitude,
+			Altitude:  payload.Altitude,
+		})
+	}
+}
+
+// AddLogEntry adds a connection event from one line of the relay's JSON
+// log. Other entries, and lines that are not JSON log entries, are
+// ignored.
+func (b *Builder) AddLogEntry(line []byte) {
+	var entry map[string]interface{}
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return
+	}
+	msg, _ := entry["msg"].(string)
+	ts, _ := entry["time"].(string)
+	if !connectionEvents[msg] {
+		return
+	}
+	t, err := time.Parse("2006-01-02T15:04:05.000Z0700", ts)
+	if err != nil {
+		if t, err = time.Parse(time.RFC3339Nano, ts); err != nil {
+			return
+		}
+	}
+	if !b.inRange(t) {
+		return
+	}
+
+	text := msg
+	for _, key := range connectionFields {
+		if v, ok := entry[key]; ok {
+			text += fmt.Sprintf(" (%s: %v)", key, v)
+		}
+	}
+	b.add(Event{Time: t, Kind: KindConnection, Text: text})
+}
+
+// AddNote adds an operator note, placed at the time it was written
+func (b *Builder) AddNote(n notes.Note) {
+	if !b.inRange(n.Created) {
+		return
+	}
+	text := n.String()
+	if n.Packet != 0 {
+		text = fmt.Sprintf("on packet %d: %s", n.Packet, text)
+	}
+	b.add(Event{Time: n.Created, Kind: KindNote, Node: n.Node, Text: text})
+}
+
+func (b *Builder) add(e Event) {
+	b.events = append(b.events, e)
+}
+
+// advance runs the offline checks due up to now
+func (b *Builder) advance(now time.Time) {
+	if b.clock.IsZero() {
+		b.clock = now
+		return
+	}
+	for b.clock.Add(checkInterval).Before(now) {
+		b.clock = b.clock.Add(checkInterval)
+		b.alerts.Check(b.nodes(), b.clock)
+		b.collectAlerts(b.clock)
+	}
+}
+
+func (b *Builder) nodes() []*nodedb.Node {
+	list := make([]*nodedb.Node, 0, len(b.heard))
+	for _, n := range b.heard {
+		list = append(list, n)
+	}
+	return list
+}
+
+// collectAlerts records alerts raised and cleared since the last call.
+// A standing alert is recorded once; every detection is recorded.
+func (b *Builder) collectAlerts(now time.Time) {
+	list := b.alerts.Active(now)
+	active := make(map[string]alerts.Alert, len(list))
+	for _, a := range list {
+		active[a.Key] = a
+	}
+
+	keys := make([]string, 0, len(b.standing))
+	for k := range b.standing {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if a := b.standing[k]; a.Kind != alerts.KindDetection {
+			if _, ok := active[k]; !ok {
+				b.add(Event{Time: now, Kind: KindAlert, Node: a.Node, Text: cleared(a)})
+			}
+		}
+	}
+
+	for _, a := range list {
+		prev, ok := b.standing[a.Key]
+		switch {
+		case !ok || !prev.Raised.Equal(a.Raised):
+			b.add(Event{Time: a.Raised, Kind: KindAlert, Node: a.Node, Text: a.Text})
+		case a.Kind == alerts.KindDetection && a.Seq != prev.Seq:
+			b.add(Event{Time: a.Fired, Kind: KindAlert, Node: a.Node, Text: a.Text})
+		}
+	}
+	b.standing = active
+}
+
+// cleared describes an alert whose condition cleared
+func cleared(a alerts.Alert) string {
+	switch a.Kind {
+	case alerts.KindOffline:
+		return a.Name + " heard again"
+	case alerts.KindLowBattery:
+		return a.Name + " battery recovered"
+	}
+	return "cleared: " + a.Text
+}
+
+// Report finishes the report. Offline checks run up to the end of the
+// range, or the last packet when the range is open.
+func (b *Builder) Report() *Report {
+	if !b.to.IsZero() && !b.clock.IsZero() {
+		b.advance(b.to)
+	}
+
+	r := &Report{
+		From:      b.from,
+		To:        b.to,
+		Generated: time.Now(),
+		Nodes:     len(b.heard),
+		Messages:  b.messages,
+		Events:    make([]Event, len(b.events)),
+		Tracks:    []Track{},
+	}
+	copy(r.Events, b.events)
+	for i := range r.Events {
+		if r.Events[i].Node != 0 {
+			r.Events[i].Name = b.name(r.Events[i].Node)
+		}
+	}
+	// Stable, so events at the same time keep the order they happened in
+	sort.SliceStable(r.Events, func(i, j int) bool {
+		return r.Events[i].Time.Before(r.Events[j].Time)
+	})
+
+	for _, t := range b.tracks {
+		track := *t
+		track.Name = b.name(t.Node)
+		r.Tracks = append(r.Tracks, track)
+	}
+	sort.Slice(r.Tracks, func(i, j int) bool {
+		return r.Tracks[i].Name < r.Tracks[j].Name
+	})
+	return r
+}
+
+func (b *Builder) name(num uint32) string {
+	if name, ok := b.names[num]; ok {
+		return name
+	}
+	return fmt.Sprintf("!%08x", num)
+}
+
+func userName(u *message.User) string {
+	if u == nil {
+		return ""
+	}
+	if name := strings.TrimSpace(u.LongName); name != "" {
+		return name
+	}
+	return strings.TrimSpace(u.ShortName)
+}
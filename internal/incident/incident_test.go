@@ -0,0 +1,119 @@
+package incident
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/notes"
+)
+
+func TestReport(t *testing.T) {
+	start := time.Date(2025, 6, 1, 18, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	b := New(start, at(115), config.AlertsConfig{OfflineAfter: time.Hour, LowBattery: 20})
+	b.AddNode(2, &message.User{LongName: "Base"})
+
+	packets := []*message.Packet{
+		// Before the report: ignored
+		{From: 1, To: 0xFFFFFFFF, ReceivedAt: at(-10), Payload: &message.TextMessage{Text: "too early"}},
+		{From: 1, ReceivedAt: at(0), Payload: &message.User{LongName: "Team 1"}},
+		{From: 1, To: 0xFFFFFFFF, ReceivedAt: at(5), Payload: &message.TextMessage{Text: "leaving | trailhead"}},
+		{From: 1, ReceivedAt: at(6), Payload: &message.Position{Latitude: 45.5, Longitude: -122.6}},
+		{From: 2, To: 1, ReceivedAt: at(7), Payload: &message.TextMessage{Text: "copy"}},
+		{From: 1, ReceivedAt: at(10), Payload: &message.Position{Latitude: 45.51, Longitude: -122.6, Altitude: 300}},
+		{From: 2, ReceivedAt: at(20), Payload: &message.Telemetry{BatteryLevel: 15}},
+		{From: 2, ReceivedAt: at(60), Payload: &message.Telemetry{BatteryLevel: 16}},
+		// Team 1 is offline from minute 70 until it is heard again
+		{From: 1, ReceivedAt: at(100), Payload: &message.DetectionEvent{Text: "<b>found</b>"}},
+		{From: 2, ReceivedAt: at(110), Payload: &message.Telemetry{BatteryLevel: 80}},
+	}
+	for _, p := range packets {
+		b.AddPacket(p)
+	}
+
+	b.AddLogEntry([]byte(`{"level":"warn","time":"2025-06-01T18:30:00.000Z","msg":"No frames from the device; reconnecting","idle":"2m0s"}`))
+	b.AddLogEntry([]byte(`{"level":"info","time":"2025-06-01T18:31:00.000Z","msg":"Reconnected after stall","connection":"serial:/dev/ttyUSB0"}`))
+	b.AddLogEntry([]byte(`{"level":"info","time":"2025-06-01T18:32:00.000Z","msg":"Decoded packet"}`))
+	b.AddLogEntry([]byte(`not json`))
+	b.AddNote(notes.Note{Node: 1, Packet: 9, Text: "false alarm", Tags: []string{"drill"}, Created: at(112)})
+	b.AddNote(notes.Note{Node: 1, Text: "after the report", Created: at(200)})
+
+	r := b.Report()
+	if r.Nodes != 2 || r.Messages != 3 {
+		t.Errorf("nodes = %d, messages = %d", r.Nodes, r.Messages)
+	}
+
+	want := []struct {
+		min  int
+		kind Kind
+		name string
+		text string
+	}{
+		{5, KindMessage, "Team 1", "leaving | trailhead"},
+		{7, KindMessage, "Base", "(to !00000001) copy"},
+		{20, KindAlert, "Base", "!00000002 battery at 15%"},
+		{30, KindConnection, "", "No frames from the device; reconnecting"},
+		{31, KindConnection, "", "Reconnected after stall (connection: serial:/dev/ttyUSB0)"},
+		{70, KindAlert, "Team 1", "Team 1 not heard for 1h0m0s"},
+		{100, KindMessage, "Team 1", "detection: <b>found</b>"},
+		{100, KindAlert, "Team 1", "Team 1 heard again"},
+		{100, KindAlert, "Team 1", "!00000001: <b>found</b>"},
+		{110, KindAlert, "Base", "!00000002 battery recovered"},
+		{112, KindNote, "Team 1", "on packet 9: false alarm #drill"},
+	}
+	if len(r.Events) != len(want) {
+		for _, e := range r.Events {
+			t.Logf("%s %s %s %q", e.Time.Format(time.TimeOnly), e.Kind, e.Name, e.Text)
+		}
+		t.Fatalf("got %d events, want %d", len(r.Events), len(want))
+	}
+	for i, w := range want {
+		e := r.Events[i]
+		if !e.Time.Equal(at(w.min)) || e.Kind != w.kind || e.Name != w.name || e.Text != w.text {
+			t.Errorf("event %d = %s %s %s %q, want minute %d %s %s %q",
+				i, e.Time.Format(time.TimeOnly), e.Kind, e.Name, e.Text, w.min, w.kind, w.name, w.text)
+		}
+	}
+
+	if len(r.Tracks) != 1 || r.Tracks[0].Name != "Team 1" || len(r.Tracks[0].Points) != 2 {
+		t.Fatalf("tracks = %+v", r.Tracks)
+	}
+	if d := r.Tracks[0].Distance(); d < 1100 || d > 1125 {
+		t.Errorf("distance = %.0f m, want about 1112", d)
+	}
+
+	var md bytes.Buffer
+	if err := Write(&md, r, "markdown"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"| 2025-06-01 18:05:00 UTC | message | Team 1 | leaving \\| trailhead |",
+		"### Team 1 (!00000001)",
+		"2 positions, 1.1 km traveled",
+		"| 2025-06-01 18:10:00 UTC | 45.510000 | -122.600000 | 300 m |",
+	} {
+		if !strings.Contains(md.String(), s) {
+			t.Errorf("markdown is missing %q:\n%s", s, md.String())
+		}
+	}
+
+	var page bytes.Buffer
+	if err := Write(&page, r, "html"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(page.String(), "<b>found</b>") || !strings.Contains(page.String(), "&lt;b&gt;found&lt;/b&gt;") {
+		t.Error("html does not escape message text")
+	}
+	if !strings.Contains(page.String(), "<polyline") || !strings.Contains(page.String(), `<tr class="alert">`) {
+		t.Errorf("html is missing the track drawing or timeline:\n%s", page.String())
+	}
+
+	if err := Write(&page, r, "pdf"); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
@@ -0,0 +1,218 @@
+package incident
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// timeLayout is how times are shown in reports
+const timeLayout = "2006-01-02 15:04:05 MST"
+
+// Formats lists the report formats
+var Formats = []string{"markdown", "html"}
+
+// Write renders the report in the given format
+func Write(w io.Writer, r *Report, format string) error {
+	switch format {
+	case "markdown":
+		return WriteMarkdown(w, r)
+	case "html":
+		return WriteHTML(w, r)
+	default:
+		return fmt.Errorf("unknown report format %q (use %s)", format, strings.Join(Formats, " or "))
+	}
+}
+
+// WriteMarkdown renders the report as Markdown
+func WriteMarkdown(w io.Writer, r *Report) error {
+	var b strings.Builder
+	b.WriteString("# Incident report\n\n")
+	fmt.Fprintf(&b, "- Period: %s\n", period(r))
+	fmt.Fprintf(&b, "- Generated: %s\n", r.Generated.Format(timeLayout))
+	fmt.Fprintf(&b, "- Nodes heard: %d\n", r.Nodes)
+	fmt.Fprintf(&b, "- Messages: %d\n", r.Messages)
+	fmt.Fprintf(&b, "- Timeline events: %d\n\n", len(r.Events))
+
+	b.WriteString("## Timeline\n\n")
+	if len(r.Events) == 0 {
+		b.WriteString("No events in this period.\n\n")
+	} else {
+		b.WriteString("| Time | Kind | Node | Event |\n|---|---|---|---|\n")
+		for _, e := range r.Events {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n",
+				e.Time.Format(timeLayout), e.Kind, markdownCell(e.Name), markdownCell(e.Text))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("## Tracks\n\n")
+	if len(r.Tracks) == 0 {
+		b.WriteString("No positions in this period.\n")
+	}
+	for _, t := range r.Tracks {
+		fmt.Fprintf(&b, "### %s (!%08x)\n\n", markdownCell(t.Name), t.Node)
+		fmt.Fprintf(&b, "%d positions, %s traveled\n\n", len(t.Points), distance(t.Distance()))
+		b.WriteString("| Time | Latitude | Longitude | Altitude |\n|---|---|---|---|\n")
+		for _, p := range t.Points {
+			fmt.Fprintf(&b, "| %s | %.6f | %.6f | %s |\n",
+				p.Time.Format(timeLayout), p.Latitude, p.Longitude, altitude(p.Altitude))
+		}
+		b.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownCell escapes text for a Markdown table cell
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// WriteHTML renders the report as a single self-contained HTML page, with
+// the tracks drawn as lines
+func WriteHTML(w io.Writer, r *Report) error {
+	return htmlReport.Execute(w, r)
+}
+
+func period(r *Report) string {
+	from, to := "the beginning", "the end"
+	if !r.From.IsZero() {
+		from = r.From.Format(timeLayout)
+	}
+	if !r.To.IsZero() {
+		to = r.To.Format(timeLayout)
+	}
+	return from + " to " + to
+}
+
+func distance(m float64) string {
+	if m < 1000 {
+		return fmt.Sprintf("%.0f m", m)
+	}
+	return fmt.Sprintf("%.1f km", m/1000)
+}
+
+func altitude(a int32) string {
+	if a == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d m", a)
+}
+
+// trackSize is the width and height of the track drawing
+const trackSize = 600
+
+// trackColors tell the tracks apart in the drawing
+var trackColors = []string{"#1f77b4", "#d62728", "#2ca02c", "#ff7f0e", "#9467bd", "#8c564b", "#e377c2", "#17becf"}
+
+// svgTrack is a track projected onto the drawing
+type svgTrack struct {
+	Name   string
+	Color  string
+	Points string
+	EndX   float64
+	EndY   float64
+}
+
+// project fits the tracks into the drawing, scaling longitude by the
+// latitude so distances look right away from the equator
+func project(tracks []Track) []svgTrack {
+	minLat, maxLat := math.Inf(1), math.Inf(-1)
+	minLon, maxLon := math.Inf(1), math.Inf(-1)
+	for _, t := range tracks {
+		for _, p := range t.Points {
+			minLat, maxLat = math.Min(minLat, p.Latitude), math.Max(maxLat, p.Latitude)
+			minLon, maxLon = math.Min(minLon, p.Longitude), math.Max(maxLon, p.Longitude)
+		}
+	}
+	if math.IsInf(minLat, 1) {
+		return nil
+	}
+
+	scaleX := math.Cos((minLat + maxLat) / 2 * math.Pi / 180)
+	span := math.Max((maxLon-minLon)*scaleX, maxLat-minLat)
+	if span == 0 {
+		span = 1
+	}
+	const margin = 20
+	scale := (trackSize - 2*margin) / span
+
+	list := make([]svgTrack, 0, len(tracks))
+	for i, t := range tracks {
+		st := svgTrack{Name: t.Name, Color: trackColors[i%len(trackColors)]}
+		points := make([]string, len(t.Points))
+		for j, p := range t.Points {
+			st.EndX = margin + (p.Longitude-minLon)*scaleX*scale
+			st.EndY = trackSize - margin - (p.Latitude-minLat)*scale
+			points[j] = fmt.Sprintf("%.1f,%.1f", st.EndX, st.EndY)
+		}
+		st.Points = strings.Join(points, " ")
+		list = append(list, st)
+	}
+	return list
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"time":     func(t time.Time) string { return t.Format(timeLayout) },
+	"period":   period,
+	"distance": distance,
+	"altitude": altitude,
+	"project":  project,
+	"nodeid":   func(num uint32) string { return fmt.Sprintf("!%08x", num) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Incident report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.25em 0.5em; text-align: left; vertical-align: top; }
+td.time { white-space: nowrap; }
+tr.alert td { background: #fde8e8; }
+tr.connection td { background: #eef3fb; }
+tr.note td { background: #fdf8e1; }
+svg { border: 1px solid #ccc; background: #fafafa; }
+</style>
+</head>
+<body>
+<h1>Incident report</h1>
+<ul>
+<li>Period: {{period .}}</li>
+<li>Generated: {{time .Generated}}</li>
+<li>Nodes heard: {{.Nodes}}</li>
+<li>Messages: {{.Messages}}</li>
+<li>Timeline events: {{len .Events}}</li>
+</ul>
+
+<h2>Timeline</h2>
+{{if .Events}}<table>
+<tr><th>Time</th><th>Kind</th><th>Node</th><th>Event</th></tr>
+{{range .Events}}<tr class="{{.Kind}}"><td class="time">{{time .Time}}</td><td>{{.Kind}}</td><td>{{.Name}}</td><td>{{.Text}}</td></tr>
+{{end}}</table>
+{{else}}<p>No events in this period.</p>
+{{end}}
+<h2>Tracks</h2>
+{{if .Tracks}}{{$tracks := project .Tracks}}<svg width="600" height="600" viewBox="0 0 600 600" xmlns="http://www.w3.org/2000/svg">
+{{range $tracks}}<polyline fill="none" stroke="{{.Color}}" stroke-width="2" points="{{.Points}}"/>
+<circle cx="{{printf "%.1f" .EndX}}" cy="{{printf "%.1f" .EndY}}" r="4" fill="{{.Color}}"><title>{{.Name}}</title></circle>
+{{end}}</svg>
+<ul>
+{{range $tracks}}<li style="color: {{.Color}}">{{.Name}}</li>
+{{end}}</ul>
+{{range .Tracks}}<h3>{{.Name}} ({{nodeid .Node}})</h3>
+<p>{{len .Points}} positions, {{distance .Distance}} traveled</p>
+<table>
+<tr><th>Time</th><th>Latitude</th><th>Longitude</th><th>Altitude</th></tr>
+{{range .Points}}<tr><td class="time">{{time .Time}}</td><td>{{printf "%.6f" .Latitude}}</td><td>{{printf "%.6f" .Longitude}}</td><td>{{altitude .Altitude}}</td></tr>
+{{end}}</table>
+{{end}}{{else}}<p>No positions in this period.</p>
+{{end}}</body>
+</html>
+`))
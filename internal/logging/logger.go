@@ -4,6 +4,7 @@ package logging
 import (
 	"os"
 	"strings"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -14,12 +15,22 @@ var (
 	Logger *zap.Logger
 	// Sugar is the sugared logger for convenient logging
 	Sugar *zap.SugaredLogger
+
+	// stopSummary ends the sampling summaries of the previous logger
+	stopSummary chan struct{}
 )
 
 // Config holds logging configuration
 type Config struct {
 	Level  string
 	Format string
+
+	// SampleThreshold is how many debug entries with the same message are
+	// logged each second before the rest are sampled; 0 logs them all
+	SampleThreshold int
+	// SampleInterval is how often the entries sampling dropped are
+	// summarized
+	SampleInterval time.Duration
 }
 
 // Initialize sets up the global logger with the given configuration
@@ -32,6 +43,9 @@ func Initialize(cfg Config) error {
 	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 	encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
 
+	// Recent entries are kept as JSON whatever the output format
+	recentCore := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), recent, level)
+
 	if strings.EqualFold(cfg.Format, "json") {
 		encoder = zapcore.NewJSONEncoder(encoderConfig)
 	} else {
@@ -39,15 +53,29 @@ func Initialize(cfg Config) error {
 		encoder = zapcore.NewConsoleEncoder(encoderConfig)
 	}
 
-	core := zapcore.NewCore(
-		encoder,
-		zapcore.AddSync(os.Stdout),
-		level,
+	core := zapcore.NewTee(
+		zapcore.NewCore(encoder, zapcore.AddSync(os.Stdout), level),
+		recentCore,
 	)
 
+	if stopSummary != nil {
+		close(stopSummary)
+		stopSummary = nil
+	}
+	var dropped *dropCounts
+	if level == zapcore.DebugLevel && cfg.SampleThreshold > 0 {
+		dropped = &dropCounts{}
+		core = newDebugSampler(core, cfg.SampleThreshold, dropped)
+	}
+
 	Logger = zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
 	Sugar = Logger.Sugar()
 
+	if dropped != nil && cfg.SampleInterval > 0 {
+		stopSummary = make(chan struct{})
+		go summarize(Logger, dropped, cfg.SampleInterval, stopSummary)
+	}
+
 	return nil
 }
 
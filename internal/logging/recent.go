@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// recentCapacity is how many log entries are kept in memory for support
+// bundles
+const recentCapacity = 1000
+
+// recentLog keeps the latest log entries, each written as one JSON line
+type recentLog struct {
+	mu      sync.Mutex
+	entries []json.RawMessage
+	next    int
+}
+
+var recent = &recentLog{}
+
+func (r *recentLog) Write(p []byte) (int, error) {
+	entry := make(json.RawMessage, len(p))
+	copy(entry, p)
+	// Drop the encoder's trailing newline
+	if n := len(entry); n > 0 && entry[n-1] == '\n' {
+		entry = entry[:n-1]
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) < recentCapacity {
+		r.entries = append(r.entries, entry)
+	} else {
+		r.entries[r.next] = entry
+		r.next = (r.next + 1) % recentCapacity
+	}
+	return len(p), nil
+}
+
+func (r *recentLog) Sync() error { return nil }
+
+// Recent returns up to n of the latest log entries as JSON objects, oldest
+// first. A limit of zero or less returns all that are kept.
+func Recent(n int) []json.RawMessage {
+	recent.mu.Lock()
+	defer recent.mu.Unlock()
+	all := append(append([]json.RawMessage{}, recent.entries[recent.next:]...), recent.entries[:recent.next]...)
+	if n > 0 && n < len(all) {
+		all = all[len(all)-n:]
+	}
+	return all
+}
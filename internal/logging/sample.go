@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// sampleEvery is how many debug entries with the same message are dropped
+// for each one logged once sampling has started
+const sampleEvery = 100
+
+// debugSampler passes debug entries through a sampler, so the per-packet
+// entries of a busy feed are thinned out while rarer ones are all logged,
+// and other levels straight to the core
+type debugSampler struct {
+	zapcore.Core
+	sampled zapcore.Core
+}
+
+func newDebugSampler(core zapcore.Core, threshold int, dropped *dropCounts) zapcore.Core {
+	return &debugSampler{
+		Core: core,
+		sampled: zapcore.NewSamplerWithOptions(core, time.Second, threshold, sampleEvery,
+			zapcore.SamplerHook(func(ent zapcore.Entry, dec zapcore.SamplingDecision) {
+				if dec&zapcore.LogDropped != 0 {
+					dropped.add(ent.Message)
+				}
+			})),
+	}
+}
+
+func (c *debugSampler) With(fields []zapcore.Field) zapcore.Core {
+	return &debugSampler{Core: c.Core.With(fields), sampled: c.sampled.With(fields)}
+}
+
+func (c *debugSampler) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level == zapcore.DebugLevel {
+		return c.sampled.Check(ent, ce)
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// dropCounts counts the entries sampling dropped by message
+type dropCounts struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+func (d *dropCounts) add(msg string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.counts == nil {
+		d.counts = make(map[string]uint64)
+	}
+	d.counts[msg]++
+}
+
+// take returns the counts so far and starts over
+func (d *dropCounts) take() (map[string]uint64, uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	counts := d.counts
+	d.counts = nil
+	var total uint64
+	for _, n := range counts {
+		total += n
+	}
+	return counts, total
+}
+
+// summarize logs how many debug entries were dropped every interval, when
+// any were, until stop is closed
+func summarize(logger *zap.Logger, dropped *dropCounts, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			counts, total := dropped.take()
+			if total == 0 {
+				continue
+			}
+			logger.Info("Debug logging sampled to keep up with the packet rate",
+				zap.Uint64("dropped", total),
+				zap.Duration("interval", interval),
+				zap.Any("messages", counts))
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package logging
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestDebugSampler(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	dropped := &dropCounts{}
+	logger := zap.New(newDebugSampler(core, 10, dropped)).With(zap.String("connection", "mqtt"))
+
+	for i := 0; i < 1000; i++ {
+		logger.Debug("Received packet")
+		logger.Info("Relayed message")
+	}
+	logger.Debug("Connected")
+
+	if n := logs.FilterMessage("Received packet").Len(); n < 10 || n > 30 {
+		t.Errorf("logged %d of 1000 debug entries, want the first 10 and a sample", n)
+	}
+	if n := logs.FilterMessage("Relayed message").Len(); n != 1000 {
+		t.Errorf("logged %d of 1000 info entries", n)
+	}
+	if n := logs.FilterMessage("Connected").Len(); n != 1 {
+		t.Errorf("rare debug entry logged %d times", n)
+	}
+
+	counts, total := dropped.take()
+	if total != 1000-uint64(logs.FilterMessage("Received packet").Len()) || counts["Received packet"] != total {
+		t.Errorf("dropped %d, by message %v", total, counts)
+	}
+	if _, total := dropped.take(); total != 0 {
+		t.Errorf("counts not reset, %d dropped", total)
+	}
+}
@@ -0,0 +1,181 @@
+// Package mailbox holds direct messages addressed to offline nodes and
+// produces a digest when the node is heard again.
+package mailbox
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+// MaxLineLength bounds a digest line so it fits in a single mesh text message
+const MaxLineLength = 200
+
+// Digest lists the messages held for a node while it was offline
+type Digest struct {
+	// Node is the recipient that came back online
+	Node uint32
+	// Messages are the held messages, oldest first
+	Messages []*message.Packet
+}
+
+// Lines renders one line per held message, each short enough to send as
+// a text message
+func (d *Digest) Lines() []string {
+	lines := make([]string, 0, len(d.Messages))
+	for _, p := range d.Messages {
+		line := fmt.Sprintf("[%s %s] %s", p.ReceivedAt.Format("Jan 2 15:04"), sender(p), text(p))
+		if len(line) > MaxLineLength {
+			line = line[:MaxLineLength-3] + "..."
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Text renders the digest as a single notification
+func (d *Digest) Text() string {
+	noun := "messages"
+	if len(d.Messages) == 1 {
+		noun = "message"
+	}
+	header := fmt.Sprintf("!%08x is back online, %d %s held while offline:", d.Node, len(d.Messages), noun)
+	return header + "\n" + strings.Join(d.Lines(), "\n")
+}
+
+// Packet wraps the digest as a text packet from the returning node so it
+// can be sent to outputs like any received message
+func (d *Digest) Packet(now time.Time) *message.Packet {
+	p := &message.Packet{
+		From:       d.Node,
+		To:         d.Node,
+		PortNum:    message.PortNumTextMessage,
+		Payload:    &message.TextMessage{Text: d.Text()},
+		ReceivedAt: now,
+	}
+	if len(d.Messages) > 0 {
+		p.Channel = d.Messages[0].Channel
+	}
+	return p
+}
+
+// Mailbox tracks when nodes were last heard and holds direct messages for
+// nodes that have gone quiet. It is safe for concurrent use.
+type Mailbox struct {
+	cfg   config.MailboxConfig
+	nodes connection.NodeDirectory
+	now   func() time.Time
+
+	mu        sync.Mutex
+	lastHeard map[uint32]time.Time
+	held      map[uint32][]entry
+}
+
+// entry is a held message and when the mailbox received it
+type entry struct {
+	packet *message.Packet
+	at     time.Time
+}
+
+// New creates a mailbox. nodes may be nil; it seeds last-heard times for
+// nodes the relay has not seen itself.
+func New(cfg config.MailboxConfig, nodes connection.NodeDirectory) *Mailbox {
+	return &Mailbox{
+		cfg:       cfg,
+		nodes:     nodes,
+		now:       time.Now,
+		lastHeard: make(map[uint32]time.Time),
+		held:      make(map[uint32][]entry),
+	}
+}
+
+// Observe records a received packet. It returns a digest when the sender
+// had messages waiting, and reports whether p was held for its recipient.
+func (m *Mailbox) Observe(p *message.Packet) (digest *Digest, held bool) {
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entries := m.live(p.From, now); len(entries) > 0 {
+		digest = &Digest{Node: p.From}
+		for _, e := range entries {
+			digest.Messages = append(digest.Messages, e.packet)
+		}
+	}
+	delete(m.held, p.From)
+	m.lastHeard[p.From] = now
+
+	if isDirectText(p) && m.offline(p.To, now) {
+		entries := append(m.live(p.To, now), entry{packet: p, at: now})
+		if n := len(entries) - m.cfg.MaxMessages; m.cfg.MaxMessages > 0 && n > 0 {
+			entries = entries[n:]
+		}
+		m.held[p.To] = entries
+		held = true
+	}
+
+	return digest, held
+}
+
+// Held returns how many messages are waiting for node
+func (m *Mailbox) Held(node uint32) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.live(node, m.now()))
+}
+
+// live returns the held messages for node that have not expired
+func (m *Mailbox) live(node uint32, now time.Time) []entry {
+	entries := m.held[node]
+	if m.cfg.MaxAge <= 0 {
+		return entries
+	}
+	for len(entries) > 0 && now.Sub(entries[0].at) > m.cfg.MaxAge {
+		entries = entries[1:]
+	}
+	return entries
+}
+
+// offline reports whether node is known to have been silent for longer
+// than the configured threshold. Nodes never heard are not considered
+// offline, since the relay knows nothing about them.
+func (m *Mailbox) offline(node uint32, now time.Time) bool {
+	last, ok := m.lastHeard[node]
+	if !ok && m.nodes != nil {
+		if info := m.nodes.GetNodeInfo(node); info != nil && info.LastHeard > 0 {
+			last, ok = time.Unix(int64(info.LastHeard), 0), true
+		}
+	}
+	return ok && now.Sub(last) > m.cfg.OfflineAfter
+}
+
+func isDirectText(p *message.Packet) bool {
+	if p.PortNum != message.PortNumTextMessage {
+		return false
+	}
+	return p.To != 0 && p.To != meshtastic.BroadcastAddr && p.To != p.From
+}
+
+func sender(p *message.Packet) string {
+	if p.FromNode != nil && p.FromNode.User != nil && p.FromNode.User.ShortName != "" {
+		return p.FromNode.User.ShortName
+	}
+	return fmt.Sprintf("!%08x", p.From)
+}
+
+func text(p *message.Packet) string {
+	switch v := p.Payload.(type) {
+	case *message.TextMessage:
+		return v.Text
+	case string:
+		return v
+	}
+	return string(p.RawPayload)
+}
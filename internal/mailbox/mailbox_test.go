@@ -0,0 +1,78 @@
+package mailbox
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func textPacket(from, to uint32, text string) *message.Packet {
+	return &message.Packet{
+		From:    from,
+		To:      to,
+		PortNum: message.PortNumTextMessage,
+		Payload: &message.TextMessage{Text: text},
+	}
+}
+
+func TestMailboxHoldsForOfflineNode(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := New(config.MailboxConfig{OfflineAfter: time.Hour, MaxMessages: 2, MaxAge: 24 * time.Hour}, nil)
+	m.now = func() time.Time { return now }
+
+	const alice, bob = 0xa, 0xb
+
+	// Unknown recipients are not held
+	if _, held := m.Observe(textPacket(bob, alice, "too early")); held {
+		t.Fatal("held message for never-heard node")
+	}
+
+	m.Observe(textPacket(alice, 0xFFFFFFFF, "bye"))
+	now = now.Add(2 * time.Hour)
+
+	for _, text := range []string{"one", "two", "three"} {
+		if _, held := m.Observe(textPacket(bob, alice, text)); !held {
+			t.Fatalf("message %q not held", text)
+		}
+	}
+	if _, held := m.Observe(textPacket(bob, 0xFFFFFFFF, "broadcast")); held {
+		t.Error("held broadcast")
+	}
+	if n := m.Held(alice); n != 2 {
+		t.Fatalf("Held = %d, want 2", n)
+	}
+
+	digest, _ := m.Observe(&message.Packet{From: alice, PortNum: message.PortNumPosition})
+	if digest == nil {
+		t.Fatal("no digest when node reappeared")
+	}
+	if len(digest.Messages) != 2 || !strings.Contains(digest.Text(), "three") || strings.Contains(digest.Text(), "one") {
+		t.Errorf("unexpected digest: %s", digest.Text())
+	}
+	if m.Held(alice) != 0 {
+		t.Error("messages still held after digest")
+	}
+
+	// Online nodes get messages directly
+	if _, held := m.Observe(textPacket(bob, alice, "hi")); held {
+		t.Error("held message for online node")
+	}
+}
+
+func TestMailboxExpiresMessages(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := New(config.MailboxConfig{OfflineAfter: time.Hour, MaxAge: 24 * time.Hour}, nil)
+	m.now = func() time.Time { return now }
+
+	m.Observe(textPacket(0xa, 0xFFFFFFFF, "bye"))
+	now = now.Add(2 * time.Hour)
+	m.Observe(textPacket(0xb, 0xa, "stale"))
+	now = now.Add(48 * time.Hour)
+
+	if digest, _ := m.Observe(textPacket(0xa, 0xFFFFFFFF, "back")); digest != nil {
+		t.Errorf("expired message delivered: %s", digest.Text())
+	}
+}
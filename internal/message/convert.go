@@ -14,23 +14,25 @@ func FromMeshtasticPacket(mp *meshtastic.Packet) *Packet {
 	}
 
 	p := &Packet{
-		ID:         mp.ID,
-		From:       mp.From,
-		To:         mp.To,
-		Channel:    mp.Channel,
-		PortNum:    PortNum(mp.PortNum),
-		RawPayload: mp.RawPayload,
-		SNR:        mp.SNR,
-		RSSI:       mp.RSSI,
-		HopLimit:   mp.HopLimit,
-		WantAck:    mp.WantAck,
-		ReceivedAt: mp.ReceivedAt,
+		ID:          mp.ID,
+		From:        mp.From,
+		To:          mp.To,
+		Channel:     mp.Channel,
+		PortNum:     PortNum(mp.PortNum),
+		RawPayload:  mp.RawPayload,
+		SNR:         mp.SNR,
+		RSSI:        mp.RSSI,
+		HopLimit:    mp.HopLimit,
+		WantAck:     mp.WantAck,
+		ReceivedAt:  mp.ReceivedAt,
+		GatewayID:   mp.GatewayID,
+		ChannelName: mp.ChannelName,
 	}
 
 	// Convert payload
 	switch payload := mp.Payload.(type) {
 	case *meshtastic.TextMessage:
-		p.Payload = &TextMessage{Text: payload.Text}
+		p.Payload = &TextMessage{Text: payload.Text, ReplyID: mp.ReplyID, Emoji: mp.Emoji}
 	case *meshtastic.Position:
 		p.Payload = &Position{
 			Latitude:  payload.Latitude(),
@@ -38,6 +40,53 @@ func FromMeshtasticPacket(mp *meshtastic.Packet) *Packet {
 			Altitude:  payload.Altitude,
 			Time:      time.Unix(int64(payload.Time), 0),
 		}
+	case *meshtastic.User:
+		p.Payload = FromMeshtasticUser(payload)
+	case *meshtastic.DetectionEvent:
+		p.Payload = &DetectionEvent{Text: payload.Text}
+	case *meshtastic.Paxcount:
+		p.Payload = &Paxcount{WiFi: payload.Wifi, BLE: payload.Ble, Uptime: payload.Uptime}
+	case *meshtastic.Telemetry:
+		if em := payload.EnvironmentMetrics; em != nil {
+			e := &Environment{
+				Temperature:        em.Temperature,
+				RelativeHumidity:   em.RelativeHumidity,
+				BarometricPressure: em.BarometricPressure,
+				GasResistance:      em.GasResistance,
+				IAQ:                em.IAQ,
+				Lux:                em.Lux,
+			}
+			if payload.Time > 0 {
+				e.Time = time.Unix(int64(payload.Time), 0)
+			}
+			p.Payload = e
+			break
+		}
+		if payload.DeviceMetrics == nil {
+			// Only device and environment metrics are decoded; keep the
+			// raw bytes otherwise
+			p.Payload = mp.RawPayload
+			break
+		}
+		t := &Telemetry{
+			BatteryLevel:       payload.DeviceMetrics.BatteryLevel,
+			Voltage:            payload.DeviceMetrics.Voltage,
+			ChannelUtilization: payload.DeviceMetrics.ChannelUtilization,
+			AirUtilTx:          payload.DeviceMetrics.AirUtilTx,
+			Uptime:             payload.DeviceMetrics.UptimeSeconds,
+		}
+		if payload.Time > 0 {
+			t.Time = time.Unix(int64(payload.Time), 0)
+		}
+		p.Payload = t
+	case *meshtastic.TAKPacket:
+		p.Payload = FromTAKPacket(payload)
+	case *meshtastic.StoreAndForward:
+		sf := &StoreForward{RR: payload.RR.String(), Text: string(payload.Text)}
+		if payload.History != nil {
+			sf.HistoryMessages = payload.History.HistoryMessages
+		}
+		p.Payload = sf
 	default:
 		p.Payload = payload
 	}
@@ -63,11 +112,7 @@ func FromMeshtasticNodeInfo(mn *meshtastic.NodeInfo) *NodeInfo {
 	}
 
 	if mn.User != nil {
-		ni.User = &User{
-			ID:        mn.User.ID,
-			LongName:  mn.User.LongName,
-			ShortName: mn.User.ShortName,
-		}
+		ni.User = FromMeshtasticUser(mn.User)
 	}
 
 	if mn.Position != nil {
@@ -81,3 +126,47 @@ func FromMeshtasticNodeInfo(mn *meshtastic.NodeInfo) *NodeInfo {
 
 	return ni
 }
+
+// FromMeshtasticUser converts a meshtastic.User to our internal User format
+func FromMeshtasticUser(mu *meshtastic.User) *User {
+	if mu == nil {
+		return nil
+	}
+
+	return &User{
+		ID:        mu.ID,
+		LongName:  mu.LongName,
+		ShortName: mu.ShortName,
+	}
+}
+
+// FromTAKPacket converts a meshtastic.TAKPacket to our internal TAK format
+func FromTAKPacket(tp *meshtastic.TAKPacket) *TAK {
+	if tp == nil {
+		return nil
+	}
+
+	t := &TAK{
+		Callsign:       tp.Callsign,
+		DeviceCallsign: tp.DeviceCallsign,
+		Team:           meshtastic.TAKTeamName(tp.Team),
+		Role:           meshtastic.TAKRoleName(tp.Role),
+		Battery:        tp.Battery,
+		Compressed:     tp.Compressed,
+	}
+	if pli := tp.PLI; pli != nil {
+		t.Latitude = pli.Latitude()
+		t.Longitude = pli.Longitude()
+		t.Altitude = pli.Altitude
+		t.Speed = pli.Speed
+		t.Course = pli.Course
+	}
+	if tp.Chat != nil {
+		t.Chat = tp.Chat.Message
+		t.ChatTo = tp.Chat.To
+		if tp.Chat.ToCallsign != "" {
+			t.ChatTo = tp.Chat.ToCallsign
+		}
+	}
+	return t
+}
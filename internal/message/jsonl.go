@@ -0,0 +1,196 @@
+package message
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxLineSize bounds a single JSONL record
+const maxLineSize = 1024 * 1024
+
+// UnmarshalJSON decodes a packet, restoring the typed payload from the
+// port number so packets read back from logs behave like live ones.
+func (p *Packet) UnmarshalJSON(data []byte) error {
+	type plain Packet
+	aux := struct {
+		*plain
+		Payload json.RawMessage `json:"payload"`
+	}{plain: (*plain)(p)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	payload, err := decodePayload(p.PortNum, aux.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s payload: %w", p.PortNum, err)
+	}
+	p.Payload = payload
+	return nil
+}
+
+func decodePayload(port PortNum, raw json.RawMessage) (interface{}, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var target interface{}
+	switch port {
+	case PortNumTextMessage:
+		target = &TextMessage{}
+	case PortNumPosition:
+		target = &Position{}
+	case PortNumNodeInfo:
+		target = &User{}
+	case PortNumDetectionSensor:
+		target = &DetectionEvent{}
+	case PortNumPaxCounter:
+		target = &Paxcount{}
+	case PortNumStoreForward:
+		target = &StoreForward{}
+	case PortNumAAtak:
+		target = &TAK{}
+	case PortNumTelemetry:
+		// Older logs and MQTT JSON carry telemetry in other shapes
+		switch {
+		case hasKey(raw, "battery_level"):
+			target = &Telemetry{}
+		case hasKey(raw, "temperature") || hasKey(raw, "relative_humidity") || hasKey(raw, "barometric_pressure"):
+			target = &Environment{}
+		default:
+			return decodeGeneric(raw)
+		}
+	default:
+		return decodeGeneric(raw)
+	}
+
+	if err := json.Unmarshal(raw, target); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// Reader reads packets from JSON Lines, such as the file output's json format
+type Reader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewReader creates a JSONL packet reader
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	return &Reader{scanner: scanner}
+}
+
+// Next returns the next packet, or io.EOF when the input is exhausted.
+// Blank lines are skipped.
+func (r *Reader) Next() (*Packet, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := r.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var p Packet
+		if err := json.Unmarshal(line, &p); err != nil {
+			return nil, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		return &p, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Magic numbers of the compressed logs the file output writes
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// OpenLog opens a log file, decompressing gzip and zstd logs. A compressed
+// log that is still being written, or was cut short by a crash, reads up to
+// its last complete line.
+func OpenLog(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(f)
+	head, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		return &logReader{r: gz, close: f.Close}, nil
+	case bytes.HasPrefix(head, zstdMagic):
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		return &logReader{r: zr, close: func() error {
+			zr.Close()
+			return f.Close()
+		}}, nil
+	}
+	return &logReader{r: br, close: f.Close}, nil
+}
+
+// logReader reads a possibly compressed log, treating a truncated stream
+// as its end
+type logReader struct {
+	r     io.Reader
+	close func() error
+}
+
+func (l *logReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (l *logReader) Close() error {
+	return l.close()
+}
+
+// Line returns the line number of the last record read
+func (r *Reader) Line() int {
+	return r.line
+}
+
+func decodeGeneric(raw json.RawMessage) (interface{}, error) {
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+// hasKey reports whether raw is a JSON object with the given key
+func hasKey(raw json.RawMessage, key string) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return false
+	}
+	_, ok := fields[key]
+	return ok
+}
@@ -0,0 +1,80 @@
+package message
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReaderRestoresPayloads(t *testing.T) {
+	packets := []*Packet{
+		{ID: 1, From: 0xAABBCCDD, PortNum: PortNumTextMessage, Payload: &TextMessage{Text: "hello"}, ReceivedAt: time.Unix(1700000000, 0).UTC()},
+		{ID: 2, From: 0x11223344, PortNum: PortNumPosition, Payload: &Position{Latitude: 37.5, Longitude: -122.25}},
+		{ID: 3, PortNum: PortNumTelemetry, Payload: map[string]interface{}{"battery": 91.0}},
+		{ID: 4, PortNum: PortNumTelemetry, Payload: &Telemetry{BatteryLevel: 87, Voltage: 3.9}},
+	}
+
+	var b strings.Builder
+	for _, p := range packets {
+		data, err := json.Marshal(p)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		b.Write(data)
+		b.WriteString("\n\n")
+	}
+
+	r := NewReader(strings.NewReader(b.String()))
+
+	p, err := r.Next()
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if text, ok := p.Payload.(*TextMessage); !ok || text.Text != "hello" {
+		t.Errorf("Expected text payload, got %#v", p.Payload)
+	}
+	if !p.ReceivedAt.Equal(packets[0].ReceivedAt) {
+		t.Errorf("ReceivedAt = %v, want %v", p.ReceivedAt, packets[0].ReceivedAt)
+	}
+
+	p, err = r.Next()
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if pos, ok := p.Payload.(*Position); !ok || pos.Latitude != 37.5 {
+		t.Errorf("Expected position payload, got %#v", p.Payload)
+	}
+
+	p, err = r.Next()
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if m, ok := p.Payload.(map[string]interface{}); !ok || m["battery"] != 91.0 {
+		t.Errorf("Expected generic payload, got %#v", p.Payload)
+	}
+
+	p, err = r.Next()
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if tm, ok := p.Payload.(*Telemetry); !ok || tm.BatteryLevel != 87 {
+		t.Errorf("Expected telemetry payload, got %#v", p.Payload)
+	}
+
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
+
+func TestReaderReportsLine(t *testing.T) {
+	r := NewReader(strings.NewReader("{\"id\":1}\nnot json\n"))
+	if _, err := r.Next(); err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if _, err := r.Next(); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected line 2 error, got %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package message
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseNodeID parses a node number written as "!1234abcd", "0x1234abcd",
+// or decimal.
+func ParseNodeID(s string) (uint32, error) {
+	s = strings.TrimSpace(s)
+
+	var n uint64
+	var err error
+	switch {
+	case strings.HasPrefix(s, "!"):
+		n, err = strconv.ParseUint(s[1:], 16, 32)
+	case strings.HasPrefix(s, "0x"), strings.HasPrefix(s, "0X"):
+		n, err = strconv.ParseUint(s[2:], 16, 32)
+	default:
+		n, err = strconv.ParseUint(s, 10, 32)
+	}
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid node id %q", s)
+	}
+	return uint32(n), nil
+}
@@ -0,0 +1,22 @@
+package message
+
+import "testing"
+
+func TestParseNodeID(t *testing.T) {
+	valid := map[string]uint32{
+		"!1234abcd":  0x1234abcd,
+		"0x1234ABCD": 0x1234abcd,
+		"305441741":  0x1234abcd,
+	}
+	for in, want := range valid {
+		if got, err := ParseNodeID(in); err != nil || got != want {
+			t.Errorf("ParseNodeID(%q) = %x, %v; want %x", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"", "!", "0", "!xyz", "!1234abcd00"} {
+		if _, err := ParseNodeID(in); err == nil {
+			t.Errorf("ParseNodeID(%q) succeeded", in)
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package message
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
 
 // PortNum represents the Meshtastic application port number.
 type PortNum int32
@@ -49,12 +54,22 @@ func (p PortNum) String() string {
 		return "ROUTING_APP"
 	case PortNumWaypoint:
 		return "WAYPOINT_APP"
+	case PortNumDetectionSensor:
+		return "DETECTION_SENSOR_APP"
+	case PortNumPaxCounter:
+		return "PAXCOUNTER_APP"
+	case PortNumStoreForward:
+		return "STORE_FORWARD_APP"
 	case PortNumTelemetry:
 		return "TELEMETRY_APP"
 	case PortNumTraceroute:
 		return "TRACEROUTE_APP"
 	case PortNumNeighborInfo:
 		return "NEIGHBORINFO_APP"
+	case PortNumAAtak:
+		return "ATAK_PLUGIN"
+	case PortNumAtakForwarder:
+		return "ATAK_FORWARDER"
 	default:
 		return "UNKNOWN_APP"
 	}
@@ -65,6 +80,11 @@ type Packet struct {
 	// ID is the unique packet identifier.
 	ID uint32 `json:"id"`
 
+	// Seq is the relay's sequence number for the packet. It increases by
+	// one for every packet the relay handles, across restarts when
+	// relay.sequence_file is set; 0 means the packet was not numbered.
+	Seq uint64 `json:"seq,omitempty"`
+
 	// From is the sender's node number.
 	From uint32 `json:"from"`
 
@@ -100,6 +120,49 @@ type Packet struct {
 
 	// FromNode contains information about the sender (if known).
 	FromNode *NodeInfo `json:"from_node,omitempty"`
+
+	// GatewayID is the node that published the packet to MQTT, e.g. "!abcd1234".
+	GatewayID string `json:"gateway_id,omitempty"`
+
+	// ChannelName is the channel name from the MQTT envelope or topic.
+	ChannelName string `json:"channel_name,omitempty"`
+
+	// Canary marks a synthetic packet the relay injected to measure its
+	// delivery latency. Receivers can ignore it.
+	Canary bool `json:"canary,omitempty"`
+}
+
+// FromID returns the sender's node ID, e.g. "!1234abcd".
+func (p *Packet) FromID() string {
+	return fmt.Sprintf("!%08x", p.From)
+}
+
+// FromName returns the sender's long name, falling back to the short name
+// and then the node ID.
+func (p *Packet) FromName() string {
+	if p.FromNode != nil && p.FromNode.User != nil {
+		if p.FromNode.User.LongName != "" {
+			return p.FromNode.User.LongName
+		}
+		if p.FromNode.User.ShortName != "" {
+			return p.FromNode.User.ShortName
+		}
+	}
+	return p.FromID()
+}
+
+// Text returns the text of a text message or detection sensor alert, and
+// an empty string for other packets.
+func (p *Packet) Text() string {
+	switch v := p.Payload.(type) {
+	case *TextMessage:
+		return v.Text
+	case *DetectionEvent:
+		return v.Text
+	case string:
+		return v
+	}
+	return ""
 }
 
 // NodeInfo contains information about a mesh node.
@@ -148,10 +211,244 @@ type Position struct {
 
 	// Time is when the position was recorded.
 	Time time.Time `json:"time,omitempty"`
+
+	// Distance is the distance from the relay's home position in meters,
+	// when the home position is known.
+	Distance float64 `json:"distance_m,omitempty"`
+
+	// Bearing is the direction from the relay's home position in degrees
+	// clockwise from true north.
+	Bearing float64 `json:"bearing,omitempty"`
+
+	// Place names where the position is, when a geocoder is configured.
+	Place string `json:"place,omitempty"`
+
+	// MapURL links to the position on a map, when map links are enabled.
+	MapURL string `json:"map_url,omitempty"`
+}
+
+// String returns the coordinates, followed by the place and map link
+// when they were added
+func (p *Position) String() string {
+	s := fmt.Sprintf("%.5f, %.5f", p.Latitude, p.Longitude)
+	if p.Place != "" {
+		s += " (" + p.Place + ")"
+	}
+	if p.MapURL != "" {
+		s += " " + p.MapURL
+	}
+	return s
 }
 
 // TextMessage represents a decoded text message.
 type TextMessage struct {
 	// Text is the message content.
 	Text string `json:"text"`
+
+	// Signed is set when the text carried a valid relay signature, which
+	// was removed from Text.
+	Signed bool `json:"signed,omitempty"`
+
+	// ReplyID is the ID of the message this one replies to.
+	ReplyID uint32 `json:"reply_id,omitempty"`
+
+	// Emoji marks a reply as a reaction; Text is then the emoji.
+	Emoji bool `json:"emoji,omitempty"`
+}
+
+// IsReaction reports whether the message is an emoji reaction to an
+// earlier message.
+func (t *TextMessage) IsReaction() bool {
+	return t.Emoji && t.ReplyID != 0
+}
+
+// TrimText shortens text to at most n bytes, ending it with "..." when
+// cut, without splitting a character.
+func TrimText(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	cut := n - 3
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "..."
+}
+
+// DetectionEvent is an alert from a node's detection sensor module.
+type DetectionEvent struct {
+	// Text is the alert configured on the sensor, e.g. "Motion detected".
+	Text string `json:"text"`
+}
+
+// String returns the alert text.
+func (d *DetectionEvent) String() string {
+	return d.Text
+}
+
+// Paxcount is a people-counter report from a node's paxcounter module.
+type Paxcount struct {
+	// WiFi is the number of WiFi devices seen.
+	WiFi uint32 `json:"wifi"`
+
+	// BLE is the number of Bluetooth devices seen.
+	BLE uint32 `json:"ble"`
+
+	// Uptime is the sender's uptime in seconds.
+	Uptime uint32 `json:"uptime,omitempty"`
+}
+
+// String summarizes the count for notifications.
+func (p *Paxcount) String() string {
+	return fmt.Sprintf("%d devices nearby (%d WiFi, %d Bluetooth)", p.WiFi+p.BLE, p.WiFi, p.BLE)
+}
+
+// Telemetry is a device metrics report.
+type Telemetry struct {
+	// Time is when the metrics were measured.
+	Time time.Time `json:"time,omitempty"`
+
+	// BatteryLevel is the battery charge in percent; above 100 means
+	// external power.
+	BatteryLevel uint32 `json:"battery_level"`
+
+	// Voltage is the battery voltage.
+	Voltage float32 `json:"voltage,omitempty"`
+
+	// ChannelUtilization is the percentage of airtime in use on the channel.
+	ChannelUtilization float32 `json:"channel_utilization,omitempty"`
+
+	// AirUtilTx is the percentage of airtime this node spent transmitting.
+	AirUtilTx float32 `json:"air_util_tx,omitempty"`
+
+	// Uptime is the node's uptime in seconds.
+	Uptime uint32 `json:"uptime,omitempty"`
+}
+
+// String summarizes the metrics for notifications.
+func (t *Telemetry) String() string {
+	return fmt.Sprintf("battery %d%%, %.2fV, channel %.1f%%, tx %.1f%%",
+		t.BatteryLevel, t.Voltage, t.ChannelUtilization, t.AirUtilTx)
+}
+
+// Environment is an environment sensor report. Readings the sensor does
+// not provide are zero.
+type Environment struct {
+	// Time is when the readings were taken.
+	Time time.Time `json:"time,omitempty"`
+
+	// Temperature is in degrees Celsius.
+	Temperature float32 `json:"temperature,omitempty"`
+
+	// RelativeHumidity is in percent.
+	RelativeHumidity float32 `json:"relative_humidity,omitempty"`
+
+	// BarometricPressure is in hPa.
+	BarometricPressure float32 `json:"barometric_pressure,omitempty"`
+
+	// GasResistance is in MOhm.
+	GasResistance float32 `json:"gas_resistance,omitempty"`
+
+	// IAQ is the indoor air quality index.
+	IAQ uint32 `json:"iaq,omitempty"`
+
+	// Lux is the ambient light level.
+	Lux float32 `json:"lux,omitempty"`
+}
+
+// String summarizes the readings for notifications.
+func (e *Environment) String() string {
+	var parts []string
+	if e.Temperature != 0 {
+		parts = append(parts, fmt.Sprintf("%.1f°C", e.Temperature))
+	}
+	if e.RelativeHumidity != 0 {
+		parts = append(parts, fmt.Sprintf("%.0f%% humidity", e.RelativeHumidity))
+	}
+	if e.BarometricPressure != 0 {
+		parts = append(parts, fmt.Sprintf("%.1f hPa", e.BarometricPressure))
+	}
+	if e.IAQ != 0 {
+		parts = append(parts, fmt.Sprintf("IAQ %d", e.IAQ))
+	}
+	if e.Lux != 0 {
+		parts = append(parts, fmt.Sprintf("%.0f lux", e.Lux))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// TAK is a position report or chat from the Meshtastic ATAK plugin. The
+// plugin may compress its strings, in which case Callsign and the chat
+// text are empty.
+type TAK struct {
+	// Callsign is the sender's TAK callsign.
+	Callsign string `json:"callsign,omitempty"`
+
+	// DeviceCallsign is the callsign of the sender's TAK device.
+	DeviceCallsign string `json:"device_callsign,omitempty"`
+
+	// Team is the team color, e.g. "Cyan".
+	Team string `json:"team,omitempty"`
+
+	// Role is the member role, e.g. "Team Member".
+	Role string `json:"role,omitempty"`
+
+	// Battery is the TAK device's battery level in percent.
+	Battery uint32 `json:"battery,omitempty"`
+
+	// Latitude and Longitude are in degrees, and Altitude in meters, when
+	// the packet is a position report.
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	Altitude  int32   `json:"altitude,omitempty"`
+
+	// Speed is in meters per second and Course in degrees.
+	Speed  uint32 `json:"speed,omitempty"`
+	Course uint32 `json:"course,omitempty"`
+
+	// Chat is the text of a GeoChat message, addressed to ChatTo
+	// ("All Chat Rooms" for everyone).
+	Chat   string `json:"chat,omitempty"`
+	ChatTo string `json:"chat_to,omitempty"`
+
+	// Compressed is set when the plugin compressed the strings.
+	Compressed bool `json:"compressed,omitempty"`
+}
+
+// HasPosition reports whether the packet is a position report.
+func (t *TAK) HasPosition() bool {
+	return t.Latitude != 0 || t.Longitude != 0
+}
+
+// String summarizes the packet for notifications.
+func (t *TAK) String() string {
+	who := t.Callsign
+	if who == "" {
+		who = "TAK user"
+	}
+	switch {
+	case t.Chat != "":
+		return fmt.Sprintf("%s: %s", who, t.Chat)
+	case t.HasPosition():
+		return fmt.Sprintf("%s at %.5f, %.5f", who, t.Latitude, t.Longitude)
+	}
+	return who
+}
+
+// StoreForward is a Store & Forward module message. Servers use it for
+// heartbeats and to replay stored text messages.
+type StoreForward struct {
+	// RR is the request/response type, e.g. ROUTER_TEXT_BROADCAST.
+	RR string `json:"rr"`
+
+	// Text is the replayed message for ROUTER_TEXT_* types.
+	Text string `json:"text,omitempty"`
+
+	// HistoryMessages is the number of messages a history replay will send.
+	HistoryMessages uint32 `json:"history_messages,omitempty"`
+}
+
+// IsText reports whether the message carries a replayed text message.
+func (sf *StoreForward) IsText() bool {
+	return sf.RR == "ROUTER_TEXT_DIRECT" || sf.RR == "ROUTER_TEXT_BROADCAST"
 }
@@ -0,0 +1,461 @@
+// Package nodedb keeps a node database shared by all connections and
+// persists it to disk so it survives restarts.
+package nodedb
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/state"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+// Node is everything the relay knows about a mesh node
+type Node struct {
+	Num       uint32            `json:"num"`
+	User      *message.User     `json:"user,omitempty"`
+	Position  *message.Position `json:"position,omitempty"`
+	LastHeard time.Time         `json:"last_heard"`
+	SNR       float32           `json:"snr,omitempty"`
+	RSSI      int32             `json:"rssi,omitempty"`
+
+	// Metrics is the device telemetry history, oldest first
+	Metrics []message.Telemetry `json:"metrics,omitempty"`
+
+	// Signal is the reception history of the node's packets, oldest first
+	Signal []SignalSample `json:"signal,omitempty"`
+}
+
+// SignalSample is the reception quality of one packet
+type SignalSample struct {
+	Time time.Time `json:"time"`
+	SNR  float32   `json:"snr"`
+	RSSI int32     `json:"rssi,omitempty"`
+}
+
+// History is a node's telemetry and signal history
+type History struct {
+	Node      uint32              `json:"node"`
+	Telemetry []message.Telemetry `json:"telemetry"`
+	Signal    []SignalSample      `json:"signal"`
+}
+
+// Latest returns the most recent telemetry sample, or nil
+func (n *Node) Latest() *message.Telemetry {
+	if len(n.Metrics) == 0 {
+		return nil
+	}
+	return &n.Metrics[len(n.Metrics)-1]
+}
+
+// copy returns a deep copy so callers never share state with the database
+func (n *Node) copy() *Node {
+	c := *n
+	if n.User != nil {
+		u := *n.User
+		c.User = &u
+	}
+	if n.Position != nil {
+		p := *n.Position
+		c.Position = &p
+	}
+	c.Metrics = append([]message.Telemetry(nil), n.Metrics...)
+	c.Signal = append([]SignalSample(nil), n.Signal...)
+	return &c
+}
+
+// snapshot is the on-disk format
+type snapshot struct {
+	Nodes []*Node `json:"nodes"`
+}
+
+// DB is the node database. It is safe for concurrent use.
+type DB struct {
+	path       string
+	maxHistory int
+	aliases    map[uint32]string
+	now        func() time.Time
+
+	mu    sync.RWMutex
+	nodes map[uint32]*Node
+	dirty bool
+}
+
+// Open loads the database from cfg.Path. A missing file starts an empty
+// database; an empty path keeps nodes in memory only.
+func Open(cfg config.NodeDBConfig) (*DB, error) {
+	db := &DB{
+		path:       cfg.Path,
+		maxHistory: cfg.History,
+		now:        time.Now,
+		nodes:      make(map[uint32]*Node),
+	}
+	for id, name := range cfg.Aliases {
+		num, err := message.ParseNodeID(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid alias: %w", err)
+		}
+		if db.aliases == nil {
+			db.aliases = make(map[uint32]string)
+		}
+		db.aliases[num] = name
+	}
+	if db.path == "" {
+		return db, nil
+	}
+
+	err := state.Load(db.path, func(data []byte) error {
+		var snap snapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return err
+		}
+		for _, n := range snap.Nodes {
+			if n != nil {
+				db.nodes[n.Num] = n
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read node database: %w", err)
+	}
+	return db, nil
+}
+
+// Observe records a received packet: when its sender was heard, and the
+// user info, position, or telemetry it carried
+func (db *DB) Observe(p *message.Packet) {
+	if p.From == 0 {
+		return
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	n := db.node(p.From)
+	n.LastHeard = p.ReceivedAt
+	if n.LastHeard.IsZero() {
+		n.LastHeard = db.now()
+	}
+	if p.SNR != 0 || p.RSSI != 0 {
+		n.SNR = p.SNR
+		n.RSSI = p.RSSI
+		n.Signal = trim(append(n.Signal, SignalSample{Time: n.LastHeard, SNR: p.SNR, RSSI: p.RSSI}), db.maxHistory)
+	}
+
+	switch payload := p.Payload.(type) {
+	case *message.User:
+		u := *payload
+		n.User = &u
+	case *message.Position:
+		if payload.Latitude != 0 || payload.Longitude != 0 {
+			pos := *payload
+			// Distance and bearing depend on the home position at the time
+			pos.Distance, pos.Bearing = 0, 0
+			n.Position = &pos
+		}
+	case *message.Telemetry:
+		t := *payload
+		if t.Time.IsZero() {
+			t.Time = n.LastHeard
+		}
+		n.Metrics = trim(append(n.Metrics, t), db.maxHistory)
+	}
+	db.dirty = true
+}
+
+// trim drops the oldest samples beyond limit, reusing the backing array
+func trim[T any](samples []T, limit int) []T {
+	if over := len(samples) - limit; limit > 0 && over > 0 {
+		return append(samples[:0], samples[over:]...)
+	}
+	return samples
+}
+
+// Import merges the node database a device sent when the connection was
+// configured. Device entries only replace what the relay heard itself
+// when they are newer.
+func (db *DB) Import(nodes []*meshtastic.NodeInfo) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, info := range nodes {
+		if info == nil || info.Num == 0 {
+			continue
+		}
+		n, known := db.nodes[info.Num]
+		if !known {
+			n = &Node{Num: info.Num}
+		}
+		heard := time.Unix(int64(info.LastHeard), 0)
+		newer := info.LastHeard > 0 && heard.After(n.LastHeard)
+		changed := false
+
+		if info.User != nil && (newer || n.User == nil) {
+			n.User = message.FromMeshtasticUser(info.User)
+			changed = true
+		}
+		if pos := info.Position; pos != nil && (pos.LatitudeI != 0 || pos.LongitudeI != 0) && (newer || n.Position == nil) {
+			n.Position = &message.Position{
+				Latitude:  pos.Latitude(),
+				Longitude: pos.Longitude(),
+				Altitude:  pos.Altitude,
+			}
+			if pos.Time > 0 {
+				n.Position.Time = time.Unix(int64(pos.Time), 0)
+			}
+			changed = true
+		}
+		if newer {
+			n.LastHeard = heard
+			n.SNR = info.Snr
+			changed = true
+		}
+		if changed {
+			db.nodes[info.Num] = n
+			db.dirty = true
+		}
+	}
+}
+
+// Merge takes the user info, position, and last heard time of a node from
+// another relay. As with Import, they only replace what this relay knows
+// when they are newer or it has none.
+func (db *DB) Merge(remote *Node) {
+	if remote == nil || remote.Num == 0 {
+		return
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	n, known := db.nodes[remote.Num]
+	if !known {
+		n = &Node{Num: remote.Num}
+	}
+	newer := remote.LastHeard.After(n.LastHeard)
+	changed := false
+
+	if remote.User != nil && (newer || n.User == nil) {
+		u := *remote.User
+		n.User = &u
+		changed = true
+	}
+	if remote.Position != nil && (newer || n.Position == nil) {
+		p := *remote.Position
+		p.Distance, p.Bearing = 0, 0
+		n.Position = &p
+		changed = true
+	}
+	if newer {
+		n.LastHeard = remote.LastHeard
+		changed = true
+	}
+	if changed {
+		db.nodes[remote.Num] = n
+		db.dirty = true
+	}
+}
+
+// node returns the entry for num, creating it. db.mu must be held.
+func (db *DB) node(num uint32) *Node {
+	n, ok := db.nodes[num]
+	if !ok {
+		n = &Node{Num: num}
+		db.nodes[num] = n
+	}
+	return n
+}
+
+// Node returns a copy of the entry for num, or nil
+func (db *DB) Node(num uint32) *Node {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if n, ok := db.nodes[num]; ok {
+		return n.copy()
+	}
+	return nil
+}
+
+// List returns copies of all nodes ordered by node number
+func (db *DB) List() []*Node {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	list := make([]*Node, 0, len(db.nodes))
+	for _, n := range db.nodes {
+		list = append(list, n.copy())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Num < list[j].Num })
+	return list
+}
+
+// History returns the telemetry and signal samples for num since the given
+// time, oldest first, or nil if the node is unknown
+func (db *DB) History(num uint32, since time.Time) *History {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	n, ok := db.nodes[num]
+	if !ok {
+		return nil
+	}
+	h := &History{Node: num, Telemetry: []message.Telemetry{}, Signal: []SignalSample{}}
+	for _, t := range n.Metrics {
+		if !t.Time.Before(since) {
+			h.Telemetry = append(h.Telemetry, t)
+		}
+	}
+	for _, s := range n.Signal {
+		if !s.Time.Before(since) {
+			h.Signal = append(h.Signal, s)
+		}
+	}
+	return h
+}
+
+// Len returns the number of known nodes
+func (db *DB) Len() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return len(db.nodes)
+}
+
+// Info returns the node in the form carried on packets, named by its
+// alias if it has one, or nil if neither a name nor an alias is known
+func (db *DB) Info(num uint32) *message.NodeInfo {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	alias, aliased := db.aliases[num]
+	n, ok := db.nodes[num]
+	if !aliased && (!ok || n.User == nil) {
+		return nil
+	}
+	info := &message.NodeInfo{Num: num, User: &message.User{ID: fmt.Sprintf("!%08x", num)}}
+	if ok {
+		info.LastHeard, info.SNR = n.LastHeard, n.SNR
+		if n.User != nil {
+			u := *n.User
+			info.User = &u
+		}
+		if n.Position != nil {
+			p := *n.Position
+			info.Position = &p
+		}
+	}
+	if aliased {
+		info.User.LongName = alias
+	}
+	return info
+}
+
+// Alias returns the configured name of a node
+func (db *DB) Alias(num uint32) (string, bool) {
+	name, ok := db.aliases[num]
+	return name, ok
+}
+
+// GetNodeInfo implements connection.NodeDirectory
+func (db *DB) GetNodeInfo(num uint32) *meshtastic.NodeInfo {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if n, ok := db.nodes[num]; ok {
+		return toMeshtastic(n)
+	}
+	return nil
+}
+
+// Nodes implements connection.NodeDirectory
+func (db *DB) Nodes() []*meshtastic.NodeInfo {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	list := make([]*meshtastic.NodeInfo, 0, len(db.nodes))
+	for _, n := range db.nodes {
+		list = append(list, toMeshtastic(n))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Num < list[j].Num })
+	return list
+}
+
+func toMeshtastic(n *Node) *meshtastic.NodeInfo {
+	info := &meshtastic.NodeInfo{Num: n.Num, Snr: n.SNR}
+	if !n.LastHeard.IsZero() {
+		info.LastHeard = uint32(n.LastHeard.Unix())
+	}
+	if n.User != nil {
+		info.User = &meshtastic.User{
+			ID:        n.User.ID,
+			LongName:  n.User.LongName,
+			ShortName: n.User.ShortName,
+		}
+	}
+	if n.Position != nil {
+		info.Position = &meshtastic.Position{
+			LatitudeI:  int32(n.Position.Latitude * 1e7),
+			LongitudeI: int32(n.Position.Longitude * 1e7),
+			Altitude:   n.Position.Altitude,
+		}
+		if !n.Position.Time.IsZero() {
+			info.Position.Time = uint32(n.Position.Time.Unix())
+		}
+	}
+	if t := n.Latest(); t != nil {
+		info.DeviceMetrics = &meshtastic.DeviceMetrics{
+			BatteryLevel:       t.BatteryLevel,
+			Voltage:            t.Voltage,
+			ChannelUtilization: t.ChannelUtilization,
+			AirUtilTx:          t.AirUtilTx,
+			UptimeSeconds:      t.Uptime,
+		}
+	}
+	return info
+}
+
+// Save writes the database to disk if it changed since the last save
+func (db *DB) Save() error {
+	if db.path == "" {
+		return nil
+	}
+
+	db.mu.Lock()
+	if !db.dirty {
+		db.mu.Unlock()
+		return nil
+	}
+	list := make([]*Node, 0, len(db.nodes))
+	for _, n := range db.nodes {
+		list = append(list, n)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Num < list[j].Num })
+	data, err := json.Marshal(snapshot{Nodes: list})
+	db.dirty = false
+	db.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode node database: %w", err)
+	}
+
+	if err := state.WriteFile(db.path, data, 0o644); err != nil {
+		db.markDirty()
+		return fmt.Errorf("failed to write node database: %w", err)
+	}
+	return nil
+}
+
+// markDirty makes the next Save retry after a failed write
+func (db *DB) markDirty() {
+	db.mu.Lock()
+	db.dirty = true
+	db.mu.Unlock()
+}
+
+// Close saves any unsaved changes
+func (db *DB) Close() error {
+	return db.Save()
+}
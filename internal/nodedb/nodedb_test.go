@@ -0,0 +1,133 @@
+package nodedb
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+func TestObserveAndPersist(t *testing.T) {
+	cfg := config.NodeDBConfig{Path: filepath.Join(t.TempDir(), "nodes", "nodes.json"), History: 2}
+	db, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	db.Observe(&message.Packet{From: 7, ReceivedAt: at, SNR: 5.5, RSSI: -90,
+		Payload: &message.User{ID: "!00000007", LongName: "Seven", ShortName: "SVN"}})
+	db.Observe(&message.Packet{From: 7, ReceivedAt: at.Add(time.Minute),
+		Payload: &message.Position{Latitude: 45.5, Longitude: -122.6, Distance: 1000}})
+	for i := uint32(1); i <= 3; i++ {
+		db.Observe(&message.Packet{From: 7, ReceivedAt: at.Add(time.Duration(i+1) * time.Minute),
+			Payload: &message.Telemetry{BatteryLevel: 90 + i}})
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	db, err = Open(cfg)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	n := db.Node(7)
+	if n == nil || n.User == nil || n.User.LongName != "Seven" {
+		t.Fatalf("user not persisted: %+v", n)
+	}
+	if n.Position == nil || n.Position.Latitude != 45.5 || n.Position.Distance != 0 {
+		t.Errorf("position = %+v", n.Position)
+	}
+	if !n.LastHeard.Equal(at.Add(4*time.Minute)) || n.RSSI != -90 {
+		t.Errorf("last heard %v rssi %d", n.LastHeard, n.RSSI)
+	}
+	if len(n.Metrics) != 2 || n.Metrics[0].BatteryLevel != 92 || n.Latest().BatteryLevel != 93 {
+		t.Errorf("metrics = %+v", n.Metrics)
+	}
+
+	info := db.GetNodeInfo(7)
+	if info.LastHeard != uint32(at.Add(4*time.Minute).Unix()) || info.DeviceMetrics.BatteryLevel != 93 {
+		t.Errorf("directory entry = %+v", info)
+	}
+}
+
+func TestImportKeepsNewerObservations(t *testing.T) {
+	db, err := Open(config.NodeDBConfig{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	at := time.Unix(1_700_000_000, 0)
+	db.Observe(&message.Packet{From: 1, ReceivedAt: at, Payload: &message.User{LongName: "Heard"}})
+
+	db.Import([]*meshtastic.NodeInfo{
+		{Num: 1, LastHeard: uint32(at.Unix()) - 60, User: &meshtastic.User{LongName: "Stale"}},
+		{Num: 2, LastHeard: uint32(at.Unix()), User: &meshtastic.User{LongName: "Device"},
+			Position: &meshtastic.Position{LatitudeI: 455000000, LongitudeI: -1226000000}},
+	})
+
+	if got := db.Node(1).User.LongName; got != "Heard" {
+		t.Errorf("node 1 name = %q, want the newer observation", got)
+	}
+	n := db.Node(2)
+	if n == nil || n.User.LongName != "Device" || n.Position == nil || n.Position.Latitude != 45.5 {
+		t.Errorf("node 2 = %+v", n)
+	}
+	if db.Len() != 2 {
+		t.Errorf("Len = %d", db.Len())
+	}
+}
+
+func TestHistorySince(t *testing.T) {
+	db, err := Open(config.NodeDBConfig{History: 10})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	at := time.Unix(1_700_000_000, 0)
+	for i := 0; i < 4; i++ {
+		db.Observe(&message.Packet{From: 3, ReceivedAt: at.Add(time.Duration(i) * time.Hour), SNR: float32(i),
+			Payload: &message.Telemetry{BatteryLevel: uint32(80 + i)}})
+	}
+
+	h := db.History(3, at.Add(2*time.Hour))
+	if h == nil || len(h.Telemetry) != 2 || len(h.Signal) != 2 {
+		t.Fatalf("history = %+v", h)
+	}
+	if h.Telemetry[0].BatteryLevel != 82 || h.Signal[1].SNR != 3 {
+		t.Errorf("history = %+v", h)
+	}
+	if db.History(4, time.Time{}) != nil {
+		t.Error("history for unknown node")
+	}
+}
+
+func TestAliases(t *testing.T) {
+	db, err := Open(config.NodeDBConfig{Aliases: map[string]string{"!00000007": "Base Camp", "9": "Ridge"}})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	db.Observe(&message.Packet{From: 7, Payload: &message.User{ID: "!00000007", LongName: "Seven", ShortName: "SVN"}})
+
+	if info := db.Info(7); info == nil || info.User.LongName != "Base Camp" || info.User.ShortName != "SVN" {
+		t.Errorf("Info(7) = %+v", info)
+	}
+	if n := db.Node(7); n.User.LongName != "Seven" {
+		t.Errorf("alias stored in the database: %+v", n.User)
+	}
+	// Aliased nodes are named before they announce themselves
+	if info := db.Info(9); info == nil || info.User.LongName != "Ridge" {
+		t.Errorf("Info(9) = %+v", info)
+	}
+	if info := db.Info(8); info != nil {
+		t.Errorf("Info(8) = %+v, want nil", info)
+	}
+
+	if _, err := Open(config.NodeDBConfig{Aliases: map[string]string{"base": "Base Camp"}}); err == nil {
+		t.Error("alias with an invalid node ID accepted")
+	}
+}
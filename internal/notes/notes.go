@@ -0,0 +1,214 @@
+// Package notes keeps operator notes on packets and nodes, such as "false
+// alarm" or "during antenna test", and persists them to disk so they stay
+// with the history when reviewing an incident.
+package notes
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/state"
+)
+
+// MaxTextLength is the longest note text accepted, in bytes
+const MaxTextLength = 1000
+
+// Note is a note on a node, or on a packet when Packet is set. A packet
+// note's Node is the packet's sender, when known.
+type Note struct {
+	ID      uint64    `json:"id"`
+	Node    uint32    `json:"node,omitempty"`
+	Packet  uint32    `json:"packet,omitempty"`
+	Text    string    `json:"text"`
+	Tags    []string  `json:"tags,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// ForPacket reports whether the note is on p
+func (n *Note) ForPacket(p *message.Packet) bool {
+	return n.Packet != 0 && n.Packet == p.ID && (n.Node == 0 || n.Node == p.From)
+}
+
+// String returns the note's text followed by its tags, e.g. "false alarm
+// #test"
+func (n *Note) String() string {
+	text := n.Text
+	for _, tag := range n.Tags {
+		text = strings.TrimSpace(text + " #" + tag)
+	}
+	return text
+}
+
+// Query selects notes; zero fields match every note
+type Query struct {
+	Node   uint32
+	Packet uint32
+	Tag    string
+}
+
+func (q Query) matches(n *Note) bool {
+	return (q.Node == 0 || n.Node == q.Node) &&
+		(q.Packet == 0 || n.Packet == q.Packet) &&
+		(q.Tag == "" || slices.Contains(n.Tags, q.Tag))
+}
+
+// snapshot is the on-disk format
+type snapshot struct {
+	NextID uint64  `json:"next_id"`
+	Notes  []*Note `json:"notes"`
+}
+
+// Store holds the notes. It is safe for concurrent use.
+type Store struct {
+	path string
+	now  func() time.Time
+
+	mu     sync.RWMutex
+	notes  []*Note
+	nextID uint64
+}
+
+// Open loads the notes from cfg.Path. A missing file starts with no notes;
+// an empty path keeps them in memory only.
+func Open(cfg config.NotesConfig) (*Store, error) {
+	s := &Store{path: cfg.Path, now: time.Now, nextID: 1}
+	if s.path == "" {
+		return s, nil
+	}
+
+	err := state.Load(s.path, func(data []byte) error {
+		var snap snapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return err
+		}
+		for _, n := range snap.Notes {
+			if n != nil {
+				s.notes = append(s.notes, n)
+				s.nextID = max(s.nextID, n.ID+1)
+			}
+		}
+		s.nextID = max(s.nextID, snap.NextID)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notes: %w", err)
+	}
+	return s, nil
+}
+
+// Add stores a note on n.Node or n.Packet, assigning its ID and creation
+// time, and saves the notes
+func (s *Store) Add(n Note) (*Note, error) {
+	n.Text = strings.TrimSpace(n.Text)
+	switch {
+	case n.Node == 0 && n.Packet == 0:
+		return nil, fmt.Errorf("a note needs a node or a packet")
+	case n.Text == "" && len(n.Tags) == 0:
+		return nil, fmt.Errorf("a note needs text or tags")
+	case len(n.Text) > MaxTextLength:
+		return nil, fmt.Errorf("text is longer than %d bytes", MaxTextLength)
+	}
+	for _, tag := range n.Tags {
+		if strings.TrimSpace(tag) == "" {
+			return nil, fmt.Errorf("tags must not be empty")
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n.ID = s.nextID
+	n.Created = s.now()
+	s.nextID++
+	s.notes = append(s.notes, &n)
+	if err := s.save(); err != nil {
+		s.notes = s.notes[:len(s.notes)-1]
+		return nil, err
+	}
+	c := n.copy()
+	return &c, nil
+}
+
+// Delete removes the note with the given ID and saves the notes. It
+// reports whether the note existed.
+func (s *Store) Delete(id uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.notes, func(n *Note) bool { return n.ID == id })
+	if i < 0 {
+		return false, nil
+	}
+	removed := s.notes[i]
+	s.notes = slices.Delete(s.notes, i, i+1)
+	if err := s.save(); err != nil {
+		s.notes = slices.Insert(s.notes, i, removed)
+		return true, err
+	}
+	return true, nil
+}
+
+// List returns copies of the notes q selects, oldest first
+func (s *Store) List(q Query) []Note {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := []Note{}
+	for _, n := range s.notes {
+		if q.matches(n) {
+			list = append(list, n.copy())
+		}
+	}
+	return list
+}
+
+// OnNode returns the notes on the node itself, not on its packets
+func (s *Store) OnNode(num uint32) []Note {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []Note
+	for _, n := range s.notes {
+		if n.Node == num && n.Packet == 0 {
+			list = append(list, n.copy())
+		}
+	}
+	return list
+}
+
+// OnPacket returns the notes on p
+func (s *Store) OnPacket(p *message.Packet) []Note {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []Note
+	for _, n := range s.notes {
+		if n.ForPacket(p) {
+			list = append(list, n.copy())
+		}
+	}
+	return list
+}
+
+func (n *Note) copy() Note {
+	c := *n
+	c.Tags = slices.Clone(n.Tags)
+	return c
+}
+
+// save writes the notes to disk. Notes change rarely and by hand, so each
+// change is written at once. The caller holds s.mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(snapshot{NextID: s.nextID, Notes: s.notes})
+	if err != nil {
+		return fmt.Errorf("failed to encode notes: %w", err)
+	}
+	if err := state.WriteFile(s.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write notes: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package notes
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.json")
+	s, err := Open(config.NotesConfig{Path: path})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	onNode, err := s.Add(Note{Node: 0x1234, Text: " solar panel replaced "})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if onNode.ID != 1 || onNode.Text != "solar panel replaced" || onNode.Created.IsZero() {
+		t.Errorf("Add = %+v", onNode)
+	}
+	if _, err := s.Add(Note{Node: 0x1234, Packet: 99, Text: "false alarm", Tags: []string{"test"}}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if _, err := s.Add(Note{Packet: 7, Tags: []string{"antenna", "test"}}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	for _, bad := range []Note{
+		{Text: "on nothing"},
+		{Node: 1},
+		{Node: 1, Tags: []string{" "}},
+	} {
+		if _, err := s.Add(bad); err == nil {
+			t.Errorf("Add(%+v) accepted", bad)
+		}
+	}
+
+	// Notes survive a restart, and IDs are not reused
+	s, err = Open(config.NotesConfig{Path: path})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if got := s.List(Query{}); len(got) != 3 {
+		t.Fatalf("List = %+v", got)
+	}
+	if got := s.OnNode(0x1234); len(got) != 1 || got[0].ID != 1 {
+		t.Errorf("OnNode = %+v", got)
+	}
+	if got := s.OnPacket(&message.Packet{ID: 99, From: 0x1234}); len(got) != 1 || got[0].String() != "false alarm #test" {
+		t.Errorf("OnPacket = %+v", got)
+	}
+	if got := s.OnPacket(&message.Packet{ID: 99, From: 0x5678}); len(got) != 0 {
+		t.Errorf("OnPacket matched another sender's packet: %+v", got)
+	}
+	if got := s.List(Query{Tag: "test"}); len(got) != 2 {
+		t.Errorf("List by tag = %+v", got)
+	}
+
+	if found, err := s.Delete(1); !found || err != nil {
+		t.Errorf("Delete = %v, %v", found, err)
+	}
+	if found, _ := s.Delete(1); found {
+		t.Error("Delete found a deleted note")
+	}
+	next, err := s.Add(Note{Node: 0x1234, Text: "moved to the roof"})
+	if err != nil || next.ID != 4 {
+		t.Errorf("Add after delete = %+v, %v", next, err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"text/template"
 	"time"
 
 	"github.com/iamruinous/meshtastic-message-relay/internal/config"
@@ -26,8 +27,10 @@ type Apprise struct {
 	timeout        time.Duration
 	headers        map[string]string
 	enabled        bool
-	client         *http.Client
 	channelConfigs map[uint32]AppriseChannelConfig
+	titleTmpl      *template.Template
+	bodyTmpl       *template.Template
+	httpSender
 }
 
 // ApprisePayload is the JSON payload sent to Apprise
@@ -91,6 +94,20 @@ func NewApprise(cfg config.OutputConfig) (*Apprise, error) {
 		}
 	}
 
+	titleTmpl, err := templateOption(cfg.Options, "title_template")
+	if err != nil {
+		return nil, err
+	}
+	bodyTmpl, err := templateOption(cfg.Options, "body_template")
+	if err != nil {
+		return nil, err
+	}
+
+	sender, err := newHTTPSender(cfg, timeout)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Apprise{
 		url:            url,
 		tag:            tag,
@@ -98,40 +115,21 @@ func NewApprise(cfg config.OutputConfig) (*Apprise, error) {
 		headers:        headers,
 		enabled:        cfg.Enabled,
 		channelConfigs: channelConfigs,
-		client: &http.Client{
-			Timeout: timeout,
-		},
+		titleTmpl:      titleTmpl,
+		bodyTmpl:       bodyTmpl,
+		httpSender:     sender,
 	}, nil
 }
 
 // Send sends a message to Apprise
 func (a *Apprise) Send(ctx context.Context, msg *message.Packet) error {
-	// Check for per-channel enabled override
-	if chCfg, ok := a.channelConfigs[msg.Channel]; ok && chCfg.Enabled != nil {
-		if !*chCfg.Enabled {
-			return nil // Channel is explicitly disabled
-		}
-	}
-
-	title := a.formatTitle(msg)
-	body := a.formatBody(msg)
-
-	// Use per-channel tag if configured, otherwise fall back to default
-	tag := a.tag
-	if chCfg, ok := a.channelConfigs[msg.Channel]; ok && chCfg.Tag != "" {
-		tag = chCfg.Tag
-	}
-
-	payload := ApprisePayload{
-		Body:  body,
-		Title: title,
-		Type:  "info",
-		Tag:   tag,
+	if !a.channelEnabled(msg.Channel) {
+		return nil // Channel is explicitly disabled
 	}
 
-	data, err := json.Marshal(payload)
+	data, err := a.payload(msg)
 	if err != nil {
-		return fmt.Errorf("failed to marshal apprise payload: %w", err)
+		return err
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", a.url, bytes.NewReader(data))
@@ -144,17 +142,67 @@ func (a *Apprise) Send(ctx context.Context, msg *message.Packet) error {
 		req.Header.Set(k, v)
 	}
 
-	resp, err := a.client.Do(req)
+	return a.do(req, "apprise")
+}
+
+// Preview renders the notification that would be sent
+func (a *Apprise) Preview(msg *message.Packet) (*Preview, error) {
+	p := &Preview{
+		Target:  MaskURL(a.url),
+		Method:  "POST",
+		Headers: maskHeaders(a.headers),
+	}
+	if !a.channelEnabled(msg.Channel) {
+		p.Skipped = fmt.Sprintf("channel %d is disabled", msg.Channel)
+		return p, nil
+	}
+
+	data, err := a.payload(msg)
 	if err != nil {
-		return fmt.Errorf("failed to send to apprise: %w", err)
+		return nil, err
 	}
-	defer func() { _ = resp.Body.Close() }()
+	p.Body = string(data)
+	return p, nil
+}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("apprise returned status %d", resp.StatusCode)
+// channelEnabled applies the per-channel enabled override
+func (a *Apprise) channelEnabled(channel uint32) bool {
+	if chCfg, ok := a.channelConfigs[channel]; ok && chCfg.Enabled != nil {
+		return *chCfg.Enabled
 	}
+	return true
+}
 
-	return nil
+func (a *Apprise) payload(msg *message.Packet) ([]byte, error) {
+	// Use per-channel tag if configured, otherwise fall back to default
+	tag := a.tag
+	if chCfg, ok := a.channelConfigs[msg.Channel]; ok && chCfg.Tag != "" {
+		tag = chCfg.Tag
+	}
+
+	title, body := a.formatTitle(msg), a.formatBody(msg)
+	var err error
+	if a.titleTmpl != nil {
+		if title, err = execute(a.titleTmpl, msg); err != nil {
+			return nil, err
+		}
+	}
+	if a.bodyTmpl != nil {
+		if body, err = execute(a.bodyTmpl, msg); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.Marshal(ApprisePayload{
+		Body:  body,
+		Title: title,
+		Type:  "info",
+		Tag:   tag,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal apprise payload: %w", err)
+	}
+	return data, nil
 }
 
 func (a *Apprise) formatTitle(msg *message.Packet) string {
@@ -181,12 +229,13 @@ func (a *Apprise) formatBody(msg *message.Packet) string {
 
 // Close closes the Apprise output
 func (a *Apprise) Close() error {
+	a.closeIdle()
 	return nil
 }
 
 // Name returns the output identifier
 func (a *Apprise) Name() string {
-	return fmt.Sprintf("apprise:%s", a.url)
+	return fmt.Sprintf("apprise:%s", MaskURL(a.url))
 }
 
 // Enabled returns whether this output is enabled
@@ -8,6 +8,20 @@ import (
 
 // New creates a new Output based on the configuration
 func New(cfg config.OutputConfig) (Output, error) {
+	out, err := newOutput(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := withTransforms(cfg, out)
+	if err != nil {
+		_ = out.Close()
+		return nil, fmt.Errorf("%s output: %w", cfg.Type, err)
+	}
+	return wrapped, nil
+}
+
+func newOutput(cfg config.OutputConfig) (Output, error) {
 	switch cfg.Type {
 	case "stdout":
 		return NewStdout(cfg)
@@ -17,6 +31,26 @@ func New(cfg config.OutputConfig) (Output, error) {
 		return NewApprise(cfg)
 	case "webhook":
 		return NewWebhook(cfg)
+	case "mqtt":
+		return NewMQTT(cfg)
+	case "homeassistant":
+		return NewHomeAssistant(cfg)
+	case "sse":
+		return NewSSE(cfg)
+	case "telegram":
+		return NewTelegram(cfg)
+	case "slack":
+		return NewSlack(cfg)
+	case "influxdb":
+		return NewInfluxDB(cfg)
+	case "tak":
+		return NewTAK(cfg)
+	case "kafka":
+		return NewKafka(cfg)
+	case "nats":
+		return NewNATS(cfg)
+	case "sms":
+		return NewSMS(cfg)
 	default:
 		return nil, fmt.Errorf("unknown output type: %s", cfg.Type)
 	}
@@ -1,13 +1,17 @@
 package output
 
 import (
+	"compress/gzip"
 	"context"
-	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
-	"time"
+	"text/template"
+
+	"github.com/klauspost/compress/zstd"
 
 	"github.com/iamruinous/meshtastic-message-relay/internal/config"
 	"github.com/iamruinous/meshtastic-message-relay/internal/message"
@@ -17,17 +21,105 @@ import (
 type File struct {
 	path       string
 	format     string
+	tmpl       *template.Template // replaces format when set
 	enabled    bool
 	rotate     bool
 	maxSizeMB  int
 	maxBackups int
+	compress   string // gzip or zstd, empty for plain text
 
 	mu   sync.Mutex
 	file *os.File
+	enc  encoder // compresses into file when compress is set
+	size int64   // bytes in file, tracked to avoid a stat per message
+}
+
+// encoder is a streaming compressor
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressExt maps compression names to the file extension they add
+var compressExt = map[string]string{
+	"gzip": ".gz",
+	"zstd": ".zst",
+}
+
+// sizeWriter writes to the file, counting the bytes that reach disk
+type sizeWriter struct{ f *File }
+
+func (w sizeWriter) Write(p []byte) (int, error) {
+	n, err := w.f.file.Write(p)
+	w.f.size += int64(n)
+	return n, err
 }
 
 // NewFile creates a new file output
 func NewFile(cfg config.OutputConfig) (*File, error) {
+	f, err := newFile(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure directory exists
+	dir := filepath.Dir(f.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	if err := f.open(); err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	return f, nil
+}
+
+// open opens the file for appending and records its current size. A
+// compressed file gets a new gzip member or zstd frame each time it is
+// opened; readers decode them as one stream.
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+
+	switch f.compress {
+	case "gzip":
+		f.enc = gzip.NewWriter(sizeWriter{f})
+	case "zstd":
+		enc, err := zstd.NewWriter(sizeWriter{f}, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			_ = file.Close()
+			return err
+		}
+		f.enc = enc
+	}
+	return nil
+}
+
+// closeFile ends the compressed stream, if any, and closes the file
+func (f *File) closeFile() error {
+	var err error
+	if f.enc != nil {
+		err = f.enc.Close()
+		f.enc = nil
+	}
+	if cerr := f.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// newFile parses the file output settings without touching the filesystem
+func newFile(cfg config.OutputConfig) (*File, error) {
 	path := "/var/log/meshtastic/messages.log"
 	if p, ok := cfg.Options["path"].(string); ok {
 		path = p
@@ -59,33 +151,37 @@ func NewFile(cfg config.OutputConfig) (*File, error) {
 		maxBackups = int(m)
 	}
 
-	f := &File{
-		path:       path,
-		format:     format,
-		enabled:    cfg.Enabled,
-		rotate:     rotate,
-		maxSizeMB:  maxSizeMB,
-		maxBackups: maxBackups,
+	compress, _ := cfg.Options["compression"].(string)
+	if compress == "none" {
+		compress = ""
 	}
-
-	// Ensure directory exists
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	if ext, ok := compressExt[compress]; ok {
+		if !strings.HasSuffix(path, ext) {
+			path += ext
+		}
+	} else if compress != "" {
+		return nil, fmt.Errorf("file compression must be none, gzip, or zstd")
 	}
 
-	// Open file for appending
-	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	tmpl, err := templateOption(cfg.Options, "template")
 	if err != nil {
-		return nil, fmt.Errorf("failed to open log file: %w", err)
+		return nil, err
 	}
-	f.file = file
 
-	return f, nil
+	return &File{
+		path:       path,
+		format:     format,
+		tmpl:       tmpl,
+		enabled:    cfg.Enabled,
+		rotate:     rotate,
+		maxSizeMB:  maxSizeMB,
+		maxBackups: maxBackups,
+		compress:   compress,
+	}, nil
 }
 
 // Send writes a message to the file
-func (f *File) Send(_ context.Context, msg *message.Packet) error {
+func (f *File) Send(ctx context.Context, msg *message.Packet) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
@@ -95,69 +191,70 @@ func (f *File) Send(_ context.Context, msg *message.Packet) error {
 		}
 	}
 
-	var line string
-	if f.format == "json" {
-		data, err := json.Marshal(msg)
-		if err != nil {
-			return fmt.Errorf("failed to marshal message: %w", err)
-		}
-		line = string(data) + "\n"
-	} else {
-		timestamp := msg.ReceivedAt.Format(time.RFC3339)
-		fromNode := fmt.Sprintf("!%08x", msg.From)
-		if msg.FromNode != nil && msg.FromNode.User != nil {
-			fromNode = msg.FromNode.User.ShortName
-		}
-
-		var payload string
-		switch p := msg.Payload.(type) {
-		case *message.TextMessage:
-			payload = p.Text
-		case string:
-			payload = p
-		default:
-			payload = fmt.Sprintf("%v", msg.Payload)
-		}
-
-		line = fmt.Sprintf("[%s] %s (%s): %s\n", timestamp, fromNode, msg.PortNum.String(), payload)
+	line, err := f.formatLine(render(ctx, msg))
+	if err != nil {
+		return err
 	}
 
-	_, err := f.file.WriteString(line)
-	return err
+	if f.enc == nil {
+		_, err = sizeWriter{f}.Write(line)
+		return err
+	}
+	// Flush every line so a crash loses at most the line being written
+	if _, err := f.enc.Write(line); err != nil {
+		return err
+	}
+	return f.enc.Flush()
 }
 
-func (f *File) checkRotation() error {
-	info, err := f.file.Stat()
+// Preview renders the line that would be appended
+func (f *File) Preview(msg *message.Packet) (*Preview, error) {
+	line, err := f.formatLine(NewRender(msg))
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return &Preview{Target: f.path, Body: strings.TrimSuffix(string(line), "\n")}, nil
+}
+
+// formatLine returns the newline-terminated line for a message
+func (f *File) formatLine(r *Render) ([]byte, error) {
+	if f.tmpl != nil {
+		line, err := execute(f.tmpl, r.msg)
+		return []byte(line + "\n"), err
+	}
+	if f.format != "json" {
+		return []byte(r.Text() + "\n"), nil
 	}
+	return r.JSONLine()
+}
 
+func (f *File) checkRotation() error {
 	maxBytes := int64(f.maxSizeMB) * 1024 * 1024
-	if info.Size() < maxBytes {
+	if f.size < maxBytes {
 		return nil
 	}
 
-	// Close current file
-	_ = f.file.Close()
+	// Close current file, finishing its compressed stream before it is
+	// renamed so every backup decodes cleanly
+	_ = f.closeFile()
 
 	// Rotate existing backups
 	for i := f.maxBackups - 1; i >= 1; i-- {
-		oldPath := fmt.Sprintf("%s.%d", f.path, i)
-		newPath := fmt.Sprintf("%s.%d", f.path, i+1)
-		_ = os.Rename(oldPath, newPath)
+		_ = os.Rename(f.backupPath(i), f.backupPath(i+1))
 	}
 
 	// Rename current to .1
-	_ = os.Rename(f.path, f.path+".1")
+	_ = os.Rename(f.path, f.backupPath(1))
 
 	// Open new file
-	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
-	if err != nil {
-		return err
-	}
-	f.file = file
+	return f.open()
+}
 
-	return nil
+// backupPath returns the name of the nth backup. Compressed backups keep
+// their extension last, e.g. messages.log.1.zst.
+func (f *File) backupPath(n int) string {
+	ext := compressExt[f.compress]
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(f.path, ext), n, ext)
 }
 
 // Close closes the file
@@ -166,7 +263,7 @@ func (f *File) Close() error {
 	defer f.mu.Unlock()
 
 	if f.file != nil {
-		return f.file.Close()
+		return f.closeFile()
 	}
 	return nil
 }
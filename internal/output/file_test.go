@@ -0,0 +1,127 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// readLog returns the IDs of the packets in a log file
+func readLog(t *testing.T, path string) []uint32 {
+	t.Helper()
+	f, err := message.OpenLog(path)
+	if err != nil {
+		t.Fatalf("OpenLog(%s) failed: %v", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var ids []uint32
+	r := message.NewReader(f)
+	for {
+		p, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return ids
+		}
+		if err != nil {
+			t.Fatalf("reading %s: %v", path, err)
+		}
+		ids = append(ids, p.ID)
+	}
+}
+
+func TestFileCompressionAppends(t *testing.T) {
+	for _, compression := range []string{"gzip", "zstd"} {
+		t.Run(compression, func(t *testing.T) {
+			cfg := config.OutputConfig{Type: "file", Enabled: true, Options: map[string]interface{}{
+				"path":        filepath.Join(t.TempDir(), "messages.log"),
+				"compression": compression,
+			}}
+
+			// Each run appends a new stream that reads back as one log
+			for id := uint32(1); id <= 2; id++ {
+				f, err := NewFile(cfg)
+				if err != nil {
+					t.Fatalf("NewFile failed: %v", err)
+				}
+				if err := f.Send(context.Background(), &message.Packet{ID: id}); err != nil {
+					t.Fatalf("Send failed: %v", err)
+				}
+				if err := f.Close(); err != nil {
+					t.Fatalf("Close failed: %v", err)
+				}
+			}
+
+			path := cfg.Options["path"].(string) + compressExt[compression]
+			if got := readLog(t, path); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+				t.Errorf("read %v, want [1 2]", got)
+			}
+		})
+	}
+}
+
+func TestFileCompressionReadsUnclosedLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.log.zst")
+	f, err := NewFile(config.OutputConfig{Type: "file", Options: map[string]interface{}{
+		"path":        path,
+		"compression": "zstd",
+	}})
+	if err != nil {
+		t.Fatalf("NewFile failed: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	for id := uint32(1); id <= 3; id++ {
+		if err := f.Send(context.Background(), &message.Packet{ID: id}); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+	if got := readLog(t, path); len(got) != 3 {
+		t.Errorf("read %v from a log still open, want 3 packets", got)
+	}
+}
+
+func TestFileCompressionRotates(t *testing.T) {
+	dir := t.TempDir()
+	f, err := NewFile(config.OutputConfig{Type: "file", Options: map[string]interface{}{
+		"path":        filepath.Join(dir, "messages.log"),
+		"compression": "zstd",
+		"max_size_mb": 0, // rotate before every line
+	}})
+	if err != nil {
+		t.Fatalf("NewFile failed: %v", err)
+	}
+	for id := uint32(1); id <= 3; id++ {
+		if err := f.Send(context.Background(), &message.Packet{ID: id}); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	for name, want := range map[string]uint32{
+		"messages.log.zst":   3,
+		"messages.log.1.zst": 2,
+		"messages.log.2.zst": 1,
+	} {
+		if got := readLog(t, filepath.Join(dir, name)); len(got) != 1 || got[0] != want {
+			t.Errorf("%s holds %v, want [%d]", name, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "messages.log.1")); err == nil {
+		t.Error("backup named without its compression extension")
+	}
+}
+
+func TestFileCompressionInvalid(t *testing.T) {
+	_, err := newFile(config.OutputConfig{Type: "file", Options: map[string]interface{}{"compression": "lz4"}})
+	if err == nil {
+		t.Error("expected an error for an unknown compression")
+	}
+}
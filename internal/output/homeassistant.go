@@ -0,0 +1,245 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// DefaultHADiscoveryPrefix is Home Assistant's default discovery prefix
+const DefaultHADiscoveryPrefix = "homeassistant"
+
+// haStateLength is the longest state Home Assistant accepts
+const haStateLength = 255
+
+// HomeAssistant publishes Home Assistant MQTT discovery configs and state
+// for each node heard, so nodes appear as devices with battery, voltage,
+// last text message, and last seen sensors and a GPS device tracker. The
+// configs are sent, retained, the first time a node is heard and again
+// when its name changes. State is retained under <topic>/<id>/.
+type HomeAssistant struct {
+	*mqttBroker
+	prefix  string
+	topic   string
+	enabled bool
+
+	announceMu sync.Mutex
+	// announced holds the device name each node was announced with
+	announced map[uint32]string
+}
+
+// haEntity is a Home Assistant entity created for every node
+type haEntity struct {
+	component string
+	key       string
+	config    map[string]interface{}
+}
+
+// haEntities are the entities of a node. State topics are relative to the
+// node's topic.
+var haEntities = []haEntity{
+	{"sensor", "battery", map[string]interface{}{
+		"name": "Battery", "device_class": "battery", "unit_of_measurement": "%",
+		"state_class": "measurement", "state_topic": "battery",
+	}},
+	{"sensor", "voltage", map[string]interface{}{
+		"name": "Voltage", "device_class": "voltage", "unit_of_measurement": "V",
+		"state_class": "measurement", "state_topic": "voltage",
+	}},
+	{"sensor", "last_text", map[string]interface{}{
+		"name": "Last message", "icon": "mdi:message-text", "state_topic": "text",
+	}},
+	{"sensor", "last_seen", map[string]interface{}{
+		"name": "Last seen", "device_class": "timestamp", "entity_category": "diagnostic",
+		"state_topic": "lastseen",
+	}},
+	{"device_tracker", "position", map[string]interface{}{
+		"name": "Position", "source_type": "gps", "json_attributes_topic": "position",
+	}},
+}
+
+// NewHomeAssistant creates a new Home Assistant discovery output. The
+// broker connection is made on first send.
+func NewHomeAssistant(cfg config.OutputConfig) (*HomeAssistant, error) {
+	broker, err := newMQTTBroker("homeassistant", cfg.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &HomeAssistant{
+		mqttBroker: broker,
+		prefix:     DefaultHADiscoveryPrefix,
+		topic:      DefaultMQTTTopic,
+		enabled:    cfg.Enabled,
+		announced:  make(map[uint32]string),
+	}
+	if p, ok := cfg.Options["discovery_prefix"].(string); ok && p != "" {
+		h.prefix = strings.TrimSuffix(p, "/")
+	}
+	if t, ok := cfg.Options["topic"].(string); ok && t != "" {
+		h.topic = strings.TrimSuffix(t, "/")
+	}
+	for _, t := range []string{h.prefix, h.topic} {
+		if strings.ContainsAny(t, "+#") {
+			return nil, fmt.Errorf("homeassistant topics must not contain wildcards")
+		}
+	}
+
+	return h, nil
+}
+
+// Send publishes the node's discovery configs if needed, then its state
+func (h *HomeAssistant) Send(ctx context.Context, msg *message.Packet) error {
+	if msg.From == 0 {
+		return nil
+	}
+
+	h.announceMu.Lock()
+	name, announce := h.needsAnnounce(msg)
+	h.announceMu.Unlock()
+
+	pubs, err := h.publications(msg, announce)
+	if err != nil {
+		return err
+	}
+	if err := h.publish(ctx, pubs); err != nil {
+		return err
+	}
+
+	if announce {
+		h.announceMu.Lock()
+		h.announced[msg.From] = name
+		h.announceMu.Unlock()
+	}
+	return nil
+}
+
+// needsAnnounce returns the node's device name and whether its discovery
+// configs must be sent. A packet without node info falls back to the bare
+// node id, which does not replace a name already announced.
+func (h *HomeAssistant) needsAnnounce(msg *message.Packet) (string, bool) {
+	name := nodeName(msg)
+	prev, ok := h.announced[msg.From]
+	if ok && (name == prev || name == hexID(msg.From)) {
+		return prev, false
+	}
+	return name, true
+}
+
+// Preview renders the discovery configs and state that would be published
+// for a node heard for the first time
+func (h *HomeAssistant) Preview(msg *message.Packet) (*Preview, error) {
+	if msg.From == 0 {
+		return &Preview{Target: h.Name(), Skipped: "no sending node"}, nil
+	}
+	pubs, err := h.publications(msg, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var body strings.Builder
+	for i, pub := range pubs {
+		if i > 0 {
+			body.WriteString("\n")
+		}
+		fmt.Fprintf(&body, "%s (retained): %s", pub.topic, pub.payload)
+	}
+	return &Preview{Target: h.Name(), Body: body.String()}, nil
+}
+
+func (h *HomeAssistant) publications(msg *message.Packet, announce bool) ([]mqttPublication, error) {
+	id := fmt.Sprintf("%08x", msg.From)
+	node := h.topic + "/" + id + "/"
+
+	var pubs []mqttPublication
+	add := func(topic string, v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", topic, err)
+		}
+		pubs = append(pubs, mqttPublication{topic: topic, retained: true, payload: data})
+		return nil
+	}
+
+	if announce {
+		device := map[string]interface{}{
+			"identifiers":  []string{"meshtastic_" + id},
+			"name":         nodeName(msg),
+			"manufacturer": "Meshtastic",
+		}
+		if msg.FromNode != nil && msg.FromNode.User != nil && msg.FromNode.User.HWModel != "" {
+			device["model"] = msg.FromNode.User.HWModel
+		}
+		for _, e := range haEntities {
+			cfg := map[string]interface{}{
+				"unique_id": fmt.Sprintf("meshtastic_%s_%s", id, e.key),
+				"device":    device,
+			}
+			for k, v := range e.config {
+				if strings.HasSuffix(k, "_topic") {
+					v = node + v.(string)
+				}
+				cfg[k] = v
+			}
+			topic := fmt.Sprintf("%s/%s/meshtastic_%s/%s/config", h.prefix, e.component, id, e.key)
+			if err := add(topic, cfg); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var err error
+	switch p := msg.Payload.(type) {
+	case *message.Telemetry:
+		if err = add(node+"battery", p.BatteryLevel); err == nil {
+			err = add(node+"voltage", p.Voltage)
+		}
+	case *message.Position:
+		if p.Latitude != 0 || p.Longitude != 0 {
+			attrs := map[string]interface{}{
+				"latitude":  p.Latitude,
+				"longitude": p.Longitude,
+				// Home Assistant requires an accuracy; Meshtastic
+				// positions do not carry one
+				"gps_accuracy": 0,
+			}
+			if p.Altitude != 0 {
+				attrs["altitude"] = p.Altitude
+			}
+			err = add(node+"position", attrs)
+		}
+	case *message.TextMessage:
+		text := []rune(p.Text)
+		if len(text) > haStateLength {
+			text = text[:haStateLength]
+		}
+		pubs = append(pubs, mqttPublication{topic: node + "text", retained: true, payload: []byte(string(text))})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seen := msg.ReceivedAt
+	if seen.IsZero() {
+		seen = time.Now()
+	}
+	pubs = append(pubs, mqttPublication{topic: node + "lastseen", retained: true, payload: []byte(seen.UTC().Format(time.RFC3339))})
+
+	return pubs, nil
+}
+
+// Name returns the output identifier
+func (h *HomeAssistant) Name() string {
+	return fmt.Sprintf("homeassistant:%s/%s", MaskURL(h.broker), h.prefix)
+}
+
+// Enabled returns whether this output is enabled
+func (h *HomeAssistant) Enabled() bool {
+	return h.enabled
+}
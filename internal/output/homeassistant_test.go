@@ -0,0 +1,75 @@
+package output
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestHomeAssistantDiscovery(t *testing.T) {
+	h, err := NewHomeAssistant(config.OutputConfig{Type: "homeassistant", Options: map[string]interface{}{
+		"broker": "tcp://localhost:1883",
+		"topic":  "mesh/",
+	}})
+	if err != nil {
+		t.Fatalf("NewHomeAssistant: %v", err)
+	}
+
+	hiker := &message.NodeInfo{Num: 0x1234abcd, User: &message.User{LongName: "Hiker", HWModel: "TBEAM"}}
+	msg := &message.Packet{
+		From:       0x1234abcd,
+		FromNode:   hiker,
+		PortNum:    message.PortNumPosition,
+		Payload:    &message.Position{Latitude: 46.85, Longitude: -121.76},
+		ReceivedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	pubs, err := h.publications(msg, true)
+	if err != nil {
+		t.Fatalf("publications: %v", err)
+	}
+
+	got := make(map[string]string, len(pubs))
+	for _, pub := range pubs {
+		if !pub.retained {
+			t.Errorf("%s is not retained", pub.topic)
+		}
+		got[pub.topic] = string(pub.payload)
+	}
+	if len(got) != len(haEntities)+2 {
+		t.Errorf("got %d publications: %v", len(got), got)
+	}
+	if got["mesh/1234abcd/lastseen"] != "2026-01-02T03:04:05Z" {
+		t.Errorf("lastseen = %q", got["mesh/1234abcd/lastseen"])
+	}
+
+	var tracker map[string]interface{}
+	if err := json.Unmarshal([]byte(got["homeassistant/device_tracker/meshtastic_1234abcd/position/config"]), &tracker); err != nil {
+		t.Fatalf("tracker config: %v", err)
+	}
+	device, _ := tracker["device"].(map[string]interface{})
+	if tracker["json_attributes_topic"] != "mesh/1234abcd/position" || tracker["unique_id"] != "meshtastic_1234abcd_position" ||
+		device["name"] != "Hiker" || device["model"] != "TBEAM" {
+		t.Errorf("tracker config = %v", tracker)
+	}
+
+	var pos map[string]float64
+	if err := json.Unmarshal([]byte(got["mesh/1234abcd/position"]), &pos); err != nil || pos["latitude"] != 46.85 {
+		t.Errorf("position = %s (%v)", got["mesh/1234abcd/position"], err)
+	}
+
+	// Announced once, and again only when the node gets a new name
+	h.announced[msg.From] = "Hiker"
+	if _, announce := h.needsAnnounce(msg); announce {
+		t.Error("announced again with the same name")
+	}
+	if _, announce := h.needsAnnounce(&message.Packet{From: 0x1234abcd}); announce {
+		t.Error("announced again without node info")
+	}
+	hiker.User.LongName = "Hiker 2"
+	if name, announce := h.needsAnnounce(msg); !announce || name != "Hiker 2" {
+		t.Errorf("needsAnnounce after rename = %s, %v", name, announce)
+	}
+}
@@ -0,0 +1,176 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/proxy"
+)
+
+// DefaultMaxInFlight is how many requests an HTTP output sends at once
+// unless configured otherwise
+const DefaultMaxInFlight = 4
+
+// sharedTransport is used by HTTP outputs without transport overrides so
+// connections to the same host are pooled and kept alive across outputs.
+var sharedTransport = newTransport(transportSettings{
+	maxIdleConns:        100,
+	maxIdleConnsPerHost: 16,
+	idleConnTimeout:     90 * time.Second,
+})
+
+// transportSettings are the tunable connection pool options
+type transportSettings struct {
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	idleConnTimeout     time.Duration
+	disableKeepAlives   bool
+	// proxy replaces the proxy environment variables when proxySet; nil
+	// connects directly
+	proxy    func(*http.Request) (*url.URL, error)
+	proxySet bool
+}
+
+func newTransport(s transportSettings) *http.Transport {
+	proxyFunc := http.ProxyFromEnvironment
+	if s.proxySet {
+		proxyFunc = s.proxy
+	}
+	return &http.Transport{
+		Proxy: proxyFunc,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          s.maxIdleConns,
+		MaxIdleConnsPerHost:   s.maxIdleConnsPerHost,
+		MaxConnsPerHost:       s.maxConnsPerHost,
+		IdleConnTimeout:       s.idleConnTimeout,
+		DisableKeepAlives:     s.disableKeepAlives,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// httpSender holds the client and concurrency settings of an HTTP output
+type httpSender struct {
+	client      *http.Client
+	maxInFlight int
+}
+
+// newHTTPSender builds the client for an HTTP output. Outputs that set any
+// pool option get a dedicated transport; the rest share one.
+func newHTTPSender(cfg config.OutputConfig, timeout time.Duration) (httpSender, error) {
+	maxInFlight := DefaultMaxInFlight
+	if v, ok := IntOption(cfg.Options, "max_in_flight"); ok {
+		if v < 1 {
+			return httpSender{}, fmt.Errorf("max_in_flight must be at least 1")
+		}
+		maxInFlight = v
+	}
+
+	transport := sharedTransport
+	settings := transportSettings{
+		maxIdleConns:        sharedTransport.MaxIdleConns,
+		maxIdleConnsPerHost: sharedTransport.MaxIdleConnsPerHost,
+		idleConnTimeout:     sharedTransport.IdleConnTimeout,
+	}
+	custom := false
+
+	if v, ok := IntOption(cfg.Options, "max_idle_conns"); ok {
+		settings.maxIdleConns, custom = v, true
+	}
+	if v, ok := IntOption(cfg.Options, "max_idle_conns_per_host"); ok {
+		settings.maxIdleConnsPerHost, custom = v, true
+	}
+	if v, ok := IntOption(cfg.Options, "max_conns_per_host"); ok {
+		settings.maxConnsPerHost, custom = v, true
+	}
+	if v, ok := cfg.Options["idle_conn_timeout"].(string); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return httpSender{}, fmt.Errorf("invalid idle_conn_timeout: %w", err)
+		}
+		settings.idleConnTimeout, custom = d, true
+	}
+	if v, ok := cfg.Options["keep_alive"].(bool); ok {
+		settings.disableKeepAlives, custom = !v, true
+	}
+	if v, ok := cfg.Options["proxy"].(string); ok && v != "" {
+		u, err := config.ParseProxy(v)
+		if err != nil {
+			return httpSender{}, err
+		}
+		settings.proxy, settings.proxySet, custom = proxy.HTTP(u), true, true
+	}
+
+	if custom {
+		transport = newTransport(settings)
+	}
+
+	return httpSender{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+		},
+		maxInFlight: maxInFlight,
+	}, nil
+}
+
+// MaxInFlight returns how many requests may be sent concurrently
+func (h *httpSender) MaxInFlight() int {
+	return h.maxInFlight
+}
+
+// maxDrain is how much of an unread response body is discarded so the
+// connection can go back to the pool
+const maxDrain = 64 << 10
+
+// do sends a request and fails on non-2xx responses
+func (h *httpSender) do(req *http.Request, service string) error {
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send to %s: %w", service, err)
+	}
+	defer closeBody(resp)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned status %d", service, resp.StatusCode)
+	}
+	return nil
+}
+
+// closeBody drains what is left of the response body before closing it;
+// the transport only reuses a connection whose body was read to the end
+func closeBody(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrain))
+	_ = resp.Body.Close()
+}
+
+// closeIdle releases pooled connections held for this output
+func (h *httpSender) closeIdle() {
+	if h.client.Transport != sharedTransport {
+		h.client.CloseIdleConnections()
+	}
+}
+
+// IntOption reads a whole-number option, which YAML decodes as an int and
+// JSON as a float64
+func IntOption(opts map[string]interface{}, key string) (int, bool) {
+	switch v := opts[key].(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
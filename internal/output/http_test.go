@@ -0,0 +1,88 @@
+package output
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+)
+
+func TestHTTPSenderOptions(t *testing.T) {
+	sender, err := newHTTPSender(config.OutputConfig{Options: map[string]interface{}{}}, time.Second)
+	if err != nil {
+		t.Fatalf("newHTTPSender failed: %v", err)
+	}
+	if sender.MaxInFlight() != DefaultMaxInFlight {
+		t.Errorf("MaxInFlight() = %d, want %d", sender.MaxInFlight(), DefaultMaxInFlight)
+	}
+	if sender.client.Transport != sharedTransport {
+		t.Error("Expected the shared transport without pool overrides")
+	}
+
+	sender, err = newHTTPSender(config.OutputConfig{Options: map[string]interface{}{
+		"max_in_flight":           8,
+		"max_idle_conns_per_host": 2.0, // numbers decoded from YAML/JSON may be floats
+		"idle_conn_timeout":       "30s",
+		"keep_alive":              false,
+	}}, time.Second)
+	if err != nil {
+		t.Fatalf("newHTTPSender failed: %v", err)
+	}
+	transport, ok := sender.client.Transport.(*http.Transport)
+	if !ok || transport == sharedTransport {
+		t.Fatal("Expected a dedicated transport with pool overrides")
+	}
+	if sender.MaxInFlight() != 8 || transport.MaxIdleConnsPerHost != 2 ||
+		transport.IdleConnTimeout != 30*time.Second || !transport.DisableKeepAlives {
+		t.Errorf("Unexpected settings: in-flight %d, transport %+v", sender.MaxInFlight(), transport)
+	}
+
+	if _, err := newHTTPSender(config.OutputConfig{Options: map[string]interface{}{"max_in_flight": 0}}, time.Second); err == nil {
+		t.Error("Expected error for max_in_flight 0")
+	}
+}
+
+func TestHTTPSenderReusesConnections(t *testing.T) {
+	// The sender never reads the body, and the tail arrives too late for
+	// the transport's own best-effort drain on close
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":`))
+		w.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write([]byte(`true}`))
+	}))
+	var conns int32
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	sender, err := newHTTPSender(config.OutputConfig{Options: map[string]interface{}{
+		"max_idle_conns_per_host": 1,
+	}}, time.Second)
+	if err != nil {
+		t.Fatalf("newHTTPSender failed: %v", err)
+	}
+	defer sender.closeIdle()
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodPost, server.URL, nil)
+		if err != nil {
+			t.Fatalf("NewRequest failed: %v", err)
+		}
+		if err := sender.do(req, "test"); err != nil {
+			t.Fatalf("send %d failed: %v", i+1, err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("Opened %d connections for two sends, want 1", n)
+	}
+}
@@ -0,0 +1,313 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// DefaultInfluxPrefix is prepended to measurement names unless
+// measurement_prefix is set
+const DefaultInfluxPrefix = "meshtastic_"
+
+// InfluxDB writes telemetry, environment readings, positions, and signal
+// reports as line protocol points tagged with the sending node. It writes
+// to an InfluxDB 2 bucket with a token, or to an InfluxDB 1 database.
+// Packets without any of these are not written.
+type InfluxDB struct {
+	url      string
+	writeURL string
+	org      string
+	bucket   string
+	database string
+	token    string
+	username string
+	password string
+	prefix   string
+	enabled  bool
+	httpSender
+}
+
+// influxPoint is a line protocol point
+type influxPoint struct {
+	measurement string
+	tags        map[string]string
+	fields      []influxField
+	at          time.Time
+}
+
+// influxField is a field and its value in line protocol form
+type influxField struct {
+	key   string
+	value string
+}
+
+// NewInfluxDB creates a new InfluxDB output
+func NewInfluxDB(cfg config.OutputConfig) (*InfluxDB, error) {
+	o := &InfluxDB{prefix: DefaultInfluxPrefix, enabled: cfg.Enabled}
+
+	o.url, _ = cfg.Options["url"].(string)
+	if o.url == "" {
+		return nil, fmt.Errorf("influxdb url is required")
+	}
+	o.url = strings.TrimSuffix(o.url, "/")
+	o.org, _ = cfg.Options["org"].(string)
+	o.bucket, _ = cfg.Options["bucket"].(string)
+	o.database, _ = cfg.Options["database"].(string)
+	o.token, _ = cfg.Options["token"].(string)
+	o.username, _ = cfg.Options["username"].(string)
+	o.password, _ = cfg.Options["password"].(string)
+	if p, ok := cfg.Options["measurement_prefix"].(string); ok {
+		o.prefix = p
+	}
+
+	q := url.Values{}
+	switch {
+	case o.bucket != "" && o.database != "":
+		return nil, fmt.Errorf("influxdb takes bucket or database, not both")
+	case o.bucket != "":
+		if o.org == "" {
+			return nil, fmt.Errorf("influxdb org is required with bucket")
+		}
+		q.Set("org", o.org)
+		q.Set("bucket", o.bucket)
+		o.writeURL = o.url + "/api/v2/write?" + q.Encode()
+	case o.database != "":
+		q.Set("db", o.database)
+		o.writeURL = o.url + "/write?" + q.Encode()
+	default:
+		return nil, fmt.Errorf("influxdb bucket or database is required")
+	}
+
+	timeout := 10 * time.Second
+	if v, ok := cfg.Options["timeout"].(string); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			timeout = d
+		}
+	}
+	sender, err := newHTTPSender(cfg, timeout)
+	if err != nil {
+		return nil, err
+	}
+	o.httpSender = sender
+
+	return o, nil
+}
+
+// Send writes the points for msg
+func (o *InfluxDB) Send(ctx context.Context, msg *message.Packet) error {
+	body := o.body(msg)
+	if body == "" {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.writeURL, strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	switch {
+	case o.token != "":
+		req.Header.Set("Authorization", "Token "+o.token)
+	case o.username != "":
+		req.SetBasicAuth(o.username, o.password)
+	}
+
+	return o.do(req, "influxdb")
+}
+
+// body returns the line protocol for msg, or "" if it has no points
+func (o *InfluxDB) body(msg *message.Packet) string {
+	var b bytes.Buffer
+	for _, p := range o.points(msg) {
+		p.write(&b)
+	}
+	return b.String()
+}
+
+// points returns the points describing msg: a signal point for any packet
+// heard with SNR or RSSI, and one for its telemetry, environment, or
+// position payload
+func (o *InfluxDB) points(msg *message.Packet) []influxPoint {
+	tags := influxTags(msg)
+	at := msg.ReceivedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	point := func(name string, fields []influxField) influxPoint {
+		return influxPoint{measurement: o.prefix + name, tags: tags, fields: fields, at: at}
+	}
+
+	var points []influxPoint
+	if msg.SNR != 0 || msg.RSSI != 0 {
+		points = append(points, point("signal", []influxField{
+			floatField("snr", msg.SNR),
+			intField("rssi", int64(msg.RSSI)),
+			intField("hop_limit", int64(msg.HopLimit)),
+		}))
+	}
+
+	var fields []influxField
+	var name string
+	switch p := msg.Payload.(type) {
+	case *message.Telemetry:
+		name = "device"
+		fields = []influxField{
+			intField("battery_level", int64(p.BatteryLevel)),
+			floatField("voltage", p.Voltage),
+			floatField("channel_utilization", p.ChannelUtilization),
+			floatField("air_util_tx", p.AirUtilTx),
+			intField("uptime", int64(p.Uptime)),
+		}
+	case *message.Environment:
+		// Zero readings are sensors the node does not have
+		name = "environment"
+		for _, f := range []struct {
+			key   string
+			value float32
+		}{
+			{"temperature", p.Temperature},
+			{"relative_humidity", p.RelativeHumidity},
+			{"barometric_pressure", p.BarometricPressure},
+			{"gas_resistance", p.GasResistance},
+			{"lux", p.Lux},
+		} {
+			if f.value != 0 {
+				fields = append(fields, floatField(f.key, f.value))
+			}
+		}
+		if p.IAQ != 0 {
+			fields = append(fields, intField("iaq", int64(p.IAQ)))
+		}
+	case *message.Position:
+		if p.Latitude == 0 && p.Longitude == 0 {
+			break
+		}
+		name = "position"
+		fields = []influxField{
+			{key: "latitude", value: strconv.FormatFloat(p.Latitude, 'f', -1, 64)},
+			{key: "longitude", value: strconv.FormatFloat(p.Longitude, 'f', -1, 64)},
+			intField("altitude", int64(p.Altitude)),
+		}
+		if p.Distance != 0 {
+			fields = append(fields,
+				influxField{key: "distance_m", value: strconv.FormatFloat(p.Distance, 'f', -1, 64)},
+				influxField{key: "bearing", value: strconv.FormatFloat(p.Bearing, 'f', -1, 64)})
+		}
+	}
+	if len(fields) > 0 {
+		points = append(points, point(name, fields))
+	}
+	return points
+}
+
+// influxTags identifies the sending node and where the packet was heard
+func influxTags(msg *message.Packet) map[string]string {
+	tags := map[string]string{"node": hexID(msg.From)}
+	if n := msg.FromNode; n != nil && n.User != nil {
+		if n.User.LongName != "" {
+			tags["name"] = n.User.LongName
+		}
+		if n.User.ShortName != "" {
+			tags["short_name"] = n.User.ShortName
+		}
+	}
+	if msg.ChannelName != "" {
+		tags["channel"] = msg.ChannelName
+	} else {
+		tags["channel"] = strconv.FormatUint(uint64(msg.Channel), 10)
+	}
+	if msg.GatewayID != "" {
+		tags["gateway"] = msg.GatewayID
+	}
+	return tags
+}
+
+func floatField(key string, v float32) influxField {
+	return influxField{key: key, value: strconv.FormatFloat(float64(v), 'f', -1, 32)}
+}
+
+func intField(key string, v int64) influxField {
+	return influxField{key: key, value: strconv.FormatInt(v, 10) + "i"}
+}
+
+// write appends the point as a line: measurement, sorted tags, fields,
+// and a nanosecond timestamp
+func (p influxPoint) write(b *bytes.Buffer) {
+	b.WriteString(influxMeasurementEscaper.Replace(p.measurement))
+
+	keys := make([]string, 0, len(p.tags))
+	for k, v := range p.tags {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteByte(',')
+		b.WriteString(influxTagEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(influxTagEscaper.Replace(p.tags[k]))
+	}
+
+	for i, f := range p.fields {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(influxTagEscaper.Replace(f.key))
+		b.WriteByte('=')
+		b.WriteString(f.value)
+	}
+	fmt.Fprintf(b, " %d\n", p.at.UnixNano())
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+)
+
+// Preview renders the request that would be sent
+func (o *InfluxDB) Preview(msg *message.Packet) (*Preview, error) {
+	p := &Preview{Target: MaskURL(o.writeURL), Method: "POST"}
+	body := o.body(msg)
+	if body == "" {
+		p.Skipped = "no telemetry, position, or signal data"
+		return p, nil
+	}
+	if o.token != "" || o.username != "" {
+		p.Headers = map[string]string{"Authorization": maskedValue}
+	}
+	p.Body = body
+	return p, nil
+}
+
+// Close releases pooled connections
+func (o *InfluxDB) Close() error {
+	o.closeIdle()
+	return nil
+}
+
+// Name returns the output identifier
+func (o *InfluxDB) Name() string {
+	target := o.bucket
+	if target == "" {
+		target = o.database
+	}
+	return fmt.Sprintf("influxdb:%s/%s", MaskURL(o.url), target)
+}
+
+// Enabled returns whether this output is enabled
+func (o *InfluxDB) Enabled() bool {
+	return o.enabled
+}
@@ -0,0 +1,96 @@
+package output
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestInfluxDBSend(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/write" || r.URL.Query().Get("bucket") != "mesh" || r.URL.Query().Get("org") != "home" {
+			t.Errorf("request = %s", r.URL)
+		}
+		if got := r.Header.Get("Authorization"); got != "Token secret" {
+			t.Errorf("Authorization = %q", got)
+		}
+		data, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	out, err := NewInfluxDB(config.OutputConfig{Type: "influxdb", Options: map[string]interface{}{
+		"url":    srv.URL,
+		"org":    "home",
+		"bucket": "mesh",
+		"token":  "secret",
+	}})
+	if err != nil {
+		t.Fatalf("NewInfluxDB: %v", err)
+	}
+
+	at := time.Unix(1700000000, 0)
+	node := &message.NodeInfo{User: &message.User{LongName: "North Ridge", ShortName: "NR"}}
+	packets := []*message.Packet{
+		{From: 0x1234abcd, FromNode: node, SNR: 6.25, RSSI: -92, HopLimit: 3, ReceivedAt: at,
+			Payload: &message.Telemetry{BatteryLevel: 87, Voltage: 4.01, ChannelUtilization: 12.5, AirUtilTx: 1.75, Uptime: 86400}},
+		{From: 0x1234abcd, ChannelName: "LongFast", ReceivedAt: at,
+			Payload: &message.Environment{Temperature: 21.5, RelativeHumidity: 40}},
+		{From: 0x1234abcd, ReceivedAt: at, Payload: &message.TextMessage{Text: "no points"}},
+	}
+	for _, p := range packets {
+		if err := out.Send(context.Background(), p); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	want := []string{
+		"meshtastic_signal,channel=0,name=North\\ Ridge,node=!1234abcd,short_name=NR snr=6.25,rssi=-92i,hop_limit=3i 1700000000000000000\n" +
+			"meshtastic_device,channel=0,name=North\\ Ridge,node=!1234abcd,short_name=NR battery_level=87i,voltage=4.01,channel_utilization=12.5,air_util_tx=1.75,uptime=86400i 1700000000000000000\n",
+		"meshtastic_environment,channel=LongFast,node=!1234abcd temperature=21.5,relative_humidity=40 1700000000000000000\n",
+	}
+	if len(bodies) != len(want) {
+		t.Fatalf("got %d writes, want %d", len(bodies), len(want))
+	}
+	for i := range want {
+		if bodies[i] != want[i] {
+			t.Errorf("write %d:\n got %q\nwant %q", i, bodies[i], want[i])
+		}
+	}
+	if strings.Contains(out.Name(), "secret") {
+		t.Errorf("Name leaks token: %s", out.Name())
+	}
+}
+
+func TestInfluxDBOptions(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"bucket": "mesh", "org": "home"},
+		{"url": "http://localhost:8086"},
+		{"url": "http://localhost:8086", "bucket": "mesh"},
+		{"url": "http://localhost:8086", "bucket": "mesh", "org": "home", "database": "mesh"},
+	}
+	for _, opts := range tests {
+		if _, err := NewInfluxDB(config.OutputConfig{Options: opts}); err == nil {
+			t.Errorf("options %v accepted", opts)
+		}
+	}
+
+	out, err := NewInfluxDB(config.OutputConfig{Options: map[string]interface{}{
+		"url": "http://localhost:8086", "database": "mesh",
+	}})
+	if err != nil {
+		t.Fatalf("NewInfluxDB: %v", err)
+	}
+	if out.writeURL != "http://localhost:8086/write?db=mesh" {
+		t.Errorf("writeURL = %s", out.writeURL)
+	}
+}
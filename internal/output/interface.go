@@ -7,7 +7,9 @@ import (
 )
 
 // Output defines the interface for message output destinations.
-// Implementations include stdout, file, apprise, and webhook outputs.
+// Implementations include stdout, file, apprise, webhook, mqtt,
+// homeassistant, sse, telegram, slack, influxdb, tak, kafka, nats, and sms
+// outputs.
 type Output interface {
 	// Send forwards a message to the output destination.
 	// Returns an error if the message cannot be delivered.
@@ -23,6 +25,59 @@ type Output interface {
 	Enabled() bool
 }
 
+// Concurrent is implemented by outputs that can deliver several messages
+// at once. The relay dispatches to them asynchronously, so delivery order
+// is not preserved when MaxInFlight is greater than one.
+type Concurrent interface {
+	// MaxInFlight returns how many Send calls may run concurrently.
+	MaxInFlight() int
+}
+
+// Publisher is implemented by outputs that stream relay events, such as a
+// configuration reload, to their clients alongside packets.
+type Publisher interface {
+	// Publish sends a named event with a JSON-encoded payload.
+	Publish(event string, data interface{}) error
+}
+
+// Editor is implemented by outputs that can edit messages they already
+// sent, such as chat services. The relay uses it to keep a reaction
+// summary on the original message instead of sending each reaction.
+type Editor interface {
+	// Edit sets a footer below the message sent for the packet with the
+	// given ID, replacing any footer set before. It returns false if the
+	// output did not send that packet or no longer remembers it.
+	Edit(ctx context.Context, id uint32, footer string) (bool, error)
+}
+
+// CanEdit reports whether out, or the output it wraps, is an Editor
+func CanEdit(out Output) bool {
+	if t, ok := out.(*Transformed); ok {
+		out = t.Output
+	}
+	_, ok := out.(Editor)
+	return ok
+}
+
+// Replier is implemented by outputs whose readers can answer the messages
+// they were sent, such as chat bots. The relay sends each answer to the
+// mesh as a text message to the node that sent the original.
+type Replier interface {
+	// Replies calls handle with each answer until ctx is done or
+	// listening fails, returning the error. It returns nil at once if the
+	// output is not set up to listen for replies.
+	Replies(ctx context.Context, handle func(Reply)) error
+}
+
+// Reply is an answer to a message an output sent for a packet
+type Reply struct {
+	To      uint32 // node that sent the original packet
+	Channel uint32 // channel the original packet arrived on
+	ReplyID uint32 // ID of the original packet
+	Author  string // name of the person who answered
+	Text    string
+}
+
 // Factory creates Output instances based on configuration.
 type Factory interface {
 	// Create creates a new Output instance based on the provided configuration.
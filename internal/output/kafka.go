@@ -0,0 +1,160 @@
+package output
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// DefaultKafkaTopic is the topic used when none is configured
+const DefaultKafkaTopic = "meshtastic-relay"
+
+// Kafka produces every message as a record to a Kafka topic, keyed by the
+// sending node by default so each node's packets stay in order on one
+// partition. The topic may use the mqtt event_topic placeholders to split
+// traffic by channel, port, or node.
+type Kafka struct {
+	brokers []string
+	codec   *streamCodec
+	enabled bool
+
+	writer *kafka.Writer
+}
+
+// NewKafka creates a new Kafka output. Brokers are connected to on the
+// first send.
+func NewKafka(cfg config.OutputConfig) (*Kafka, error) {
+	k := &Kafka{enabled: cfg.Enabled}
+
+	k.brokers = stringsOption(cfg.Options, "brokers")
+	if len(k.brokers) == 0 {
+		return nil, fmt.Errorf("kafka brokers are required")
+	}
+	topic := DefaultKafkaTopic
+	if t, ok := cfg.Options["topic"].(string); ok && t != "" {
+		if invalid := strings.IndexFunc(topicPlaceholder.ReplaceAllString(t, ""), invalidKafkaRune); invalid >= 0 {
+			return nil, fmt.Errorf("kafka topic %q may only contain letters, digits, '.', '_', and '-'", t)
+		}
+		topic = t
+	}
+	codec, err := newStreamCodec("kafka", cfg, topic, kafkaTopicName)
+	if err != nil {
+		return nil, err
+	}
+	k.codec = codec
+
+	acks := kafka.RequireOne
+	if a, ok := cfg.Options["acks"].(string); ok {
+		switch a {
+		case "", "one":
+		case "all":
+			acks = kafka.RequireAll
+		case "none":
+			acks = kafka.RequireNone
+		default:
+			return nil, fmt.Errorf("kafka acks must be none, one, or all")
+		}
+	}
+	timeout := 10 * time.Second
+	if v, ok := cfg.Options["timeout"].(string); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kafka timeout: %w", err)
+		}
+		timeout = d
+	}
+
+	transport := &kafka.Transport{DialTimeout: timeout}
+	if username, _ := cfg.Options["username"].(string); username != "" {
+		password, _ := cfg.Options["password"].(string)
+		transport.SASL = plain.Mechanism{Username: username, Password: password}
+	}
+	if raw, ok := cfg.Options["tls"].(map[string]interface{}); ok {
+		tlsOpts := tlsOptions(raw)
+		tlsCfg, err := tlsOpts.Load()
+		if err != nil {
+			return nil, fmt.Errorf("invalid kafka tls config: %w", err)
+		}
+		transport.TLS = tlsCfg
+	}
+
+	k.writer = &kafka.Writer{
+		Addr:         kafka.TCP(k.brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: acks,
+		// Send each record as it arrives rather than waiting for a batch
+		BatchSize:    1,
+		WriteTimeout: timeout,
+		ReadTimeout:  timeout,
+		Transport:    transport,
+	}
+	return k, nil
+}
+
+// invalidKafkaRune reports whether r is not allowed in a topic name
+func invalidKafkaRune(r rune) bool {
+	return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-')
+}
+
+// kafkaTopicName replaces characters not allowed in topic names
+func kafkaTopicName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if invalidKafkaRune(r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// Send produces the message record
+func (k *Kafka) Send(ctx context.Context, msg *message.Packet) error {
+	rec, err := k.codec.record(render(ctx, msg))
+	if err != nil {
+		return err
+	}
+
+	km := kafka.Message{
+		Topic: rec.topic,
+		Value: rec.payload,
+		Headers: []kafka.Header{
+			{Key: "portnum", Value: []byte(msg.PortNum.String())},
+		},
+	}
+	if rec.key != "" {
+		km.Key = []byte(rec.key)
+	}
+	if !msg.ReceivedAt.IsZero() {
+		km.Time = msg.ReceivedAt
+	}
+	if err := k.writer.WriteMessages(ctx, km); err != nil {
+		return fmt.Errorf("kafka produce to %s failed: %w", rec.topic, err)
+	}
+	return nil
+}
+
+// Preview renders the topic, key, and value that would be produced
+func (k *Kafka) Preview(msg *message.Packet) (*Preview, error) {
+	return k.codec.preview(k.Name(), msg)
+}
+
+// Close flushes and closes broker connections
+func (k *Kafka) Close() error {
+	return k.writer.Close()
+}
+
+// Name returns the output identifier
+func (k *Kafka) Name() string {
+	return fmt.Sprintf("kafka:%s/%s", strings.Join(k.brokers, ","), k.codec.topic)
+}
+
+// Enabled returns whether this output is enabled
+func (k *Kafka) Enabled() bool {
+	return k.enabled
+}
@@ -0,0 +1,421 @@
+package output
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/proxy"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+// DefaultMQTTTopic is the topic prefix used when none is configured
+const DefaultMQTTTopic = "meshtastic-relay"
+
+// MQTT publishes messages to an MQTT broker. Every message goes to
+// <topic>/events, or to the topic its event_topic template expands to, as
+// JSON or as a Meshtastic ServiceEnvelope protobuf. With node_state
+// enabled, the latest position, battery, user, and last-seen time of each
+// node are also kept as retained messages under <topic>/nodes/<id>/, so
+// dashboards can read current state without replaying history.
+type MQTT struct {
+	*mqttBroker
+	topic      string
+	eventTopic string
+	protobuf   bool
+	nodeState  bool
+	enabled    bool
+}
+
+// mqttBroker is a lazily connected broker client shared by the outputs
+// that publish to MQTT
+type mqttBroker struct {
+	broker   string
+	username string
+	password string
+	clientID string
+	qos      byte
+	timeout  time.Duration
+	tls      *tls.Config
+	// proxy opens the broker connection when a proxy option is set
+	proxy mqtt.OpenConnectionFunc
+
+	mu     sync.Mutex
+	client mqtt.Client
+}
+
+// mqttPublication is a single message to publish
+type mqttPublication struct {
+	topic    string
+	retained bool
+	payload  []byte
+}
+
+// NewMQTT creates a new MQTT output. The broker connection is made on
+// first send.
+func NewMQTT(cfg config.OutputConfig) (*MQTT, error) {
+	broker, err := newMQTTBroker("mqtt", cfg.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MQTT{
+		mqttBroker: broker,
+		topic:      DefaultMQTTTopic,
+		enabled:    cfg.Enabled,
+	}
+
+	if t, ok := cfg.Options["topic"].(string); ok && t != "" {
+		m.topic = strings.TrimSuffix(t, "/")
+	}
+	m.eventTopic = m.topic + "/events"
+	if t, ok := cfg.Options["event_topic"].(string); ok && t != "" {
+		if err := checkTopicTemplate(t); err != nil {
+			return nil, err
+		}
+		m.eventTopic = strings.ReplaceAll(t, "{topic}", m.topic)
+	}
+	if f, ok := cfg.Options["format"].(string); ok {
+		switch f {
+		case "", "json":
+		case "protobuf":
+			m.protobuf = true
+		default:
+			return nil, fmt.Errorf("mqtt format must be json or protobuf")
+		}
+	}
+	if b, ok := cfg.Options["node_state"].(bool); ok {
+		m.nodeState = b
+	}
+
+	return m, nil
+}
+
+// newMQTTBroker reads the broker, credential, qos, timeout, and tls
+// options. kind prefixes error messages.
+func newMQTTBroker(kind string, opts map[string]interface{}) (*mqttBroker, error) {
+	broker, _ := opts["broker"].(string)
+	if broker == "" {
+		return nil, fmt.Errorf("%s broker is required", kind)
+	}
+
+	b := &mqttBroker{
+		broker:  broker,
+		qos:     1,
+		timeout: 10 * time.Second,
+	}
+
+	b.username, _ = opts["username"].(string)
+	b.password, _ = opts["password"].(string)
+	b.clientID, _ = opts["client_id"].(string)
+	if q, ok := IntOption(opts, "qos"); ok {
+		if q < 0 || q > 2 {
+			return nil, fmt.Errorf("%s qos must be 0, 1, or 2", kind)
+		}
+		b.qos = byte(q)
+	}
+	if t, ok := opts["timeout"].(string); ok {
+		d, err := time.ParseDuration(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s timeout: %w", kind, err)
+		}
+		b.timeout = d
+	}
+	if raw, ok := opts["tls"].(map[string]interface{}); ok {
+		if !config.IsTLSBroker(broker) {
+			return nil, fmt.Errorf("%s tls requires an ssl://, tls://, mqtts:// or wss:// broker", kind)
+		}
+		tlsOpts := tlsOptions(raw)
+		tlsCfg, err := tlsOpts.Load()
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s tls config: %w", kind, err)
+		}
+		b.tls = tlsCfg
+	}
+	if v, ok := opts["proxy"].(string); ok && v != "" {
+		u, err := config.ParseProxy(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s proxy: %w", kind, err)
+		}
+		b.proxy = proxy.MQTT(u)
+	}
+
+	return b, nil
+}
+
+// tlsOptions reads an output's tls block
+func tlsOptions(raw map[string]interface{}) config.TLSConfig {
+	var c config.TLSConfig
+	c.CACert, _ = raw["ca_cert"].(string)
+	c.ClientCert, _ = raw["client_cert"].(string)
+	c.ClientKey, _ = raw["client_key"].(string)
+	c.InsecureSkipVerify, _ = raw["insecure_skip_verify"].(bool)
+	c.ServerName, _ = raw["server_name"].(string)
+	return c
+}
+
+// Send publishes the message event and any node state it updates
+func (m *MQTT) Send(ctx context.Context, msg *message.Packet) error {
+	pubs, err := m.publications(render(ctx, msg))
+	if err != nil {
+		return err
+	}
+	return m.publish(ctx, pubs)
+}
+
+// Preview renders the topics and payloads that would be published
+func (m *MQTT) Preview(msg *message.Packet) (*Preview, error) {
+	pubs, err := m.publications(NewRender(msg))
+	if err != nil {
+		return nil, err
+	}
+
+	var body strings.Builder
+	for i, pub := range pubs {
+		if i > 0 {
+			body.WriteString("\n")
+		}
+		body.WriteString(pub.topic)
+		if pub.retained {
+			body.WriteString(" (retained)")
+		}
+		body.WriteString(": ")
+		body.Write(pub.payload)
+	}
+
+	return &Preview{Target: m.Name(), Body: body.String()}, nil
+}
+
+func (m *MQTT) publications(r *Render) ([]mqttPublication, error) {
+	msg := r.msg
+	var event []byte
+	if m.protobuf {
+		event = envelope(msg).Marshal()
+	} else {
+		var err error
+		if event, err = r.JSON(); err != nil {
+			return nil, err
+		}
+	}
+	pubs := []mqttPublication{{topic: expandTopic(m.eventTopic, msg), payload: event}}
+
+	if !m.nodeState || msg.From == 0 {
+		return pubs, nil
+	}
+
+	node := fmt.Sprintf("%s/nodes/!%08x/", m.topic, msg.From)
+	state := func(name string, v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s state: %w", name, err)
+		}
+		pubs = append(pubs, mqttPublication{topic: node + name, retained: true, payload: data})
+		return nil
+	}
+
+	var err error
+	switch p := msg.Payload.(type) {
+	case *message.Position:
+		err = state("position", p)
+	case *message.Telemetry:
+		err = state("battery", struct {
+			Level   uint32  `json:"level"`
+			Voltage float32 `json:"voltage"`
+		}{p.BatteryLevel, p.Voltage})
+	case *message.User:
+		err = state("user", p)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seen := msg.ReceivedAt
+	if seen.IsZero() {
+		seen = time.Now()
+	}
+	if err := state("lastseen", seen.UTC().Format(time.RFC3339)); err != nil {
+		return nil, err
+	}
+
+	return pubs, nil
+}
+
+// topicPlaceholder matches a {name} placeholder in an event_topic template
+var topicPlaceholder = regexp.MustCompile(`\{[^}]*\}`)
+
+// topicFields expands event_topic placeholders for a packet
+var topicFields = map[string]func(msg *message.Packet) string{
+	"channel": func(msg *message.Packet) string {
+		if msg.ChannelName != "" {
+			return msg.ChannelName
+		}
+		return strconv.FormatUint(uint64(msg.Channel), 10)
+	},
+	"channel_index": func(msg *message.Packet) string { return strconv.FormatUint(uint64(msg.Channel), 10) },
+	"portnum":       func(msg *message.Packet) string { return msg.PortNum.String() },
+	"from":          func(msg *message.Packet) string { return fmt.Sprintf("!%08x", msg.From) },
+	"to":            func(msg *message.Packet) string { return fmt.Sprintf("!%08x", msg.To) },
+	"gateway": func(msg *message.Packet) string {
+		if msg.GatewayID != "" {
+			return msg.GatewayID
+		}
+		return "local"
+	},
+}
+
+// checkTopicTemplate rejects event_topic templates with unknown
+// placeholders or MQTT wildcards
+func checkTopicTemplate(t string) error {
+	if strings.ContainsAny(topicPlaceholder.ReplaceAllString(t, ""), "+#") {
+		return fmt.Errorf("mqtt event_topic must not contain wildcards")
+	}
+	for _, p := range topicPlaceholder.FindAllString(t, -1) {
+		name := strings.Trim(p, "{}")
+		if _, ok := topicFields[name]; !ok && name != "topic" {
+			return fmt.Errorf("mqtt event_topic has unknown placeholder %s", p)
+		}
+	}
+	return nil
+}
+
+// expandTopic fills in the placeholders of a checked topic template.
+// Values are made safe to use as a single topic level.
+func expandTopic(t string, msg *message.Packet) string {
+	return expandTemplate(t, msg, topicLevel.Replace)
+}
+
+// expandTemplate fills in the placeholders of a checked topic template,
+// passing each value through clean
+func expandTemplate(t string, msg *message.Packet, clean func(string) string) string {
+	if !strings.Contains(t, "{") {
+		return t
+	}
+	return topicPlaceholder.ReplaceAllStringFunc(t, func(p string) string {
+		return clean(topicFields[strings.Trim(p, "{}")](msg))
+	})
+}
+
+// topicLevel replaces characters that would split or wildcard a topic level
+var topicLevel = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+// envelope wraps a packet the way Meshtastic gateways publish to MQTT
+func envelope(msg *message.Packet) *meshtastic.ServiceEnvelope {
+	payload := msg.RawPayload
+	if t, ok := msg.Payload.(*message.TextMessage); ok && payload == nil {
+		payload = []byte(t.Text)
+	}
+	mp := &meshtastic.MeshPacket{
+		From:     msg.From,
+		To:       msg.To,
+		Channel:  msg.Channel,
+		ID:       msg.ID,
+		RxSnr:    msg.SNR,
+		RxRssi:   msg.RSSI,
+		HopLimit: msg.HopLimit,
+		WantAck:  msg.WantAck,
+		Decoded:  &meshtastic.Data{PortNum: meshtastic.PortNum(msg.PortNum), Payload: payload},
+	}
+	if !msg.ReceivedAt.IsZero() {
+		mp.RxTime = uint32(msg.ReceivedAt.Unix())
+	}
+	return &meshtastic.ServiceEnvelope{Packet: mp, ChannelID: msg.ChannelName, GatewayID: msg.GatewayID}
+}
+
+// publish sends the publications in order, connecting first if needed
+func (m *mqttBroker) publish(ctx context.Context, pubs []mqttPublication) error {
+	client, err := m.connect()
+	if err != nil {
+		return err
+	}
+
+	for _, pub := range pubs {
+		token := client.Publish(pub.topic, m.qos, pub.retained, pub.payload)
+		select {
+		case <-token.Done():
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(m.timeout):
+			return fmt.Errorf("mqtt publish to %s timed out", pub.topic)
+		}
+		if err := token.Error(); err != nil {
+			return fmt.Errorf("mqtt publish to %s failed: %w", pub.topic, err)
+		}
+	}
+	return nil
+}
+
+// connect returns the broker client, connecting on first use
+func (m *mqttBroker) connect() (mqtt.Client, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.client != nil {
+		return m.client, nil
+	}
+
+	clientID := m.clientID
+	if clientID == "" {
+		clientID = fmt.Sprintf("meshtastic-relay-out-%d", time.Now().UnixNano())
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(m.broker).
+		SetClientID(clientID).
+		SetAutoReconnect(true)
+	if m.username != "" {
+		opts.SetUsername(m.username)
+	}
+	if m.password != "" {
+		opts.SetPassword(m.password)
+	}
+	if m.tls != nil {
+		opts.SetTLSConfig(m.tls)
+	}
+	if m.proxy != nil {
+		opts.SetCustomOpenConnectionFn(m.proxy)
+	}
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(m.timeout) {
+		return nil, fmt.Errorf("mqtt connection to %s timed out", MaskURL(m.broker))
+	}
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("failed to connect to mqtt broker: %w", err)
+	}
+
+	m.client = client
+	return client, nil
+}
+
+// Close disconnects from the broker
+func (m *mqttBroker) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.client != nil {
+		m.client.Disconnect(250)
+		m.client = nil
+	}
+	return nil
+}
+
+// Name returns the output identifier
+func (m *MQTT) Name() string {
+	return fmt.Sprintf("mqtt:%s/%s", MaskURL(m.broker), m.topic)
+}
+
+// Enabled returns whether this output is enabled
+func (m *MQTT) Enabled() bool {
+	return m.enabled
+}
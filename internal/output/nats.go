@@ -0,0 +1,179 @@
+package output
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// DefaultNATSSubject is the subject used when none is configured
+const DefaultNATSSubject = "meshtastic-relay"
+
+// NATS publishes every message to a NATS subject, which may use the mqtt
+// event_topic placeholders so subscribers can filter with wildcards such
+// as meshtastic.*.TEXT_MESSAGE_APP. NATS messages have no key, so the key
+// is sent in the Key header along with the port in the Portnum header.
+type NATS struct {
+	url         string
+	username    string
+	password    string
+	token       string
+	credentials string
+	codec       *streamCodec
+	timeout     time.Duration
+	tls         *tls.Config
+	enabled     bool
+
+	mu   sync.Mutex
+	conn *nats.Conn
+}
+
+// NewNATS creates a new NATS output. The server connection is made on the
+// first send.
+func NewNATS(cfg config.OutputConfig) (*NATS, error) {
+	n := &NATS{timeout: 10 * time.Second, enabled: cfg.Enabled}
+
+	n.url, _ = cfg.Options["url"].(string)
+	if n.url == "" {
+		return nil, fmt.Errorf("nats url is required")
+	}
+	n.username, _ = cfg.Options["username"].(string)
+	n.password, _ = cfg.Options["password"].(string)
+	n.token, _ = cfg.Options["token"].(string)
+	n.credentials, _ = cfg.Options["credentials"].(string)
+
+	subject := DefaultNATSSubject
+	if s, ok := cfg.Options["subject"].(string); ok && s != "" {
+		literal := topicPlaceholder.ReplaceAllString(s, "")
+		if strings.ContainsAny(literal, "*> \t\r\n") {
+			return nil, fmt.Errorf("nats subject must not contain wildcards or whitespace")
+		}
+		subject = s
+	}
+	codec, err := newStreamCodec("nats", cfg, subject, subjectToken.Replace)
+	if err != nil {
+		return nil, err
+	}
+	n.codec = codec
+
+	if v, ok := cfg.Options["timeout"].(string); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid nats timeout: %w", err)
+		}
+		n.timeout = d
+	}
+	if raw, ok := cfg.Options["tls"].(map[string]interface{}); ok {
+		tlsOpts := tlsOptions(raw)
+		tlsCfg, err := tlsOpts.Load()
+		if err != nil {
+			return nil, fmt.Errorf("invalid nats tls config: %w", err)
+		}
+		n.tls = tlsCfg
+	}
+
+	return n, nil
+}
+
+// subjectToken replaces characters that would split or wildcard a subject
+// token
+var subjectToken = strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_", "\t", "_", "\r", "_", "\n", "_")
+
+// Send publishes the message and waits for the server to acknowledge it
+func (n *NATS) Send(ctx context.Context, msg *message.Packet) error {
+	rec, err := n.codec.record(render(ctx, msg))
+	if err != nil {
+		return err
+	}
+
+	conn, err := n.connect()
+	if err != nil {
+		return err
+	}
+
+	nm := nats.NewMsg(rec.topic)
+	nm.Data = rec.payload
+	nm.Header.Set("Portnum", msg.PortNum.String())
+	if rec.key != "" {
+		nm.Header.Set("Key", rec.key)
+	}
+	if err := conn.PublishMsg(nm); err != nil {
+		return fmt.Errorf("nats publish to %s failed: %w", rec.topic, err)
+	}
+
+	// Flushing surfaces a lost connection now rather than on a later send
+	flushCtx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+	if err := conn.FlushWithContext(flushCtx); err != nil {
+		return fmt.Errorf("nats publish to %s failed: %w", rec.topic, err)
+	}
+	return nil
+}
+
+// connect returns the server connection, connecting on first use. The
+// client reconnects by itself after that.
+func (n *NATS) connect() (*nats.Conn, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.conn != nil {
+		return n.conn, nil
+	}
+
+	opts := []nats.Option{nats.Name("meshtastic-relay"), nats.Timeout(n.timeout)}
+	if n.username != "" {
+		opts = append(opts, nats.UserInfo(n.username, n.password))
+	}
+	if n.token != "" {
+		opts = append(opts, nats.Token(n.token))
+	}
+	if n.credentials != "" {
+		opts = append(opts, nats.UserCredentials(n.credentials))
+	}
+	if n.tls != nil {
+		opts = append(opts, nats.Secure(n.tls))
+	}
+
+	conn, err := nats.Connect(n.url, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to nats server: %s", strings.ReplaceAll(err.Error(), n.url, MaskURL(n.url)))
+	}
+	n.conn = conn
+	return conn, nil
+}
+
+// Preview renders the subject, key, and payload that would be published
+func (n *NATS) Preview(msg *message.Packet) (*Preview, error) {
+	return n.codec.preview(n.Name(), msg)
+}
+
+// Close closes the connection
+func (n *NATS) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.conn == nil {
+		return nil
+	}
+	n.conn.Close()
+	n.conn = nil
+	return nil
+}
+
+// Name returns the output identifier
+func (n *NATS) Name() string {
+	return fmt.Sprintf("nats:%s/%s", MaskURL(n.url), n.codec.topic)
+}
+
+// Enabled returns whether this output is enabled
+func (n *NATS) Enabled() bool {
+	return n.enabled
+}
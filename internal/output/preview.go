@@ -0,0 +1,134 @@
+package output
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// maskedValue replaces secrets in previews
+const maskedValue = "****"
+
+// Preview describes what an output would deliver for a message
+type Preview struct {
+	// Target is where the message would go, with secrets masked
+	Target string
+	// Method is the HTTP method, if any
+	Method string
+	// Headers are the request headers, with secrets masked
+	Headers map[string]string
+	// Body is the rendered payload
+	Body string
+	// Skipped explains why the output would not deliver the message
+	Skipped string
+}
+
+// Previewer is implemented by outputs that can render a message without
+// delivering it.
+type Previewer interface {
+	// Preview renders what Send would deliver for msg.
+	Preview(msg *message.Packet) (*Preview, error)
+}
+
+// NewPreviewer creates an output for previewing only. Unlike New it has no
+// side effects such as creating files.
+func NewPreviewer(cfg config.OutputConfig) (Previewer, error) {
+	var out Output
+	var err error
+	switch cfg.Type {
+	case "file":
+		var f *File
+		if f, err = newFile(cfg); err == nil {
+			out, err = withTransforms(cfg, f)
+		}
+	case "sse":
+		out, err = withTransforms(cfg, newSSE(cfg))
+	default:
+		out, err = New(cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p, ok := out.(Previewer)
+	if !ok {
+		_ = out.Close()
+		return nil, errNoPreview(out)
+	}
+	if t, ok := out.(*Transformed); ok {
+		if _, ok := t.Output.(Previewer); !ok {
+			_ = out.Close()
+			return nil, errNoPreview(t.Output)
+		}
+	}
+	return p, nil
+}
+
+func errNoPreview(out Output) error {
+	return fmt.Errorf("output %s does not support previews", out.Name())
+}
+
+// sensitiveKeys are query parameter, header, and option name fragments
+// whose values are masked in previews and support bundles
+var sensitiveKeys = []string{"auth", "key", "token", "secret", "pass", "signature", "sig", "cookie", "salt", "private"}
+
+// IsSensitive reports whether a query parameter, header, or option with
+// this name holds a secret
+func IsSensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, k := range sensitiveKeys {
+		if strings.Contains(name, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostSchemes are URL schemes whose host names a server. Other schemes,
+// such as Apprise's tgram://BOTTOKEN/CHAT, may keep a secret there.
+var hostSchemes = map[string]bool{
+	"http": true, "https": true, "ws": true, "wss": true,
+	"tcp": true, "ssl": true, "tls": true, "mqtt": true, "mqtts": true,
+	"nats": true, "socks5": true, "socks5h": true,
+}
+
+// RedactURL keeps the scheme of a URL, and the host for hostSchemes, and
+// replaces the rest with placeholder, since services keep tokens anywhere
+// from the credentials to the path and query: Slack and Discord webhooks,
+// Apprise keys. A URL with nothing after the host is returned unchanged;
+// one that does not parse keeps only its scheme.
+func RedactURL(raw, placeholder string) string {
+	scheme, _, found := strings.Cut(raw, "://")
+	if !found {
+		return placeholder
+	}
+	u, err := url.Parse(raw)
+	if err != nil || !hostSchemes[strings.ToLower(u.Scheme)] {
+		return scheme + "://" + placeholder
+	}
+	if u.User == nil && strings.Trim(u.Path, "/") == "" && u.RawQuery == "" && u.Fragment == "" {
+		return raw
+	}
+	return u.Scheme + "://" + u.Host + "/" + placeholder
+}
+
+// MaskURL hides everything in a URL but its scheme and server, for
+// previews, output names, and logs
+func MaskURL(raw string) string {
+	return RedactURL(raw, maskedValue)
+}
+
+// maskHeaders returns a copy of headers with secret values masked
+func maskHeaders(headers map[string]string) map[string]string {
+	masked := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if IsSensitive(k) {
+			v = maskedValue
+		}
+		masked[k] = v
+	}
+	return masked
+}
@@ -0,0 +1,24 @@
+package output
+
+import "testing"
+
+func TestMaskURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"https://hooks.example.com/in?token=abc&x=1", "https://hooks.example.com/****"},
+		{"https://user:pw@example.com/", "https://example.com/****"},
+		{"https://hooks.slack.com/services/T0/B0/SECRETXYZ", "https://hooks.slack.com/****"},
+		{"https://discord.com/api/webhooks/123/TOKEN", "https://discord.com/****"},
+		{"http://apprise:8000/notify/mykey", "http://apprise:8000/****"},
+		{"tgram://BOTTOKEN/chat", "tgram://****"},
+		{"tcp://broker.local:1883", "tcp://broker.local:1883"},
+		{"https://ntfy.sh/", "https://ntfy.sh/"},
+		{"not a url", "****"},
+	}
+	for _, tt := range tests {
+		if got := MaskURL(tt.in); got != tt.want {
+			t.Errorf("MaskURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
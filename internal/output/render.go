@@ -0,0 +1,79 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// Render serializes a packet on demand and caches the result, so outputs
+// sharing a format serialize each packet once. It is safe for concurrent
+// use. The returned slices are shared and must not be modified.
+type Render struct {
+	msg *message.Packet
+
+	jsonOnce sync.Once
+	jsonLine []byte // JSON followed by a newline
+	jsonErr  error
+
+	textOnce sync.Once
+	text     string
+}
+
+// NewRender returns an empty render cache for msg
+func NewRender(msg *message.Packet) *Render {
+	return &Render{msg: msg}
+}
+
+// JSON returns the packet encoded as JSON
+func (r *Render) JSON() ([]byte, error) {
+	line, err := r.JSONLine()
+	if err != nil {
+		return nil, err
+	}
+	n := len(line) - 1
+	return line[:n:n], nil
+}
+
+// JSONLine returns the packet encoded as JSON with a trailing newline
+func (r *Render) JSONLine() ([]byte, error) {
+	r.jsonOnce.Do(func() {
+		data, err := json.Marshal(r.msg)
+		if err != nil {
+			r.jsonErr = fmt.Errorf("failed to marshal message: %w", err)
+			return
+		}
+		r.jsonLine = append(data, '\n')
+	})
+	// Capping capacity makes appends by callers copy instead of writing
+	// into the shared array
+	return r.jsonLine[:len(r.jsonLine):len(r.jsonLine)], r.jsonErr
+}
+
+// Text returns the packet as a single human-readable line
+func (r *Render) Text() string {
+	r.textOnce.Do(func() {
+		r.text = formatTextLine(r.msg)
+	})
+	return r.text
+}
+
+type renderKey struct{}
+
+// WithRender attaches a render cache to ctx for the outputs a packet is
+// sent to
+func WithRender(ctx context.Context, r *Render) context.Context {
+	return context.WithValue(ctx, renderKey{}, r)
+}
+
+// render returns the cache from ctx if it was made for msg. Transforms
+// hand outputs a different packet, which gets a render of its own.
+func render(ctx context.Context, msg *message.Packet) *Render {
+	if r, ok := ctx.Value(renderKey{}).(*Render); ok && r.msg == msg {
+		return r
+	}
+	return NewRender(msg)
+}
@@ -0,0 +1,45 @@
+package output
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestRenderShared(t *testing.T) {
+	msg := &message.Packet{From: 1, PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: "hi"}}
+	ctx := WithRender(context.Background(), NewRender(msg))
+
+	if render(ctx, msg) != render(ctx, msg) {
+		t.Error("render not shared for the same packet")
+	}
+	other := *msg
+	if render(ctx, &other) == render(ctx, msg) {
+		t.Error("render shared with a different packet")
+	}
+
+	r := render(ctx, msg)
+	line, err := r.JSONLine()
+	if err != nil {
+		t.Fatalf("JSONLine: %v", err)
+	}
+	data, _ := r.JSON()
+	if string(line) != string(data)+"\n" {
+		t.Errorf("JSONLine = %q, JSON = %q", line, data)
+	}
+
+	// Appending must not write into the cached line
+	_ = append(data, 'x')
+	if again, _ := r.JSONLine(); again[len(again)-1] != '\n' {
+		t.Error("cached JSON modified by append")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = r.JSON()
+		_ = r.Text()
+	})
+	if allocs != 0 {
+		t.Errorf("cached render allocated %.0f times", allocs)
+	}
+}
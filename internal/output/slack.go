@@ -0,0 +1,387 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// DefaultSlackAPI is the Web API endpoint used unless api_url is set
+const DefaultSlackAPI = "https://slack.com/api"
+
+// DefaultSlackThreadWindow is how long messages from a node keep going to
+// the same thread
+const DefaultSlackThreadWindow = 24 * time.Hour
+
+// slackMaxText is the most characters Slack accepts in a section block
+const slackMaxText = 3000
+
+// Slack posts messages to Slack as Block Kit messages, through an
+// incoming webhook or a bot token. With a bot token, messages from the
+// same node are grouped in a thread until the thread window passes
+// without a message from it. Only text messages are sent unless
+// all_ports is set.
+type Slack struct {
+	webhookURL   string
+	apiURL       string
+	token        string
+	channel      string
+	threads      bool
+	threadWindow time.Duration
+	allPorts     bool
+	tmpl         *template.Template
+	enabled      bool
+
+	sender httpSender
+
+	// mu guards nodeThreads, the open thread of each sender node
+	mu          sync.Mutex
+	nodeThreads map[uint32]*slackThread
+}
+
+// slackThread is the thread a node's messages are posted to
+type slackThread struct {
+	ts   string
+	last time.Time
+}
+
+// slackMessage is the webhook and chat.postMessage request body
+type slackMessage struct {
+	Channel  string       `json:"channel,omitempty"`
+	Text     string       `json:"text"`
+	Blocks   []slackBlock `json:"blocks"`
+	ThreadTS string       `json:"thread_ts,omitempty"`
+}
+
+// slackBlock is a section or context block
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+// slackText is a mrkdwn text object
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// slackResponse is the Web API response envelope
+type slackResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+	TS    string `json:"ts"`
+}
+
+// NewSlack creates a new Slack output
+func NewSlack(cfg config.OutputConfig) (*Slack, error) {
+	s := &Slack{
+		apiURL:       DefaultSlackAPI,
+		threadWindow: DefaultSlackThreadWindow,
+		enabled:      cfg.Enabled,
+		nodeThreads:  make(map[uint32]*slackThread),
+	}
+
+	s.webhookURL, _ = cfg.Options["webhook_url"].(string)
+	s.token, _ = cfg.Options["bot_token"].(string)
+	s.channel, _ = cfg.Options["channel"].(string)
+	switch {
+	case s.webhookURL != "" && s.token != "":
+		return nil, fmt.Errorf("slack takes webhook_url or bot_token, not both")
+	case s.webhookURL == "" && s.token == "":
+		return nil, fmt.Errorf("slack webhook_url or bot_token is required")
+	case s.token != "" && s.channel == "":
+		return nil, fmt.Errorf("slack channel is required with bot_token")
+	}
+	if u, ok := cfg.Options["api_url"].(string); ok && u != "" {
+		s.apiURL = strings.TrimSuffix(u, "/")
+	}
+
+	// Webhooks do not return the message timestamp needed to reply in a
+	// thread, so threads need a bot token
+	s.threads = s.token != ""
+	if v, ok := cfg.Options["threads"].(bool); ok {
+		if v && s.token == "" {
+			return nil, fmt.Errorf("slack threads need bot_token")
+		}
+		s.threads = v
+	}
+	if v, ok := cfg.Options["thread_window"].(string); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid slack thread_window: %q", v)
+		}
+		s.threadWindow = d
+	}
+	s.allPorts, _ = cfg.Options["all_ports"].(bool)
+
+	tmpl, err := templateOption(cfg.Options, "template")
+	if err != nil {
+		return nil, err
+	}
+	s.tmpl = tmpl
+
+	timeout := 30 * time.Second
+	if v, ok := cfg.Options["timeout"].(string); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			timeout = d
+		}
+	}
+	if s.sender, err = newHTTPSender(cfg, timeout); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Send posts the message, replying in the sender's thread if it has one
+func (s *Slack) Send(ctx context.Context, msg *message.Packet) error {
+	if s.skip(msg) {
+		return nil
+	}
+	m, err := s.message(msg)
+	if err != nil {
+		return err
+	}
+
+	if s.webhookURL != "" {
+		return s.postWebhook(ctx, m)
+	}
+
+	now := time.Now()
+	if s.threads {
+		m.ThreadTS = s.thread(msg.From, now)
+	}
+	ts, err := s.postMessage(ctx, m)
+	if err != nil {
+		return err
+	}
+	if s.threads {
+		s.remember(msg.From, m.ThreadTS, ts, now)
+	}
+	return nil
+}
+
+// thread returns the timestamp of the node's open thread, or "" to start
+// a new one
+func (s *Slack) thread(node uint32, now time.Time) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.nodeThreads[node]
+	if t == nil || now.Sub(t.last) > s.threadWindow {
+		return ""
+	}
+	return t.ts
+}
+
+// remember records a message posted for node. A message that started a
+// thread becomes its parent.
+func (s *Slack) remember(node uint32, threadTS, ts string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if threadTS == "" {
+		if ts == "" {
+			return
+		}
+		threadTS = ts
+	}
+	s.nodeThreads[node] = &slackThread{ts: threadTS, last: now}
+
+	// Forget threads that have gone quiet
+	for n, t := range s.nodeThreads {
+		if now.Sub(t.last) > s.threadWindow {
+			delete(s.nodeThreads, n)
+		}
+	}
+}
+
+// postWebhook sends m to the incoming webhook
+func (s *Slack) postWebhook(ctx context.Context, m *slackMessage) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to marshal slack message: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.webhookURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.sender.client.Do(req)
+	if err != nil {
+		// The webhook URL is the secret
+		return fmt.Errorf("failed to send to slack: %w", stripURL(err))
+	}
+	defer closeBody(resp)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("slack returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// postMessage sends m with chat.postMessage and returns its timestamp
+func (s *Slack) postMessage(ctx context.Context, m *slackMessage) (string, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal slack message: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.apiURL+"/chat.postMessage", bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	resp, err := s.sender.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send to slack: %w", err)
+	}
+	defer closeBody(resp)
+
+	var result slackResponse
+	_ = json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("slack returned status %d", resp.StatusCode)
+	}
+	if !result.OK {
+		return "", fmt.Errorf("slack returned error: %s", result.Error)
+	}
+	return result.TS, nil
+}
+
+// skip reports whether msg is not sent to Slack
+func (s *Slack) skip(msg *message.Packet) bool {
+	if s.allPorts {
+		return false
+	}
+	_, text := msg.Payload.(*message.TextMessage)
+	return !text
+}
+
+// message builds the blocks for msg: the sender and text, then a context
+// line with the channel and signal
+func (s *Slack) message(msg *message.Packet) (*slackMessage, error) {
+	text, err := s.text(msg)
+	if err != nil {
+		return nil, err
+	}
+	body := fmt.Sprintf("*%s*: %s", slackEscape(nodeName(msg)), slackEscape(text))
+	if r := []rune(body); len(r) > slackMaxText {
+		body = string(r[:slackMaxText])
+	}
+
+	return &slackMessage{
+		Channel: s.channel,
+		Text:    fmt.Sprintf("%s: %s", nodeName(msg), text),
+		Blocks: []slackBlock{
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: body}},
+			{Type: "context", Elements: slackContext(msg)},
+		},
+	}, nil
+}
+
+// text renders the template if set, otherwise the message text or a
+// summary of other payloads
+func (s *Slack) text(msg *message.Packet) (string, error) {
+	if s.tmpl != nil {
+		return execute(s.tmpl, msg)
+	}
+	if p, ok := msg.Payload.(*message.TextMessage); ok {
+		return p.Text, nil
+	}
+	return fmt.Sprintf("[%s] %v", msg.PortNum.String(), msg.Payload), nil
+}
+
+// slackContext returns the context elements describing where and how a
+// packet was heard
+func slackContext(msg *message.Packet) []slackText {
+	channel := msg.ChannelName
+	if channel == "" {
+		channel = fmt.Sprintf("%d", msg.Channel)
+	}
+	elements := []slackText{
+		{Type: "mrkdwn", Text: slackEscape(hexID(msg.From))},
+		{Type: "mrkdwn", Text: "Channel " + slackEscape(channel)},
+	}
+	if msg.SNR != 0 || msg.RSSI != 0 {
+		elements = append(elements, slackText{Type: "mrkdwn",
+			Text: fmt.Sprintf("SNR %.1f dB, RSSI %d dBm", msg.SNR, msg.RSSI)})
+	}
+	if msg.GatewayID != "" {
+		elements = append(elements, slackText{Type: "mrkdwn", Text: "via " + slackEscape(msg.GatewayID)})
+	}
+	return elements
+}
+
+// slackEscape escapes the characters Slack treats as control sequences
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// Preview renders the request that would be sent. Replies to a thread are
+// not shown.
+func (s *Slack) Preview(msg *message.Packet) (*Preview, error) {
+	p := &Preview{Target: s.target(), Method: "POST"}
+	if s.skip(msg) {
+		p.Skipped = "not a text message (set all_ports to send every message)"
+		return p, nil
+	}
+	m, err := s.message(msg)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal slack message: %w", err)
+	}
+	if s.token != "" {
+		p.Headers = map[string]string{"Authorization": maskedValue}
+	}
+	p.Body = string(data)
+	return p, nil
+}
+
+// target returns the request URL with the webhook secret masked
+func (s *Slack) target() string {
+	if s.webhookURL == "" {
+		return s.apiURL + "/chat.postMessage"
+	}
+	u, err := url.Parse(s.webhookURL)
+	if err != nil {
+		return maskedValue
+	}
+	return u.Scheme + "://" + u.Host + "/" + maskedValue
+}
+
+// Close releases pooled connections
+func (s *Slack) Close() error {
+	s.sender.closeIdle()
+	return nil
+}
+
+// Name returns the output identifier, without secrets
+func (s *Slack) Name() string {
+	if s.webhookURL != "" {
+		if u, err := url.Parse(s.webhookURL); err == nil {
+			return "slack:" + u.Host
+		}
+		return "slack:webhook"
+	}
+	return "slack:" + s.channel
+}
+
+// Enabled returns whether this output is enabled
+func (s *Slack) Enabled() bool {
+	return s.enabled
+}
@@ -0,0 +1,101 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestSlackThreadsPerSender(t *testing.T) {
+	var got []slackMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat.postMessage" || r.Header.Get("Authorization") != "Bearer xoxb-1" {
+			t.Errorf("request = %s %s", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		var m slackMessage
+		_ = json.NewDecoder(r.Body).Decode(&m)
+		got = append(got, m)
+		_, _ = fmt.Fprintf(w, `{"ok":true,"ts":"100.%d"}`, len(got))
+	}))
+	defer srv.Close()
+
+	out, err := NewSlack(config.OutputConfig{Type: "slack", Options: map[string]interface{}{
+		"bot_token": "xoxb-1",
+		"channel":   "#mesh",
+		"api_url":   srv.URL,
+	}})
+	if err != nil {
+		t.Fatalf("NewSlack: %v", err)
+	}
+
+	text := func(from uint32, s string) *message.Packet {
+		return &message.Packet{From: from, PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: s}, SNR: 5.5, RSSI: -90}
+	}
+	for _, msg := range []*message.Packet{text(1, "a <b>"), text(2, "c"), text(1, "d")} {
+		if err := out.Send(context.Background(), msg); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("got %d requests", len(got))
+	}
+	if got[0].ThreadTS != "" || got[1].ThreadTS != "" || got[2].ThreadTS != "100.1" {
+		t.Errorf("thread_ts = %q %q %q, want the third reply in the first sender's thread",
+			got[0].ThreadTS, got[1].ThreadTS, got[2].ThreadTS)
+	}
+	if body := got[0].Blocks[0].Text.Text; body != "*!00000001*: a &lt;b&gt;" {
+		t.Errorf("section = %q", body)
+	}
+	if ctx := got[0].Blocks[1].Elements; len(ctx) != 3 || !strings.Contains(ctx[2].Text, "SNR 5.5 dB") {
+		t.Errorf("context = %+v", ctx)
+	}
+}
+
+func TestSlackWebhook(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	out, err := NewSlack(config.OutputConfig{Type: "slack", Options: map[string]interface{}{
+		"webhook_url": srv.URL + "/services/T0/B0/secret",
+	}})
+	if err != nil {
+		t.Fatalf("NewSlack: %v", err)
+	}
+	if err := out.Send(context.Background(), &message.Packet{Payload: &message.TextMessage{Text: "hi"}}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("requests = %d", requests)
+	}
+	p, err := out.Preview(&message.Packet{Payload: &message.TextMessage{Text: "hi"}})
+	if err != nil || strings.Contains(p.Target, "secret") || strings.Contains(out.Name(), "secret") {
+		t.Errorf("webhook secret leaked: %+v %s %v", p, out.Name(), err)
+	}
+}
+
+func TestSlackOptions(t *testing.T) {
+	tests := []map[string]interface{}{
+		{},
+		{"bot_token": "t"},
+		{"webhook_url": "https://hooks.slack.com/x", "bot_token": "t", "channel": "c"},
+		{"webhook_url": "https://hooks.slack.com/x", "threads": true},
+		{"bot_token": "t", "channel": "c", "thread_window": "soon"},
+	}
+	for _, opts := range tests {
+		if _, err := NewSlack(config.OutputConfig{Options: opts}); err == nil {
+			t.Errorf("options %v accepted", opts)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// DefaultTwilioAPI is the Twilio endpoint used unless api_url is set
+const DefaultTwilioAPI = "https://api.twilio.com"
+
+// DefaultSMSRate is the default number of texts sent per minute across all
+// recipients
+const DefaultSMSRate = 10
+
+// DefaultSMSRecipientRate is the default number of texts a single
+// recipient receives per hour
+const DefaultSMSRecipientRate = 20
+
+// DefaultSMSMaxLength is the default text length limit, Twilio's maximum
+// of ten concatenated segments
+const DefaultSMSMaxLength = 1600
+
+// ErrSMSRateLimited is returned for texts dropped by the rate limits
+var ErrSMSRateLimited = errors.New("sms rate limit reached")
+
+// SMS sends mesh text messages as texts through Twilio or any HTTP SMS API.
+// Messages from a node listed in recipients go to that node's numbers;
+// others go to the numbers in to, or are not sent if it is empty. Only text
+// messages are sent unless all_ports is set.
+//
+// Texts cost money and phones cannot mute a chatty mesh, so the limits are
+// strict: texts over the overall per-minute limit or a recipient's hourly
+// limit are dropped rather than queued, and reported as ErrSMSRateLimited.
+type SMS struct {
+	provider   string
+	url        string
+	method     string
+	headers    map[string]string
+	bodyTmpl   *template.Template // http provider request body
+	accountSID string
+	authToken  string
+	from       string
+	to         []string
+	recipients map[uint32][]string
+	allPorts   bool
+	maxLength  int
+	tmpl       *template.Template
+	enabled    bool
+	httpSender
+
+	mu        sync.Mutex
+	rate      int
+	perMinute []time.Time
+	recipRate int
+	perHour   map[string][]time.Time
+}
+
+// smsRequest is the data of the http provider's body_template
+type smsRequest struct {
+	To     string
+	From   string
+	Text   string
+	Packet *message.Packet
+}
+
+// NewSMS creates a new SMS output
+func NewSMS(cfg config.OutputConfig) (*SMS, error) {
+	s := &SMS{
+		method:    "POST",
+		headers:   make(map[string]string),
+		maxLength: DefaultSMSMaxLength,
+		rate:      DefaultSMSRate,
+		recipRate: DefaultSMSRecipientRate,
+		perHour:   make(map[string][]time.Time),
+		enabled:   cfg.Enabled,
+	}
+
+	s.provider, _ = cfg.Options["provider"].(string)
+	s.from, _ = cfg.Options["from"].(string)
+	switch s.provider {
+	case "", "twilio":
+		s.provider = "twilio"
+		s.accountSID, _ = cfg.Options["account_sid"].(string)
+		s.authToken, _ = cfg.Options["auth_token"].(string)
+		if s.accountSID == "" || s.authToken == "" {
+			return nil, fmt.Errorf("sms account_sid and auth_token are required for twilio")
+		}
+		if s.from == "" {
+			return nil, fmt.Errorf("sms from is required for twilio")
+		}
+		api := DefaultTwilioAPI
+		if u, ok := cfg.Options["api_url"].(string); ok && u != "" {
+			api = strings.TrimSuffix(u, "/")
+		}
+		s.url = fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", api, url.PathEscape(s.accountSID))
+	case "http":
+		s.url, _ = cfg.Options["url"].(string)
+		if s.url == "" {
+			return nil, fmt.Errorf("sms url is required for the http provider")
+		}
+		if m, ok := cfg.Options["method"].(string); ok && m != "" {
+			s.method = m
+		}
+		if h, ok := cfg.Options["headers"].(map[string]interface{}); ok {
+			for k, v := range h {
+				if hv, ok := v.(string); ok {
+					s.headers[k] = hv
+				}
+			}
+		}
+		tmpl, err := templateOption(cfg.Options, "body_template")
+		if err != nil {
+			return nil, err
+		}
+		if tmpl == nil {
+			return nil, fmt.Errorf("sms body_template is required for the http provider")
+		}
+		s.bodyTmpl = tmpl
+	default:
+		return nil, fmt.Errorf("sms provider must be twilio or http")
+	}
+
+	s.to = stringsOption(cfg.Options, "to")
+	if raw, ok := cfg.Options["recipients"].(map[string]interface{}); ok {
+		s.recipients = make(map[uint32][]string, len(raw))
+		for id := range raw {
+			num, err := message.ParseNodeID(id)
+			if err != nil {
+				return nil, fmt.Errorf("sms recipients: %w", err)
+			}
+			numbers := stringsOption(raw, id)
+			if len(numbers) == 0 {
+				return nil, fmt.Errorf("sms recipients: no numbers for node %s", id)
+			}
+			s.recipients[num] = numbers
+		}
+	}
+	if len(s.to) == 0 && len(s.recipients) == 0 {
+		return nil, fmt.Errorf("sms to or recipients is required")
+	}
+
+	s.allPorts, _ = cfg.Options["all_ports"].(bool)
+	if n, ok := IntOption(cfg.Options, "max_length"); ok {
+		if n < 1 {
+			return nil, fmt.Errorf("sms max_length must be at least 1")
+		}
+		s.maxLength = n
+	}
+	if n, ok := IntOption(cfg.Options, "rate_limit"); ok {
+		if n < 1 {
+			return nil, fmt.Errorf("sms rate_limit must be at least 1")
+		}
+		s.rate = n
+	}
+	if n, ok := IntOption(cfg.Options, "recipient_rate_limit"); ok {
+		if n < 1 {
+			return nil, fmt.Errorf("sms recipient_rate_limit must be at least 1")
+		}
+		s.recipRate = n
+	}
+
+	tmpl, err := templateOption(cfg.Options, "template")
+	if err != nil {
+		return nil, err
+	}
+	s.tmpl = tmpl
+
+	timeout := 30 * time.Second
+	if v, ok := cfg.Options["timeout"].(string); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			timeout = d
+		}
+	}
+	if s.httpSender, err = newHTTPSender(cfg, timeout); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Send texts the message to each of its recipients that is within the
+// rate limits
+func (s *SMS) Send(ctx context.Context, msg *message.Packet) error {
+	if s.skip(msg) {
+		return nil
+	}
+	text, err := s.text(msg)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, to := range s.recipientsFor(msg) {
+		if !s.allow(to, time.Now()) {
+			errs = append(errs, fmt.Errorf("%w: text to %s dropped", ErrSMSRateLimited, to))
+			continue
+		}
+		req, err := s.request(ctx, to, text, msg)
+		if err == nil {
+			err = s.do(req, "sms")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("text to %s: %w", to, stripURL(err)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// recipientsFor returns the numbers texted for msg
+func (s *SMS) recipientsFor(msg *message.Packet) []string {
+	if numbers, ok := s.recipients[msg.From]; ok {
+		return numbers
+	}
+	return s.to
+}
+
+// allow reports whether a text to a recipient fits within the limits,
+// counting it if it does
+func (s *SMS) allow(to string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.perMinute = recent(s.perMinute, now.Add(-time.Minute))
+	hour := recent(s.perHour[to], now.Add(-time.Hour))
+	if len(s.perMinute) >= s.rate || len(hour) >= s.recipRate {
+		s.perHour[to] = hour
+		return false
+	}
+	s.perMinute = append(s.perMinute, now)
+	s.perHour[to] = append(hour, now)
+	return true
+}
+
+// recent drops the times before since from a sorted list
+func recent(times []time.Time, since time.Time) []time.Time {
+	i := sort.Search(len(times), func(i int) bool { return times[i].After(since) })
+	return times[i:]
+}
+
+// request builds the provider request texting to
+func (s *SMS) request(ctx context.Context, to, text string, msg *message.Packet) (*http.Request, error) {
+	body, contentType, err := s.body(to, text, msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, s.method, s.url, strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	if s.provider == "twilio" {
+		req.SetBasicAuth(s.accountSID, s.authToken)
+	}
+	return req, nil
+}
+
+// body returns the request body and its content type
+func (s *SMS) body(to, text string, msg *message.Packet) (string, string, error) {
+	if s.provider == "twilio" {
+		form := url.Values{"To": {to}, "Body": {text}}
+		if strings.HasPrefix(s.from, "MG") {
+			// A messaging service picks the sending number itself
+			form.Set("MessagingServiceSid", s.from)
+		} else {
+			form.Set("From", s.from)
+		}
+		return form.Encode(), "application/x-www-form-urlencoded", nil
+	}
+
+	var b strings.Builder
+	if err := s.bodyTmpl.Execute(&b, smsRequest{To: to, From: s.from, Text: text, Packet: msg}); err != nil {
+		return "", "", fmt.Errorf("failed to render %s: %w", s.bodyTmpl.Name(), err)
+	}
+	return b.String(), "application/json", nil
+}
+
+// skip reports whether msg is not texted
+func (s *SMS) skip(msg *message.Packet) bool {
+	if s.allPorts {
+		return false
+	}
+	_, text := msg.Payload.(*message.TextMessage)
+	return !text
+}
+
+// text renders the template if set, otherwise "<sender>: <text>", cut to
+// max_length
+func (s *SMS) text(msg *message.Packet) (string, error) {
+	var text string
+	if s.tmpl != nil {
+		var err error
+		if text, err = execute(s.tmpl, msg); err != nil {
+			return "", err
+		}
+	} else {
+		switch p := msg.Payload.(type) {
+		case *message.TextMessage:
+			text = fmt.Sprintf("%s: %s", nodeName(msg), p.Text)
+		default:
+			text = fmt.Sprintf("%s [%s] %v", nodeName(msg), msg.PortNum.String(), msg.Payload)
+		}
+	}
+	if r := []rune(text); len(r) > s.maxLength {
+		text = string(r[:s.maxLength])
+	}
+	return text, nil
+}
+
+// Preview renders the request sent to each recipient, without counting
+// against the rate limits
+func (s *SMS) Preview(msg *message.Packet) (*Preview, error) {
+	p := &Preview{Target: MaskURL(s.url), Method: s.method, Headers: maskHeaders(s.headers)}
+	if s.provider == "twilio" {
+		p.Headers["Authorization"] = maskedValue
+	}
+	if s.skip(msg) {
+		p.Skipped = "not a text message (set all_ports to send every message)"
+		return p, nil
+	}
+	to := s.recipientsFor(msg)
+	if len(to) == 0 {
+		p.Skipped = "no recipients for node " + hexID(msg.From)
+		return p, nil
+	}
+	text, err := s.text(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	bodies := make([]string, 0, len(to))
+	for _, number := range to {
+		body, _, err := s.body(number, text, msg)
+		if err != nil {
+			return nil, err
+		}
+		bodies = append(bodies, body)
+	}
+	p.Body = strings.Join(bodies, "\n")
+	return p, nil
+}
+
+// Close releases pooled connections
+func (s *SMS) Close() error {
+	s.closeIdle()
+	return nil
+}
+
+// Name returns the output identifier, without credentials
+func (s *SMS) Name() string {
+	if s.provider == "twilio" {
+		return fmt.Sprintf("sms:twilio:%s", s.from)
+	}
+	return fmt.Sprintf("sms:%s", MaskURL(s.url))
+}
+
+// Enabled returns whether this output is enabled
+func (s *SMS) Enabled() bool {
+	return s.enabled
+}
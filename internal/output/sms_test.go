@@ -0,0 +1,121 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestSMSTwilio(t *testing.T) {
+	var mu sync.Mutex
+	var got []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2010-04-01/Accounts/AC123/Messages.json" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if user, pass, _ := r.BasicAuth(); user != "AC123" || pass != "secret" {
+			t.Errorf("basic auth = %s:%s", user, pass)
+		}
+		_ = r.ParseForm()
+		mu.Lock()
+		got = append(got, r.PostForm)
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	out, err := NewSMS(config.OutputConfig{Type: "sms", Options: map[string]interface{}{
+		"api_url":     srv.URL,
+		"account_sid": "AC123",
+		"auth_token":  "secret",
+		"from":        "+15550100000",
+		"to":          "+15550100001",
+		"recipients":  map[string]interface{}{"!1234abcd": []interface{}{"+15550100002", "+15550100003"}},
+		"rate_limit":  3,
+	}})
+	if err != nil {
+		t.Fatalf("NewSMS: %v", err)
+	}
+
+	text := func(from uint32) *message.Packet {
+		return &message.Packet{From: from, PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: "help"}}
+	}
+	if err := out.Send(context.Background(), &message.Packet{PortNum: message.PortNumPosition, Payload: &message.Position{}}); err != nil {
+		t.Fatalf("Send position: %v", err)
+	}
+	if err := out.Send(context.Background(), text(0x1234abcd)); err != nil {
+		t.Fatalf("Send mapped: %v", err)
+	}
+	if err := out.Send(context.Background(), text(0x0000beef)); err != nil {
+		t.Fatalf("Send unmapped: %v", err)
+	}
+	// The per-minute limit of 3 is used up
+	if err := out.Send(context.Background(), text(0x0000beef)); !errors.Is(err, ErrSMSRateLimited) {
+		t.Fatalf("Send over limit: err = %v, want ErrSMSRateLimited", err)
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("sent %d texts, want 3", len(got))
+	}
+	for i, to := range []string{"+15550100002", "+15550100003", "+15550100001"} {
+		if got[i].Get("To") != to || got[i].Get("From") != "+15550100000" {
+			t.Errorf("text %d: To=%s From=%s", i, got[i].Get("To"), got[i].Get("From"))
+		}
+	}
+	if body := got[0].Get("Body"); body != "!1234abcd: help" {
+		t.Errorf("Body = %q", body)
+	}
+}
+
+func TestSMSRecipientLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	out, err := NewSMS(config.OutputConfig{Type: "sms", Options: map[string]interface{}{
+		"provider":             "http",
+		"url":                  srv.URL,
+		"body_template":        `{"to": {{json .To}}, "text": {{json .Text}}}`,
+		"to":                   []interface{}{"+15550100001"},
+		"recipient_rate_limit": 1,
+	}})
+	if err != nil {
+		t.Fatalf("NewSMS: %v", err)
+	}
+
+	msg := &message.Packet{From: 1, PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: `say "hi"`}}
+	if err := out.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := out.Send(context.Background(), msg); !errors.Is(err, ErrSMSRateLimited) {
+		t.Fatalf("second Send: err = %v, want ErrSMSRateLimited", err)
+	}
+
+	p, err := out.Preview(msg)
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	if want := `{"to": "+15550100001", "text": "!00000001: say \"hi\""}`; p.Body != want {
+		t.Errorf("Preview body = %s, want %s", p.Body, want)
+	}
+}
+
+func TestSMSOptions(t *testing.T) {
+	for _, opts := range []map[string]interface{}{
+		{"account_sid": "AC1", "auth_token": "x", "to": "+1"},
+		{"account_sid": "AC1", "auth_token": "x", "from": "+1"},
+		{"provider": "http", "url": "http://sms", "to": "+1"},
+		{"provider": "carrier-pigeon", "to": "+1"},
+		{"account_sid": "AC1", "auth_token": "x", "from": "+1", "recipients": map[string]interface{}{"bob": "+2"}},
+	} {
+		if _, err := NewSMS(config.OutputConfig{Type: "sms", Options: opts}); err == nil {
+			t.Errorf("NewSMS(%v) succeeded", opts)
+		}
+	}
+}
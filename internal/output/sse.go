@@ -0,0 +1,203 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// sseHeartbeat keeps idle streams from being closed by proxies
+const sseHeartbeat = 30 * time.Second
+
+// SSE streams packets to web clients as Server-Sent Events. Each client
+// connected to the endpoint receives every packet sent after it connected
+// as a "packet" event whose data is the packet JSON, and relay events such
+// as "reload" under their own names.
+type SSE struct {
+	listen      string
+	path        string
+	buffer      int
+	allowOrigin string
+	enabled     bool
+
+	srv      *http.Server
+	listener net.Listener
+
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+}
+
+// NewSSE creates an SSE output and starts listening
+func NewSSE(cfg config.OutputConfig) (*SSE, error) {
+	s := newSSE(cfg)
+
+	ln, err := net.Listen("tcp", s.listen)
+	if err != nil {
+		return nil, fmt.Errorf("sse: failed to listen on %s: %w", s.listen, err)
+	}
+	s.listener = ln
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+s.path, s.serve)
+	s.srv = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	// Serve returns when the output is closed
+	go func() { _ = s.srv.Serve(ln) }()
+
+	return s, nil
+}
+
+// newSSE parses the SSE output settings without listening
+func newSSE(cfg config.OutputConfig) *SSE {
+	s := &SSE{
+		listen:  "127.0.0.1:8090",
+		path:    "/events",
+		buffer:  64,
+		enabled: cfg.Enabled,
+		clients: make(map[chan []byte]struct{}),
+	}
+	if l, ok := cfg.Options["listen"].(string); ok && l != "" {
+		s.listen = l
+	}
+	if p, ok := cfg.Options["path"].(string); ok && p != "" {
+		s.path = p
+	}
+	if n, ok := IntOption(cfg.Options, "buffer"); ok && n > 0 {
+		s.buffer = n
+	}
+	s.allowOrigin, _ = cfg.Options["allow_origin"].(string)
+	return s
+}
+
+// Send queues the packet for every connected client. Clients too slow to
+// keep up miss packets rather than delaying the relay.
+func (s *SSE) Send(ctx context.Context, msg *message.Packet) error {
+	data, err := render(ctx, msg).JSON()
+	if err != nil {
+		return err
+	}
+	s.broadcast(sseEvent("packet", data))
+	return nil
+}
+
+// Publish streams a relay event to every connected client
+func (s *SSE) Publish(event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("sse: failed to encode %s event: %w", event, err)
+	}
+	s.broadcast(sseEvent(event, payload))
+	return nil
+}
+
+// broadcast queues an event for every client with room for it
+func (s *SSE) broadcast(event []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for client := range s.clients {
+		select {
+		case client <- event:
+		default:
+		}
+	}
+}
+
+func sseEvent(name string, data []byte) []byte {
+	return []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", name, data))
+}
+
+// Clients returns the number of connected clients
+func (s *SSE) Clients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+// serve streams packets to one client until it disconnects
+func (s *SSE) serve(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	client := make(chan []byte, s.buffer)
+	s.mu.Lock()
+	s.clients[client] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, client)
+		s.mu.Unlock()
+	}()
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	if s.allowOrigin != "" {
+		h.Set("Access-Control-Allow-Origin", s.allowOrigin)
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			_, _ = fmt.Fprint(w, ": ping\n\n")
+		case event := <-client:
+			_, _ = w.Write(event)
+		}
+		flusher.Flush()
+	}
+}
+
+// Preview renders the event that would be streamed
+func (s *SSE) Preview(msg *message.Packet) (*Preview, error) {
+	data, err := NewRender(msg).JSON()
+	if err != nil {
+		return nil, err
+	}
+	return &Preview{Target: s.Name(), Body: fmt.Sprintf("event: packet\ndata: %s", data)}, nil
+}
+
+// Addr returns the address the output is listening on
+func (s *SSE) Addr() string {
+	if s.listener == nil {
+		return s.listen
+	}
+	return s.listener.Addr().String()
+}
+
+// Close disconnects all clients and stops listening
+func (s *SSE) Close() error {
+	if s.srv == nil {
+		return nil
+	}
+	err := s.srv.Close()
+	// The server only tracks the listener once Serve is running
+	_ = s.listener.Close()
+	return err
+}
+
+// Name returns the output identifier
+func (s *SSE) Name() string {
+	return fmt.Sprintf("sse:%s%s", s.listen, s.path)
+}
+
+// Enabled returns whether this output is enabled
+func (s *SSE) Enabled() bool {
+	return s.enabled
+}
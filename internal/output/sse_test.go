@@ -0,0 +1,65 @@
+package output
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestSSEStreamsPackets(t *testing.T) {
+	out, err := NewSSE(config.OutputConfig{Type: "sse", Options: map[string]interface{}{"listen": "127.0.0.1:0"}})
+	if err != nil {
+		t.Fatalf("NewSSE: %v", err)
+	}
+	defer func() { _ = out.Close() }()
+
+	resp, err := http.Get("http://" + out.Addr() + "/events")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	lines.Scan() // ": connected" comment, sent once the client is registered
+
+	msg := &message.Packet{From: 1, PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: "hi"}}
+	if err := out.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	done := make(chan string, 1)
+	go func() {
+		var event strings.Builder
+		for lines.Scan() && !strings.HasPrefix(lines.Text(), "data: ") {
+			event.WriteString(lines.Text())
+		}
+		done <- event.String() + "|" + lines.Text()
+	}()
+	select {
+	case got := <-done:
+		want := "event: packet|data: " + string(mustJSON(t, msg))
+		if got != want {
+			t.Errorf("event = %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+}
+
+func mustJSON(t *testing.T, msg *message.Packet) []byte {
+	t.Helper()
+	data, err := NewRender(msg).JSON()
+	if err != nil {
+		t.Fatalf("JSON: %v", err)
+	}
+	return data
+}
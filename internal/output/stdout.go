@@ -2,9 +2,9 @@ package output
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
+	"text/template"
 	"time"
 
 	"github.com/iamruinous/meshtastic-message-relay/internal/config"
@@ -14,6 +14,7 @@ import (
 // Stdout outputs messages to standard output
 type Stdout struct {
 	format  string
+	tmpl    *template.Template // replaces format when set
 	enabled bool
 }
 
@@ -24,30 +25,72 @@ func NewStdout(cfg config.OutputConfig) (*Stdout, error) {
 		format = f
 	}
 
+	tmpl, err := templateOption(cfg.Options, "template")
+	if err != nil {
+		return nil, err
+	}
+
 	return &Stdout{
 		format:  format,
+		tmpl:    tmpl,
 		enabled: cfg.Enabled,
 	}, nil
 }
 
 // Send outputs a message to stdout
-func (s *Stdout) Send(_ context.Context, msg *message.Packet) error {
+func (s *Stdout) Send(ctx context.Context, msg *message.Packet) error {
+	r := render(ctx, msg)
+	if s.tmpl != nil {
+		line, err := execute(s.tmpl, msg)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(os.Stdout, line)
+		return nil
+	}
 	if s.format == "json" {
-		return s.sendJSON(msg)
+		return s.sendJSON(r)
 	}
-	return s.sendText(msg)
+	return s.sendText(r)
 }
 
-func (s *Stdout) sendJSON(msg *message.Packet) error {
-	data, err := json.Marshal(msg)
+func (s *Stdout) sendJSON(r *Render) error {
+	line, err := r.JSONLine()
 	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
+		return err
 	}
-	_, _ = fmt.Fprintln(os.Stdout, string(data))
+	_, _ = os.Stdout.Write(line)
+	return nil
+}
+
+func (s *Stdout) sendText(r *Render) error {
+	_, _ = fmt.Fprintln(os.Stdout, r.Text())
 	return nil
 }
 
-func (s *Stdout) sendText(msg *message.Packet) error {
+// Preview renders the line that would be written
+func (s *Stdout) Preview(msg *message.Packet) (*Preview, error) {
+	if s.tmpl != nil {
+		body, err := execute(s.tmpl, msg)
+		if err != nil {
+			return nil, err
+		}
+		return &Preview{Target: "stdout", Body: body}, nil
+	}
+	r := NewRender(msg)
+	body := r.Text()
+	if s.format == "json" {
+		data, err := r.JSON()
+		if err != nil {
+			return nil, err
+		}
+		body = string(data)
+	}
+	return &Preview{Target: "stdout", Body: body}, nil
+}
+
+// formatTextLine renders a packet as a single human-readable line
+func formatTextLine(msg *message.Packet) string {
 	timestamp := msg.ReceivedAt.Format(time.RFC3339)
 	fromNode := fmt.Sprintf("!%08x", msg.From)
 	if msg.FromNode != nil && msg.FromNode.User != nil {
@@ -64,13 +107,7 @@ func (s *Stdout) sendText(msg *message.Packet) error {
 		payload = fmt.Sprintf("%v", msg.Payload)
 	}
 
-	_, _ = fmt.Fprintf(os.Stdout, "[%s] %s (%s): %s\n",
-		timestamp,
-		fromNode,
-		msg.PortNum.String(),
-		payload,
-	)
-	return nil
+	return fmt.Sprintf("[%s] %s (%s): %s", timestamp, fromNode, msg.PortNum.String(), payload)
 }
 
 // Close closes the stdout output (no-op)
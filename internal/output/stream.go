@@ -0,0 +1,128 @@
+package output
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// streamRecord is a single record for a streaming platform
+type streamRecord struct {
+	topic   string
+	key     string
+	payload []byte
+}
+
+// streamCodec encodes packets as records for Kafka and NATS. Payloads are
+// the packet JSON or a Meshtastic ServiceEnvelope protobuf, and the key is
+// the sending node (the default), the channel, or empty.
+type streamCodec struct {
+	kind     string
+	topic    string
+	key      string
+	protobuf bool
+	clean    func(string) string
+}
+
+// newStreamCodec reads the format and key options and checks the topic
+// template, whose placeholders are the same as the mqtt event_topic's.
+// clean makes an expanded placeholder valid within a topic.
+func newStreamCodec(kind string, cfg config.OutputConfig, topic string, clean func(string) string) (*streamCodec, error) {
+	c := &streamCodec{kind: kind, topic: topic, key: "node", clean: clean}
+
+	for _, p := range topicPlaceholder.FindAllString(topic, -1) {
+		if _, ok := topicFields[strings.Trim(p, "{}")]; !ok {
+			return nil, fmt.Errorf("%s topic has unknown placeholder %s", kind, p)
+		}
+	}
+	switch f, _ := cfg.Options["format"].(string); f {
+	case "", "json":
+	case "protobuf":
+		c.protobuf = true
+	default:
+		return nil, fmt.Errorf("%s format must be json or protobuf", kind)
+	}
+	if k, ok := cfg.Options["key"].(string); ok {
+		switch k {
+		case "node", "channel", "none":
+			c.key = k
+		default:
+			return nil, fmt.Errorf("%s key must be node, channel, or none", kind)
+		}
+	}
+	return c, nil
+}
+
+// record encodes the packet in r
+func (c *streamCodec) record(r *Render) (streamRecord, error) {
+	msg := r.msg
+	rec := streamRecord{topic: expandTemplate(c.topic, msg, c.clean)}
+	switch c.key {
+	case "node":
+		rec.key = hexID(msg.From)
+	case "channel":
+		rec.key = topicFields["channel"](msg)
+	}
+
+	if c.protobuf {
+		rec.payload = envelope(msg).Marshal()
+		return rec, nil
+	}
+	data, err := r.JSON()
+	if err != nil {
+		return rec, err
+	}
+	rec.payload = data
+	return rec, nil
+}
+
+// preview renders the record that would be published. Protobuf payloads
+// are shown as hex.
+func (c *streamCodec) preview(target string, msg *message.Packet) (*Preview, error) {
+	rec, err := c.record(NewRender(msg))
+	if err != nil {
+		return nil, err
+	}
+
+	var body strings.Builder
+	body.WriteString(rec.topic)
+	if rec.key != "" {
+		body.WriteString(" key=" + strconv.Quote(rec.key))
+	}
+	body.WriteString(": ")
+	if c.protobuf {
+		body.WriteString(hex.EncodeToString(rec.payload))
+	} else {
+		body.Write(rec.payload)
+	}
+	return &Preview{Target: target, Body: body.String()}, nil
+}
+
+// stringsOption reads an option given as a list or a comma-separated string
+func stringsOption(opts map[string]interface{}, key string) []string {
+	var values []string
+	switch v := opts[key].(type) {
+	case string:
+		values = strings.Split(v, ",")
+	case []string:
+		values = v
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	var out []string
+	for _, s := range values {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
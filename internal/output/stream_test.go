@@ -0,0 +1,155 @@
+package output
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestKafkaOptions(t *testing.T) {
+	for _, opts := range []map[string]interface{}{
+		{},
+		{"brokers": "localhost:9092", "topic": "mesh/{portnum}"},
+		{"brokers": "localhost:9092", "topic": "mesh.{node}"},
+		{"brokers": "localhost:9092", "format": "xml"},
+		{"brokers": "localhost:9092", "key": "gateway"},
+		{"brokers": "localhost:9092", "acks": "two"},
+	} {
+		if _, err := NewKafka(config.OutputConfig{Type: "kafka", Options: opts}); err == nil {
+			t.Errorf("NewKafka(%v) succeeded", opts)
+		}
+	}
+
+	out, err := NewKafka(config.OutputConfig{Type: "kafka", Options: map[string]interface{}{
+		"brokers": []interface{}{"k1:9092", "k2:9092"},
+		"topic":   "meshtastic.{from}.{portnum}",
+	}})
+	if err != nil {
+		t.Fatalf("NewKafka: %v", err)
+	}
+	defer func() { _ = out.Close() }()
+	if got, want := out.Name(), "kafka:k1:9092,k2:9092/meshtastic.{from}.{portnum}"; got != want {
+		t.Errorf("Name() = %q, want %q", got, want)
+	}
+
+	p, err := out.Preview(&message.Packet{From: 0x1234abcd, PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: "hi"}})
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	if want := `meshtastic._1234abcd.TEXT_MESSAGE_APP key="!1234abcd": {`; !strings.HasPrefix(p.Body, want) {
+		t.Errorf("Preview body = %q, want prefix %q", p.Body, want)
+	}
+}
+
+func TestStreamCodecKeys(t *testing.T) {
+	msg := &message.Packet{From: 0x1234abcd, Channel: 2, ChannelName: "LongFast", PortNum: message.PortNumTextMessage,
+		Payload: &message.TextMessage{Text: "hi"}}
+	for key, want := range map[string]string{"": "!1234abcd", "node": "!1234abcd", "channel": "LongFast", "none": ""} {
+		opts := map[string]interface{}{"format": "protobuf"}
+		if key != "" {
+			opts["key"] = key
+		}
+		c, err := newStreamCodec("kafka", config.OutputConfig{Options: opts}, "t", kafkaTopicName)
+		if err != nil {
+			t.Fatalf("newStreamCodec(key %q): %v", key, err)
+		}
+		rec, err := c.record(NewRender(msg))
+		if err != nil {
+			t.Fatalf("record: %v", err)
+		}
+		if rec.key != want {
+			t.Errorf("key %q: got %q, want %q", key, rec.key, want)
+		}
+		if string(rec.payload) != string(envelope(msg).Marshal()) {
+			t.Errorf("key %q: payload is not the service envelope", key)
+		}
+	}
+}
+
+// fakeNATS accepts one client, answers pings, and reports each published
+// message as its header block and payload
+func fakeNATS(t *testing.T) (string, <-chan [2]string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	published := make(chan [2]string, 4)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_, _ = fmt.Fprintf(conn, "INFO {\"server_id\":\"test\",\"version\":\"2.10.0\",\"proto\":1,\"headers\":true,\"max_payload\":1048576}\r\n")
+
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			switch fields[0] {
+			case "PING":
+				_, _ = io.WriteString(conn, "PONG\r\n")
+			case "HPUB":
+				hdrLen, _ := strconv.Atoi(fields[len(fields)-2])
+				total, _ := strconv.Atoi(fields[len(fields)-1])
+				data := make([]byte, total+2)
+				if _, err := io.ReadFull(r, data); err != nil {
+					return
+				}
+				published <- [2]string{fields[1] + "\n" + string(data[:hdrLen]), string(data[hdrLen:total])}
+			}
+		}
+	}()
+	return "nats://" + ln.Addr().String(), published
+}
+
+func TestNATSPublish(t *testing.T) {
+	url, published := fakeNATS(t)
+
+	out, err := NewNATS(config.OutputConfig{Type: "nats", Options: map[string]interface{}{
+		"url":     url,
+		"subject": "mesh.{channel}.{portnum}",
+	}})
+	if err != nil {
+		t.Fatalf("NewNATS: %v", err)
+	}
+	defer func() { _ = out.Close() }()
+
+	msg := &message.Packet{From: 0x1234abcd, ChannelName: "Long.Fast", PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: "hi"}}
+	if err := out.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	got := <-published
+	for _, want := range []string{"mesh.Long_Fast.TEXT_MESSAGE_APP\n", "Key: !1234abcd\r\n", "Portnum: TEXT_MESSAGE_APP\r\n"} {
+		if !strings.Contains(got[0], want) {
+			t.Errorf("headers missing %q:\n%s", want, got[0])
+		}
+	}
+	if !strings.Contains(got[1], `"text":"hi"`) {
+		t.Errorf("payload = %s", got[1])
+	}
+}
+
+func TestNATSSubjectWildcard(t *testing.T) {
+	if _, err := NewNATS(config.OutputConfig{Type: "nats", Options: map[string]interface{}{"url": "nats://localhost:4222", "subject": "mesh.*"}}); err == nil {
+		t.Error("NewNATS accepted a wildcard subject")
+	}
+}
@@ -0,0 +1,339 @@
+package output
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// DefaultTAKStale is how long TAK clients show a converted position
+const DefaultTAKStale = 10 * time.Minute
+
+// cotTimeFormat is the timestamp format of Cursor on Target events
+const cotTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// TAK forwards packets from the Meshtastic ATAK plugin to a TAK server or
+// multicast group. With format cot (the default) position reports and
+// chats are converted to Cursor on Target XML, as are the position packets
+// of nodes without the plugin unless positions is disabled, so every node
+// shows up on the TAK map. With format raw the plugin payload is passed
+// through unchanged, one per datagram over UDP or length-prefixed over
+// TCP. Other packets are not sent, and ATAK forwarder packets are only
+// sent raw.
+type TAK struct {
+	address   string
+	network   string
+	raw       bool
+	positions bool
+	stale     time.Duration
+	timeout   time.Duration
+	enabled   bool
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// cotEvent is a Cursor on Target event
+type cotEvent struct {
+	XMLName xml.Name  `xml:"event"`
+	Version string    `xml:"version,attr"`
+	UID     string    `xml:"uid,attr"`
+	Type    string    `xml:"type,attr"`
+	How     string    `xml:"how,attr"`
+	Time    string    `xml:"time,attr"`
+	Start   string    `xml:"start,attr"`
+	Stale   string    `xml:"stale,attr"`
+	Point   cotPoint  `xml:"point"`
+	Detail  cotDetail `xml:"detail"`
+}
+
+type cotPoint struct {
+	Lat float64 `xml:"lat,attr"`
+	Lon float64 `xml:"lon,attr"`
+	Hae float64 `xml:"hae,attr"`
+	CE  int     `xml:"ce,attr"`
+	LE  int     `xml:"le,attr"`
+}
+
+type cotDetail struct {
+	Contact *cotContact `xml:"contact,omitempty"`
+	Group   *cotGroup   `xml:"__group,omitempty"`
+	Status  *cotStatus  `xml:"status,omitempty"`
+	Track   *cotTrack   `xml:"track,omitempty"`
+	Chat    *cotChat    `xml:"__chat,omitempty"`
+	Remarks *cotRemarks `xml:"remarks,omitempty"`
+}
+
+type cotContact struct {
+	Callsign string `xml:"callsign,attr"`
+}
+
+type cotGroup struct {
+	Name string `xml:"name,attr"`
+	Role string `xml:"role,attr"`
+}
+
+type cotStatus struct {
+	Battery uint32 `xml:"battery,attr"`
+}
+
+type cotTrack struct {
+	Speed  uint32 `xml:"speed,attr"`
+	Course uint32 `xml:"course,attr"`
+}
+
+type cotChat struct {
+	Chatroom       string `xml:"chatroom,attr"`
+	ID             string `xml:"id,attr"`
+	SenderCallsign string `xml:"senderCallsign,attr"`
+}
+
+type cotRemarks struct {
+	Source string `xml:"source,attr"`
+	To     string `xml:"to,attr,omitempty"`
+	Time   string `xml:"time,attr"`
+	Text   string `xml:",chardata"`
+}
+
+// NewTAK creates a new TAK output. The connection is made on the first
+// send.
+func NewTAK(cfg config.OutputConfig) (*TAK, error) {
+	t := &TAK{
+		network:   "udp",
+		positions: true,
+		stale:     DefaultTAKStale,
+		timeout:   10 * time.Second,
+		enabled:   cfg.Enabled,
+	}
+
+	t.address, _ = cfg.Options["address"].(string)
+	if t.address == "" {
+		return nil, fmt.Errorf("tak address is required")
+	}
+	if _, _, err := net.SplitHostPort(t.address); err != nil {
+		return nil, fmt.Errorf("invalid tak address %q: %w", t.address, err)
+	}
+	if p, ok := cfg.Options["protocol"].(string); ok && p != "" {
+		if p != "udp" && p != "tcp" {
+			return nil, fmt.Errorf("tak protocol must be udp or tcp")
+		}
+		t.network = p
+	}
+	switch f, _ := cfg.Options["format"].(string); f {
+	case "", "cot":
+	case "raw":
+		t.raw = true
+	default:
+		return nil, fmt.Errorf("tak format must be cot or raw")
+	}
+	if v, ok := cfg.Options["positions"].(bool); ok {
+		t.positions = v
+	}
+	if v, ok := cfg.Options["stale"].(string); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid tak stale: %q", v)
+		}
+		t.stale = d
+	}
+	if v, ok := cfg.Options["timeout"].(string); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			t.timeout = d
+		}
+	}
+
+	return t, nil
+}
+
+// Send forwards an ATAK plugin packet
+func (t *TAK) Send(ctx context.Context, msg *message.Packet) error {
+	data, err := t.payload(msg)
+	if err != nil || data == nil {
+		return err
+	}
+	if t.raw && t.network == "tcp" {
+		// Delimit payloads on the stream with their varint length
+		data = append(binary.AppendUvarint(nil, uint64(len(data))), data...)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		d := net.Dialer{Timeout: t.timeout}
+		conn, err := d.DialContext(ctx, t.network, t.address)
+		if err != nil {
+			return fmt.Errorf("failed to connect to tak server: %w", err)
+		}
+		t.conn = conn
+	}
+	_ = t.conn.SetWriteDeadline(time.Now().Add(t.timeout))
+	if _, err := t.conn.Write(data); err != nil {
+		// Reconnect on the next send
+		_ = t.conn.Close()
+		t.conn = nil
+		return fmt.Errorf("failed to send to tak server: %w", err)
+	}
+	return nil
+}
+
+// payload returns what is sent for msg, or nil if it is not sent
+func (t *TAK) payload(msg *message.Packet) ([]byte, error) {
+	var event *cotEvent
+	switch msg.PortNum {
+	case message.PortNumAAtak, message.PortNumAtakForwarder:
+		if t.raw {
+			if len(msg.RawPayload) == 0 {
+				return nil, nil
+			}
+			return msg.RawPayload, nil
+		}
+		if tak, ok := msg.Payload.(*message.TAK); ok {
+			event = t.event(msg, tak)
+		}
+	case message.PortNumPosition:
+		if pos, ok := msg.Payload.(*message.Position); ok && t.positions && !t.raw {
+			event = t.positionEvent(msg, pos)
+		}
+	}
+	if event == nil {
+		return nil, nil
+	}
+	data, err := xml.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cot event: %w", err)
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// event converts a TAK packet to a CoT position or chat event, or returns
+// nil if it has neither
+func (t *TAK) event(msg *message.Packet, tak *message.TAK) *cotEvent {
+	callsign := tak.Callsign
+	if callsign == "" {
+		callsign = nodeName(msg)
+	}
+	uid := tak.DeviceCallsign
+	if uid == "" {
+		uid = meshUID(msg)
+	}
+	e := t.newEvent(msg, uid)
+
+	switch {
+	case tak.Chat != "":
+		room := tak.ChatTo
+		if room == "" {
+			room = "All Chat Rooms"
+		}
+		e.Type = "b-t-f"
+		e.How = "h-g-i-g-o"
+		e.UID = fmt.Sprintf("GeoChat.%s.%s.%d", uid, room, msg.ID)
+		e.Detail.Chat = &cotChat{Chatroom: room, ID: room, SenderCallsign: callsign}
+		e.Detail.Remarks = &cotRemarks{Source: uid, To: room, Time: e.Time, Text: tak.Chat}
+	case tak.HasPosition():
+		e.Type = "a-f-G-U-C"
+		e.Point.Lat = tak.Latitude
+		e.Point.Lon = tak.Longitude
+		e.Point.Hae = float64(tak.Altitude)
+		e.Detail.Contact = &cotContact{Callsign: callsign}
+		if tak.Team != "" || tak.Role != "" {
+			e.Detail.Group = &cotGroup{Name: tak.Team, Role: tak.Role}
+		}
+		if tak.Battery > 0 {
+			e.Detail.Status = &cotStatus{Battery: tak.Battery}
+		}
+		e.Detail.Track = &cotTrack{Speed: tak.Speed, Course: tak.Course}
+	default:
+		return nil
+	}
+	return e
+}
+
+// positionEvent converts a Meshtastic position to a CoT position event,
+// or returns nil if it has no fix
+func (t *TAK) positionEvent(msg *message.Packet, pos *message.Position) *cotEvent {
+	if pos.Latitude == 0 && pos.Longitude == 0 {
+		return nil
+	}
+	e := t.newEvent(msg, meshUID(msg))
+	e.Type = "a-f-G-U-C"
+	e.Point.Lat = pos.Latitude
+	e.Point.Lon = pos.Longitude
+	e.Point.Hae = float64(pos.Altitude)
+	e.Detail.Contact = &cotContact{Callsign: nodeName(msg)}
+	return e
+}
+
+// newEvent starts an event for msg, timed from when it was received
+func (t *TAK) newEvent(msg *message.Packet, uid string) *cotEvent {
+	at := msg.ReceivedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	at = at.UTC()
+
+	return &cotEvent{
+		Version: "2.0",
+		UID:     uid,
+		How:     "m-g",
+		Time:    at.Format(cotTimeFormat),
+		Start:   at.Format(cotTimeFormat),
+		Stale:   at.Add(t.stale).Format(cotTimeFormat),
+		// Unknown accuracy
+		Point: cotPoint{CE: 9999999, LE: 9999999},
+	}
+}
+
+// meshUID is the CoT uid of a node without an ATAK device callsign
+func meshUID(msg *message.Packet) string {
+	return "meshtastic-" + hexID(msg.From)
+}
+
+// Preview renders the event that would be sent. Raw payloads are shown as
+// hex.
+func (t *TAK) Preview(msg *message.Packet) (*Preview, error) {
+	p := &Preview{Target: t.Name()}
+	data, err := t.payload(msg)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case data == nil:
+		p.Skipped = "not a position or ATAK plugin chat"
+	case t.raw:
+		p.Body = hex.EncodeToString(data)
+	default:
+		p.Body = string(data)
+	}
+	return p, nil
+}
+
+// Close closes the connection
+func (t *TAK) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+// Name returns the output identifier
+func (t *TAK) Name() string {
+	return fmt.Sprintf("tak:%s://%s", t.network, t.address)
+}
+
+// Enabled returns whether this output is enabled
+func (t *TAK) Enabled() bool {
+	return t.enabled
+}
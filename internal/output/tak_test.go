@@ -0,0 +1,144 @@
+package output
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestTAKCoT(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = pc.Close() }()
+
+	out, err := NewTAK(config.OutputConfig{Type: "tak", Options: map[string]interface{}{"address": pc.LocalAddr().String()}})
+	if err != nil {
+		t.Fatalf("NewTAK: %v", err)
+	}
+	defer func() { _ = out.Close() }()
+
+	// Only positions and ATAK plugin packets are sent
+	if err := out.Send(context.Background(), &message.Packet{PortNum: message.PortNumTelemetry, Payload: &message.Telemetry{BatteryLevel: 90}}); err != nil {
+		t.Fatalf("Send telemetry: %v", err)
+	}
+	msg := &message.Packet{From: 0x1234abcd, PortNum: message.PortNumAAtak, ReceivedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Payload: &message.TAK{Callsign: "RIDGE-1", DeviceCallsign: "ANDROID-abc123", Team: "Cyan", Role: "Team Member",
+			Battery: 77, Latitude: -33.7654321, Longitude: 151.2345678, Altitude: 42, Course: 270}}
+	if err := out.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	_ = pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	got := string(buf[:n])
+	for _, want := range []string{
+		`<event version="2.0" uid="ANDROID-abc123" type="a-f-G-U-C" how="m-g" time="2024-05-01T12:00:00.000Z" start="2024-05-01T12:00:00.000Z" stale="2024-05-01T12:10:00.000Z">`,
+		`<point lat="-33.7654321" lon="151.2345678" hae="42" ce="9999999" le="9999999"></point>`,
+		`<contact callsign="RIDGE-1"></contact><__group name="Cyan" role="Team Member"></__group><status battery="77"></status>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("event missing %s:\n%s", want, got)
+		}
+	}
+}
+
+func TestTAKRawTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		r := bufio.NewReader(conn)
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return
+		}
+		data := make([]byte, n)
+		_, _ = io.ReadFull(r, data)
+		received <- data
+	}()
+
+	out, err := NewTAK(config.OutputConfig{Type: "tak", Options: map[string]interface{}{
+		"address": ln.Addr().String(), "protocol": "tcp", "format": "raw",
+	}})
+	if err != nil {
+		t.Fatalf("NewTAK: %v", err)
+	}
+	defer func() { _ = out.Close() }()
+
+	raw := []byte{0x12, 0x09, 0x0a, 0x07, 'R', 'I', 'D', 'G', 'E', '-', '1'}
+	if err := out.Send(context.Background(), &message.Packet{PortNum: message.PortNumAtakForwarder, RawPayload: raw}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	select {
+	case data := <-received:
+		if string(data) != string(raw) {
+			t.Errorf("received %x, want %x", data, raw)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing received")
+	}
+
+	for _, opts := range []map[string]interface{}{{}, {"address": "nohost"}, {"address": "h:1", "format": "json"}, {"address": "h:1", "protocol": "sctp"}} {
+		if _, err := NewTAK(config.OutputConfig{Options: opts}); err == nil {
+			t.Errorf("options %v accepted", opts)
+		}
+	}
+}
+
+func TestTAKMeshPosition(t *testing.T) {
+	out, err := NewTAK(config.OutputConfig{Type: "tak", Options: map[string]interface{}{"address": "127.0.0.1:6969"}})
+	if err != nil {
+		t.Fatalf("NewTAK: %v", err)
+	}
+	msg := &message.Packet{From: 0x1234abcd, PortNum: message.PortNumPosition, ReceivedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		FromNode: &message.NodeInfo{User: &message.User{LongName: "Base Camp"}},
+		Payload:  &message.Position{Latitude: 46.5, Longitude: -121.25, Altitude: 1200}}
+
+	p, err := out.Preview(msg)
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	for _, want := range []string{
+		`uid="meshtastic-!1234abcd" type="a-f-G-U-C"`,
+		`<point lat="46.5" lon="-121.25" hae="1200" ce="9999999" le="9999999"></point>`,
+		`<contact callsign="Base Camp"></contact>`,
+	} {
+		if !strings.Contains(p.Body, want) {
+			t.Errorf("event missing %s:\n%s", want, p.Body)
+		}
+	}
+
+	// Positions without a fix, or with positions disabled, are not sent
+	if p, _ := out.Preview(&message.Packet{PortNum: message.PortNumPosition, Payload: &message.Position{}}); p.Skipped == "" {
+		t.Error("position without a fix was not skipped")
+	}
+	out, err = NewTAK(config.OutputConfig{Type: "tak", Options: map[string]interface{}{"address": "127.0.0.1:6969", "positions": false}})
+	if err != nil {
+		t.Fatalf("NewTAK: %v", err)
+	}
+	if p, _ := out.Preview(msg); p.Skipped == "" {
+		t.Error("position sent with positions disabled")
+	}
+}
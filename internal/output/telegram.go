@@ -0,0 +1,499 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// DefaultTelegramAPI is the Bot API endpoint used unless api_url is set
+const DefaultTelegramAPI = "https://api.telegram.org"
+
+// DefaultTelegramRate is the default message limit per minute. Telegram
+// allows bots about 20 messages a minute in a group.
+const DefaultTelegramRate = 20
+
+// telegramMaxText is the most characters of message text the Bot API
+// accepts
+const telegramMaxText = 4096
+
+// telegramMaxSent is the most sent messages remembered for editing and
+// replies
+const telegramMaxSent = 500
+
+// telegramPollTimeout is how long a getUpdates request waits for new
+// messages when listening for replies
+const telegramPollTimeout = 25 * time.Second
+
+// Telegram sends messages to a Telegram chat through a bot. Only text
+// messages are sent unless all_ports is set. Sends are spaced to stay
+// within the configured rate, and a rate-limited send is retried once
+// after the delay Telegram asks for. Sent messages are remembered so a
+// reaction summary can be added to them later and, with replies set,
+// answers to them in the chat can be sent back to the mesh.
+type Telegram struct {
+	apiURL              string
+	token               string
+	chatID              string
+	parseMode           string
+	disableNotification bool
+	allPorts            bool
+	replies             bool
+	tmpl                *template.Template
+	enabled             bool
+
+	sender httpSender
+	// poll is the client for getUpdates, whose requests outlast the send
+	// timeout; offset is the ID of the next update to fetch
+	poll   *http.Client
+	offset int64
+
+	// interval is the minimum time between sends; next is when the next
+	// send may start
+	interval time.Duration
+	mu       sync.Mutex
+	next     time.Time
+
+	// sent maps recent packet IDs to the messages sent for them; sentOrder
+	// lists the packet IDs oldest first
+	sentMu    sync.Mutex
+	sent      map[uint32]*telegramSent
+	sentOrder []uint32
+}
+
+// telegramSent is a message sent to the chat, its text before any footer,
+// and where the packet it was sent for came from
+type telegramSent struct {
+	messageID int64
+	text      string
+	from      uint32
+	channel   uint32
+}
+
+// telegramMessage is the sendMessage request body
+type telegramMessage struct {
+	ChatID              string `json:"chat_id"`
+	MessageID           int64  `json:"message_id,omitempty"` // editMessageText only
+	Text                string `json:"text"`
+	ParseMode           string `json:"parse_mode,omitempty"`
+	DisableNotification bool   `json:"disable_notification,omitempty"`
+}
+
+// telegramResponse is the Bot API response envelope
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+	Result json.RawMessage `json:"result"`
+}
+
+// telegramSentMessage is the part of a sent message the output reads
+type telegramSentMessage struct {
+	MessageID int64 `json:"message_id"`
+}
+
+// telegramUpdate is an update returned by getUpdates. Only messages are
+// requested.
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Chat struct {
+			ID       int64  `json:"id"`
+			Username string `json:"username"`
+		} `json:"chat"`
+		From *struct {
+			FirstName string `json:"first_name"`
+			LastName  string `json:"last_name"`
+			Username  string `json:"username"`
+		} `json:"from"`
+		Text           string               `json:"text"`
+		ReplyToMessage *telegramSentMessage `json:"reply_to_message"`
+	} `json:"message"`
+}
+
+// NewTelegram creates a new Telegram output
+func NewTelegram(cfg config.OutputConfig) (*Telegram, error) {
+	t := &Telegram{
+		apiURL:  DefaultTelegramAPI,
+		enabled: cfg.Enabled,
+		sent:    make(map[uint32]*telegramSent),
+	}
+
+	t.token, _ = cfg.Options["bot_token"].(string)
+	if t.token == "" {
+		return nil, fmt.Errorf("telegram bot_token is required")
+	}
+	switch id := cfg.Options["chat_id"].(type) {
+	case string:
+		t.chatID = id
+	case int, int64, float64:
+		n, _ := IntOption(cfg.Options, "chat_id")
+		t.chatID = fmt.Sprintf("%d", n)
+	}
+	if t.chatID == "" {
+		return nil, fmt.Errorf("telegram chat_id is required")
+	}
+	if u, ok := cfg.Options["api_url"].(string); ok && u != "" {
+		t.apiURL = strings.TrimSuffix(u, "/")
+	}
+	t.parseMode, _ = cfg.Options["parse_mode"].(string)
+	switch t.parseMode {
+	case "", "HTML", "MarkdownV2":
+	default:
+		return nil, fmt.Errorf("telegram parse_mode must be HTML or MarkdownV2")
+	}
+	t.disableNotification, _ = cfg.Options["disable_notification"].(bool)
+	t.allPorts, _ = cfg.Options["all_ports"].(bool)
+	t.replies, _ = cfg.Options["replies"].(bool)
+
+	rate := DefaultTelegramRate
+	if n, ok := IntOption(cfg.Options, "rate_limit"); ok {
+		if n < 1 {
+			return nil, fmt.Errorf("telegram rate_limit must be at least 1")
+		}
+		rate = n
+	}
+	t.interval = time.Minute / time.Duration(rate)
+
+	tmpl, err := templateOption(cfg.Options, "template")
+	if err != nil {
+		return nil, err
+	}
+	t.tmpl = tmpl
+
+	timeout := 30 * time.Second
+	if v, ok := cfg.Options["timeout"].(string); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			timeout = d
+		}
+	}
+	if t.sender, err = newHTTPSender(cfg, timeout); err != nil {
+		return nil, err
+	}
+	t.poll = &http.Client{
+		Timeout:   telegramPollTimeout + timeout,
+		Transport: t.sender.client.Transport,
+	}
+
+	return t, nil
+}
+
+// Send posts the message to the chat, waiting for a free rate slot
+func (t *Telegram) Send(ctx context.Context, msg *message.Packet) error {
+	if t.skip(msg) {
+		return nil
+	}
+	text, err := t.text(msg)
+	if err != nil {
+		return err
+	}
+	data, err := t.body(text, 0)
+	if err != nil {
+		return err
+	}
+
+	result, err := t.call(ctx, "sendMessage", data)
+	if err != nil {
+		return err
+	}
+	var sent telegramSentMessage
+	if err := json.Unmarshal(result.Result, &sent); err == nil && msg.ID != 0 && sent.MessageID != 0 {
+		t.remember(msg.ID, &telegramSent{
+			messageID: sent.MessageID,
+			text:      text,
+			from:      msg.From,
+			channel:   msg.Channel,
+		})
+	}
+	return nil
+}
+
+// Edit replaces the footer of the message sent for packet id
+func (t *Telegram) Edit(ctx context.Context, id uint32, footer string) (bool, error) {
+	t.sentMu.Lock()
+	sent, ok := t.sent[id]
+	t.sentMu.Unlock()
+	if !ok {
+		return false, nil
+	}
+
+	// Keep the footer whole by shortening the message
+	text := []rune(sent.text)
+	if limit := max(telegramMaxText-len([]rune(footer))-2, 0); len(text) > limit {
+		text = text[:limit]
+	}
+	data, err := t.body(string(text)+"\n\n"+footer, sent.messageID)
+	if err != nil {
+		return true, err
+	}
+	_, err = t.call(ctx, "editMessageText", data)
+	return true, err
+}
+
+// Replies long-polls the bot's updates for answers in the chat to the
+// messages it sent, when replies is set. Updates are fetched with
+// getUpdates, so the bot must not have a webhook.
+func (t *Telegram) Replies(ctx context.Context, handle func(Reply)) error {
+	if !t.replies {
+		return nil
+	}
+	for {
+		data, err := json.Marshal(map[string]interface{}{
+			"offset":          t.offset,
+			"timeout":         int(telegramPollTimeout / time.Second),
+			"allowed_updates": []string{"message"},
+		})
+		if err != nil {
+			return err
+		}
+		result, _, err := t.post(ctx, t.poll, "getUpdates", data)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var updates []telegramUpdate
+		if err := json.Unmarshal(result.Result, &updates); err != nil {
+			return fmt.Errorf("invalid telegram updates: %w", err)
+		}
+		for _, u := range updates {
+			t.offset = u.UpdateID + 1
+			if r, ok := t.reply(u); ok {
+				handle(r)
+			}
+		}
+	}
+}
+
+// reply returns the answer an update carries, if it is a text message in
+// the chat replying to a remembered message
+func (t *Telegram) reply(u telegramUpdate) (Reply, bool) {
+	m := u.Message
+	if m == nil || m.Text == "" || m.ReplyToMessage == nil {
+		return Reply{}, false
+	}
+	if strconv.FormatInt(m.Chat.ID, 10) != t.chatID && "@"+m.Chat.Username != t.chatID {
+		return Reply{}, false
+	}
+
+	t.sentMu.Lock()
+	defer t.sentMu.Unlock()
+	for id, sent := range t.sent {
+		if sent.messageID != m.ReplyToMessage.MessageID {
+			continue
+		}
+		r := Reply{To: sent.from, Channel: sent.channel, ReplyID: id, Text: m.Text}
+		if m.From != nil {
+			r.Author = strings.TrimSpace(m.From.FirstName + " " + m.From.LastName)
+			if r.Author == "" {
+				r.Author = m.From.Username
+			}
+		}
+		return r, true
+	}
+	return Reply{}, false
+}
+
+// remember records the message sent for a packet, forgetting the oldest
+// beyond telegramMaxSent
+func (t *Telegram) remember(id uint32, sent *telegramSent) {
+	t.sentMu.Lock()
+	defer t.sentMu.Unlock()
+	if _, ok := t.sent[id]; !ok {
+		t.sentOrder = append(t.sentOrder, id)
+	}
+	t.sent[id] = sent
+	if len(t.sentOrder) > telegramMaxSent {
+		delete(t.sent, t.sentOrder[0])
+		t.sentOrder = t.sentOrder[1:]
+	}
+}
+
+// call makes a Bot API request in the next free rate slot. A rate-limited
+// request is retried once after the delay Telegram asks for.
+func (t *Telegram) call(ctx context.Context, method string, data []byte) (*telegramResponse, error) {
+	if err := t.wait(ctx); err != nil {
+		return nil, err
+	}
+	result, retryAfter, err := t.post(ctx, t.sender.client, method, data)
+	if retryAfter == 0 {
+		return result, err
+	}
+
+	// Rate limited by Telegram: back off as asked and try once more
+	t.delay(retryAfter)
+	if err := t.wait(ctx); err != nil {
+		return nil, err
+	}
+	result, _, err = t.post(ctx, t.sender.client, method, data)
+	return result, err
+}
+
+// post makes a Bot API request with client. It returns the delay Telegram
+// asks for when the request was rate limited.
+func (t *Telegram) post(ctx context.Context, client *http.Client, method string, data []byte) (*telegramResponse, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", t.apiURL+"/bot"+t.token+"/"+method, bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// The request URL carries the bot token
+		return nil, 0, fmt.Errorf("failed to send to telegram: %w", stripURL(err))
+	}
+	defer closeBody(resp)
+
+	var result telegramResponse
+	_ = json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode == http.StatusTooManyRequests && result.Parameters.RetryAfter > 0 {
+		return nil, time.Duration(result.Parameters.RetryAfter) * time.Second,
+			fmt.Errorf("telegram rate limited: %s", result.Description)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || !result.OK {
+		if result.Description != "" {
+			return nil, 0, fmt.Errorf("telegram returned status %d: %s", resp.StatusCode, result.Description)
+		}
+		return nil, 0, fmt.Errorf("telegram returned status %d", resp.StatusCode)
+	}
+	return &result, 0, nil
+}
+
+// wait blocks until the next send slot
+func (t *Telegram) wait(ctx context.Context) error {
+	t.mu.Lock()
+	now := time.Now()
+	start := t.next
+	if start.Before(now) {
+		start = now
+	}
+	t.next = start.Add(t.interval)
+	t.mu.Unlock()
+
+	if d := start.Sub(now); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// delay holds off all sends for d
+func (t *Telegram) delay(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until := time.Now().Add(d); until.After(t.next) {
+		t.next = until
+	}
+}
+
+// skip reports whether msg is not sent to Telegram
+func (t *Telegram) skip(msg *message.Packet) bool {
+	if t.allPorts {
+		return false
+	}
+	_, text := msg.Payload.(*message.TextMessage)
+	return !text
+}
+
+// body returns the sendMessage request body for text, or the
+// editMessageText body when messageID is set
+func (t *Telegram) body(text string, messageID int64) ([]byte, error) {
+	data, err := json.Marshal(telegramMessage{
+		ChatID:              t.chatID,
+		MessageID:           messageID,
+		Text:                text,
+		ParseMode:           t.parseMode,
+		DisableNotification: t.disableNotification,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal telegram message: %w", err)
+	}
+	return data, nil
+}
+
+// text renders the template if set, otherwise "<sender>: <text>"
+func (t *Telegram) text(msg *message.Packet) (string, error) {
+	var text string
+	if t.tmpl != nil {
+		var err error
+		if text, err = execute(t.tmpl, msg); err != nil {
+			return "", err
+		}
+	} else {
+		switch p := msg.Payload.(type) {
+		case *message.TextMessage:
+			text = fmt.Sprintf("%s: %s", nodeName(msg), p.Text)
+		default:
+			text = fmt.Sprintf("%s [%s] %v", nodeName(msg), msg.PortNum.String(), msg.Payload)
+		}
+	}
+	if r := []rune(text); len(r) > telegramMaxText {
+		text = string(r[:telegramMaxText])
+	}
+	return text, nil
+}
+
+// stripURL drops the request URL from a client error
+func stripURL(err error) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		return uerr.Err
+	}
+	return err
+}
+
+// Preview renders the request that would be sent
+func (t *Telegram) Preview(msg *message.Packet) (*Preview, error) {
+	p := &Preview{Target: t.Name(), Method: "POST"}
+	if t.skip(msg) {
+		p.Skipped = "not a text message (set all_ports to send every message)"
+		return p, nil
+	}
+	text, err := t.text(msg)
+	if err != nil {
+		return nil, err
+	}
+	data, err := t.body(text, 0)
+	if err != nil {
+		return nil, err
+	}
+	p.Body = string(data)
+	return p, nil
+}
+
+// Close releases pooled connections
+func (t *Telegram) Close() error {
+	t.sender.closeIdle()
+	return nil
+}
+
+// Name returns the output identifier, without the bot token
+func (t *Telegram) Name() string {
+	return fmt.Sprintf("telegram:%s", t.chatID)
+}
+
+// Enabled returns whether this output is enabled
+func (t *Telegram) Enabled() bool {
+	return t.enabled
+}
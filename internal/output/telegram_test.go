@@ -0,0 +1,169 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestTelegramSend(t *testing.T) {
+	var got []telegramMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bot123:abc/sendMessage" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		var m telegramMessage
+		_ = json.NewDecoder(r.Body).Decode(&m)
+		got = append(got, m)
+		// Rate limit the first request
+		if len(got) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"ok":false,"description":"Too Many Requests","parameters":{"retry_after":1}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	out, err := NewTelegram(config.OutputConfig{Type: "telegram", Options: map[string]interface{}{
+		"bot_token":  "123:abc",
+		"chat_id":    -1001234,
+		"api_url":    srv.URL,
+		"rate_limit": 6000,
+	}})
+	if err != nil {
+		t.Fatalf("NewTelegram: %v", err)
+	}
+
+	msg := &message.Packet{From: 0x1234abcd, PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: "hello"},
+		FromNode: &message.NodeInfo{User: &message.User{LongName: "Ridge"}}}
+	if err := out.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := out.Send(context.Background(), &message.Packet{Payload: &message.Position{}}); err != nil {
+		t.Fatalf("Send position: %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("got %d requests, want the rate-limited send retried once", len(got))
+	}
+	if got[1].ChatID != "-1001234" || got[1].Text != "Ridge: hello" {
+		t.Errorf("message = %+v", got[1])
+	}
+	if strings.Contains(out.Name(), "abc") {
+		t.Errorf("Name leaks bot token: %s", out.Name())
+	}
+}
+
+func TestTelegramOptions(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"chat_id": "1"},
+		{"bot_token": "t"},
+		{"bot_token": "t", "chat_id": "1", "parse_mode": "Markdown"},
+		{"bot_token": "t", "chat_id": "1", "rate_limit": 0},
+		{"bot_token": "t", "chat_id": "1", "template": "{{ .Bad"},
+	}
+	for _, opts := range tests {
+		if _, err := NewTelegram(config.OutputConfig{Options: opts}); err == nil {
+			t.Errorf("options %v accepted", opts)
+		}
+	}
+}
+
+func TestTelegramEdit(t *testing.T) {
+	var edits []telegramMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/editMessageText") {
+			var m telegramMessage
+			_ = json.NewDecoder(r.Body).Decode(&m)
+			edits = append(edits, m)
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":77}}`))
+	}))
+	defer srv.Close()
+
+	out, err := NewTelegram(config.OutputConfig{Type: "telegram", Options: map[string]interface{}{
+		"bot_token":  "123:abc",
+		"chat_id":    "42",
+		"api_url":    srv.URL,
+		"rate_limit": 6000,
+	}})
+	if err != nil {
+		t.Fatalf("NewTelegram: %v", err)
+	}
+
+	if known, _ := out.Edit(context.Background(), 9, "reactions: 👍x1"); known {
+		t.Error("Edit found a message that was never sent")
+	}
+	msg := &message.Packet{ID: 9, From: 0x1234abcd, Payload: &message.TextMessage{Text: "hello"}}
+	if err := out.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	for _, footer := range []string{"reactions: 👍x1", "reactions: 👍x2"} {
+		if known, err := out.Edit(context.Background(), 9, footer); !known || err != nil {
+			t.Fatalf("Edit = %v, %v", known, err)
+		}
+	}
+
+	if len(edits) != 2 {
+		t.Fatalf("got %d edits, want 2", len(edits))
+	}
+	if edits[1].MessageID != 77 || edits[1].Text != "!1234abcd: hello\n\nreactions: 👍x2" {
+		t.Errorf("edit = %+v", edits[1])
+	}
+}
+
+func TestTelegramReplies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/getUpdates") {
+			_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":77}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"result":[
+			{"update_id":10,"message":{"chat":{"id":42},"text":"unrelated"}},
+			{"update_id":11,"message":{"chat":{"id":7},"text":"other chat","reply_to_message":{"message_id":77}}},
+			{"update_id":12,"message":{"chat":{"id":42},"text":"wrong message","reply_to_message":{"message_id":5}}},
+			{"update_id":13,"message":{"chat":{"id":42},"from":{"first_name":"Ana","last_name":"Ruiz"},"text":"on our way","reply_to_message":{"message_id":77}}}
+		]}`))
+	}))
+	defer srv.Close()
+
+	out, err := NewTelegram(config.OutputConfig{Type: "telegram", Options: map[string]interface{}{
+		"bot_token":  "123:abc",
+		"chat_id":    "42",
+		"api_url":    srv.URL,
+		"rate_limit": 6000,
+		"replies":    true,
+	}})
+	if err != nil {
+		t.Fatalf("NewTelegram: %v", err)
+	}
+	msg := &message.Packet{ID: 9, From: 0x1234abcd, Channel: 2, Payload: &message.TextMessage{Text: "need water"}}
+	if err := out.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var replies []Reply
+	err = out.Replies(ctx, func(r Reply) {
+		replies = append(replies, r)
+		cancel()
+	})
+	if err != nil {
+		t.Fatalf("Replies: %v", err)
+	}
+
+	want := Reply{To: 0x1234abcd, Channel: 2, ReplyID: 9, Author: "Ana Ruiz", Text: "on our way"}
+	if len(replies) != 1 || replies[0] != want {
+		t.Errorf("replies = %+v, want %+v", replies, want)
+	}
+	if out.offset != 14 {
+		t.Errorf("offset = %d, want the next poll to confirm the updates", out.offset)
+	}
+}
@@ -0,0 +1,283 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/geo"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// portEmoji is shown by the emojiForPort template function
+var portEmoji = map[message.PortNum]string{
+	message.PortNumTextMessage:     "💬",
+	message.PortNumPosition:        "📍",
+	message.PortNumNodeInfo:        "👤",
+	message.PortNumRouting:         "🔀",
+	message.PortNumWaypoint:        "🚩",
+	message.PortNumDetectionSensor: "🚨",
+	message.PortNumPaxCounter:      "👥",
+	message.PortNumStoreForward:    "📦",
+	message.PortNumTelemetry:       "🔋",
+	message.PortNumTraceroute:      "🧭",
+	message.PortNumNeighborInfo:    "🕸",
+}
+
+// TemplateFuncs returns the functions available to output templates.
+// Templates are executed with the *message.Packet as data.
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"nodeName":      nodeName,
+		"hexID":         hexID,
+		"maplink":       maplink,
+		"round":         round,
+		"durationSince": durationSince,
+		"emojiForPort":  emojiForPort,
+		"jsonField":     jsonField,
+		"json":          toJSON,
+		"upper":         strings.ToUpper,
+		"lower":         strings.ToLower,
+		"trim":          strings.TrimSpace,
+		"replace":       replace,
+		"truncate":      truncate,
+		"default":       defaultValue,
+		"formatTime":    formatTime,
+	}
+}
+
+// parseTemplate parses an output template option with the helper functions
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(TemplateFuncs()).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// templateOption parses the template in the option key, or returns nil if
+// it is not set
+func templateOption(options map[string]interface{}, key string) (*template.Template, error) {
+	text, ok := options[key].(string)
+	if !ok || text == "" {
+		return nil, nil
+	}
+	return parseTemplate(key, text)
+}
+
+// execute renders tmpl for msg
+func execute(tmpl *template.Template, msg *message.Packet) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, msg); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", tmpl.Name(), err)
+	}
+	return b.String(), nil
+}
+
+// nodeName returns the long name of a packet's sender or a node, falling
+// back to the short name and then the node ID
+func nodeName(v interface{}) string {
+	var node *message.NodeInfo
+	var num uint32
+	switch v := v.(type) {
+	case *message.Packet:
+		node, num = v.FromNode, v.From
+	case *message.NodeInfo:
+		if v == nil {
+			return ""
+		}
+		node, num = v, v.Num
+	default:
+		return hexID(v)
+	}
+	if node != nil && node.User != nil {
+		if node.User.LongName != "" {
+			return node.User.LongName
+		}
+		if node.User.ShortName != "" {
+			return node.User.ShortName
+		}
+	}
+	return fmt.Sprintf("!%08x", num)
+}
+
+// hexID formats a node number as "!xxxxxxxx"
+func hexID(v interface{}) string {
+	n, ok := toUint32(v)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	return fmt.Sprintf("!%08x", n)
+}
+
+func toUint32(v interface{}) (uint32, bool) {
+	switch v := v.(type) {
+	case uint32:
+		return v, true
+	case int:
+		return uint32(v), true
+	case int32:
+		return uint32(v), true
+	case int64:
+		return uint32(v), true
+	case uint64:
+		return uint32(v), true
+	case uint:
+		return uint32(v), true
+	case float64:
+		return uint32(v), true
+	case string:
+		if n, err := message.ParseNodeID(v); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// maplink returns a link to a position, or to the position a packet
+// carries or its sender was last known at: the one positions.map_links
+// added, else OpenStreetMap. It returns an empty string when there is no
+// position.
+func maplink(v interface{}) string {
+	var pos *message.Position
+	switch v := v.(type) {
+	case *message.Position:
+		pos = v
+	case *message.Packet:
+		if p, ok := v.Payload.(*message.Position); ok {
+			pos = p
+		} else if v.FromNode != nil {
+			pos = v.FromNode.Position
+		}
+	case *message.NodeInfo:
+		if v != nil {
+			pos = v.Position
+		}
+	}
+	if pos == nil || pos.Latitude == 0 && pos.Longitude == 0 {
+		return ""
+	}
+	if pos.MapURL != "" {
+		return pos.MapURL
+	}
+	return geo.MapLink(config.MapLinksOSM, geo.Point{Lat: pos.Latitude, Lon: pos.Longitude})
+}
+
+// round rounds a number to the given decimal places
+func round(v interface{}, places int) float64 {
+	var f float64
+	switch v := v.(type) {
+	case float64:
+		f = v
+	case float32:
+		f = float64(v)
+	case int:
+		f = float64(v)
+	case int32:
+		f = float64(v)
+	case uint32:
+		f = float64(v)
+	default:
+		return 0
+	}
+	scale := math.Pow(10, float64(places))
+	return math.Round(f*scale) / scale
+}
+
+// durationSince returns the time elapsed since t, to the second
+func durationSince(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return time.Since(t).Round(time.Second).String()
+}
+
+// emojiForPort returns an emoji for a packet's or port's application type
+func emojiForPort(v interface{}) string {
+	var port message.PortNum
+	switch v := v.(type) {
+	case message.PortNum:
+		port = v
+	case *message.Packet:
+		port = v.PortNum
+	}
+	if e, ok := portEmoji[port]; ok {
+		return e
+	}
+	return "📡"
+}
+
+// toJSON returns v encoded as JSON, e.g. {"text": {{json .Text}}} to
+// quote a string inside a JSON body template
+func toJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// jsonField returns the value at a dotted path in v's JSON encoding, e.g.
+// {{jsonField . "payload.battery_level"}}. Missing fields give nil.
+func jsonField(v interface{}, path string) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			doc = node[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, nil
+			}
+			doc = node[i]
+		default:
+			return nil, nil
+		}
+	}
+	return doc, nil
+}
+
+// replace replaces every old in s with new, e.g. {{replace "\n" " " .Text}}
+func replace(old, new, s string) string {
+	return strings.ReplaceAll(s, old, new)
+}
+
+// truncate cuts s to n characters, ending it with "…" when cut
+func truncate(n int, s string) string {
+	r := []rune(s)
+	if n <= 0 || len(r) <= n {
+		return s
+	}
+	return strings.TrimRight(string(r[:n-1]), " ") + "…"
+}
+
+// defaultValue returns v, or def when v is empty, e.g.
+// {{default "(no text)" .Text}}
+func defaultValue(def, v interface{}) interface{} {
+	if v == nil {
+		return def
+	}
+	if s, ok := v.(string); ok && s == "" {
+		return def
+	}
+	return v
+}
+
+// formatTime formats t with a Go layout in local time, e.g.
+// {{formatTime "15:04" .ReceivedAt}}
+func formatTime(layout string, t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(layout)
+}
@@ -0,0 +1,80 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	msg := &message.Packet{
+		From:    0x1234abcd,
+		PortNum: message.PortNumPosition,
+		Payload: &message.Position{Latitude: 45.51523, Longitude: -122.67841, Distance: 1234.5},
+		FromNode: &message.NodeInfo{
+			Num:  0x1234abcd,
+			User: &message.User{LongName: "Base Camp", ShortName: "BC"},
+		},
+	}
+
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{`{{nodeName .}}`, "Base Camp"},
+		{`{{hexID .From}}`, "!1234abcd"},
+		{`{{emojiForPort .}} {{emojiForPort .PortNum}}`, "📍 📍"},
+		{`{{round .Payload.Distance 0}}`, "1235"},
+		{`{{jsonField . "payload.latitude"}}`, "45.51523"},
+		{`{{jsonField . "payload.missing"}}`, "<no value>"},
+		{`{{maplink .}}`, "https://www.openstreetmap.org/?mlat=45.51523&mlon=-122.67841#map=15/45.51523/-122.67841"},
+		{`{{durationSince .ReceivedAt}}`, ""},
+		{`{{.FromName}} {{.FromID}}`, "Base Camp !1234abcd"},
+		{`{{default "(no text)" .Text | upper}}`, "(NO TEXT)"},
+		{`{{truncate 6 "Base Camp here"}} {{replace " " "_" "a b"}}`, "Base… a_b"},
+	}
+	for _, tt := range tests {
+		tmpl, err := parseTemplate("template", tt.tmpl)
+		if err != nil {
+			t.Fatalf("parse %s: %v", tt.tmpl, err)
+		}
+		got, err := execute(tmpl, msg)
+		if err != nil {
+			t.Fatalf("execute %s: %v", tt.tmpl, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+
+	if got := nodeName(&message.Packet{From: 7}); got != "!00000007" {
+		t.Errorf("nodeName without user = %q", got)
+	}
+}
+
+func TestAppriseTemplates(t *testing.T) {
+	out, err := NewApprise(config.OutputConfig{Type: "apprise", Options: map[string]interface{}{
+		"url":            "http://apprise:8000/notify",
+		"title_template": "{{emojiForPort .}} {{nodeName .}}",
+		"body_template":  "{{.Payload.Text}}",
+	}})
+	if err != nil {
+		t.Fatalf("NewApprise: %v", err)
+	}
+	p, err := out.Preview(&message.Packet{From: 1, PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: "hello"}})
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	want := `{"body":"hello","title":"💬 !00000001","type":"info","tag":"meshtastic"}`
+	if p.Body != want {
+		t.Errorf("body = %s, want %s", p.Body, want)
+	}
+
+	if _, err := NewWebhook(config.OutputConfig{Type: "webhook", Options: map[string]interface{}{
+		"url":           "http://example.com",
+		"body_template": "{{nodeName .",
+	}}); err == nil {
+		t.Error("invalid template accepted")
+	}
+}
@@ -0,0 +1,82 @@
+package output
+
+import (
+	"context"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/transform"
+)
+
+// Transformed applies packet transforms before delegating to an output.
+// Wrapping happens in New, so transforms such as the public feed
+// allowlist hold for every output type and template.
+type Transformed struct {
+	Output
+	chain transform.Chain
+}
+
+// withTransforms wraps out if its options configure any transforms
+func withTransforms(cfg config.OutputConfig, out Output) (Output, error) {
+	chain, err := transform.FromOptions(cfg.Options)
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		return out, nil
+	}
+	return &Transformed{Output: out, chain: chain}, nil
+}
+
+// Send transforms msg and forwards it, unless a transform drops it
+func (t *Transformed) Send(ctx context.Context, msg *message.Packet) error {
+	if msg = t.chain.Apply(msg); msg == nil {
+		return nil
+	}
+	return t.Output.Send(ctx, msg)
+}
+
+// MaxInFlight passes through the wrapped output's concurrency
+func (t *Transformed) MaxInFlight() int {
+	if c, ok := t.Output.(Concurrent); ok {
+		return c.MaxInFlight()
+	}
+	return 1
+}
+
+// Publish passes events through to the wrapped output untransformed
+func (t *Transformed) Publish(event string, data interface{}) error {
+	if p, ok := t.Output.(Publisher); ok {
+		return p.Publish(event, data)
+	}
+	return nil
+}
+
+// Edit passes edits through to the wrapped output. Outputs that cannot
+// edit report the message as unknown.
+func (t *Transformed) Edit(ctx context.Context, id uint32, footer string) (bool, error) {
+	if e, ok := t.Output.(Editor); ok {
+		return e.Edit(ctx, id, footer)
+	}
+	return false, nil
+}
+
+// Replies passes through the wrapped output's replies, untransformed
+func (t *Transformed) Replies(ctx context.Context, handle func(Reply)) error {
+	if r, ok := t.Output.(Replier); ok {
+		return r.Replies(ctx, handle)
+	}
+	return nil
+}
+
+// Preview renders the transformed message with the wrapped output
+func (t *Transformed) Preview(msg *message.Packet) (*Preview, error) {
+	p, ok := t.Output.(Previewer)
+	if !ok {
+		return nil, errNoPreview(t.Output)
+	}
+	if msg = t.chain.Apply(msg); msg == nil {
+		return &Preview{Target: t.Name(), Skipped: "dropped by transform"}, nil
+	}
+	return p.Preview(msg)
+}
@@ -3,9 +3,9 @@ package output
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
+	"text/template"
 	"time"
 
 	"github.com/iamruinous/meshtastic-message-relay/internal/config"
@@ -18,8 +18,9 @@ type Webhook struct {
 	method  string
 	timeout time.Duration
 	headers map[string]string
+	tmpl    *template.Template // request body instead of the JSON packet
 	enabled bool
-	client  *http.Client
+	httpSender
 }
 
 // NewWebhook creates a new webhook output
@@ -53,23 +54,32 @@ func NewWebhook(cfg config.OutputConfig) (*Webhook, error) {
 		}
 	}
 
+	tmpl, err := templateOption(cfg.Options, "body_template")
+	if err != nil {
+		return nil, err
+	}
+
+	sender, err := newHTTPSender(cfg, timeout)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Webhook{
-		url:     url,
-		method:  method,
-		timeout: timeout,
-		headers: headers,
-		enabled: cfg.Enabled,
-		client: &http.Client{
-			Timeout: timeout,
-		},
+		url:        url,
+		method:     method,
+		timeout:    timeout,
+		headers:    headers,
+		tmpl:       tmpl,
+		enabled:    cfg.Enabled,
+		httpSender: sender,
 	}, nil
 }
 
 // Send sends a message to the webhook
 func (w *Webhook) Send(ctx context.Context, msg *message.Packet) error {
-	data, err := json.Marshal(msg)
+	data, err := w.body(render(ctx, msg))
 	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
+		return err
 	}
 
 	req, err := http.NewRequestWithContext(ctx, w.method, w.url, bytes.NewReader(data))
@@ -86,27 +96,42 @@ func (w *Webhook) Send(ctx context.Context, msg *message.Packet) error {
 		req.Header.Set(k, v)
 	}
 
-	resp, err := w.client.Do(req)
+	return w.do(req, "webhook")
+}
+
+// Preview renders the request that would be sent
+func (w *Webhook) Preview(msg *message.Packet) (*Preview, error) {
+	data, err := w.body(NewRender(msg))
 	if err != nil {
-		return fmt.Errorf("failed to send to webhook: %w", err)
+		return nil, err
 	}
-	defer func() { _ = resp.Body.Close() }()
+	return &Preview{
+		Target:  MaskURL(w.url),
+		Method:  w.method,
+		Headers: maskHeaders(w.headers),
+		Body:    string(data),
+	}, nil
+}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+// body returns the request body: the body template if set, otherwise the
+// packet as JSON
+func (w *Webhook) body(r *Render) ([]byte, error) {
+	if w.tmpl == nil {
+		return r.JSON()
 	}
-
-	return nil
+	body, err := execute(w.tmpl, r.msg)
+	return []byte(body), err
 }
 
 // Close closes the webhook output
 func (w *Webhook) Close() error {
+	w.closeIdle()
 	return nil
 }
 
 // Name returns the output identifier
 func (w *Webhook) Name() string {
-	return fmt.Sprintf("webhook:%s", w.url)
+	return fmt.Sprintf("webhook:%s", MaskURL(w.url))
 }
 
 // Enabled returns whether this output is enabled
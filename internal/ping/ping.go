@@ -0,0 +1,156 @@
+// Package ping measures round-trip latency to a mesh node using
+// want_ack packets.
+package ping
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// Result is the outcome of a single probe
+type Result struct {
+	// Seq numbers probes from 1
+	Seq int
+	// RTT is the time until the destination's ack arrived
+	RTT time.Duration
+	// Hops is how many times the ack was relayed, or -1 when unknown
+	Hops int
+	// Err is set when the probe was not acknowledged
+	Err error
+}
+
+// Pinger sends probes to a single node
+type Pinger struct {
+	conn connection.AckTransport
+
+	// To is the destination node number
+	To uint32
+	// Channel is the channel index to send on
+	Channel uint32
+	// Port is the application port; REPLY_APP avoids showing probes as chat
+	Port message.PortNum
+	// Text is the probe payload
+	Text string
+	// Timeout bounds each probe
+	Timeout time.Duration
+}
+
+// New creates a pinger with REPLY_APP probes
+func New(conn connection.AckTransport, to uint32) *Pinger {
+	return &Pinger{
+		conn:    conn,
+		To:      to,
+		Port:    message.PortNumReply,
+		Text:    "ping",
+		Timeout: 30 * time.Second,
+	}
+}
+
+// Ping sends one probe and waits for its ack
+func (p *Pinger) Ping(ctx context.Context, seq int) Result {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	text := p.Text
+	if p.Port == message.PortNumTextMessage {
+		text = fmt.Sprintf("%s %d", p.Text, seq)
+	}
+
+	start := time.Now()
+	ack, err := p.conn.SendAndWaitAck(ctx, &message.Packet{
+		To:      p.To,
+		Channel: p.Channel,
+		PortNum: p.Port,
+		Payload: &message.TextMessage{Text: text},
+	})
+	r := Result{Seq: seq, RTT: time.Since(start), Hops: -1, Err: err}
+	if err == nil {
+		r.Hops = ack.Hops
+	}
+	return r
+}
+
+// Run sends count probes spaced by interval, calling fn after each. It
+// stops early when ctx ends.
+func (p *Pinger) Run(ctx context.Context, count int, interval time.Duration, fn func(Result)) []Result {
+	results := make([]Result, 0, count)
+	for seq := 1; seq <= count; seq++ {
+		if seq > 1 {
+			select {
+			case <-ctx.Done():
+				return results
+			case <-time.After(interval):
+			}
+		}
+
+		r := p.Ping(ctx, seq)
+		if ctx.Err() != nil {
+			// Interrupted, not lost
+			return results
+		}
+		results = append(results, r)
+		if fn != nil {
+			fn(r)
+		}
+	}
+	return results
+}
+
+// Stats summarizes a series of probes
+type Stats struct {
+	Sent     int
+	Received int
+	Min      time.Duration
+	Avg      time.Duration
+	Max      time.Duration
+	StdDev   time.Duration
+}
+
+// Loss returns the fraction of probes that were not acknowledged
+func (s Stats) Loss() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return float64(s.Sent-s.Received) / float64(s.Sent)
+}
+
+// Summarize computes statistics over results. Latency figures only cover
+// acknowledged probes.
+func Summarize(results []Result) Stats {
+	s := Stats{Sent: len(results)}
+
+	var sum float64
+	for _, r := range results {
+		if r.Err != nil {
+			continue
+		}
+		if s.Received == 0 || r.RTT < s.Min {
+			s.Min = r.RTT
+		}
+		if r.RTT > s.Max {
+			s.Max = r.RTT
+		}
+		s.Received++
+		sum += float64(r.RTT)
+	}
+	if s.Received == 0 {
+		return s
+	}
+
+	mean := sum / float64(s.Received)
+	var variance float64
+	for _, r := range results {
+		if r.Err == nil {
+			d := float64(r.RTT) - mean
+			variance += d * d
+		}
+	}
+	s.Avg = time.Duration(mean)
+	s.StdDev = time.Duration(math.Sqrt(variance / float64(s.Received)))
+	return s
+}
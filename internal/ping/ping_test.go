@@ -0,0 +1,74 @@
+package ping
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestSummarize(t *testing.T) {
+	results := []Result{
+		{Seq: 1, RTT: 2 * time.Second},
+		{Seq: 2, RTT: 30 * time.Second, Err: errors.New("timeout")},
+		{Seq: 3, RTT: 4 * time.Second},
+		{Seq: 4, RTT: 6 * time.Second},
+	}
+
+	s := Summarize(results)
+	if s.Sent != 4 || s.Received != 3 {
+		t.Errorf("Sent/Received = %d/%d, want 4/3", s.Sent, s.Received)
+	}
+	if s.Loss() != 0.25 {
+		t.Errorf("Loss = %v, want 0.25", s.Loss())
+	}
+	if s.Min != 2*time.Second || s.Max != 6*time.Second || s.Avg != 4*time.Second {
+		t.Errorf("min/avg/max = %v/%v/%v", s.Min, s.Avg, s.Max)
+	}
+	// Population stddev of 2, 4, 6
+	if want := time.Duration(1632993161); s.StdDev < want-time.Millisecond || s.StdDev > want+time.Millisecond {
+		t.Errorf("StdDev = %v, want ~%v", s.StdDev, want)
+	}
+}
+
+func TestSummarizeAllLost(t *testing.T) {
+	s := Summarize([]Result{{Seq: 1, Err: errors.New("timeout")}})
+	if s.Received != 0 || s.Loss() != 1 || s.Avg != 0 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+	if (Stats{}).Loss() != 0 {
+		t.Error("Loss of no probes should be 0")
+	}
+}
+
+// ackTransport acks every probe with a fixed hop count
+type ackTransport struct {
+	hops int
+	err  error
+	sent []*message.Packet
+}
+
+func (a *ackTransport) SendAndWaitAck(_ context.Context, p *message.Packet) (connection.Ack, error) {
+	a.sent = append(a.sent, p)
+	return connection.Ack{Hops: a.hops}, a.err
+}
+
+func TestPingHops(t *testing.T) {
+	conn := &ackTransport{hops: 2}
+	p := New(conn, 0x1234abcd)
+	results := p.Run(context.Background(), 2, 0, nil)
+	if len(results) != 2 || results[0].Hops != 2 || results[1].Err != nil {
+		t.Errorf("results = %+v", results)
+	}
+	if len(conn.sent) != 2 || conn.sent[0].To != 0x1234abcd || conn.sent[0].PortNum != message.PortNumReply {
+		t.Errorf("sent = %+v", conn.sent)
+	}
+
+	conn.err = errors.New("timeout")
+	if r := p.Ping(context.Background(), 3); r.Hops != -1 {
+		t.Errorf("lost probe hops = %d, want -1", r.Hops)
+	}
+}
@@ -0,0 +1,184 @@
+// Package proxy dials outbound connections through SOCKS5 and HTTP CONNECT
+// proxies, for relays running inside restricted networks.
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	xproxy "golang.org/x/net/proxy"
+)
+
+// Dial connects to addr through the proxy at u, or directly when u is nil
+func Dial(ctx context.Context, u *url.URL, addr string) (net.Conn, error) {
+	direct := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if u == nil {
+		return direct.DialContext(ctx, "tcp", addr)
+	}
+
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		var auth *xproxy.Auth
+		if u.User != nil {
+			pass, _ := u.User.Password()
+			auth = &xproxy.Auth{User: u.User.Username(), Password: pass}
+		}
+		d, err := xproxy.SOCKS5("tcp", u.Host, auth, direct)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := d.(xproxy.ContextDialer).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("socks5 proxy %s: %w", u.Host, err)
+		}
+		return conn, nil
+	case "http", "https":
+		return connect(ctx, u, direct, addr)
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme %s", u.Scheme)
+}
+
+// connect opens a tunnel to addr with an HTTP CONNECT request
+func connect(ctx context.Context, u *url.URL, direct *net.Dialer, addr string) (net.Conn, error) {
+	conn, err := direct.DialContext(ctx, "tcp", hostPort(u))
+	if err != nil {
+		return nil, fmt.Errorf("http proxy %s: %w", u.Host, err)
+	}
+	if u.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("http proxy %s: %w", u.Host, err)
+		}
+		conn = tlsConn
+	}
+
+	// Bound the handshake by the context, then clear the deadline for
+	// the tunneled connection
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		creds := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + pass))
+		req.Header.Set("Proxy-Authorization", "Basic "+creds)
+	}
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("http proxy %s: %w", u.Host, err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("http proxy %s: %w", u.Host, err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("http proxy %s refused the tunnel: %s", u.Host, resp.Status)
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// hostPort returns the proxy address with the scheme's default port
+func hostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// bufferedConn reads what the proxy sent after its response before the
+// rest of the connection
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// HTTP returns the proxy function for an http.Transport: the proxy at u,
+// or none when u is nil
+func HTTP(u *url.URL) func(*http.Request) (*url.URL, error) {
+	if u == nil {
+		return nil
+	}
+	return http.ProxyURL(u)
+}
+
+// MQTT returns a paho connection function that reaches the broker through
+// the proxy at u, or directly when u is nil, instead of through the proxy
+// environment variables. Websocket brokers are dialed through the proxy by
+// the websocket client.
+func MQTT(u *url.URL) mqtt.OpenConnectionFunc {
+	return func(uri *url.URL, o mqtt.ClientOptions) (net.Conn, error) {
+		ctx := context.Background()
+		if o.ConnectTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, o.ConnectTimeout)
+			defer cancel()
+		}
+
+		switch uri.Scheme {
+		case "ws", "wss":
+			wsOpts := &mqtt.WebsocketOptions{}
+			if o.WebsocketOptions != nil {
+				*wsOpts = *o.WebsocketOptions
+			}
+			wsOpts.Proxy = func(*http.Request) (*url.URL, error) { return u, nil }
+			var tlsCfg *tls.Config
+			if uri.Scheme == "wss" {
+				tlsCfg = o.TLSConfig
+			}
+			dialURI := *uri
+			dialURI.User = nil
+			return mqtt.NewWebsocket(dialURI.String(), tlsCfg, o.ConnectTimeout, o.HTTPHeaders, wsOpts)
+		case "mqtt", "tcp":
+			return Dial(ctx, u, uri.Host)
+		case "ssl", "tls", "mqtts", "mqtt+ssl", "tcps":
+			conn, err := Dial(ctx, u, uri.Host)
+			if err != nil {
+				return nil, err
+			}
+			tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+			if o.TLSConfig != nil {
+				tlsCfg = o.TLSConfig.Clone()
+			}
+			if tlsCfg.ServerName == "" {
+				tlsCfg.ServerName = uri.Hostname()
+			}
+			tlsConn := tls.Client(conn, tlsCfg)
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+			return tlsConn, nil
+		}
+		return nil, fmt.Errorf("mqtt scheme %s is not supported with a proxy", uri.Scheme)
+	}
+}
@@ -0,0 +1,184 @@
+// Package reactions tallies emoji reactions to earlier messages, so outputs
+// can show a summary on the original message or in a periodic digest
+// instead of one notification per reaction.
+package reactions
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// maxTracked is the most messages whose reactions are tallied; the oldest
+// are forgotten beyond it
+const maxTracked = 1000
+
+// maxQuote bounds how much of the original text a digest line quotes
+const maxQuote = 40
+
+// Count is how many nodes reacted with an emoji
+type Count struct {
+	Emoji string
+	N     int
+}
+
+// Summary is the reactions to one message
+type Summary struct {
+	// ID is the packet ID of the original message
+	ID uint32
+	// Original is the original message, or nil if the relay did not see it
+	Original *message.Packet
+	// Counts are in the order each emoji was first used
+	Counts []Count
+}
+
+// String renders the summary as "reactions: 👍x3 ❤️x1"
+func (s *Summary) String() string {
+	parts := make([]string, len(s.Counts))
+	for i, c := range s.Counts {
+		parts[i] = fmt.Sprintf("%sx%d", c.Emoji, c.N)
+	}
+	return "reactions: " + strings.Join(parts, " ")
+}
+
+// Tracker remembers recent messages and the reactions to them. It is safe
+// for concurrent use.
+type Tracker struct {
+	mu       sync.Mutex
+	messages map[uint32]*tally
+	order    []uint32 // message IDs, oldest first
+	pending  []uint32 // messages with reactions since the last digest
+}
+
+// tally is a message and who reacted to it with each emoji
+type tally struct {
+	packet   *message.Packet
+	emoji    []string
+	reactors map[string]map[uint32]bool
+	pending  bool
+}
+
+// New creates an empty tracker
+func New() *Tracker {
+	return &Tracker{messages: make(map[uint32]*tally)}
+}
+
+// Observe records a received packet. Text messages are remembered as
+// possible originals. For a reaction it returns the updated summary of the
+// message reacted to; a node reacting again with the same emoji is counted
+// once.
+func (t *Tracker) Observe(p *message.Packet) *Summary {
+	text, ok := p.Payload.(*message.TextMessage)
+	if !ok {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !text.IsReaction() {
+		if p.ID != 0 {
+			if m := t.message(p.ID); m.packet == nil {
+				m.packet = p
+			}
+		}
+		return nil
+	}
+
+	m := t.message(text.ReplyID)
+	emoji := strings.TrimSpace(text.Text)
+	if m.reactors[emoji] == nil {
+		m.reactors[emoji] = make(map[uint32]bool)
+		m.emoji = append(m.emoji, emoji)
+	}
+	m.reactors[emoji][p.From] = true
+	if !m.pending {
+		m.pending = true
+		t.pending = append(t.pending, text.ReplyID)
+	}
+	return m.summary(text.ReplyID)
+}
+
+// message returns the tally for id, creating it if needed
+func (t *Tracker) message(id uint32) *tally {
+	if m, ok := t.messages[id]; ok {
+		return m
+	}
+	m := &tally{reactors: make(map[string]map[uint32]bool)}
+	t.messages[id] = m
+	t.order = append(t.order, id)
+	if len(t.order) > maxTracked {
+		delete(t.messages, t.order[0])
+		t.order = t.order[1:]
+	}
+	return m
+}
+
+func (m *tally) summary(id uint32) *Summary {
+	s := &Summary{ID: id, Original: m.packet}
+	for _, e := range m.emoji {
+		s.Counts = append(s.Counts, Count{Emoji: e, N: len(m.reactors[e])})
+	}
+	return s
+}
+
+// Digest returns the summaries of messages reacted to since the last
+// digest, oldest reaction first
+func (t *Tracker) Digest() []*Summary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var digest []*Summary
+	for _, id := range t.pending {
+		m, ok := t.messages[id]
+		if !ok {
+			continue
+		}
+		m.pending = false
+		digest = append(digest, m.summary(id))
+	}
+	t.pending = nil
+	return digest
+}
+
+// Text renders a digest as a single notification, one line per message
+func Text(digest []*Summary) string {
+	lines := []string{"Reactions since the last digest:"}
+	for _, s := range digest {
+		lines = append(lines, fmt.Sprintf("%s: %s", quote(s), s))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Packet wraps a digest as a text packet so it can be sent to outputs like
+// any received message
+func Packet(digest []*Summary, now time.Time) *message.Packet {
+	return &message.Packet{
+		PortNum:    message.PortNumTextMessage,
+		Payload:    &message.TextMessage{Text: Text(digest)},
+		ReceivedAt: now,
+	}
+}
+
+// quote describes the original message: its sender and the start of its
+// text
+func quote(s *Summary) string {
+	if s.Original == nil {
+		return fmt.Sprintf("message %08x", s.ID)
+	}
+	sender := fmt.Sprintf("!%08x", s.Original.From)
+	if n := s.Original.FromNode; n != nil && n.User != nil && n.User.ShortName != "" {
+		sender = n.User.ShortName
+	}
+	text := ""
+	if t, ok := s.Original.Payload.(*message.TextMessage); ok {
+		text = t.Text
+	}
+	if r := []rune(text); len(r) > maxQuote {
+		text = string(r[:maxQuote-3]) + "..."
+	}
+	return fmt.Sprintf("%s %q", sender, text)
+}
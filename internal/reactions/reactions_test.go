@@ -0,0 +1,55 @@
+package reactions
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func react(from, replyID uint32, emoji string) *message.Packet {
+	return &message.Packet{From: from, PortNum: message.PortNumTextMessage,
+		Payload: &message.TextMessage{Text: emoji, ReplyID: replyID, Emoji: true}}
+}
+
+func TestTrackerObserve(t *testing.T) {
+	tr := New()
+	original := &message.Packet{ID: 42, From: 1, PortNum: message.PortNumTextMessage,
+		Payload:  &message.TextMessage{Text: "trailhead parking is full"},
+		FromNode: &message.NodeInfo{User: &message.User{ShortName: "RDG"}}}
+	if s := tr.Observe(original); s != nil {
+		t.Fatalf("original returned summary %v", s)
+	}
+
+	tr.Observe(react(2, 42, "👍"))
+	tr.Observe(react(3, 42, "❤️"))
+	tr.Observe(react(4, 42, "👍"))
+	s := tr.Observe(react(2, 42, "👍")) // the same node again
+	if s.Original != original {
+		t.Errorf("original not matched")
+	}
+	if got := s.String(); got != "reactions: 👍x2 ❤️x1" {
+		t.Errorf("summary = %q", got)
+	}
+
+	// A reply without the emoji flag is a plain message
+	reply := &message.Packet{ID: 43, From: 2, Payload: &message.TextMessage{Text: "thanks", ReplyID: 42}}
+	if s := tr.Observe(reply); s != nil {
+		t.Errorf("reply returned summary %v", s)
+	}
+
+	tr.Observe(react(5, 7, "😂"))
+	digest := tr.Digest()
+	if len(digest) != 2 {
+		t.Fatalf("digest has %d messages, want 2", len(digest))
+	}
+	text := Text(digest)
+	for _, want := range []string{`RDG "trailhead parking is full": reactions: 👍x2 ❤️x1`, "message 00000007: reactions: 😂x1"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("digest missing %q:\n%s", want, text)
+		}
+	}
+	if digest := tr.Digest(); len(digest) != 0 {
+		t.Errorf("second digest has %d messages, want 0", len(digest))
+	}
+}
@@ -0,0 +1,69 @@
+package relay
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/output"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic/simulator"
+)
+
+// BenchmarkRelayPath covers parse, filter, serialization and sending for
+// three JSON file outputs, the path every received packet takes. Each
+// iteration waits for the output workers, so their work is timed and the
+// queues never fill.
+func BenchmarkRelayPath(b *testing.B) {
+	text := simulator.EncodeFromRadio(1, simulator.EncodeMeshPacket(
+		0x12345678, meshtastic.BroadcastAddr, 0, 0xdeadbeef,
+		simulator.EncodeData(uint32(meshtastic.PortNumTextMessageApp), []byte("Checking in from the ridge, all good here")),
+		1700000000, 6.25, -97, 3), nil, nil, 0)
+
+	cfg := &config.Config{
+		Filters: config.FilterConfig{
+			MessageTypes: []string{"TEXT_MESSAGE_APP", "POSITION_APP"},
+		},
+	}
+	s, err := New(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	dir := b.TempDir()
+	for _, name := range []string{"a.log", "b.log", "c.log"} {
+		outCfg := config.OutputConfig{
+			Type:    "file",
+			Enabled: true,
+			Options: map[string]interface{}{"path": filepath.Join(dir, name), "rotate": false},
+		}
+		out, err := output.New(outCfg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		k := newSink(outCfg, out)
+		s.startSink(k)
+		s.outputs = append(s.outputs, k)
+	}
+	defer s.closeOutputs()
+
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		fr, err := meshtastic.ParseFromRadio(text)
+		if err != nil {
+			b.Fatal(err)
+		}
+		msg := message.FromMeshtasticPacket(fr.ToPacket())
+		if !s.ShouldRelay(msg) {
+			b.Fatal("packet filtered")
+		}
+		s.sendToOutputs(ctx, msg)
+		waitOutputs(s)
+	}
+	b.StopTimer()
+	if stats := s.GetStats(); stats.MessagesSent != uint64(3*b.N) || stats.QueueDrops != 0 {
+		b.Fatalf("sent %d messages and dropped %d, want %d sent", stats.MessagesSent, stats.QueueDrops, 3*b.N)
+	}
+}
@@ -0,0 +1,119 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/canary"
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/output"
+)
+
+// ErrCanariesDisabled is returned when injecting a canary with
+// canary.enabled unset
+var ErrCanariesDisabled = errors.New("canaries are disabled")
+
+// acceptsCanary reads an output's canary option; outputs take canaries
+// unless it is false
+func acceptsCanary(cfg config.OutputConfig) bool {
+	accept, ok := cfg.Options["canary"].(bool)
+	return !ok || accept
+}
+
+// Canaries returns the canary tracker (nil when canaries are disabled)
+func (s *Service) Canaries() *canary.Tracker {
+	return s.canaries
+}
+
+// InjectCanary passes a new canary through the relay as if the connection
+// had received it and returns its ID. Wait on the tracker for its result.
+func (s *Service) InjectCanary() (uint32, error) {
+	if s.canaries == nil {
+		return 0, ErrCanariesDisabled
+	}
+	if !s.IsRunning() {
+		return 0, fmt.Errorf("service is not running")
+	}
+	p := s.canaries.Start(time.Now())
+	select {
+	case s.injected <- p:
+	default:
+		// The canary times out as undelivered, which is what happened
+		s.logger.Warn("Relay loop busy; canary dropped", zap.Uint32("id", p.ID))
+	}
+	return p.ID, nil
+}
+
+// runCanaries injects a canary every canary.interval until ctx is done
+func (s *Service) runCanaries(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Canary.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.InjectCanary(); err != nil {
+				s.logger.Debug("Failed to inject canary", zap.Error(err))
+			}
+		}
+	}
+}
+
+// dispatchCanary queues a canary for every output that takes canaries.
+// Canaries skip the filters, routes, and low-power batching so their
+// latency reflects the outputs alone.
+func (s *Service) dispatchCanary(ctx context.Context, msg *message.Packet) {
+	s.stamp(msg)
+	ctx = output.WithRender(ctx, output.NewRender(msg))
+
+	s.dispatch.RLock()
+	for _, k := range s.outputs {
+		if !k.canary {
+			continue
+		}
+		s.canaries.Queued(msg.ID, k.out.Name())
+		s.enqueue(ctx, k, msg)
+	}
+	s.dispatch.RUnlock()
+	s.canaries.Dispatched(msg.ID)
+}
+
+// canaryDelivered reports an output's handling of msg if it is a canary
+func (s *Service) canaryDelivered(k *sink, msg *message.Packet, err error) {
+	if msg.Canary && s.canaries != nil {
+		s.canaries.Delivered(msg.ID, k.out.Name(), err, time.Now())
+	}
+}
+
+// canaryCompleted logs a completed canary and raises or clears the canary
+// alert as the relay's health changes
+func (s *Service) canaryCompleted(res canary.Result, h canary.Health) {
+	if res.Degraded {
+		s.logger.Warn("Canary degraded",
+			zap.Uint32("id", res.ID),
+			zap.String("reason", res.Reason),
+			zap.Duration("latency", res.Latency),
+			zap.Int("failing", h.Failing))
+	} else {
+		s.logger.Debug("Canary delivered",
+			zap.Uint32("id", res.ID),
+			zap.Duration("latency", res.Latency),
+			zap.Int("outputs", len(res.Deliveries)))
+	}
+	s.publish("canary", res)
+
+	if engine := s.Alerts(); engine != nil {
+		text := ""
+		if h.Degraded {
+			text = fmt.Sprintf("End-to-end delivery degraded: %s (%d canaries in a row)", res.Reason, h.Failing)
+		}
+		engine.Canary(text, time.Now())
+	}
+}
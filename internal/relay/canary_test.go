@@ -0,0 +1,61 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+)
+
+func TestCanaryDelivery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	skipped := fileOutput(dir, "skipped.log", "text")
+	skipped.Options["canary"] = false
+	cfg := &config.Config{
+		Canary: config.CanaryConfig{Enabled: true, Text: "canary", Timeout: 5 * time.Second, Failures: 1, History: 10},
+		// Filters and routes do not apply to canaries
+		Filters: config.FilterConfig{MessageTypes: []string{"POSITION_APP"}},
+		Outputs: []config.OutputConfig{
+			fileOutput(dir, "all.log", "json"),
+			{Type: "webhook", Enabled: true, Options: map[string]interface{}{"url": srv.URL}},
+			skipped,
+		},
+	}
+	s := startOutputs(t, cfg)
+
+	p := s.canaries.Start(time.Now())
+	s.dispatchCanary(context.Background(), p)
+	res, err := s.canaries.Wait(context.Background(), p.ID)
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+
+	if len(res.Deliveries) != 2 {
+		t.Fatalf("deliveries = %+v, want the file and webhook outputs", res.Deliveries)
+	}
+	var failed int
+	for _, d := range res.Deliveries {
+		if d.Error != "" {
+			failed++
+		}
+	}
+	if failed != 1 || !res.Degraded || !s.canaries.Health().Degraded {
+		t.Errorf("result = %+v", res)
+	}
+}
+
+func TestInjectCanaryDisabled(t *testing.T) {
+	s := startOutputs(t, &config.Config{Outputs: []config.OutputConfig{fileOutput(t.TempDir(), "all.log", "text")}})
+	if _, err := s.InjectCanary(); !errors.Is(err, ErrCanariesDisabled) {
+		t.Errorf("InjectCanary = %v, want ErrCanariesDisabled", err)
+	}
+}
@@ -0,0 +1,87 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// deadLetter keeps a message that k and its fallbacks all failed to take,
+// for redelivery to k later. Canaries are not kept; a late one measures
+// nothing.
+func (s *Service) deadLetter(k *sink, msg *message.Packet, cause error) {
+	s.mu.RLock()
+	queue := s.deadLetters
+	s.mu.RUnlock()
+	if queue == nil || msg.Canary {
+		return
+	}
+
+	if err := queue.Add(outputKey(k.cfg), msg, cause); err != nil {
+		s.logger.Error("Failed to keep undelivered message",
+			zap.String("output", k.out.Name()),
+			zap.Uint32("id", msg.ID),
+			zap.Error(err))
+		return
+	}
+	s.logger.Warn("Message kept for redelivery",
+		zap.String("output", k.out.Name()),
+		zap.Uint32("id", msg.ID))
+	s.mu.Lock()
+	s.stats.DeadLettered++
+	s.mu.Unlock()
+}
+
+// redeliver tries the dead letters again now and then every retry
+// interval
+func (s *Service) redeliver(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval(s.config.DeadLetter.RetryInterval))
+	defer ticker.Stop()
+
+	for {
+		if s.deadLetters.Len() > 0 {
+			res, err := s.deadLetters.Redeliver(ctx, s.resend)
+			if err != nil {
+				s.logger.Warn("Failed to save dead letters", zap.Error(err))
+			}
+			if res.Delivered+res.Failed+res.Expired > 0 {
+				s.logger.Info("Redelivered undelivered messages",
+					zap.Int("delivered", res.Delivered),
+					zap.Int("failed", res.Failed),
+					zap.Int("expired", res.Expired),
+					zap.Int("waiting", s.deadLetters.Len()))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resend sends a dead letter to the output it failed on, if that output
+// is still configured
+func (s *Service) resend(ctx context.Context, output string, msg *message.Packet) error {
+	s.dispatch.RLock()
+	defer s.dispatch.RUnlock()
+	for _, k := range s.outputs {
+		if outputKey(k.cfg) != output {
+			continue
+		}
+		if err := k.out.Send(ctx, msg); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.stats.MessagesSent++
+		s.stats.Redelivered++
+		s.mu.Unlock()
+		return nil
+	}
+	return fmt.Errorf("output %s is not configured", output)
+}
@@ -0,0 +1,159 @@
+package relay
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/output"
+)
+
+// Queue defaults and policies, for the queue_size and queue_full options
+const (
+	defaultQueueSize = 1000
+	queueFullDrop    = "drop"
+	queueFullBlock   = "block"
+)
+
+// errQueueFull is the cause recorded for packets dropped from a full queue
+var errQueueFull = errors.New("output queue full")
+
+// dispatched is a packet waiting in a sink's queue, with the context it
+// was sent with
+type dispatched struct {
+	ctx context.Context
+	msg *message.Packet
+}
+
+// QueueStats describes an output's dispatch queue
+type QueueStats struct {
+	Output   string
+	Queued   int
+	Capacity int
+	Dropped  uint64 // packets discarded because the queue was full
+	Blocked  uint64 // packets that waited for room in the queue
+}
+
+// queuePolicy reads an output's queue_size and queue_full options
+func queuePolicy(cfg config.OutputConfig) (size int, block bool) {
+	size = defaultQueueSize
+	if n, ok := output.IntOption(cfg.Options, "queue_size"); ok && n > 0 {
+		size = n
+	}
+	block = cfg.Options["queue_full"] == queueFullBlock
+	return size, block
+}
+
+// startSink gives a sink its queue and the worker that sends from it, so
+// a slow output never holds up the others. Outputs implementing
+// output.Replier also get a listener sending their replies to the mesh.
+func (s *Service) startSink(k *sink) {
+	k.queue = make(chan dispatched, k.queueSize)
+	k.done = make(chan struct{})
+	go s.drain(k)
+
+	if r, ok := k.out.(output.Replier); ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		k.stopReplies = cancel
+		go s.listenForReplies(ctx, k.out, r)
+	}
+}
+
+// stopSink stops listening for replies, closes a sink's queue, and waits
+// for the worker to send what is left in it
+func (k *sink) stopSink() {
+	if k.stopReplies != nil {
+		k.stopReplies()
+	}
+	if k.queue == nil {
+		return
+	}
+	close(k.queue)
+	<-k.done
+}
+
+// drain sends a sink's queued packets in order. Outputs implementing
+// output.Concurrent take up to their slots' worth at once.
+func (s *Service) drain(k *sink) {
+	defer close(k.done)
+	if k.slots == nil {
+		for d := range k.queue {
+			s.sendToSink(d.ctx, k, d.msg)
+			k.pending.Done()
+		}
+		return
+	}
+
+	for {
+		// Wait for a free slot first so bursts stay in the queue
+		k.slots <- struct{}{}
+		d, ok := <-k.queue
+		if !ok {
+			return
+		}
+		go func(d dispatched) {
+			defer func() {
+				<-k.slots
+				k.pending.Done()
+			}()
+			s.sendToSink(d.ctx, k, d.msg)
+		}(d)
+	}
+}
+
+// enqueue queues msg for the sink. When the queue is full the packet is
+// dropped, and kept for redelivery if there is a dead letter queue, unless
+// the output asks to block until there is room.
+func (s *Service) enqueue(ctx context.Context, k *sink, msg *message.Packet) {
+	// Shutdown waits for queued sends rather than aborting them
+	d := dispatched{ctx: context.WithoutCancel(ctx), msg: msg}
+	k.pending.Add(1)
+	select {
+	case k.queue <- d:
+		return
+	default:
+	}
+
+	if k.block {
+		k.blocked.Add(1)
+		select {
+		case k.queue <- d:
+		case <-ctx.Done():
+			k.pending.Done()
+			s.canaryDelivered(k, msg, ctx.Err())
+		}
+		return
+	}
+
+	k.pending.Done()
+	k.dropped.Add(1)
+	s.mu.Lock()
+	s.stats.QueueDrops++
+	s.mu.Unlock()
+	s.logger.Warn("Output queue full; message dropped",
+		zap.String("output", k.out.Name()),
+		zap.Uint32("id", msg.ID),
+		zap.Int("queue_size", cap(k.queue)))
+	s.deadLetter(k, msg, errQueueFull)
+	s.canaryDelivered(k, msg, errQueueFull)
+}
+
+// QueueStats returns the dispatch queue of each output
+func (s *Service) QueueStats() []QueueStats {
+	s.dispatch.RLock()
+	defer s.dispatch.RUnlock()
+	stats := make([]QueueStats, 0, len(s.outputs))
+	for _, k := range s.outputs {
+		stats = append(stats, QueueStats{
+			Output:   k.out.Name(),
+			Queued:   len(k.queue),
+			Capacity: cap(k.queue),
+			Dropped:  k.dropped.Load(),
+			Blocked:  k.blocked.Load(),
+		})
+	}
+	return stats
+}
@@ -0,0 +1,141 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/filter"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/output"
+)
+
+// Retry defaults, unless retry_delay, retry_backoff, and retry_max_delay
+// are set
+const (
+	defaultRetryDelay    = 2 * time.Second
+	defaultRetryBackoff  = 2
+	defaultRetryMaxDelay = time.Minute
+)
+
+// retryPolicy is how often and how patiently a failed send is retried
+type retryPolicy struct {
+	retries  int
+	delay    time.Duration // before the first retry
+	backoff  float64       // each wait is this many times the last
+	maxDelay time.Duration // longest wait
+}
+
+// newRetryPolicy reads an output's retries, retry_delay, retry_backoff,
+// and retry_max_delay options
+func newRetryPolicy(cfg config.OutputConfig) retryPolicy {
+	p := retryPolicy{delay: defaultRetryDelay, backoff: defaultRetryBackoff, maxDelay: defaultRetryMaxDelay}
+	if n, ok := cfg.Options["retries"].(int); ok {
+		p.retries = max(n, 0)
+	}
+	if v, ok := cfg.Options["retry_delay"].(string); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			p.delay = d
+		}
+	}
+	switch v := cfg.Options["retry_backoff"].(type) {
+	case int:
+		p.backoff = float64(v)
+	case float64:
+		p.backoff = v
+	}
+	p.backoff = max(p.backoff, 1)
+	if v, ok := cfg.Options["retry_max_delay"].(string); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			p.maxDelay = d
+		}
+	}
+	return p
+}
+
+// wait returns how long to wait before the given retry, counting from 1
+func (p retryPolicy) wait(retry int) time.Duration {
+	d := float64(p.delay) * math.Pow(p.backoff, float64(retry-1))
+	if p.maxDelay > 0 && d > float64(p.maxDelay) {
+		return max(p.maxDelay, p.delay)
+	}
+	return time.Duration(d)
+}
+
+// newChain creates an output and the fallbacks tried when it fails
+func newChain(cfg config.OutputConfig) (*sink, error) {
+	out, err := output.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output %s: %w", cfg.Type, err)
+	}
+	k := newSink(cfg, out)
+	if src, ok := cfg.Options["filter"].(string); ok {
+		if k.match, err = filter.Compile(src); err != nil {
+			closeSinks([]*sink{k})
+			return nil, fmt.Errorf("invalid filter for output %s: %w", cfg.Type, err)
+		}
+	}
+	tp, err := cfg.TextPatterns()
+	if err == nil {
+		k.patterns, err = filter.NewTextPatterns(tp.Include, tp.Exclude)
+	}
+	if err != nil {
+		closeSinks([]*sink{k})
+		return nil, fmt.Errorf("invalid text_patterns for output %s: %w", cfg.Type, err)
+	}
+	if k.groups, err = cfg.Groups(); err != nil {
+		closeSinks([]*sink{k})
+		return nil, fmt.Errorf("invalid groups for output %s: %w", cfg.Type, err)
+	}
+
+	for i, fbCfg := range cfg.Fallbacks() {
+		fb, err := output.New(fbCfg)
+		if err != nil {
+			closeSinks([]*sink{k})
+			return nil, fmt.Errorf("failed to create fallback %d (%s) of output %s: %w", i+1, fbCfg.Type, cfg.Type, err)
+		}
+		k.fallbacks = append(k.fallbacks, newSink(fbCfg, fb))
+	}
+	return k, nil
+}
+
+// failover sends msg to the first of the sink's fallbacks that accepts
+// it. It returns the last error, or err when there are no fallbacks.
+func (s *Service) failover(ctx context.Context, k *sink, msg *message.Packet, err error) error {
+	for _, fb := range k.fallbacks {
+		if err = s.attempt(ctx, fb, msg); err == nil {
+			s.logger.Info("Message delivered through fallback output",
+				zap.String("output", k.out.Name()),
+				zap.String("fallback", fb.out.Name()))
+			s.mu.Lock()
+			s.stats.MessagesSent++
+			s.stats.Failovers++
+			s.mu.Unlock()
+			return nil
+		}
+		s.logger.Error("Failed to send message to fallback output",
+			zap.String("output", k.out.Name()),
+			zap.String("fallback", fb.out.Name()),
+			zap.Error(err))
+		s.mu.Lock()
+		s.stats.Errors++
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// sleep waits for d, returning false if ctx is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,115 @@
+package relay
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/deadletter"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestFailoverChain(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	fallback := fileOutput(dir, "fallback.log", "text")
+	fallback.Options["type"] = "file"
+	s := startOutputs(t, &config.Config{Outputs: []config.OutputConfig{{
+		Type:    "webhook",
+		Enabled: true,
+		Options: map[string]interface{}{
+			"url":           srv.URL,
+			"max_in_flight": 1,
+			"retries":       2,
+			"retry_delay":   "1ms",
+			"fallback": []interface{}{
+				map[string]interface{}{"type": "webhook", "url": srv.URL},
+				fallback.Options,
+			},
+		},
+	}}})
+
+	s.sendToOutputs(context.Background(), &message.Packet{From: 1, Payload: &message.TextMessage{Text: "trail closed"}})
+	waitOutputs(s)
+
+	if n := requests.Load(); n != 4 {
+		t.Errorf("webhook got %d requests, want 3 from the primary and 1 from the first fallback", n)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "fallback.log"))
+	if !strings.Contains(string(data), "trail closed") {
+		t.Errorf("fallback file = %q", data)
+	}
+	stats := s.GetStats()
+	if stats.Failovers != 1 || stats.MessagesSent != 1 || stats.Errors != 2 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := newRetryPolicy(config.OutputConfig{Options: map[string]interface{}{
+		"retries":         4,
+		"retry_delay":     "1s",
+		"retry_backoff":   3,
+		"retry_max_delay": "5s",
+	}})
+	for retry, want := range map[int]time.Duration{1: time.Second, 2: 3 * time.Second, 3: 5 * time.Second, 4: 5 * time.Second} {
+		if got := p.wait(retry); got != want {
+			t.Errorf("wait(%d) = %s, want %s", retry, got, want)
+		}
+	}
+}
+
+func TestDeadLetters(t *testing.T) {
+	var healthy atomic.Bool
+	var received atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		received.Add(1)
+	}))
+	defer srv.Close()
+
+	s := startOutputs(t, &config.Config{Outputs: []config.OutputConfig{{
+		Type:    "webhook",
+		Enabled: true,
+		Options: map[string]interface{}{"url": srv.URL, "max_in_flight": 1, "retries": 1, "retry_delay": "1ms"},
+	}}})
+	queue, err := deadletter.Open(config.DeadLetterConfig{Path: filepath.Join(t.TempDir(), "dead.jsonl")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.deadLetters = queue
+
+	s.sendToOutputs(context.Background(), &message.Packet{ID: 9, From: 1, Payload: &message.TextMessage{Text: "need water"}})
+	waitOutputs(s)
+	if stats := s.GetStats(); stats.DeadLettered != 1 || stats.DeadLetters != 1 || stats.MessagesSent != 0 {
+		t.Fatalf("stats after outage = %+v", stats)
+	}
+
+	healthy.Store(true)
+	res, err := queue.Redeliver(context.Background(), s.resend)
+	if err != nil || res.Delivered != 1 {
+		t.Fatalf("Redeliver = %+v, %v", res, err)
+	}
+	if received.Load() != 1 {
+		t.Errorf("webhook received %d messages after recovering, want 1", received.Load())
+	}
+	if stats := s.GetStats(); stats.Redelivered != 1 || stats.DeadLetters != 0 || stats.MessagesSent != 1 {
+		t.Errorf("stats after redelivery = %+v", stats)
+	}
+}
@@ -0,0 +1,502 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/filter"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/output"
+)
+
+// sink is a configured output and its dispatch state
+type sink struct {
+	cfg      config.OutputConfig
+	out      output.Output
+	critical bool
+	canary   bool // from the canary option
+	// match and patterns select the packets sent to this output, from its
+	// filter and text_patterns options; nil sends all of them
+	match    *filter.Expr
+	patterns *filter.TextPatterns
+	// groups are the output groups routes send to, from its groups option
+	groups []string
+
+	// retry is how a failed send is retried before moving on to the
+	// fallbacks in order
+	retry     retryPolicy
+	fallbacks []*sink
+
+	// queue holds packets for the worker sending to this output, from
+	// its queue_size and queue_full options; done closes when the worker
+	// has sent the last of them
+	queue     chan dispatched
+	queueSize int
+	block     bool
+	done      chan struct{}
+	dropped   atomic.Uint64
+	blocked   atomic.Uint64
+
+	// slots limits concurrent sends to outputs implementing
+	// output.Concurrent; pending tracks queued and in-flight sends for
+	// shutdown and reload
+	slots   chan struct{}
+	pending sync.WaitGroup
+
+	// stopReplies stops the listener for outputs implementing
+	// output.Replier
+	stopReplies context.CancelFunc
+
+	mu          sync.Mutex
+	replacement *sink
+	batch       []*message.Packet // held for the next flush in low-power mode
+	delivery    delivery          // outcome of the sends, for OutputStatuses
+}
+
+func newSink(cfg config.OutputConfig, out output.Output) *sink {
+	k := &sink{cfg: cfg, out: out, critical: isCritical(cfg), canary: acceptsCanary(cfg)}
+	k.retry = newRetryPolicy(cfg)
+	k.queueSize, k.block = queuePolicy(cfg)
+	if c, ok := out.(output.Concurrent); ok && c.MaxInFlight() > 1 {
+		k.slots = make(chan struct{}, c.MaxInFlight())
+	}
+	return k
+}
+
+// replacedBy records the sink taking over from k during a reload
+func (k *sink) replacedBy(next *sink) {
+	k.mu.Lock()
+	k.replacement = next
+	k.mu.Unlock()
+}
+
+func (k *sink) replaced() *sink {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.replacement
+}
+
+// GetOutputs returns the configured outputs
+func (s *Service) GetOutputs() []output.Output {
+	s.dispatch.RLock()
+	defer s.dispatch.RUnlock()
+	outs := make([]output.Output, len(s.outputs))
+	for i, k := range s.outputs {
+		outs[i] = k.out
+	}
+	return outs
+}
+
+func (s *Service) initOutputs() error {
+	sinks := make([]*sink, 0)
+	var disabled []config.OutputConfig
+
+	for _, outCfg := range s.config.Outputs {
+		if !outCfg.Enabled {
+			disabled = append(disabled, outCfg)
+			continue
+		}
+
+		k, err := newChain(outCfg)
+		if err != nil {
+			closeSinks(sinks)
+			return err
+		}
+		sinks = append(sinks, k)
+		s.logger.Debug("Initialized output",
+			zap.String("type", outCfg.Type),
+			zap.String("name", k.out.Name()),
+			zap.Int("fallbacks", len(k.fallbacks)))
+	}
+
+	if len(sinks) == 0 {
+		return fmt.Errorf("no outputs enabled")
+	}
+	for _, k := range sinks {
+		s.startSink(k)
+	}
+
+	s.dispatch.Lock()
+	s.outputs = sinks
+	s.disabled = disabled
+	s.dispatch.Unlock()
+	return nil
+}
+
+func (s *Service) closeOutputs() {
+	s.dispatch.Lock()
+	sinks := s.outputs
+	s.outputs = nil
+	s.dispatch.Unlock()
+
+	for _, k := range sinks {
+		s.retire(k)
+	}
+}
+
+// retire sends the sink's held and queued packets and waits for its
+// in-flight sends to finish, then closes it and its fallbacks
+func (s *Service) retire(k *sink) {
+	s.flushSink(context.Background(), k)
+	k.stopSink()
+	k.pending.Wait()
+	for _, c := range append([]*sink{k}, k.fallbacks...) {
+		if err := c.out.Close(); err != nil {
+			s.logger.Error("Error closing output", zap.String("output", c.out.Name()), zap.Error(err))
+		}
+	}
+}
+
+// closeSinks closes outputs that never received a message
+func closeSinks(sinks []*sink) {
+	for _, k := range sinks {
+		_ = k.out.Close()
+		closeSinks(k.fallbacks)
+	}
+}
+
+func (s *Service) sendToOutputs(ctx context.Context, msg *message.Packet) {
+	s.sendToSinks(ctx, msg, nil)
+}
+
+// sendToSinks sends msg to the outputs for which skip, if set, returns
+// false
+func (s *Service) sendToSinks(ctx context.Context, msg *message.Packet, skip func(*sink) bool) {
+	// Outputs sharing a format serialize the packet once between them
+	ctx = output.WithRender(ctx, output.NewRender(msg))
+
+	s.mu.RLock()
+	routes, conn := s.routes, s.connection
+	s.mu.RUnlock()
+
+	// With routes, packets go only to the outputs in the groups of the
+	// routes they match
+	var groups map[string]bool
+	if routes != nil {
+		name := ""
+		if conn != nil {
+			name = conn.Name()
+		}
+		if groups = routes.groups(msg, name); len(groups) == 0 {
+			s.logger.Debug("Message matched no route", zap.Uint32("id", msg.ID))
+			s.mu.Lock()
+			s.stats.MessagesFiltered++
+			s.mu.Unlock()
+			return
+		}
+	}
+
+	// Reload swaps outputs only between packets
+	s.dispatch.RLock()
+	defer s.dispatch.RUnlock()
+
+	paused := s.power != nil && s.power.paused()
+	for _, k := range s.outputs {
+		if skip != nil && skip(k) {
+			continue
+		}
+		if groups != nil && !k.inGroup(groups) {
+			continue
+		}
+		if k.match != nil && !k.match.Match(msg) || k.patterns != nil && !k.patterns.Match(msg) {
+			continue
+		}
+		if s.power != nil && !k.critical {
+			// Low-power mode batches non-critical outputs, and drops their
+			// packets while the device battery is low
+			if !paused {
+				k.hold(msg)
+			}
+			continue
+		}
+		s.enqueue(ctx, k, msg)
+	}
+}
+
+func (s *Service) sendToSink(ctx context.Context, k *sink, msg *message.Packet) {
+	err := s.attempt(ctx, k, msg)
+	k.delivery.record(err, time.Now())
+	if err == nil {
+		s.mu.Lock()
+		s.stats.MessagesSent++
+		s.mu.Unlock()
+		s.canaryDelivered(k, msg, nil)
+		return
+	}
+	s.logger.Error("Failed to send message to output",
+		zap.String("output", k.out.Name()),
+		zap.Error(err))
+	s.mu.Lock()
+	s.stats.Errors++
+	s.mu.Unlock()
+
+	err = s.failover(ctx, k, msg, err)
+	if err != nil {
+		s.deadLetter(k, msg, err)
+	}
+	s.canaryDelivered(k, msg, err)
+}
+
+// attempt sends msg to the sink, retrying as configured
+func (s *Service) attempt(ctx context.Context, k *sink, msg *message.Packet) error {
+	err := k.out.Send(ctx, msg)
+	for i := 1; err != nil && i <= k.retry.retries; i++ {
+		wait := k.retry.wait(i)
+		s.logger.Debug("Retrying send",
+			zap.String("output", k.out.Name()),
+			zap.Int("attempt", i+1),
+			zap.Duration("wait", wait),
+			zap.Error(err))
+		if !sleep(ctx, wait) {
+			return err
+		}
+		err = k.out.Send(ctx, msg)
+	}
+
+	if err != nil {
+		// A send that fails while its output is being replaced is handed
+		// to the replacement rather than lost
+		if next := k.replaced(); next != nil {
+			s.logger.Debug("Retrying send on replacement output",
+				zap.String("output", k.out.Name()),
+				zap.String("replacement", next.out.Name()),
+				zap.Error(err))
+			err = next.out.Send(ctx, msg)
+		}
+	}
+	return err
+}
+
+// ReloadSummary describes what a reload changed
+type ReloadSummary struct {
+	Added          []string `json:"added,omitempty"`
+	Removed        []string `json:"removed,omitempty"`
+	Changed        []string `json:"changed,omitempty"`
+	Failed         []string `json:"failed,omitempty"`
+	FiltersChanged bool     `json:"filters_changed"`
+	RoutesChanged  bool     `json:"routes_changed"`
+}
+
+// Empty reports whether the reload changed nothing
+func (r *ReloadSummary) Empty() bool {
+	return len(r.Added)+len(r.Removed)+len(r.Changed)+len(r.Failed) == 0 && !r.FiltersChanged && !r.RoutesChanged
+}
+
+// String returns a one-line description of the reload
+func (r *ReloadSummary) String() string {
+	if r.Empty() {
+		return "no changes"
+	}
+	var parts []string
+	for _, list := range []struct {
+		verb  string
+		names []string
+	}{{"added", r.Added}, {"removed", r.Removed}, {"changed", r.Changed}, {"failed", r.Failed}} {
+		if len(list.names) > 0 {
+			parts = append(parts, fmt.Sprintf("%s %s", list.verb, strings.Join(list.names, ", ")))
+		}
+	}
+	if r.FiltersChanged {
+		parts = append(parts, "filters changed")
+	}
+	if r.RoutesChanged {
+		parts = append(parts, "routes changed")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Reload applies the outputs, filters, and routes from cfg to the running
+// service.
+// Unchanged outputs keep running. Sends already in flight on a removed or
+// changed output finish before it is closed, and any that fail are retried
+// on its replacement. Other settings take effect on restart.
+func (s *Service) Reload(cfg *config.Config) (*ReloadSummary, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	if !s.IsRunning() {
+		return nil, fmt.Errorf("service is not running")
+	}
+	filters, ingest, err := compileFilters(cfg)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := newRouter(cfg.Routes)
+	if err != nil {
+		return nil, err
+	}
+
+	var wanted, disabled []config.OutputConfig
+	for _, outCfg := range cfg.Outputs {
+		if outCfg.Enabled {
+			wanted = append(wanted, outCfg)
+		} else {
+			disabled = append(disabled, outCfg)
+		}
+	}
+	if len(wanted) == 0 {
+		return nil, fmt.Errorf("no outputs enabled")
+	}
+
+	s.dispatch.RLock()
+	previous := s.outputs
+	s.dispatch.RUnlock()
+
+	previousCfgs := make([]config.OutputConfig, len(previous))
+	for i, k := range previous {
+		previousCfgs[i] = k.cfg
+	}
+	previousKeys := outputKeys(previousCfgs)
+	current := make(map[string]*sink, len(previous))
+	for i, k := range previous {
+		current[previousKeys[i]] = k
+	}
+
+	summary := &ReloadSummary{}
+	var (
+		sinks    []*sink
+		created  []*sink
+		retiring []*sink
+		// replacements pairs changed outputs with their new instances
+		replacements = make(map[*sink]*sink)
+		// deferred outputs could not start alongside the instance they
+		// replace, typically because it still holds a port
+		deferred []config.OutputConfig
+	)
+	for i, key := range outputKeys(wanted) {
+		outCfg := wanted[i]
+		old, exists := current[key]
+		delete(current, key)
+		if exists && reflect.DeepEqual(old.cfg, outCfg) {
+			sinks = append(sinks, old)
+			continue
+		}
+
+		k, err := newChain(outCfg)
+		if err != nil {
+			if exists {
+				deferred = append(deferred, outCfg)
+				retiring = append(retiring, old)
+				summary.Changed = append(summary.Changed, old.out.Name())
+				continue
+			}
+			closeSinks(created)
+			return nil, err
+		}
+		created = append(created, k)
+		sinks = append(sinks, k)
+		if exists {
+			replacements[old] = k
+			retiring = append(retiring, old)
+			summary.Changed = append(summary.Changed, k.out.Name())
+		} else {
+			summary.Added = append(summary.Added, k.out.Name())
+		}
+	}
+	for i, old := range previous {
+		if _, removed := current[previousKeys[i]]; removed {
+			retiring = append(retiring, old)
+			summary.Removed = append(summary.Removed, old.out.Name())
+		}
+	}
+
+	for _, k := range created {
+		s.startSink(k)
+	}
+	for old, k := range replacements {
+		old.replacedBy(k)
+	}
+	s.dispatch.Lock()
+	s.outputs = sinks
+	s.disabled = disabled
+	s.dispatch.Unlock()
+
+	s.mu.Lock()
+	summary.FiltersChanged = !reflect.DeepEqual(s.filters.cfg, cfg.Filters) || !reflect.DeepEqual(s.ingest.config(), ingest.config())
+	s.filters, s.ingest = filters, ingest
+	summary.RoutesChanged = !reflect.DeepEqual(s.routes.config(), routes.config())
+	s.routes = routes
+	s.mu.Unlock()
+
+	for _, old := range retiring {
+		s.retire(old)
+	}
+
+	var failed error
+	for _, outCfg := range deferred {
+		k, err := newChain(outCfg)
+		if err != nil {
+			s.logger.Error("Failed to recreate output", zap.String("type", outCfg.Type), zap.Error(err))
+			summary.Failed = append(summary.Failed, outputKey(outCfg))
+			failed = err
+			continue
+		}
+		s.startSink(k)
+		s.dispatch.Lock()
+		s.outputs = append(s.outputs, k)
+		s.dispatch.Unlock()
+	}
+
+	s.logger.Info("Configuration reloaded",
+		zap.Strings("added", summary.Added),
+		zap.Strings("removed", summary.Removed),
+		zap.Strings("changed", summary.Changed),
+		zap.Strings("failed", summary.Failed),
+		zap.Bool("filters_changed", summary.FiltersChanged),
+		zap.Bool("routes_changed", summary.RoutesChanged))
+	s.publish("reload", summary)
+
+	return summary, failed
+}
+
+// publish sends an event to outputs that stream events to clients
+func (s *Service) publish(name string, data interface{}) {
+	s.dispatch.RLock()
+	defer s.dispatch.RUnlock()
+	for _, k := range s.outputs {
+		if p, ok := k.out.(output.Publisher); ok {
+			if err := p.Publish(name, data); err != nil {
+				s.logger.Warn("Failed to publish event",
+					zap.String("output", k.out.Name()),
+					zap.String("event", name),
+					zap.Error(err))
+			}
+		}
+	}
+}
+
+// outputKey identifies an output across reloads by its type and
+// destination, so editing other options reports it as changed rather than
+// as removed and added
+func outputKey(cfg config.OutputConfig) string {
+	for _, opt := range []string{"listen", "url", "broker", "path"} {
+		if v, ok := cfg.Options[opt].(string); ok && v != "" {
+			return cfg.Type + ":" + v
+		}
+	}
+	return cfg.Type
+}
+
+// outputKeys returns the key of each config, numbering repeats of the
+// same key in order
+func outputKeys(cfgs []config.OutputConfig) []string {
+	keys := make([]string, len(cfgs))
+	seen := make(map[string]int)
+	for i, cfg := range cfgs {
+		key := outputKey(cfg)
+		seen[key]++
+		if seen[key] > 1 {
+			key = fmt.Sprintf("%s#%d", key, seen[key])
+		}
+		keys[i] = key
+	}
+	return keys
+}
@@ -0,0 +1,335 @@
+package relay
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func fileOutput(dir, name, format string) config.OutputConfig {
+	return config.OutputConfig{
+		Type:    "file",
+		Enabled: true,
+		Options: map[string]interface{}{"path": filepath.Join(dir, name), "format": format, "rotate": false},
+	}
+}
+
+// startOutputs creates a service with cfg's outputs, without a connection
+func startOutputs(t *testing.T, cfg *config.Config) *Service {
+	t.Helper()
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := s.initOutputs(); err != nil {
+		t.Fatalf("initOutputs: %v", err)
+	}
+	s.running = true
+	t.Cleanup(s.closeOutputs)
+	return s
+}
+
+// waitOutputs waits until the outputs have sent every queued packet
+func waitOutputs(s *Service) {
+	for _, k := range s.outputs {
+		k.pending.Wait()
+	}
+}
+
+func TestReloadSummary(t *testing.T) {
+	dir := t.TempDir()
+	s := startOutputs(t, &config.Config{Outputs: []config.OutputConfig{
+		fileOutput(dir, "a.log", "json"),
+		fileOutput(dir, "b.log", "json"),
+	}})
+	kept := s.GetOutputs()[0]
+
+	summary, err := s.Reload(&config.Config{
+		Outputs: []config.OutputConfig{
+			fileOutput(dir, "a.log", "json"),
+			fileOutput(dir, "b.log", "text"),
+			fileOutput(dir, "c.log", "json"),
+		},
+		Filters: config.FilterConfig{MessageTypes: []string{"TEXT_MESSAGE_APP"}},
+	})
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	want := &ReloadSummary{
+		Added:          []string{"file:" + filepath.Join(dir, "c.log")},
+		Changed:        []string{"file:" + filepath.Join(dir, "b.log")},
+		FiltersChanged: true,
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("summary = %+v, want %+v", summary, want)
+	}
+	if outs := s.GetOutputs(); len(outs) != 3 || outs[0] != kept {
+		t.Errorf("outputs = %v, want the unchanged output kept", outs)
+	}
+
+	summary, err = s.Reload(&config.Config{
+		Outputs: []config.OutputConfig{fileOutput(dir, "a.log", "json")},
+		Filters: config.FilterConfig{MessageTypes: []string{"TEXT_MESSAGE_APP"}},
+	})
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if len(summary.Removed) != 2 || summary.FiltersChanged || len(s.GetOutputs()) != 1 {
+		t.Errorf("summary = %s", summary)
+	}
+
+	if _, err := s.Reload(&config.Config{}); err == nil {
+		t.Error("reload without outputs succeeded")
+	}
+}
+
+func TestReloadRecreatesOutputHoldingPort(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	sse := func(path string) config.OutputConfig {
+		return config.OutputConfig{Type: "sse", Enabled: true,
+			Options: map[string]interface{}{"listen": addr, "path": path}}
+	}
+	s := startOutputs(t, &config.Config{Outputs: []config.OutputConfig{sse("/events")}})
+
+	summary, err := s.Reload(&config.Config{Outputs: []config.OutputConfig{sse("/stream")}})
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if len(summary.Changed) != 1 || len(summary.Failed) != 0 {
+		t.Errorf("summary = %s", summary)
+	}
+	if outs := s.GetOutputs(); len(outs) != 1 || outs[0].Name() != "sse:"+addr+"/stream" {
+		t.Errorf("outputs = %v", outs)
+	}
+}
+
+func TestFilters(t *testing.T) {
+	dir := t.TempDir()
+	secondary := fileOutput(dir, "secondary.log", "text")
+	secondary.Options["filter"] = `channel == 1 || text contains "urgent"`
+	pager := fileOutput(dir, "pager.log", "text")
+	pager.Options["text_patterns"] = map[string]interface{}{"include": []interface{}{"(?i)urgent"}}
+	s := startOutputs(t, &config.Config{
+		Outputs: []config.OutputConfig{fileOutput(dir, "all.log", "text"), secondary, pager},
+		Filters: config.FilterConfig{Expression: `portnum == "TEXT_MESSAGE_APP" && rssi > -110`},
+	})
+
+	packets := []*message.Packet{
+		{From: 1, Channel: 0, PortNum: message.PortNumTextMessage, RSSI: -90, Payload: &message.TextMessage{Text: "hello"}},
+		{From: 1, Channel: 1, PortNum: message.PortNumTextMessage, RSSI: -90, Payload: &message.TextMessage{Text: "on secondary"}},
+		{From: 1, Channel: 0, PortNum: message.PortNumTextMessage, RSSI: -90, Payload: &message.TextMessage{Text: "urgent"}},
+		{From: 1, Channel: 1, PortNum: message.PortNumTextMessage, RSSI: -120, Payload: &message.TextMessage{Text: "too weak"}},
+		{From: 1, Channel: 1, PortNum: message.PortNumPosition, RSSI: -90, Payload: &message.Position{}},
+	}
+	for _, p := range packets {
+		if s.ShouldRelay(p) {
+			s.sendToOutputs(context.Background(), p)
+		}
+	}
+	waitOutputs(s)
+
+	lines := func(name string) int {
+		data, _ := os.ReadFile(filepath.Join(dir, name))
+		return strings.Count(string(data), "\n")
+	}
+	if lines("all.log") != 3 || lines("secondary.log") != 2 || lines("pager.log") != 1 {
+		t.Errorf("all %d, secondary %d, pager %d lines; want 3, 2, and 1", lines("all.log"), lines("secondary.log"), lines("pager.log"))
+	}
+
+	if _, err := s.Reload(&config.Config{
+		Outputs: []config.OutputConfig{fileOutput(dir, "all.log", "text")},
+		Filters: config.FilterConfig{Expression: "rssi >"},
+	}); err == nil {
+		t.Error("reload with an invalid expression succeeded")
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	dir := t.TempDir()
+	pager := fileOutput(dir, "pager.log", "text")
+	pager.Options["groups"] = "alerts"
+	metrics := fileOutput(dir, "metrics.log", "text")
+	metrics.Options["groups"] = []interface{}{"telemetry"}
+	archive := fileOutput(dir, "archive.log", "text")
+	archive.Options["groups"] = []interface{}{"archive", "telemetry"}
+	s := startOutputs(t, &config.Config{
+		Outputs: []config.OutputConfig{pager, metrics, archive},
+		Routes: []config.RouteConfig{
+			{Name: "sos", Channels: []uint32{1}, MessageTypes: []string{"TEXT_MESSAGE_APP"}, Groups: []string{"alerts"}, Continue: true},
+			{Name: "telemetry", MessageTypes: []string{"TELEMETRY_APP"}, Nodes: []string{"!00000002"}, Groups: []string{"telemetry"}},
+			{Name: "text", MessageTypes: []string{"TEXT_MESSAGE_APP"}, Groups: []string{"archive"}},
+		},
+	})
+
+	for _, p := range []*message.Packet{
+		{From: 1, Channel: 1, PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: "sos"}},
+		{From: 1, Channel: 0, PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: "hello"}},
+		{From: 2, PortNum: message.PortNumTelemetry, Payload: &message.Telemetry{}},
+		{From: 3, PortNum: message.PortNumTelemetry, Payload: &message.Telemetry{}},
+	} {
+		s.sendToOutputs(context.Background(), p)
+	}
+	waitOutputs(s)
+
+	lines := func(name string) int {
+		data, _ := os.ReadFile(filepath.Join(dir, name))
+		return strings.Count(string(data), "\n")
+	}
+	// The archive is in the telemetry group too, so it gets node 2's
+	// telemetry once; node 3's matches no route
+	if lines("pager.log") != 1 || lines("metrics.log") != 1 || lines("archive.log") != 3 {
+		t.Errorf("pager %d, metrics %d, archive %d lines; want 1, 1, and 3",
+			lines("pager.log"), lines("metrics.log"), lines("archive.log"))
+	}
+	if stats := s.GetStats(); stats.MessagesFiltered != 1 {
+		t.Errorf("filtered %d packets, want 1", stats.MessagesFiltered)
+	}
+
+	summary, err := s.Reload(&config.Config{Outputs: []config.OutputConfig{pager, metrics, archive}})
+	if err != nil || !summary.RoutesChanged {
+		t.Errorf("reload without routes: %v, routes changed %v", err, summary != nil && summary.RoutesChanged)
+	}
+}
+
+func TestSlowOutputQueue(t *testing.T) {
+	arrived := make(chan struct{}, 10)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		arrived <- struct{}{}
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	dir := t.TempDir()
+	s := startOutputs(t, &config.Config{Outputs: []config.OutputConfig{
+		{Type: "webhook", Enabled: true, Options: map[string]interface{}{"url": srv.URL, "max_in_flight": 1, "queue_size": 1}},
+		fileOutput(dir, "all.log", "text"),
+	}})
+	send := func(text string) {
+		s.sendToOutputs(context.Background(), &message.Packet{From: 1, Payload: &message.TextMessage{Text: text}})
+	}
+
+	// The webhook holds the first packet and queues the second; the rest
+	// are dropped while the file output keeps up
+	send("one")
+	<-arrived
+	for _, text := range []string{"two", "three", "four"} {
+		send(text)
+	}
+	s.outputs[1].pending.Wait()
+	data, _ := os.ReadFile(filepath.Join(dir, "all.log"))
+	if n := strings.Count(string(data), "\n"); n != 4 {
+		t.Errorf("file output wrote %d lines while the webhook was stalled, want 4", n)
+	}
+	queues := s.QueueStats()
+	if queues[0].Queued != 1 || queues[0].Capacity != 1 || queues[0].Dropped != 2 || queues[1].Dropped != 0 {
+		t.Errorf("queues = %+v", queues)
+	}
+	if stats := s.GetStats(); stats.QueueDrops != 2 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	release <- struct{}{}
+	release <- struct{}{}
+	waitOutputs(s)
+	if stats := s.GetStats(); stats.MessagesSent != 6 {
+		t.Errorf("sent %d messages, want 6", stats.MessagesSent)
+	}
+}
+
+func TestQueuePolicy(t *testing.T) {
+	for _, tt := range []struct {
+		options map[string]interface{}
+		size    int
+		block   bool
+	}{
+		{map[string]interface{}{}, defaultQueueSize, false},
+		{map[string]interface{}{"queue_size": 50}, 50, false},
+		{map[string]interface{}{"queue_size": 50.0, "queue_full": "block"}, 50, true}, // from JSON
+		{map[string]interface{}{"queue_size": 0}, defaultQueueSize, false},
+		{map[string]interface{}{"queue_size": -3.0}, defaultQueueSize, false},
+		{map[string]interface{}{"queue_size": "50", "queue_full": "drop"}, defaultQueueSize, false},
+	} {
+		size, block := queuePolicy(config.OutputConfig{Options: tt.options})
+		if size != tt.size || block != tt.block {
+			t.Errorf("queuePolicy(%v) = %d, %v; want %d, %v", tt.options, size, block, tt.size, tt.block)
+		}
+	}
+}
+
+func TestIngestFilters(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Connection: config.ConnectionConfig{Filters: config.FilterConfig{Expression: `portnum != "TELEMETRY_APP"`}},
+		Outputs:    []config.OutputConfig{fileOutput(dir, "all.log", "text")},
+	}
+	s := startOutputs(t, cfg)
+
+	telemetry := &message.Packet{From: 2, PortNum: message.PortNumTelemetry, Payload: &message.Telemetry{}}
+	text := &message.Packet{From: 1, PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: "hello"}}
+	if s.admit(telemetry) || !s.admit(text) {
+		t.Errorf("admit(telemetry) = %v, admit(text) = %v", s.admit(telemetry), s.admit(text))
+	}
+
+	cfg.Connection.Filters = config.FilterConfig{}
+	summary, err := s.Reload(cfg)
+	if err != nil || !summary.FiltersChanged || !s.admit(telemetry) {
+		t.Errorf("after removing connection filters: %v, %+v, admit %v", err, summary, s.admit(telemetry))
+	}
+}
+
+func TestOutputStatuses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	disabled := fileOutput(dir, "off.log", "text")
+	disabled.Enabled = false
+	s := startOutputs(t, &config.Config{Outputs: []config.OutputConfig{
+		fileOutput(dir, "all.log", "text"),
+		{Type: "webhook", Enabled: true, Options: map[string]interface{}{"url": srv.URL + "/hook?token=secret"}},
+		disabled,
+	}})
+
+	for _, text := range []string{"one", "two"} {
+		s.sendToOutputs(context.Background(), &message.Packet{From: 1, PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: text}})
+	}
+	waitOutputs(s)
+
+	st := s.OutputStatuses()
+	if len(st) != 3 {
+		t.Fatalf("got %d statuses, want 3", len(st))
+	}
+	if file := st[0]; !file.Enabled || file.Delivered != 2 || file.Failed != 0 || file.LastDelivery.IsZero() || file.Failing() {
+		t.Errorf("file status = %+v", file)
+	}
+	if hook := st[1]; hook.Delivered != 0 || hook.Failed != 2 || hook.LastError == "" || !hook.Failing() {
+		t.Errorf("webhook status = %+v", hook)
+	}
+	if off := st[2]; off.Enabled || off.Output != "file:"+filepath.Join(dir, "off.log") {
+		t.Errorf("disabled status = %+v", off)
+	}
+	for _, o := range st {
+		if strings.Contains(o.Output, "secret") {
+			t.Errorf("output name %q shows the token", o.Output)
+		}
+	}
+}
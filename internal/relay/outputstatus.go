@@ -0,0 +1,91 @@
+package relay
+
+import (
+	"sync"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/output"
+)
+
+// OutputStatus describes how sending to an output is going
+type OutputStatus struct {
+	Output       string    `json:"output"`
+	Type         string    `json:"type"`
+	Enabled      bool      `json:"enabled"`
+	Delivered    uint64    `json:"delivered"`
+	Failed       uint64    `json:"failed"` // sends that failed after their retries
+	LastDelivery time.Time `json:"last_delivery,omitempty"`
+	LastError    string    `json:"last_error,omitempty"`
+	LastErrorAt  time.Time `json:"last_error_at,omitempty"`
+	Queued       int       `json:"queued"`
+}
+
+// Failing reports whether the output's last send failed
+func (o OutputStatus) Failing() bool {
+	return o.LastErrorAt.After(o.LastDelivery)
+}
+
+// delivery records the outcome of the sends to an output. A fallback
+// taking over a failed send does not count as a delivery for the output
+// that failed.
+type delivery struct {
+	mu           sync.Mutex
+	delivered    uint64
+	failed       uint64
+	lastDelivery time.Time
+	lastError    string
+	lastErrorAt  time.Time
+}
+
+func (d *delivery) record(err error, at time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err == nil {
+		d.delivered++
+		d.lastDelivery = at
+		return
+	}
+	d.failed++
+	d.lastError = err.Error()
+	d.lastErrorAt = at
+}
+
+// OutputStatuses returns the status of each configured output, enabled
+// ones first. Counts start over when a reload changes an output.
+func (s *Service) OutputStatuses() []OutputStatus {
+	s.dispatch.RLock()
+	defer s.dispatch.RUnlock()
+	statuses := make([]OutputStatus, 0, len(s.outputs)+len(s.disabled))
+	for _, k := range s.outputs {
+		d := &k.delivery
+		d.mu.Lock()
+		statuses = append(statuses, OutputStatus{
+			Output:       k.out.Name(),
+			Type:         k.cfg.Type,
+			Enabled:      true,
+			Delivered:    d.delivered,
+			Failed:       d.failed,
+			LastDelivery: d.lastDelivery,
+			LastError:    d.lastError,
+			LastErrorAt:  d.lastErrorAt,
+			Queued:       len(k.queue),
+		})
+		d.mu.Unlock()
+	}
+	for _, cfg := range s.disabled {
+		statuses = append(statuses, OutputStatus{Output: disabledName(cfg), Type: cfg.Type})
+	}
+	return statuses
+}
+
+// disabledName names a disabled output as it would be named if enabled,
+// as near as the config allows without creating it
+func disabledName(cfg config.OutputConfig) string {
+	for _, opt := range []string{"url", "broker"} {
+		if v, ok := cfg.Options[opt].(string); ok && v != "" {
+			return cfg.Type + ":" + output.MaskURL(v)
+		}
+	}
+	return outputKey(cfg)
+}
@@ -0,0 +1,124 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestServicePlayback(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Relay.SafeMode = true
+	cfg.NodeDB.Path = ""
+	cfg.Filters.MessageTypes = []string{"TEXT_MESSAGE_APP"}
+	cfg.Outputs = []config.OutputConfig{fileOutput(dir, "out.log", "json")}
+
+	packets := []*message.Packet{
+		{ID: 1, From: 0x1234abcd, PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: "one"}},
+		{ID: 2, From: 0x1234abcd, PortNum: message.PortNumPosition, Payload: &message.Position{Latitude: 1}},
+		{ID: 3, From: 0x1234abcd, PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: "two"}},
+	}
+	playback := connection.NewPlayback("test", func(fn func(*message.Packet) error) error {
+		for _, p := range packets {
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	s.UseConnection(playback)
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	<-playback.Done()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.GetStats().MessagesReceived < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	_ = s.Stop()
+
+	if st := s.GetStats(); st.MessagesSent != 2 || st.MessagesFiltered != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "out.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 2 || !strings.Contains(string(data), `"two"`) {
+		t.Errorf("output:\n%s", data)
+	}
+}
+
+func TestSendAndWaitAck(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.NodeDB.Path = ""
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	s.UseConnection(connection.NewPlayback("test", func(func(*message.Packet) error) error { return nil }))
+
+	text := &message.Packet{To: 0x1234abcd, PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: "hi"}}
+	if _, err := s.SendAndWaitAck(context.Background(), text); err == nil || !strings.Contains(err.Error(), "cannot wait for acks") {
+		t.Errorf("SendAndWaitAck on playback = %v", err)
+	}
+
+	s.config.Relay.SafeMode = true
+	if _, err := s.SendAndWaitAck(context.Background(), text); !errors.Is(err, connection.ErrSafeMode) {
+		t.Errorf("SendAndWaitAck in safe mode = %v", err)
+	}
+}
+
+func TestFailedStartClosesEverything(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Relay.SafeMode = true
+	cfg.NodeDB.Path = filepath.Join(dir, "nodes.json")
+	cfg.Dedup = config.DedupConfig{Enabled: true, Window: time.Minute, StateFile: filepath.Join(dir, "dedup.json")}
+	cfg.Outputs = []config.OutputConfig{fileOutput(dir, "out.log", "json")}
+	// A directory cannot be read as the sequence file, the last store opened
+	cfg.Relay.SequenceFile = t.TempDir()
+
+	// Play packets until closed
+	playback := connection.NewPlayback("test", func(fn func(*message.Packet) error) error {
+		for i := uint32(1); ; i++ {
+			if err := fn(&message.Packet{ID: i, From: 0x1234abcd}); err != nil {
+				return err
+			}
+		}
+	})
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	s.UseConnection(playback)
+	if err := s.Start(context.Background()); err == nil {
+		_ = s.Stop()
+		t.Fatal("Start succeeded with an unreadable sequence file")
+	}
+
+	if s.IsRunning() {
+		t.Error("service is running after a failed start")
+	}
+	if playback.IsConnected() {
+		t.Error("connection is still open")
+	}
+	if outputs := s.GetOutputs(); len(outputs) != 0 {
+		t.Errorf("outputs still open: %v", outputs)
+	}
+}
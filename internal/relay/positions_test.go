@@ -0,0 +1,49 @@
+package relay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestLocateDoesNotWaitForGeocoder(t *testing.T) {
+	hang := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		select {
+		case <-hang:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(hang)
+
+	cfg := config.DefaultConfig()
+	cfg.NodeDB.Path = ""
+	cfg.Positions.Geocoder = config.GeocoderConfig{
+		Type:      config.GeocoderNominatim,
+		URL:       srv.URL,
+		UserAgent: "test-relay",
+		Timeout:   10 * time.Second,
+	}
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	// A geocoder that never answers does not hold up the relay loop
+	start := time.Now()
+	for i := 1; i <= 20; i++ {
+		pos := &message.Position{Latitude: 45 + float64(i)/100, Longitude: -122}
+		s.locate(&message.Packet{ID: uint32(i), PortNum: message.PortNumPosition, Payload: pos})
+		if pos.Place != "" {
+			t.Errorf("position %d = %+v", i, pos)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("locating took %v", elapsed)
+	}
+}
@@ -0,0 +1,147 @@
+package relay
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// maxBatch is the most packets held for a non-critical output between
+// flushes; the oldest are dropped beyond it
+const maxBatch = 1000
+
+// externalPower is the battery level a device reports when it runs on
+// external power
+const externalPower = 101
+
+// power is the low-power mode state. Packets for non-critical outputs are
+// held and sent in batches, and dropped while the attached device's
+// battery is below the threshold.
+type power struct {
+	cfg config.PowerConfig
+
+	mu      sync.Mutex
+	battery uint32 // last level the attached device reported, 0 if unknown
+	low     bool
+}
+
+func newPower(cfg config.PowerConfig) *power {
+	return &power{cfg: cfg}
+}
+
+// observe records the battery level the attached device reports about
+// itself. It returns whether the relay entered or left low battery.
+func (p *power) observe(level uint32) (low, changed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.battery = level
+	low = p.cfg.BatteryThreshold > 0 && level < p.cfg.BatteryThreshold && level != externalPower
+	changed = low != p.low
+	p.low = low
+	return low, changed
+}
+
+// paused reports whether non-critical outputs are paused
+func (p *power) paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.low
+}
+
+// isCritical reports whether an output is sent to immediately in low-power
+// mode
+func isCritical(cfg config.OutputConfig) bool {
+	critical, _ := cfg.Options["critical"].(bool)
+	return critical
+}
+
+// hold queues msg for the sink's next flush
+func (k *sink) hold(msg *message.Packet) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if len(k.batch) >= maxBatch {
+		k.batch = k.batch[1:]
+	}
+	k.batch = append(k.batch, msg)
+}
+
+// takeBatch returns and clears the held packets
+func (k *sink) takeBatch() []*message.Packet {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	batch := k.batch
+	k.batch = nil
+	return batch
+}
+
+// observeBattery updates the low-power state from the attached device's
+// own telemetry
+func (s *Service) observeBattery(msg *message.Packet) {
+	t, ok := msg.Payload.(*message.Telemetry)
+	if !ok || t.BatteryLevel == 0 || msg.From == 0 || msg.From != s.localNode() {
+		return
+	}
+	low, changed := s.power.observe(t.BatteryLevel)
+	switch {
+	case changed && low:
+		s.logger.Warn("Device battery low; pausing non-critical outputs",
+			zap.Uint32("battery", t.BatteryLevel),
+			zap.Uint32("threshold", s.config.Power.BatteryThreshold))
+	case changed:
+		s.logger.Info("Device battery recovered; resuming non-critical outputs",
+			zap.Uint32("battery", t.BatteryLevel))
+	}
+}
+
+// flushBatches hands the held packets to the outputs' queues every flush
+// interval
+func (s *Service) flushBatches(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Power.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.flushOutputs(ctx)
+		}
+	}
+}
+
+// flushOutputs queues every output's held packets
+func (s *Service) flushOutputs(ctx context.Context) {
+	// Reload swaps outputs only between flushes
+	s.dispatch.RLock()
+	defer s.dispatch.RUnlock()
+	for _, k := range s.outputs {
+		s.flushSink(ctx, k)
+	}
+}
+
+// flushSink queues a sink's held packets in order. The sink's worker sends
+// them, so a slow output holds up neither the others nor a reload.
+func (s *Service) flushSink(ctx context.Context, k *sink) {
+	batch := k.takeBatch()
+	if len(batch) == 0 {
+		return
+	}
+	s.logger.Debug("Flushing batched messages", zap.String("output", k.out.Name()), zap.Int("messages", len(batch)))
+	for _, msg := range batch {
+		s.enqueue(ctx, k, msg)
+	}
+}
+
+// pollInterval returns interval, lengthened to the power poll interval in
+// low-power mode
+func (s *Service) pollInterval(interval time.Duration) time.Duration {
+	if s.power != nil && s.config.Power.PollInterval > interval {
+		return s.config.Power.PollInterval
+	}
+	return interval
+}
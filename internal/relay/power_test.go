@@ -0,0 +1,126 @@
+package relay
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestPowerBatchesNonCriticalOutputs(t *testing.T) {
+	dir := t.TempDir()
+	critical := fileOutput(dir, "critical.log", "text")
+	critical.Options["critical"] = true
+	s := startOutputs(t, &config.Config{
+		Outputs: []config.OutputConfig{critical, fileOutput(dir, "batched.log", "text")},
+		Power:   config.PowerConfig{Enabled: true, BatteryThreshold: 30},
+	})
+
+	lines := func(name string) int {
+		data, _ := os.ReadFile(filepath.Join(dir, name))
+		return strings.Count(string(data), "\n")
+	}
+	send := func(text string) {
+		s.sendToOutputs(context.Background(), &message.Packet{From: 1, Payload: &message.TextMessage{Text: text}})
+		waitOutputs(s)
+	}
+
+	send("one")
+	send("two")
+	if lines("critical.log") != 2 || lines("batched.log") != 0 {
+		t.Fatalf("before flush: critical %d, batched %d lines", lines("critical.log"), lines("batched.log"))
+	}
+	s.flushOutputs(context.Background())
+	waitOutputs(s)
+	if lines("batched.log") != 2 {
+		t.Errorf("after flush: batched %d lines", lines("batched.log"))
+	}
+
+	// Below the battery threshold non-critical outputs are paused
+	if low, changed := s.power.observe(25); !low || !changed {
+		t.Fatalf("observe(25) = %v, %v", low, changed)
+	}
+	send("three")
+	s.flushOutputs(context.Background())
+	waitOutputs(s)
+	if lines("critical.log") != 3 || lines("batched.log") != 2 {
+		t.Errorf("while paused: critical %d, batched %d lines", lines("critical.log"), lines("batched.log"))
+	}
+
+	// External power is never low
+	if low, _ := s.power.observe(externalPower); low {
+		t.Error("external power treated as low battery")
+	}
+}
+
+func TestPowerFlushQueuesBatches(t *testing.T) {
+	arrived := make(chan struct{}, 10)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		arrived <- struct{}{}
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	dir := t.TempDir()
+	s := startOutputs(t, &config.Config{
+		Outputs: []config.OutputConfig{
+			{Type: "webhook", Enabled: true, Options: map[string]interface{}{"url": srv.URL, "max_in_flight": 1}},
+			fileOutput(dir, "batched.log", "text"),
+		},
+		Power: config.PowerConfig{Enabled: true},
+	})
+	for _, text := range []string{"one", "two"} {
+		s.sendToOutputs(context.Background(), &message.Packet{From: 1, Payload: &message.TextMessage{Text: text}})
+	}
+
+	// The flush returns while the webhook is stalled on the first packet,
+	// and neither the file output nor a reload waits for it
+	s.flushOutputs(context.Background())
+	<-arrived
+	if !s.dispatch.TryLock() {
+		t.Fatal("flush still holds the outputs while the webhook is sending")
+	}
+	s.dispatch.Unlock()
+	s.outputs[1].pending.Wait()
+	data, _ := os.ReadFile(filepath.Join(dir, "batched.log"))
+	if n := strings.Count(string(data), "\n"); n != 2 {
+		t.Errorf("file output wrote %d lines while the webhook was stalled, want 2", n)
+	}
+	if queues := s.QueueStats(); queues[0].Queued != 1 {
+		t.Errorf("webhook queue = %+v, want the second packet waiting", queues[0])
+	}
+
+	release <- struct{}{}
+	release <- struct{}{}
+	waitOutputs(s)
+}
+
+func TestPowerPollInterval(t *testing.T) {
+	s, err := New(&config.Config{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if got := s.pollInterval(time.Minute); got != time.Minute {
+		t.Errorf("without low-power mode pollInterval(1m) = %v", got)
+	}
+
+	s, err = New(&config.Config{Power: config.PowerConfig{Enabled: true, PollInterval: 5 * time.Minute}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if got := s.pollInterval(time.Minute); got != 5*time.Minute {
+		t.Errorf("pollInterval(1m) = %v, want 5m", got)
+	}
+	if got := s.pollInterval(10 * time.Minute); got != 10*time.Minute {
+		t.Errorf("pollInterval(10m) = %v, want 10m", got)
+	}
+}
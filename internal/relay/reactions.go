@@ -0,0 +1,74 @@
+package relay
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/output"
+	"github.com/iamruinous/meshtastic-message-relay/internal/reactions"
+)
+
+// observeReaction tallies a relayed packet. It reports whether the packet
+// is a reaction, which updates the summary on the original message in
+// outputs that can edit it and is otherwise left for the next digest.
+func (s *Service) observeReaction(ctx context.Context, msg *message.Packet) bool {
+	summary := s.reactions.Observe(msg)
+	if summary == nil {
+		return false
+	}
+
+	s.dispatch.RLock()
+	defer s.dispatch.RUnlock()
+
+	paused := s.power != nil && s.power.paused()
+	for _, k := range s.outputs {
+		editor, ok := k.out.(output.Editor)
+		if !ok || !output.CanEdit(k.out) || paused && !k.critical {
+			continue
+		}
+		if _, err := editor.Edit(ctx, summary.ID, summary.String()); err != nil {
+			s.logger.Warn("Failed to update reaction summary",
+				zap.String("output", k.out.Name()),
+				zap.Uint32("message", summary.ID),
+				zap.Error(err))
+			s.mu.Lock()
+			s.stats.Errors++
+			s.mu.Unlock()
+		}
+	}
+	return true
+}
+
+// sendReactionDigests sends the reactions received since the last digest
+// to outputs that cannot edit their messages
+func (s *Service) sendReactionDigests(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Reactions.DigestInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			digest := s.reactions.Digest()
+			if len(digest) == 0 {
+				continue
+			}
+			s.sendToSinks(ctx, s.reactionDigest(digest, now), func(k *sink) bool {
+				return output.CanEdit(k.out)
+			})
+		}
+	}
+}
+
+// reactionDigest wraps a digest as a packet from the attached node
+func (s *Service) reactionDigest(digest []*reactions.Summary, now time.Time) *message.Packet {
+	p := reactions.Packet(digest, now)
+	p.From = s.localNode()
+	p.FromNode = s.nodes.Info(p.From)
+	s.stamp(p)
+	return p
+}
@@ -0,0 +1,81 @@
+package relay
+
+import (
+	"sync"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// recent is a ring buffer of the last messages received, which also
+// hands each new message to its subscribers
+type recent struct {
+	mu          sync.Mutex
+	buf         []*message.Packet
+	next        int
+	full        bool
+	subscribers map[chan *message.Packet]struct{}
+}
+
+func newRecent(size int) *recent {
+	if size <= 0 {
+		size = 1
+	}
+	return &recent{buf: make([]*message.Packet, size)}
+}
+
+// add stores p, dropping the oldest message when full
+func (r *recent) add(p *message.Packet) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf[r.next] = p
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+	for sub := range r.subscribers {
+		select {
+		case sub <- p:
+		default:
+		}
+	}
+}
+
+// subscribe returns a channel receiving each message added from now on,
+// and a function that ends the subscription and closes the channel.
+// Messages a subscriber has no room for are dropped.
+func (r *recent) subscribe(buffer int) (<-chan *message.Packet, func()) {
+	sub := make(chan *message.Packet, buffer)
+	r.mu.Lock()
+	if r.subscribers == nil {
+		r.subscribers = make(map[chan *message.Packet]struct{})
+	}
+	r.subscribers[sub] = struct{}{}
+	r.mu.Unlock()
+
+	var once sync.Once
+	return sub, func() {
+		once.Do(func() {
+			r.mu.Lock()
+			delete(r.subscribers, sub)
+			r.mu.Unlock()
+			close(sub)
+		})
+	}
+}
+
+// list returns up to limit of the newest messages, oldest first. A limit
+// of zero or less returns all of them.
+func (r *recent) list(limit int) []*message.Packet {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	all := make([]*message.Packet, 0, len(r.buf))
+	if r.full {
+		all = append(all, r.buf[r.next:]...)
+	}
+	all = append(all, r.buf[:r.next]...)
+	if limit > 0 && len(all) > limit {
+		all = all[len(all)-limit:]
+	}
+	return all
+}
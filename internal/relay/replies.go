@@ -0,0 +1,69 @@
+package relay
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/output"
+)
+
+// maxReplyLength bounds a reply so it fits in a single mesh text message
+const maxReplyLength = 200
+
+// replyRetry is how long to wait before listening again after an output
+// fails to fetch replies
+const replyRetry = 10 * time.Second
+
+// replySendTimeout bounds delivering a single reply to the mesh
+const replySendTimeout = 30 * time.Second
+
+// listenForReplies sends the answers to an output's messages to the mesh
+// until ctx is done
+func (s *Service) listenForReplies(ctx context.Context, out output.Output, r output.Replier) {
+	for {
+		err := r.Replies(ctx, func(reply output.Reply) {
+			s.sendReply(ctx, out, reply)
+		})
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		s.logger.Warn("Failed to fetch replies",
+			zap.String("output", out.Name()),
+			zap.Error(err))
+		if !sleep(ctx, replyRetry) {
+			return
+		}
+	}
+}
+
+// sendReply sends an answer from an output to the node whose packet it
+// replies to, prefixed with the name of the person who wrote it. Safe mode
+// keeps replies off the mesh.
+func (s *Service) sendReply(ctx context.Context, out output.Output, reply output.Reply) {
+	text := reply.Text
+	if reply.Author != "" {
+		text = reply.Author + ": " + text
+	}
+	sendCtx, cancel := context.WithTimeout(ctx, replySendTimeout)
+	defer cancel()
+	err := s.Send(sendCtx, &message.Packet{
+		To:      reply.To,
+		Channel: reply.Channel,
+		PortNum: message.PortNumTextMessage,
+		Payload: &message.TextMessage{Text: message.TrimText(text, maxReplyLength), ReplyID: reply.ReplyID},
+	})
+	if err != nil {
+		s.logger.Warn("Failed to send reply to the mesh",
+			zap.String("output", out.Name()),
+			zap.Uint32("to", reply.To),
+			zap.Error(err))
+		return
+	}
+	s.logger.Info("Sent reply to the mesh",
+		zap.String("output", out.Name()),
+		zap.Uint32("to", reply.To),
+		zap.Uint32("reply_to", reply.ReplyID))
+}
@@ -0,0 +1,119 @@
+package relay
+
+import (
+	"strings"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// router picks the output groups each packet goes to from the routes
+type router struct {
+	cfgs   []config.RouteConfig
+	routes []route
+}
+
+// route is a compiled routes entry; nil criteria match every packet
+type route struct {
+	connections []string
+	channels    map[uint32]bool
+	types       map[string]bool
+	nodes       map[uint32]bool
+	groups      []string
+	cont        bool
+}
+
+// newRouter compiles the routes. Without routes it returns nil, and every
+// packet goes to every output.
+func newRouter(cfgs []config.RouteConfig) (*router, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+	r := &router{cfgs: cfgs}
+	for _, c := range cfgs {
+		rt := route{connections: c.Connections, groups: c.Groups, cont: c.Continue}
+		if len(c.Channels) > 0 {
+			rt.channels = make(map[uint32]bool)
+			for _, ch := range c.Channels {
+				rt.channels[ch] = true
+			}
+		}
+		if len(c.MessageTypes) > 0 {
+			rt.types = make(map[string]bool)
+			for _, t := range c.MessageTypes {
+				rt.types[t] = true
+			}
+		}
+		if len(c.Nodes) > 0 {
+			rt.nodes = make(map[uint32]bool)
+			for _, id := range c.Nodes {
+				n, err := message.ParseNodeID(id)
+				if err != nil {
+					return nil, err
+				}
+				rt.nodes[n] = true
+			}
+		}
+		r.routes = append(r.routes, rt)
+	}
+	return r, nil
+}
+
+// config returns the routes the router was compiled from
+func (r *router) config() []config.RouteConfig {
+	if r == nil {
+		return nil
+	}
+	return r.cfgs
+}
+
+// groups returns the groups msg, received on the connection named conn,
+// goes to. It is empty when no route matches.
+func (r *router) groups(msg *message.Packet, conn string) map[string]bool {
+	groups := make(map[string]bool)
+	for i := range r.routes {
+		rt := &r.routes[i]
+		if !rt.matches(msg, conn) {
+			continue
+		}
+		for _, g := range rt.groups {
+			groups[g] = true
+		}
+		if !rt.cont {
+			break
+		}
+	}
+	return groups
+}
+
+func (rt *route) matches(msg *message.Packet, conn string) bool {
+	if rt.channels != nil && !rt.channels[msg.Channel] {
+		return false
+	}
+	if rt.types != nil && !rt.types[msg.PortNum.String()] {
+		return false
+	}
+	if rt.nodes != nil && !rt.nodes[msg.From] {
+		return false
+	}
+	if rt.connections == nil {
+		return true
+	}
+	for _, c := range rt.connections {
+		// A connection is named by its type or by its full name
+		if conn == c || strings.HasPrefix(conn, c+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// inGroup reports whether the sink is in one of groups
+func (k *sink) inGroup(groups map[string]bool) bool {
+	for _, g := range k.groups {
+		if groups[g] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+package relay
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// stamp numbers a packet and, with the relay clock, sets its receive time
+// to now
+func (s *Service) stamp(msg *message.Packet) {
+	if s.config.Relay.Clock == config.ClockRelay {
+		msg.ReceivedAt = time.Now()
+	}
+	if s.seq == nil {
+		return
+	}
+	n, err := s.seq.Next()
+	if err != nil {
+		s.logger.Warn("Failed to save sequence number", zap.Error(err))
+	}
+	msg.Seq = n
+}
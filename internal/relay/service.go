@@ -4,60 +4,194 @@ package relay
 import (
 	"context"
 	"fmt"
+	"math"
 	"sync"
+	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/iamruinous/meshtastic-message-relay/internal/alerts"
+	"github.com/iamruinous/meshtastic-message-relay/internal/canary"
+	"github.com/iamruinous/meshtastic-message-relay/internal/cluster"
 	"github.com/iamruinous/meshtastic-message-relay/internal/config"
 	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+	"github.com/iamruinous/meshtastic-message-relay/internal/deadletter"
+	"github.com/iamruinous/meshtastic-message-relay/internal/dedup"
+	"github.com/iamruinous/meshtastic-message-relay/internal/filter"
+	"github.com/iamruinous/meshtastic-message-relay/internal/geo"
 	"github.com/iamruinous/meshtastic-message-relay/internal/logging"
+	"github.com/iamruinous/meshtastic-message-relay/internal/mailbox"
 	"github.com/iamruinous/meshtastic-message-relay/internal/message"
-	"github.com/iamruinous/meshtastic-message-relay/internal/output"
+	"github.com/iamruinous/meshtastic-message-relay/internal/nodedb"
+	"github.com/iamruinous/meshtastic-message-relay/internal/notes"
+	"github.com/iamruinous/meshtastic-message-relay/internal/reactions"
+	"github.com/iamruinous/meshtastic-message-relay/internal/replay"
+	"github.com/iamruinous/meshtastic-message-relay/internal/scheduler"
+	"github.com/iamruinous/meshtastic-message-relay/internal/sequence"
+	"github.com/iamruinous/meshtastic-message-relay/internal/signing"
 )
 
 // Service orchestrates the message relay between connections and outputs
 type Service struct {
-	config     *config.Config
-	connection connection.Connection
-	outputs    []output.Output
-	logger     *zap.Logger
-
-	mu       sync.RWMutex
-	running  bool
-	stats    Stats
-	messages chan *message.Packet
+	config      *config.Config
+	connection  connection.Connection
+	mailbox     *mailbox.Mailbox
+	replay      *replay.Replayer
+	dedup       *dedup.Filter
+	deadLetters *deadletter.Queue
+	seq         *sequence.Counter
+	home        *geo.Home
+	nodes       *nodedb.DB
+	notes       *notes.Store
+	alerts      *alerts.Engine
+	cluster     *cluster.Cluster
+	power       *power
+	reactions   *reactions.Tracker
+	recent      *recent
+	signer      *signing.Signer
+	places      *geo.Namer      // names positions, nil if not configured
+	canaries    *canary.Tracker // nil unless canary.enabled
+	injected    chan *message.Packet
+	logger      *zap.Logger
+
+	mu         sync.RWMutex
+	running    bool
+	started    time.Time
+	lastPacket time.Time // when the last packet arrived from the connection
+	cancel     context.CancelFunc
+	stats      Stats
+	messages   chan *message.Packet
+	filters    *packetFilter // compiled filters
+	ingest     *packetFilter // compiled connection.filters, nil if unset
+	routes     *router       // compiled routes, nil if unset
+
+	// dispatch guards outputs; sends hold it for reading so a reload only
+	// swaps outputs between packets
+	dispatch sync.RWMutex
+	outputs  []*sink
+	disabled []config.OutputConfig // listed by OutputStatuses
+	reloadMu sync.Mutex
 }
 
+// alertCheckInterval is how often nodes are checked for offline alerts
+const alertCheckInterval = time.Minute
+
+// mailboxSendTimeout bounds delivering a single held message to the mesh
+const mailboxSendTimeout = 30 * time.Second
+
 // Stats holds runtime statistics for the relay service
 type Stats struct {
 	MessagesReceived uint64
 	MessagesSent     uint64
 	MessagesFiltered uint64
+	IngestDropped    uint64 // packets dropped by connection.filters on arrival
+	Duplicates       uint64
 	Errors           uint64
+	Failovers        uint64 // messages delivered through a fallback output
+	StallRecoveries  uint64 // reconnects after the connection went silent
+	DeadLettered     uint64 // messages kept for redelivery after every send failed
+	Redelivered      uint64 // kept messages delivered later
+	QueueDrops       uint64 // packets dropped because an output's queue was full
+	DeadLetters      int    // kept messages waiting for redelivery
 }
 
 // New creates a new relay service with the given configuration
 func New(cfg *config.Config) (*Service, error) {
 	logger := logging.With(zap.String("component", "relay"))
 
-	return &Service{
+	filters, ingest, err := compileFilters(cfg)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := newRouter(cfg.Routes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Safe mode covers every connection the service makes
+	if cfg.Relay.SafeMode {
+		cfg.Connection.SafeMode = true
+	}
+
+	s := &Service{
 		config:   cfg,
+		home:     geo.NewHome(cfg.Relay),
+		recent:   newRecent(cfg.API.History),
+		signer:   signing.New(cfg.Relay.SigningKey),
 		logger:   logger,
 		messages: make(chan *message.Packet, 100),
-	}, nil
+		injected: make(chan *message.Packet, 16),
+		filters:  filters,
+		ingest:   ingest,
+		routes:   routes,
+	}
+	if cfg.Power.Enabled {
+		s.power = newPower(cfg.Power)
+	}
+	if cfg.Reactions.Enabled {
+		s.reactions = reactions.New()
+	}
+	if cfg.Canary.Enabled {
+		s.canaries = canary.New(cfg.Canary, s.canaryCompleted)
+	}
+	if s.places, err = geo.NewNamer(cfg.Positions.Geocoder); err != nil {
+		return nil, err
+	}
+	return s, nil
 }
 
 // Start initializes the connection and outputs, then begins relaying messages
-func (s *Service) Start(ctx context.Context) error {
+func (s *Service) Start(ctx context.Context) (err error) {
 	s.mu.Lock()
 	if s.running {
 		s.mu.Unlock()
 		return fmt.Errorf("service is already running")
 	}
 	s.running = true
+	s.started = time.Now()
 	s.mu.Unlock()
 
+	// A failed start closes whatever it opened, saving the stores
+	defer func() {
+		if err != nil {
+			s.mu.Lock()
+			s.running = false
+			s.mu.Unlock()
+			s.shutdown()
+		}
+	}()
+
 	s.logger.Info("Starting relay service")
+	if s.config.Relay.SafeMode {
+		s.logger.Info("Safe mode: nothing will be written to the radio")
+	}
+
+	if err := prepareState(s.config); err != nil {
+		return err
+	}
+
+	// Load the nodes known from previous runs
+	nodes, err := nodedb.Open(s.config.NodeDB)
+	if err != nil {
+		return fmt.Errorf("failed to open node database: %w", err)
+	}
+	s.mu.Lock()
+	s.nodes = nodes
+	s.mu.Unlock()
+	store, err := notes.Open(s.config.Notes)
+	if err != nil {
+		return fmt.Errorf("failed to open notes: %w", err)
+	}
+	var queue *deadletter.Queue
+	if s.config.DeadLetter.Path != "" {
+		if queue, err = deadletter.Open(s.config.DeadLetter); err != nil {
+			return fmt.Errorf("failed to open dead letters: %w", err)
+		}
+	}
+	s.mu.Lock()
+	s.notes = store
+	s.deadLetters = queue
+	s.mu.Unlock()
 
 	// Initialize outputs
 	if err := s.initOutputs(); err != nil {
@@ -66,22 +200,117 @@ func (s *Service) Start(ctx context.Context) error {
 
 	// Initialize connection
 	if err := s.initConnection(); err != nil {
-		s.closeOutputs()
 		return fmt.Errorf("failed to initialize connection: %w", err)
 	}
 
 	// Connect to the Meshtastic node
 	if err := s.connection.Connect(ctx); err != nil {
-		s.closeOutputs()
 		return fmt.Errorf("failed to connect: %w", err)
 	}
 
+	// Background work stops with the service
+	ctx, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	// Start scheduled broadcasts
+	sched, err := scheduler.New(s, s.nodes, s.config.Schedules)
+	if err != nil {
+		return fmt.Errorf("failed to initialize schedules: %w", err)
+	}
+	if !s.config.Relay.SafeMode {
+		sched.Run(ctx)
+	} else if len(s.config.Schedules) > 0 {
+		s.logger.Warn("Safe mode: scheduled broadcasts are disabled",
+			zap.Int("schedules", len(s.config.Schedules)))
+	}
+
+	// Catch up on messages missed while the relay was down. Replay asks a
+	// store and forward server on the mesh, so safe mode skips it.
+	if s.config.Replay.Enabled && s.config.Relay.SafeMode {
+		s.logger.Warn("Safe mode: replay is disabled")
+	} else if s.config.Replay.Enabled {
+		s.replay, err = replay.New(s.config.Replay, s.connection)
+		if err != nil {
+			return fmt.Errorf("failed to initialize replay: %w", err)
+		}
+		s.replay.Start(ctx)
+	}
+
+	if s.config.Dedup.Enabled {
+		s.dedup, err = dedup.New(s.config.Dedup)
+		if err != nil {
+			return fmt.Errorf("failed to initialize dedup: %w", err)
+		}
+	}
+
+	s.seq, err = sequence.Open(s.config.Relay.SequenceFile)
+	if err != nil {
+		return err
+	}
+
+	if s.config.Mailbox.Enabled {
+		s.mailbox = mailbox.New(s.config.Mailbox, s.nodes)
+		if s.config.Mailbox.Deliver && s.config.Relay.SafeMode {
+			s.logger.Warn("Safe mode: held messages go to the outputs but are not delivered to nodes")
+		}
+	}
+
+	if s.config.Cluster.Enabled {
+		if err := s.joinCluster(); err != nil {
+			return fmt.Errorf("failed to join cluster: %w", err)
+		}
+	}
+
+	go s.persist(ctx)
+
+	if s.deadLetters != nil {
+		go s.redeliver(ctx)
+	}
+
+	if s.power != nil {
+		go s.flushBatches(ctx)
+		s.logger.Info("Low-power mode enabled",
+			zap.Duration("flush_interval", s.config.Power.FlushInterval),
+			zap.Duration("poll_interval", s.config.Power.PollInterval),
+			zap.Uint32("battery_threshold", s.config.Power.BatteryThreshold))
+	}
+
+	if s.reactions != nil {
+		go s.sendReactionDigests(ctx)
+	}
+
+	if s.config.Alerts.Enabled {
+		engine := alerts.New(s.config.Alerts, time.Now())
+		s.mu.Lock()
+		s.alerts = engine
+		s.mu.Unlock()
+		go s.checkAlerts(ctx, engine)
+	}
+
 	s.logger.Info("Relay service started",
 		zap.String("connection", s.connection.Name()),
-		zap.Int("outputs", len(s.outputs)))
+		zap.Int("outputs", len(s.GetOutputs())),
+		zap.Int("schedules", sched.Len()))
+
+	if s.config.Connection.StallTimeout > 0 {
+		go s.watchdog(ctx, s.config.Connection.StallTimeout)
+	}
+
+	if s.canaries != nil && s.config.Canary.Interval > 0 {
+		go s.runCanaries(ctx)
+	}
+
+	// Places are looked up off the relay loop, which only reads them
+	if s.places != nil {
+		go s.places.Run(ctx, func(p geo.Point, err error) {
+			s.logger.Debug("Failed to name position", zap.Float64("lat", p.Lat), zap.Float64("lon", p.Lon), zap.Error(err))
+		})
+	}
 
 	// Start the message relay loop
-	go s.relayLoop(ctx)
+	go s.relayLoop(ctx, s.connection)
 
 	return nil
 }
@@ -89,27 +318,69 @@ func (s *Service) Start(ctx context.Context) error {
 // Stop gracefully shuts down the relay service
 func (s *Service) Stop() error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	if !s.running {
+		s.mu.Unlock()
 		return nil
 	}
 
 	s.logger.Info("Stopping relay service")
 	s.running = false
+	s.mu.Unlock()
+
+	s.shutdown()
+
+	s.logger.Info("Relay service stopped")
+	return nil
+}
+
+// shutdown stops background work and closes the connection, the stores,
+// and the outputs that are open, as Stop and a failed Start do
+func (s *Service) shutdown() {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	conn := s.connection
+	s.mu.Unlock()
 
 	// Close connection
-	if s.connection != nil {
-		if err := s.connection.Close(); err != nil {
+	if conn != nil {
+		if err := conn.Close(); err != nil {
 			s.logger.Error("Error closing connection", zap.Error(err))
 		}
 	}
 
-	// Close outputs
-	s.closeOutputs()
+	if s.cluster != nil {
+		s.cluster.Close()
+	}
 
-	s.logger.Info("Relay service stopped")
-	return nil
+	if s.replay != nil {
+		if err := s.replay.Close(); err != nil {
+			s.logger.Error("Error saving replay state", zap.Error(err))
+		}
+	}
+
+	if s.nodes != nil {
+		if err := s.nodes.Close(); err != nil {
+			s.logger.Error("Error saving node database", zap.Error(err))
+		}
+	}
+
+	if s.dedup != nil {
+		if err := s.dedup.Close(); err != nil {
+			s.logger.Error("Error saving dedup state", zap.Error(err))
+		}
+	}
+
+	if s.seq != nil {
+		if err := s.seq.Close(); err != nil {
+			s.logger.Error("Error saving sequence number", zap.Error(err))
+		}
+	}
+
+	// Close outputs once in-flight sends finish; those sends update stats
+	// under s.mu, so it must not be held here
+	s.closeOutputs()
 }
 
 // IsRunning returns true if the service is currently running
@@ -123,7 +394,11 @@ func (s *Service) IsRunning() bool {
 func (s *Service) GetStats() Stats {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.stats
+	stats := s.stats
+	if s.deadLetters != nil {
+		stats.DeadLetters = s.deadLetters.Len()
+	}
+	return stats
 }
 
 // GetConnection returns the current connection (may be nil)
@@ -133,52 +408,122 @@ func (s *Service) GetConnection() connection.Connection {
 	return s.connection
 }
 
-// GetOutputs returns the configured outputs
-func (s *Service) GetOutputs() []output.Output {
+// Send sends a packet the relay originates to the mesh, signing text
+// messages when a signing key is configured. It fails with
+// connection.ErrSafeMode in safe mode.
+func (s *Service) Send(ctx context.Context, packet *message.Packet) error {
+	if s.config.Relay.SafeMode {
+		return connection.ErrSafeMode
+	}
+	conn := s.GetConnection()
+	if conn == nil {
+		return fmt.Errorf("not connected")
+	}
+	if s.signer != nil {
+		s.signer.SignPacket(packet)
+	}
+	return conn.Send(ctx, packet)
+}
+
+// SendAndWaitAck sends a packet as Send does, with want_ack set, and
+// waits for its destination to acknowledge it. It fails when the
+// connection cannot wait for acks (MQTT).
+func (s *Service) SendAndWaitAck(ctx context.Context, packet *message.Packet) (connection.Ack, error) {
+	if s.config.Relay.SafeMode {
+		return connection.Ack{}, connection.ErrSafeMode
+	}
+	acker, ok := s.GetConnection().(connection.AckTransport)
+	if !ok {
+		return connection.Ack{}, fmt.Errorf("connection cannot wait for acks")
+	}
+	if s.signer != nil {
+		s.signer.SignPacket(packet)
+	}
+	return acker.SendAndWaitAck(ctx, packet)
+}
+
+// SafeMode reports whether the relay is kept from writing to the radio
+func (s *Service) SafeMode() bool {
+	return s.config.Relay.SafeMode
+}
+
+// StartedAt returns when the service was started
+func (s *Service) StartedAt() time.Time {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.outputs
+	return s.started
 }
 
-func (s *Service) initConnection() error {
-	var err error
-	s.connection, err = connection.New(&s.config.Connection)
-	return err
+// LastPacket returns when the last packet arrived from the connection,
+// or the zero time if none has since the service started
+func (s *Service) LastPacket() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastPacket
 }
 
-func (s *Service) initOutputs() error {
-	s.outputs = make([]output.Output, 0)
+// Recent returns up to limit of the newest messages received, oldest
+// first, whether or not they passed the filters. A limit of zero or less
+// returns all that are kept.
+func (s *Service) Recent(limit int) []*message.Packet {
+	return s.recent.list(limit)
+}
 
-	for _, outCfg := range s.config.Outputs {
-		if !outCfg.Enabled {
-			continue
-		}
+// Subscribe returns a channel receiving each message from now on, as
+// Recent would list them, and a function that ends the subscription.
+// Messages are dropped for a subscriber with no room in its buffer
+// rather than holding up the relay.
+func (s *Service) Subscribe(buffer int) (<-chan *message.Packet, func()) {
+	return s.recent.subscribe(buffer)
+}
 
-		out, err := output.New(outCfg)
-		if err != nil {
-			return fmt.Errorf("failed to create output %s: %w", outCfg.Type, err)
-		}
-		s.outputs = append(s.outputs, out)
-		s.logger.Debug("Initialized output", zap.String("type", outCfg.Type), zap.String("name", out.Name()))
-	}
+// Nodes returns the node database (nil before Start)
+func (s *Service) Nodes() *nodedb.DB {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.nodes
+}
 
-	if len(s.outputs) == 0 {
-		return fmt.Errorf("no outputs enabled")
-	}
+// Notes returns the operator notes on packets and nodes (nil before Start)
+func (s *Service) Notes() *notes.Store {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.notes
+}
 
-	return nil
+// Alerts returns the alert engine (nil when alerts are disabled or before
+// Start)
+func (s *Service) Alerts() *alerts.Engine {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.alerts
 }
 
-func (s *Service) closeOutputs() {
-	for _, out := range s.outputs {
-		if err := out.Close(); err != nil {
-			s.logger.Error("Error closing output", zap.String("output", out.Name()), zap.Error(err))
-		}
+// Home returns the relay's home position, which may be updated at runtime
+func (s *Service) Home() *geo.Home {
+	return s.home
+}
+
+// UseConnection makes Start use conn in place of the configured
+// connection, e.g. to play back recorded packets. The watchdog does not
+// replace it.
+func (s *Service) UseConnection(conn connection.Connection) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connection = conn
+}
+
+func (s *Service) initConnection() error {
+	if s.GetConnection() != nil {
+		return nil
 	}
+	var err error
+	s.connection, err = connection.New(&s.config.Connection)
+	return err
 }
 
-func (s *Service) relayLoop(ctx context.Context) {
-	msgChan := s.connection.Messages()
+func (s *Service) relayLoop(ctx context.Context, conn connection.Connection) {
+	msgChan := conn.Messages()
 
 	for {
 		select {
@@ -186,6 +531,9 @@ func (s *Service) relayLoop(ctx context.Context) {
 			s.logger.Debug("Relay loop stopped: context canceled")
 			return
 
+		case msg := <-s.injected:
+			s.dispatchCanary(ctx, msg)
+
 		case msg, ok := <-msgChan:
 			if !ok {
 				s.logger.Debug("Relay loop stopped: message channel closed")
@@ -194,24 +542,358 @@ func (s *Service) relayLoop(ctx context.Context) {
 
 			s.mu.Lock()
 			s.stats.MessagesReceived++
+			s.lastPacket = time.Now()
 			s.mu.Unlock()
 
+			// Connection filters shed packets before anything else
+			// spends time on them
+			if !s.admit(msg) {
+				s.mu.Lock()
+				s.stats.IngestDropped++
+				s.mu.Unlock()
+				continue
+			}
+
+			if s.dedup != nil && s.dedup.Duplicate(msg) {
+				s.mu.Lock()
+				s.stats.Duplicates++
+				s.mu.Unlock()
+				continue
+			}
+
+			s.stamp(msg)
+
+			if s.signer != nil {
+				s.signer.VerifyPacket(msg)
+			}
+
+			if s.replay != nil {
+				if msg = s.replay.Process(ctx, msg); msg == nil {
+					continue
+				}
+			}
+
+			s.nodes.Observe(msg)
+			if s.power != nil {
+				s.observeBattery(msg)
+			}
+			if s.cluster != nil {
+				s.cluster.Share(msg)
+			}
+			s.nameSender(msg)
+
+			if s.alerts != nil {
+				s.alerts.Observe(msg)
+			}
+
+			s.enrichPosition(msg)
+			s.locate(msg)
+			s.recent.add(msg)
+
+			if s.mailbox != nil {
+				s.checkMailbox(ctx, msg)
+			}
+
 			// Apply filters
-			if !s.shouldRelay(msg) {
+			if !s.ShouldRelay(msg) {
 				s.mu.Lock()
 				s.stats.MessagesFiltered++
 				s.mu.Unlock()
 				continue
 			}
 
+			// Reactions are summarized rather than relayed one by one
+			if s.reactions != nil && s.observeReaction(ctx, msg) {
+				continue
+			}
+
 			// Send to all outputs
 			s.sendToOutputs(ctx, msg)
 		}
 	}
 }
 
-func (s *Service) shouldRelay(msg *message.Packet) bool {
-	filters := s.config.Filters
+// nameSender fills in the sender's name from the node database when the
+// connection did not know it, and applies the sender's alias
+func (s *Service) nameSender(msg *message.Packet) {
+	if msg.FromNode == nil || msg.FromNode.User == nil {
+		if info := s.nodes.Info(msg.From); info != nil {
+			msg.FromNode = info
+		}
+		return
+	}
+	if alias, ok := s.nodes.Alias(msg.From); ok && msg.FromNode.User.LongName != alias {
+		node := *msg.FromNode
+		user := *node.User
+		user.LongName = alias
+		node.User = &user
+		msg.FromNode = &node
+	}
+}
+
+// joinCluster starts sharing node and dedup updates with other relays
+func (s *Service) joinCluster() error {
+	c, err := cluster.New(s.config.Cluster, s.nodes, s.dedup)
+	if err != nil {
+		return err
+	}
+	if err := c.Start(); err != nil {
+		return err
+	}
+	if s.dedup == nil {
+		s.logger.Warn("Dedup is disabled; packets other relays handled will still be relayed")
+	}
+	s.cluster = c
+	return nil
+}
+
+// persist merges the device's node database into the relay's and saves
+// the node database and dedup state periodically
+func (s *Service) persist(ctx context.Context) {
+	interval := s.config.NodeDB.SaveInterval
+	if interval <= 0 {
+		interval = config.DefaultConfig().NodeDB.SaveInterval
+	}
+	if s.power != nil && s.config.Power.SaveInterval > interval {
+		interval = s.config.Power.SaveInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if dir, ok := s.GetConnection().(connection.NodeDirectory); ok {
+			s.nodes.Import(dir.Nodes())
+		}
+		if err := s.nodes.Save(); err != nil {
+			s.logger.Warn("Failed to save node database", zap.Error(err))
+		}
+		if s.dedup != nil {
+			if err := s.dedup.Save(); err != nil {
+				s.logger.Warn("Failed to save dedup state", zap.Error(err))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkAlerts raises offline alerts for nodes that have gone quiet
+func (s *Service) checkAlerts(ctx context.Context, engine *alerts.Engine) {
+	interval := alertCheckInterval
+	if s.power != nil && s.config.Power.CheckInterval > interval {
+		interval = s.config.Power.CheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			engine.Check(s.nodes.List(), now)
+		}
+	}
+}
+
+// enrichPosition learns the home position from the attached node's own
+// position reports and annotates other nodes' positions with their
+// distance and bearing from home
+func (s *Service) enrichPosition(msg *message.Packet) {
+	pos, ok := msg.Payload.(*message.Position)
+	if !ok || pos.Latitude == 0 && pos.Longitude == 0 {
+		return
+	}
+	at := geo.Point{Lat: pos.Latitude, Lon: pos.Longitude}
+
+	self := s.localNode()
+	if self != 0 && msg.From == self {
+		s.learnHome(at)
+		return
+	}
+
+	if _, _, known := s.home.Get(); !known {
+		s.learnHomeFromNodeDB(self)
+	}
+	home, _, known := s.home.Get()
+	if !known {
+		return
+	}
+	pos.Distance = math.Round(geo.Distance(home, at))
+	pos.Bearing = math.Round(geo.Bearing(home, at)*10) / 10
+}
+
+// locate adds a map link and the place name to position reports, as
+// configured under positions. A place not yet looked up is left unnamed.
+func (s *Service) locate(msg *message.Packet) {
+	pos, ok := msg.Payload.(*message.Position)
+	if !ok || pos.Latitude == 0 && pos.Longitude == 0 {
+		return
+	}
+	at := geo.Point{Lat: pos.Latitude, Lon: pos.Longitude}
+	pos.MapURL = geo.MapLink(s.config.Positions.MapLinks, at)
+	if s.places != nil {
+		pos.Place = s.places.Name(at)
+	}
+}
+
+// localNode returns the attached device's node number, or 0 if unknown
+func (s *Service) localNode() uint32 {
+	local, ok := s.GetConnection().(connection.LocalNode)
+	if !ok {
+		return 0
+	}
+	if info := local.GetMyInfo(); info != nil {
+		return info.MyNodeNum
+	}
+	return 0
+}
+
+// learnHomeFromNodeDB uses the position the device reported for itself
+// when the connection was configured
+func (s *Service) learnHomeFromNodeDB(self uint32) {
+	dir, ok := s.GetConnection().(connection.NodeDirectory)
+	if self == 0 || !ok {
+		return
+	}
+	node := dir.GetNodeInfo(self)
+	if node == nil || node.Position == nil || node.Position.LatitudeI == 0 && node.Position.LongitudeI == 0 {
+		return
+	}
+	s.learnHome(geo.Point{Lat: node.Position.Latitude(), Lon: node.Position.Longitude()})
+}
+
+// learnHome follows the device's position unless the home was set otherwise
+func (s *Service) learnHome(at geo.Point) {
+	if s.home.Learn(at) {
+		s.logger.Info("Home position learned from device",
+			zap.Float64("lat", at.Lat),
+			zap.Float64("lon", at.Lon))
+	}
+}
+
+// checkMailbox holds direct messages for offline recipients and sends a
+// digest when a node with held messages is heard again. Digests bypass the
+// filters since they are notifications the operator opted into. Safe mode
+// keeps held messages from being delivered to the node.
+func (s *Service) checkMailbox(ctx context.Context, msg *message.Packet) {
+	digest, held := s.mailbox.Observe(msg)
+	if held {
+		s.logger.Debug("Holding message for offline node",
+			zap.Uint32("to", msg.To),
+			zap.Int("held", s.mailbox.Held(msg.To)))
+	}
+	if digest == nil {
+		return
+	}
+
+	s.logger.Info("Node back online with held messages",
+		zap.Uint32("node", digest.Node),
+		zap.Int("messages", len(digest.Messages)))
+	p := digest.Packet(time.Now())
+	s.stamp(p)
+	s.sendToOutputs(ctx, p)
+
+	if s.config.Mailbox.Deliver && !s.config.Relay.SafeMode {
+		go s.deliverDigest(ctx, digest)
+	}
+}
+
+// deliverDigest sends each held message to the returning node as a DM
+func (s *Service) deliverDigest(ctx context.Context, digest *mailbox.Digest) {
+	for _, line := range digest.Lines() {
+		sendCtx, cancel := context.WithTimeout(ctx, mailboxSendTimeout)
+		err := s.Send(sendCtx, &message.Packet{
+			To:      digest.Node,
+			Channel: digest.Messages[0].Channel,
+			PortNum: message.PortNumTextMessage,
+			Payload: &message.TextMessage{Text: line},
+		})
+		cancel()
+		if err != nil {
+			s.logger.Warn("Failed to deliver held message",
+				zap.Uint32("node", digest.Node),
+				zap.Error(err))
+			return
+		}
+	}
+}
+
+// ShouldRelay reports whether msg passes the configured filters
+func (s *Service) ShouldRelay(msg *message.Packet) bool {
+	s.mu.RLock()
+	f := s.filters
+	s.mu.RUnlock()
+	return f.match(msg)
+}
+
+// admit reports whether msg from the connection passes connection.filters
+func (s *Service) admit(msg *message.Packet) bool {
+	s.mu.RLock()
+	f := s.ingest
+	s.mu.RUnlock()
+	return f == nil || f.match(msg)
+}
+
+// packetFilter is a compiled FilterConfig
+type packetFilter struct {
+	cfg      config.FilterConfig
+	where    *filter.Expr         // compiled expression, nil if unset
+	patterns *filter.TextPatterns // compiled text_patterns, nil if unset
+}
+
+// newPacketFilter compiles the filter settings named name
+func newPacketFilter(cfg config.FilterConfig, name string) (*packetFilter, error) {
+	f := &packetFilter{cfg: cfg}
+	if cfg.Expression != "" {
+		var err error
+		if f.where, err = filter.Compile(cfg.Expression); err != nil {
+			return nil, fmt.Errorf("%s.expression: %w", name, err)
+		}
+	}
+	patterns, err := filter.NewTextPatterns(cfg.TextPatterns.Include, cfg.TextPatterns.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("%s.text_patterns.%w", name, err)
+	}
+	f.patterns = patterns
+	return f, nil
+}
+
+// compileFilters compiles the top-level filters and connection.filters,
+// the latter nil when it sets nothing
+func compileFilters(cfg *config.Config) (filters, ingest *packetFilter, err error) {
+	if filters, err = newPacketFilter(cfg.Filters, "filters"); err != nil {
+		return nil, nil, err
+	}
+	if emptyFilters(cfg.Connection.Filters) {
+		return filters, nil, nil
+	}
+	if ingest, err = newPacketFilter(cfg.Connection.Filters, "connection.filters"); err != nil {
+		return nil, nil, err
+	}
+	return filters, ingest, nil
+}
+
+func emptyFilters(f config.FilterConfig) bool {
+	return len(f.MessageTypes) == 0 && len(f.NodeIDs) == 0 && len(f.Channels) == 0 &&
+		f.Expression == "" && len(f.TextPatterns.Include) == 0 && len(f.TextPatterns.Exclude) == 0
+}
+
+// config returns the filter settings, empty for a nil filter
+func (f *packetFilter) config() config.FilterConfig {
+	if f == nil {
+		return config.FilterConfig{}
+	}
+	return f.cfg
+}
+
+// match reports whether msg passes the filters
+func (f *packetFilter) match(msg *message.Packet) bool {
+	filters := f.cfg
 
 	// Filter by message type
 	if len(filters.MessageTypes) > 0 {
@@ -256,22 +938,8 @@ func (s *Service) shouldRelay(msg *message.Packet) bool {
 		}
 	}
 
-	return true
-}
-
-func (s *Service) sendToOutputs(ctx context.Context, msg *message.Packet) {
-	for _, out := range s.outputs {
-		if err := out.Send(ctx, msg); err != nil {
-			s.logger.Error("Failed to send message to output",
-				zap.String("output", out.Name()),
-				zap.Error(err))
-			s.mu.Lock()
-			s.stats.Errors++
-			s.mu.Unlock()
-		} else {
-			s.mu.Lock()
-			s.stats.MessagesSent++
-			s.mu.Unlock()
-		}
+	if f.patterns != nil && !f.patterns.Match(msg) {
+		return false
 	}
+	return f.where == nil || f.where.Match(msg)
 }
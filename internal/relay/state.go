@@ -0,0 +1,27 @@
+package relay
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/state"
+)
+
+// prepareState creates the directories of the files kept across restarts
+// and checks they can be written, so a read-only or missing state
+// directory stops the relay at startup instead of failing the first save
+func prepareState(cfg *config.Config) error {
+	prepared := make(map[string]bool)
+	for _, f := range cfg.StateFiles() {
+		dir := filepath.Dir(f.Path)
+		if prepared[dir] {
+			continue
+		}
+		if err := state.Prepare(dir); err != nil {
+			return fmt.Errorf("%s: %w", f.Key, err)
+		}
+		prepared[dir] = true
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package relay
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+)
+
+// maxReconnectDelay caps the wait between reconnect attempts after a stall
+const maxReconnectDelay = time.Minute
+
+// watchdog reconnects when the connection stays open but receives nothing
+// from the device for the stall timeout. Connections that cannot report
+// activity are not watched.
+func (s *Service) watchdog(ctx context.Context, timeout time.Duration) {
+	if _, ok := s.GetConnection().(connection.Activity); !ok {
+		return
+	}
+
+	interval := s.pollInterval(min(max(timeout/4, time.Second), time.Minute))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// A fresh connection gets the full timeout before its first frame
+	since := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			conn := s.GetConnection()
+			act, ok := conn.(connection.Activity)
+			if !ok || !conn.IsConnected() {
+				continue
+			}
+			last := act.LastFrame()
+			if last.Before(since) {
+				last = since
+			}
+			if now.Sub(last) < timeout {
+				continue
+			}
+
+			s.logger.Warn("No frames from the device; reconnecting",
+				zap.String("connection", conn.Name()),
+				zap.Duration("silent_for", now.Sub(last).Round(time.Second)))
+			s.mu.Lock()
+			s.stats.StallRecoveries++
+			s.mu.Unlock()
+
+			if !s.reconnect(ctx, conn) {
+				return
+			}
+			since = time.Now()
+		}
+	}
+}
+
+// reconnect closes a stalled connection and replaces it with a new one,
+// retrying with backoff until it connects. It returns false if the service
+// stopped first.
+func (s *Service) reconnect(ctx context.Context, old connection.Connection) bool {
+	if err := old.Close(); err != nil {
+		s.logger.Warn("Error closing stalled connection", zap.Error(err))
+	}
+
+	delay := time.Second
+	for {
+		conn, err := connection.New(&s.config.Connection)
+		if err == nil {
+			if err = conn.Connect(ctx); err == nil {
+				s.mu.Lock()
+				if !s.running || ctx.Err() != nil {
+					s.mu.Unlock()
+					_ = conn.Close()
+					return false
+				}
+				s.connection = conn
+				s.mu.Unlock()
+
+				s.logger.Info("Reconnected after stall", zap.String("connection", conn.Name()))
+				go s.relayLoop(ctx, conn)
+				return true
+			}
+		}
+		s.logger.Warn("Reconnect failed", zap.Error(err), zap.Duration("retry_in", delay))
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
@@ -0,0 +1,50 @@
+//go:build unix
+
+package relay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic/simulator"
+)
+
+func TestWatchdogReconnectsStalledConnection(t *testing.T) {
+	device := simulator.NewTestDevice(t)
+	defer device.Stop()
+	path := device.Start()
+
+	cfg := config.DefaultConfig()
+	cfg.Connection.Type = "serial"
+	cfg.Connection.Serial.Port = path
+	cfg.Connection.StallTimeout = time.Second
+	cfg.NodeDB.Path = ""
+	cfg.Outputs = []config.OutputConfig{fileOutput(t.TempDir(), "out.log", "json")}
+
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = s.Stop() }()
+	first := s.GetConnection()
+
+	// The simulator sends its config and then nothing
+	deadline := time.Now().Add(10 * time.Second)
+	for s.GetStats().StallRecoveries == 0 || !s.GetConnection().IsConnected() {
+		if time.Now().After(deadline) {
+			t.Fatalf("no recovery: stats %+v", s.GetStats())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if s.GetConnection() == first {
+		t.Error("connection was not replaced")
+	}
+	if first.IsConnected() {
+		t.Error("stalled connection is still open")
+	}
+}
@@ -0,0 +1,239 @@
+// Package replay catches up on messages missed while the relay was down by
+// requesting history from a Store & Forward server on the mesh.
+package replay
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+	"github.com/iamruinous/meshtastic-message-relay/internal/logging"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/state"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+// saveInterval limits how often the last-seen time is written to disk
+const saveInterval = time.Minute
+
+// requestTimeout bounds sending the history request
+const requestTimeout = 30 * time.Second
+
+// Replayer requests history once at startup and turns the replayed
+// messages that arrive in response into regular text packets. Messages
+// the relay already handled before it stopped are dropped.
+type Replayer struct {
+	conn      connection.Connection
+	window    time.Duration
+	statePath string
+	logger    *zap.Logger
+	now       func() time.Time
+
+	mu        sync.Mutex
+	server    uint32
+	requested bool
+	// since and started bound the gap to fill: replayed messages outside
+	// it were either relayed before the restart or received live
+	since    time.Time
+	started  time.Time
+	lastSeen time.Time
+	savedAt  time.Time
+}
+
+// New creates a replayer, loading the last-seen time from the state file
+func New(cfg config.ReplayConfig, conn connection.Connection) (*Replayer, error) {
+	r := &Replayer{
+		conn:      conn,
+		window:    cfg.Window,
+		statePath: cfg.StateFile,
+		logger:    logging.With(zap.String("component", "replay")),
+		now:       time.Now,
+	}
+
+	if cfg.Server != "" {
+		server, err := message.ParseNodeID(cfg.Server)
+		if err != nil {
+			return nil, fmt.Errorf("invalid replay server: %w", err)
+		}
+		r.server = server
+	}
+
+	lastSeen, err := loadState(r.statePath)
+	if err != nil {
+		return nil, err
+	}
+	r.lastSeen = lastSeen
+	r.since = lastSeen
+	r.started = r.now()
+	return r, nil
+}
+
+// Start requests history right away when the server is configured.
+// Otherwise the request goes to the first server heard on the mesh.
+func (r *Replayer) Start(ctx context.Context) {
+	r.mu.Lock()
+	server := r.server
+	r.mu.Unlock()
+
+	if server != 0 {
+		go r.request(ctx, server)
+	}
+}
+
+// Process handles a received packet. Replayed messages are returned as
+// text packets, or nil if they were already relayed; other packets are
+// returned unchanged.
+func (r *Replayer) Process(ctx context.Context, p *message.Packet) *message.Packet {
+	sf, ok := p.Payload.(*message.StoreForward)
+	if !ok {
+		r.seen(p.ReceivedAt)
+		return p
+	}
+
+	if !sf.IsText() {
+		r.discover(ctx, p.From, sf)
+		return p
+	}
+
+	r.mu.Lock()
+	fresh := p.ReceivedAt.After(r.since) && p.ReceivedAt.Before(r.started)
+	r.mu.Unlock()
+	if !fresh {
+		return nil
+	}
+
+	replayed := *p
+	replayed.PortNum = message.PortNumTextMessage
+	replayed.Payload = &message.TextMessage{Text: sf.Text}
+	replayed.RawPayload = []byte(sf.Text)
+	r.seen(p.ReceivedAt)
+	return &replayed
+}
+
+// Close saves the last-seen time
+func (r *Replayer) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.save()
+}
+
+// discover requests history from the first server heard, if no server
+// was configured
+func (r *Replayer) discover(ctx context.Context, from uint32, sf *message.StoreForward) {
+	if !strings.HasPrefix(sf.RR, "ROUTER_") {
+		return
+	}
+
+	r.mu.Lock()
+	if r.server != 0 || r.requested {
+		r.mu.Unlock()
+		return
+	}
+	r.server = from
+	r.mu.Unlock()
+
+	r.logger.Info("Found Store & Forward server", zap.String("server", fmt.Sprintf("!%08x", from)))
+	go r.request(ctx, from)
+}
+
+// request asks the server for the messages it stored since the relay
+// last saw one, bounded by the configured window
+func (r *Replayer) request(ctx context.Context, server uint32) {
+	r.mu.Lock()
+	if r.requested {
+		r.mu.Unlock()
+		return
+	}
+	r.requested = true
+	window := r.window
+	if !r.since.IsZero() {
+		if gap := r.started.Sub(r.since); gap < window {
+			window = gap
+		}
+	}
+	r.mu.Unlock()
+
+	minutes := uint32(math.Ceil(window.Minutes()))
+	if minutes == 0 {
+		return
+	}
+
+	req := &meshtastic.StoreAndForward{
+		RR:      meshtastic.StoreForwardClientHistory,
+		History: &meshtastic.StoreForwardHistory{Window: minutes},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	err := r.conn.Send(ctx, &message.Packet{
+		To:         server,
+		PortNum:    message.PortNumStoreForward,
+		RawPayload: req.Marshal(),
+	})
+	if err != nil {
+		r.logger.Warn("Failed to request history", zap.Error(err))
+		return
+	}
+
+	r.logger.Info("Requested message history",
+		zap.String("server", fmt.Sprintf("!%08x", server)),
+		zap.Uint32("window_minutes", minutes))
+}
+
+// seen records that messages up to t have been handled
+func (r *Replayer) seen(t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !t.After(r.lastSeen) {
+		return
+	}
+	r.lastSeen = t
+
+	if r.now().Sub(r.savedAt) >= saveInterval {
+		if err := r.save(); err != nil {
+			r.logger.Warn("Failed to save replay state", zap.Error(err))
+		}
+	}
+}
+
+func (r *Replayer) save() error {
+	if r.statePath == "" || r.lastSeen.IsZero() {
+		return nil
+	}
+
+	if err := state.WriteFile(r.statePath, []byte(r.lastSeen.UTC().Format(time.RFC3339Nano)+"\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+
+	r.savedAt = r.now()
+	return nil
+}
+
+func loadState(path string) (time.Time, error) {
+	if path == "" {
+		return time.Time{}, nil
+	}
+
+	var t time.Time
+	err := state.Load(path, func(data []byte) error {
+		parsed, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+		if err != nil {
+			return err
+		}
+		t = parsed
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read replay state: %w", err)
+	}
+	return t, nil
+}
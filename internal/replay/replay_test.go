@@ -0,0 +1,125 @@
+package replay
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+type fakeConn struct {
+	mu   sync.Mutex
+	sent []*message.Packet
+}
+
+func (f *fakeConn) Connect(context.Context) error    { return nil }
+func (f *fakeConn) Messages() <-chan *message.Packet { return nil }
+func (f *fakeConn) Close() error                     { return nil }
+func (f *fakeConn) Name() string                     { return "fake" }
+func (f *fakeConn) IsConnected() bool                { return true }
+func (f *fakeConn) Send(_ context.Context, p *message.Packet) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, p)
+	return nil
+}
+
+func (f *fakeConn) requests() []*message.Packet {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*message.Packet(nil), f.sent...)
+}
+
+func replayed(from uint32, at time.Time, text string) *message.Packet {
+	return &message.Packet{
+		From:       from,
+		PortNum:    message.PortNumStoreForward,
+		Payload:    &message.StoreForward{RR: "ROUTER_TEXT_BROADCAST", Text: text},
+		ReceivedAt: at,
+	}
+}
+
+func TestReplayFillsGap(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "state", "last_seen")
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	conn := &fakeConn{}
+
+	// First run relays a message and saves its time
+	r, err := New(config.ReplayConfig{Window: 2 * time.Hour, StateFile: state}, conn)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	r.Process(context.Background(), &message.Packet{From: 1, ReceivedAt: start})
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Restart 30 minutes later with a known server
+	now := start.Add(30 * time.Minute)
+	r, err = New(config.ReplayConfig{Server: "!0000abcd", Window: 2 * time.Hour, StateFile: state}, conn)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	r.now = func() time.Time { return now }
+	r.started = now
+	r.Start(context.Background())
+
+	deadline := time.Now().Add(time.Second)
+	for len(conn.requests()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	reqs := conn.requests()
+	if len(reqs) != 1 || reqs[0].To != 0xabcd {
+		t.Fatalf("expected one history request to the server, got %+v", reqs)
+	}
+	sf, err := meshtastic.ParseStoreAndForward(reqs[0].RawPayload)
+	if err != nil || sf.RR != meshtastic.StoreForwardClientHistory || sf.History == nil || sf.History.Window != 30 {
+		t.Errorf("unexpected request: %+v, %v", sf, err)
+	}
+
+	if p := r.Process(context.Background(), replayed(2, start.Add(-time.Minute), "old")); p != nil {
+		t.Error("message relayed before the restart was replayed")
+	}
+	p := r.Process(context.Background(), replayed(2, start.Add(10*time.Minute), "missed"))
+	if p == nil {
+		t.Fatal("missed message dropped")
+	}
+	text, ok := p.Payload.(*message.TextMessage)
+	if !ok || text.Text != "missed" || p.PortNum != message.PortNumTextMessage || p.From != 2 {
+		t.Errorf("unexpected replayed packet: %+v", p)
+	}
+	if p := r.Process(context.Background(), replayed(2, now.Add(time.Minute), "live")); p != nil {
+		t.Error("message received live was replayed")
+	}
+}
+
+func TestReplayDiscoversServer(t *testing.T) {
+	conn := &fakeConn{}
+	r, err := New(config.ReplayConfig{Window: time.Hour}, conn)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	r.Start(context.Background())
+
+	heartbeat := &message.Packet{
+		From:    0x1234,
+		PortNum: message.PortNumStoreForward,
+		Payload: &message.StoreForward{RR: "ROUTER_HEARTBEAT"},
+	}
+	if p := r.Process(context.Background(), heartbeat); p != heartbeat {
+		t.Error("heartbeat not passed through")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(conn.requests()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if reqs := conn.requests(); len(reqs) != 1 || reqs[0].To != 0x1234 {
+		t.Fatalf("expected one request to the heartbeat sender, got %+v", reqs)
+	}
+}
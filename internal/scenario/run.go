@@ -0,0 +1,317 @@
+package scenario
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/relay"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic/simulator"
+)
+
+// pollInterval is how often expectations are checked while waiting
+const pollInterval = 100 * time.Millisecond
+
+// Result is the outcome of a scenario
+type Result struct {
+	Name string
+	Path string
+	// Err is set when the scenario could not run
+	Err error
+	// Failures lists the expectations that were not met
+	Failures []string
+	Duration time.Duration
+}
+
+// Passed reports whether the scenario ran and met every expectation
+func (r *Result) Passed() bool {
+	return r.Err == nil && len(r.Failures) == 0
+}
+
+// Run plays the scenario against a relay built from its config and checks
+// the expectations. The relay connects to a simulated device over a
+// pseudo-terminal; its API server, cluster membership, startup replay,
+// and state files are disabled so scenarios leave nothing behind.
+func Run(ctx context.Context, sc *Scenario) *Result {
+	start := time.Now()
+	res := &Result{Name: sc.Name, Path: sc.Path}
+	res.Failures, res.Err = sc.run(ctx)
+	res.Duration = time.Since(start)
+	return res
+}
+
+func (sc *Scenario) run(ctx context.Context) ([]string, error) {
+	workdir, err := os.MkdirTemp("", "meshtastic-scenario-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create work directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(workdir) }()
+
+	rec := &receiver{}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start mock receiver: %w", err)
+	}
+	srv := &http.Server{Handler: rec, ReadHeaderTimeout: 5 * time.Second}
+	go func() { _ = srv.Serve(ln) }()
+	defer func() { _ = srv.Close() }()
+
+	data, err := sc.configData("http://"+ln.Addr().String(), workdir)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.LoadYAML(data)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sc.Timeout+30*time.Second)
+	defer cancel()
+
+	device := simulator.New(sc.deviceConfig())
+	path, err := device.Start(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start simulator: %w", err)
+	}
+	defer func() { _ = device.Stop() }()
+
+	isolate(cfg, path)
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	service, err := relay.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := service.Start(ctx); err != nil {
+		return nil, fmt.Errorf("failed to start relay: %w", err)
+	}
+	defer func() { _ = service.Stop() }()
+
+	deadline := time.Now().Add(sc.Timeout)
+	for !device.ConfigSent() {
+		if time.Now().After(deadline) {
+			return nil, errors.New("relay did not request the device config")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := sc.play(ctx, device); err != nil {
+		return nil, err
+	}
+
+	// Wait for the expectations to hold through the settle time, or
+	// report what is still unmet at the deadline
+	ended := time.Now()
+	deadline = ended.Add(sc.Timeout)
+	for {
+		failures := sc.check(rec, workdir)
+		now := time.Now()
+		if len(failures) == 0 && now.Sub(ended) >= sc.Settle || now.After(deadline) {
+			return failures, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// deviceConfig simulates the scenario's nodes, or the default ones, with
+// no unscripted traffic
+func (sc *Scenario) deviceConfig() *simulator.DeviceConfig {
+	cfg := simulator.DefaultConfig()
+	cfg.MessageInterval = 0
+	if len(sc.Nodes) > 0 {
+		cfg.SimulatedNodes = make([]simulator.SimulatedNode, len(sc.Nodes))
+		for i, n := range sc.Nodes {
+			cfg.SimulatedNodes[i] = simulator.SimulatedNode{
+				NodeNum:   n.num,
+				LongName:  n.LongName,
+				ShortName: n.ShortName,
+				HWModel:   9,
+				Latitude:  n.Latitude,
+				Longitude: n.Longitude,
+			}
+		}
+	}
+	return &cfg
+}
+
+// isolate points the relay at the simulator and turns off everything that
+// reaches outside the scenario
+func isolate(cfg *config.Config, port string) {
+	cfg.Connection.Type = "serial"
+	cfg.Connection.Serial.Port = port
+	cfg.API.Enabled = false
+	cfg.Cluster.Enabled = false
+	cfg.Replay.Enabled = false
+	cfg.NodeDB.Path = ""
+	cfg.Dedup.StateFile = ""
+}
+
+// play sends the script's packets from the simulated device
+func (sc *Scenario) play(ctx context.Context, device *simulator.Device) error {
+	defaultFrom := device.Config().SimulatedNodes[0].NodeNum
+	for i, step := range sc.Script {
+		from := step.from
+		if from == 0 {
+			from = defaultFrom
+		}
+
+		var err error
+		switch {
+		case step.Text != "":
+			err = device.SendTextMessage(from, step.Text)
+		case step.Position != nil:
+			err = device.SendPosition(from, step.Position.Latitude, step.Position.Longitude, step.Position.Altitude)
+		case step.Detection != "":
+			err = device.SendDetection(from, step.Detection)
+		case step.Wait > 0:
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(step.Wait):
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("script[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// check returns a description of each unmet expectation
+func (sc *Scenario) check(rec *receiver, workdir string) []string {
+	var failures []string
+	for _, e := range sc.Expect {
+		var bodies []string
+		if e.File != "" {
+			var err error
+			if bodies, err = readRecords(filepath.Join(workdir, e.File)); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", e, err))
+				continue
+			}
+		} else {
+			bodies = rec.bodies(e.Receiver)
+		}
+
+		matched := 0
+		for _, body := range bodies {
+			if e.matches(body) {
+				matched++
+			}
+		}
+		switch {
+		case e.Count == nil && matched == 0:
+			failures = append(failures, fmt.Sprintf("%s: no matching delivery among %d", e, len(bodies)))
+		case e.Count != nil && matched != *e.Count:
+			failures = append(failures, fmt.Sprintf("%s: %d matching deliveries, want %d", e, matched, *e.Count))
+		}
+	}
+	return failures
+}
+
+// matches reports whether a delivered body meets the expectation
+func (e Expectation) matches(body string) bool {
+	if !strings.Contains(body, e.Contains) {
+		return false
+	}
+	if len(e.JSON) == 0 {
+		return true
+	}
+	var doc interface{}
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		return false
+	}
+	for path, want := range e.JSON {
+		got, ok := lookup(doc, path)
+		if !ok || fmt.Sprint(got) != fmt.Sprint(want) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup returns the value at a dotted path in a decoded JSON document
+func lookup(doc interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if doc, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// readRecords returns the non-empty lines of a file, or none if it does
+// not exist yet
+func readRecords(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			records = append(records, line)
+		}
+	}
+	return records, sc.Err()
+}
+
+// receiver is the mock HTTP receiver. It accepts every request and keeps
+// the bodies with their paths.
+type receiver struct {
+	mu       sync.Mutex
+	requests []request
+}
+
+type request struct {
+	path string
+	body string
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	r.requests = append(r.requests, request{path: req.URL.Path, body: string(body)})
+	r.mu.Unlock()
+	// Enough for outputs that check the response, like telegram
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = io.WriteString(w, `{"ok":true}`)
+}
+
+// bodies returns the bodies of requests to paths starting with prefix
+func (r *receiver) bodies(prefix string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for _, req := range r.requests {
+		if strings.HasPrefix(req.path, prefix) {
+			out = append(out, req.body)
+		}
+	}
+	return out
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package scenario
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRunExample(t *testing.T) {
+	sc, err := Load("../../scenarios/text-to-webhook.yaml")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	res := Run(context.Background(), sc)
+	if !res.Passed() {
+		t.Fatalf("scenario failed: err=%v failures=%v", res.Err, res.Failures)
+	}
+}
@@ -0,0 +1,225 @@
+// Package scenario runs scripted end-to-end tests of a relay config: a
+// simulated device plays a script of mesh packets to a real relay, and the
+// requests its outputs make to a mock HTTP receiver and the records they
+// write to files are checked against expectations.
+package scenario
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// DefaultTimeout bounds how long a scenario waits for its expectations
+const DefaultTimeout = 10 * time.Second
+
+// DefaultSettle is how long expectations must hold after the script ends,
+// so that deliveries still in flight are counted
+const DefaultSettle = time.Second
+
+// Scenario pairs a relay config with a simulator script and the deliveries
+// expected from it. In the config, ${receiver} is replaced with the URL of
+// the mock HTTP receiver and ${workdir} with a scratch directory for file
+// outputs.
+type Scenario struct {
+	Name string `yaml:"name"`
+	// Config is the path of a config file, relative to the scenario, or
+	// the config itself
+	Config  interface{}   `yaml:"config"`
+	Nodes   []Node        `yaml:"nodes"`
+	Script  []Step        `yaml:"script"`
+	Expect  []Expectation `yaml:"expect"`
+	Timeout time.Duration `yaml:"timeout"`
+	Settle  time.Duration `yaml:"settle"`
+
+	// Path is the file the scenario was loaded from
+	Path string `yaml:"-"`
+}
+
+// Node is a simulated mesh node announced to the relay on connect
+type Node struct {
+	ID        string  `yaml:"id"`
+	LongName  string  `yaml:"long_name"`
+	ShortName string  `yaml:"short_name"`
+	Latitude  float64 `yaml:"latitude"`
+	Longitude float64 `yaml:"longitude"`
+
+	num uint32
+}
+
+// Step is one action of the script: a packet sent from a node, or a pause
+type Step struct {
+	// From is the sending node, by default the first node
+	From      string        `yaml:"from"`
+	Text      string        `yaml:"text"`
+	Position  *Position     `yaml:"position"`
+	Detection string        `yaml:"detection"`
+	Wait      time.Duration `yaml:"wait"`
+
+	from uint32
+}
+
+// Position is the payload of a position step
+type Position struct {
+	Latitude  float64 `yaml:"latitude"`
+	Longitude float64 `yaml:"longitude"`
+	Altitude  int32   `yaml:"altitude"`
+}
+
+// Expectation describes deliveries to the mock receiver or records in a
+// file. A delivery matches when its body contains Contains and has the
+// values in JSON at their dotted paths, e.g. payload.text. Without Count
+// at least one delivery must match; with it, exactly Count must.
+type Expectation struct {
+	// Receiver matches requests whose path starts with it
+	Receiver string `yaml:"receiver"`
+	// File names a file of newline-separated records, relative to
+	// ${workdir}
+	File     string                 `yaml:"file"`
+	Count    *int                   `yaml:"count"`
+	Contains string                 `yaml:"contains"`
+	JSON     map[string]interface{} `yaml:"json"`
+}
+
+// String describes what the expectation checks
+func (e Expectation) String() string {
+	if e.File != "" {
+		return "file " + e.File
+	}
+	return "receiver " + e.Receiver
+}
+
+// Load reads and checks a scenario file
+func Load(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %w", err)
+	}
+	sc := &Scenario{Timeout: DefaultTimeout, Settle: DefaultSettle, Path: path}
+	if err := yaml.Unmarshal(data, sc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if sc.Name == "" {
+		sc.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if err := sc.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return sc, nil
+}
+
+func (sc *Scenario) validate() error {
+	switch sc.Config.(type) {
+	case string, map[string]interface{}:
+	case nil:
+		return fmt.Errorf("config is required")
+	default:
+		return fmt.Errorf("config must be a file path or a mapping")
+	}
+
+	for i := range sc.Nodes {
+		num, err := message.ParseNodeID(sc.Nodes[i].ID)
+		if err != nil {
+			return fmt.Errorf("nodes[%d]: %w", i, err)
+		}
+		sc.Nodes[i].num = num
+	}
+
+	if len(sc.Script) == 0 {
+		return fmt.Errorf("script is empty")
+	}
+	for i := range sc.Script {
+		step := &sc.Script[i]
+		actions := 0
+		for _, set := range []bool{step.Text != "", step.Position != nil, step.Detection != "", step.Wait > 0} {
+			if set {
+				actions++
+			}
+		}
+		if actions != 1 {
+			return fmt.Errorf("script[%d] must have exactly one of text, position, detection, or wait", i)
+		}
+		if step.From != "" {
+			num, err := message.ParseNodeID(step.From)
+			if err != nil {
+				return fmt.Errorf("script[%d]: %w", i, err)
+			}
+			step.from = num
+		}
+	}
+
+	if len(sc.Expect) == 0 {
+		return fmt.Errorf("expect is empty")
+	}
+	for i, e := range sc.Expect {
+		if (e.Receiver == "") == (e.File == "") {
+			return fmt.Errorf("expect[%d] must have exactly one of receiver or file", i)
+		}
+		if e.Count != nil && *e.Count < 0 {
+			return fmt.Errorf("expect[%d].count must not be negative", i)
+		}
+	}
+	if sc.Timeout <= 0 || sc.Settle < 0 {
+		return fmt.Errorf("timeout must be positive and settle not negative")
+	}
+	return nil
+}
+
+// configData returns the relay config with the placeholders filled in
+func (sc *Scenario) configData(receiver, workdir string) ([]byte, error) {
+	var data []byte
+	switch c := sc.Config.(type) {
+	case string:
+		path := c
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(sc.Path), path)
+		}
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read config: %w", err)
+		}
+	default:
+		var err error
+		if data, err = yaml.Marshal(c); err != nil {
+			return nil, fmt.Errorf("failed to encode config: %w", err)
+		}
+	}
+	r := strings.NewReplacer("${receiver}", receiver, "${workdir}", workdir)
+	return []byte(r.Replace(string(data))), nil
+}
+
+// Find returns the scenario files among paths, expanding directories to
+// the .yaml and .yml files in them
+func Find(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		var found []string
+		for _, e := range entries {
+			if ext := filepath.Ext(e.Name()); !e.IsDir() && (ext == ".yaml" || ext == ".yml") {
+				found = append(found, filepath.Join(path, e.Name()))
+			}
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
@@ -0,0 +1,56 @@
+package scenario
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadValidation(t *testing.T) {
+	dir := t.TempDir()
+	for name, tc := range map[string]struct {
+		yaml string
+		err  string
+	}{
+		"no config":      {"script: [{text: hi}]\nexpect: [{receiver: /}]", "config is required"},
+		"empty script":   {"config: c.yaml\nexpect: [{receiver: /}]", "script is empty"},
+		"two actions":    {"config: c.yaml\nscript: [{text: hi, detection: x}]\nexpect: [{receiver: /}]", "exactly one of text"},
+		"bad node":       {"config: c.yaml\nscript: [{text: hi, from: bob}]\nexpect: [{receiver: /}]", "invalid node id"},
+		"two targets":    {"config: c.yaml\nscript: [{text: hi}]\nexpect: [{receiver: /, file: out.jsonl}]", "exactly one of receiver or file"},
+		"no expectation": {"config: c.yaml\nscript: [{text: hi}]", "expect is empty"},
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "-")+".yaml")
+		if err := os.WriteFile(path, []byte(tc.yaml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: err = %v, want %q", name, err, tc.err)
+		}
+	}
+}
+
+func TestExpectationMatches(t *testing.T) {
+	count := 1
+	e := Expectation{Receiver: "/hook", Count: &count, Contains: "SOS", JSON: map[string]interface{}{"payload.text": "SOS now", "port_num": 1}}
+	for body, want := range map[string]bool{
+		`{"port_num":1,"payload":{"text":"SOS now"}}`:   true,
+		`{"port_num":3,"payload":{"text":"SOS now"}}`:   false,
+		`{"port_num":1,"payload":{"text":"SOS later"}}`: false,
+		`SOS now`: false,
+	} {
+		if got := e.matches(body); got != want {
+			t.Errorf("matches(%s) = %v, want %v", body, got, want)
+		}
+	}
+
+	rec := &receiver{requests: []request{{path: "/hook/a", body: `{"port_num":1,"payload":{"text":"SOS now"}}`}, {path: "/other", body: "SOS"}}}
+	sc := &Scenario{Expect: []Expectation{e}}
+	if failures := sc.check(rec, t.TempDir()); len(failures) != 0 {
+		t.Errorf("check failures: %v", failures)
+	}
+	count = 2
+	if failures := sc.check(rec, t.TempDir()); len(failures) != 1 {
+		t.Errorf("check failures = %v, want one", failures)
+	}
+}
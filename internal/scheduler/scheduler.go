@@ -0,0 +1,285 @@
+// Package scheduler broadcasts configured messages to the mesh on a schedule.
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+	"github.com/iamruinous/meshtastic-message-relay/internal/logging"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// OnlineWindow is how recently a node must have been heard to count as online
+const OnlineWindow = 2 * time.Hour
+
+// sendTimeout bounds a single scheduled send
+const sendTimeout = 30 * time.Second
+
+// maxMessageLength bounds a scheduled message so it fits in a single mesh
+// text message
+const maxMessageLength = 200
+
+// Data is the template context available to scheduled messages
+type Data struct {
+	// Name is the schedule name
+	Name string
+	// Now is the time the message is sent, in the schedule's timezone
+	Now time.Time
+	// Date is Now formatted as 2006-01-02
+	Date string
+	// Time is Now formatted as 15:04
+	Time string
+	// Weekday is the day name, e.g. Monday
+	Weekday string
+	// NodeCount is the number of nodes known to the device
+	NodeCount int
+	// OnlineCount is the number of nodes heard within OnlineWindow
+	OnlineCount int
+}
+
+// Job is a single scheduled broadcast
+type Job struct {
+	name     string
+	at       *timeOfDay
+	days     map[time.Weekday]bool
+	every    time.Duration
+	location *time.Location
+	channel  uint32
+	to       uint32
+	tmpl     *template.Template
+}
+
+type timeOfDay struct {
+	hour, minute int
+}
+
+// NewJob builds a job from its configuration
+func NewJob(cfg *config.ScheduleConfig) (*Job, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		name:     cfg.Name,
+		every:    cfg.Every,
+		location: time.Local,
+		channel:  cfg.Channel,
+		to:       cfg.To,
+	}
+	if job.name == "" {
+		job.name = "schedule"
+	}
+
+	if cfg.At != "" {
+		hour, minute, err := config.ParseTimeOfDay(cfg.At)
+		if err != nil {
+			return nil, err
+		}
+		job.at = &timeOfDay{hour: hour, minute: minute}
+	}
+
+	if len(cfg.Days) > 0 {
+		job.days = make(map[time.Weekday]bool, len(cfg.Days))
+		for _, d := range cfg.Days {
+			day, err := config.ParseWeekday(d)
+			if err != nil {
+				return nil, err
+			}
+			job.days[day] = true
+		}
+	}
+
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		job.location = loc
+	}
+
+	tmpl, err := template.New(job.name).Option("missingkey=error").Parse(cfg.Message)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message template: %w", err)
+	}
+	job.tmpl = tmpl
+
+	return job, nil
+}
+
+// Name returns the job name
+func (j *Job) Name() string {
+	return j.name
+}
+
+// Next returns the first run time strictly after t
+func (j *Job) Next(t time.Time) time.Time {
+	if j.every > 0 {
+		return t.Add(j.every)
+	}
+
+	local := t.In(j.location)
+	// A week always contains a matching day when any days are configured
+	for i := 0; i <= 7; i++ {
+		day := local.AddDate(0, 0, i)
+		run := time.Date(day.Year(), day.Month(), day.Day(), j.at.hour, j.at.minute, 0, 0, j.location)
+		if !run.After(t) {
+			continue
+		}
+		if j.days != nil && !j.days[run.Weekday()] {
+			continue
+		}
+		return run
+	}
+	return time.Time{}
+}
+
+// Render executes the message template
+func (j *Job) Render(data *Data) (string, error) {
+	var buf bytes.Buffer
+	if err := j.tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Sender sends messages to the mesh
+type Sender interface {
+	Send(ctx context.Context, packet *message.Packet) error
+}
+
+// Scheduler runs jobs against a connection
+type Scheduler struct {
+	conn   Sender
+	nodes  connection.NodeDirectory
+	jobs   []*Job
+	logger *zap.Logger
+	now    func() time.Time
+}
+
+// New creates a scheduler for the enabled schedules. nodes may be nil; it
+// provides the node counts for message templates.
+func New(conn Sender, nodes connection.NodeDirectory, schedules []config.ScheduleConfig) (*Scheduler, error) {
+	s := &Scheduler{
+		conn:   conn,
+		nodes:  nodes,
+		logger: logging.With(zap.String("component", "scheduler")),
+		now:    time.Now,
+	}
+
+	for i := range schedules {
+		if !schedules[i].Enabled {
+			continue
+		}
+		job, err := NewJob(&schedules[i])
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", schedules[i].Name, err)
+		}
+		s.jobs = append(s.jobs, job)
+	}
+
+	return s, nil
+}
+
+// Len returns the number of enabled jobs
+func (s *Scheduler) Len() int {
+	return len(s.jobs)
+}
+
+// Run runs all jobs until ctx is canceled
+func (s *Scheduler) Run(ctx context.Context) {
+	for _, job := range s.jobs {
+		go s.runJob(ctx, job)
+	}
+}
+
+func (s *Scheduler) runJob(ctx context.Context, job *Job) {
+	for {
+		next := job.Next(s.now())
+		s.logger.Debug("Scheduled broadcast",
+			zap.String("schedule", job.name),
+			zap.Time("next", next))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := s.fire(ctx, job); err != nil {
+			s.logger.Error("Scheduled broadcast failed",
+				zap.String("schedule", job.name),
+				zap.Error(err))
+		}
+	}
+}
+
+// fire renders and sends a job's message
+func (s *Scheduler) fire(ctx context.Context, job *Job) error {
+	text, err := job.Render(s.data(job))
+	if err != nil {
+		return fmt.Errorf("failed to render message: %w", err)
+	}
+	if text == "" {
+		s.logger.Debug("Skipping empty scheduled message", zap.String("schedule", job.name))
+		return nil
+	}
+	if len(text) > maxMessageLength {
+		s.logger.Warn("Scheduled message is too long for the mesh; trimming it",
+			zap.String("schedule", job.name),
+			zap.Int("length", len(text)),
+			zap.Int("max", maxMessageLength))
+		text = message.TrimText(text, maxMessageLength)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	err = s.conn.Send(ctx, &message.Packet{
+		To:      job.to,
+		Channel: job.channel,
+		PortNum: message.PortNumTextMessage,
+		Payload: &message.TextMessage{Text: text},
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("Sent scheduled broadcast",
+		zap.String("schedule", job.name),
+		zap.Uint32("channel", job.channel),
+		zap.String("text", text))
+	return nil
+}
+
+func (s *Scheduler) data(job *Job) *Data {
+	now := s.now().In(job.location)
+	d := &Data{
+		Name:    job.name,
+		Now:     now,
+		Date:    now.Format("2006-01-02"),
+		Time:    now.Format("15:04"),
+		Weekday: now.Weekday().String(),
+	}
+
+	if s.nodes != nil {
+		nodes := s.nodes.Nodes()
+		d.NodeCount = len(nodes)
+		for _, n := range nodes {
+			if n.LastHeard > 0 && now.Sub(time.Unix(int64(n.LastHeard), 0)) <= OnlineWindow {
+				d.OnlineCount++
+			}
+		}
+	}
+
+	return d
+}
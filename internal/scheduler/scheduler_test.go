@@ -0,0 +1,125 @@
+package scheduler
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// sender records the packets sent to it
+type sender struct {
+	sent []*message.Packet
+}
+
+func (s *sender) Send(_ context.Context, p *message.Packet) error {
+	s.sent = append(s.sent, p)
+	return nil
+}
+
+func TestNextDaily(t *testing.T) {
+	job, err := NewJob(&config.ScheduleConfig{
+		At:       "19:00",
+		Timezone: "UTC",
+		Message:  "Net tonight",
+	})
+	if err != nil {
+		t.Fatalf("NewJob failed: %v", err)
+	}
+
+	before := time.Date(2024, 3, 4, 18, 30, 0, 0, time.UTC)
+	if got, want := job.Next(before), time.Date(2024, 3, 4, 19, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next(%v) = %v, want %v", before, got, want)
+	}
+
+	// Exactly at the run time moves to the next day
+	at := time.Date(2024, 3, 4, 19, 0, 0, 0, time.UTC)
+	if got, want := job.Next(at), time.Date(2024, 3, 5, 19, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next(%v) = %v, want %v", at, got, want)
+	}
+}
+
+func TestNextWeekdays(t *testing.T) {
+	job, err := NewJob(&config.ScheduleConfig{
+		At:       "08:15",
+		Days:     []string{"sat", "Sunday"},
+		Timezone: "UTC",
+		Message:  "Weekend check-in",
+	})
+	if err != nil {
+		t.Fatalf("NewJob failed: %v", err)
+	}
+
+	// Monday 2024-03-04 -> Saturday 2024-03-09
+	monday := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+	if got, want := job.Next(monday), time.Date(2024, 3, 9, 8, 15, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next(%v) = %v, want %v", monday, got, want)
+	}
+}
+
+func TestRender(t *testing.T) {
+	job, err := NewJob(&config.ScheduleConfig{
+		Every:   time.Hour,
+		Message: "{{.Weekday}} {{.Date}}: {{.OnlineCount}}/{{.NodeCount}} nodes online",
+	})
+	if err != nil {
+		t.Fatalf("NewJob failed: %v", err)
+	}
+
+	now := time.Date(2024, 3, 4, 19, 0, 0, 0, time.UTC)
+	got, err := job.Render(&Data{Now: now, Date: "2024-03-04", Weekday: "Monday", NodeCount: 12, OnlineCount: 5})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if want := "Monday 2024-03-04: 5/12 nodes online"; got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+
+	if next := job.Next(now); !next.Equal(now.Add(time.Hour)) {
+		t.Errorf("Next() = %v, want %v", next, now.Add(time.Hour))
+	}
+}
+
+func TestScheduleValidation(t *testing.T) {
+	tests := []config.ScheduleConfig{
+		{Message: "no time"},
+		{At: "19:00", Every: time.Hour, Message: "both"},
+		{At: "25:00", Message: "bad time"},
+		{Every: time.Second, Message: "too often"},
+		{Every: time.Hour, Days: []string{"mon"}, Message: "days with every"},
+		{At: "19:00", Days: []string{"funday"}, Message: "bad day"},
+		{At: "19:00", Channel: 8, Message: "bad channel"},
+		{At: "19:00", Message: "{{.Broken"},
+	}
+	for _, cfg := range tests {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected validation error for %+v", cfg)
+		}
+	}
+}
+
+func TestFireTrimsLongMessages(t *testing.T) {
+	conn := &sender{}
+	s, err := New(conn, nil, []config.ScheduleConfig{{
+		Enabled: true,
+		Every:   time.Hour,
+		Message: "{{.NodeCount}} nodes. " + strings.Repeat("Net check-in on the hour, all stations welcome. ", 10),
+	}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := s.fire(context.Background(), s.jobs[0]); err != nil {
+		t.Fatalf("fire failed: %v", err)
+	}
+
+	if len(conn.sent) != 1 {
+		t.Fatalf("sent %d packets, want 1", len(conn.sent))
+	}
+	text := conn.sent[0].Payload.(*message.TextMessage).Text
+	if len(text) > maxMessageLength || !strings.HasPrefix(text, "0 nodes. ") || !strings.HasSuffix(text, "...") {
+		t.Errorf("sent %d bytes: %q", len(text), text)
+	}
+}
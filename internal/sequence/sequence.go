@@ -0,0 +1,102 @@
+// Package sequence numbers the packets the relay handles, so consumers of
+// its outputs can order them and notice gaps even when packet timestamps
+// are skewed.
+//
+// Numbers start at 1 and keep increasing across restarts when a state file
+// is set. Writing the file for every packet would be too costly, so the
+// counter reserves a range of numbers ahead and saves only the end of the
+// range; after a crash numbering resumes past the reserved range, leaving
+// a gap but never reusing a number. A clean Close saves the exact number.
+package sequence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/state"
+)
+
+// reserve is how many numbers are handed out per write of the state file
+const reserve = 1000
+
+// Counter hands out increasing sequence numbers. It is safe for concurrent
+// use.
+type Counter struct {
+	mu       sync.Mutex
+	path     string
+	last     uint64 // last number handed out
+	reserved uint64 // numbers up to this one may be handed out without saving
+}
+
+// Open creates a counter that continues from the number saved in path; an
+// empty path keeps the count in memory only
+func Open(path string) (*Counter, error) {
+	c := &Counter{path: path}
+	if path == "" {
+		return c, nil
+	}
+
+	err := state.Load(path, func(data []byte) error {
+		last, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return err
+		}
+		c.last, c.reserved = last, last
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sequence state: %w", err)
+	}
+	return c, nil
+}
+
+// Next returns the next sequence number. The number is valid even when
+// the error reports that the state file could not be written; the range
+// is then reserved again on the next call, so numbering does not run
+// ahead of what the file records.
+func (c *Counter) Next() (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.last++
+	if c.path == "" || c.last <= c.reserved {
+		return c.last, nil
+	}
+	end := c.last + reserve - 1
+	if err := c.save(end); err != nil {
+		return c.last, err
+	}
+	c.reserved = end
+	return c.last, nil
+}
+
+// Last returns the last number handed out, 0 if none
+func (c *Counter) Last() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// Close saves the last number handed out, so numbering resumes right
+// after it
+func (c *Counter) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.path == "" {
+		return nil
+	}
+	if err := c.save(c.last); err != nil {
+		return err
+	}
+	c.reserved = c.last
+	return nil
+}
+
+func (c *Counter) save(n uint64) error {
+	if err := state.WriteFile(c.path, []byte(strconv.FormatUint(n, 10)+"\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to write sequence state: %w", err)
+	}
+	return nil
+}
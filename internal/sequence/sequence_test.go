@@ -0,0 +1,76 @@
+package sequence
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCounter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "sequence")
+
+	c, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for want := uint64(1); want <= 3; want++ {
+		if n, err := c.Next(); n != want || err != nil {
+			t.Fatalf("Next() = %d, %v; want %d", n, err, want)
+		}
+	}
+
+	// Without a clean close numbering resumes past the reserved range
+	crashed, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := crashed.Next(); n != reserve+1 {
+		t.Errorf("after a crash Next() = %d, want %d", n, reserve+1)
+	}
+
+	// A clean close resumes right after the last number
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	c, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := c.Next(); n != 4 {
+		t.Errorf("after a restart Next() = %d, want 4", n)
+	}
+}
+
+func TestCounterFailedSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sequence")
+
+	c, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A directory in the way makes every save fail
+	if err := os.MkdirAll(filepath.Join(path, "blocker"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for want := uint64(1); want <= 2; want++ {
+		if n, err := c.Next(); n != want || err == nil {
+			t.Fatalf("Next() = %d, %v; want %d and an error", n, err, want)
+		}
+	}
+
+	// The range is reserved again once the file can be written
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := c.Next(); n != 3 || err != nil {
+		t.Fatalf("Next() = %d, %v; want 3", n, err)
+	}
+	crashed, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := crashed.Next(); n != reserve+3 {
+		t.Errorf("after a crash Next() = %d, want %d", n, reserve+3)
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"path/filepath"
+	"text/template"
+)
+
+// labelPrefix namespaces launchd job labels
+const labelPrefix = "com.github.iamruinous."
+
+// launchd manages a launchd job
+type launchd struct {
+	opts Options
+}
+
+var plistTemplate = template.Must(template.New("plist").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{html .Label}}</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{html .Binary}}</string>
+		<string>--config</string>
+		<string>{{html .Config}}</string>
+		<string>run</string>
+	</array>
+{{- if .RunAs}}
+	<key>UserName</key>
+	<string>{{html .RunAs}}</string>
+{{- end}}
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>ThrottleInterval</key>
+	<integer>5</integer>
+	<key>StandardOutPath</key>
+	<string>{{html .Log}}</string>
+	<key>StandardErrorPath</key>
+	<string>{{html .Log}}</string>
+</dict>
+</plist>
+`))
+
+func (l *launchd) label() string {
+	return labelPrefix + l.opts.Name
+}
+
+func (l *launchd) Path() string {
+	if l.opts.User {
+		return filepath.Join(userHome(), "Library", "LaunchAgents", l.label()+".plist")
+	}
+	return filepath.Join("/Library/LaunchDaemons", l.label()+".plist")
+}
+
+// logPath is where launchd writes the relay's output
+func (l *launchd) logPath() string {
+	if l.opts.User {
+		return filepath.Join(userHome(), "Library", "Logs", l.opts.Name+".log")
+	}
+	return filepath.Join("/var/log", l.opts.Name+".log")
+}
+
+func (l *launchd) Definition() ([]byte, error) {
+	return render(plistTemplate, struct {
+		Options
+		Label string
+		Log   string
+	}{l.opts, l.label(), l.logPath()})
+}
+
+func (l *launchd) Install(start bool) error {
+	if err := writeDefinition(l); err != nil {
+		return err
+	}
+	if !start {
+		// RunAtLoad starts it at the next boot or login
+		return nil
+	}
+	return run("launchctl", "load", "-w", l.Path())
+}
+
+func (l *launchd) Uninstall() error {
+	// A job that is already unloaded is not an error
+	_ = run("launchctl", "unload", "-w", l.Path())
+	return removeDefinition(l)
+}
+
+func (l *launchd) Status() error {
+	return run("launchctl", "list", l.label())
+}
@@ -0,0 +1,123 @@
+// Package service installs the relay as a system service: a systemd unit
+// on Linux or a launchd job on macOS.
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+)
+
+// DefaultName is the service's default name
+const DefaultName = "meshtastic-relay"
+
+// ErrUnsupported indicates the platform has no supported service manager
+var ErrUnsupported = errors.New("services are only supported with systemd (Linux) and launchd (macOS)")
+
+// Options describe the service to install
+type Options struct {
+	// Name names the unit, or the launchd job after its label prefix
+	Name string
+	// Binary is the absolute path of the relay executable
+	Binary string
+	// Config is the absolute path of the config file
+	Config string
+	// User installs a per-user service instead of a system one
+	User bool
+	// RunAs is the account a system service runs as; empty for root
+	RunAs string
+}
+
+// Manager installs and controls services with the platform's service
+// manager
+type Manager interface {
+	// Path returns where the service definition is installed
+	Path() string
+	// Definition returns the service definition file's contents
+	Definition() ([]byte, error)
+	// Install writes the definition and starts the service at boot (or
+	// login, for user services) and now, unless start is false
+	Install(start bool) error
+	// Uninstall stops the service and removes its definition
+	Uninstall() error
+	// Status writes the service manager's view of the service to stdout,
+	// returning an error when the service is not running
+	Status() error
+}
+
+// New returns the manager for this platform
+func New(opts Options) (Manager, error) {
+	if opts.Name == "" {
+		opts.Name = DefaultName
+	}
+	if strings.ContainsAny(opts.Name, "/\\ ") {
+		return nil, fmt.Errorf("invalid service name %q", opts.Name)
+	}
+	switch runtime.GOOS {
+	case "linux":
+		return &systemd{opts}, nil
+	case "darwin":
+		return &launchd{opts}, nil
+	}
+	return nil, ErrUnsupported
+}
+
+// run runs service manager commands; tests replace it
+var run = runCommand
+
+// runCommand runs a service manager command, showing its output
+func runCommand(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// render executes a definition template for opts
+func render(t *template.Template, data any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeDefinition writes a service definition, creating its directory
+func writeDefinition(m Manager) error {
+	data, err := m.Definition()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.Path()), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.Path(), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", m.Path(), err)
+	}
+	return nil
+}
+
+// removeDefinition removes a service definition that may not exist
+func removeDefinition(m Manager) error {
+	if err := os.Remove(m.Path()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove %s: %w", m.Path(), err)
+	}
+	return nil
+}
+
+// userHome returns the home directory for user services
+func userHome() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "~"
+	}
+	return home
+}
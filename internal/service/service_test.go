@@ -0,0 +1,94 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSystemdUnit(t *testing.T) {
+	s := &systemd{Options{Name: "relay", Binary: "/opt/relay 100%/relay", Config: "/etc/relay/config.yaml", RunAs: "pi"}}
+	data, err := s.Definition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unit := string(data)
+	for _, want := range []string{
+		`ExecStart="/opt/relay 100%%/relay" --config "/etc/relay/config.yaml" run`,
+		"User=pi",
+		"StateDirectory=relay",
+		"SupplementaryGroups=dialout",
+		"WantedBy=multi-user.target",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("unit missing %q:\n%s", want, unit)
+		}
+	}
+	if s.Path() != "/etc/systemd/system/relay.service" {
+		t.Errorf("Path = %s", s.Path())
+	}
+}
+
+func TestSystemdUserInstall(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	var calls []string
+	run = func(name string, args ...string) error {
+		calls = append(calls, name+" "+strings.Join(args, " "))
+		return nil
+	}
+	t.Cleanup(func() { run = runCommand })
+
+	s := &systemd{Options{Name: "relay", Binary: "/usr/bin/relay", Config: "/home/pi/config.yaml", User: true, RunAs: "ignored"}}
+	if err := s.Install(true); err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	path := filepath.Join(home, ".config", "systemd", "user", "relay.service")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unit not written: %v", err)
+	}
+	if strings.Contains(string(data), "dialout") || !strings.Contains(string(data), "WantedBy=default.target") {
+		t.Errorf("user unit:\n%s", data)
+	}
+	want := []string{"systemctl --user daemon-reload", "systemctl --user enable --now relay"}
+	if strings.Join(calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+
+	calls = nil
+	if err := s.Uninstall(); err != nil {
+		t.Fatalf("Uninstall: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("unit left behind: %v", err)
+	}
+	if len(calls) != 2 || calls[0] != "systemctl --user disable --now relay" {
+		t.Errorf("calls = %q", calls)
+	}
+}
+
+func TestLaunchdPlist(t *testing.T) {
+	l := &launchd{Options{Name: "relay", Binary: "/usr/local/bin/relay", Config: "/Users/a&b/config.yaml"}}
+	data, err := l.Definition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plist := string(data)
+	for _, want := range []string{
+		"<string>com.github.iamruinous.relay</string>",
+		"<string>/Users/a&amp;b/config.yaml</string>",
+		"<string>/var/log/relay.log</string>",
+	} {
+		if !strings.Contains(plist, want) {
+			t.Errorf("plist missing %q:\n%s", want, plist)
+		}
+	}
+	if strings.Contains(plist, "UserName") {
+		t.Errorf("plist sets a user:\n%s", plist)
+	}
+	if l.Path() != "/Library/LaunchDaemons/com.github.iamruinous.relay.plist" {
+		t.Errorf("Path = %s", l.Path())
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// systemd manages a systemd unit
+type systemd struct {
+	opts Options
+}
+
+// quoteArg quotes a command line argument for ExecStart
+func quoteArg(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(s)
+	return `"` + s + `"`
+}
+
+var unitTemplate = template.Must(template.New("unit").Funcs(template.FuncMap{"quote": quoteArg}).Parse(`[Unit]
+Description=Meshtastic Message Relay
+Documentation=https://github.com/iamruinous/meshtastic-message-relay
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+{{- if .RunAs}}
+User={{.RunAs}}
+{{- end}}
+ExecStart={{quote .Binary}} --config {{quote .Config}} run
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=on-failure
+RestartSec=5
+# Node database, dedup state, dead letters and so on
+StateDirectory={{.Name}}
+StateDirectoryMode=0700
+NoNewPrivileges=true
+PrivateTmp=true
+{{- if not .User}}
+# Serial devices
+SupplementaryGroups=dialout
+{{- end}}
+
+[Install]
+WantedBy={{if .User}}default.target{{else}}multi-user.target{{end}}
+`))
+
+func (s *systemd) Path() string {
+	if s.opts.User {
+		return filepath.Join(userHome(), ".config", "systemd", "user", s.opts.Name+".service")
+	}
+	return filepath.Join("/etc/systemd/system", s.opts.Name+".service")
+}
+
+func (s *systemd) Definition() ([]byte, error) {
+	return render(unitTemplate, s.opts)
+}
+
+func (s *systemd) Install(start bool) error {
+	if err := writeDefinition(s); err != nil {
+		return err
+	}
+	if err := s.systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	if start {
+		return s.systemctl("enable", "--now", s.opts.Name)
+	}
+	return s.systemctl("enable", s.opts.Name)
+}
+
+func (s *systemd) Uninstall() error {
+	// A unit that is already stopped or gone is not an error
+	_ = s.systemctl("disable", "--now", s.opts.Name)
+	if err := removeDefinition(s); err != nil {
+		return err
+	}
+	return s.systemctl("daemon-reload")
+}
+
+func (s *systemd) Status() error {
+	return s.systemctl("status", "--no-pager", s.opts.Name)
+}
+
+// systemctl runs systemctl against the user or system manager
+func (s *systemd) systemctl(args ...string) error {
+	if s.opts.User {
+		args = append([]string{"--user"}, args...)
+	}
+	return run("systemctl", args...)
+}
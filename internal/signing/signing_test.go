@@ -0,0 +1,51 @@
+package signing
+
+import (
+	"testing"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestSignVerify(t *testing.T) {
+	s := New("shared secret")
+	signed := s.Sign("Net tonight at 19:30")
+	if len(signed) != len("Net tonight at 19:30")+Overhead {
+		t.Fatalf("signed = %q", signed)
+	}
+
+	if body, ok := s.Verify(signed); !ok || body != "Net tonight at 19:30" {
+		t.Errorf("Verify(%q) = %q, %v", signed, body, ok)
+	}
+	if _, ok := New("other key").Verify(signed); ok {
+		t.Error("verified with a different key")
+	}
+	if _, ok := s.Verify("Net tonight at 19:31" + signed[len(signed)-Overhead:]); ok {
+		t.Error("verified altered text")
+	}
+	if body, ok := s.Verify("no signature ~here"); ok || body != "no signature ~here" {
+		t.Errorf("unsigned text = %q, %v", body, ok)
+	}
+	if New("") != nil {
+		t.Error("empty key should disable signing")
+	}
+}
+
+func TestPackets(t *testing.T) {
+	s := New("k")
+	original := &message.TextMessage{Text: "hello", ReplyID: 42}
+	out := &message.Packet{PortNum: message.PortNumTextMessage, Payload: original}
+	s.SignPacket(out)
+	if original.Text != "hello" {
+		t.Error("SignPacket modified the caller's payload")
+	}
+	// A signed reply is still threaded
+	if signed := out.Payload.(*message.TextMessage); signed.ReplyID != 42 {
+		t.Errorf("signed payload = %+v", signed)
+	}
+
+	in := &message.Packet{Payload: &message.TextMessage{Text: out.Payload.(*message.TextMessage).Text}}
+	s.VerifyPacket(in)
+	if got := in.Payload.(*message.TextMessage); got.Text != "hello" || !got.Signed {
+		t.Errorf("verified payload = %+v", got)
+	}
+}
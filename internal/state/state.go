@@ -0,0 +1,181 @@
+// Package state manages the files the relay keeps across restarts: the
+// node database, notes, dedup and replay state, sequence numbers, dead
+// letters, and radio captures. Relative paths for these files are taken
+// from the state directory.
+//
+// Files are replaced atomically: new contents are written to a temporary
+// file, synced, and renamed over the old file, so a crash or power loss
+// leaves either the old or the new contents, never a truncated file.
+// Loading a file first removes a temporary file such a crash left behind,
+// and a file that cannot be decoded is moved aside so the relay starts
+// without it instead of refusing to start.
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/logging"
+)
+
+// appName names the relay's directory under the XDG state directory
+const appName = "meshtastic-relay"
+
+// tmpSuffix follows the file name in the names of temporary files, before
+// a random part
+const tmpSuffix = ".tmp-"
+
+// DefaultDir returns the state directory used when none is configured:
+// $STATE_DIRECTORY when systemd provides one, else
+// $XDG_STATE_HOME/meshtastic-relay, else ~/.local/state/meshtastic-relay.
+// It returns "" when none of these is known.
+func DefaultDir() string {
+	// systemd's StateDirectory= may list several, separated by colons
+	if dir := os.Getenv("STATE_DIRECTORY"); dir != "" {
+		return filepath.SplitList(dir)[0]
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, appName)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return ""
+	}
+	return filepath.Join(home, ".local", "state", appName)
+}
+
+// Resolve returns path inside dir when path is relative. Absolute and
+// empty paths, and any path when dir is empty, are returned as is.
+func Resolve(dir, path string) string {
+	if path == "" || dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// Prepare creates dir if needed and checks that files can be written in
+// it, so a state directory that is not writable is reported at startup
+// rather than at the first save
+func Prepare(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	f, err := os.CreateTemp(dir, ".probe-*")
+	if err != nil {
+		return fmt.Errorf("state directory %s is not writable: %w", dir, err)
+	}
+	name := f.Name()
+	_ = f.Close()
+	if err := os.Remove(name); err != nil {
+		return fmt.Errorf("state directory %s is not writable: %w", dir, err)
+	}
+	return nil
+}
+
+// WriteFile replaces path with data atomically, creating its directory if
+// needed
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	// Each write gets its own temporary file, so concurrent writes of the
+	// same file never interleave
+	f, err := os.CreateTemp(dir, filepath.Base(path)+tmpSuffix+"*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	err = f.Chmod(perm)
+	if err == nil {
+		_, err = f.Write(data)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	// Sync the directory too, or the rename itself can be lost
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+	return nil
+}
+
+// Load reads path and passes its contents to decode. A missing file is
+// not an error and decode is not called. When decode fails the file is
+// moved aside to path.corrupt-<time> and Load returns nil, so the caller
+// starts empty; decode must leave the caller's state untouched when it
+// fails.
+func Load(path string, decode func(data []byte) error) error {
+	removeUnfinished(path)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := decode(data); err != nil {
+		return quarantine(path, err)
+	}
+	return nil
+}
+
+// removeUnfinished removes the temporary files of path's writes. They are
+// only left behind by writes a crash interrupted; the file they were
+// replacing is still whole.
+func removeUnfinished(path string) {
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return
+	}
+	base := filepath.Base(path)
+	for _, e := range entries {
+		// Earlier versions used a fixed name
+		name := e.Name()
+		if e.IsDir() || name != base+".tmp" && !strings.HasPrefix(name, base+tmpSuffix) {
+			continue
+		}
+		tmp := filepath.Join(filepath.Dir(path), name)
+		if err := os.Remove(tmp); err == nil {
+			logger().Warn("Removed unfinished write", zap.String("path", tmp))
+		}
+	}
+}
+
+// quarantine moves a file that failed to load out of the way, keeping it
+// for inspection
+func quarantine(path string, cause error) error {
+	moved := path + ".corrupt-" + time.Now().UTC().Format("20060102T150405Z")
+	if err := os.Rename(path, moved); err != nil {
+		return fmt.Errorf("invalid %s (%v) and could not be moved aside: %w", path, cause, err)
+	}
+	logger().Warn("Moved aside a state file that could not be loaded; starting without it",
+		zap.String("path", path),
+		zap.String("moved_to", moved),
+		zap.Error(cause))
+	return nil
+}
+
+func logger() *zap.Logger {
+	return logging.With(zap.String("component", "state"))
+}
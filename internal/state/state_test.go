@@ -0,0 +1,113 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWriteAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sub", "nodes.json")
+
+	if err := WriteFile(path, []byte("v1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(path, []byte("v2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A write cut short by a crash leaves its temporary file behind
+	unfinished := []string{path + ".tmp-123456", path + ".tmp"}
+	for _, tmp := range unfinished {
+		if err := os.WriteFile(tmp, []byte("v"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got string
+	if err := Load(path, func(data []byte) error { got = string(data); return nil }); err != nil || got != "v2" {
+		t.Fatalf("Load = %q, %v; want v2", got, err)
+	}
+	for _, tmp := range unfinished {
+		if _, err := os.Stat(tmp); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("unfinished write %s was not removed", tmp)
+		}
+	}
+
+	// A file that fails to decode is moved aside
+	if err := Load(path, func([]byte) error { return errors.New("bad") }); err != nil {
+		t.Fatalf("Load of an invalid file = %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Error("invalid file was left in place")
+	}
+	if moved, _ := filepath.Glob(path + ".corrupt-*"); len(moved) != 1 {
+		t.Errorf("moved aside = %v", moved)
+	}
+
+	called := false
+	if err := Load(filepath.Join(dir, "missing"), func([]byte) error { called = true; return nil }); err != nil || called {
+		t.Errorf("Load of a missing file = %v, decode called %v", err, called)
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nodes.json")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- WriteFile(path, []byte(fmt.Sprintf("v%d", i)), 0o600)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("WriteFile: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.HasPrefix(string(data), "v") {
+		t.Errorf("contents = %q, %v", data, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("stat = %v, %v; want mode 0600", info, err)
+	}
+	if left, _ := filepath.Glob(path + ".tmp*"); len(left) != 0 {
+		t.Errorf("temporary files left behind: %v", left)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	for _, c := range []struct{ dir, path, want string }{
+		{"/var/lib/relay", "nodes.json", "/var/lib/relay/nodes.json"},
+		{"/var/lib/relay", "/srv/nodes.json", "/srv/nodes.json"},
+		{"/var/lib/relay", "", ""},
+		{"", "nodes.json", "nodes.json"},
+	} {
+		if got := Resolve(c.dir, c.path); got != c.want {
+			t.Errorf("Resolve(%q, %q) = %q, want %q", c.dir, c.path, got, c.want)
+		}
+	}
+}
+
+func TestDefaultDir(t *testing.T) {
+	t.Setenv("STATE_DIRECTORY", "")
+	t.Setenv("XDG_STATE_HOME", "/xdg/state")
+	if got := DefaultDir(); got != "/xdg/state/meshtastic-relay" {
+		t.Errorf("DefaultDir() = %q", got)
+	}
+	t.Setenv("STATE_DIRECTORY", "/var/lib/meshtastic-relay")
+	if got := DefaultDir(); got != "/var/lib/meshtastic-relay" {
+		t.Errorf("DefaultDir() under systemd = %q", got)
+	}
+}
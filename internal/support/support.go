@@ -0,0 +1,146 @@
+// Package support builds support bundles: a tarball of the relay's
+// configuration with secrets redacted, its status, recent logs, and the
+// latest raw frames from the device, to attach to bug reports.
+package support
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/output"
+)
+
+// Redacted replaces secret values in a bundle
+const Redacted = "REDACTED"
+
+// envRef matches values that only name an environment variable
+var envRef = regexp.MustCompile(`^\$\{?[A-Za-z_][A-Za-z0-9_]*\}?$`)
+
+// urlValue matches values that are a URL
+var urlValue = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*://\S*$`)
+
+// secretKeys are options whose whole value is a secret although their
+// names do not say so: webhook and Apprise URLs carry their tokens
+var secretKeys = map[string]bool{"webhook_url": true, "urls": true}
+
+// Redact returns a copy of settings with the values of secret options
+// replaced and URLs cut down to their scheme and server, since services
+// keep tokens anywhere from the host to the query. Values that only
+// reference an environment variable, like "${API_TOKEN}", are kept.
+func Redact(settings map[string]interface{}) map[string]interface{} {
+	return redactMap(settings, false)
+}
+
+func redactMap(m map[string]interface{}, secret bool) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = redactValue(v, secret || output.IsSensitive(k) || secretKeys[strings.ToLower(k)])
+	}
+	return out
+}
+
+func redactValue(v interface{}, secret bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return redactMap(v, secret)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, e := range v {
+			list[i] = redactValue(e, secret)
+		}
+		return list
+	case []string:
+		list := make([]interface{}, len(v))
+		for i, e := range v {
+			list[i] = redactValue(e, secret)
+		}
+		return list
+	case string:
+		switch {
+		case v == "" || envRef.MatchString(v):
+			return v
+		case secret:
+			return Redacted
+		case urlValue.MatchString(v):
+			return output.RedactURL(v, Redacted)
+		}
+		return v
+	}
+	if secret && v != nil {
+		return Redacted
+	}
+	return v
+}
+
+// file is one file in a bundle
+type file struct {
+	name string
+	data []byte
+}
+
+// Bundle collects the files of a support bundle in memory
+type Bundle struct {
+	dir     string
+	created time.Time
+	files   []file
+}
+
+// New creates an empty bundle whose files are written under dir
+func New(dir string) *Bundle {
+	return &Bundle{dir: dir, created: time.Now()}
+}
+
+// Add adds a file to the bundle
+func (b *Bundle) Add(name string, data []byte) {
+	b.files = append(b.files, file{name: name, data: data})
+}
+
+// AddJSON adds v to the bundle as an indented JSON file
+func (b *Bundle) AddJSON(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	b.Add(name, append(data, '\n'))
+	return nil
+}
+
+// Files returns the names of the files added so far
+func (b *Bundle) Files() []string {
+	names := make([]string, len(b.files))
+	for i, f := range b.files {
+		names[i] = f.name
+	}
+	return names
+}
+
+// Write writes the bundle to w as a gzipped tarball
+func (b *Bundle) Write(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, f := range b.files {
+		hdr := &tar.Header{
+			Name:    path.Join(b.dir, f.name),
+			Mode:    0o600,
+			Size:    int64(len(f.data)),
+			ModTime: b.created,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,99 @@
+package support
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	in := map[string]interface{}{
+		"api": map[string]interface{}{"listen": "127.0.0.1:8080", "token": "hunter2"},
+		"outputs": []interface{}{
+			map[string]interface{}{
+				"type":      "webhook",
+				"url":       "https://user:pw@example.com/hook?api_key=abc&room=ops",
+				"headers":   map[string]interface{}{"authorization": "Bearer xyz", "x-room": "ops"},
+				"bot_token": "${TELEGRAM_BOT_TOKEN}",
+				"retries":   3,
+			},
+			map[string]interface{}{"type": "apprise", "urls": []interface{}{"discord://1234/SECRETTOKEN"}},
+			map[string]interface{}{"type": "apprise", "url": "tgram://123:BOTTOKEN/chat"},
+			map[string]interface{}{"type": "slack", "webhook_url": "https://hooks.slack.com/services/T0/B0/SECRETXYZ"},
+			map[string]interface{}{"type": "ntfy", "server": "https://ntfy.sh", "broker": "tcp://broker.local:1883"},
+		},
+		"relay":   map[string]interface{}{"signing_key": "s3cret", "home_lat": 45.5},
+		"filters": map[string]interface{}{"expression": `text matches "http://"`},
+	}
+	want := map[string]interface{}{
+		"api": map[string]interface{}{"listen": "127.0.0.1:8080", "token": Redacted},
+		"outputs": []interface{}{
+			map[string]interface{}{
+				"type":      "webhook",
+				"url":       "https://example.com/REDACTED",
+				"headers":   map[string]interface{}{"authorization": Redacted, "x-room": "ops"},
+				"bot_token": "${TELEGRAM_BOT_TOKEN}",
+				"retries":   3,
+			},
+			map[string]interface{}{"type": "apprise", "urls": []interface{}{Redacted}},
+			map[string]interface{}{"type": "apprise", "url": "tgram://REDACTED"},
+			map[string]interface{}{"type": "slack", "webhook_url": Redacted},
+			map[string]interface{}{"type": "ntfy", "server": "https://ntfy.sh", "broker": "tcp://broker.local:1883"},
+		},
+		"relay":   map[string]interface{}{"signing_key": Redacted, "home_lat": 45.5},
+		"filters": map[string]interface{}{"expression": `text matches "http://"`},
+	}
+	if got := Redact(in); !reflect.DeepEqual(got, want) {
+		t.Errorf("Redact =\n%v\nwant\n%v", got, want)
+	}
+	// Tokens in the path or host of a URL are removed wherever it is kept
+	for _, v := range []string{"discord://1234/SECRETTOKEN", "https://hooks.slack.com/services/T0/B0/SECRETXYZ", "tgram://BOTTOKEN/chat"} {
+		if got := Redact(map[string]interface{}{"notify": v})["notify"].(string); strings.Contains(got, "TOKEN") || strings.Contains(got, "SECRET") {
+			t.Errorf("Redact(%q) = %q", v, got)
+		}
+	}
+	if in["api"].(map[string]interface{})["token"] != "hunter2" {
+		t.Error("input was modified")
+	}
+}
+
+func TestBundleWrite(t *testing.T) {
+	b := New("bundle")
+	b.Add("config.yaml", []byte("api: {}\n"))
+	if err := b.AddJSON("status.json", map[string]int{"received": 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := b.Write(&buf); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	got := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		got[hdr.Name] = string(data)
+	}
+	want := map[string]string{
+		"bundle/config.yaml": "api: {}\n",
+		"bundle/status.json": "{\n  \"received\": 3\n}\n",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("archive = %q, want %q", got, want)
+	}
+}
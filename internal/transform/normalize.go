@@ -0,0 +1,180 @@
+package transform
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// zeroWidthJoiner joins emoji sequences, so it is kept when other format
+// characters are stripped
+const zeroWidthJoiner = '\u200d'
+
+// Normalize cleans up text for outputs that mishandle Unicode. Text is
+// normalized to NFC and control characters other than newline and tab are
+// stripped, along with invisible format characters such as bidi overrides.
+// With transliterate set, text is reduced to ASCII for legacy systems like
+// pagers and SMS gateways: accents are dropped, common Latin, Greek, and
+// Cyrillic letters and typographic punctuation are spelled in ASCII, and
+// anything else becomes the replacement.
+type Normalize struct {
+	transliterate bool
+	replacement   string
+}
+
+func newNormalize(raw interface{}) (*Normalize, error) {
+	opts, enabled, err := optionMap(raw)
+	if err != nil || !enabled {
+		return nil, err
+	}
+
+	n := &Normalize{replacement: "?"}
+	n.transliterate, _ = opts["transliterate"].(bool)
+	if r, ok := opts["replacement"].(string); ok {
+		for _, c := range r {
+			if c > unicode.MaxASCII {
+				return nil, errors.New("replacement must be ASCII")
+			}
+		}
+		n.replacement = r
+	}
+	return n, nil
+}
+
+// Apply returns a copy of p with its text and names normalized
+func (t *Normalize) Apply(p *message.Packet) *message.Packet {
+	out := *p
+	out.ChannelName = t.text(p.ChannelName)
+
+	if p.FromNode != nil && p.FromNode.User != nil {
+		node := *p.FromNode
+		node.User = t.user(p.FromNode.User)
+		out.FromNode = &node
+	}
+
+	switch v := p.Payload.(type) {
+	case *message.TextMessage:
+		m := *v
+		m.Text = t.text(v.Text)
+		out.Payload = &m
+	case *message.DetectionEvent:
+		d := *v
+		d.Text = t.text(v.Text)
+		out.Payload = &d
+	case *message.StoreForward:
+		sf := *v
+		sf.Text = t.text(v.Text)
+		out.Payload = &sf
+	case *message.TAK:
+		tak := *v
+		tak.Callsign = t.text(v.Callsign)
+		tak.Chat = t.text(v.Chat)
+		out.Payload = &tak
+	case *message.User:
+		out.Payload = t.user(v)
+	}
+
+	return &out
+}
+
+func (t *Normalize) user(u *message.User) *message.User {
+	c := *u
+	c.LongName = t.text(u.LongName)
+	c.ShortName = t.text(u.ShortName)
+	return &c
+}
+
+// text normalizes a single string
+func (t *Normalize) text(s string) string {
+	if s == "" {
+		return s
+	}
+	if !t.transliterate {
+		return strings.Map(keepPrintable, norm.NFC.String(s))
+	}
+
+	var b strings.Builder
+	for _, r := range norm.NFC.String(s) {
+		if ascii, ok := transliterations[r]; ok {
+			b.WriteString(ascii)
+			continue
+		}
+		// Decomposing splits accented letters into a base letter and
+		// combining marks, which are dropped
+		for _, d := range norm.NFKD.String(string(r)) {
+			t.ascii(&b, d)
+		}
+	}
+	return b.String()
+}
+
+// ascii writes the ASCII spelling of a decomposed rune
+func (t *Normalize) ascii(b *strings.Builder, r rune) {
+	switch {
+	case r <= unicode.MaxASCII:
+		if keepPrintable(r) >= 0 {
+			b.WriteRune(r)
+		}
+	case unicode.In(r, unicode.Mn, unicode.Cf, unicode.Cc):
+	case unicode.IsSpace(r):
+		b.WriteByte(' ')
+	default:
+		if ascii, ok := transliterations[r]; ok {
+			b.WriteString(ascii)
+		} else {
+			b.WriteString(t.replacement)
+		}
+	}
+}
+
+// keepPrintable maps control and format characters to -1 so strings.Map
+// drops them, keeping newlines, tabs, and emoji joiners
+func keepPrintable(r rune) rune {
+	switch {
+	case r == '\n', r == '\t', r == zeroWidthJoiner:
+		return r
+	case unicode.In(r, unicode.Cc, unicode.Cf):
+		return -1
+	}
+	return r
+}
+
+// transliterations spells letters and punctuation that do not decompose
+// to ASCII
+var transliterations = map[rune]string{
+	// Latin
+	'ß': "ss", 'ẞ': "SS", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE",
+	'ø': "o", 'Ø': "O", 'đ': "d", 'Đ': "D", 'ð': "d", 'Ð': "D",
+	'þ': "th", 'Þ': "Th", 'ł': "l", 'Ł': "L", 'ı': "i", 'ħ': "h", 'Ħ': "H",
+
+	// Punctuation and symbols
+	'‘': "'", '’': "'", '‚': "'", '′': "'", '“': `"`, '”': `"`, '„': `"`, '″': `"`,
+	'«': "<<", '»': ">>", '‹': "<", '›': ">",
+	'‐': "-", '‑': "-", '‒': "-", '–': "-", '—': "-", '―': "-", '−': "-",
+	'•': "*", '·': ".", '…': "...", '°': " deg", '×': "x", '÷': "/",
+	'¡': "!", '¿': "?", '€': "EUR", '£': "GBP", '¥': "JPY", '©': "(c)", '®': "(R)",
+
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th",
+	'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p",
+	'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+	'Α': "A", 'Β': "V", 'Γ': "G", 'Δ': "D", 'Ε': "E", 'Ζ': "Z", 'Η': "I", 'Θ': "Th",
+	'Ι': "I", 'Κ': "K", 'Λ': "L", 'Μ': "M", 'Ν': "N", 'Ξ': "X", 'Ο': "O", 'Π': "P",
+	'Ρ': "R", 'Σ': "S", 'Τ': "T", 'Υ': "Y", 'Φ': "F", 'Χ': "Ch", 'Ψ': "Ps", 'Ω': "O",
+
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'ґ': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'є': "ye", 'ж': "zh", 'з': "z", 'и': "i", 'і': "i", 'ї': "yi", 'й': "y", 'к': "k",
+	'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+	'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+	'А': "A", 'Б': "B", 'В': "V", 'Г': "G", 'Ґ': "G", 'Д': "D", 'Е': "E", 'Ё': "E",
+	'Є': "Ye", 'Ж': "Zh", 'З': "Z", 'И': "I", 'І': "I", 'Ї': "Yi", 'Й': "Y", 'К': "K",
+	'Л': "L", 'М': "M", 'Н': "N", 'О': "O", 'П': "P", 'Р': "R", 'С': "S", 'Т': "T",
+	'У': "U", 'Ф': "F", 'Х': "Kh", 'Ц': "Ts", 'Ч': "Ch", 'Ш': "Sh", 'Щ': "Shch",
+	'Ъ': "", 'Ы': "Y", 'Ь': "", 'Э': "E", 'Ю': "Yu", 'Я': "Ya",
+}
@@ -0,0 +1,86 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// Pseudonymize replaces node numbers and names with stable pseudonyms
+// derived from an HMAC of the node number, so statistics can be published
+// without exposing real identities. Message content is left untouched.
+type Pseudonymize struct {
+	hash *hasher
+}
+
+func newPseudonymize(raw interface{}) (*Pseudonymize, error) {
+	opts, enabled, err := optionMap(raw)
+	if err != nil || !enabled {
+		return nil, err
+	}
+
+	// A random key would give new pseudonyms on every restart, which
+	// defeats publishing statistics over time
+	salt, _ := opts["salt"].(string)
+	if salt == "" {
+		return nil, errors.New("salt is required")
+	}
+
+	h, err := newHasher(salt)
+	if err != nil {
+		return nil, err
+	}
+	return &Pseudonymize{hash: h}, nil
+}
+
+// Apply returns a copy of p with node identities replaced
+func (t *Pseudonymize) Apply(p *message.Packet) *message.Packet {
+	out := *p
+	out.From = t.hash.node(p.From)
+	out.To = t.hash.node(p.To)
+	if p.GatewayID != "" {
+		out.GatewayID = t.gateway(p.GatewayID)
+	}
+
+	// The raw payload may carry names, e.g. in NodeInfo packets
+	out.RawPayload = nil
+
+	if p.FromNode != nil {
+		node := *p.FromNode
+		node.Num = out.From
+		if node.User != nil {
+			node.User = t.user(p.From)
+		}
+		out.FromNode = &node
+	}
+
+	if _, ok := p.Payload.(*message.User); ok {
+		out.Payload = t.user(p.From)
+	}
+
+	return &out
+}
+
+// gateway pseudonymizes a "!abcd1234" gateway ID; IDs in any other form
+// are dropped rather than passed through
+func (t *Pseudonymize) gateway(id string) string {
+	num, err := message.ParseNodeID(id)
+	if err != nil || !strings.HasPrefix(id, "!") {
+		return ""
+	}
+	return fmt.Sprintf("!%08x", t.hash.node(num))
+}
+
+// user builds a pseudonymous user in the format the firmware uses for
+// nodes without a name
+func (t *Pseudonymize) user(num uint32) *message.User {
+	id := t.hash.node(num)
+	short := fmt.Sprintf("%04x", id&0xFFFF)
+	return &message.User{
+		ID:        fmt.Sprintf("!%08x", id),
+		LongName:  "Meshtastic " + short,
+		ShortName: short,
+	}
+}
@@ -0,0 +1,65 @@
+package transform
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// DefaultPositionDecimals keeps roughly 1 km of position precision
+const DefaultPositionDecimals = 2
+
+// PublicFeed reduces packets to a fixed allowlist suitable for publishing:
+// receive time (to the minute), port, channel, a pseudonymous sender hash,
+// and a coarse position for position packets. Everything else, including
+// message text and node names, is dropped.
+type PublicFeed struct {
+	decimals int
+	hash     *hasher
+}
+
+func newPublicFeed(raw interface{}) (*PublicFeed, error) {
+	opts, enabled, err := optionMap(raw)
+	if err != nil || !enabled {
+		return nil, err
+	}
+
+	decimals := intOpt(opts, "position_decimals", DefaultPositionDecimals)
+	if decimals < 0 || decimals > 7 {
+		return nil, fmt.Errorf("position_decimals must be between 0 and 7")
+	}
+
+	salt, _ := opts["salt"].(string)
+	h, err := newHasher(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PublicFeed{decimals: decimals, hash: h}, nil
+}
+
+// Apply builds a new packet holding only allowlisted fields
+func (f *PublicFeed) Apply(p *message.Packet) *message.Packet {
+	out := &message.Packet{
+		From:       f.hash.node(p.From),
+		Channel:    p.Channel,
+		PortNum:    p.PortNum,
+		ReceivedAt: p.ReceivedAt.UTC().Truncate(time.Minute),
+	}
+
+	if pos, ok := p.Payload.(*message.Position); ok {
+		out.Payload = &message.Position{
+			Latitude:  f.round(pos.Latitude),
+			Longitude: f.round(pos.Longitude),
+		}
+	}
+
+	return out
+}
+
+func (f *PublicFeed) round(v float64) float64 {
+	scale := math.Pow10(f.decimals)
+	return math.Round(v*scale) / scale
+}
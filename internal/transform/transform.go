@@ -0,0 +1,137 @@
+// Package transform rewrites packets before they reach an output, e.g. to
+// strip fields for public feeds.
+package transform
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+// Transform rewrites a packet for an output. Implementations must not
+// modify the input, since the same packet is shared by all outputs.
+// Returning nil drops the packet for that output.
+type Transform interface {
+	Apply(p *message.Packet) *message.Packet
+}
+
+// Chain applies transforms in order, stopping if one drops the packet
+type Chain []Transform
+
+// Apply runs every transform in the chain
+func (c Chain) Apply(p *message.Packet) *message.Packet {
+	for _, t := range c {
+		if p = t.Apply(p); p == nil {
+			return nil
+		}
+	}
+	return p
+}
+
+// FromOptions builds the transforms configured in an output's options
+func FromOptions(opts map[string]interface{}) (Chain, error) {
+	var chain Chain
+
+	if raw, ok := opts["public_feed"]; ok {
+		feed, err := newPublicFeed(raw)
+		if err != nil {
+			return nil, fmt.Errorf("public_feed: %w", err)
+		}
+		if feed != nil {
+			chain = append(chain, feed)
+		}
+	}
+
+	if raw, ok := opts["pseudonymize"]; ok {
+		p, err := newPseudonymize(raw)
+		if err != nil {
+			return nil, fmt.Errorf("pseudonymize: %w", err)
+		}
+		if p != nil {
+			chain = append(chain, p)
+		}
+	}
+
+	if raw, ok := opts["normalize_text"]; ok {
+		n, err := newNormalize(raw)
+		if err != nil {
+			return nil, fmt.Errorf("normalize_text: %w", err)
+		}
+		if n != nil {
+			chain = append(chain, n)
+		}
+	}
+
+	return chain, nil
+}
+
+// hasher derives stable pseudonyms for node numbers
+type hasher struct {
+	key []byte
+}
+
+// newHasher creates a hasher keyed by salt. Without a salt a random key is
+// used, so pseudonyms only stay stable until the relay restarts.
+func newHasher(salt string) (*hasher, error) {
+	if salt != "" {
+		return &hasher{key: []byte(salt)}, nil
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return &hasher{key: key}, nil
+}
+
+// node returns the pseudonym for a node number. Broadcast and unset
+// addresses are kept since they identify nobody.
+func (h *hasher) node(num uint32) uint32 {
+	if num == 0 || num == meshtastic.BroadcastAddr {
+		return num
+	}
+
+	mac := hmac.New(sha256.New, h.key)
+	_ = binary.Write(mac, binary.BigEndian, num)
+	sum := binary.BigEndian.Uint32(mac.Sum(nil))
+
+	// Keep pseudonyms out of the reserved range
+	if sum == 0 || sum == meshtastic.BroadcastAddr {
+		sum = 1
+	}
+	return sum
+}
+
+func optionMap(raw interface{}) (map[string]interface{}, bool, error) {
+	switch v := raw.(type) {
+	case bool:
+		return map[string]interface{}{}, v, nil
+	case map[string]interface{}:
+		enabled := true
+		if e, ok := v["enabled"].(bool); ok {
+			enabled = e
+		}
+		return v, enabled, nil
+	case nil:
+		return map[string]interface{}{}, false, nil
+	default:
+		return nil, false, fmt.Errorf("expected true/false or a map, got %T", raw)
+	}
+}
+
+func intOpt(opts map[string]interface{}, key string, def int) int {
+	switch v := opts[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return def
+}
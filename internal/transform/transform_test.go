@@ -0,0 +1,185 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+func TestPublicFeedAllowlist(t *testing.T) {
+	chain, err := FromOptions(map[string]interface{}{
+		"public_feed": map[string]interface{}{"salt": "s3cret", "position_decimals": 2},
+	})
+	if err != nil {
+		t.Fatalf("FromOptions: %v", err)
+	}
+	if len(chain) != 1 {
+		t.Fatalf("expected 1 transform, got %d", len(chain))
+	}
+
+	received := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+	in := &message.Packet{
+		ID:         42,
+		From:       0x12345678,
+		To:         0x87654321,
+		Channel:    1,
+		PortNum:    message.PortNumPosition,
+		Payload:    &message.Position{Latitude: 45.123456, Longitude: -122.987654, Altitude: 100},
+		RawPayload: []byte{1, 2, 3},
+		SNR:        5.5,
+		RSSI:       -90,
+		ReceivedAt: received,
+		FromNode:   &message.NodeInfo{Num: 0x12345678, User: &message.User{LongName: "Alice"}},
+		GatewayID:  "!12345678",
+	}
+
+	out := chain.Apply(in)
+	if out == nil {
+		t.Fatal("packet dropped")
+	}
+	if out.From == in.From || out.From == 0 {
+		t.Errorf("From not pseudonymized: %x", out.From)
+	}
+	if out.ID != 0 || out.To != 0 || out.RawPayload != nil || out.SNR != 0 || out.RSSI != 0 || out.FromNode != nil || out.GatewayID != "" {
+		t.Errorf("non-allowlisted fields leaked: %+v", out)
+	}
+	if !out.ReceivedAt.Equal(received.Truncate(time.Minute)) {
+		t.Errorf("ReceivedAt = %v", out.ReceivedAt)
+	}
+	pos, ok := out.Payload.(*message.Position)
+	if !ok {
+		t.Fatalf("payload = %T", out.Payload)
+	}
+	if pos.Latitude != 45.12 || pos.Longitude != -122.99 || pos.Altitude != 0 {
+		t.Errorf("position not coarsened: %+v", pos)
+	}
+	if in.FromNode == nil || in.RawPayload == nil {
+		t.Error("input packet was modified")
+	}
+
+	// Same salt, same pseudonym
+	again, _ := FromOptions(map[string]interface{}{"public_feed": map[string]interface{}{"salt": "s3cret"}})
+	if got := again.Apply(in).From; got != out.From {
+		t.Errorf("pseudonym not stable: %x != %x", got, out.From)
+	}
+
+	text := chain.Apply(&message.Packet{From: 1, PortNum: message.PortNumTextMessage, Payload: &message.TextMessage{Text: "hi"}})
+	if text.Payload != nil {
+		t.Errorf("text payload leaked: %+v", text.Payload)
+	}
+}
+
+func TestFromOptionsDisabled(t *testing.T) {
+	for _, opts := range []map[string]interface{}{
+		{},
+		{"public_feed": false},
+		{"public_feed": map[string]interface{}{"enabled": false}},
+	} {
+		chain, err := FromOptions(opts)
+		if err != nil || len(chain) != 0 {
+			t.Errorf("FromOptions(%v) = %v, %v", opts, chain, err)
+		}
+	}
+
+	if _, err := FromOptions(map[string]interface{}{"public_feed": "yes"}); err == nil {
+		t.Error("expected error for invalid public_feed")
+	}
+}
+
+func TestPseudonymize(t *testing.T) {
+	chain, err := FromOptions(map[string]interface{}{
+		"pseudonymize": map[string]interface{}{"salt": "s3cret"},
+	})
+	if err != nil {
+		t.Fatalf("FromOptions: %v", err)
+	}
+
+	in := &message.Packet{
+		From:       0x12345678,
+		To:         0xFFFFFFFF,
+		PortNum:    message.PortNumNodeInfo,
+		Payload:    &message.User{ID: "!12345678", LongName: "Alice", ShortName: "AL"},
+		RawPayload: []byte("Alice"),
+		FromNode:   &message.NodeInfo{Num: 0x12345678, User: &message.User{LongName: "Alice"}},
+		GatewayID:  "!12345678",
+	}
+
+	out := chain.Apply(in)
+	if out.From == in.From || out.To != in.To || out.RawPayload != nil {
+		t.Errorf("unexpected packet: %+v", out)
+	}
+	user, ok := out.Payload.(*message.User)
+	if !ok || user.LongName == "Alice" || user.ID == "!12345678" {
+		t.Errorf("payload not pseudonymized: %+v", out.Payload)
+	}
+	if out.FromNode.Num != out.From || *out.FromNode.User != *user {
+		t.Errorf("FromNode inconsistent: %+v", out.FromNode)
+	}
+	if out.GatewayID != user.ID {
+		t.Errorf("GatewayID = %q, want %q", out.GatewayID, user.ID)
+	}
+	if in.FromNode.User.LongName != "Alice" {
+		t.Error("input packet was modified")
+	}
+
+	text := chain.Apply(&message.Packet{From: 0x12345678, Payload: &message.TextMessage{Text: "hi"}})
+	if text.From != out.From {
+		t.Errorf("pseudonym not stable: %x != %x", text.From, out.From)
+	}
+
+	if _, err := FromOptions(map[string]interface{}{"pseudonymize": true}); err == nil {
+		t.Error("expected error without salt")
+	}
+}
+
+func TestNormalizeText(t *testing.T) {
+	in := &message.Packet{
+		PortNum:  message.PortNumTextMessage,
+		Payload:  &message.TextMessage{Text: "Caf\u0065\u0301 \u202eopen\u202c\x07 at 9–\u200b5\n"},
+		FromNode: &message.NodeInfo{User: &message.User{LongName: "Jürgen", ShortName: "JÜ"}},
+	}
+
+	chain, err := FromOptions(map[string]interface{}{"normalize_text": true})
+	if err != nil {
+		t.Fatalf("FromOptions: %v", err)
+	}
+	out := chain.Apply(in)
+	if got, want := out.Payload.(*message.TextMessage).Text, "Café open at 9–5\n"; got != want {
+		t.Errorf("normalized text = %q, want %q", got, want)
+	}
+	if out.FromNode.User.LongName != "Jürgen" {
+		t.Errorf("name changed without transliterate: %q", out.FromNode.User.LongName)
+	}
+
+	chain, err = FromOptions(map[string]interface{}{"normalize_text": map[string]interface{}{"transliterate": true}})
+	if err != nil {
+		t.Fatalf("FromOptions: %v", err)
+	}
+	out = chain.Apply(in)
+	if got, want := out.Payload.(*message.TextMessage).Text, "Cafe open at 9-5\n"; got != want {
+		t.Errorf("transliterated text = %q, want %q", got, want)
+	}
+	if got := out.FromNode.User.LongName; got != "Jurgen" {
+		t.Errorf("transliterated name = %q", got)
+	}
+	for text, want := range map[string]string{
+		"Straße “Łódź”":  `Strasse "Lodz"`,
+		"Привет, Москва": "Privet, Moskva",
+		"Καλημέρα":       "Kalimera",
+		"ok 👍🏽 日本":       "ok ?? ??",
+		"a\u00a0b":       "a b",
+	} {
+		got := chain.Apply(&message.Packet{Payload: &message.TextMessage{Text: text}}).Payload.(*message.TextMessage).Text
+		if got != want {
+			t.Errorf("transliterate(%q) = %q, want %q", text, got, want)
+		}
+	}
+
+	if in.Payload.(*message.TextMessage).Text == "Cafe open at 9-5\n" || in.FromNode.User.LongName != "Jürgen" {
+		t.Error("input packet was modified")
+	}
+	if _, err := FromOptions(map[string]interface{}{"normalize_text": map[string]interface{}{"replacement": "¿"}}); err == nil {
+		t.Error("non-ASCII replacement accepted")
+	}
+}
@@ -0,0 +1,120 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/alerts"
+)
+
+// maxAlertRows is the most alerts the pane lists at once
+const maxAlertRows = 8
+
+// refreshAlerts reloads the active alerts and surfaces new notifications
+// as the notice line
+func (m *Model) refreshAlerts(now time.Time) {
+	if m.backend == nil {
+		return
+	}
+	engine := m.backend.Alerts()
+	if engine == nil {
+		return
+	}
+
+	m.alerts = engine.Active(now)
+	if m.alertIndex >= len(m.alerts) {
+		m.alertIndex = max(len(m.alerts)-1, 0)
+	}
+
+	var latest *alerts.Alert
+	for i := range m.alerts {
+		a := &m.alerts[i]
+		if a.Seq > m.alertSeq && (latest == nil || a.Seq > latest.Seq) {
+			latest = a
+		}
+	}
+	if latest != nil {
+		m.alertSeq = latest.Seq
+		m.notice = "⚠ " + latest.Text
+	}
+}
+
+// unackedAlerts counts the listed alerts not yet acknowledged
+//
+//nolint:gocritic // hugeParam: consistency with tea.Model interface methods
+func (m Model) unackedAlerts() int {
+	n := 0
+	for i := range m.alerts {
+		if !m.alerts[i].Acked(m.lastUpdate) {
+			n++
+		}
+	}
+	return n
+}
+
+// updateAlerts handles keys while the alerts pane is open
+func (m *Model) updateAlerts(key tea.KeyMsg) tea.Cmd {
+	switch key.String() {
+	case "esc", "a":
+		m.alertsOpen = false
+	case "up", "k":
+		if m.alertIndex > 0 {
+			m.alertIndex--
+		}
+	case "down", "j":
+		if m.alertIndex < len(m.alerts)-1 {
+			m.alertIndex++
+		}
+	case "enter", "s":
+		if len(m.alerts) == 0 {
+			return nil
+		}
+		engine := m.backend.Alerts()
+		now := time.Now()
+		a := m.alerts[m.alertIndex]
+		if key.String() == "enter" {
+			engine.Ack(a.Key, now)
+			m.notice = "Acknowledged: " + a.Text
+		} else {
+			engine.Snooze(a.Key, now)
+			m.notice = "Snoozed: " + a.Text
+		}
+		m.refreshAlerts(now)
+	}
+	return nil
+}
+
+//nolint:gocritic // hugeParam: consistency with tea.Model interface methods
+func (m Model) renderAlerts() string {
+	var b strings.Builder
+	b.WriteString(statLabelStyle.Render(fmt.Sprintf("Alerts (%d)", len(m.alerts))))
+	b.WriteString("\n")
+
+	if len(m.alerts) == 0 {
+		b.WriteString(statLabelStyle.Render("No active alerts"))
+	}
+
+	// Keep the selection in view
+	start := 0
+	if m.alertIndex >= maxAlertRows {
+		start = m.alertIndex - maxAlertRows + 1
+	}
+	for i := start; i < len(m.alerts) && i < start+maxAlertRows; i++ {
+		a := m.alerts[i]
+		line := fmt.Sprintf("%s %s", a.Raised.Format("15:04"), a.Text)
+		switch {
+		case i == m.alertIndex:
+			b.WriteString(messageFromStyle.Render("> " + line))
+		case a.Acked(m.lastUpdate):
+			b.WriteString(statLabelStyle.Render("✓ " + line))
+		default:
+			b.WriteString(errorStyle.Render("! " + line))
+		}
+		b.WriteString("\n")
+	}
+
+	return boxStyle.Width(m.width - 4).Render(strings.TrimRight(b.String(), "\n"))
+}
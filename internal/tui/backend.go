@@ -0,0 +1,232 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/alerts"
+	"github.com/iamruinous/meshtastic-message-relay/internal/api"
+	"github.com/iamruinous/meshtastic-message-relay/internal/canned"
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+	"github.com/iamruinous/meshtastic-message-relay/internal/geo"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/notes"
+	"github.com/iamruinous/meshtastic-message-relay/internal/relay"
+)
+
+const (
+	// messageBuffer is how many received messages wait for the TUI before
+	// newer ones are dropped
+	messageBuffer = 256
+
+	// reconnectDelay is how long an attached TUI waits before reopening a
+	// broken message stream
+	reconnectDelay = 5 * time.Second
+)
+
+// errOverAPI is returned for what a TUI attached over the API cannot do
+var errOverAPI = errors.New("not available over the API; use run --interactive on the relay's host")
+
+// Backend is the relay the TUI shows: a service in this process, or a
+// relay running elsewhere reached over its HTTP API
+type Backend interface {
+	// Messages returns the packets the relay receives from now on
+	Messages() <-chan *message.Packet
+	// Snapshot returns the relay's current state
+	Snapshot(ctx context.Context) (Snapshot, error)
+	// Send sends a packet the relay originates to the mesh
+	Send(ctx context.Context, packet *message.Packet) error
+	// SendAndWaitAck sends a packet and waits for its destination's ack,
+	// when the snapshot reports CanWaitForAck
+	SendAndWaitAck(ctx context.Context, packet *message.Packet) (connection.Ack, error)
+	// QuickReplies returns the device's canned messages
+	QuickReplies(ctx context.Context) ([]string, error)
+	// Notes returns the operator notes on a packet
+	Notes(p *message.Packet) []notes.Note
+	// Alerts returns the alert engine, or nil if there is none
+	Alerts() *alerts.Engine
+	// Close stops delivering messages
+	Close()
+}
+
+// Snapshot is the relay's state shown in the status bar and panels
+type Snapshot struct {
+	Stats         relay.Stats
+	Connected     bool
+	ConnName      string // empty without a connection
+	Device        *connection.DeviceProfile
+	Outputs       []relay.OutputStatus
+	Home          *geo.Point
+	SafeMode      bool
+	CanWaitForAck bool
+}
+
+// local is a relay service running in this process
+type local struct {
+	service  *relay.Service
+	messages <-chan *message.Packet
+	stop     func()
+}
+
+// Local returns a backend for a service running in this process
+func Local(service *relay.Service) Backend {
+	messages, stop := service.Subscribe(messageBuffer)
+	return &local{service: service, messages: messages, stop: stop}
+}
+
+func (l *local) Messages() <-chan *message.Packet {
+	return l.messages
+}
+
+func (l *local) Snapshot(context.Context) (Snapshot, error) {
+	snap := Snapshot{
+		Stats:    l.service.GetStats(),
+		Outputs:  l.service.OutputStatuses(),
+		SafeMode: l.service.SafeMode(),
+	}
+	if conn := l.service.GetConnection(); conn != nil {
+		snap.Connected = conn.IsConnected()
+		snap.ConnName = conn.Name()
+		snap.Device = connection.Profile(conn)
+		_, snap.CanWaitForAck = conn.(connection.AckTransport)
+	}
+	if home, _, ok := l.service.Home().Get(); ok {
+		snap.Home = &home
+	}
+	return snap, nil
+}
+
+func (l *local) Send(ctx context.Context, packet *message.Packet) error {
+	return l.service.Send(ctx, packet)
+}
+
+func (l *local) SendAndWaitAck(ctx context.Context, packet *message.Packet) (connection.Ack, error) {
+	return l.service.SendAndWaitAck(ctx, packet)
+}
+
+func (l *local) QuickReplies(ctx context.Context) ([]string, error) {
+	admin, ok := l.service.GetConnection().(connection.AdminTransport)
+	if !ok {
+		return nil, fmt.Errorf("connection does not support canned messages")
+	}
+	return canned.Get(ctx, admin)
+}
+
+func (l *local) Notes(p *message.Packet) []notes.Note {
+	if store := l.service.Notes(); store != nil {
+		return store.OnPacket(p)
+	}
+	return nil
+}
+
+func (l *local) Alerts() *alerts.Engine {
+	return l.service.Alerts()
+}
+
+func (l *local) Close() {
+	l.stop()
+}
+
+// remote is a relay reached over its HTTP API
+type remote struct {
+	client   *api.Client
+	messages chan *message.Packet
+	cancel   context.CancelFunc
+}
+
+// Remote returns a backend for the relay whose API is at base, sending
+// token when it is set. It streams messages until closed, reopening the
+// stream when it breaks.
+func Remote(base, token string) Backend {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &remote{
+		client:   api.NewClient(base, token),
+		messages: make(chan *message.Packet, messageBuffer),
+		cancel:   cancel,
+	}
+	go r.stream(ctx)
+	return r
+}
+
+func (r *remote) stream(ctx context.Context) {
+	for {
+		_ = r.client.Stream(ctx, func(p *message.Packet) {
+			select {
+			case r.messages <- p:
+			default:
+			}
+		})
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (r *remote) Messages() <-chan *message.Packet {
+	return r.messages
+}
+
+func (r *remote) Snapshot(ctx context.Context) (Snapshot, error) {
+	status, err := r.client.Status(ctx)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	st := status.Stats
+	snap := Snapshot{
+		Stats: relay.Stats{
+			MessagesReceived: st.Received,
+			MessagesSent:     st.Sent,
+			MessagesFiltered: st.Filtered,
+			IngestDropped:    st.IngestDropped,
+			Duplicates:       st.Duplicates,
+			Errors:           st.Errors,
+			Failovers:        st.Failovers,
+			StallRecoveries:  st.StallRecoveries,
+			DeadLettered:     st.DeadLettered,
+			Redelivered:      st.Redelivered,
+			QueueDrops:       st.QueueDrops,
+			DeadLetters:      st.DeadLetters,
+		},
+		Connected: status.Connection.Connected,
+		ConnName:  status.Connection.Name,
+		Device:    status.Connection.Device,
+		Outputs:   status.OutputStatus,
+		SafeMode:  status.SafeMode,
+	}
+	if status.Home != nil {
+		snap.Home = &geo.Point{Lat: status.Home.Lat, Lon: status.Home.Lon}
+	}
+	return snap, nil
+}
+
+func (r *remote) Send(ctx context.Context, packet *message.Packet) error {
+	req := api.SendRequest{Text: packet.Text(), Channel: packet.Channel}
+	if packet.To != 0 {
+		req.To = fmt.Sprintf("!%08x", packet.To)
+	}
+	return r.client.Send(ctx, req)
+}
+
+func (r *remote) SendAndWaitAck(context.Context, *message.Packet) (connection.Ack, error) {
+	return connection.Ack{}, errOverAPI
+}
+
+func (r *remote) QuickReplies(ctx context.Context) ([]string, error) {
+	return r.client.Canned(ctx)
+}
+
+func (r *remote) Notes(*message.Packet) []notes.Note {
+	return nil
+}
+
+func (r *remote) Alerts() *alerts.Engine {
+	return nil
+}
+
+func (r *remote) Close() {
+	r.cancel()
+}
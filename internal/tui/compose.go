@@ -0,0 +1,199 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+const (
+	// maxTextLength is the longest text the send box takes, as for the
+	// API's POST /send
+	maxTextLength = 200
+
+	// ackTimeout bounds the wait for a direct message's ack
+	ackTimeout = time.Minute
+)
+
+// sentMsg reports the result of a message sent from the send box
+type sentMsg struct {
+	id    uint64
+	acked bool
+	hops  int
+	err   error
+}
+
+// newCompose returns the send box's text input
+func newCompose() textinput.Model {
+	ti := textinput.New()
+	ti.Placeholder = "Message"
+	ti.CharLimit = maxTextLength
+	ti.Prompt = "> "
+	return ti
+}
+
+// sendText sends text to a node, waiting for its ack when the connection
+// can, or broadcasts it on the primary channel when to is 0
+func sendText(backend Backend, id uint64, to uint32, text string, canAck bool) tea.Cmd {
+	return func() tea.Msg {
+		packet := &message.Packet{
+			To:      to,
+			PortNum: message.PortNumTextMessage,
+			Payload: &message.TextMessage{Text: text},
+		}
+		if !canAck || to == 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), quickReplyTimeout)
+			defer cancel()
+			return sentMsg{id: id, err: backend.Send(ctx, packet)}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), ackTimeout)
+		defer cancel()
+		ack, err := backend.SendAndWaitAck(ctx, packet)
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("no ack within %s", ackTimeout)
+		}
+		return sentMsg{id: id, acked: err == nil, hops: ack.Hops, err: err}
+	}
+}
+
+// openCompose opens the send box, addressed to broadcast
+func (m *Model) openCompose() tea.Cmd {
+	m.composeOpen = true
+	m.composeTo = 0
+	m.compose.Reset()
+	return m.compose.Focus()
+}
+
+// updateCompose handles keys while the send box is open
+func (m *Model) updateCompose(key tea.KeyMsg) tea.Cmd {
+	switch key.String() {
+	case "esc":
+		m.composeOpen = false
+		m.compose.Blur()
+		return nil
+	case "tab":
+		m.composeTo = m.nextRecipient(m.composeTo)
+		return nil
+	case "enter":
+		text := strings.TrimSpace(m.compose.Value())
+		if text == "" {
+			return nil
+		}
+		m.composeOpen = false
+		m.compose.Blur()
+		return m.send(m.composeTo, text)
+	}
+
+	var cmd tea.Cmd
+	m.compose, cmd = m.compose.Update(key)
+	return cmd
+}
+
+// send lists an outgoing message, pending until sentMsg reports on it
+func (m *Model) send(to uint32, text string) tea.Cmd {
+	m.sendSeq++
+	status := "sending..."
+	if m.canAck && to != 0 {
+		status = "waiting for ack..."
+	}
+	m.messages = append(m.messages, MessageDisplay{
+		Time:     time.Now(),
+		From:     "→ " + m.recipientName(to),
+		Type:     message.PortNumTextMessage.String(),
+		Content:  text,
+		Outgoing: true,
+		SendID:   m.sendSeq,
+		Status:   status,
+	})
+	m.trimMessages()
+	m.viewport.SetContent(m.renderMessages())
+	if m.selected < 0 {
+		m.viewport.GotoBottom()
+	}
+	return sendText(m.backend, m.sendSeq, to, text, m.canAck)
+}
+
+// delivered shows the result of a send on its message
+func (m *Model) delivered(msg sentMsg) {
+	for i := range m.messages {
+		d := &m.messages[i]
+		if !d.Outgoing || d.SendID != msg.id {
+			continue
+		}
+		switch {
+		case msg.err != nil:
+			d.Status, d.Failed = "✗ "+msg.err.Error(), true
+		case !msg.acked:
+			d.Status = "✓ sent"
+		case msg.hops >= 0:
+			d.Status = fmt.Sprintf("✓ acked (%d hops)", msg.hops)
+		default:
+			d.Status = "✓ acked"
+		}
+		break
+	}
+	m.viewport.SetContent(m.renderMessages())
+}
+
+// nextRecipient returns the destination after to: broadcast, then each
+// node heard from, most recent first
+//
+//nolint:gocritic // hugeParam: consistency with tea.Model interface methods
+func (m Model) nextRecipient(to uint32) uint32 {
+	var self uint32
+	if m.device != nil {
+		self = m.device.NodeNum
+	}
+	nodes := []uint32{0}
+	seen := map[uint32]bool{0: true, self: true}
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		p := m.messages[i].Packet
+		if p == nil || seen[p.From] {
+			continue
+		}
+		seen[p.From] = true
+		nodes = append(nodes, p.From)
+	}
+	for i, n := range nodes {
+		if n == to {
+			return nodes[(i+1)%len(nodes)]
+		}
+	}
+	return 0
+}
+
+// recipientName names a destination by the short name it was last heard
+// with
+//
+//nolint:gocritic // hugeParam: consistency with tea.Model interface methods
+func (m Model) recipientName(to uint32) string {
+	if to == 0 {
+		return "broadcast"
+	}
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if p := m.messages[i].Packet; p != nil && p.From == to {
+			return m.messages[i].From
+		}
+	}
+	return fmt.Sprintf("!%08x", to)
+}
+
+//nolint:gocritic // hugeParam: consistency with tea.Model interface methods
+func (m Model) renderCompose() string {
+	var b strings.Builder
+	b.WriteString(statLabelStyle.Render("Send to ") + messageFromStyle.Render(m.recipientName(m.composeTo)))
+	if m.composeTo == 0 {
+		b.WriteString(statLabelStyle.Render(" (primary channel)"))
+	}
+	b.WriteString("\n")
+	b.WriteString(m.compose.View())
+	return boxStyle.Width(m.width - 4).Render(b.String())
+}
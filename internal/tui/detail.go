@@ -0,0 +1,179 @@
+package tui
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// selectPrev moves the selection up, starting from the newest message
+func (m *Model) selectPrev() {
+	switch {
+	case len(m.messages) == 0:
+		return
+	case m.selected < 0:
+		m.selected = len(m.messages) - 1
+	case m.selected > 0:
+		m.selected--
+	}
+	m.showSelection()
+}
+
+// selectNext moves the selection down; past the newest message it clears
+// the selection, so the list follows new messages again
+func (m *Model) selectNext() {
+	if m.selected < 0 {
+		return
+	}
+	m.selected++
+	if m.selected >= len(m.messages) {
+		m.selected = -1
+		m.viewport.SetContent(m.renderMessages())
+		m.viewport.GotoBottom()
+		return
+	}
+	m.showSelection()
+}
+
+// showSelection redraws the list and scrolls the selected message into
+// view
+func (m *Model) showSelection() {
+	var b strings.Builder
+	for _, msg := range m.messages[:m.selected] {
+		b.WriteString(m.renderMessage(msg))
+		b.WriteString("\n")
+	}
+	top := strings.Count(b.String(), "\n")
+	bottom := top + strings.Count(m.renderMessage(m.messages[m.selected]), "\n")
+
+	m.viewport.SetContent(m.renderMessages())
+	switch {
+	case top < m.viewport.YOffset:
+		m.viewport.SetYOffset(top)
+	case bottom >= m.viewport.YOffset+m.viewport.Height:
+		m.viewport.SetYOffset(bottom - m.viewport.Height + 1)
+	}
+}
+
+// openDetail opens the detail view of the selected message, or of the
+// newest when none is selected
+func (m *Model) openDetail() {
+	if len(m.messages) == 0 {
+		return
+	}
+	if m.selected < 0 {
+		m.selected = len(m.messages) - 1
+		m.showSelection()
+	}
+	m.detailOpen = true
+	m.detail = viewport.New(m.viewport.Width, m.viewport.Height-1) // less the title
+	m.detail.SetContent(m.renderDetail(m.messages[m.selected]))
+}
+
+// updateDetail handles keys while the detail view is open
+func (m *Model) updateDetail(key tea.KeyMsg) tea.Cmd {
+	switch key.String() {
+	case "esc", "enter", "q":
+		m.detailOpen = false
+		return nil
+	}
+	var cmd tea.Cmd
+	m.detail, cmd = m.detail.Update(key)
+	return cmd
+}
+
+// renderDetail shows every field of a message, its raw payload, and its
+// decoded payload
+//
+//nolint:gocritic // hugeParam: consistency with tea.Model interface methods
+func (m Model) renderDetail(msg MessageDisplay) string {
+	var b strings.Builder
+	field := func(name, value string) {
+		b.WriteString(statLabelStyle.Render(fmt.Sprintf("%-12s", name)))
+		b.WriteString(messageContentStyle.Render(value))
+		b.WriteString("\n")
+	}
+
+	p := msg.Packet
+	if p == nil {
+		// Sent from the send box
+		field("To", strings.TrimPrefix(msg.From, "→ "))
+		field("Sent", msg.Time.Format(time.RFC3339))
+		field("Port", msg.Type)
+		field("Text", msg.Content)
+		field("Status", msg.Status)
+		return b.String()
+	}
+
+	field("ID", fmt.Sprintf("%d (0x%08x)", p.ID, p.ID))
+	if p.Seq != 0 {
+		field("Seq", fmt.Sprintf("%d", p.Seq))
+	}
+	field("From", fmt.Sprintf("%s (%s)", p.FromName(), p.FromID()))
+	to := fmt.Sprintf("!%08x", p.To)
+	if p.To == 0xFFFFFFFF {
+		to = "broadcast"
+	}
+	field("To", to)
+	channel := fmt.Sprintf("%d", p.Channel)
+	if p.ChannelName != "" {
+		channel += " (" + p.ChannelName + ")"
+	}
+	field("Channel", channel)
+	field("Port", fmt.Sprintf("%s (%d)", p.PortNum, p.PortNum))
+	field("Received", p.ReceivedAt.Format(time.RFC3339Nano))
+	field("SNR", fmt.Sprintf("%.2f dB", p.SNR))
+	field("RSSI", fmt.Sprintf("%d dBm", p.RSSI))
+	field("Hop limit", fmt.Sprintf("%d", p.HopLimit))
+	field("Want ack", fmt.Sprintf("%t", p.WantAck))
+	if p.GatewayID != "" {
+		field("Gateway", p.GatewayID)
+	}
+	if p.Canary {
+		field("Canary", "true")
+	}
+	if m.backend != nil {
+		for _, n := range m.backend.Notes(p) {
+			field("Note", n.String())
+		}
+	}
+
+	b.WriteString("\n")
+	b.WriteString(statLabelStyle.Render(fmt.Sprintf("Raw payload (%d bytes)", len(p.RawPayload))))
+	b.WriteString("\n")
+	if len(p.RawPayload) > 0 {
+		b.WriteString(messageContentStyle.Render(strings.TrimRight(hex.Dump(p.RawPayload), "\n")))
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	b.WriteString(statLabelStyle.Render("Decoded payload"))
+	b.WriteString("\n")
+	b.WriteString(messageContentStyle.Render(decodedJSON(p)))
+	return b.String()
+}
+
+// decodedJSON returns a packet's decoded payload as indented JSON
+func decodedJSON(p *message.Packet) string {
+	if p.Payload == nil {
+		return "none"
+	}
+	data, err := json.MarshalIndent(p.Payload, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%v", p.Payload)
+	}
+	return string(data)
+}
+
+//nolint:gocritic // hugeParam: consistency with tea.Model interface methods
+func (m Model) renderDetailBox() string {
+	title := statLabelStyle.Render("Message detail")
+	return boxStyle.Width(m.width - 4).Render(title + "\n" + m.detail.View())
+}
@@ -0,0 +1,141 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+const (
+	// maxSamples is how many readings each graph keeps
+	maxSamples = 30
+
+	// maxGraphRows is the most nodes the graphs panel lists at once
+	maxGraphRows = 8
+)
+
+// sparkBlocks draw a sparkline from lowest to highest
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// nodeGraph holds a node's recent signal readings and channel
+// utilization
+type nodeGraph struct {
+	name  string
+	heard time.Time
+	snr   []float64
+	rssi  []float64
+	util  []float64 // from the node's device telemetry
+}
+
+// appendSample adds v to samples, dropping the oldest past maxSamples
+func appendSample(samples []float64, v float64) []float64 {
+	samples = append(samples, v)
+	if len(samples) > maxSamples {
+		samples = samples[len(samples)-maxSamples:]
+	}
+	return samples
+}
+
+// recordGraphs adds a packet's signal and channel utilization to its
+// sender's graphs
+func (m *Model) recordGraphs(p *message.Packet, name string) {
+	if m.graphs == nil {
+		m.graphs = make(map[uint32]*nodeGraph)
+	}
+	g := m.graphs[p.From]
+	if g == nil {
+		g = &nodeGraph{}
+		m.graphs[p.From] = g
+	}
+	g.name, g.heard = name, p.ReceivedAt
+
+	// Packets from the attached device itself carry no signal readings
+	if p.SNR != 0 || p.RSSI != 0 {
+		g.snr = appendSample(g.snr, float64(p.SNR))
+		g.rssi = appendSample(g.rssi, float64(p.RSSI))
+	}
+	if t, ok := p.Payload.(*message.Telemetry); ok {
+		g.util = appendSample(g.util, float64(t.ChannelUtilization))
+	}
+}
+
+// sparkline draws samples scaled between their lowest and highest value
+func sparkline(samples []float64) string {
+	if len(samples) == 0 {
+		return ""
+	}
+	lo, hi := samples[0], samples[0]
+	for _, v := range samples {
+		lo, hi = min(lo, v), max(hi, v)
+	}
+	var b strings.Builder
+	for _, v := range samples {
+		i := len(sparkBlocks) / 2
+		if hi > lo {
+			i = int((v - lo) / (hi - lo) * float64(len(sparkBlocks)-1))
+		}
+		b.WriteRune(sparkBlocks[i])
+	}
+	return b.String()
+}
+
+// graphLine labels a sparkline with its latest value
+func graphLine(label string, samples []float64, format string) string {
+	if len(samples) == 0 {
+		return statLabelStyle.Render(fmt.Sprintf("%s %-*s %8s", label, maxSamples, "", "-"))
+	}
+	latest := fmt.Sprintf(format, samples[len(samples)-1])
+	return statLabelStyle.Render(label+" ") +
+		messageTypeStyle.Render(fmt.Sprintf("%-*s", maxSamples, sparkline(samples))) +
+		statValueStyle.Render(fmt.Sprintf(" %8s", latest))
+}
+
+//nolint:gocritic // hugeParam: consistency with tea.Model interface methods
+func (m Model) renderGraphs() string {
+	var b strings.Builder
+	b.WriteString(statLabelStyle.Render("Mesh health"))
+	b.WriteString("\n")
+
+	var self uint32
+	if m.device != nil {
+		self = m.device.NodeNum
+	}
+	if g := m.graphs[self]; self != 0 && g != nil && len(g.util) > 0 {
+		b.WriteString(messageFromStyle.Render(fmt.Sprintf("%-10s", "This node")) + " ")
+		b.WriteString(graphLine("channel", g.util, "%.1f%%"))
+		b.WriteString("\n")
+	}
+
+	// Most recently heard first
+	nodes := make([]uint32, 0, len(m.graphs))
+	for num, g := range m.graphs {
+		if num != self && (len(g.snr) > 0 || len(g.util) > 0) {
+			nodes = append(nodes, num)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return m.graphs[nodes[i]].heard.After(m.graphs[nodes[j]].heard)
+	})
+	if len(nodes) == 0 {
+		b.WriteString(statLabelStyle.Render("No signal readings yet"))
+	}
+	if len(nodes) > maxGraphRows {
+		nodes = nodes[:maxGraphRows]
+	}
+
+	for _, num := range nodes {
+		g := m.graphs[num]
+		b.WriteString(messageFromStyle.Render(fmt.Sprintf("%-10s", g.name)) + " ")
+		b.WriteString(graphLine("SNR", g.snr, "%.1f dB") + "  ")
+		b.WriteString(graphLine("RSSI", g.rssi, "%.0f dBm"))
+		if len(g.util) > 0 {
+			b.WriteString("  " + graphLine("channel", g.util, "%.1f%%"))
+		}
+		b.WriteString("\n")
+	}
+
+	return boxStyle.Width(m.width - 4).Render(strings.TrimRight(b.String(), "\n"))
+}
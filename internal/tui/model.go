@@ -2,12 +2,17 @@
 package tui
 
 import (
+	"context"
 	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 
+	"github.com/iamruinous/meshtastic-message-relay/internal/alerts"
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+	"github.com/iamruinous/meshtastic-message-relay/internal/geo"
 	"github.com/iamruinous/meshtastic-message-relay/internal/message"
 	"github.com/iamruinous/meshtastic-message-relay/internal/relay"
 )
@@ -15,10 +20,13 @@ import (
 // MaxMessages is the maximum number of messages to display
 const MaxMessages = 100
 
+// refreshTimeout bounds fetching the relay's state
+const refreshTimeout = 5 * time.Second
+
 // Model represents the TUI state
 type Model struct {
-	// Service reference
-	service *relay.Service
+	// The relay shown
+	backend Backend
 
 	// UI state
 	width    int
@@ -34,11 +42,46 @@ type Model struct {
 	messages     []MessageDisplay
 	connected    bool
 	connName     string
+	device       *connection.DeviceProfile
 	outputCount  int
+	home         *geo.Point
+	safe         bool
+	canAck       bool // the connection can wait for acks
 	stats        relay.Stats
 	startTime    time.Time
 	lastUpdate   time.Time
 	errorMessage string
+	notice       string
+
+	// Message selection and detail view
+	selected   int // index into messages; -1 follows the newest
+	detailOpen bool
+	detail     viewport.Model
+
+	// Quick-reply picker
+	pickerOpen   bool
+	pickerIndex  int
+	quickReplies []string
+
+	// Send box
+	composeOpen bool
+	compose     textinput.Model
+	composeTo   uint32 // 0 broadcasts
+	sendSeq     uint64
+
+	// Signal and channel utilization graphs, by node
+	graphsOpen bool
+	graphs     map[uint32]*nodeGraph
+
+	// Outputs panel
+	outputsOpen bool
+	outputs     []relay.OutputStatus
+
+	// Alerts pane
+	alertsOpen bool
+	alertIndex int
+	alerts     []alerts.Alert
+	alertSeq   uint64 // last alert notification shown
 }
 
 // MessageDisplay holds a message for display
@@ -49,17 +92,26 @@ type MessageDisplay struct {
 	Content string
 	SNR     float32
 	RSSI    int32
+	Packet  *message.Packet // for looking up notes
+
+	// Messages sent from the send box
+	Outgoing bool
+	SendID   uint64
+	Status   string // sending, acked, or why it failed
+	Failed   bool
 }
 
 // New creates a new TUI model
-func New(service *relay.Service) Model {
+func New(backend Backend) Model {
 	s := spinner.New()
 	s.Spinner = spinner.Dot
 	s.Style = spinnerStyle
 
 	return Model{
-		service:   service,
+		backend:   backend,
 		spinner:   s,
+		compose:   newCompose(),
+		selected:  -1,
 		messages:  make([]MessageDisplay, 0),
 		startTime: time.Now(),
 	}
@@ -72,7 +124,8 @@ func (m Model) Init() tea.Cmd {
 	return tea.Batch(
 		m.spinner.Tick,
 		tickCmd(),
-		waitForMessage(m.service),
+		refreshCmd(m.backend),
+		waitForMessage(m.backend),
 	)
 }
 
@@ -85,6 +138,12 @@ type messageMsg *message.Packet
 // errMsg is sent when an error occurs
 type errMsg error
 
+// snapshotMsg carries the relay's state, refreshed every tick
+type snapshotMsg struct {
+	snap Snapshot
+	err  error
+}
+
 // tickCmd returns a command that sends a tick every second
 func tickCmd() tea.Cmd {
 	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
@@ -92,17 +151,26 @@ func tickCmd() tea.Cmd {
 	})
 }
 
-// waitForMessage waits for messages from the service
-func waitForMessage(svc *relay.Service) tea.Cmd {
+// refreshCmd fetches the relay's state
+func refreshCmd(backend Backend) tea.Cmd {
 	return func() tea.Msg {
-		if svc == nil {
+		if backend == nil {
 			return nil
 		}
-		conn := svc.GetConnection()
-		if conn == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+		snap, err := backend.Snapshot(ctx)
+		return snapshotMsg{snap: snap, err: err}
+	}
+}
+
+// waitForMessage waits for messages from the relay
+func waitForMessage(backend Backend) tea.Cmd {
+	return func() tea.Msg {
+		if backend == nil {
 			return nil
 		}
-		msg, ok := <-conn.Messages()
+		msg, ok := <-backend.Messages()
 		if !ok {
 			return nil
 		}
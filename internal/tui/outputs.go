@@ -0,0 +1,94 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/relay"
+)
+
+// failingOutputs counts the enabled outputs whose last send failed
+//
+//nolint:gocritic // hugeParam: consistency with tea.Model interface methods
+func (m Model) failingOutputs() int {
+	n := 0
+	for _, o := range m.outputs {
+		if o.Enabled && o.Failing() {
+			n++
+		}
+	}
+	return n
+}
+
+//nolint:gocritic // hugeParam: consistency with tea.Model interface methods
+func (m Model) renderOutputs() string {
+	var b strings.Builder
+	b.WriteString(statLabelStyle.Render(fmt.Sprintf("Outputs (%d)", len(m.outputs))))
+	b.WriteString("\n")
+
+	width := 0
+	for _, o := range m.outputs {
+		width = max(width, len(o.Output))
+	}
+	for _, o := range m.outputs {
+		name := fmt.Sprintf("%-*s", width, o.Output)
+		if !o.Enabled {
+			b.WriteString(statLabelStyle.Render("○ " + name + "  disabled"))
+			b.WriteString("\n")
+			continue
+		}
+
+		if o.Failing() {
+			b.WriteString(errorStyle.Render("✗ ") + messageContentStyle.Render(name))
+		} else {
+			b.WriteString(connectedStyle.Render("● ") + messageContentStyle.Render(name))
+		}
+		b.WriteString(statLabelStyle.Render("  delivered ") + statValueStyle.Render(fmt.Sprintf("%d", o.Delivered)))
+		failed := statValueStyle.Render("0")
+		if o.Failed > 0 {
+			failed = errorStyle.Render(fmt.Sprintf("%d", o.Failed))
+		}
+		b.WriteString(statLabelStyle.Render("  failed ") + failed)
+		b.WriteString(statLabelStyle.Render("  last ") + statValueStyle.Render(m.since(o.LastDelivery)))
+		if o.Queued > 0 {
+			b.WriteString(statLabelStyle.Render("  queued ") + statValueStyle.Render(fmt.Sprintf("%d", o.Queued)))
+		}
+		if o.LastError != "" {
+			b.WriteString("\n")
+			b.WriteString(m.renderOutputError(o))
+		}
+		b.WriteString("\n")
+	}
+
+	return boxStyle.Width(m.width - 4).Render(strings.TrimRight(b.String(), "\n"))
+}
+
+// renderOutputError shows an output's last error and when it happened,
+// muted once a later send has succeeded
+//
+//nolint:gocritic // hugeParam: consistency with tea.Model interface methods
+func (m Model) renderOutputError(o relay.OutputStatus) string {
+	line := fmt.Sprintf("    %s: %s", m.since(o.LastErrorAt), o.LastError)
+	if limit := m.width - 8; limit > 1 && len([]rune(line)) > limit {
+		line = string([]rune(line)[:limit-1]) + "…"
+	}
+	if o.Failing() {
+		return errorStyle.Render(line)
+	}
+	return statLabelStyle.Render(line)
+}
+
+// since formats how long ago t was
+//
+//nolint:gocritic // hugeParam: consistency with tea.Model interface methods
+func (m Model) since(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	now := m.lastUpdate
+	if now.Before(t) {
+		now = t
+	}
+	return now.Sub(t).Round(time.Second).String() + " ago"
+}
@@ -0,0 +1,98 @@
+package tui
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+)
+
+// quickReplyTimeout bounds loading and sending quick replies
+const quickReplyTimeout = 15 * time.Second
+
+// quickRepliesMsg carries the canned messages loaded from the device
+type quickRepliesMsg struct {
+	replies []string
+	err     error
+}
+
+// quickReplySentMsg reports the result of sending a quick reply
+type quickReplySentMsg struct {
+	text string
+	err  error
+}
+
+// loadQuickReplies fetches the device's canned messages
+func loadQuickReplies(backend Backend) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), quickReplyTimeout)
+		defer cancel()
+
+		replies, err := backend.QuickReplies(ctx)
+		return quickRepliesMsg{replies: replies, err: err}
+	}
+}
+
+// sendQuickReply broadcasts text on the primary channel
+func sendQuickReply(backend Backend, text string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), quickReplyTimeout)
+		defer cancel()
+
+		err := backend.Send(ctx, &message.Packet{
+			PortNum: message.PortNumTextMessage,
+			Payload: &message.TextMessage{Text: text},
+		})
+		return quickReplySentMsg{text: text, err: err}
+	}
+}
+
+// updatePicker handles keys while the quick-reply picker is open
+func (m *Model) updatePicker(key tea.KeyMsg) tea.Cmd {
+	switch key.String() {
+	case "esc", "r":
+		m.pickerOpen = false
+	case "up", "k":
+		if m.pickerIndex > 0 {
+			m.pickerIndex--
+		}
+	case "down", "j":
+		if m.pickerIndex < len(m.quickReplies)-1 {
+			m.pickerIndex++
+		}
+	case "enter":
+		if len(m.quickReplies) == 0 {
+			return nil
+		}
+		m.pickerOpen = false
+		return sendQuickReply(m.backend, m.quickReplies[m.pickerIndex])
+	}
+	return nil
+}
+
+//nolint:gocritic // hugeParam: consistency with tea.Model interface methods
+func (m Model) renderPicker() string {
+	var b strings.Builder
+	b.WriteString(statLabelStyle.Render("Quick reply (broadcast on primary channel)"))
+	b.WriteString("\n")
+
+	if m.quickReplies == nil {
+		b.WriteString(m.spinner.View() + " Loading canned messages...")
+	} else if len(m.quickReplies) == 0 {
+		b.WriteString(statLabelStyle.Render("No canned messages configured on the device"))
+	}
+
+	for i, reply := range m.quickReplies {
+		if i == m.pickerIndex {
+			b.WriteString(messageFromStyle.Render("> " + reply))
+		} else {
+			b.WriteString(messageContentStyle.Render("  " + reply))
+		}
+		b.WriteString("\n")
+	}
+
+	return boxStyle.Width(m.width - 4).Render(strings.TrimRight(b.String(), "\n"))
+}
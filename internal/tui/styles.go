@@ -59,6 +59,10 @@ var (
 	messageContentStyle = lipgloss.NewStyle().
 				Foreground(lipgloss.Color("#FFFFFF"))
 
+	selectedStyle = lipgloss.NewStyle().
+			Foreground(primaryColor).
+			Bold(true)
+
 	// Help style
 	helpStyle = lipgloss.NewStyle().
 			Foreground(mutedColor).
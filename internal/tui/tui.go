@@ -4,13 +4,13 @@ import (
 	"fmt"
 
 	tea "github.com/charmbracelet/bubbletea"
-
-	"github.com/iamruinous/meshtastic-message-relay/internal/relay"
 )
 
-// Run starts the TUI with the given relay service
-func Run(service *relay.Service) error {
-	model := New(service)
+// Run starts the TUI showing the relay behind backend, closing backend
+// when the TUI exits
+func Run(backend Backend) error {
+	defer backend.Close()
+	model := New(backend)
 	program := tea.NewProgram(
 		model,
 		tea.WithAltScreen(),
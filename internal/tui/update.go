@@ -2,12 +2,14 @@ package tui
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 
+	"github.com/iamruinous/meshtastic-message-relay/internal/geo"
 	"github.com/iamruinous/meshtastic-message-relay/internal/message"
 )
 
@@ -19,6 +21,23 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.detailOpen {
+			cmds = append(cmds, m.updateDetail(msg))
+			return m, tea.Batch(cmds...)
+		}
+		if m.composeOpen {
+			cmds = append(cmds, m.updateCompose(msg))
+			return m, tea.Batch(cmds...)
+		}
+		if m.pickerOpen {
+			cmds = append(cmds, m.updatePicker(msg))
+			return m, tea.Batch(cmds...)
+		}
+		if m.alertsOpen {
+			cmds = append(cmds, m.updateAlerts(msg))
+			return m, tea.Batch(cmds...)
+		}
+
 		switch msg.String() {
 		case "q", "ctrl+c", "esc":
 			m.quitting = true
@@ -26,9 +45,64 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "c":
 			// Clear messages
 			m.messages = make([]MessageDisplay, 0)
+			m.selected = -1
 			m.viewport.SetContent(m.renderMessages())
+		case "up", "k":
+			m.selectPrev()
+		case "down", "j":
+			m.selectNext()
+		case "enter":
+			m.openDetail()
+		case "r":
+			// Open the quick-reply picker
+			if m.canSend() {
+				m.pickerOpen = true
+				m.pickerIndex = 0
+				m.quickReplies = nil
+				cmds = append(cmds, loadQuickReplies(m.backend))
+			}
+		case "s":
+			// Open the send box
+			if m.canSend() {
+				cmds = append(cmds, m.openCompose())
+			}
+		case "g":
+			// Toggle the graphs panel
+			m.graphsOpen = !m.graphsOpen
+		case "o":
+			// Toggle the outputs panel
+			m.outputsOpen = !m.outputsOpen
+		case "a":
+			// Open the alerts pane
+			if m.backend != nil && m.backend.Alerts() != nil {
+				m.alertsOpen = true
+				m.alertIndex = 0
+				m.refreshAlerts(time.Now())
+			}
 		}
 
+	case quickRepliesMsg:
+		if msg.err != nil {
+			m.pickerOpen = false
+			m.errorMessage = "quick replies: " + msg.err.Error()
+		} else {
+			m.quickReplies = msg.replies
+			if m.quickReplies == nil {
+				m.quickReplies = []string{}
+			}
+		}
+
+	case quickReplySentMsg:
+		if msg.err != nil {
+			m.errorMessage = "send failed: " + msg.err.Error()
+		} else {
+			m.errorMessage = ""
+			m.notice = fmt.Sprintf("Sent %q", msg.text)
+		}
+
+	case sentMsg:
+		m.delivered(msg)
+
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
@@ -40,35 +114,45 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if !m.ready {
 			m.viewport = viewport.New(msg.Width-4, msg.Height-verticalMargins)
 			m.viewport.YPosition = headerHeight
+			// The arrow keys move the selection instead
+			m.viewport.KeyMap.Up.SetEnabled(false)
+			m.viewport.KeyMap.Down.SetEnabled(false)
 			m.ready = true
 		} else {
 			m.viewport.Width = msg.Width - 4
 			m.viewport.Height = msg.Height - verticalMargins
 		}
+		m.detail.Width = m.viewport.Width
+		m.detail.Height = m.viewport.Height - 1
 		m.viewport.SetContent(m.renderMessages())
 
 	case tickMsg:
 		m.lastUpdate = time.Time(msg)
-		// Update stats from service
-		if m.service != nil {
-			m.stats = m.service.GetStats()
-			conn := m.service.GetConnection()
-			if conn != nil {
-				m.connected = conn.IsConnected()
-				m.connName = conn.Name()
-			}
-			m.outputCount = len(m.service.GetOutputs())
+		m.refreshAlerts(m.lastUpdate)
+		cmds = append(cmds, tickCmd(), refreshCmd(m.backend))
+
+	case snapshotMsg:
+		if msg.err != nil {
+			// The attached relay is unreachable
+			m.connected = false
+			m.errorMessage = "relay: " + msg.err.Error()
+			break
 		}
-		cmds = append(cmds, tickCmd())
+		if strings.HasPrefix(m.errorMessage, "relay: ") {
+			m.errorMessage = ""
+		}
+		m.applySnapshot(msg.snap)
 
 	case messageMsg:
 		if msg != nil {
 			m.addMessage((*message.Packet)(msg))
 			m.viewport.SetContent(m.renderMessages())
-			m.viewport.GotoBottom()
+			if m.selected < 0 {
+				m.viewport.GotoBottom()
+			}
 		}
 		// Continue waiting for messages
-		cmds = append(cmds, waitForMessage(m.service))
+		cmds = append(cmds, waitForMessage(m.backend))
 
 	case errMsg:
 		m.errorMessage = msg.Error()
@@ -99,6 +183,8 @@ func (m *Model) addMessage(msg *message.Packet) {
 	switch p := msg.Payload.(type) {
 	case *message.TextMessage:
 		content = p.Text
+	case *message.Position:
+		content = m.formatPosition(p)
 	case string:
 		content = p
 	default:
@@ -112,12 +198,60 @@ func (m *Model) addMessage(msg *message.Packet) {
 		Content: content,
 		SNR:     msg.SNR,
 		RSSI:    msg.RSSI,
+		Packet:  msg,
 	}
 
 	m.messages = append(m.messages, display)
+	m.trimMessages()
+	m.recordGraphs(msg, fromNode)
+}
+
+// trimMessages drops the oldest messages past MaxMessages, keeping the
+// selection on its message
+func (m *Model) trimMessages() {
+	drop := len(m.messages) - MaxMessages
+	if drop <= 0 {
+		return
+	}
+	m.messages = m.messages[drop:]
+	if m.selected >= 0 {
+		m.selected = max(m.selected-drop, 0)
+	}
+}
+
+// formatPosition shows a position with its distance and direction from
+// the relay's home position when that is known
+func (m *Model) formatPosition(p *message.Position) string {
+	content := fmt.Sprintf("%.5f, %.5f", p.Latitude, p.Longitude)
+	if m.home == nil {
+		return content
+	}
+	at := geo.Point{Lat: p.Latitude, Lon: p.Longitude}
+	return fmt.Sprintf("%s (%.1f km %s of home)", content,
+		geo.Distance(*m.home, at)/1000, geo.Compass(geo.Bearing(*m.home, at)))
+}
 
-	// Trim to max messages
-	if len(m.messages) > MaxMessages {
-		m.messages = m.messages[len(m.messages)-MaxMessages:]
+// applySnapshot shows the relay's latest state
+func (m *Model) applySnapshot(snap Snapshot) {
+	m.stats = snap.Stats
+	m.connected = snap.Connected
+	m.connName = snap.ConnName
+	m.device = snap.Device
+	m.home = snap.Home
+	m.safe = snap.SafeMode
+	m.canAck = snap.CanWaitForAck
+	m.outputs = snap.Outputs
+	m.outputCount = 0
+	for _, o := range m.outputs {
+		if o.Enabled {
+			m.outputCount++
+		}
 	}
 }
+
+// canSend reports whether messages can be sent to the mesh
+//
+//nolint:gocritic // hugeParam: consistency with tea.Model interface methods
+func (m Model) canSend() bool {
+	return m.backend != nil && m.connName != "" && !m.safe
+}
@@ -37,11 +37,50 @@ func (m Model) View() string {
 	b.WriteString(stats)
 	b.WriteString("\n")
 
-	// Messages viewport
-	messagesBox := boxStyle.Width(m.width - 4).Render(m.viewport.View())
-	b.WriteString(messagesBox)
+	// Messages viewport, or the selected message's detail
+	if m.detailOpen {
+		b.WriteString(m.renderDetailBox())
+	} else {
+		b.WriteString(boxStyle.Width(m.width - 4).Render(m.viewport.View()))
+	}
 	b.WriteString("\n")
 
+	// Send box
+	if m.composeOpen {
+		b.WriteString(m.renderCompose())
+		b.WriteString("\n")
+	}
+
+	// Quick-reply picker
+	if m.pickerOpen {
+		b.WriteString(m.renderPicker())
+		b.WriteString("\n")
+	}
+
+	// Graphs panel
+	if m.graphsOpen {
+		b.WriteString(m.renderGraphs())
+		b.WriteString("\n")
+	}
+
+	// Outputs panel
+	if m.outputsOpen {
+		b.WriteString(m.renderOutputs())
+		b.WriteString("\n")
+	}
+
+	// Alerts pane
+	if m.alertsOpen {
+		b.WriteString(m.renderAlerts())
+		b.WriteString("\n")
+	}
+
+	// Last notice if any
+	if m.notice != "" && m.errorMessage == "" {
+		b.WriteString(messageTypeStyle.Render(m.notice))
+		b.WriteString("\n")
+	}
+
 	// Error message if any
 	if m.errorMessage != "" {
 		b.WriteString(errorStyle.Render("Error: " + m.errorMessage))
@@ -49,7 +88,19 @@ func (m Model) View() string {
 	}
 
 	// Help
-	help := helpStyle.Render("q: quit • c: clear messages • ↑/↓: scroll")
+	help := helpStyle.Render("q: quit • c: clear messages • s: send • r: quick reply • g: graphs • o: outputs • a: alerts • ↑/↓: select • enter: details")
+	switch {
+	case m.detailOpen:
+		help = helpStyle.Render("↑/↓: scroll • esc: close")
+	case m.safeMode():
+		help = helpStyle.Render("q: quit • c: clear messages • g: graphs • o: outputs • a: alerts • ↑/↓: select • enter: details")
+	case m.composeOpen:
+		help = helpStyle.Render("enter: send • tab: next recipient • esc: cancel")
+	case m.pickerOpen:
+		help = helpStyle.Render("↑/↓: select • enter: send • esc: cancel")
+	case m.alertsOpen:
+		help = helpStyle.Render("↑/↓: select • enter: acknowledge • s: snooze • esc: close")
+	}
 	b.WriteString(help)
 
 	return b.String()
@@ -66,14 +117,43 @@ func (m Model) renderStatusBar() string {
 		connInfo = statLabelStyle.Render(" | ") + statValueStyle.Render(m.connName)
 	}
 
+	// Device firmware and role
+	deviceInfo := ""
+	if m.device != nil {
+		deviceInfo = statLabelStyle.Render(" | Firmware: ") + statValueStyle.Render(m.device.Firmware) +
+			statLabelStyle.Render(" ") + statValueStyle.Render(m.device.Role)
+	}
+
 	// Outputs
 	outputInfo := statLabelStyle.Render(" | Outputs: ") + statValueStyle.Render(fmt.Sprintf("%d", m.outputCount))
+	if n := m.failingOutputs(); n > 0 {
+		outputInfo += errorStyle.Render(fmt.Sprintf(" (%d failing)", n))
+	}
 
 	// Uptime
 	uptime := time.Since(m.startTime).Round(time.Second)
 	uptimeInfo := statLabelStyle.Render(" | Uptime: ") + statValueStyle.Render(uptime.String())
 
-	return status + connInfo + outputInfo + uptimeInfo
+	// Alerts awaiting acknowledgment
+	alertInfo := ""
+	if n := m.unackedAlerts(); n > 0 {
+		alertInfo = statLabelStyle.Render(" | Alerts: ") + errorStyle.Render(fmt.Sprintf("%d", n))
+	}
+
+	// Safe mode, so nobody expects replies to go out
+	safeInfo := ""
+	if m.safeMode() {
+		safeInfo = statLabelStyle.Render(" | ") + errorStyle.Render("SAFE MODE")
+	}
+
+	return status + connInfo + deviceInfo + outputInfo + uptimeInfo + alertInfo + safeInfo
+}
+
+// safeMode reports whether the relay is kept from writing to the radio
+//
+//nolint:gocritic // hugeParam: consistency with tea.Model interface methods
+func (m Model) safeMode() bool {
+	return m.safe
 }
 
 //nolint:gocritic // hugeParam: consistency with tea.Model interface methods
@@ -88,7 +168,27 @@ func (m Model) renderStats() string {
 		errors += statValueStyle.Render("0")
 	}
 
-	return received + sent + filtered + errors
+	failovers := ""
+	if m.stats.Failovers > 0 {
+		failovers = statLabelStyle.Render(" | Failovers: ") + statValueStyle.Render(fmt.Sprintf("%d", m.stats.Failovers))
+	}
+
+	stalls := ""
+	if m.stats.StallRecoveries > 0 {
+		stalls = statLabelStyle.Render(" | Stall recoveries: ") + statValueStyle.Render(fmt.Sprintf("%d", m.stats.StallRecoveries))
+	}
+
+	drops := ""
+	if m.stats.QueueDrops > 0 {
+		drops = statLabelStyle.Render(" | Queue drops: ") + errorStyle.Render(fmt.Sprintf("%d", m.stats.QueueDrops))
+	}
+
+	deadLetters := ""
+	if m.stats.DeadLetters > 0 {
+		deadLetters = statLabelStyle.Render(" | Awaiting redelivery: ") + errorStyle.Render(fmt.Sprintf("%d", m.stats.DeadLetters))
+	}
+
+	return received + sent + filtered + errors + failovers + stalls + drops + deadLetters
 }
 
 //nolint:gocritic // hugeParam: consistency with tea.Model interface methods
@@ -98,8 +198,11 @@ func (m Model) renderMessages() string {
 	}
 
 	var b strings.Builder
-	for _, msg := range m.messages {
+	for i, msg := range m.messages {
 		line := m.renderMessage(msg)
+		if i == m.selected {
+			line = selectedStyle.Render("▶ ") + line
+		}
 		b.WriteString(line)
 		b.WriteString("\n")
 	}
@@ -123,5 +226,21 @@ func (m Model) renderMessage(msg MessageDisplay) string {
 
 	content := messageContentStyle.Render("  " + msg.Content)
 
+	// Progress of a message sent from the send box
+	if msg.Outgoing {
+		if msg.Failed {
+			content += " " + errorStyle.Render(msg.Status)
+		} else {
+			content += " " + statLabelStyle.Render(msg.Status)
+		}
+	}
+
+	// Operator notes added through the API
+	if m.backend != nil && msg.Packet != nil {
+		for _, n := range m.backend.Notes(msg.Packet) {
+			content += "\n" + statLabelStyle.Render("  note: "+n.String())
+		}
+	}
+
 	return header + "\n" + content
 }
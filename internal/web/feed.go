@@ -0,0 +1,88 @@
+package web
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	// backlog is how many recent messages a new feed starts with
+	backlog = 50
+
+	// feedBuffer is how many messages wait for a slow browser before
+	// newer ones are dropped
+	feedBuffer = 64
+
+	// pingInterval is how often an idle feed is pinged, so proxies keep it
+	// open and dead browsers are noticed
+	pingInterval = 30 * time.Second
+
+	// writeTimeout bounds writing one message to a browser
+	writeTimeout = 10 * time.Second
+)
+
+// upgrader accepts WebSocket handshakes from pages served by this server
+// only, as its default origin check does
+var upgrader = websocket.Upgrader{}
+
+// handleFeed streams messages over a WebSocket as they are received, one
+// JSON Message per text frame, starting with the most recent ones
+func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // the upgrader has answered with the error
+	}
+	defer func() { _ = conn.Close() }()
+
+	messages, stop := s.service.Subscribe(feedBuffer)
+	defer stop()
+
+	// The browser sends nothing, but reading handles its pongs and close
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(v interface{}) bool {
+		_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		return conn.WriteJSON(v) == nil
+	}
+	for _, p := range s.service.Recent(backlog) {
+		if !write(newMessage(p)) {
+			return
+		}
+	}
+
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "relay stopping"), time.Now().Add(time.Second))
+			return
+		case <-closed:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+		case p, ok := <-messages:
+			if !ok {
+				return
+			}
+			if !write(newMessage(p)) {
+				s.logger.Debug("Feed closed", zap.String("remote", r.RemoteAddr))
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Meshtastic Message Relay dashboard: node positions on a map, the live
+// message feed, and relay stats
+"use strict";
+
+const maxMessages = 200;
+const refreshInterval = 30000;
+const reconnectDelay = 5000;
+
+const map = L.map("map").setView([0, 0], 2);
+L.tileLayer("https://tile.openstreetmap.org/{z}/{x}/{y}.png", {
+  maxZoom: 19,
+  attribution: '&copy; <a href="https://www.openstreetmap.org/copyright">OpenStreetMap</a> contributors',
+}).addTo(map);
+
+const markers = new Map();
+let homeMarker = null;
+let fitted = false;
+
+function nodeLabel(node) {
+  return node.short_name || node.long_name || node.id;
+}
+
+function ago(time) {
+  const seconds = Math.round((Date.now() - new Date(time)) / 1000);
+  if (seconds < 60) return seconds + "s ago";
+  if (seconds < 3600) return Math.round(seconds / 60) + "m ago";
+  if (seconds < 86400) return Math.round(seconds / 3600) + "h ago";
+  return Math.round(seconds / 86400) + "d ago";
+}
+
+function escapeHTML(s) {
+  const div = document.createElement("div");
+  div.textContent = s;
+  return div.innerHTML;
+}
+
+function nodePopup(node) {
+  const rows = [
+    "<strong>" + escapeHTML(node.long_name || node.id) + "</strong> " + escapeHTML(node.id),
+    "Last heard " + ago(node.last_heard),
+  ];
+  if (node.snr || node.rssi) rows.push("SNR " + node.snr + " dB, RSSI " + node.rssi + " dBm");
+  if (node.battery !== undefined) rows.push("Battery " + (node.battery > 100 ? "powered" : node.battery + "%"));
+  if (node.altitude) rows.push("Altitude " + node.altitude + " m");
+  if (node.distance_m) rows.push((node.distance_m / 1000).toFixed(1) + " km from home");
+  return rows.join("<br>");
+}
+
+function placeNode(node) {
+  let marker = markers.get(node.id);
+  if (!marker) {
+    marker = L.circleMarker([node.lat, node.lon], { radius: 7, color: "#2c7a4b", fillOpacity: 0.8 }).addTo(map);
+    marker.bindTooltip(escapeHTML(nodeLabel(node)), { permanent: true, direction: "right", className: "label" });
+    markers.set(node.id, marker);
+  }
+  marker.setLatLng([node.lat, node.lon]);
+  marker.bindPopup(nodePopup(node));
+}
+
+async function getJSON(path) {
+  const resp = await fetch(path);
+  if (!resp.ok) throw new Error(path + ": " + resp.status);
+  return resp.json();
+}
+
+async function refreshNodes() {
+  const nodes = await getJSON("data/nodes");
+  nodes.forEach(placeNode);
+  if (!fitted && markers.size > 0) {
+    const points = nodes.map((n) => [n.lat, n.lon]);
+    if (homeMarker) points.push(homeMarker.getLatLng());
+    map.fitBounds(points, { padding: [40, 40], maxZoom: 13 });
+    fitted = true;
+  }
+}
+
+async function refreshStats() {
+  const stats = await getJSON("data/stats");
+  const connection = document.getElementById("connection");
+  connection.textContent = stats.connection
+    ? stats.connection + (stats.connected ? " connected" : " disconnected")
+    : "no connection";
+  connection.classList.toggle("down", !stats.connected);
+
+  const rows = [
+    ["Uptime", stats.uptime || "stopped"],
+    ["Received", stats.received],
+    ["Sent", stats.sent],
+    ["Filtered", stats.filtered],
+    ["Errors", stats.errors],
+    ["Nodes", stats.nodes + " (" + stats.mapped + " on the map)"],
+    ["Outputs", stats.outputs.join(", ") || "none"],
+  ];
+  const list = document.getElementById("stats");
+  list.replaceChildren();
+  for (const [name, value] of rows) {
+    const dt = document.createElement("dt");
+    dt.textContent = name;
+    const dd = document.createElement("dd");
+    dd.textContent = value;
+    list.append(dt, dd);
+  }
+
+  if (stats.home) {
+    if (!homeMarker) {
+      homeMarker = L.marker([stats.home.lat, stats.home.lon], { title: "Home" }).addTo(map).bindPopup("Relay home");
+    }
+    homeMarker.setLatLng([stats.home.lat, stats.home.lon]);
+  }
+}
+
+function refresh() {
+  refreshStats()
+    .then(refreshNodes)
+    .catch((err) => console.error(err));
+}
+
+function showMessage(msg) {
+  const item = document.createElement("li");
+  const meta = document.createElement("div");
+  meta.className = "meta";
+  meta.textContent = new Date(msg.time).toLocaleTimeString() + " " + msg.from_name + " → " + msg.to + " · " + msg.port;
+  const body = document.createElement("div");
+  body.textContent = msg.text || "";
+  item.append(meta, body);
+
+  const list = document.getElementById("messages");
+  list.prepend(item);
+  while (list.children.length > maxMessages) list.lastChild.remove();
+
+  if (msg.position) {
+    const marker = markers.get(msg.from);
+    if (marker) {
+      marker.setLatLng([msg.position.lat, msg.position.lon]);
+    } else {
+      refreshNodes().catch((err) => console.error(err));
+    }
+  }
+}
+
+function connectFeed() {
+  const state = document.getElementById("feed-state");
+  const url = new URL("feed", location.href);
+  url.protocol = location.protocol === "https:" ? "wss:" : "ws:";
+  const ws = new WebSocket(url);
+  ws.onopen = () => {
+    state.textContent = "live";
+    state.classList.remove("down");
+    document.getElementById("messages").replaceChildren();
+  };
+  ws.onmessage = (event) => showMessage(JSON.parse(event.data));
+  ws.onclose = () => {
+    state.textContent = "reconnecting...";
+    state.classList.add("down");
+    setTimeout(connectFeed, reconnectDelay);
+  };
+}
+
+refresh();
+setInterval(refresh, refreshInterval);
+connectFeed();
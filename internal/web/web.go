@@ -0,0 +1,265 @@
+// Package web serves the embedded web dashboard: a Leaflet map of node
+// positions from the node database, a live message feed over WebSocket,
+// and basic relay stats.
+package web
+
+import (
+	"context"
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/logging"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/relay"
+)
+
+//go:embed static
+var static embed.FS
+
+// Server is the web dashboard server
+type Server struct {
+	cfg     config.WebConfig
+	service *relay.Service
+	logger  *zap.Logger
+
+	srv      *http.Server
+	listener net.Listener
+}
+
+// New creates a dashboard server for service
+func New(cfg config.WebConfig, service *relay.Service) *Server {
+	s := &Server{
+		cfg:     cfg,
+		service: service,
+		logger:  logging.With(zap.String("component", "web")),
+	}
+	// Feeds end when the server shuts down rather than holding it up
+	base, cancel := context.WithCancel(context.Background())
+	s.srv = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return base },
+	}
+	s.srv.RegisterOnShutdown(cancel)
+	return s
+}
+
+// Handler returns the dashboard routes
+func (s *Server) Handler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err) // the embedded directory is always there
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /", http.FileServerFS(files))
+	mux.HandleFunc("GET /data/nodes", s.handleNodes)
+	mux.HandleFunc("GET /data/stats", s.handleStats)
+	mux.HandleFunc("GET /feed", s.handleFeed)
+	return s.authorize(mux)
+}
+
+// Start listens on the configured address and serves in the background
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.cfg.Listen, err)
+	}
+	s.listener = ln
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Web dashboard stopped", zap.Error(err))
+		}
+	}()
+
+	s.logger.Info("Web dashboard listening", zap.String("addr", ln.Addr().String()))
+	return nil
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return s.cfg.Listen
+	}
+	return s.listener.Addr().String()
+}
+
+// Close stops the server, waiting for active requests until ctx is done
+func (s *Server) Close(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+// authorize requires the password on every request when one is set. It
+// uses basic auth, which browsers prompt for and then also send with the
+// WebSocket handshake.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	if s.cfg.Password == "" {
+		return next
+	}
+	want := []byte(s.cfg.Password)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, got, _ := r.BasicAuth()
+		if subtle.ConstantTimeCompare([]byte(got), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="meshtastic-relay"`)
+			http.Error(w, "missing or invalid password", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Node is a node on the map
+type Node struct {
+	ID        string    `json:"id"` // e.g. !1234abcd
+	LongName  string    `json:"long_name,omitempty"`
+	ShortName string    `json:"short_name,omitempty"`
+	Lat       float64   `json:"lat"`
+	Lon       float64   `json:"lon"`
+	Altitude  int32     `json:"altitude,omitempty"`
+	LastHeard time.Time `json:"last_heard"`
+	SNR       float32   `json:"snr,omitempty"`
+	RSSI      int32     `json:"rssi,omitempty"`
+	Battery   *uint32   `json:"battery,omitempty"` // percent, from the latest telemetry
+	Distance  float64   `json:"distance_m,omitempty"`
+}
+
+// Stats are the relay state shown beside the map
+type Stats struct {
+	Running    bool     `json:"running"`
+	Uptime     string   `json:"uptime,omitempty"`
+	Connection string   `json:"connection,omitempty"`
+	Connected  bool     `json:"connected"`
+	Received   uint64   `json:"received"`
+	Sent       uint64   `json:"sent"`
+	Filtered   uint64   `json:"filtered"`
+	Errors     uint64   `json:"errors"`
+	Nodes      int      `json:"nodes"`
+	Mapped     int      `json:"mapped"` // nodes with a position
+	Home       *LatLon  `json:"home,omitempty"`
+	Outputs    []string `json:"outputs"`
+}
+
+// LatLon is a point on the map
+type LatLon struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// handleNodes returns the nodes with a known position
+func (s *Server) handleNodes(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, s.mappedNodes())
+}
+
+func (s *Server) mappedNodes() []Node {
+	nodes := []Node{}
+	db := s.service.Nodes()
+	if db == nil {
+		return nodes
+	}
+	for _, n := range db.List() {
+		if n.Position == nil || (n.Position.Latitude == 0 && n.Position.Longitude == 0) {
+			continue
+		}
+		node := Node{
+			ID:        fmt.Sprintf("!%08x", n.Num),
+			Lat:       n.Position.Latitude,
+			Lon:       n.Position.Longitude,
+			Altitude:  n.Position.Altitude,
+			LastHeard: n.LastHeard,
+			SNR:       n.SNR,
+			RSSI:      n.RSSI,
+			Distance:  n.Position.Distance,
+		}
+		if n.User != nil {
+			node.LongName = n.User.LongName
+			node.ShortName = n.User.ShortName
+		}
+		if t := n.Latest(); t != nil {
+			battery := t.BatteryLevel
+			node.Battery = &battery
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, _ *http.Request) {
+	st := s.service.GetStats()
+	stats := Stats{
+		Running:  s.service.IsRunning(),
+		Received: st.MessagesReceived,
+		Sent:     st.MessagesSent,
+		Filtered: st.MessagesFiltered,
+		Errors:   st.Errors,
+		Mapped:   len(s.mappedNodes()),
+		Outputs:  []string{},
+	}
+	if stats.Running {
+		stats.Uptime = time.Since(s.service.StartedAt()).Round(time.Second).String()
+	}
+	if conn := s.service.GetConnection(); conn != nil {
+		stats.Connection = conn.Name()
+		stats.Connected = conn.IsConnected()
+	}
+	for _, out := range s.service.GetOutputs() {
+		stats.Outputs = append(stats.Outputs, out.Name())
+	}
+	if db := s.service.Nodes(); db != nil {
+		stats.Nodes = db.Len()
+	}
+	if home, _, ok := s.service.Home().Get(); ok {
+		stats.Home = &LatLon{Lat: home.Lat, Lon: home.Lon}
+	}
+	writeJSON(w, stats)
+}
+
+// Message is a packet in the live feed
+type Message struct {
+	Time     time.Time `json:"time"`
+	From     string    `json:"from"`
+	FromName string    `json:"from_name"`
+	To       string    `json:"to"` // "broadcast" or a node ID
+	Channel  uint32    `json:"channel"`
+	Port     string    `json:"port"`
+	Text     string    `json:"text,omitempty"`
+	SNR      float32   `json:"snr,omitempty"`
+	RSSI     int32     `json:"rssi,omitempty"`
+	Position *LatLon   `json:"position,omitempty"` // for position packets, to move the node's marker
+}
+
+// newMessage returns the feed's view of a packet
+func newMessage(p *message.Packet) Message {
+	m := Message{
+		Time:     p.ReceivedAt,
+		From:     p.FromID(),
+		FromName: p.FromName(),
+		To:       fmt.Sprintf("!%08x", p.To),
+		Channel:  p.Channel,
+		Port:     p.PortNum.String(),
+		Text:     p.Text(),
+		SNR:      p.SNR,
+		RSSI:     p.RSSI,
+	}
+	if p.To == 0xFFFFFFFF {
+		m.To = "broadcast"
+	}
+	if pos, ok := p.Payload.(*message.Position); ok && (pos.Latitude != 0 || pos.Longitude != 0) {
+		m.Position = &LatLon{Lat: pos.Latitude, Lon: pos.Longitude}
+	}
+	return m
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
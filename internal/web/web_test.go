@@ -0,0 +1,164 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/iamruinous/meshtastic-message-relay/internal/config"
+	"github.com/iamruinous/meshtastic-message-relay/internal/connection"
+	"github.com/iamruinous/meshtastic-message-relay/internal/message"
+	"github.com/iamruinous/meshtastic-message-relay/internal/relay"
+)
+
+// newTestServer serves a dashboard for a relay receiving a position from
+// !1234abcd every 10ms
+func newTestServer(t *testing.T, password string) *httptest.Server {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Relay.SafeMode = true
+	cfg.NodeDB.Path = ""
+	cfg.Outputs = []config.OutputConfig{{
+		Type:    "file",
+		Enabled: true,
+		Options: map[string]interface{}{"path": filepath.Join(t.TempDir(), "out.log"), "format": "json"},
+	}}
+	service, err := relay.New(cfg)
+	if err != nil {
+		t.Fatalf("relay.New: %v", err)
+	}
+
+	done := make(chan struct{})
+	service.UseConnection(connection.NewPlayback("test", func(fn func(*message.Packet) error) error {
+		for id := uint32(1); ; id++ {
+			select {
+			case <-done:
+				return nil
+			case <-time.After(10 * time.Millisecond):
+			}
+			p := &message.Packet{
+				ID:      id,
+				From:    0x1234abcd,
+				To:      0xFFFFFFFF,
+				PortNum: message.PortNumPosition,
+				Payload: &message.Position{Latitude: 45.5, Longitude: -122.6},
+			}
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+	}))
+	if err := service.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	srv := httptest.NewServer(New(config.WebConfig{Password: password}, service).Handler())
+	t.Cleanup(func() {
+		srv.Close()
+		close(done)
+		_ = service.Stop()
+	})
+	return srv
+}
+
+func get(t *testing.T, url, password string, v interface{}) int {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if password != "" {
+		req.SetBasicAuth("admin", password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if v != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestDashboard(t *testing.T) {
+	srv := newTestServer(t, "hunter2")
+
+	if code := get(t, srv.URL+"/data/stats", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("without a password: %d, want 401", code)
+	}
+	if code := get(t, srv.URL+"/data/stats", "wrong", nil); code != http.StatusUnauthorized {
+		t.Errorf("with the wrong password: %d, want 401", code)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/", nil)
+	req.SetBasicAuth("", "hunter2")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /: %v", err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), "leaflet") {
+		t.Errorf("GET / = %d %q", resp.StatusCode, page)
+	}
+
+	var nodes []Node
+	deadline := time.Now().Add(5 * time.Second)
+	for len(nodes) == 0 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		get(t, srv.URL+"/data/nodes", "hunter2", &nodes)
+	}
+	if len(nodes) != 1 || nodes[0].ID != "!1234abcd" || nodes[0].Lat != 45.5 || nodes[0].Lon != -122.6 {
+		t.Fatalf("nodes = %+v", nodes)
+	}
+
+	var stats Stats
+	if code := get(t, srv.URL+"/data/stats", "hunter2", &stats); code != http.StatusOK {
+		t.Fatalf("GET /data/stats = %d", code)
+	}
+	if !stats.Running || stats.Received == 0 || stats.Mapped != 1 || len(stats.Outputs) != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestFeed(t *testing.T) {
+	srv := newTestServer(t, "hunter2")
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/feed"
+
+	if _, _, err := websocket.DefaultDialer.Dial(url, nil); err == nil {
+		t.Error("feed without a password succeeded")
+	}
+
+	header := http.Header{}
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.SetBasicAuth("", "hunter2")
+	header.Set("Authorization", req.Header.Get("Authorization"))
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg Message
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("ReadJSON: %v", err)
+	}
+	if msg.From != "!1234abcd" || msg.To != "broadcast" || msg.Position == nil || msg.Position.Lat != 45.5 {
+		t.Errorf("message = %+v", msg)
+	}
+
+	// A page from another site cannot open the feed
+	header.Set("Origin", "https://example.com")
+	if _, _, err := websocket.DefaultDialer.Dial(url, header); err == nil {
+		t.Error("feed from another origin succeeded")
+	}
+}
@@ -0,0 +1,232 @@
+// Package xmodem implements file transfers with a Meshtastic device using
+// the XModem packets carried in the stream API.
+package xmodem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+// Defaults for transfer behavior
+const (
+	DefaultTimeout = 5 * time.Second
+	DefaultRetries = 5
+)
+
+var (
+	// ErrRejected indicates the device refused to open the requested file
+	ErrRejected = errors.New("device rejected transfer")
+
+	// ErrCanceled indicates the device canceled the transfer
+	ErrCanceled = errors.New("transfer canceled by device")
+
+	// ErrTooManyRetries indicates a packet could not be delivered
+	ErrTooManyRetries = errors.New("too many retries")
+)
+
+// Transport is the connection capability needed for transfers.
+// It is satisfied by connection.XModemTransport.
+type Transport interface {
+	SendXModem(pkt *meshtastic.XModem) error
+	XModemPackets() <-chan *meshtastic.XModem
+}
+
+// Client performs XModem transfers over a Transport
+type Client struct {
+	transport Transport
+
+	// Timeout is how long to wait for each response
+	Timeout time.Duration
+	// Retries is how many times a packet is resent before giving up
+	Retries int
+	// Progress, if set, is called with the number of bytes transferred so far
+	Progress func(n int)
+}
+
+// New creates a new XModem client
+func New(t Transport) *Client {
+	return &Client{
+		transport: t,
+		Timeout:   DefaultTimeout,
+		Retries:   DefaultRetries,
+	}
+}
+
+// Download reads a file from the device
+func (c *Client) Download(ctx context.Context, name string) ([]byte, error) {
+	c.drain()
+
+	var (
+		data    []byte
+		expect  uint32 = 1
+		retries int
+		last    = &meshtastic.XModem{Control: meshtastic.XModemSTX, Buffer: []byte(name)}
+	)
+
+	if err := c.transport.SendXModem(last); err != nil {
+		return nil, fmt.Errorf("failed to request file: %w", err)
+	}
+
+	for {
+		pkt, err := c.receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if retries++; retries > c.Retries {
+				c.cancel()
+				return nil, ErrTooManyRetries
+			}
+			if err := c.transport.SendXModem(last); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		switch pkt.Control {
+		case meshtastic.XModemSOH, meshtastic.XModemSTX:
+			switch {
+			case pkt.Seq == expect-1:
+				// Our ACK was lost; acknowledge the duplicate again
+				last = &meshtastic.XModem{Control: meshtastic.XModemACK}
+			case pkt.Seq != expect || uint32(meshtastic.CRC16(pkt.Buffer)) != pkt.CRC16:
+				last = &meshtastic.XModem{Control: meshtastic.XModemNAK}
+			default:
+				data = append(data, pkt.Buffer...)
+				expect++
+				retries = 0
+				last = &meshtastic.XModem{Control: meshtastic.XModemACK}
+				if c.Progress != nil {
+					c.Progress(len(data))
+				}
+			}
+			if err := c.transport.SendXModem(last); err != nil {
+				return nil, err
+			}
+
+		case meshtastic.XModemEOT:
+			if err := c.transport.SendXModem(&meshtastic.XModem{Control: meshtastic.XModemACK}); err != nil {
+				return nil, err
+			}
+			return data, nil
+
+		case meshtastic.XModemNAK:
+			if expect == 1 {
+				return nil, fmt.Errorf("%w: %s", ErrRejected, name)
+			}
+
+		case meshtastic.XModemCAN:
+			return nil, ErrCanceled
+		}
+	}
+}
+
+// Upload writes a file to the device
+func (c *Client) Upload(ctx context.Context, name string, data []byte) error {
+	c.drain()
+
+	open := &meshtastic.XModem{Control: meshtastic.XModemSOH, Buffer: []byte(name)}
+	if err := c.exchange(ctx, open); err != nil {
+		if errors.Is(err, ErrRejected) {
+			return fmt.Errorf("%w: %s", ErrRejected, name)
+		}
+		return err
+	}
+
+	var seq uint32 = 1
+	for offset := 0; offset < len(data); offset += meshtastic.XModemBlockSize {
+		end := offset + meshtastic.XModemBlockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		block := data[offset:end]
+
+		pkt := &meshtastic.XModem{
+			Control: meshtastic.XModemSOH,
+			Seq:     seq,
+			CRC16:   uint32(meshtastic.CRC16(block)),
+			Buffer:  block,
+		}
+		if err := c.exchange(ctx, pkt); err != nil {
+			return fmt.Errorf("failed to send block %d: %w", seq, err)
+		}
+
+		seq++
+		if c.Progress != nil {
+			c.Progress(end)
+		}
+	}
+
+	return c.exchange(ctx, &meshtastic.XModem{Control: meshtastic.XModemEOT})
+}
+
+// exchange sends a packet and waits for it to be acknowledged, resending on
+// NAK or timeout.
+func (c *Client) exchange(ctx context.Context, pkt *meshtastic.XModem) error {
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if err := c.transport.SendXModem(pkt); err != nil {
+			return err
+		}
+
+		resp, err := c.receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		switch resp.Control {
+		case meshtastic.XModemACK:
+			return nil
+		case meshtastic.XModemCAN:
+			return ErrCanceled
+		case meshtastic.XModemNAK:
+			// The device refuses to open a file with a NAK to seq 0
+			if pkt.Seq == 0 && pkt.Control == meshtastic.XModemSOH {
+				return ErrRejected
+			}
+		}
+	}
+
+	c.cancel()
+	return ErrTooManyRetries
+}
+
+// receive waits for the next packet from the device
+func (c *Client) receive(ctx context.Context) (*meshtastic.XModem, error) {
+	timer := time.NewTimer(c.Timeout)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, fmt.Errorf("timeout waiting for device")
+	case pkt, ok := <-c.transport.XModemPackets():
+		if !ok {
+			return nil, fmt.Errorf("connection closed")
+		}
+		return pkt, nil
+	}
+}
+
+// drain discards packets left over from an earlier transfer
+func (c *Client) drain() {
+	for {
+		select {
+		case <-c.transport.XModemPackets():
+		default:
+			return
+		}
+	}
+}
+
+// cancel tells the device to abort the transfer
+func (c *Client) cancel() {
+	_ = c.transport.SendXModem(&meshtastic.XModem{Control: meshtastic.XModemCAN})
+}
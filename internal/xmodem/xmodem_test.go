@@ -0,0 +1,162 @@
+package xmodem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+// fakeDevice mimics the firmware side of an XModem transfer
+type fakeDevice struct {
+	files   map[string][]byte
+	out     chan *meshtastic.XModem
+	corrupt int // number of outgoing blocks to corrupt
+
+	reading []byte
+	readSeq uint32
+	writing string
+	written []byte
+}
+
+func newFakeDevice() *fakeDevice {
+	return &fakeDevice{
+		files: make(map[string][]byte),
+		out:   make(chan *meshtastic.XModem, 16),
+	}
+}
+
+func (d *fakeDevice) XModemPackets() <-chan *meshtastic.XModem {
+	return d.out
+}
+
+func (d *fakeDevice) SendXModem(pkt *meshtastic.XModem) error {
+	switch pkt.Control {
+	case meshtastic.XModemSTX:
+		data, ok := d.files[string(pkt.Buffer)]
+		if !ok {
+			d.reply(meshtastic.XModemNAK)
+			return nil
+		}
+		d.reading, d.readSeq = data, 1
+		d.sendBlock()
+
+	case meshtastic.XModemACK:
+		d.readSeq++
+		d.sendBlock()
+
+	case meshtastic.XModemNAK:
+		d.sendBlock()
+
+	case meshtastic.XModemSOH:
+		if pkt.Seq == 0 {
+			d.writing, d.written = string(pkt.Buffer), nil
+			d.reply(meshtastic.XModemACK)
+			return nil
+		}
+		if uint32(meshtastic.CRC16(pkt.Buffer)) != pkt.CRC16 {
+			d.reply(meshtastic.XModemNAK)
+			return nil
+		}
+		d.written = append(d.written, pkt.Buffer...)
+		d.reply(meshtastic.XModemACK)
+
+	case meshtastic.XModemEOT:
+		d.files[d.writing] = d.written
+		d.reply(meshtastic.XModemACK)
+	}
+	return nil
+}
+
+func (d *fakeDevice) reply(control meshtastic.XModemControl) {
+	d.out <- &meshtastic.XModem{Control: control}
+}
+
+func (d *fakeDevice) sendBlock() {
+	offset := int(d.readSeq-1) * meshtastic.XModemBlockSize
+	if offset >= len(d.reading) {
+		d.reply(meshtastic.XModemEOT)
+		return
+	}
+	end := offset + meshtastic.XModemBlockSize
+	if end > len(d.reading) {
+		end = len(d.reading)
+	}
+	block := d.reading[offset:end]
+
+	crc := uint32(meshtastic.CRC16(block))
+	if d.corrupt > 0 {
+		d.corrupt--
+		crc ^= 0xFFFF
+	}
+
+	d.out <- &meshtastic.XModem{
+		Control: meshtastic.XModemSOH,
+		Seq:     d.readSeq,
+		CRC16:   crc,
+		Buffer:  block,
+	}
+}
+
+func TestCRC16(t *testing.T) {
+	// Standard CRC-16/XMODEM check value
+	if got := meshtastic.CRC16([]byte("123456789")); got != 0x31C3 {
+		t.Errorf("Expected CRC 0x31C3, got 0x%04X", got)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	device := newFakeDevice()
+	device.files["/log.txt"] = bytes.Repeat([]byte("mesh log line\n"), 50)
+	device.corrupt = 1
+
+	client := New(device)
+	client.Timeout = time.Second
+
+	data, err := client.Download(context.Background(), "/log.txt")
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if !bytes.Equal(data, device.files["/log.txt"]) {
+		t.Errorf("Downloaded %d bytes, expected %d", len(data), len(device.files["/log.txt"]))
+	}
+}
+
+func TestDownloadMissingFile(t *testing.T) {
+	client := New(newFakeDevice())
+	client.Timeout = time.Second
+
+	_, err := client.Download(context.Background(), "/missing")
+	if !errors.Is(err, ErrRejected) {
+		t.Errorf("Expected ErrRejected, got %v", err)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	device := newFakeDevice()
+	client := New(device)
+	client.Timeout = time.Second
+
+	data := bytes.Repeat([]byte{0x01, 0x02, 0x03}, 100)
+	if err := client.Upload(context.Background(), "/canned.txt", data); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	if !bytes.Equal(device.files["/canned.txt"], data) {
+		t.Errorf("Device stored %d bytes, expected %d", len(device.files["/canned.txt"]), len(data))
+	}
+}
+
+func TestXModemRoundTrip(t *testing.T) {
+	pkt := &meshtastic.XModem{Control: meshtastic.XModemSOH, Seq: 300, CRC16: 0xBEEF, Buffer: []byte("data")}
+
+	parsed, err := meshtastic.ParseXModem(pkt.Marshal())
+	if err != nil {
+		t.Fatalf("ParseXModem failed: %v", err)
+	}
+	if parsed.Control != pkt.Control || parsed.Seq != pkt.Seq || parsed.CRC16 != pkt.CRC16 || !bytes.Equal(parsed.Buffer, pkt.Buffer) {
+		t.Errorf("Round trip mismatch: %+v != %+v", parsed, pkt)
+	}
+}
@@ -0,0 +1,183 @@
+package meshtastic
+
+// AdminMessage field numbers (subset of the admin.proto oneof)
+const (
+	adminGetConfigRequest          = 5
+	adminGetConfigResponse         = 6
+	adminGetCannedMessagesRequest  = 10
+	adminGetCannedMessagesResponse = 11
+	adminSetCannedMessages         = 36
+	adminSessionPasskey            = 101
+)
+
+// ConfigType selects a config section in get_config_request
+type ConfigType uint32
+
+// Config sections (subset of admin.proto ConfigType)
+const (
+	ConfigTypeSecurity ConfigType = 7
+)
+
+// Config field numbers (subset of the config.proto oneof)
+const configSecurity = 8
+
+// Config is a device config section returned by get_config_response. Only
+// the sections the relay uses are modeled.
+type Config struct {
+	Security *SecurityConfig
+}
+
+// SecurityConfig holds the device's PKI keys
+type SecurityConfig struct {
+	PublicKey  []byte
+	PrivateKey []byte
+}
+
+// CannedMessageSeparator separates individual messages in the canned
+// message module's message list
+const CannedMessageSeparator = "|"
+
+// AdminMessage is the payload of ADMIN_APP packets. Only the variants the
+// relay uses are modeled.
+type AdminMessage struct {
+	// GetConfigRequest asks the device for a config section
+	GetConfigRequest *ConfigType
+	// GetConfigResponse holds the requested config section
+	GetConfigResponse *Config
+	// GetCannedMessagesRequest asks the device for its canned messages
+	GetCannedMessagesRequest bool
+	// GetCannedMessagesResponse holds the device's canned messages
+	GetCannedMessagesResponse *string
+	// SetCannedMessages replaces the device's canned messages
+	SetCannedMessages *string
+	// SessionPasskey must be echoed back on admin writes
+	SessionPasskey []byte
+}
+
+// Marshal encodes the AdminMessage as protobuf bytes
+func (a *AdminMessage) Marshal() []byte {
+	var buf []byte
+	if a.GetConfigRequest != nil {
+		// Enum zero is a valid section, so write it even when zero
+		buf = appendTag(buf, adminGetConfigRequest, wireVarint)
+		buf = appendVarint(buf, uint64(*a.GetConfigRequest))
+	}
+	buf = appendBoolField(buf, adminGetCannedMessagesRequest, a.GetCannedMessagesRequest)
+	if a.GetCannedMessagesResponse != nil {
+		buf = appendPresentString(buf, adminGetCannedMessagesResponse, *a.GetCannedMessagesResponse)
+	}
+	if a.SetCannedMessages != nil {
+		buf = appendPresentString(buf, adminSetCannedMessages, *a.SetCannedMessages)
+	}
+	buf = appendBytesField(buf, adminSessionPasskey, a.SessionPasskey)
+	return buf
+}
+
+// appendPresentString writes a string field even when it is empty, as
+// oneof members carry meaning through their presence
+func appendPresentString(buf []byte, fieldNum int, s string) []byte {
+	buf = appendTag(buf, fieldNum, wireBytes)
+	buf = appendVarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// ParseAdminMessage parses an AdminMessage from protobuf bytes
+func ParseAdminMessage(data []byte) (*AdminMessage, error) {
+	a := &AdminMessage{}
+	pos := 0
+
+	for pos < len(data) {
+		// Admin field numbers exceed 15, so tags may span several bytes
+		tag, n := decodeVarint(data[pos:])
+		if n == 0 {
+			return nil, ErrInvalidProtobuf
+		}
+		pos += n
+		fieldNum := tag >> 3
+		wireType := tag & 0x07
+
+		switch wireType {
+		case 0: // Varint
+			val, n := decodeVarint(data[pos:])
+			if n == 0 {
+				return nil, ErrInvalidProtobuf
+			}
+			pos += n
+			if fieldNum == adminGetCannedMessagesRequest {
+				a.GetCannedMessagesRequest = val != 0
+			}
+
+		case 2: // Length-delimited
+			length, n := decodeVarint(data[pos:])
+			if n == 0 {
+				return nil, ErrInvalidProtobuf
+			}
+			pos += n
+			if length > uint64(len(data)-pos) {
+				return nil, ErrInvalidProtobuf
+			}
+			fieldData := data[pos : pos+int(length)]
+			pos += int(length)
+
+			switch fieldNum {
+			case adminGetConfigResponse:
+				cfg, err := parseConfig(fieldData)
+				if err != nil {
+					return nil, err
+				}
+				a.GetConfigResponse = cfg
+			case adminGetCannedMessagesResponse:
+				s := string(fieldData)
+				a.GetCannedMessagesResponse = &s
+			case adminSetCannedMessages:
+				s := string(fieldData)
+				a.SetCannedMessages = &s
+			case adminSessionPasskey:
+				a.SessionPasskey = fieldData
+			}
+
+		case 5: // 32-bit
+			pos += 4
+
+		case 1: // 64-bit
+			pos += 8
+
+		default:
+			return nil, ErrUnsupportedType
+		}
+	}
+
+	if pos > len(data) {
+		return nil, ErrInvalidProtobuf
+	}
+
+	return a, nil
+}
+
+// parseConfig parses the modeled sections of a Config message
+func parseConfig(data []byte) (*Config, error) {
+	cfg := &Config{}
+	err := walkFields(data, func(fieldNum, _ uint64, fieldData []byte) error {
+		if fieldNum != configSecurity {
+			return nil
+		}
+		sec := &SecurityConfig{}
+		if err := walkFields(fieldData, func(num, _ uint64, b []byte) error {
+			switch num {
+			case 1:
+				sec.PublicKey = b
+			case 2:
+				sec.PrivateKey = b
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		cfg.Security = sec
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
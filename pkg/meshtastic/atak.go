@@ -0,0 +1,167 @@
+package meshtastic
+
+// TAKPacket is the payload of ATAK_PLUGIN packets, sent by the Meshtastic
+// ATAK plugin. When Compressed is set the strings are compressed with
+// unishox2, which is not decoded; they are left empty and only the
+// position and battery are available.
+type TAKPacket struct {
+	Compressed     bool
+	Callsign       string
+	DeviceCallsign string
+	Team           uint32
+	Role           uint32
+	Battery        uint32
+	PLI            *TAKPosition
+	Chat           *TAKChat
+}
+
+// TAKPosition is a TAK position report (PLI)
+type TAKPosition struct {
+	LatitudeI  int32
+	LongitudeI int32
+	Altitude   int32
+	Speed      uint32
+	Course     uint32
+}
+
+// Latitude returns the latitude in degrees
+func (p *TAKPosition) Latitude() float64 {
+	return float64(p.LatitudeI) / 1e7
+}
+
+// Longitude returns the longitude in degrees
+func (p *TAKPosition) Longitude() float64 {
+	return float64(p.LongitudeI) / 1e7
+}
+
+// TAKChat is a TAK GeoChat message
+type TAKChat struct {
+	Message    string
+	To         string
+	ToCallsign string
+}
+
+// takTeams are the team colors by enum value
+var takTeams = []string{
+	"", "White", "Yellow", "Orange", "Magenta", "Red", "Maroon", "Purple",
+	"Dark Blue", "Blue", "Cyan", "Teal", "Green", "Dark Green", "Brown",
+}
+
+// takRoles are the member roles by enum value
+var takRoles = []string{
+	"", "Team Member", "Team Lead", "HQ", "Sniper", "Medic", "Forward Observer", "RTO", "K9",
+}
+
+// TAKTeamName returns the team color for a team enum value, or "" if
+// unset or unknown
+func TAKTeamName(team uint32) string {
+	if int(team) < len(takTeams) {
+		return takTeams[team]
+	}
+	return ""
+}
+
+// TAKRoleName returns the member role for a role enum value, or "" if
+// unset or unknown
+func TAKRoleName(role uint32) string {
+	if int(role) < len(takRoles) {
+		return takRoles[role]
+	}
+	return ""
+}
+
+// ParseTAKPacket parses a TAKPacket from protobuf bytes
+func ParseTAKPacket(data []byte) (*TAKPacket, error) {
+	tp := &TAKPacket{}
+	err := walkFields(data, func(fieldNum, val uint64, fieldData []byte) error {
+		switch fieldNum {
+		case 1:
+			tp.Compressed = val != 0
+		case 2: // contact
+			return walkFields(fieldData, func(n, _ uint64, d []byte) error {
+				switch n {
+				case 1:
+					tp.Callsign = string(d)
+				case 2:
+					tp.DeviceCallsign = string(d)
+				}
+				return nil
+			})
+		case 3: // group
+			return walkFields(fieldData, func(n, v uint64, _ []byte) error {
+				switch n {
+				case 1:
+					tp.Role = uint32(v)
+				case 2:
+					tp.Team = uint32(v)
+				}
+				return nil
+			})
+		case 4: // status
+			return walkFields(fieldData, func(n, v uint64, _ []byte) error {
+				if n == 1 {
+					tp.Battery = uint32(v)
+				}
+				return nil
+			})
+		case 5:
+			pli, err := parseTAKPosition(fieldData)
+			if err != nil {
+				return err
+			}
+			tp.PLI = pli
+		case 6:
+			chat := &TAKChat{}
+			err := walkFields(fieldData, func(n, _ uint64, d []byte) error {
+				switch n {
+				case 1:
+					chat.Message = string(d)
+				case 2:
+					chat.To = string(d)
+				case 3:
+					chat.ToCallsign = string(d)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			tp.Chat = chat
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tp.Compressed {
+		// Compressed strings would only be garbage
+		tp.Callsign, tp.DeviceCallsign = "", ""
+		if tp.Chat != nil {
+			tp.Chat = &TAKChat{}
+		}
+	}
+	return tp, nil
+}
+
+func parseTAKPosition(data []byte) (*TAKPosition, error) {
+	p := &TAKPosition{}
+	err := walkFields(data, func(fieldNum, val uint64, _ []byte) error {
+		switch fieldNum {
+		case 1:
+			p.LatitudeI = int32(uint32(val))
+		case 2:
+			p.LongitudeI = int32(uint32(val))
+		case 3:
+			p.Altitude = int32(val)
+		case 4:
+			p.Speed = uint32(val)
+		case 5:
+			p.Course = uint32(val)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,40 @@
+package meshtastic
+
+import "testing"
+
+func TestParseTAKPacket(t *testing.T) {
+	contact := appendStringField(appendStringField(nil, 1, "RIDGE-1"), 2, "ANDROID-abc123")
+	group := appendUint32Field(appendUint32Field(nil, 1, 1), 2, 10)
+	lat := int32(-337654321)
+	var pli []byte
+	pli = appendFixed32Field(pli, 1, uint32(lat))
+	pli = appendFixed32Field(pli, 2, uint32(1512345678))
+	pli = appendUint32Field(pli, 3, 42)
+	pli = appendUint32Field(pli, 5, 270)
+
+	var data []byte
+	data = appendBytesField(data, 2, contact)
+	data = appendBytesField(data, 3, group)
+	data = appendBytesField(data, 4, appendUint32Field(nil, 1, 77))
+	data = appendBytesField(data, 5, pli)
+
+	tp, err := ParseTAKPacket(data)
+	if err != nil {
+		t.Fatalf("ParseTAKPacket: %v", err)
+	}
+	if tp.Callsign != "RIDGE-1" || tp.DeviceCallsign != "ANDROID-abc123" || tp.Battery != 77 {
+		t.Errorf("packet = %+v", tp)
+	}
+	if TAKTeamName(tp.Team) != "Cyan" || TAKRoleName(tp.Role) != "Team Member" {
+		t.Errorf("team %d role %d", tp.Team, tp.Role)
+	}
+	if tp.PLI == nil || tp.PLI.Latitude() != -33.7654321 || tp.PLI.Altitude != 42 || tp.PLI.Course != 270 {
+		t.Errorf("pli = %+v", tp.PLI)
+	}
+
+	// Compressed strings are dropped
+	tp, err = ParseTAKPacket(append(appendUint32Field(nil, 1, 1), data...))
+	if err != nil || tp.Callsign != "" || tp.PLI == nil {
+		t.Errorf("compressed packet = %+v, %v", tp, err)
+	}
+}
@@ -0,0 +1,104 @@
+package meshtastic
+
+import (
+	"bytes"
+	"testing"
+)
+
+// benchPackets returns FromRadio messages representative of mesh traffic
+func benchPackets() []struct {
+	name string
+	data []byte
+} {
+	packet := func(port PortNum, payload []byte) []byte {
+		mp := &MeshPacket{
+			From:     0x12345678,
+			To:       BroadcastAddr,
+			ID:       0xdeadbeef,
+			RxTime:   1700000000,
+			HopLimit: 3,
+			RxSnr:    6.25,
+			RxRssi:   -97,
+			Decoded:  &Data{PortNum: port, Payload: payload},
+		}
+		return appendBytesField(appendUint32Field(nil, 1, 42), 2, mp.Marshal())
+	}
+
+	var position []byte
+	position = appendFixed32Field(position, 1, uint32(451234560))
+	position = appendFixed32Field(position, 2, uint32(0xb6b1d8c4))
+	position = appendFixed32Field(position, 3, 120)
+	position = appendUint32Field(position, 4, 1700000000)
+
+	var metrics []byte
+	metrics = appendUint32Field(metrics, 1, 87)
+	metrics = appendFloat32Field(metrics, 2, 4.01)
+	metrics = appendFloat32Field(metrics, 3, 12.5)
+	metrics = appendFloat32Field(metrics, 4, 1.75)
+	metrics = appendUint32Field(metrics, 5, 86400)
+	telemetry := appendBytesField(appendFixed32Field(nil, 1, 1700000000), 2, metrics)
+
+	return []struct {
+		name string
+		data []byte
+	}{
+		{"text", packet(PortNumTextMessageApp, []byte("Checking in from the ridge, all good here"))},
+		{"position", packet(PortNumPositionApp, position)},
+		{"telemetry", packet(PortNumTelemetryApp, telemetry)},
+	}
+}
+
+func BenchmarkReadPacket(b *testing.B) {
+	var stream bytes.Buffer
+	framer := NewStreamFramer(nil, &stream)
+	for _, p := range benchPackets() {
+		_ = framer.WritePacket(p.data)
+	}
+	data := stream.Bytes()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		framer := NewStreamFramer(bytes.NewReader(data), nil)
+		for {
+			if _, err := framer.ReadPacket(); err != nil {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkParseFromRadio(b *testing.B) {
+	for _, p := range benchPackets() {
+		b.Run(p.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				fr, err := ParseFromRadio(p.data)
+				if err != nil {
+					b.Fatal(err)
+				}
+				fr.ToPacket()
+			}
+		})
+	}
+}
+
+// TestParseAllocs keeps the parse path within its allocation budget so
+// regressions show up in CI rather than on busy meshes
+func TestParseAllocs(t *testing.T) {
+	budgets := map[string]float64{
+		"text":      6,
+		"position":  6,
+		"telemetry": 7,
+	}
+	for _, p := range benchPackets() {
+		allocs := testing.AllocsPerRun(100, func() {
+			fr, _ := ParseFromRadio(p.data)
+			fr.ToPacket()
+			_ = fr.Packet.Decoded.PortNum.String()
+		})
+		if allocs > budgets[p.name] {
+			t.Errorf("%s: %.0f allocs per parse, budget %.0f", p.name, allocs, budgets[p.name])
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package meshtastic
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Protobuf wire types
+const (
+	wireVarint = 0
+	wireBytes  = 2
+	wire32bit  = 5
+)
+
+// Addressing defaults for outgoing packets
+const (
+	// BroadcastAddr is the destination for packets sent to all nodes
+	BroadcastAddr uint32 = 0xFFFFFFFF
+	// DefaultHopLimit matches the firmware's default hop limit
+	DefaultHopLimit = 3
+)
+
+// ToRadio field numbers
+const (
+	toRadioPacket       = 1
+	toRadioWantConfigID = 3
+	toRadioDisconnect   = 4
+	toRadioXmodemPacket = 5
+)
+
+func appendVarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+func appendTag(buf []byte, fieldNum, wireType int) []byte {
+	return appendVarint(buf, uint64(fieldNum<<3|wireType))
+}
+
+func appendUint32Field(buf []byte, fieldNum int, v uint32) []byte {
+	if v == 0 {
+		return buf
+	}
+	buf = appendTag(buf, fieldNum, wireVarint)
+	return appendVarint(buf, uint64(v))
+}
+
+func appendBoolField(buf []byte, fieldNum int, v bool) []byte {
+	if !v {
+		return buf
+	}
+	buf = appendTag(buf, fieldNum, wireVarint)
+	return append(buf, 1)
+}
+
+func appendBytesField(buf []byte, fieldNum int, data []byte) []byte {
+	if len(data) == 0 {
+		return buf
+	}
+	buf = appendTag(buf, fieldNum, wireBytes)
+	buf = appendVarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+func appendStringField(buf []byte, fieldNum int, s string) []byte {
+	return appendBytesField(buf, fieldNum, []byte(s))
+}
+
+func appendFixed32Field(buf []byte, fieldNum int, v uint32) []byte {
+	if v == 0 {
+		return buf
+	}
+	buf = appendTag(buf, fieldNum, wire32bit)
+	return binary.LittleEndian.AppendUint32(buf, v)
+}
+
+func appendFloat32Field(buf []byte, fieldNum int, v float32) []byte {
+	if v == 0 {
+		return buf
+	}
+	return appendFixed32Field(buf, fieldNum, math.Float32bits(v))
+}
+
+// Marshal encodes the Data message using the same field layout as parseData
+func (d *Data) Marshal() []byte {
+	var buf []byte
+	buf = appendUint32Field(buf, 1, uint32(d.PortNum))
+	buf = appendBytesField(buf, 2, d.Payload)
+	buf = appendBoolField(buf, 3, d.WantResponse)
+	buf = appendUint32Field(buf, 4, d.Dest)
+	buf = appendUint32Field(buf, 5, d.Source)
+	buf = appendUint32Field(buf, 6, d.RequestID)
+	buf = appendUint32Field(buf, 7, d.ReplyID)
+	buf = appendUint32Field(buf, 8, d.Emoji)
+	return buf
+}
+
+// Marshal encodes the MeshPacket using the same field layout as parseMeshPacket
+func (mp *MeshPacket) Marshal() []byte {
+	var buf []byte
+	buf = appendUint32Field(buf, 1, mp.From)
+	buf = appendUint32Field(buf, 2, mp.To)
+	buf = appendUint32Field(buf, 3, mp.Channel)
+	if mp.Decoded != nil {
+		buf = appendBytesField(buf, 4, mp.Decoded.Marshal())
+	}
+	buf = appendBytesField(buf, 5, mp.Encrypted)
+	buf = appendUint32Field(buf, 6, mp.ID)
+	buf = appendUint32Field(buf, 7, mp.RxTime)
+	buf = appendUint32Field(buf, 10, mp.HopLimit)
+	buf = appendBoolField(buf, 11, mp.WantAck)
+	buf = appendUint32Field(buf, 12, mp.Priority)
+	if mp.RxSnr != 0 {
+		buf = appendTag(buf, 13, wireVarint)
+		buf = appendVarint(buf, uint64(int32(mp.RxSnr*4)))
+	}
+	buf = appendFixed32Field(buf, 14, uint32(mp.RxRssi))
+	buf = appendUint32Field(buf, 15, mp.HopStart)
+	buf = appendBytesField(buf, 16, mp.PublicKey)
+	buf = appendBoolField(buf, 17, mp.PkiEncrypted)
+	return buf
+}
+
+// Marshal encodes the ToRadio message for writing to the device
+func (tr *ToRadio) Marshal() []byte {
+	var buf []byte
+	if tr.Packet != nil {
+		buf = appendBytesField(buf, toRadioPacket, tr.Packet.Marshal())
+	}
+	buf = appendUint32Field(buf, toRadioWantConfigID, tr.WantConfigID)
+	buf = appendBoolField(buf, toRadioDisconnect, tr.Disconnect)
+	if tr.XmodemPacket != nil {
+		// An empty XModem message is still meaningful (NUL control)
+		buf = appendTag(buf, toRadioXmodemPacket, wireBytes)
+		buf = appendVarint(buf, uint64(len(tr.XmodemPacket)))
+		buf = append(buf, tr.XmodemPacket...)
+	}
+	return buf
+}
@@ -0,0 +1,72 @@
+package meshtastic
+
+// ServiceEnvelope field numbers
+const (
+	envelopePacket    = 1
+	envelopeChannelID = 2
+	envelopeGatewayID = 3
+)
+
+// ServiceEnvelope wraps a MeshPacket published to MQTT by a gateway node
+type ServiceEnvelope struct {
+	Packet *MeshPacket
+	// ChannelID is the channel name, e.g. "LongFast"
+	ChannelID string
+	// GatewayID is the publishing node's ID, e.g. "!abcd1234"
+	GatewayID string
+}
+
+// ParseServiceEnvelope decodes a ServiceEnvelope as published on
+// msh/<region>/2/e/<channel>/<gateway> topics. An envelope without a
+// packet is rejected, which keeps other protobufs from parsing as one.
+func ParseServiceEnvelope(data []byte) (*ServiceEnvelope, error) {
+	env := &ServiceEnvelope{}
+	err := walkFields(data, func(fieldNum, _ uint64, fieldData []byte) error {
+		switch fieldNum {
+		case envelopePacket:
+			if fieldData == nil {
+				return ErrInvalidProtobuf
+			}
+			mp, err := parseMeshPacket(fieldData)
+			if err != nil {
+				return err
+			}
+			env.Packet = mp
+		case envelopeChannelID:
+			env.ChannelID = string(fieldData)
+		case envelopeGatewayID:
+			env.GatewayID = string(fieldData)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if env.Packet == nil {
+		return nil, ErrInvalidProtobuf
+	}
+	return env, nil
+}
+
+// Marshal encodes the ServiceEnvelope
+func (e *ServiceEnvelope) Marshal() []byte {
+	var buf []byte
+	if e.Packet != nil {
+		buf = appendBytesField(buf, envelopePacket, e.Packet.Marshal())
+	}
+	buf = appendStringField(buf, envelopeChannelID, e.ChannelID)
+	buf = appendStringField(buf, envelopeGatewayID, e.GatewayID)
+	return buf
+}
+
+// ToPacket converts the envelope's packet to a Packet carrying the
+// gateway and channel name
+func (e *ServiceEnvelope) ToPacket() *Packet {
+	p := (&FromRadio{Packet: e.Packet}).ToPacket()
+	if p == nil {
+		return nil
+	}
+	p.GatewayID = e.GatewayID
+	p.ChannelName = e.ChannelID
+	return p
+}
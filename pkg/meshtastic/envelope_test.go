@@ -0,0 +1,50 @@
+package meshtastic
+
+import "testing"
+
+func TestParseServiceEnvelope(t *testing.T) {
+	mp := &MeshPacket{
+		From:    0xabcd1234,
+		To:      BroadcastAddr,
+		ID:      42,
+		Decoded: &Data{PortNum: PortNumTextMessageApp, Payload: []byte("hello")},
+	}
+	inner := mp.Marshal()
+
+	// packet, channel_id "LongFast", gateway_id "!abcd1234"
+	data := append([]byte{0x0a, byte(len(inner))}, inner...)
+	data = append(data, 0x12, 8)
+	data = append(data, "LongFast"...)
+	data = append(data, 0x1a, 9)
+	data = append(data, "!abcd1234"...)
+
+	env, err := ParseServiceEnvelope(data)
+	if err != nil {
+		t.Fatalf("ParseServiceEnvelope: %v", err)
+	}
+	if env.ChannelID != "LongFast" || env.GatewayID != "!abcd1234" {
+		t.Errorf("envelope = %q/%q", env.ChannelID, env.GatewayID)
+	}
+
+	p := env.ToPacket()
+	if p.From != mp.From || p.ID != 42 || p.GatewayID != "!abcd1234" || p.ChannelName != "LongFast" {
+		t.Errorf("packet = %+v", p)
+	}
+	if text, ok := p.Payload.(*TextMessage); !ok || text.Text != "hello" {
+		t.Errorf("payload = %#v", p.Payload)
+	}
+
+	if again, err := ParseServiceEnvelope(env.Marshal()); err != nil || again.GatewayID != env.GatewayID {
+		t.Errorf("round trip = %+v, %v", again, err)
+	}
+}
+
+func TestParseServiceEnvelopeRejectsFromRadio(t *testing.T) {
+	fr := []byte{0x08, 0x01, 0x12, 0x02, 0x08, 0x01} // id=1, packet{from=1}
+	if _, err := ParseServiceEnvelope(fr); err == nil {
+		t.Error("FromRadio parsed as a ServiceEnvelope")
+	}
+	if _, err := ParseServiceEnvelope([]byte{0x12, 0x01, 'x'}); err == nil {
+		t.Error("envelope without a packet accepted")
+	}
+}
@@ -15,11 +15,17 @@ const (
 	Magic1 byte = 0x94
 	Magic2 byte = 0xc3
 
-	// Maximum packet size
+	// Maximum packet size (default limit for the stream API)
 	MaxPacketSize = 512
 
+	// MaxFrameSize is the largest payload the 16-bit length header can carry
+	MaxFrameSize = 0xFFFF
+
 	// Header size (2 magic bytes + 2 length bytes)
 	HeaderSize = 4
+
+	// WakeSequenceLen is the number of Magic2 bytes sent to wake a device
+	WakeSequenceLen = 32
 )
 
 var (
@@ -35,25 +41,56 @@ var (
 
 // StreamFramer handles framing/deframing of Meshtastic packets over streams
 type StreamFramer struct {
-	reader     io.Reader
-	writer     io.Writer
-	readBuffer []byte // Buffer for accumulating partial reads
-	readPos    int    // Current position in read buffer
+	reader        io.Reader
+	writer        io.Writer
+	readBuffer    []byte // Buffer for accumulating partial reads
+	readPos       int    // Current position in read buffer
+	maxPacketSize int    // Largest payload accepted or sent
+	skipRemaining int    // Payload bytes of an oversize frame still to discard
 }
 
 // NewStreamFramer creates a new stream framer
 func NewStreamFramer(r io.Reader, w io.Writer) *StreamFramer {
 	return &StreamFramer{
-		reader:     r,
-		writer:     w,
-		readBuffer: make([]byte, MaxPacketSize+HeaderSize),
-		readPos:    0,
+		reader:        r,
+		writer:        w,
+		readBuffer:    make([]byte, MaxPacketSize+HeaderSize),
+		readPos:       0,
+		maxPacketSize: MaxPacketSize,
+	}
+}
+
+// SetMaxPacketSize changes the largest payload the framer accepts.
+// Values outside 1..MaxFrameSize are clamped. Buffered data is preserved.
+func (f *StreamFramer) SetMaxPacketSize(size int) {
+	if size <= 0 {
+		size = MaxPacketSize
 	}
+	if size > MaxFrameSize {
+		size = MaxFrameSize
+	}
+
+	buf := make([]byte, size+HeaderSize)
+	f.readPos = copy(buf, f.readBuffer[:f.readPos])
+	f.readBuffer = buf
+	f.maxPacketSize = size
+}
+
+// MaxPacketSize returns the largest payload the framer accepts
+func (f *StreamFramer) MaxPacketSize() int {
+	return f.maxPacketSize
 }
 
 // ReadPacket reads a framed packet from the stream
 // It handles timeouts gracefully by preserving partial reads across calls
 func (f *StreamFramer) ReadPacket() ([]byte, error) {
+	// Finish discarding an oversize frame before looking for the next header
+	if f.skipRemaining > 0 {
+		if err := f.skipOversize(); err != nil {
+			return nil, err
+		}
+	}
+
 	// Read until we have at least the header
 	for f.readPos < HeaderSize {
 		n, err := f.reader.Read(f.readBuffer[f.readPos:])
@@ -71,17 +108,18 @@ func (f *StreamFramer) ReadPacket() ([]byte, error) {
 
 	// Validate magic bytes
 	if f.readBuffer[0] != Magic1 || f.readBuffer[1] != Magic2 {
-		// Invalid magic - discard first byte and try to resync
-		copy(f.readBuffer, f.readBuffer[1:f.readPos])
-		f.readPos--
+		// Invalid magic - discard noise up to the next possible frame start
+		f.resync()
 		return nil, ErrInvalidMagic
 	}
 
 	// Get length (big endian)
 	length := binary.BigEndian.Uint16(f.readBuffer[2:4])
-	if length > MaxPacketSize {
-		// Invalid length - reset buffer
-		f.readPos = 0
+	if int(length) > f.maxPacketSize {
+		// Oversize frame - skip its payload so the stream stays in sync
+		f.discard(HeaderSize)
+		f.skipRemaining = int(length)
+		f.discardSkipped()
 		return nil, ErrPacketTooLarge
 	}
 
@@ -116,6 +154,57 @@ func (f *StreamFramer) ReadPacket() ([]byte, error) {
 	return payload, nil
 }
 
+// discard drops the first n buffered bytes
+func (f *StreamFramer) discard(n int) {
+	copy(f.readBuffer, f.readBuffer[n:f.readPos])
+	f.readPos -= n
+}
+
+// discardSkipped drops buffered bytes belonging to an oversize frame
+func (f *StreamFramer) discardSkipped() {
+	n := f.skipRemaining
+	if n > f.readPos {
+		n = f.readPos
+	}
+	f.discard(n)
+	f.skipRemaining -= n
+}
+
+// skipOversize reads and drops the remaining payload of an oversize frame
+func (f *StreamFramer) skipOversize() error {
+	f.discardSkipped()
+	for f.skipRemaining > 0 {
+		n, err := f.reader.Read(f.readBuffer[f.readPos:])
+		if n > 0 {
+			f.readPos += n
+			f.discardSkipped()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resync discards buffered bytes preceding the next candidate frame start.
+// A trailing Magic1 is kept since its Magic2 may arrive in the next read,
+// which lets the framer recover from boot noise split across reads.
+func (f *StreamFramer) resync() {
+	start := f.readPos
+	for i := 1; i < f.readPos; i++ {
+		if f.readBuffer[i] != Magic1 {
+			continue
+		}
+		if i+1 == f.readPos || f.readBuffer[i+1] == Magic2 {
+			start = i
+			break
+		}
+	}
+
+	copy(f.readBuffer, f.readBuffer[start:f.readPos])
+	f.readPos -= start
+}
+
 // isTemporaryError checks if an error is temporary (timeout) and can be retried
 func isTemporaryError(err error) bool {
 	if err == nil {
@@ -137,7 +226,7 @@ func isTemporaryError(err error) bool {
 
 // WritePacket writes a framed packet to the stream
 func (f *StreamFramer) WritePacket(data []byte) error {
-	if len(data) > MaxPacketSize {
+	if len(data) > f.maxPacketSize {
 		return ErrPacketTooLarge
 	}
 
@@ -156,6 +245,19 @@ func (f *StreamFramer) WritePacket(data []byte) error {
 	return nil
 }
 
+// WriteWake writes the wake sequence expected by devices before the first
+// frame. Devices in light sleep or with a console attached use the run of
+// Magic2 bytes to switch the serial port into API mode.
+func (f *StreamFramer) WriteWake() error {
+	wake := make([]byte, WakeSequenceLen)
+	for i := range wake {
+		wake[i] = Magic2
+	}
+
+	_, err := f.writer.Write(wake)
+	return err
+}
+
 // SyncToMagic reads bytes until it finds the magic sequence
 // Useful for recovering from stream corruption
 func (f *StreamFramer) SyncToMagic() error {
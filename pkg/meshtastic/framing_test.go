@@ -2,6 +2,7 @@ package meshtastic
 
 import (
 	"bytes"
+	"io"
 	"testing"
 )
 
@@ -137,3 +138,116 @@ func TestSyncToMagic(t *testing.T) {
 		t.Errorf("Expected 6 bytes remaining, got %d", len(remaining))
 	}
 }
+
+// chunkReader returns data in fixed-size chunks to simulate split reads
+type chunkReader struct {
+	data []byte
+	size int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n := r.size
+	if n > len(p) {
+		n = len(p)
+	}
+	if n > len(r.data) {
+		n = len(r.data)
+	}
+	copy(p, r.data[:n])
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestStreamFramerResyncAcrossReads(t *testing.T) {
+	// Boot noise including a stray Magic1 and a Magic1 split from its Magic2
+	noise := []byte("INFO | boot\r\n")
+	noise = append(noise, Magic1, 'x', 0x00)
+	frame := []byte{Magic1, Magic2, 0x00, 0x04, 't', 'e', 's', 't'}
+
+	for _, size := range []int{1, 3, 5, 64} {
+		stream := append(append([]byte{}, noise...), frame...)
+		framer := NewStreamFramer(&chunkReader{data: stream, size: size}, nil)
+
+		var (
+			data []byte
+			err  error
+		)
+		for attempts := 0; attempts < len(stream); attempts++ {
+			data, err = framer.ReadPacket()
+			if err != ErrInvalidMagic {
+				break
+			}
+		}
+
+		if err != nil {
+			t.Fatalf("chunk size %d: ReadPacket failed: %v", size, err)
+		}
+		if !bytes.Equal(data, []byte("test")) {
+			t.Errorf("chunk size %d: expected payload 'test', got %q", size, data)
+		}
+	}
+}
+
+func TestWriteWake(t *testing.T) {
+	buf := &bytes.Buffer{}
+	framer := NewStreamFramer(buf, buf)
+
+	if err := framer.WriteWake(); err != nil {
+		t.Fatalf("WriteWake failed: %v", err)
+	}
+
+	wake := buf.Bytes()
+	if len(wake) != WakeSequenceLen {
+		t.Fatalf("Expected %d wake bytes, got %d", WakeSequenceLen, len(wake))
+	}
+	for i, b := range wake {
+		if b != Magic2 {
+			t.Fatalf("Wake byte %d: expected 0x%02x, got 0x%02x", i, Magic2, b)
+		}
+	}
+}
+
+func TestStreamFramerSkipsOversizeFrame(t *testing.T) {
+	oversize := append([]byte{Magic1, Magic2, 0x00, 0x14}, bytes.Repeat([]byte{Magic1}, 20)...)
+	valid := []byte{Magic1, Magic2, 0x00, 0x02, 'o', 'k'}
+
+	for _, size := range []int{1, 7, 64} {
+		stream := append(append([]byte{}, oversize...), valid...)
+		framer := NewStreamFramer(&chunkReader{data: stream, size: size}, nil)
+		framer.SetMaxPacketSize(8)
+
+		if _, err := framer.ReadPacket(); err != ErrPacketTooLarge {
+			t.Fatalf("chunk size %d: expected ErrPacketTooLarge, got %v", size, err)
+		}
+
+		data, err := framer.ReadPacket()
+		if err != nil {
+			t.Fatalf("chunk size %d: ReadPacket after oversize frame failed: %v", size, err)
+		}
+		if !bytes.Equal(data, []byte("ok")) {
+			t.Errorf("chunk size %d: expected payload 'ok', got %q", size, data)
+		}
+	}
+}
+
+func TestStreamFramerJumboFrames(t *testing.T) {
+	buf := &bytes.Buffer{}
+	framer := NewStreamFramer(buf, buf)
+	framer.SetMaxPacketSize(4096)
+
+	jumbo := bytes.Repeat([]byte{0xAB}, 3000)
+	if err := framer.WritePacket(jumbo); err != nil {
+		t.Fatalf("WritePacket failed: %v", err)
+	}
+
+	data, err := framer.ReadPacket()
+	if err != nil {
+		t.Fatalf("ReadPacket failed: %v", err)
+	}
+	if !bytes.Equal(data, jumbo) {
+		t.Errorf("Jumbo payload mismatch: got %d bytes", len(data))
+	}
+}
@@ -0,0 +1,201 @@
+package meshtastic
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FieldSpan is a protobuf field located in an encoded message
+type FieldSpan struct {
+	// Start is the offset of the field's tag; End is the offset after
+	// its value
+	Start, End int
+	Num        uint64
+	WireType   uint8
+	Name       string
+	// Value describes the field's value: the number for varint and
+	// fixed fields, the length for length-delimited ones
+	Value string
+	// Depth is how deeply the field is nested in the frame
+	Depth int
+}
+
+// schema names the fields of a message type. Fields with a sub schema
+// are walked into.
+type schema map[uint64]schemaField
+
+type schemaField struct {
+	name string
+	sub  schema
+}
+
+// Field numbers as read by ParseFromRadio and the parsers it calls
+var (
+	dataSchema = schema{
+		1: {name: "portnum"},
+		2: {name: "payload"},
+		3: {name: "want_response"},
+		4: {name: "dest"},
+		5: {name: "source"},
+		6: {name: "request_id"},
+		7: {name: "reply_id"},
+		8: {name: "emoji"},
+	}
+	meshPacketSchema = schema{
+		1:  {name: "from"},
+		2:  {name: "to"},
+		3:  {name: "channel"},
+		4:  {name: "decoded", sub: dataSchema},
+		5:  {name: "encrypted"},
+		6:  {name: "id"},
+		7:  {name: "rx_time"},
+		10: {name: "hop_limit"},
+		11: {name: "want_ack"},
+		12: {name: "priority"},
+		13: {name: "rx_snr"},
+		14: {name: "rx_rssi"},
+		15: {name: "hop_start"},
+		16: {name: "public_key"},
+		17: {name: "pki_encrypted"},
+	}
+	fromRadioSchema = schema{
+		1:  {name: "id"},
+		2:  {name: "packet", sub: meshPacketSchema},
+		3:  {name: "my_info"},
+		4:  {name: "node_info"},
+		8:  {name: "config_complete_id"},
+		9:  {name: "rebooted"},
+		11: {name: "xmodem_packet"},
+		13: {name: "metadata"},
+	}
+)
+
+// FromRadioFields returns the fields of an encoded FromRadio message in
+// order, including those of the mesh packet and its decoded payload.
+// Walking stops at the first malformed field.
+func FromRadioFields(data []byte) []FieldSpan {
+	return spanFields(data, 0, 0, fromRadioSchema, nil)
+}
+
+func spanFields(data []byte, base, depth int, s schema, spans []FieldSpan) []FieldSpan {
+	pos := 0
+	for pos < len(data) {
+		tag, n := decodeVarint(data[pos:])
+		if n == 0 {
+			return spans
+		}
+		span := FieldSpan{
+			Start:    base + pos,
+			Num:      tag >> 3,
+			WireType: uint8(tag & 0x07),
+			Depth:    depth,
+		}
+		pos += n
+
+		f, known := s[span.Num]
+		span.Name = f.name
+		if !known {
+			span.Name = fmt.Sprintf("field %d", span.Num)
+		}
+
+		var sub []byte
+		switch span.WireType {
+		case 0: // Varint
+			val, n := decodeVarint(data[pos:])
+			if n == 0 {
+				return spans
+			}
+			pos += n
+			span.Value = fmt.Sprintf("%d", val)
+		case 1: // 64-bit
+			if pos+8 > len(data) {
+				return spans
+			}
+			span.Value = fmt.Sprintf("%d", binary.LittleEndian.Uint64(data[pos:]))
+			pos += 8
+		case 2: // Length-delimited
+			length, n := decodeVarint(data[pos:])
+			if n == 0 || length > uint64(len(data)-pos-n) {
+				return spans
+			}
+			pos += n
+			sub = data[pos : pos+int(length)]
+			span.Value = fmt.Sprintf("%d bytes", length)
+			pos += int(length)
+		case 5: // 32-bit
+			if pos+4 > len(data) {
+				return spans
+			}
+			span.Value = fmt.Sprintf("%d", int32(binary.LittleEndian.Uint32(data[pos:])))
+			pos += 4
+		default:
+			return spans
+		}
+
+		span.End = base + pos
+		spans = append(spans, span)
+		if f.sub != nil && sub != nil {
+			spans = spanFields(sub, span.End-len(sub), depth+1, f.sub, spans)
+		}
+	}
+	return spans
+}
+
+// hexdumpWidth is the number of bytes on each hexdump line
+const hexdumpWidth = 16
+
+// WriteHexdump writes a FromRadio frame as a hexdump: offset, bytes, and
+// ASCII, with each line followed by the fields that start on it
+func WriteHexdump(w io.Writer, frame []byte) error {
+	spans := FromRadioFields(frame)
+	next := 0
+
+	var b strings.Builder
+	for off := 0; off < len(frame); off += hexdumpWidth {
+		line := frame[off:min(off+hexdumpWidth, len(frame))]
+
+		fmt.Fprintf(&b, "%08x  ", off)
+		for i := 0; i < hexdumpWidth; i++ {
+			if i < len(line) {
+				fmt.Fprintf(&b, "%02x ", line[i])
+			} else {
+				b.WriteString("   ")
+			}
+			if i == hexdumpWidth/2-1 {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(" |")
+		for _, c := range line {
+			if c < 0x20 || c > 0x7e {
+				c = '.'
+			}
+			b.WriteByte(c)
+		}
+		b.WriteString("|\n")
+
+		for ; next < len(spans) && spans[next].Start < off+hexdumpWidth; next++ {
+			s := spans[next]
+			fmt.Fprintf(&b, "          %04x-%04x %s%s (%d) = %s\n",
+				s.Start, s.End-1, strings.Repeat("  ", s.Depth), s.Name, s.Num, s.Value)
+		}
+	}
+	if end := lastEnd(spans); end < len(frame) {
+		fmt.Fprintf(&b, "          %04x-%04x not decoded\n", end, len(frame)-1)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// lastEnd returns the end of the last top-level field
+func lastEnd(spans []FieldSpan) int {
+	for i := len(spans) - 1; i >= 0; i-- {
+		if spans[i].Depth == 0 {
+			return spans[i].End
+		}
+	}
+	return 0
+}
@@ -0,0 +1,48 @@
+package meshtastic
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteHexdump(t *testing.T) {
+	frame := []byte{
+		0x08, 0x05, // id = 5
+		0x12, 0x0a, // packet, 10 bytes
+		0x08, 0x07, // from = 7
+		0x22, 0x06, // decoded, 6 bytes
+		0x08, 0x01, // portnum = 1
+		0x12, 0x02, 'h', 'i', // payload
+		0x40, 0x2a, // config_complete_id = 42
+		0xff, // trailing garbage
+	}
+
+	spans := FromRadioFields(frame)
+	var names []string
+	for _, s := range spans {
+		names = append(names, s.Name)
+	}
+	if got := strings.Join(names, ","); got != "id,packet,from,decoded,portnum,payload,config_complete_id" {
+		t.Fatalf("fields = %s", got)
+	}
+	if p := spans[5]; p.Start != 10 || p.End != 14 || p.Depth != 2 {
+		t.Errorf("payload span = %+v", p)
+	}
+
+	var b strings.Builder
+	if err := WriteHexdump(&b, frame); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"00000000  08 05 12 0a 08 07 22 06  08 01 12 02 68 69 40 2a  |......\".....hi@*|",
+		"0002-000d packet (2) = 10 bytes",
+		"000a-000d     payload (2) = 2 bytes",
+		"00000010  ff ",
+		"0010-0010 not decoded",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("hexdump missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package meshtastic
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// PKI packets are AES-256-CCM encrypted with a key derived from an X25519
+// exchange between the sender's and recipient's keys. The ciphertext is
+// followed by an 8 byte auth tag and a 4 byte extra nonce.
+const (
+	pkiTagSize   = 8
+	pkiExtraSize = 4
+	pkiOverhead  = pkiTagSize + pkiExtraSize
+	ccmNonceSize = 13
+)
+
+// ErrPKIDecrypt indicates a PKI packet could not be authenticated, usually
+// because it was not addressed to this key
+var ErrPKIDecrypt = errors.New("pki decryption failed")
+
+// PKIPublicKey derives the X25519 public key for a private key
+func PKIPublicKey(privateKey []byte) ([]byte, error) {
+	priv, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	return priv.PublicKey().Bytes(), nil
+}
+
+// DecryptPKI decrypts a PKI packet payload sent by from with packet id,
+// using the recipient's private key and the sender's public key
+func DecryptPKI(privateKey, senderKey []byte, from, id uint32, data []byte) ([]byte, error) {
+	if len(data) < pkiOverhead {
+		return nil, ErrPKIDecrypt
+	}
+
+	block, err := pkiCipher(privateKey, senderKey)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(data) - pkiOverhead
+	ciphertext, tag := data[:n], data[n:n+pkiTagSize]
+	extra := binary.LittleEndian.Uint32(data[n+pkiTagSize:])
+
+	plain, ok := ccmOpen(block, pkiNonce(from, id, extra), ciphertext, tag)
+	if !ok {
+		return nil, ErrPKIDecrypt
+	}
+	return plain, nil
+}
+
+// EncryptPKI encrypts a payload the way the firmware does for a PKI
+// packet from the sender's private key to the recipient's public key
+func EncryptPKI(privateKey, recipientKey []byte, from, id, extraNonce uint32, plain []byte) ([]byte, error) {
+	block, err := pkiCipher(privateKey, recipientKey)
+	if err != nil {
+		return nil, err
+	}
+
+	out := ccmSeal(block, pkiNonce(from, id, extraNonce), plain)
+	return binary.LittleEndian.AppendUint32(out, extraNonce), nil
+}
+
+// DecryptPKI decodes an encrypted PKI packet in place
+func (mp *MeshPacket) DecryptPKI(privateKey, senderKey []byte) error {
+	plain, err := DecryptPKI(privateKey, senderKey, mp.From, mp.ID, mp.Encrypted)
+	if err != nil {
+		return err
+	}
+
+	decoded, err := parseData(plain)
+	if err != nil {
+		return fmt.Errorf("failed to parse decrypted payload: %w", err)
+	}
+	mp.Decoded = decoded
+	mp.Encrypted = nil
+	mp.PkiEncrypted = true
+	return nil
+}
+
+// pkiCipher derives the shared AES-256 key for a key pair
+func pkiCipher(privateKey, publicKey []byte) (cipher.Block, error) {
+	priv, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	pub, err := ecdh.X25519().NewPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, fmt.Errorf("key exchange failed: %w", err)
+	}
+	key := sha256.Sum256(shared)
+	return aes.NewCipher(key[:])
+}
+
+// pkiNonce builds the CCM nonce: the packet id as a 64-bit value with the
+// extra nonce over its upper half, then the sender
+func pkiNonce(from, id, extra uint32) []byte {
+	nonce := make([]byte, ccmNonceSize)
+	binary.LittleEndian.PutUint32(nonce[0:], id)
+	binary.LittleEndian.PutUint32(nonce[4:], extra)
+	binary.LittleEndian.PutUint32(nonce[8:], from)
+	return nonce
+}
+
+// ccmSeal encrypts plain with AES-CCM (RFC 3610) using an 8 byte tag, a
+// 2 byte length field, and no associated data. It returns the ciphertext
+// followed by the tag.
+func ccmSeal(block cipher.Block, nonce, plain []byte) []byte {
+	tag := ccmMAC(block, nonce, plain)
+	out := make([]byte, len(plain), len(plain)+pkiTagSize)
+	ccmCTR(block, nonce, out, plain, tag)
+	return append(out, tag...)
+}
+
+// ccmOpen decrypts and authenticates a ccmSeal ciphertext
+func ccmOpen(block cipher.Block, nonce, ciphertext, tag []byte) ([]byte, bool) {
+	plain := make([]byte, len(ciphertext))
+	want := append([]byte(nil), tag...)
+	ccmCTR(block, nonce, plain, ciphertext, want)
+
+	if subtle.ConstantTimeCompare(want, ccmMAC(block, nonce, plain)) != 1 {
+		return nil, false
+	}
+	return plain, true
+}
+
+// ccmMAC computes the CBC-MAC over the message
+func ccmMAC(block cipher.Block, nonce, msg []byte) []byte {
+	var b [aes.BlockSize]byte
+	b[0] = byte(((pkiTagSize-2)/2)<<3 | (15 - ccmNonceSize - 1))
+	copy(b[1:], nonce)
+	binary.BigEndian.PutUint16(b[14:], uint16(len(msg)))
+
+	var x [aes.BlockSize]byte
+	block.Encrypt(x[:], b[:])
+	for i := 0; i < len(msg); i += aes.BlockSize {
+		end := min(i+aes.BlockSize, len(msg))
+		for j := i; j < end; j++ {
+			x[j-i] ^= msg[j]
+		}
+		block.Encrypt(x[:], x[:])
+	}
+	return x[:pkiTagSize]
+}
+
+// ccmCTR applies the CCM keystream: counter 0 to the tag in place, and
+// counters 1.. to src into dst
+func ccmCTR(block cipher.Block, nonce, dst, src, tag []byte) {
+	var ctr [aes.BlockSize]byte
+	ctr[0] = byte(15 - ccmNonceSize - 1)
+	copy(ctr[1:], nonce)
+
+	var s [aes.BlockSize]byte
+	block.Encrypt(s[:], ctr[:])
+	subtle.XORBytes(tag, tag, s[:pkiTagSize])
+
+	for i := 0; i < len(src); i += aes.BlockSize {
+		binary.BigEndian.PutUint16(ctr[14:], uint16(i/aes.BlockSize+1))
+		block.Encrypt(s[:], ctr[:])
+		end := min(i+aes.BlockSize, len(src))
+		subtle.XORBytes(dst[i:end], src[i:end], s[:end-i])
+	}
+}
@@ -3,6 +3,7 @@ package meshtastic
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"math"
 	"time"
 )
@@ -43,40 +44,42 @@ const (
 
 // String returns the string representation of the port number
 func (p PortNum) String() string {
-	names := map[PortNum]string{
-		PortNumUnknownApp:         "UNKNOWN_APP",
-		PortNumTextMessageApp:     "TEXT_MESSAGE_APP",
-		PortNumRemoteHardwareApp:  "REMOTE_HARDWARE_APP",
-		PortNumPositionApp:        "POSITION_APP",
-		PortNumNodeInfoApp:        "NODEINFO_APP",
-		PortNumRoutingApp:         "ROUTING_APP",
-		PortNumAdminApp:           "ADMIN_APP",
-		PortNumTextMsgCompressApp: "TEXT_MESSAGE_COMPRESSED_APP",
-		PortNumWaypointApp:        "WAYPOINT_APP",
-		PortNumAudioApp:           "AUDIO_APP",
-		PortNumDetectionSensorApp: "DETECTION_SENSOR_APP",
-		PortNumReplyApp:           "REPLY_APP",
-		PortNumIPTunnelApp:        "IP_TUNNEL_APP",
-		PortNumPaxcounterApp:      "PAXCOUNTER_APP",
-		PortNumSerialApp:          "SERIAL_APP",
-		PortNumStoreForwardApp:    "STORE_FORWARD_APP",
-		PortNumRangeTestApp:       "RANGE_TEST_APP",
-		PortNumTelemetryApp:       "TELEMETRY_APP",
-		PortNumZpsApp:             "ZPS_APP",
-		PortNumSimulatorApp:       "SIMULATOR_APP",
-		PortNumTracerouteApp:      "TRACEROUTE_APP",
-		PortNumNeighborinfoApp:    "NEIGHBORINFO_APP",
-		PortNumAtakPlugin:         "ATAK_PLUGIN",
-		PortNumMapReportApp:       "MAP_REPORT_APP",
-		PortNumPrivateApp:         "PRIVATE_APP",
-		PortNumAtakForwarder:      "ATAK_FORWARDER",
-	}
-	if name, ok := names[p]; ok {
+	if name, ok := portNames[p]; ok {
 		return name
 	}
 	return "UNKNOWN_APP"
 }
 
+// portNames is built once; String is called for every relayed packet
+var portNames = map[PortNum]string{
+	PortNumUnknownApp:         "UNKNOWN_APP",
+	PortNumTextMessageApp:     "TEXT_MESSAGE_APP",
+	PortNumRemoteHardwareApp:  "REMOTE_HARDWARE_APP",
+	PortNumPositionApp:        "POSITION_APP",
+	PortNumNodeInfoApp:        "NODEINFO_APP",
+	PortNumRoutingApp:         "ROUTING_APP",
+	PortNumAdminApp:           "ADMIN_APP",
+	PortNumTextMsgCompressApp: "TEXT_MESSAGE_COMPRESSED_APP",
+	PortNumWaypointApp:        "WAYPOINT_APP",
+	PortNumAudioApp:           "AUDIO_APP",
+	PortNumDetectionSensorApp: "DETECTION_SENSOR_APP",
+	PortNumReplyApp:           "REPLY_APP",
+	PortNumIPTunnelApp:        "IP_TUNNEL_APP",
+	PortNumPaxcounterApp:      "PAXCOUNTER_APP",
+	PortNumSerialApp:          "SERIAL_APP",
+	PortNumStoreForwardApp:    "STORE_FORWARD_APP",
+	PortNumRangeTestApp:       "RANGE_TEST_APP",
+	PortNumTelemetryApp:       "TELEMETRY_APP",
+	PortNumZpsApp:             "ZPS_APP",
+	PortNumSimulatorApp:       "SIMULATOR_APP",
+	PortNumTracerouteApp:      "TRACEROUTE_APP",
+	PortNumNeighborinfoApp:    "NEIGHBORINFO_APP",
+	PortNumAtakPlugin:         "ATAK_PLUGIN",
+	PortNumMapReportApp:       "MAP_REPORT_APP",
+	PortNumPrivateApp:         "PRIVATE_APP",
+	PortNumAtakForwarder:      "ATAK_FORWARDER",
+}
+
 // MeshPacket represents a decoded Meshtastic mesh packet
 type MeshPacket struct {
 	From         uint32
@@ -252,6 +255,30 @@ type DeviceMetadata struct {
 	HasRemoteHardware  bool
 }
 
+// roleNames maps device roles (Config.DeviceConfig.Role) to their names
+var roleNames = map[uint32]string{
+	0:  "CLIENT",
+	1:  "CLIENT_MUTE",
+	2:  "ROUTER",
+	3:  "ROUTER_CLIENT",
+	4:  "REPEATER",
+	5:  "TRACKER",
+	6:  "SENSOR",
+	7:  "TAK",
+	8:  "CLIENT_HIDDEN",
+	9:  "LOST_AND_FOUND",
+	10: "TAK_TRACKER",
+	11: "ROUTER_LATE",
+}
+
+// RoleName returns the name of a device role, or ROLE_<n> if unknown
+func RoleName(role uint32) string {
+	if name, ok := roleNames[role]; ok {
+		return name
+	}
+	return fmt.Sprintf("ROLE_%d", role)
+}
+
 // MqttClientProxyMessage for MQTT proxy communication
 type MqttClientProxyMessage struct {
 	Topic    string
@@ -302,7 +329,7 @@ func ParseFromRadio(data []byte) (*FromRadio, error) {
 		case 2: // Length-delimited
 			length, n := decodeVarint(data[pos:])
 			pos += n
-			if pos+int(length) > len(data) {
+			if length > uint64(len(data)-pos) {
 				return nil, ErrInvalidProtobuf
 			}
 			fieldData := data[pos : pos+int(length)]
@@ -329,6 +356,12 @@ func ParseFromRadio(data []byte) (*FromRadio, error) {
 				fr.NodeInfo = nodeInfo
 			case 11: // xmodem_packet
 				fr.XmodemPacket = fieldData
+			case 13: // metadata
+				metadata, err := parseDeviceMetadata(fieldData)
+				if err != nil {
+					return nil, err
+				}
+				fr.Metadata = metadata
 			}
 
 		default:
@@ -345,10 +378,15 @@ func parseMeshPacket(data []byte) (*MeshPacket, error) {
 	pos := 0
 
 	for pos < len(data) {
-		tag := data[pos]
+		// public_key and pki_encrypted exceed field 15, so tags may span
+		// several bytes
+		tag, n := decodeVarint(data[pos:])
+		if n == 0 {
+			return nil, ErrInvalidProtobuf
+		}
 		fieldNum := tag >> 3
 		wireType := tag & 0x07
-		pos++
+		pos += n
 
 		switch wireType {
 		case 0: // Varint
@@ -382,7 +420,7 @@ func parseMeshPacket(data []byte) (*MeshPacket, error) {
 		case 2: // Length-delimited
 			length, n := decodeVarint(data[pos:])
 			pos += n
-			if pos+int(length) > len(data) {
+			if length > uint64(len(data)-pos) {
 				return nil, ErrInvalidProtobuf
 			}
 			fieldData := data[pos : pos+int(length)]
@@ -453,7 +491,7 @@ func parseData(data []byte) (*Data, error) {
 		case 2: // Length-delimited
 			length, n := decodeVarint(data[pos:])
 			pos += n
-			if pos+int(length) > len(data) {
+			if length > uint64(len(data)-pos) {
 				return nil, ErrInvalidProtobuf
 			}
 			fieldData := data[pos : pos+int(length)]
@@ -494,6 +532,9 @@ func parseMyNodeInfo(data []byte) (*MyNodeInfo, error) {
 		case 2: // Length-delimited
 			length, n := decodeVarint(data[pos:])
 			pos += n
+			if length > uint64(len(data)-pos) {
+				return nil, ErrInvalidProtobuf
+			}
 			pos += int(length) // Skip for now
 		}
 	}
@@ -501,6 +542,58 @@ func parseMyNodeInfo(data []byte) (*MyNodeInfo, error) {
 	return info, nil
 }
 
+func parseDeviceMetadata(data []byte) (*DeviceMetadata, error) {
+	md := &DeviceMetadata{}
+	pos := 0
+
+	for pos < len(data) {
+		tag := data[pos]
+		fieldNum := tag >> 3
+		wireType := tag & 0x07
+		pos++
+
+		switch wireType {
+		case 0: // Varint
+			val, n := decodeVarint(data[pos:])
+			pos += n
+			switch fieldNum {
+			case 2:
+				md.DeviceStateVersion = uint32(val)
+			case 3:
+				md.CanShutdown = val != 0
+			case 4:
+				md.HasWifi = val != 0
+			case 5:
+				md.HasBluetooth = val != 0
+			case 6:
+				md.HasEthernet = val != 0
+			case 7:
+				md.Role = uint32(val)
+			case 8:
+				md.PositionFlags = uint32(val)
+			case 9:
+				md.HwModel = uint32(val)
+			case 10:
+				md.HasRemoteHardware = val != 0
+			}
+		case 2: // Length-delimited
+			length, n := decodeVarint(data[pos:])
+			pos += n
+			if length > uint64(len(data)-pos) {
+				return nil, ErrInvalidProtobuf
+			}
+			if fieldNum == 1 {
+				md.FirmwareVersion = string(data[pos : pos+int(length)])
+			}
+			pos += int(length)
+		default:
+			return nil, ErrUnsupportedType
+		}
+	}
+
+	return md, nil
+}
+
 func parseNodeInfo(data []byte) (*NodeInfo, error) {
 	info := &NodeInfo{}
 	pos := 0
@@ -536,7 +629,7 @@ func parseNodeInfo(data []byte) (*NodeInfo, error) {
 		case 2: // Length-delimited
 			length, n := decodeVarint(data[pos:])
 			pos += n
-			if pos+int(length) > len(data) {
+			if length > uint64(len(data)-pos) {
 				return nil, ErrInvalidProtobuf
 			}
 			fieldData := data[pos : pos+int(length)]
@@ -601,7 +694,7 @@ func parseUser(data []byte) (*User, error) {
 		case 2: // Length-delimited
 			length, n := decodeVarint(data[pos:])
 			pos += n
-			if pos+int(length) > len(data) {
+			if length > uint64(len(data)-pos) {
 				return nil, ErrInvalidProtobuf
 			}
 			fieldData := data[pos : pos+int(length)]
@@ -662,6 +755,9 @@ func parsePosition(data []byte) (*Position, error) {
 		case 2: // Length-delimited
 			length, n := decodeVarint(data[offset:])
 			offset += n
+			if length > uint64(len(data)-offset) {
+				return nil, ErrInvalidProtobuf
+			}
 			offset += int(length) // Skip
 
 		case 5: // 32-bit (sfixed32, fixed32, float)
@@ -729,6 +825,8 @@ func (fr *FromRadio) ToPacket() *Packet {
 	if mp.Decoded != nil {
 		p.PortNum = mp.Decoded.PortNum
 		p.RawPayload = mp.Decoded.Payload
+		p.ReplyID = mp.Decoded.ReplyID
+		p.Emoji = mp.Decoded.Emoji != 0
 
 		// Decode payload based on port number
 		switch mp.Decoded.PortNum {
@@ -738,6 +836,28 @@ func (fr *FromRadio) ToPacket() *Packet {
 			if pos, err := parsePosition(mp.Decoded.Payload); err == nil {
 				p.Payload = pos
 			}
+		case PortNumNodeInfoApp:
+			if user, err := parseUser(mp.Decoded.Payload); err == nil {
+				p.Payload = user
+			}
+		case PortNumDetectionSensorApp:
+			p.Payload = &DetectionEvent{Text: string(mp.Decoded.Payload)}
+		case PortNumPaxcounterApp:
+			if pc, err := parsePaxcount(mp.Decoded.Payload); err == nil {
+				p.Payload = pc
+			}
+		case PortNumTelemetryApp:
+			if t, err := parseTelemetry(mp.Decoded.Payload); err == nil {
+				p.Payload = t
+			}
+		case PortNumStoreForwardApp:
+			if sf, err := ParseStoreAndForward(mp.Decoded.Payload); err == nil {
+				p.Payload = sf
+			}
+		case PortNumAtakPlugin:
+			if tp, err := ParseTAKPacket(mp.Decoded.Payload); err == nil {
+				p.Payload = tp
+			}
 		default:
 			p.Payload = mp.Decoded.Payload
 		}
@@ -761,6 +881,13 @@ type Packet struct {
 	WantAck    bool
 	ReceivedAt time.Time
 	FromNode   *NodeInfo
+	// ReplyID is the ID of the packet this one replies to; Emoji marks
+	// the reply as a reaction
+	ReplyID uint32
+	Emoji   bool
+	// GatewayID and ChannelName are set for packets received over MQTT
+	GatewayID   string
+	ChannelName string
 }
 
 // TextMessage represents a text message payload
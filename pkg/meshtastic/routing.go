@@ -0,0 +1,92 @@
+package meshtastic
+
+import "fmt"
+
+// RoutingError is the error_reason of a Routing message. Zero means the
+// packet was delivered; routing acks carry it in reply to want_ack packets.
+type RoutingError uint32
+
+// Routing error reasons (subset of mesh.proto Routing.Error)
+const (
+	RoutingErrorNone             RoutingError = 0
+	RoutingErrorNoRoute          RoutingError = 1
+	RoutingErrorGotNak           RoutingError = 2
+	RoutingErrorTimeout          RoutingError = 3
+	RoutingErrorNoInterface      RoutingError = 4
+	RoutingErrorMaxRetransmit    RoutingError = 5
+	RoutingErrorNoChannel        RoutingError = 6
+	RoutingErrorTooLarge         RoutingError = 7
+	RoutingErrorNoResponse       RoutingError = 8
+	RoutingErrorDutyCycleLimit   RoutingError = 9
+	RoutingErrorBadRequest       RoutingError = 32
+	RoutingErrorNotAuthorized    RoutingError = 33
+	RoutingErrorPKIFailed        RoutingError = 34
+	RoutingErrorPKIUnknownPubkey RoutingError = 35
+)
+
+// String returns the string representation of the routing error
+func (e RoutingError) String() string {
+	names := map[RoutingError]string{
+		RoutingErrorNone:             "NONE",
+		RoutingErrorNoRoute:          "NO_ROUTE",
+		RoutingErrorGotNak:           "GOT_NAK",
+		RoutingErrorTimeout:          "TIMEOUT",
+		RoutingErrorNoInterface:      "NO_INTERFACE",
+		RoutingErrorMaxRetransmit:    "MAX_RETRANSMIT",
+		RoutingErrorNoChannel:        "NO_CHANNEL",
+		RoutingErrorTooLarge:         "TOO_LARGE",
+		RoutingErrorNoResponse:       "NO_RESPONSE",
+		RoutingErrorDutyCycleLimit:   "DUTY_CYCLE_LIMIT",
+		RoutingErrorBadRequest:       "BAD_REQUEST",
+		RoutingErrorNotAuthorized:    "NOT_AUTHORIZED",
+		RoutingErrorPKIFailed:        "PKI_FAILED",
+		RoutingErrorPKIUnknownPubkey: "PKI_UNKNOWN_PUBKEY",
+	}
+	if name, ok := names[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("ERROR_%d", uint32(e))
+}
+
+// ParseRoutingError extracts the error_reason from a Routing message
+func ParseRoutingError(data []byte) (RoutingError, error) {
+	var reason RoutingError
+	pos := 0
+
+	for pos < len(data) {
+		tag, n := decodeVarint(data[pos:])
+		if n == 0 {
+			return 0, ErrInvalidProtobuf
+		}
+		pos += n
+		fieldNum := tag >> 3
+
+		switch tag & 0x07 {
+		case 0: // Varint
+			val, n := decodeVarint(data[pos:])
+			if n == 0 {
+				return 0, ErrInvalidProtobuf
+			}
+			pos += n
+			if fieldNum == 3 {
+				reason = RoutingError(val)
+			}
+
+		case 2: // Length-delimited (route_request, route_reply)
+			length, n := decodeVarint(data[pos:])
+			pos += n
+			if n == 0 || length > uint64(len(data)-pos) {
+				return 0, ErrInvalidProtobuf
+			}
+			pos += int(length)
+
+		default:
+			return 0, ErrUnsupportedType
+		}
+	}
+
+	if pos > len(data) {
+		return 0, ErrInvalidProtobuf
+	}
+	return reason, nil
+}
@@ -0,0 +1,51 @@
+package meshtastic
+
+// DetectionEvent is the payload of DETECTION_SENSOR_APP packets. The
+// firmware sends the configured alert text, e.g. "Motion detected".
+type DetectionEvent struct {
+	Text string
+}
+
+// Paxcount is the payload of PAXCOUNTER_APP packets
+type Paxcount struct {
+	// Wifi is the number of WiFi devices seen
+	Wifi uint32
+	// Ble is the number of Bluetooth devices seen
+	Ble uint32
+	// Uptime is the sender's uptime in seconds
+	Uptime uint32
+}
+
+// parsePaxcount parses a Paxcount from protobuf bytes
+func parsePaxcount(data []byte) (*Paxcount, error) {
+	pc := &Paxcount{}
+	pos := 0
+
+	for pos < len(data) {
+		tag, n := decodeVarint(data[pos:])
+		if n == 0 {
+			return nil, ErrInvalidProtobuf
+		}
+		pos += n
+
+		if tag&0x07 != 0 {
+			return nil, ErrUnsupportedType
+		}
+		val, n := decodeVarint(data[pos:])
+		if n == 0 {
+			return nil, ErrInvalidProtobuf
+		}
+		pos += n
+
+		switch tag >> 3 {
+		case 1:
+			pc.Wifi = uint32(val)
+		case 2:
+			pc.Ble = uint32(val)
+		case 3:
+			pc.Uptime = uint32(val)
+		}
+	}
+
+	return pc, nil
+}
@@ -4,9 +4,11 @@ package simulator
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
+	"net"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -15,6 +17,10 @@ import (
 	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
 )
 
+// errNoClient is returned for packets sent in TCP mode while no client is
+// connected
+var errNoClient = errors.New("no client connected")
+
 // DeviceConfig holds configuration for the simulated device
 type DeviceConfig struct {
 	// NodeNum is this device's node number
@@ -25,6 +31,8 @@ type DeviceConfig struct {
 	ShortName string
 	// HWModel is the hardware model ID
 	HWModel uint32
+	// FirmwareVersion is reported in the device metadata
+	FirmwareVersion string
 	// Latitude in degrees
 	Latitude float64
 	// Longitude in degrees
@@ -37,6 +45,11 @@ type DeviceConfig struct {
 	MessageInterval time.Duration
 	// Verbose enables verbose logging
 	Verbose bool
+	// Seed makes packet IDs, signal values, and impairments repeat from
+	// run to run (0 = random)
+	Seed int64
+	// Impairments degrade the link to the client
+	Impairments Impairments
 }
 
 // SimulatedNode represents another node in the simulated mesh
@@ -53,13 +66,14 @@ type SimulatedNode struct {
 // DefaultConfig returns a default device configuration
 func DefaultConfig() DeviceConfig {
 	return DeviceConfig{
-		NodeNum:   0x12345678,
-		LongName:  "Simulated Node",
-		ShortName: "SIM1",
-		HWModel:   9, // TBEAM
-		Latitude:  37.7749,
-		Longitude: -122.4194,
-		Altitude:  10,
+		NodeNum:         0x12345678,
+		LongName:        "Simulated Node",
+		ShortName:       "SIM1",
+		HWModel:         9, // TBEAM
+		Latitude:        37.7749,
+		Longitude:       -122.4194,
+		Altitude:        10,
+		FirmwareVersion: "2.5.0.sim",
 		SimulatedNodes: []SimulatedNode{
 			{
 				NodeNum:   0xAABBCCDD,
@@ -84,18 +98,38 @@ func DefaultConfig() DeviceConfig {
 	}
 }
 
+// link is the byte stream to the client: the PTY master, or a TCP
+// connection
+type link interface {
+	io.ReadWriter
+	SetReadDeadline(t time.Time) error
+}
+
 // Device simulates a Meshtastic device
 type Device struct {
 	config DeviceConfig
 	pty    *PTY
-	framer *meshtastic.StreamFramer
 	logger func(format string, args ...interface{})
 
+	// In TCP mode, the listener and the client being served
+	listener net.Listener
+	client   net.Conn
+
+	// link and framer are replaced when a TCP client connects
+	link   atomic.Pointer[link]
+	framer atomic.Pointer[meshtastic.StreamFramer]
+
 	mu         sync.RWMutex
 	running    bool
 	stopCh     chan struct{}
 	packetID   atomic.Uint32
 	configSent bool
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+
+	// writeMu keeps impaired frames in order while they are delayed
+	writeMu sync.Mutex
 }
 
 // New creates a new simulated device
@@ -112,7 +146,12 @@ func New(config *DeviceConfig) *Device {
 		logger: logger,
 		stopCh: make(chan struct{}),
 	}
-	d.packetID.Store(uint32(rand.Intn(10000)))
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	d.rand = rand.New(rand.NewSource(seed))
+	d.packetID.Store(uint32(d.intn(10000)))
 	return d
 }
 
@@ -122,7 +161,7 @@ func (d *Device) Start(ctx context.Context) (string, error) {
 	defer d.mu.Unlock()
 
 	if d.running {
-		return d.pty.SlavePath, nil
+		return d.path(), nil
 	}
 
 	// Create PTY
@@ -132,21 +171,106 @@ func (d *Device) Start(ctx context.Context) (string, error) {
 	}
 
 	d.pty = pty
-	d.framer = meshtastic.NewStreamFramer(pty.Master, pty.Master)
+	d.setLink(pty.Master)
+	d.start(ctx)
+
+	d.logger("Device started on %s", pty.SlavePath)
+	return pty.SlavePath, nil
+}
+
+// StartTCP starts the simulated device listening on addr, speaking the
+// same framed protocol as a node's TCP API on port 4403, and returns the
+// address it listens on. Like a node, it serves one client at a time: a
+// new connection replaces the current one and requests the config again.
+func (d *Device) StartTCP(ctx context.Context, addr string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.running {
+		return d.path(), nil
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	d.listener = ln
+	d.start(ctx)
+	go d.acceptLoop(ln)
+
+	d.logger("Device listening on %s", ln.Addr())
+	return ln.Addr().String(), nil
+}
+
+// start marks the device running and starts its loops; d.mu is held
+func (d *Device) start(ctx context.Context) {
 	d.running = true
 	d.stopCh = make(chan struct{})
 	d.configSent = false
 
 	// Start the read loop
-	go d.readLoop(ctx)
+	go d.readLoop(ctx, d.stopCh)
 
 	// Start the message generator if interval is set
 	if d.config.MessageInterval > 0 {
 		go d.messageLoop(ctx)
 	}
+}
 
-	d.logger("Device started on %s", pty.SlavePath)
-	return pty.SlavePath, nil
+// setLink makes the device talk to the client over l
+func (d *Device) setLink(l link) {
+	d.link.Store(&l)
+	d.framer.Store(meshtastic.NewStreamFramer(l, l))
+}
+
+// currentLink returns the stream to the client, or nil without one
+func (d *Device) currentLink() link {
+	if l := d.link.Load(); l != nil {
+		return *l
+	}
+	return nil
+}
+
+// acceptLoop serves each TCP client in turn until the listener closes
+func (d *Device) acceptLoop(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+
+		d.mu.Lock()
+		if !d.running {
+			d.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		if d.client != nil {
+			d.logger("Replacing client %s", d.client.RemoteAddr())
+			_ = d.client.Close()
+		}
+		d.client = conn
+		d.configSent = false
+		d.setLink(conn)
+		d.mu.Unlock()
+
+		d.logger("Client connected from %s", conn.RemoteAddr())
+	}
+}
+
+// dropClient forgets a TCP client that has disconnected
+func (d *Device) dropClient(l link) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client == nil || link(d.client) != l {
+		return
+	}
+	d.logger("Client %s disconnected", d.client.RemoteAddr())
+	_ = d.client.Close()
+	d.client = nil
+	d.link.Store(nil)
+	d.framer.Store(nil)
 }
 
 // Stop stops the simulated device
@@ -166,6 +290,16 @@ func (d *Device) Stop() error {
 		_ = d.pty.Close()
 		d.pty = nil
 	}
+	if d.listener != nil {
+		_ = d.listener.Close()
+		d.listener = nil
+	}
+	if d.client != nil {
+		_ = d.client.Close()
+		d.client = nil
+	}
+	d.link.Store(nil)
+	d.framer.Store(nil)
 
 	return nil
 }
@@ -175,12 +309,28 @@ func (d *Device) Config() DeviceConfig {
 	return d.config
 }
 
-// GetPath returns the path to the slave PTY device
+// ConfigSent reports whether the device has answered a config request
+func (d *Device) ConfigSent() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.configSent
+}
+
+// GetPath returns the path to the slave PTY device, or in TCP mode the
+// address the device listens on
 func (d *Device) GetPath() string {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
-	if d.pty != nil {
+	return d.path()
+}
+
+// path is GetPath with d.mu held
+func (d *Device) path() string {
+	switch {
+	case d.pty != nil:
 		return d.pty.SlavePath
+	case d.listener != nil:
+		return d.listener.Addr().String()
 	}
 	return ""
 }
@@ -213,7 +363,7 @@ func (d *Device) SendPosition(fromNode uint32, lat, lon float64, alt int32) erro
 	return d.sendFromRadio(packet, nil, nil, 0)
 }
 
-func (d *Device) readLoop(ctx context.Context) {
+func (d *Device) readLoop(ctx context.Context, stopCh chan struct{}) {
 	d.logger("Starting read loop")
 
 	for {
@@ -221,21 +371,40 @@ func (d *Device) readLoop(ctx context.Context) {
 		select {
 		case <-ctx.Done():
 			return
-		case <-d.stopCh:
+		case <-stopCh:
 			return
 		default:
 		}
 
+		// Stop may release the PTY while we are between reads, and in
+		// TCP mode there may be no client yet
+		l, framer := d.currentLink(), d.framer.Load()
+		if l == nil || framer == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stopCh:
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+			continue
+		}
+
 		// Use short deadline to allow checking stop conditions
 		// but still allow blocking reads to work
-		_ = d.pty.Master.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		_ = l.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
 
-		data, err := d.framer.ReadPacket()
+		data, err := framer.ReadPacket()
 		if err != nil {
 			// Expected errors - just retry
 			if isExpectedError(err) {
 				continue
 			}
+			// A TCP client hung up
+			if _, ok := l.(net.Conn); ok && (errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed)) {
+				d.dropClient(l)
+				continue
+			}
 			// Log unexpected errors
 			if d.config.Verbose && err.Error() != "EOF" {
 				d.logger("ReadPacket error: %v", err)
@@ -293,12 +462,10 @@ func (d *Device) handleToRadio(data []byte) {
 	}
 }
 
+// sendConfig answers a config request. Like a node, the device answers
+// every request, so a client can repeat one whose answer was lost.
 func (d *Device) sendConfig(configID uint32) {
 	d.mu.Lock()
-	if d.configSent {
-		d.mu.Unlock()
-		return
-	}
 	d.configSent = true
 	d.mu.Unlock()
 
@@ -308,7 +475,23 @@ func (d *Device) sendConfig(configID uint32) {
 	myInfo := EncodeMyNodeInfo(d.config.NodeNum, 1)
 	_ = d.sendFromRadio(nil, myInfo, nil, 0)
 
-	// Send our own NodeInfo
+	// Send the device metadata
+	metadata := EncodeDeviceMetadata(d.config.FirmwareVersion, d.config.HWModel, 0, false, true)
+	_ = d.writePacket(EncodeMetadataFromRadio(d.packetID.Add(1), metadata))
+
+	// Send our own NodeInfo and the other nodes
+	for _, nodeInfo := range d.nodeInfos() {
+		_ = d.sendFromRadio(nil, nil, nodeInfo, 0)
+	}
+
+	// Send config complete
+	_ = d.sendFromRadio(nil, nil, nil, configID)
+
+	d.logger("Configuration sent")
+}
+
+// nodeInfos encodes NodeInfo messages for this device and the simulated mesh
+func (d *Device) nodeInfos() [][]byte {
 	user := EncodeUser(
 		fmt.Sprintf("!%08x", d.config.NodeNum),
 		d.config.LongName,
@@ -321,10 +504,8 @@ func (d *Device) sendConfig(configID uint32) {
 		d.config.Altitude,
 		uint32(time.Now().Unix()),
 	)
-	nodeInfo := EncodeNodeInfo(d.config.NodeNum, user, position, 0, uint32(time.Now().Unix()))
-	_ = d.sendFromRadio(nil, nil, nodeInfo, 0)
+	infos := [][]byte{EncodeNodeInfo(d.config.NodeNum, user, position, 0, uint32(time.Now().Unix()))}
 
-	// Send other nodes
 	for _, node := range d.config.SimulatedNodes {
 		user := EncodeUser(
 			fmt.Sprintf("!%08x", node.NodeNum),
@@ -336,22 +517,18 @@ func (d *Device) sendConfig(configID uint32) {
 			int32(node.Latitude*1e7),
 			int32(node.Longitude*1e7),
 			node.Altitude,
-			uint32(time.Now().Unix()-int64(rand.Intn(3600))),
+			uint32(time.Now().Unix()-int64(d.intn(3600))),
 		)
-		nodeInfo := EncodeNodeInfo(
+		infos = append(infos, EncodeNodeInfo(
 			node.NodeNum,
 			user,
 			position,
-			float32(rand.Intn(20)-10),
-			uint32(time.Now().Unix()-int64(rand.Intn(600))),
-		)
-		_ = d.sendFromRadio(nil, nil, nodeInfo, 0)
+			float32(d.intn(20)-10),
+			uint32(time.Now().Unix()-int64(d.intn(600))),
+		))
 	}
 
-	// Send config complete
-	_ = d.sendFromRadio(nil, nil, nil, configID)
-
-	d.logger("Configuration sent")
+	return infos
 }
 
 func (d *Device) sendFromRadio(packet, myInfo, nodeInfo []byte, configCompleteID uint32) error {
@@ -359,7 +536,94 @@ func (d *Device) sendFromRadio(packet, myInfo, nodeInfo []byte, configCompleteID
 	fromRadio := EncodeFromRadio(packetID, packet, myInfo, nodeInfo, configCompleteID)
 
 	d.logger("Sending FromRadio: %d bytes", len(fromRadio))
-	return d.framer.WritePacket(fromRadio)
+	return d.writePacket(fromRadio)
+}
+
+// writePacket frames data to the client, through the impairments when
+// any are set
+func (d *Device) writePacket(data []byte) error {
+	framer := d.framer.Load()
+	if framer == nil {
+		return errNoClient
+	}
+	if !d.config.Impairments.Enabled() {
+		return framer.WritePacket(data)
+	}
+
+	l := d.currentLink()
+	if l == nil {
+		return errNoClient
+	}
+	frames, delays := d.impair(Frame(data))
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	for i, frame := range frames {
+		if delays[i] > 0 {
+			time.Sleep(delays[i])
+		}
+		if _, err := l.Write(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendNodeInfo broadcasts a NODEINFO_APP packet announcing a node's user info
+func (d *Device) SendNodeInfo(fromNode uint32, longName, shortName string, hwModel uint32) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if !d.running {
+		return fmt.Errorf("device not running")
+	}
+
+	user := EncodeUser(fmt.Sprintf("!%08x", fromNode), longName, shortName, hwModel)
+	data := EncodeData(4, user) // PortNum 4 = NODEINFO_APP
+	packet := EncodeMeshPacket(
+		fromNode,
+		0xFFFFFFFF, // Broadcast
+		0,          // Channel
+		d.packetID.Add(1),
+		data,
+		uint32(time.Now().Unix()),
+		float32(d.intn(20)-5),
+		int32(-60-d.intn(40)),
+		3,
+	)
+	return d.sendFromRadio(packet, nil, nil, 0)
+}
+
+// SendDetection simulates a detection sensor alert from a node
+func (d *Device) SendDetection(fromNode uint32, text string) error {
+	return d.sendModulePacket(fromNode, 10, []byte(text)) // PortNum 10 = DETECTION_SENSOR_APP
+}
+
+// SendPaxcount simulates a paxcounter report from a node
+func (d *Device) SendPaxcount(fromNode, wifi, ble, uptime uint32) error {
+	return d.sendModulePacket(fromNode, 34, EncodePaxcount(wifi, ble, uptime)) // PortNum 34 = PAXCOUNTER_APP
+}
+
+// sendModulePacket broadcasts a module payload from a node
+func (d *Device) sendModulePacket(fromNode, portNum uint32, payload []byte) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if !d.running {
+		return fmt.Errorf("device not running")
+	}
+
+	packet := EncodeMeshPacket(
+		fromNode,
+		0xFFFFFFFF, // Broadcast
+		0,          // Channel
+		d.packetID.Add(1),
+		EncodeData(portNum, payload),
+		uint32(time.Now().Unix()),
+		float32(d.intn(20)-5),
+		int32(-60-d.intn(40)),
+		3,
+	)
+	return d.sendFromRadio(packet, nil, nil, 0)
 }
 
 func (d *Device) createTextMessagePacket(fromNode uint32, text string, packetID uint32) []byte {
@@ -374,9 +638,9 @@ func (d *Device) createTextMessagePacket(fromNode uint32, text string, packetID
 		packetID,
 		data,
 		uint32(time.Now().Unix()),
-		float32(rand.Intn(20)-5), // SNR
-		int32(-60-rand.Intn(40)), // RSSI
-		3,                        // HopLimit
+		float32(d.intn(20)-5), // SNR
+		int32(-60-d.intn(40)), // RSSI
+		3,                     // HopLimit
 	)
 
 	return packet
@@ -402,31 +666,61 @@ func (d *Device) createPositionPacket(fromNode uint32, lat, lon float64, alt int
 		packetID,
 		data,
 		uint32(time.Now().Unix()),
-		float32(rand.Intn(20)-5),
-		int32(-60-rand.Intn(40)),
+		float32(d.intn(20)-5),
+		int32(-60-d.intn(40)),
 		3,
 	)
 
 	return packet
 }
 
+// sampleMessages are the texts simulated nodes send
+var sampleMessages = []string{
+	"Hello from the mesh!",
+	"Testing 1 2 3",
+	"Meshtastic is awesome!",
+	"Anyone copy?",
+	"Good morning mesh!",
+	"Signal check",
+	"Weather is nice today",
+	"73s de simulated node",
+}
+
+// Samples returns encoded FromRadio messages like those the device sends
+// once running: NodeInfo for every node, followed by n packets alternating
+// between text messages and positions from the simulated nodes. The device
+// does not need to be started.
+func (d *Device) Samples(n int) [][]byte {
+	var samples [][]byte
+	for _, nodeInfo := range d.nodeInfos() {
+		samples = append(samples, EncodeFromRadio(d.packetID.Add(1), nil, nil, nodeInfo, 0))
+	}
+
+	nodes := d.config.SimulatedNodes
+	if len(nodes) == 0 {
+		return samples
+	}
+
+	for i := 0; i < n; i++ {
+		node := nodes[i%len(nodes)]
+		var packet []byte
+		if i%2 == 0 {
+			packet = d.createTextMessagePacket(node.NodeNum, sampleMessages[i%len(sampleMessages)], d.packetID.Add(1))
+		} else {
+			packet = d.createPositionPacket(node.NodeNum, node.Latitude, node.Longitude, node.Altitude, d.packetID.Add(1))
+		}
+		samples = append(samples, EncodeFromRadio(d.packetID.Add(1), packet, nil, nil, 0))
+	}
+
+	return samples
+}
+
 func (d *Device) messageLoop(ctx context.Context) {
 	d.logger("Starting message loop (interval=%v)", d.config.MessageInterval)
 
 	ticker := time.NewTicker(d.config.MessageInterval)
 	defer ticker.Stop()
 
-	messages := []string{
-		"Hello from the mesh!",
-		"Testing 1 2 3",
-		"Meshtastic is awesome!",
-		"Anyone copy?",
-		"Good morning mesh!",
-		"Signal check",
-		"Weather is nice today",
-		"73s de simulated node",
-	}
-
 	for {
 		select {
 		case <-ctx.Done():
@@ -436,8 +730,8 @@ func (d *Device) messageLoop(ctx context.Context) {
 		case <-ticker.C:
 			// Pick a random node and message
 			if len(d.config.SimulatedNodes) > 0 {
-				node := d.config.SimulatedNodes[rand.Intn(len(d.config.SimulatedNodes))]
-				msg := messages[rand.Intn(len(messages))]
+				node := d.config.SimulatedNodes[d.intn(len(d.config.SimulatedNodes))]
+				msg := sampleMessages[d.intn(len(sampleMessages))]
 
 				d.logger("Sending message from %s: %s", node.ShortName, msg)
 				_ = d.SendTextMessage(node.NodeNum, msg)
@@ -446,6 +740,13 @@ func (d *Device) messageLoop(ctx context.Context) {
 	}
 }
 
+// intn returns a random number in [0, n) from the device's source
+func (d *Device) intn(n int) int {
+	d.randMu.Lock()
+	defer d.randMu.Unlock()
+	return d.rand.Intn(n)
+}
+
 func decodeVarint(data []byte) (val uint64, bytesRead int) {
 	var shift uint
 	for i, b := range data {
@@ -487,16 +788,17 @@ func (d *Device) ReadRaw(buf []byte) (int, error) {
 	return d.pty.Master.Read(buf)
 }
 
-// WriteFramedPacket writes a framed packet to the master end
+// WriteFramedPacket writes a framed packet to the master end, or in TCP
+// mode to the client
 func (d *Device) WriteFramedPacket(data []byte) error {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 
-	if d.framer == nil {
+	if !d.running {
 		return fmt.Errorf("device not started")
 	}
 
-	return d.framer.WritePacket(data)
+	return d.writePacket(data)
 }
 
 // MasterReader returns an io.Reader for the master end
@@ -84,6 +84,29 @@ func EncodeMyNodeInfo(nodeNum, rebootCount uint32) []byte {
 	return msg
 }
 
+// EncodeDeviceMetadata encodes a DeviceMetadata message
+func EncodeDeviceMetadata(firmware string, hwModel, role uint32, wifi, bluetooth bool) []byte {
+	var msg []byte
+	msg = append(msg, encodeString(1, firmware)...) // firmware_version
+	if wifi {
+		msg = append(msg, encodeUint32(4, 1)...) // hasWifi
+	}
+	if bluetooth {
+		msg = append(msg, encodeUint32(5, 1)...) // hasBluetooth
+	}
+	msg = append(msg, encodeUint32(7, role)...)    // role
+	msg = append(msg, encodeUint32(9, hwModel)...) // hw_model
+	return msg
+}
+
+// EncodeMetadataFromRadio encodes a FromRadio message carrying device metadata
+func EncodeMetadataFromRadio(id uint32, metadata []byte) []byte {
+	var msg []byte
+	msg = append(msg, encodeUint32(1, id)...)
+	msg = append(msg, encodeBytes(13, metadata)...)
+	return msg
+}
+
 // EncodeUser encodes a User message
 func EncodeUser(id, longName, shortName string, hwModel uint32) []byte {
 	var msg []byte
@@ -106,6 +129,15 @@ func EncodePosition(latitudeI, longitudeI, altitude int32, timestamp uint32) []b
 	return msg
 }
 
+// EncodePaxcount encodes a Paxcount message
+func EncodePaxcount(wifi, ble, uptime uint32) []byte {
+	var msg []byte
+	msg = append(msg, encodeUint32(1, wifi)...)
+	msg = append(msg, encodeUint32(2, ble)...)
+	msg = append(msg, encodeUint32(3, uptime)...)
+	return msg
+}
+
 // EncodeNodeInfo encodes a NodeInfo message
 func EncodeNodeInfo(num uint32, user, position []byte, snr float32, lastHeard uint32) []byte {
 	var msg []byte
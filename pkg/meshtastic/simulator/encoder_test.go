@@ -58,6 +58,26 @@ func TestEncodeMyNodeInfo(t *testing.T) {
 	}
 }
 
+func TestEncodeDeviceMetadata(t *testing.T) {
+	data := EncodeDeviceMetadata("2.5.0.abc", 9, 2, true, false)
+
+	result, err := meshtastic.ParseFromRadio(EncodeMetadataFromRadio(1, data))
+	if err != nil {
+		t.Fatalf("Failed to parse encoded DeviceMetadata: %v", err)
+	}
+
+	md := result.Metadata
+	if md == nil {
+		t.Fatal("Metadata is nil")
+	}
+	if md.FirmwareVersion != "2.5.0.abc" || md.HwModel != 9 || !md.HasWifi || md.HasBluetooth {
+		t.Errorf("Unexpected metadata: %+v", md)
+	}
+	if name := meshtastic.RoleName(md.Role); name != "ROUTER" {
+		t.Errorf("Expected role ROUTER, got %s", name)
+	}
+}
+
 func TestEncodeUser(t *testing.T) {
 	id := "!12345678"
 	longName := "Test Node"
@@ -0,0 +1,126 @@
+package simulator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Impairments degrade the link from the device to the client, to test the
+// client's framer resync, config retries, and dedup under adverse
+// conditions. Percentages apply to each frame independently; with
+// DeviceConfig.Seed set the same frames are impaired every run.
+type Impairments struct {
+	// Loss is the percentage of frames dropped
+	Loss float64 `yaml:"loss"`
+	// Duplicate is the percentage of frames sent twice
+	Duplicate float64 `yaml:"duplicate"`
+	// Corrupt is the percentage of frames with a random byte changed,
+	// header included
+	Corrupt float64 `yaml:"corrupt"`
+	// Truncate is the percentage of frames cut short, so the client reads
+	// the start of the next frame as the rest of the payload
+	Truncate float64 `yaml:"truncate"`
+	// Latency delays every frame
+	Latency time.Duration `yaml:"latency"`
+	// Jitter adds a random delay up to this to every frame
+	Jitter time.Duration `yaml:"jitter"`
+}
+
+// Enabled reports whether any impairment is set
+func (im Impairments) Enabled() bool {
+	return im != Impairments{}
+}
+
+// Validate checks that percentages are within 0-100 and delays are not
+// negative
+func (im Impairments) Validate() error {
+	for _, p := range []struct {
+		name  string
+		value float64
+	}{{"loss", im.Loss}, {"duplicate", im.Duplicate}, {"corrupt", im.Corrupt}, {"truncate", im.Truncate}} {
+		if p.value < 0 || p.value > 100 {
+			return fmt.Errorf("%s must be a percentage from 0 to 100", p.name)
+		}
+	}
+	if im.Latency < 0 || im.Jitter < 0 {
+		return fmt.Errorf("latency and jitter must not be negative")
+	}
+	return nil
+}
+
+// String describes the impairments, e.g. "loss 5%, jitter 200ms"
+func (im Impairments) String() string {
+	var parts []string
+	for _, p := range []struct {
+		name  string
+		value float64
+	}{{"loss", im.Loss}, {"duplicate", im.Duplicate}, {"corrupt", im.Corrupt}, {"truncate", im.Truncate}} {
+		if p.value > 0 {
+			parts = append(parts, fmt.Sprintf("%s %g%%", p.name, p.value))
+		}
+	}
+	if im.Latency > 0 {
+		parts = append(parts, fmt.Sprintf("latency %s", im.Latency))
+	}
+	if im.Jitter > 0 {
+		parts = append(parts, fmt.Sprintf("jitter %s", im.Jitter))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// chance reports true for percent of calls
+func (d *Device) chance(percent float64) bool {
+	if percent <= 0 {
+		return false
+	}
+	d.randMu.Lock()
+	defer d.randMu.Unlock()
+	return d.rand.Float64()*100 < percent
+}
+
+// impair returns the frames to write in place of frame, each with the
+// delay before it: none when it is lost, two when it is duplicated
+func (d *Device) impair(frame []byte) (frames [][]byte, delays []time.Duration) {
+	im := d.config.Impairments
+	if d.chance(im.Loss) {
+		d.logger("Impairment: dropped a %d byte frame", len(frame))
+		return nil, nil
+	}
+
+	if d.chance(im.Corrupt) {
+		frame = append([]byte(nil), frame...)
+		i := d.intn(len(frame))
+		frame[i] ^= byte(1 + d.intn(255))
+		d.logger("Impairment: corrupted byte %d of a %d byte frame", i, len(frame))
+	}
+	if len(frame) > 1 && d.chance(im.Truncate) {
+		n := 1 + d.intn(len(frame)-1)
+		d.logger("Impairment: truncated a %d byte frame to %d", len(frame), n)
+		frame = frame[:n]
+	}
+
+	frames = [][]byte{frame}
+	if d.chance(im.Duplicate) {
+		d.logger("Impairment: duplicated a %d byte frame", len(frame))
+		frames = append(frames, frame)
+	}
+	for range frames {
+		delay := im.Latency
+		if im.Jitter > 0 {
+			delay += time.Duration(d.int63n(int64(im.Jitter) + 1))
+		}
+		delays = append(delays, delay)
+	}
+	return frames, delays
+}
+
+// int63n returns a random number in [0, n) from the device's source
+func (d *Device) int63n(n int64) int64 {
+	d.randMu.Lock()
+	defer d.randMu.Unlock()
+	return d.rand.Int63n(n)
+}
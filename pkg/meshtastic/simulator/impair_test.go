@@ -0,0 +1,123 @@
+package simulator
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
+)
+
+func TestImpair(t *testing.T) {
+	frame := Frame([]byte("a packet payload"))
+	impaired := func(im Impairments) *Device {
+		cfg := DefaultConfig()
+		cfg.Seed = 1
+		cfg.Impairments = im
+		return New(&cfg)
+	}
+
+	if frames, _ := impaired(Impairments{Loss: 100}).impair(frame); len(frames) != 0 {
+		t.Errorf("loss 100%%: %d frames", len(frames))
+	}
+
+	frames, _ := impaired(Impairments{Corrupt: 100}).impair(frame)
+	if len(frames) != 1 || len(frames[0]) != len(frame) || bytes.Equal(frames[0], frame) {
+		t.Errorf("corrupt 100%%: %v", frames)
+	}
+	diff := 0
+	for i := range frame {
+		if frames[0][i] != frame[i] {
+			diff++
+		}
+	}
+	if diff != 1 {
+		t.Errorf("corrupt 100%%: %d bytes changed, want 1", diff)
+	}
+
+	frames, _ = impaired(Impairments{Truncate: 100}).impair(frame)
+	if len(frames) != 1 || len(frames[0]) >= len(frame) || !bytes.HasPrefix(frame, frames[0]) {
+		t.Errorf("truncate 100%%: %v", frames)
+	}
+
+	frames, delays := impaired(Impairments{Duplicate: 100, Latency: 50 * time.Millisecond, Jitter: 10 * time.Millisecond}).impair(frame)
+	if len(frames) != 2 || !bytes.Equal(frames[0], frame) || !bytes.Equal(frames[1], frame) {
+		t.Errorf("duplicate 100%%: %v", frames)
+	}
+	for _, d := range delays {
+		if d < 50*time.Millisecond || d > 60*time.Millisecond {
+			t.Errorf("delay %s, want 50-60ms", d)
+		}
+	}
+
+	// The same seed impairs the same frames
+	im := Impairments{Loss: 30, Corrupt: 30}
+	a, b := impaired(im), impaired(im)
+	for i := 0; i < 50; i++ {
+		fa, _ := a.impair(frame)
+		fb, _ := b.impair(frame)
+		if len(fa) != len(fb) || len(fa) == 1 && !bytes.Equal(fa[0], fb[0]) {
+			t.Fatalf("frame %d impaired differently with the same seed", i)
+		}
+	}
+}
+
+func TestImpairmentsValidate(t *testing.T) {
+	for _, im := range []Impairments{{Loss: -1}, {Corrupt: 101}, {Jitter: -time.Second}} {
+		if err := im.Validate(); err == nil {
+			t.Errorf("%+v: no error", im)
+		}
+	}
+	im := Impairments{Loss: 5, Jitter: 200 * time.Millisecond}
+	if err := im.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+	if s := im.String(); s != "loss 5%, jitter 200ms" {
+		t.Errorf("String = %q", s)
+	}
+	if s := (Impairments{}).String(); s != "none" {
+		t.Errorf("String = %q", s)
+	}
+}
+
+func TestImpairedLink(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MessageInterval = 0
+	cfg.Impairments = Impairments{Latency: 100 * time.Millisecond}
+	device := NewTestDeviceWithConfig(t, &cfg)
+	defer device.Stop()
+
+	conn, err := net.Dial("tcp", device.StartTCP())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	framer := meshtastic.NewStreamFramer(conn, conn)
+
+	// A repeated request is answered again, as a client retrying after a
+	// lost frame needs
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		if err := framer.WritePacket([]byte{0x18, 0x01}); err != nil { // WantConfig
+			t.Fatalf("WritePacket: %v", err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for first := true; ; first = false {
+			data, err := framer.ReadPacket()
+			if err != nil {
+				t.Fatalf("request %d: ReadPacket: %v", i, err)
+			}
+			if first && time.Since(start) < 100*time.Millisecond {
+				t.Errorf("request %d: first frame after %s, want at least 100ms", i, time.Since(start))
+			}
+			fr, err := meshtastic.ParseFromRadio(data)
+			if err != nil {
+				t.Fatalf("request %d: ParseFromRadio: %v", i, err)
+			}
+			if fr.ConfigCompleteID != 0 {
+				break
+			}
+		}
+	}
+}
@@ -4,11 +4,15 @@ package simulator
 
 import (
 	"bytes"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"go.bug.st/serial"
+
+	"github.com/iamruinous/meshtastic-message-relay/pkg/meshtastic"
 )
 
 func TestPTYBidirectional(t *testing.T) {
@@ -420,3 +424,98 @@ func (f *testStreamFramer) WritePacket(data []byte) error {
 	_, err := f.writer.Write(packet)
 	return err
 }
+
+func TestPlayScenario(t *testing.T) {
+	sc, err := ParseScenario([]byte(`
+seed: 1
+nodes:
+  - {id: "!aabbccdd", short_name: HIK}
+events:
+  - {at: 0s, text: "hello"}
+  - {at: 20ms, track: {every: 20ms, points: [{latitude: 1, longitude: 2}, {latitude: 3, longitude: 4}, {latitude: 5, longitude: 6}]}}
+  - {at: 30ms, join: {id: "!11223344", short_name: BASE}}
+  - {at: 50ms, silent: true}
+  - {at: 60ms, text: "never sent"}
+  - {at: 70ms, from: "!11223344", text: "bye"}
+`))
+	if err != nil {
+		t.Fatalf("ParseScenario: %v", err)
+	}
+	cfg := DefaultConfig()
+	cfg.MessageInterval = 0
+	cfg.SimulatedNodes = sc.SimulatedNodes()
+	cfg.Seed = sc.Seed
+	td := NewTestDeviceWithConfig(t, &cfg)
+	path := td.Start()
+	defer td.Stop()
+
+	port, err := serial.Open(path, &serial.Mode{BaudRate: 115200})
+	if err != nil {
+		t.Fatalf("Failed to open serial port: %v", err)
+	}
+	defer func() { _ = port.Close() }()
+	_ = port.SetReadTimeout(100 * time.Millisecond)
+	framer := meshtastic.NewStreamFramer(port, port)
+
+	played := make(chan error, 1)
+	go func() { played <- td.Play(td.Context(), sc) }()
+	if err := framer.WritePacket([]byte{0x18, 0x01}); err != nil { // WantConfig
+		t.Fatalf("Failed to request config: %v", err)
+	}
+
+	// Read in the background: the port returns no error on a timeout
+	packets := make(chan string, 16)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			data, err := framer.ReadPacket()
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err != nil {
+				continue
+			}
+			fr, err := meshtastic.ParseFromRadio(data)
+			if err != nil || fr.Packet == nil || fr.Packet.Decoded == nil {
+				continue
+			}
+			packets <- fmt.Sprintf("%08x %s", fr.Packet.From, fr.Packet.Decoded.PortNum)
+		}
+	}()
+
+	var got []string
+	timeout := time.After(5 * time.Second)
+collect:
+	for len(got) < 5 {
+		select {
+		case p := <-packets:
+			got = append(got, p)
+		case <-timeout:
+			break collect
+		}
+	}
+	// Nothing more arrives after the scenario ends
+	select {
+	case p := <-packets:
+		got = append(got, p)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := <-played; err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+
+	// The hiker's third position and last text come after it goes silent
+	want := []string{
+		"aabbccdd TEXT_MESSAGE_APP",
+		"aabbccdd POSITION_APP",
+		"11223344 NODEINFO_APP",
+		"aabbccdd POSITION_APP",
+		"11223344 TEXT_MESSAGE_APP",
+	}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("packets = %v, want %v", got, want)
+	}
+}
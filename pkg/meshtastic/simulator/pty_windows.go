@@ -8,7 +8,7 @@ import (
 )
 
 // ErrNotSupported is returned when PTY operations are attempted on Windows
-var ErrNotSupported = errors.New("PTY simulation is not supported on Windows; use virtual COM port software like com0com for serial port testing")
+var ErrNotSupported = errors.New("PTY simulation is not supported on Windows; use Device.StartTCP (simulate --tcp), or virtual COM port software like com0com for serial port testing")
 
 // PTY represents a pseudo-terminal pair
 // On Windows, this is a stub that returns errors for all operations.
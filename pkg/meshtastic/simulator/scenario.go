@@ -0,0 +1,316 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Scenario is a timeline of mesh events for the simulator to play back:
+// nodes joining, text messages, position tracks, and nodes going silent.
+// With a seed set, every run sends the same packets at the same offsets.
+type Scenario struct {
+	Name string `yaml:"name"`
+	// Seed seeds packet IDs, signal values, and impairments (0 = random)
+	Seed int64 `yaml:"seed"`
+	// Impairments degrade the link to the client for the whole scenario
+	Impairments Impairments `yaml:"impairments"`
+	// Nodes are in the mesh from the start and announced on connect
+	Nodes  []ScenarioNode `yaml:"nodes"`
+	Events []Event        `yaml:"events"`
+
+	actions []action
+}
+
+// ScenarioNode is a simulated node, by ID such as "!aabbccdd"
+type ScenarioNode struct {
+	ID        string  `yaml:"id"`
+	LongName  string  `yaml:"long_name"`
+	ShortName string  `yaml:"short_name"`
+	HWModel   uint32  `yaml:"hw_model"`
+	Latitude  float64 `yaml:"latitude"`
+	Longitude float64 `yaml:"longitude"`
+	Altitude  int32   `yaml:"altitude"`
+
+	num uint32
+}
+
+// Event is something that happens At an offset from the start of the
+// scenario. It does exactly one of: Join announces a new node, Text and
+// Position send a packet from From, Track sends a position from From every
+// Track.Every, and Silent stops From sending anything more, tracks
+// included. From defaults to the first node.
+type Event struct {
+	At       time.Duration `yaml:"at"`
+	From     string        `yaml:"from"`
+	Join     *ScenarioNode `yaml:"join"`
+	Text     string        `yaml:"text"`
+	Position *Point        `yaml:"position"`
+	Track    *Track        `yaml:"track"`
+	Silent   bool          `yaml:"silent"`
+}
+
+// Point is a position
+type Point struct {
+	Latitude  float64 `yaml:"latitude"`
+	Longitude float64 `yaml:"longitude"`
+	Altitude  int32   `yaml:"altitude"`
+}
+
+// Track is a series of positions sent one after another
+type Track struct {
+	Every  time.Duration `yaml:"every"`
+	Points []Point       `yaml:"points"`
+}
+
+// action is a packet the scenario sends, or a node going silent
+type action struct {
+	at       time.Duration
+	from     uint32
+	join     *ScenarioNode
+	text     string
+	position *Point
+	silent   bool
+}
+
+// LoadScenario reads and checks a scenario file
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %w", err)
+	}
+	sc, err := ParseScenario(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return sc, nil
+}
+
+// ParseScenario parses and checks a YAML scenario
+func ParseScenario(data []byte) (*Scenario, error) {
+	sc := &Scenario{}
+	if err := yaml.Unmarshal(data, sc); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario: %w", err)
+	}
+	if err := sc.compile(); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// compile checks the scenario and orders its actions by time
+func (sc *Scenario) compile() error {
+	if err := sc.Impairments.Validate(); err != nil {
+		return fmt.Errorf("impairments: %w", err)
+	}
+	known := make(map[uint32]bool)
+	for i := range sc.Nodes {
+		num, err := parseNodeID(sc.Nodes[i].ID)
+		if err != nil {
+			return fmt.Errorf("nodes[%d]: %w", i, err)
+		}
+		sc.Nodes[i].num = num
+		known[num] = true
+	}
+	// Joined nodes may be named by events before the join, which are
+	// checked against the timeline below
+	for i, e := range sc.Events {
+		if e.Join == nil {
+			continue
+		}
+		num, err := parseNodeID(e.Join.ID)
+		if err != nil {
+			return fmt.Errorf("events[%d].join: %w", i, err)
+		}
+		if known[num] {
+			return fmt.Errorf("events[%d].join: node %s is already in the mesh", i, e.Join.ID)
+		}
+		e.Join.num = num
+		known[num] = true
+	}
+	if len(sc.Events) == 0 {
+		return fmt.Errorf("events is empty")
+	}
+
+	sc.actions = nil
+	for i, e := range sc.Events {
+		actions := 0
+		for _, set := range []bool{e.Join != nil, e.Text != "", e.Position != nil, e.Track != nil, e.Silent} {
+			if set {
+				actions++
+			}
+		}
+		if actions != 1 {
+			return fmt.Errorf("events[%d] must have exactly one of join, text, position, track, or silent", i)
+		}
+		if e.At < 0 {
+			return fmt.Errorf("events[%d].at must not be negative", i)
+		}
+
+		var from uint32
+		switch {
+		case e.Join != nil:
+			from = e.Join.num
+		case e.From != "":
+			num, err := parseNodeID(e.From)
+			if err != nil {
+				return fmt.Errorf("events[%d]: %w", i, err)
+			}
+			if !known[num] {
+				return fmt.Errorf("events[%d]: node %s is not in nodes or joined", i, e.From)
+			}
+			from = num
+		case len(sc.Nodes) > 0:
+			from = sc.Nodes[0].num
+		default:
+			return fmt.Errorf("events[%d]: from is required without nodes", i)
+		}
+
+		a := action{at: e.At, from: from, join: e.Join, text: e.Text, position: e.Position, silent: e.Silent}
+		if e.Track == nil {
+			sc.actions = append(sc.actions, a)
+			continue
+		}
+		if e.Track.Every <= 0 || len(e.Track.Points) == 0 {
+			return fmt.Errorf("events[%d].track needs every and points", i)
+		}
+		for j := range e.Track.Points {
+			a.at = e.At + time.Duration(j)*e.Track.Every
+			a.position = &e.Track.Points[j]
+			sc.actions = append(sc.actions, a)
+		}
+	}
+	// Events at the same time keep their order in the file
+	sort.SliceStable(sc.actions, func(i, j int) bool { return sc.actions[i].at < sc.actions[j].at })
+
+	joined := make(map[uint32]bool)
+	for i := range sc.Nodes {
+		joined[sc.Nodes[i].num] = true
+	}
+	for _, a := range sc.actions {
+		if a.join != nil {
+			joined[a.from] = true
+		} else if !joined[a.from] {
+			return fmt.Errorf("node !%08x is used at %s before it joins", a.from, a.at)
+		}
+	}
+	return nil
+}
+
+// Duration returns the offset of the scenario's last event
+func (sc *Scenario) Duration() time.Duration {
+	if len(sc.actions) == 0 {
+		return 0
+	}
+	return sc.actions[len(sc.actions)-1].at
+}
+
+// SimulatedNodes returns the nodes in the mesh from the start
+func (sc *Scenario) SimulatedNodes() []SimulatedNode {
+	nodes := make([]SimulatedNode, len(sc.Nodes))
+	for i := range sc.Nodes {
+		nodes[i] = sc.Nodes[i].simulated()
+	}
+	return nodes
+}
+
+func (n *ScenarioNode) simulated() SimulatedNode {
+	hwModel := n.HWModel
+	if hwModel == 0 {
+		hwModel = 9 // TBEAM
+	}
+	return SimulatedNode{
+		NodeNum:   n.num,
+		LongName:  n.LongName,
+		ShortName: n.ShortName,
+		HWModel:   hwModel,
+		Latitude:  n.Latitude,
+		Longitude: n.Longitude,
+		Altitude:  n.Altitude,
+	}
+}
+
+// Play waits for a client to request the device config, then sends the
+// scenario's events at their offsets from that moment. It returns once the
+// last event is sent, or with the context's error.
+func (d *Device) Play(ctx context.Context, sc *Scenario) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for !d.ConfigSent() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-d.stopCh:
+			return fmt.Errorf("device not running")
+		case <-ticker.C:
+		}
+	}
+
+	d.logger("Playing scenario %q (%d events over %s)", sc.Name, len(sc.actions), sc.Duration())
+	start := time.Now()
+	silent := make(map[uint32]bool)
+	for _, a := range sc.actions {
+		if wait := time.Until(start.Add(a.at)); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-d.stopCh:
+				return fmt.Errorf("device not running")
+			case <-time.After(wait):
+			}
+		}
+		if silent[a.from] {
+			continue
+		}
+
+		var err error
+		switch {
+		case a.silent:
+			d.logger("%s: !%08x goes silent", a.at, a.from)
+			silent[a.from] = true
+		case a.join != nil:
+			d.logger("%s: !%08x joins", a.at, a.from)
+			node := a.join.simulated()
+			err = d.SendNodeInfo(node.NodeNum, node.LongName, node.ShortName, node.HWModel)
+			if err == nil && (node.Latitude != 0 || node.Longitude != 0) {
+				err = d.SendPosition(node.NodeNum, node.Latitude, node.Longitude, node.Altitude)
+			}
+		case a.text != "":
+			d.logger("%s: !%08x says %q", a.at, a.from, a.text)
+			err = d.SendTextMessage(a.from, a.text)
+		case a.position != nil:
+			d.logger("%s: !%08x is at %.5f,%.5f", a.at, a.from, a.position.Latitude, a.position.Longitude)
+			err = d.SendPosition(a.from, a.position.Latitude, a.position.Longitude, a.position.Altitude)
+		}
+		if err != nil {
+			return fmt.Errorf("event at %s: %w", a.at, err)
+		}
+	}
+	return nil
+}
+
+// parseNodeID parses a node ID as "!aabbccdd", "0xaabbccdd", or a decimal
+// number
+func parseNodeID(s string) (uint32, error) {
+	s = strings.TrimSpace(s)
+	var n uint64
+	var err error
+	switch {
+	case strings.HasPrefix(s, "!"):
+		n, err = strconv.ParseUint(s[1:], 16, 32)
+	case strings.HasPrefix(s, "0x"), strings.HasPrefix(s, "0X"):
+		n, err = strconv.ParseUint(s[2:], 16, 32)
+	default:
+		n, err = strconv.ParseUint(s, 10, 32)
+	}
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid node id %q", s)
+	}
+	return uint32(n), nil
+}
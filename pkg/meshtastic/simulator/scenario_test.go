@@ -0,0 +1,90 @@
+package simulator
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseScenario(t *testing.T) {
+	sc, err := ParseScenario([]byte(`
+name: test
+seed: 7
+nodes:
+  - {id: "!aabbccdd", long_name: Hiker, short_name: HIK}
+events:
+  - {at: 10s, text: "second"}
+  - at: 5s
+    track:
+      every: 10s
+      points:
+        - {latitude: 1, longitude: 2}
+        - {latitude: 3, longitude: 4}
+  - {at: 5s, text: "first"}
+  - {at: 12s, join: {id: "!11223344", long_name: Base}}
+  - {at: 20s, from: "!11223344", silent: true}
+`))
+	if err != nil {
+		t.Fatalf("ParseScenario: %v", err)
+	}
+
+	// Ordered by time, with events at the same time in file order
+	var got []string
+	for _, a := range sc.actions {
+		var what string
+		switch {
+		case a.join != nil:
+			what = "join"
+		case a.silent:
+			what = "silent"
+		case a.text != "":
+			what = a.text
+		case a.position != nil:
+			what = "position"
+		}
+		got = append(got, a.at.String()+" "+what)
+	}
+	want := "5s position, 5s first, 10s second, 12s join, 15s position, 20s silent"
+	if strings.Join(got, ", ") != want {
+		t.Errorf("actions = %s, want %s", strings.Join(got, ", "), want)
+	}
+	if sc.Duration() != 20*time.Second {
+		t.Errorf("Duration = %s", sc.Duration())
+	}
+	if nodes := sc.SimulatedNodes(); len(nodes) != 1 || nodes[0].NodeNum != 0xaabbccdd || nodes[0].HWModel != 9 {
+		t.Errorf("SimulatedNodes = %+v", nodes)
+	}
+}
+
+func TestParseScenarioErrors(t *testing.T) {
+	tests := []struct {
+		name, yaml, want string
+	}{
+		{"no events", `nodes: [{id: "!aabbccdd"}]`, "events is empty"},
+		{"bad node", `{nodes: [{id: "nope"}], events: [{text: hi}]}`, "invalid node id"},
+		{"two actions", `{nodes: [{id: "!aabbccdd"}], events: [{text: hi, silent: true}]}`, "exactly one of"},
+		{"unknown sender", `{nodes: [{id: "!aabbccdd"}], events: [{from: "!11223344", text: hi}]}`, "not in nodes or joined"},
+		{"no sender", `{events: [{text: hi}]}`, "from is required"},
+		{"before join", `{events: [{at: 1s, from: "!11223344", text: hi}, {at: 2s, join: {id: "!11223344"}}]}`, "before it joins"},
+		{"joins twice", `{nodes: [{id: "!aabbccdd"}], events: [{join: {id: "!aabbccdd"}}]}`, "already in the mesh"},
+		{"empty track", `{nodes: [{id: "!aabbccdd"}], events: [{track: {every: 1s}}]}`, "needs every and points"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseScenario([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadScenarioExample(t *testing.T) {
+	sc, err := LoadScenario("../../../scenarios/simulate/hike.yaml")
+	if err != nil {
+		t.Fatalf("LoadScenario: %v", err)
+	}
+	if sc.Seed == 0 || len(sc.Nodes) != 1 || sc.Duration() != 3*time.Minute {
+		t.Errorf("scenario = %+v, duration %s", sc, sc.Duration())
+	}
+}
@@ -53,6 +53,16 @@ func (td *TestDevice) Start() string {
 	return path
 }
 
+// StartTCP starts the test device listening on a free local port and
+// returns its address
+func (td *TestDevice) StartTCP() string {
+	addr, err := td.Device.StartTCP(td.ctx, "127.0.0.1:0")
+	if err != nil {
+		td.t.Fatalf("Failed to start test device: %v", err)
+	}
+	return addr
+}
+
 // Stop stops the test device
 func (td *TestDevice) Stop() {
 	td.cancel()
@@ -0,0 +1,200 @@
+package meshtastic
+
+import "encoding/binary"
+
+// StoreForwardRR is the request/response type of a StoreAndForward message
+type StoreForwardRR uint32
+
+// Store & Forward request/response types (subset of storeforward.proto)
+const (
+	StoreForwardUnset               StoreForwardRR = 0
+	StoreForwardRouterError         StoreForwardRR = 1
+	StoreForwardRouterHeartbeat     StoreForwardRR = 2
+	StoreForwardRouterPing          StoreForwardRR = 3
+	StoreForwardRouterPong          StoreForwardRR = 4
+	StoreForwardRouterBusy          StoreForwardRR = 5
+	StoreForwardRouterHistory       StoreForwardRR = 6
+	StoreForwardRouterStats         StoreForwardRR = 7
+	StoreForwardRouterTextDirect    StoreForwardRR = 8
+	StoreForwardRouterTextBroadcast StoreForwardRR = 9
+	StoreForwardClientError         StoreForwardRR = 64
+	StoreForwardClientHistory       StoreForwardRR = 65
+	StoreForwardClientStats         StoreForwardRR = 66
+	StoreForwardClientPing          StoreForwardRR = 67
+	StoreForwardClientPong          StoreForwardRR = 68
+	StoreForwardClientAbort         StoreForwardRR = 106
+)
+
+// StoreAndForward field numbers
+const (
+	sfRR      = 1
+	sfHistory = 3
+	sfText    = 5
+)
+
+// StoreForwardHistory asks for, or describes, a history replay
+type StoreForwardHistory struct {
+	// HistoryMessages is the number of messages the server will send
+	HistoryMessages uint32
+	// Window is how far back to look, in minutes
+	Window uint32
+	// LastRequest is the index of the last message the client received
+	LastRequest uint32
+}
+
+// StoreAndForward is the payload of STORE_FORWARD_APP packets
+type StoreAndForward struct {
+	RR      StoreForwardRR
+	History *StoreForwardHistory
+	// Text holds a replayed text message for ROUTER_TEXT_* packets
+	Text []byte
+}
+
+// IsText reports whether the message carries a replayed text message
+func (sf *StoreAndForward) IsText() bool {
+	return sf.RR == StoreForwardRouterTextDirect || sf.RR == StoreForwardRouterTextBroadcast
+}
+
+// Marshal encodes the StoreAndForward message as protobuf bytes
+func (sf *StoreAndForward) Marshal() []byte {
+	var buf []byte
+	buf = appendUint32Field(buf, sfRR, uint32(sf.RR))
+	if sf.History != nil {
+		var h []byte
+		h = appendUint32Field(h, 1, sf.History.HistoryMessages)
+		h = appendUint32Field(h, 2, sf.History.Window)
+		h = appendUint32Field(h, 3, sf.History.LastRequest)
+		buf = appendPresentString(buf, sfHistory, string(h))
+	}
+	buf = appendBytesField(buf, sfText, sf.Text)
+	return buf
+}
+
+// ParseStoreAndForward parses a StoreAndForward message from protobuf bytes
+func ParseStoreAndForward(data []byte) (*StoreAndForward, error) {
+	sf := &StoreAndForward{}
+	err := walkFields(data, func(fieldNum uint64, val uint64, fieldData []byte) error {
+		switch fieldNum {
+		case sfRR:
+			sf.RR = StoreForwardRR(val)
+		case sfHistory:
+			h := &StoreForwardHistory{}
+			if err := walkFields(fieldData, func(num, v uint64, _ []byte) error {
+				switch num {
+				case 1:
+					h.HistoryMessages = uint32(v)
+				case 2:
+					h.Window = uint32(v)
+				case 3:
+					h.LastRequest = uint32(v)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			sf.History = h
+		case sfText:
+			sf.Text = fieldData
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sf, nil
+}
+
+// walkFields calls fn for each field in data. Varint and fixed-width fields
+// get their value, length-delimited fields their bytes.
+func walkFields(data []byte, fn func(fieldNum, val uint64, fieldData []byte) error) error {
+	pos := 0
+	for pos < len(data) {
+		tag, n := decodeVarint(data[pos:])
+		if n == 0 {
+			return ErrInvalidProtobuf
+		}
+		pos += n
+		fieldNum := tag >> 3
+
+		switch tag & 0x07 {
+		case 0: // Varint
+			val, n := decodeVarint(data[pos:])
+			if n == 0 {
+				return ErrInvalidProtobuf
+			}
+			pos += n
+			if err := fn(fieldNum, val, nil); err != nil {
+				return err
+			}
+
+		case 2: // Length-delimited
+			length, n := decodeVarint(data[pos:])
+			if n == 0 {
+				return ErrInvalidProtobuf
+			}
+			pos += n
+			if length > uint64(len(data)-pos) {
+				return ErrInvalidProtobuf
+			}
+			fieldData := data[pos : pos+int(length)]
+			pos += int(length)
+			if err := fn(fieldNum, 0, fieldData); err != nil {
+				return err
+			}
+
+		case 5: // 32-bit
+			if pos+4 > len(data) {
+				return ErrInvalidProtobuf
+			}
+			val := binary.LittleEndian.Uint32(data[pos:])
+			pos += 4
+			if err := fn(fieldNum, uint64(val), nil); err != nil {
+				return err
+			}
+
+		case 1: // 64-bit
+			if pos+8 > len(data) {
+				return ErrInvalidProtobuf
+			}
+			val := binary.LittleEndian.Uint64(data[pos:])
+			pos += 8
+			if err := fn(fieldNum, val, nil); err != nil {
+				return err
+			}
+
+		default:
+			return ErrUnsupportedType
+		}
+	}
+
+	if pos > len(data) {
+		return ErrInvalidProtobuf
+	}
+	return nil
+}
+
+// String returns the string representation of the request/response type
+func (rr StoreForwardRR) String() string {
+	names := map[StoreForwardRR]string{
+		StoreForwardUnset:               "UNSET",
+		StoreForwardRouterError:         "ROUTER_ERROR",
+		StoreForwardRouterHeartbeat:     "ROUTER_HEARTBEAT",
+		StoreForwardRouterPing:          "ROUTER_PING",
+		StoreForwardRouterPong:          "ROUTER_PONG",
+		StoreForwardRouterBusy:          "ROUTER_BUSY",
+		StoreForwardRouterHistory:       "ROUTER_HISTORY",
+		StoreForwardRouterStats:         "ROUTER_STATS",
+		StoreForwardRouterTextDirect:    "ROUTER_TEXT_DIRECT",
+		StoreForwardRouterTextBroadcast: "ROUTER_TEXT_BROADCAST",
+		StoreForwardClientError:         "CLIENT_ERROR",
+		StoreForwardClientHistory:       "CLIENT_HISTORY",
+		StoreForwardClientStats:         "CLIENT_STATS",
+		StoreForwardClientPing:          "CLIENT_PING",
+		StoreForwardClientPong:          "CLIENT_PONG",
+		StoreForwardClientAbort:         "CLIENT_ABORT",
+	}
+	if name, ok := names[rr]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
@@ -0,0 +1,102 @@
+package meshtastic
+
+import "math"
+
+// Telemetry is the payload of TELEMETRY_APP packets. Device and
+// environment metrics are modeled; other variants leave both nil.
+type Telemetry struct {
+	// Time is when the metrics were measured, in seconds since the epoch
+	Time               uint32
+	DeviceMetrics      *DeviceMetrics
+	EnvironmentMetrics *EnvironmentMetrics
+}
+
+// EnvironmentMetrics are readings from a node's environment sensors.
+// Readings the sensor does not provide are zero.
+type EnvironmentMetrics struct {
+	Temperature        float32 // degrees Celsius
+	RelativeHumidity   float32 // percent
+	BarometricPressure float32 // hPa
+	GasResistance      float32 // MOhm
+	IAQ                uint32  // indoor air quality index
+	Lux                float32
+}
+
+// parseTelemetry parses a Telemetry message from protobuf bytes
+func parseTelemetry(data []byte) (*Telemetry, error) {
+	t := &Telemetry{}
+	err := walkFields(data, func(fieldNum, val uint64, fieldData []byte) error {
+		switch fieldNum {
+		case 1:
+			t.Time = uint32(val)
+		case 2:
+			dm, err := parseDeviceMetrics(fieldData)
+			if err != nil {
+				return err
+			}
+			t.DeviceMetrics = dm
+		case 3:
+			em, err := parseEnvironmentMetrics(fieldData)
+			if err != nil {
+				return err
+			}
+			t.EnvironmentMetrics = em
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// parseDeviceMetrics parses a DeviceMetrics message from protobuf bytes
+func parseDeviceMetrics(data []byte) (*DeviceMetrics, error) {
+	dm := &DeviceMetrics{}
+	err := walkFields(data, func(fieldNum, val uint64, _ []byte) error {
+		switch fieldNum {
+		case 1:
+			dm.BatteryLevel = uint32(val)
+		case 2:
+			dm.Voltage = math.Float32frombits(uint32(val))
+		case 3:
+			dm.ChannelUtilization = math.Float32frombits(uint32(val))
+		case 4:
+			dm.AirUtilTx = math.Float32frombits(uint32(val))
+		case 5:
+			dm.UptimeSeconds = uint32(val)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dm, nil
+}
+
+// parseEnvironmentMetrics parses an EnvironmentMetrics message from
+// protobuf bytes
+func parseEnvironmentMetrics(data []byte) (*EnvironmentMetrics, error) {
+	em := &EnvironmentMetrics{}
+	err := walkFields(data, func(fieldNum, val uint64, _ []byte) error {
+		switch fieldNum {
+		case 1:
+			em.Temperature = math.Float32frombits(uint32(val))
+		case 2:
+			em.RelativeHumidity = math.Float32frombits(uint32(val))
+		case 3:
+			em.BarometricPressure = math.Float32frombits(uint32(val))
+		case 4:
+			em.GasResistance = math.Float32frombits(uint32(val))
+		case 7:
+			em.IAQ = uint32(val)
+		case 9:
+			em.Lux = math.Float32frombits(uint32(val))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return em, nil
+}
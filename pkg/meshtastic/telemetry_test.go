@@ -0,0 +1,24 @@
+package meshtastic
+
+import "testing"
+
+func TestParseEnvironmentTelemetry(t *testing.T) {
+	var env []byte
+	env = appendFloat32Field(env, 1, 21.5)
+	env = appendFloat32Field(env, 2, 40)
+	env = appendFloat32Field(env, 3, 1013.25)
+	env = appendUint32Field(env, 7, 55)
+	data := appendBytesField(appendFixed32Field(nil, 1, 1700000000), 3, env)
+
+	tm, err := parseTelemetry(data)
+	if err != nil {
+		t.Fatalf("parseTelemetry: %v", err)
+	}
+	if tm.DeviceMetrics != nil {
+		t.Error("environment report decoded as device metrics")
+	}
+	em := tm.EnvironmentMetrics
+	if em == nil || em.Temperature != 21.5 || em.RelativeHumidity != 40 || em.BarometricPressure != 1013.25 || em.IAQ != 55 {
+		t.Errorf("environment metrics = %+v", em)
+	}
+}
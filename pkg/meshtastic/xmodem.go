@@ -0,0 +1,128 @@
+package meshtastic
+
+import "fmt"
+
+// XModemControl is the control byte of an XModem packet
+type XModemControl uint32
+
+// XModem control values as used by the Meshtastic firmware
+const (
+	XModemNUL   XModemControl = 0
+	XModemSOH   XModemControl = 1
+	XModemSTX   XModemControl = 2
+	XModemEOT   XModemControl = 4
+	XModemACK   XModemControl = 6
+	XModemNAK   XModemControl = 21
+	XModemCAN   XModemControl = 24
+	XModemCTRLZ XModemControl = 26
+)
+
+// XModemBlockSize is the payload size of a single XModem packet
+const XModemBlockSize = 128
+
+// String returns the string representation of the control value
+func (c XModemControl) String() string {
+	switch c {
+	case XModemNUL:
+		return "NUL"
+	case XModemSOH:
+		return "SOH"
+	case XModemSTX:
+		return "STX"
+	case XModemEOT:
+		return "EOT"
+	case XModemACK:
+		return "ACK"
+	case XModemNAK:
+		return "NAK"
+	case XModemCAN:
+		return "CAN"
+	case XModemCTRLZ:
+		return "CTRLZ"
+	default:
+		return fmt.Sprintf("XMODEM(%d)", uint32(c))
+	}
+}
+
+// XModem is a single packet of the XModem file transfer protocol
+type XModem struct {
+	Control XModemControl
+	Seq     uint32
+	CRC16   uint32
+	Buffer  []byte
+}
+
+// Marshal encodes the XModem message
+func (x *XModem) Marshal() []byte {
+	buf := []byte{}
+	buf = appendUint32Field(buf, 1, uint32(x.Control))
+	buf = appendUint32Field(buf, 2, x.Seq)
+	buf = appendUint32Field(buf, 3, x.CRC16)
+	buf = appendBytesField(buf, 4, x.Buffer)
+	return buf
+}
+
+// ParseXModem parses an XModem message from protobuf bytes
+func ParseXModem(data []byte) (*XModem, error) {
+	x := &XModem{}
+	pos := 0
+
+	for pos < len(data) {
+		tag := data[pos]
+		fieldNum := tag >> 3
+		wireType := tag & 0x07
+		pos++
+
+		switch wireType {
+		case 0: // Varint
+			val, n := decodeVarint(data[pos:])
+			if n == 0 {
+				return nil, ErrInvalidProtobuf
+			}
+			pos += n
+			switch fieldNum {
+			case 1:
+				x.Control = XModemControl(val)
+			case 2:
+				x.Seq = uint32(val)
+			case 3:
+				x.CRC16 = uint32(val)
+			}
+
+		case 2: // Length-delimited
+			length, n := decodeVarint(data[pos:])
+			if n == 0 {
+				return nil, ErrInvalidProtobuf
+			}
+			pos += n
+			if length > uint64(len(data)-pos) {
+				return nil, ErrInvalidProtobuf
+			}
+			if fieldNum == 4 {
+				x.Buffer = data[pos : pos+int(length)]
+			}
+			pos += int(length)
+
+		default:
+			return nil, ErrUnsupportedType
+		}
+	}
+
+	return x, nil
+}
+
+// CRC16 computes the CRC-16/XMODEM (CCITT, poly 0x1021, init 0) checksum
+func CRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}